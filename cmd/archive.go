@@ -0,0 +1,148 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/spf13/cobra"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export all periods and meetings to a JSON archive",
+	Long: `Export all periods, meetings, polls and votes together with the audit log and
+the hash chains of the meetings to a JSON archive that can be imported with
+"import", also into another storage backend.
+
+The archive is gzip compressed if the file name ends with ".gz".`,
+	Run: func(cmd *cobra.Command, args []string) {
+		out, outErr := cmd.Flags().GetString("out")
+		if outErr != nil {
+			log.Fatalln("can't get flag \"out\"")
+		}
+		config := getConfig()
+		handler := openStorage(config)
+		defer closeDatabase(config, handler)
+		archive, exportErr := pollsdata.ExportArchive(context.Background(), handler, pollsweb.NewSystemClock().Now())
+		if exportErr != nil {
+			log.Fatalln("export failed:", exportErr)
+		}
+		if out == "-" {
+			if writeErr := pollsdata.WriteArchive(os.Stdout, archive, false); writeErr != nil {
+				log.Fatalln("can't write archive:", writeErr)
+			}
+			return
+		}
+		file, createErr := os.Create(out)
+		if createErr != nil {
+			log.Fatalln("can't create archive:", createErr)
+		}
+		writeErr := pollsdata.WriteArchive(file, archive, strings.HasSuffix(out, ".gz"))
+		// close explicitly: an error on close (for example when the data is flushed) means the archive is incomplete
+		closeErr := file.Close()
+		if writeErr != nil {
+			log.Fatalln("can't write archive:", writeErr)
+		}
+		if closeErr != nil {
+			log.Fatalln("can't write archive:", closeErr)
+		}
+		fmt.Printf("exported %d periods, %d meetings, %d audit entries and %d chain entries to %s\n",
+			len(archive.Periods), len(archive.Meetings), len(archive.AuditEntries), len(archive.Chains), out)
+	},
+}
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import <archive>",
+	Short: "Import a JSON archive created with export",
+	Long: `Import all periods and meetings from an archive created with "export", use
+"-" to read from stdin. The archive is verified before anything is written,
+all ids from the archive are kept.
+
+With mode "merge" (the default) periods and meetings with an existing id are
+skipped, the import fails if a period or meeting with the same name or slug but
+another id exists, existing audit and hash chain entries are skipped. With mode
+"replace" all periods, meetings, audit entries and hash chains are deleted
+before the archive is imported.
+
+The import is written in a single transaction: if it fails nothing is imported
+(and nothing deleted). With MongoDB this requires a replica set.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		modeString, modeErr := cmd.Flags().GetString("mode")
+		if modeErr != nil {
+			log.Fatalln("can't get flag \"mode\"")
+		}
+		mode, parseErr := pollsdata.ParseArchiveImportMode(modeString)
+		if parseErr != nil {
+			log.Fatalln(parseErr)
+		}
+		verifyOnly, verifyErr := cmd.Flags().GetBool("verify-only")
+		if verifyErr != nil {
+			log.Fatalln("can't get flag \"verify-only\"")
+		}
+		var r io.Reader = os.Stdin
+		if args[0] != "-" {
+			file, openErr := os.Open(args[0])
+			if openErr != nil {
+				log.Fatalln("can't open archive:", openErr)
+			}
+			defer file.Close()
+			r = file
+		}
+		archive, readErr := pollsdata.ReadArchive(r)
+		if readErr != nil {
+			log.Fatalln(readErr)
+		}
+		if verifyOnly {
+			if verifyErr := archive.Verify(); verifyErr != nil {
+				log.Fatalln(verifyErr)
+			}
+			fmt.Printf("archive is valid: %d periods and %d meetings\n", len(archive.Periods), len(archive.Meetings))
+			return
+		}
+		config := getConfig()
+		handler := openStorage(config)
+		defer closeDatabase(config, handler)
+		res, importErr := pollsdata.ImportArchive(context.Background(), handler, archive, mode)
+		if importErr != nil {
+			log.Fatalln("import failed:", importErr)
+		}
+		if mode == pollsdata.ArchiveImportReplace {
+			fmt.Printf("deleted %d periods, %d meetings, %d audit entries and %d chain entries\n",
+				res.PeriodsDeleted, res.MeetingsDeleted, res.AuditEntriesDeleted, res.ChainEntriesDeleted)
+		}
+		fmt.Printf("imported %d periods (%d skipped) and %d meetings (%d skipped)\n",
+			res.PeriodsImported, res.PeriodsSkipped, res.MeetingsImported, res.MeetingsSkipped)
+		fmt.Printf("imported %d audit entries (%d skipped) and %d chain entries (%d skipped)\n",
+			res.AuditEntriesImported, res.AuditEntriesSkipped, res.ChainEntriesImported, res.ChainEntriesSkipped)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+	exportCmd.Flags().String("out", "-", "The file to write the archive to, \"-\" for stdout")
+	importCmd.Flags().String("mode", "merge", "How to handle existing data: \"merge\" or \"replace\"")
+	importCmd.Flags().Bool("verify-only", false, "Only verify the archive, don't import it")
+}
@@ -0,0 +1,175 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/FabianWe/pollsweb/server"
+	"github.com/asaskevich/govalidator"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"text/tabwriter"
+)
+
+// dbCmd represents the db command
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the database",
+	Long: `Commands to set up and upgrade the database.
+
+A new database is created with "db init", after an update of pollsweb
+"db migrate" applies the changes to the stored documents. The server
+refuses to start while migrations are pending.`,
+}
+
+var dbInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the collections and indexes",
+	Long: `Create all collections and indexes (including the unique constraints on
+names and slugs). It is safe to run init on an existing database.
+
+If the database is empty all migrations are recorded as applied, there
+is nothing to migrate. On an existing database run "db migrate"
+afterwards.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfig()
+		handler := connectDatabase(config)
+		defer closeDatabase(config, handler)
+		ctx := context.Background()
+		collections, collectionsErr := handler.CreateCollections(ctx)
+		for _, name := range collections {
+			fmt.Println("created collection", name)
+		}
+		if collectionsErr != nil {
+			log.Fatalln("can't create collections:", collectionsErr)
+		}
+		indexes, indexesErr := handler.CreateIndexes(ctx)
+		if indexesErr != nil {
+			log.Fatalln("can't create indexes:", indexesErr)
+		}
+		fmt.Printf("%d indexes exist\n", len(indexes))
+		empty, emptyErr := handler.IsEmpty(ctx)
+		if emptyErr != nil {
+			log.Fatalln("can't check if the database is empty:", emptyErr)
+		}
+		if !empty {
+			fmt.Println(`database is not empty, run "db migrate" to apply pending migrations`)
+			return
+		}
+		marked, markErr := handler.Migrator().MarkApplied(ctx)
+		for _, migration := range marked {
+			fmt.Printf("recorded migration %d as applied: %s\n", migration.Version, migration.Description)
+		}
+		if markErr != nil {
+			log.Fatalln("can't record migrations:", markErr)
+		}
+	},
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply all pending migrations",
+	Long: `Apply all migrations that are not applied yet, migrations are recorded in
+the migrations collection. Use "db status" to list the migrations.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfig()
+		handler := connectDatabase(config)
+		defer closeDatabase(config, handler)
+		applied, migrateErr := handler.Migrator().Migrate(context.Background())
+		for _, migration := range applied {
+			fmt.Printf("applied migration %d: %s\n", migration.Version, migration.Description)
+		}
+		if migrateErr != nil {
+			log.Fatalln(migrateErr)
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+	},
+}
+
+var dbStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show which migrations are applied",
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfig()
+		handler := connectDatabase(config)
+		defer closeDatabase(config, handler)
+		status, statusErr := handler.Migrator().Status(context.Background())
+		if statusErr != nil {
+			log.Fatalln("can't get migrations:", statusErr)
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "VERSION\tAPPLIED\tDESCRIPTION")
+		for _, migrationStatus := range status {
+			applied := "pending"
+			if migrationStatus.IsApplied() {
+				applied = migrationStatus.Applied.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(writer, "%d\t%s\t%s\n", migrationStatus.Migration.Version, applied,
+				migrationStatus.Migration.Description)
+		}
+		if flushErr := writer.Flush(); flushErr != nil {
+			log.Fatalln(flushErr)
+		}
+	},
+}
+
+// validateConfig validates the config, it exits on error.
+func validateConfig(config *server.AppConfig) {
+	if ok, validateErr := govalidator.ValidateStruct(config); !ok || validateErr != nil {
+		log.Fatalf("invalid config file, validation failed: ok=%v, error=%v\n", ok, validateErr)
+	}
+}
+
+// connectDatabase validates the config and connects to the mongodb database, it exits on error.
+// The db commands only work with the mongo storage driver, other drivers set up the storage when it is opened.
+func connectDatabase(config *server.AppConfig) *pollsdata.MongoDataHandler {
+	if config.Storage.Driver != pollsdata.MongoStorageDriverName {
+		log.Fatalf("the db commands require the storage driver \"%s\", got \"%s\"\n",
+			pollsdata.MongoStorageDriverName, config.Storage.Driver)
+	}
+	return openStorage(config).(*pollsdata.MongoDataHandler)
+}
+
+// openStorage validates the config and opens the configured storage, it exits on error.
+func openStorage(config *server.AppConfig) pollsdata.DataHandler {
+	validateConfig(config)
+	ctx, cancel := context.WithTimeout(context.Background(), config.Storage.Timeout)
+	defer cancel()
+	handler, openErr := pollsdata.OpenStorage(ctx, config.Storage.Driver, config.Storage.DriverConfigs)
+	if openErr != nil {
+		log.Fatalln("can't open storage:", openErr)
+	}
+	return handler
+}
+
+func closeDatabase(config *server.AppConfig, handler pollsdata.DataHandler) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.Storage.Timeout)
+	defer cancel()
+	if closeErr := handler.Close(ctx); closeErr != nil {
+		log.Println("error closing database connection:", closeErr)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbInitCmd)
+	dbCmd.AddCommand(dbMigrateCmd)
+	dbCmd.AddCommand(dbStatusCmd)
+}
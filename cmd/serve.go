@@ -55,7 +55,14 @@ to quickly create a Cobra application.`,
 		if portErr != nil {
 			log.Fatalln("can't get flag \"port\"")
 		}
-		server.RunServerMongo(config, templateRoot, host, port, true)
+		allowPending, allowPendingErr := cmd.Flags().GetBool("allow-pending-migrations")
+		if allowPendingErr != nil {
+			log.Fatalln("can't get flag \"allow-pending-migrations\"")
+		}
+		if allowPending {
+			config.Storage.AllowPendingMigrations = true
+		}
+		server.RunServer(config, templateRoot, host, port, true)
 	},
 }
 
@@ -64,4 +71,5 @@ func init() {
 	serveCmd.PersistentFlags().String("template-root", "", "The directory containing the template files (.gohtml), default is to look for it in the directory where the executable is")
 	serveCmd.PersistentFlags().String("host", "localhost", "The host to run on")
 	serveCmd.PersistentFlags().Int("port", 8080, "The port to run on")
+	serveCmd.PersistentFlags().Bool("allow-pending-migrations", false, "Start even if the database has pending migrations (see \"db migrate\")")
 }
@@ -32,6 +32,12 @@ func getConfig() *server.AppConfig {
 	if unmarshalErr != nil {
 		log.Fatalln("invalid config file:", unmarshalErr)
 	}
+	driversErr := config.Storage.DecodeDriverConfigs(func(key string, dst interface{}) error {
+		return viper.UnmarshalKey(key, dst)
+	})
+	if driversErr != nil {
+		log.Fatalln("invalid config file:", driversErr)
+	}
 	return config
 }
 
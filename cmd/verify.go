@@ -0,0 +1,157 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the integrity of stored data",
+}
+
+var verifyMeetingCmd = &cobra.Command{
+	Use:   "meeting <slug>",
+	Short: "Verify the hash chain of a meeting",
+	Long: `Recompute the hash chain of a meeting and compare it with the stored votes
+and audit log entries of the meeting.
+
+All problems are reported: changed, inserted or removed chain entries and votes
+or audit entries that were changed, deleted or stored without being linked into
+the chain. The exit status is 1 if a problem was found.
+
+The hash of the last entry is printed as "head". If it is published (for example
+in the minutes of the meeting) it proves later that the chain has not been
+replaced as a whole: pass the published head with --head, it must be the hash of
+an entry of the chain. Entries appended after the head was published are fine.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		publishedHead, headErr := cmd.Flags().GetString("head")
+		if headErr != nil {
+			log.Fatalln("can't get flag \"head\"")
+		}
+		config := getConfig()
+		handler := openStorage(config)
+		defer closeDatabase(config, handler)
+		ctx := context.Background()
+		slug := args[0]
+		meeting, getErr := handler.GetMeeting(ctx, pollsdata.NewMeetingQueryArgs().SetSlug(&slug))
+		if getErr != nil {
+			log.Fatalln("can't get meeting:", getErr)
+		}
+		report, verifyErr := pollsdata.VerifyMeetingChain(ctx, handler, meeting)
+		if verifyErr != nil {
+			log.Fatalln("verification failed:", verifyErr)
+		}
+		fmt.Printf("meeting %s (%s)\n", meeting.Name, meeting.Id)
+		fmt.Printf("%d chain entries, %d votes, %d audit entries\n", report.NumEntries, report.NumVotes, report.NumAuditEntries)
+		fmt.Println("head", report.Head)
+		if publishedHead != "" {
+			if sequence := report.CheckPublishedHead(publishedHead); sequence > 0 {
+				fmt.Printf("published head is entry %d, %d entries were appended since then\n",
+					sequence, int64(report.NumEntries)-sequence)
+			}
+		}
+		if report.Valid() {
+			fmt.Println("the chain is valid, no manipulation found")
+			return
+		}
+		for _, problem := range report.Problems {
+			fmt.Println("problem:", problem)
+		}
+		fmt.Printf("the chain is NOT valid, found %d problems\n", len(report.Problems))
+		// exit explicitly, deferred functions are not run by os.Exit
+		closeDatabase(config, handler)
+		os.Exit(1)
+	},
+}
+
+var verifyChainsCmd = &cobra.Command{
+	Use:   "chains",
+	Short: "Verify the hash chains of all meetings, including deleted meetings",
+	Long: `Verify all stored hash chains like "verify meeting" does.
+
+Chains and audit entries are kept when a meeting is deleted (also when a period
+is deleted together with its meetings). The polls and votes of a deleted meeting
+are gone, so for these chains only the entries themselves and the audit entries
+of the meeting are checked. The exit status is 1 if a problem was found.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfig()
+		handler := openStorage(config)
+		defer closeDatabase(config, handler)
+		reports, verifyErr := pollsdata.VerifyAllChains(context.Background(), handler)
+		if verifyErr != nil {
+			log.Fatalln("verification failed:", verifyErr)
+		}
+		numProblems := 0
+		for _, report := range reports {
+			if report.MeetingDeleted {
+				fmt.Printf("meeting %s (deleted)\n", report.MeetingId)
+			} else {
+				fmt.Printf("meeting %s\n", report.MeetingId)
+			}
+			fmt.Printf("%d chain entries, %d votes, %d audit entries\n", report.NumEntries, report.NumVotes, report.NumAuditEntries)
+			fmt.Println("head", report.Head)
+			for _, problem := range report.Problems {
+				fmt.Println("problem:", problem)
+			}
+			numProblems += len(report.Problems)
+		}
+		if numProblems == 0 {
+			fmt.Printf("%d chains are valid, no manipulation found\n", len(reports))
+			return
+		}
+		fmt.Printf("the chains are NOT valid, found %d problems\n", numProblems)
+		// exit explicitly, deferred functions are not run by os.Exit
+		closeDatabase(config, handler)
+		os.Exit(1)
+	},
+}
+
+var verifyLinkCmd = &cobra.Command{
+	Use:   "link",
+	Short: "Link polls, votes and audit entries stored before hash chains into the chains",
+	Long: `Link the polls, votes and audit entries of all meetings that are not linked
+into the hash chain of their meeting yet, for example because they were stored
+before hash chains were introduced. Entries that are already linked are not
+changed, changed entries are still reported by "verify meeting".
+
+With MongoDB this is done by the migrations ("db migrate").`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfig()
+		handler := openStorage(config)
+		defer closeDatabase(config, handler)
+		num, linkErr := pollsdata.LinkAllUnchainedRecords(context.Background(), handler)
+		fmt.Printf("linked %d records\n", num)
+		if linkErr != nil {
+			log.Fatalln("linking failed:", linkErr)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	verifyCmd.AddCommand(verifyMeetingCmd)
+	verifyCmd.AddCommand(verifyChainsCmd)
+	verifyCmd.AddCommand(verifyLinkCmd)
+	verifyMeetingCmd.Flags().String("head", "", "A head of the chain published earlier (for example in the minutes), it must be contained in the chain")
+}
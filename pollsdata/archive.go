@@ -0,0 +1,670 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/pollsweb"
+	"github.com/google/uuid"
+	"time"
+)
+
+// ArchiveFormatVersion is the version of the archive format (Archive).
+//
+// It is increased whenever a field is removed or its meaning changes, archives with another version are rejected.
+const ArchiveFormatVersion = 1
+
+// Archive contains all periods and meetings (with their polls and votes) of a DataHandler together with the audit
+// log and the hash chains of the meetings.
+//
+// The archive is independent of the storage backend, see ExportArchive and ImportArchive.
+// Checksum is the hex encoded sha256 checksum of the content (see ComputeChecksum), it is used to detect archives
+// that were modified or truncated.
+// AuditEntries and Chains were added later, they are empty in older archives.
+type Archive struct {
+	Version      int                  `json:"version"`
+	Created      time.Time            `json:"created"`
+	Periods      []*ArchivePeriod     `json:"periods"`
+	Meetings     []*ArchiveMeeting    `json:"meetings"`
+	AuditEntries []*ArchiveAuditEntry `json:"audit_entries,omitempty"`
+	Chains       []*ArchiveChainEntry `json:"chains,omitempty"`
+	Checksum     string               `json:"checksum"`
+}
+
+// NewArchive returns a new archive with the current format version, the checksum is not computed.
+func NewArchive(created time.Time) *Archive {
+	return &Archive{
+		Version:      ArchiveFormatVersion,
+		Created:      created,
+		Periods:      make([]*ArchivePeriod, 0),
+		Meetings:     make([]*ArchiveMeeting, 0),
+		AuditEntries: make([]*ArchiveAuditEntry, 0),
+		Chains:       make([]*ArchiveChainEntry, 0),
+		Checksum:     "",
+	}
+}
+
+// ComputeChecksum computes the checksum of the content (everything except the creation time and the checksum) of the
+// archive. Empty audit entries and chains are omitted, so the checksum of older archives doesn't change.
+func (archive *Archive) ComputeChecksum() (string, error) {
+	content := struct {
+		Version      int                  `json:"version"`
+		Periods      []*ArchivePeriod     `json:"periods"`
+		Meetings     []*ArchiveMeeting    `json:"meetings"`
+		AuditEntries []*ArchiveAuditEntry `json:"audit_entries,omitempty"`
+		Chains       []*ArchiveChainEntry `json:"chains,omitempty"`
+	}{archive.Version, archive.Periods, archive.Meetings, archive.AuditEntries, archive.Chains}
+	encoded, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// UpdateChecksum sets the checksum to the checksum of the current content.
+func (archive *Archive) UpdateChecksum() error {
+	checksum, err := archive.ComputeChecksum()
+	if err != nil {
+		return err
+	}
+	archive.Checksum = checksum
+	return nil
+}
+
+// ArchiveVerificationError is returned if an archive is not valid, see Archive.Verify.
+// Wrapped is the cause of the error (for example a ModelValidationError), it can be nil.
+type ArchiveVerificationError struct {
+	pollsweb.PollWebError
+	Message string
+	Wrapped error
+}
+
+func NewArchiveVerificationError(message string, wrapped error) ArchiveVerificationError {
+	return ArchiveVerificationError{
+		Message: message,
+		Wrapped: wrapped,
+	}
+}
+
+func (e ArchiveVerificationError) Error() string {
+	if e.Wrapped == nil {
+		return "invalid archive: " + e.Message
+	}
+	return fmt.Sprintf("invalid archive: %s: %v", e.Message, e.Wrapped)
+}
+
+func (e ArchiveVerificationError) Unwrap() error {
+	return e.Wrapped
+}
+
+// Verify checks the integrity of the archive: the version must be supported, the checksum must match, ids, names and
+// slugs must be unique, all meetings must reference a period in the archive and all models must be valid.
+// The chains must be complete and linked (see verifyChains), the records they reference are not checked: the
+// meetings of some chains may have been deleted, use VerifyChain to check the chain of a meeting.
+// It returns an ArchiveVerificationError if the archive is not valid.
+func (archive *Archive) Verify() error {
+	if archive.Version != ArchiveFormatVersion {
+		return NewArchiveVerificationError(fmt.Sprintf("unsupported version %d, expected version %d",
+			archive.Version, ArchiveFormatVersion), nil)
+	}
+	checksum, checksumErr := archive.ComputeChecksum()
+	if checksumErr != nil {
+		return checksumErr
+	}
+	if checksum != archive.Checksum {
+		return NewArchiveVerificationError("checksum does not match, the archive was modified", nil)
+	}
+	periodIds := make(map[uuid.UUID]struct{}, len(archive.Periods))
+	periodSlugs := make(map[string]struct{}, len(archive.Periods))
+	periodNames := make(map[string]struct{}, len(archive.Periods))
+	for _, period := range archive.Periods {
+		if _, exists := periodIds[period.Id]; exists {
+			return NewArchiveVerificationError(fmt.Sprintf("duplicate period id %s", period.Id), nil)
+		}
+		if _, exists := periodSlugs[period.Slug]; exists {
+			return NewArchiveVerificationError(fmt.Sprintf("duplicate period slug \"%s\"", period.Slug), nil)
+		}
+		if _, exists := periodNames[period.Name]; exists {
+			return NewArchiveVerificationError(fmt.Sprintf("duplicate period name \"%s\"", period.Name), nil)
+		}
+		periodIds[period.Id] = struct{}{}
+		periodSlugs[period.Slug] = struct{}{}
+		periodNames[period.Name] = struct{}{}
+		if validateErr := period.ToModel().ValidateModel(); validateErr != nil {
+			return NewArchiveVerificationError(fmt.Sprintf("invalid period \"%s\"", period.Slug), validateErr)
+		}
+	}
+	meetingIds := make(map[uuid.UUID]struct{}, len(archive.Meetings))
+	meetingSlugs := make(map[string]struct{}, len(archive.Meetings))
+	meetingNames := make(map[string]struct{}, len(archive.Meetings))
+	for _, meeting := range archive.Meetings {
+		if _, exists := meetingIds[meeting.Id]; exists {
+			return NewArchiveVerificationError(fmt.Sprintf("duplicate meeting id %s", meeting.Id), nil)
+		}
+		if _, exists := meetingSlugs[meeting.Slug]; exists {
+			return NewArchiveVerificationError(fmt.Sprintf("duplicate meeting slug \"%s\"", meeting.Slug), nil)
+		}
+		if _, exists := meetingNames[meeting.Name]; exists {
+			return NewArchiveVerificationError(fmt.Sprintf("duplicate meeting name \"%s\"", meeting.Name), nil)
+		}
+		meetingIds[meeting.Id] = struct{}{}
+		meetingSlugs[meeting.Slug] = struct{}{}
+		meetingNames[meeting.Name] = struct{}{}
+		if _, exists := periodIds[meeting.PeriodId]; !exists {
+			return NewArchiveVerificationError(fmt.Sprintf("meeting \"%s\" references the unknown period %s",
+				meeting.Slug, meeting.PeriodId), nil)
+		}
+		model, modelErr := meeting.ToModel()
+		if modelErr != nil {
+			return NewArchiveVerificationError(fmt.Sprintf("invalid meeting \"%s\"", meeting.Slug), modelErr)
+		}
+		if validateErr := model.ValidateModel(); validateErr != nil {
+			return NewArchiveVerificationError(fmt.Sprintf("invalid meeting \"%s\"", meeting.Slug), validateErr)
+		}
+	}
+	auditIds := make(map[uuid.UUID]struct{}, len(archive.AuditEntries))
+	for _, entry := range archive.AuditEntries {
+		if _, exists := auditIds[entry.Id]; exists {
+			return NewArchiveVerificationError(fmt.Sprintf("duplicate audit entry id %s", entry.Id), nil)
+		}
+		auditIds[entry.Id] = struct{}{}
+	}
+	return archive.verifyChains()
+}
+
+// verifyChains checks that the chain entries are sorted by meeting and sequence number, that the chain of each meeting
+// is complete (starting with sequence number 1) and that each entry is linked to its predecessor and matches its hash.
+func (archive *Archive) verifyChains() error {
+	chainIds := make(map[uuid.UUID]struct{}, len(archive.Chains))
+	meetings := make(map[uuid.UUID]struct{})
+	var previous *ArchiveChainEntry
+	for _, archiveEntry := range archive.Chains {
+		entry := archiveEntry.ToModel()
+		if _, exists := chainIds[entry.Id]; exists {
+			return NewArchiveVerificationError(fmt.Sprintf("duplicate chain entry id %s", entry.Id), nil)
+		}
+		chainIds[entry.Id] = struct{}{}
+		expectedSequence, expectedPrevious := int64(1), ChainGenesisHash
+		if previous != nil && previous.MeetingId == entry.MeetingId {
+			expectedSequence, expectedPrevious = previous.Sequence+1, previous.Hash
+		} else {
+			if _, exists := meetings[entry.MeetingId]; exists {
+				return NewArchiveVerificationError(fmt.Sprintf("the chain of meeting %s is not sorted", entry.MeetingId), nil)
+			}
+			meetings[entry.MeetingId] = struct{}{}
+		}
+		switch {
+		case entry.Sequence != expectedSequence:
+			return NewArchiveVerificationError(fmt.Sprintf("chain of meeting %s: expected sequence number %d, got %d",
+				entry.MeetingId, expectedSequence, entry.Sequence), nil)
+		case entry.PreviousHash != expectedPrevious:
+			return NewArchiveVerificationError(fmt.Sprintf("chain of meeting %s: entry %d is not linked to the previous entry",
+				entry.MeetingId, entry.Sequence), nil)
+		case entry.Hash != entry.ComputeHash():
+			return NewArchiveVerificationError(fmt.Sprintf("chain of meeting %s: hash of entry %d doesn't match its content",
+				entry.MeetingId, entry.Sequence), nil)
+		}
+		previous = archiveEntry
+	}
+	return nil
+}
+
+type ArchiveMeetingTime struct {
+	Weekday time.Weekday `json:"weekday"`
+	Hour    uint8        `json:"hour"`
+	Minute  uint8        `json:"minute"`
+}
+
+type ArchiveVoter struct {
+	Id     uuid.UUID      `json:"id"`
+	Name   string         `json:"name"`
+	Slug   string         `json:"slug"`
+	Weight gopolls.Weight `json:"weight"`
+	Email  string         `json:"email,omitempty"`
+}
+
+func newArchiveVoters(voters []*VoterModel) []*ArchiveVoter {
+	res := make([]*ArchiveVoter, len(voters))
+	for i, voter := range voters {
+		res[i] = &ArchiveVoter{
+			Id:     voter.Id,
+			Name:   voter.Name,
+			Slug:   voter.Slug,
+			Weight: voter.Weight,
+			Email:  voter.Email,
+		}
+	}
+	return res
+}
+
+func archiveVotersToModels(voters []*ArchiveVoter) []*VoterModel {
+	res := make([]*VoterModel, len(voters))
+	for i, voter := range voters {
+		model := NewVoterModel(voter.Name, voter.Slug, voter.Weight)
+		model.Id = voter.Id
+		model.Email = voter.Email
+		res[i] = model
+	}
+	return res
+}
+
+type ArchivePeriod struct {
+	Id          uuid.UUID           `json:"id"`
+	Name        string              `json:"name"`
+	Slug        string              `json:"slug"`
+	MeetingTime *ArchiveMeetingTime `json:"meeting_time"`
+	Voters      []*ArchiveVoter     `json:"voters"`
+	Start       time.Time           `json:"start"`
+	End         time.Time           `json:"end"`
+	Created     time.Time           `json:"created"`
+	LastUpdated time.Time           `json:"last_updated"`
+	Archived    time.Time           `json:"archived"`
+}
+
+func NewArchivePeriod(period *PeriodSettingsModel) *ArchivePeriod {
+	res := &ArchivePeriod{
+		Id:          period.Id,
+		Name:        period.Name,
+		Slug:        period.Slug,
+		MeetingTime: nil,
+		Voters:      newArchiveVoters(period.Voters),
+		Start:       period.Start,
+		End:         period.End,
+		Created:     period.Created,
+		LastUpdated: period.LastUpdated,
+		Archived:    period.Archived,
+	}
+	if template := period.MeetingDateTemplate; template != nil {
+		res.MeetingTime = &ArchiveMeetingTime{
+			Weekday: template.Weekday,
+			Hour:    template.Hour,
+			Minute:  template.Minute,
+		}
+	}
+	return res
+}
+
+// ToModel returns the period stored in the archive.
+func (period *ArchivePeriod) ToModel() *PeriodSettingsModel {
+	res := &PeriodSettingsModel{
+		IdModel:             NewIdModel(period.Id),
+		Name:                period.Name,
+		Slug:                period.Slug,
+		MeetingDateTemplate: nil,
+		Voters:              archiveVotersToModels(period.Voters),
+		Start:               period.Start,
+		End:                 period.End,
+		Created:             period.Created,
+		LastUpdated:         period.LastUpdated,
+		Archived:            period.Archived,
+	}
+	if period.MeetingTime != nil {
+		res.MeetingDateTemplate = NewMeetingTimeTemplateModel(period.MeetingTime.Weekday,
+			period.MeetingTime.Hour, period.MeetingTime.Minute)
+	}
+	return res
+}
+
+// ArchiveVote is a vote of a poll, depending on the poll type Answer (basic), Value (median) or Ranking (schulze)
+// is set.
+type ArchiveVote struct {
+	Id        uuid.UUID                `json:"id"`
+	VoterName string                   `json:"voter_name"`
+	Slug      string                   `json:"slug"`
+	Answer    *gopolls.BasicPollAnswer `json:"answer,omitempty"`
+	Value     *gopolls.MedianUnit      `json:"value,omitempty"`
+	Ranking   gopolls.SchulzeRanking   `json:"ranking,omitempty"`
+}
+
+func newArchiveVote(vote *VoteModel) *ArchiveVote {
+	return &ArchiveVote{
+		Id:        vote.Id,
+		VoterName: vote.VoterName,
+		Slug:      vote.Slug,
+	}
+}
+
+func (vote *ArchiveVote) toVoteModel() *VoteModel {
+	res := NewVoteModel(vote.VoterName, vote.Slug)
+	res.Id = vote.Id
+	return res
+}
+
+type ArchiveMajority struct {
+	Numerator   int64 `json:"numerator"`
+	Denominator int64 `json:"denominator"`
+}
+
+// ArchivePoll is a poll of any type, Value and Currency are only set for median polls and Options only for schulze
+// polls.
+type ArchivePoll struct {
+	Id               uuid.UUID           `json:"id"`
+	Name             string              `json:"name"`
+	Slug             string              `json:"slug"`
+	Type             string              `json:"type"`
+	Majority         *ArchiveMajority    `json:"majority"`
+	AbsoluteMajority bool                `json:"absolute_majority"`
+	RollCall         bool                `json:"roll_call"`
+	State            string              `json:"state"`
+	Opened           time.Time           `json:"opened"`
+	Closed           time.Time           `json:"closed"`
+	Published        time.Time           `json:"published"`
+	Value            *gopolls.MedianUnit `json:"value,omitempty"`
+	Currency         string              `json:"currency,omitempty"`
+	Options          []string            `json:"options,omitempty"`
+	Votes            []*ArchiveVote      `json:"votes"`
+}
+
+func NewArchivePoll(poll AbstractPollModel) (*ArchivePoll, error) {
+	pollModel := poll.GetPollModel()
+	res := &ArchivePoll{
+		Id:               pollModel.Id,
+		Name:             pollModel.Name,
+		Slug:             pollModel.Slug,
+		Type:             pollModel.Type,
+		Majority:         nil,
+		AbsoluteMajority: pollModel.AbsoluteMajority,
+		RollCall:         pollModel.RollCall,
+		State:            pollModel.State,
+		Opened:           pollModel.Opened,
+		Closed:           pollModel.Closed,
+		Published:        pollModel.Published,
+	}
+	if pollModel.Majority != nil {
+		res.Majority = &ArchiveMajority{
+			Numerator:   pollModel.Majority.Numerator,
+			Denominator: pollModel.Majority.Denominator,
+		}
+	}
+	switch typedPoll := poll.(type) {
+	case *BasicPollModel:
+		res.Votes = make([]*ArchiveVote, len(typedPoll.Votes))
+		for i, vote := range typedPoll.Votes {
+			archiveVote := newArchiveVote(vote.VoteModel)
+			answer := vote.Answer
+			archiveVote.Answer = &answer
+			res.Votes[i] = archiveVote
+		}
+	case *MedianPollModel:
+		value := typedPoll.Value
+		res.Value = &value
+		res.Currency = typedPoll.Currency
+		res.Votes = make([]*ArchiveVote, len(typedPoll.Votes))
+		for i, vote := range typedPoll.Votes {
+			archiveVote := newArchiveVote(vote.VoteModel)
+			voteValue := vote.Value
+			archiveVote.Value = &voteValue
+			res.Votes[i] = archiveVote
+		}
+	case *SchulzePollModel:
+		res.Options = typedPoll.Options
+		res.Votes = make([]*ArchiveVote, len(typedPoll.Votes))
+		for i, vote := range typedPoll.Votes {
+			archiveVote := newArchiveVote(vote.VoteModel)
+			archiveVote.Ranking = vote.Ranking
+			res.Votes[i] = archiveVote
+		}
+	default:
+		return nil, fmt.Errorf("unsupported poll type %T", poll)
+	}
+	return res, nil
+}
+
+// ToModel returns the poll stored in the archive, it returns an error if the type is unknown or a vote doesn't
+// contain the value for the poll type.
+func (poll *ArchivePoll) ToModel() (AbstractPollModel, error) {
+	var majority *MajorityModel
+	if poll.Majority != nil {
+		majority = NewMajorityModel(poll.Majority.Numerator, poll.Majority.Denominator)
+	}
+	var res AbstractPollModel
+	switch poll.Type {
+	case BasicPollStringName:
+		votes := make([]*BasicPollVoteModel, len(poll.Votes))
+		for i, vote := range poll.Votes {
+			if vote.Answer == nil {
+				return nil, fmt.Errorf("vote %s of poll \"%s\" has no answer", vote.Slug, poll.Slug)
+			}
+			votes[i] = &BasicPollVoteModel{VoteModel: vote.toVoteModel(), Answer: *vote.Answer}
+		}
+		res = NewBasicPollModel(poll.Name, poll.Slug, majority, poll.AbsoluteMajority, votes)
+	case MedianPollStringName:
+		if poll.Value == nil {
+			return nil, fmt.Errorf("median poll \"%s\" has no value", poll.Slug)
+		}
+		votes := make([]*MedianPollVoteModel, len(poll.Votes))
+		for i, vote := range poll.Votes {
+			if vote.Value == nil {
+				return nil, fmt.Errorf("vote %s of poll \"%s\" has no value", vote.Slug, poll.Slug)
+			}
+			votes[i] = &MedianPollVoteModel{VoteModel: vote.toVoteModel(), Value: *vote.Value}
+		}
+		res = NewMedianPollModel(poll.Name, poll.Slug, majority, poll.AbsoluteMajority, *poll.Value, poll.Currency, votes)
+	case SchulzePollStringName:
+		votes := make([]*SchulzePollVoteModel, len(poll.Votes))
+		for i, vote := range poll.Votes {
+			votes[i] = &SchulzePollVoteModel{VoteModel: vote.toVoteModel(), Ranking: vote.Ranking}
+		}
+		res = NewSchulzePollModel(poll.Name, poll.Slug, majority, poll.AbsoluteMajority, poll.Options, votes)
+	default:
+		return nil, fmt.Errorf("invalid poll type \"%s\" of poll \"%s\"", poll.Type, poll.Slug)
+	}
+	pollModel := res.GetPollModel()
+	pollModel.Id = poll.Id
+	pollModel.RollCall = poll.RollCall
+	pollModel.State = poll.State
+	pollModel.Opened = poll.Opened
+	pollModel.Closed = poll.Closed
+	pollModel.Published = poll.Published
+	return res, nil
+}
+
+type ArchivePollGroup struct {
+	Id    uuid.UUID      `json:"id"`
+	Name  string         `json:"name"`
+	Slug  string         `json:"slug"`
+	Polls []*ArchivePoll `json:"polls"`
+}
+
+type ArchiveMeeting struct {
+	Id          uuid.UUID           `json:"id"`
+	Name        string              `json:"name"`
+	Slug        string              `json:"slug"`
+	PeriodId    uuid.UUID           `json:"period_id"`
+	Created     time.Time           `json:"created"`
+	MeetingTime time.Time           `json:"meeting_time"`
+	OnlineStart time.Time           `json:"online_start"`
+	OnlineEnd   time.Time           `json:"online_end"`
+	Voters      []*ArchiveVoter     `json:"voters"`
+	Groups      []*ArchivePollGroup `json:"groups"`
+	LastUpdated time.Time           `json:"last_updated"`
+	UpdateToken int64               `json:"update_token"`
+
+	NotificationsSent map[string]time.Time `json:"notifications_sent,omitempty"`
+	OnlineOpenedAt    time.Time            `json:"online_opened_at"`
+	OnlineClosedAt    time.Time            `json:"online_closed_at"`
+}
+
+func NewArchiveMeeting(meeting *MeetingModel) (*ArchiveMeeting, error) {
+	res := &ArchiveMeeting{
+		Id:          meeting.Id,
+		Name:        meeting.Name,
+		Slug:        meeting.Slug,
+		PeriodId:    meeting.PeriodId,
+		Created:     meeting.Created,
+		MeetingTime: meeting.MeetingTime,
+		OnlineStart: meeting.OnlineStart,
+		OnlineEnd:   meeting.OnlineEnd,
+		Voters:      newArchiveVoters(meeting.Voters),
+		Groups:      make([]*ArchivePollGroup, len(meeting.Groups)),
+		LastUpdated: meeting.LastUpdated,
+		UpdateToken: meeting.UpdateToken,
+
+		NotificationsSent: meeting.NotificationsSent,
+		OnlineOpenedAt:    meeting.OnlineOpenedAt,
+		OnlineClosedAt:    meeting.OnlineClosedAt,
+	}
+	for i, group := range meeting.Groups {
+		archiveGroup := &ArchivePollGroup{
+			Id:    group.Id,
+			Name:  group.Name,
+			Slug:  group.Slug,
+			Polls: make([]*ArchivePoll, len(group.Polls)),
+		}
+		for j, poll := range group.Polls {
+			archivePoll, pollErr := NewArchivePoll(poll)
+			if pollErr != nil {
+				return nil, pollErr
+			}
+			archiveGroup.Polls[j] = archivePoll
+		}
+		res.Groups[i] = archiveGroup
+	}
+	return res, nil
+}
+
+// ToModel returns the meeting stored in the archive.
+func (meeting *ArchiveMeeting) ToModel() (*MeetingModel, error) {
+	groups := make([]*PollGroupModel, len(meeting.Groups))
+	for i, group := range meeting.Groups {
+		polls := make([]AbstractPollModel, len(group.Polls))
+		for j, poll := range group.Polls {
+			pollModel, pollErr := poll.ToModel()
+			if pollErr != nil {
+				return nil, pollErr
+			}
+			polls[j] = pollModel
+		}
+		groupModel := NewPollGroupModel(group.Name, group.Slug, polls)
+		groupModel.Id = group.Id
+		groups[i] = groupModel
+	}
+	// the constructor would set created to the current time
+	res := &MeetingModel{
+		IdModel:     NewIdModel(meeting.Id),
+		Name:        meeting.Name,
+		Slug:        meeting.Slug,
+		Created:     meeting.Created,
+		PeriodId:    meeting.PeriodId,
+		MeetingTime: meeting.MeetingTime,
+		OnlineStart: meeting.OnlineStart,
+		OnlineEnd:   meeting.OnlineEnd,
+		Voters:      archiveVotersToModels(meeting.Voters),
+		Groups:      groups,
+		LastUpdated: meeting.LastUpdated,
+		UpdateToken: meeting.UpdateToken,
+
+		NotificationsSent: meeting.NotificationsSent,
+		OnlineOpenedAt:    meeting.OnlineOpenedAt,
+		OnlineClosedAt:    meeting.OnlineClosedAt,
+	}
+	return res, nil
+}
+
+// ArchiveAuditEntry is an entry of the audit log, see AuditEntryModel.
+type ArchiveAuditEntry struct {
+	Id         uuid.UUID         `json:"id"`
+	Time       time.Time         `json:"time"`
+	Actor      string            `json:"actor"`
+	RemoteAddr string            `json:"remote_addr"`
+	Action     string            `json:"action"`
+	PeriodId   uuid.UUID         `json:"period_id"`
+	MeetingId  uuid.UUID         `json:"meeting_id"`
+	PollId     uuid.UUID         `json:"poll_id"`
+	Details    map[string]string `json:"details"`
+}
+
+func NewArchiveAuditEntry(entry *AuditEntryModel) *ArchiveAuditEntry {
+	return &ArchiveAuditEntry{
+		Id:         entry.Id,
+		Time:       entry.Time,
+		Actor:      entry.Actor,
+		RemoteAddr: entry.RemoteAddr,
+		Action:     entry.Action,
+		PeriodId:   entry.PeriodId,
+		MeetingId:  entry.MeetingId,
+		PollId:     entry.PollId,
+		Details:    entry.Details,
+	}
+}
+
+// ToModel returns the audit entry stored in the archive.
+func (entry *ArchiveAuditEntry) ToModel() *AuditEntryModel {
+	details := entry.Details
+	if details == nil {
+		details = make(map[string]string)
+	}
+	return &AuditEntryModel{
+		IdModel:    NewIdModel(entry.Id),
+		Time:       entry.Time,
+		Actor:      entry.Actor,
+		RemoteAddr: entry.RemoteAddr,
+		Action:     entry.Action,
+		PeriodId:   entry.PeriodId,
+		MeetingId:  entry.MeetingId,
+		PollId:     entry.PollId,
+		Details:    details,
+	}
+}
+
+// ArchiveChainEntry is an entry of the hash chain of a meeting, see ChainEntryModel.
+type ArchiveChainEntry struct {
+	Id           uuid.UUID `json:"id"`
+	MeetingId    uuid.UUID `json:"meeting_id"`
+	Sequence     int64     `json:"sequence"`
+	Time         time.Time `json:"time"`
+	Kind         string    `json:"kind"`
+	RecordId     uuid.UUID `json:"record_id"`
+	PollId       uuid.UUID `json:"poll_id"`
+	Digest       string    `json:"digest"`
+	PreviousHash string    `json:"previous_hash"`
+	Hash         string    `json:"hash"`
+}
+
+func NewArchiveChainEntry(entry *ChainEntryModel) *ArchiveChainEntry {
+	return &ArchiveChainEntry{
+		Id:           entry.Id,
+		MeetingId:    entry.MeetingId,
+		Sequence:     entry.Sequence,
+		Time:         entry.Time,
+		Kind:         entry.Kind,
+		RecordId:     entry.RecordId,
+		PollId:       entry.PollId,
+		Digest:       entry.Digest,
+		PreviousHash: entry.PreviousHash,
+		Hash:         entry.Hash,
+	}
+}
+
+// ToModel returns the chain entry stored in the archive.
+func (entry *ArchiveChainEntry) ToModel() *ChainEntryModel {
+	return &ChainEntryModel{
+		IdModel:      NewIdModel(entry.Id),
+		MeetingId:    entry.MeetingId,
+		Sequence:     entry.Sequence,
+		Time:         entry.Time,
+		Kind:         entry.Kind,
+		RecordId:     entry.RecordId,
+		PollId:       entry.PollId,
+		Digest:       entry.Digest,
+		PreviousHash: entry.PreviousHash,
+		Hash:         entry.Hash,
+	}
+}
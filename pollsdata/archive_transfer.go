@@ -0,0 +1,348 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// archivePageSize is the number of periods / meetings / audit entries read at once during an export.
+const archivePageSize = 100
+
+// ExportArchive reads all periods (including archived periods), meetings and audit entries from the handler together
+// with all chains, including the chains of deleted meetings (chains are kept when a meeting is deleted, see
+// ChainHandler.GetChainMeetingIds). created is the creation time stored in the archive, the checksum of the archive is set.
+func ExportArchive(ctx context.Context, handler DataHandler, created time.Time) (*Archive, error) {
+	res := NewArchive(created)
+	periodQuery := NewPeriodListQuery().SetIncludeArchived(true).SetLimit(archivePageSize)
+	for {
+		page, pageErr := handler.ListPeriods(ctx, periodQuery)
+		if pageErr != nil {
+			return nil, pageErr
+		}
+		for _, period := range page.Periods {
+			res.Periods = append(res.Periods, NewArchivePeriod(period))
+		}
+		if !page.HasNext() {
+			break
+		}
+		periodQuery.SetCursor(page.NextCursor)
+	}
+	meetingQuery := NewMeetingListQuery().SetLimit(archivePageSize)
+	for {
+		page, pageErr := handler.ListMeetings(ctx, meetingQuery)
+		if pageErr != nil {
+			return nil, pageErr
+		}
+		for _, summary := range page.Meetings {
+			id := summary.Id
+			meeting, meetingErr := handler.GetMeeting(ctx, NewMeetingQueryArgs().SetId(&id))
+			if meetingErr != nil {
+				return nil, meetingErr
+			}
+			archiveMeeting, archiveErr := NewArchiveMeeting(meeting)
+			if archiveErr != nil {
+				return nil, archiveErr
+			}
+			res.Meetings = append(res.Meetings, archiveMeeting)
+		}
+		if !page.HasNext() {
+			break
+		}
+		meetingQuery.SetCursor(page.NextCursor)
+	}
+	auditErr := AllAuditEntries(ctx, handler, NewAuditQuery().SetLimit(archivePageSize), func(entry *AuditEntryModel) error {
+		res.AuditEntries = append(res.AuditEntries, NewArchiveAuditEntry(entry))
+		return nil
+	})
+	if auditErr != nil {
+		return nil, auditErr
+	}
+	chainMeetings, idsErr := handler.GetChainMeetingIds(ctx)
+	if idsErr != nil {
+		return nil, idsErr
+	}
+	for _, meetingId := range chainMeetings {
+		chain, chainErr := handler.GetChain(ctx, meetingId)
+		if chainErr != nil {
+			return nil, chainErr
+		}
+		for _, entry := range chain {
+			res.Chains = append(res.Chains, NewArchiveChainEntry(entry))
+		}
+	}
+	if checksumErr := res.UpdateChecksum(); checksumErr != nil {
+		return nil, checksumErr
+	}
+	return res, nil
+}
+
+// WriteArchive writes the archive as json, if compress is true the output is gzip compressed.
+func WriteArchive(w io.Writer, archive *Archive, compress bool) error {
+	if !compress {
+		return json.NewEncoder(w).Encode(archive)
+	}
+	gzipWriter := gzip.NewWriter(w)
+	if encodeErr := json.NewEncoder(gzipWriter).Encode(archive); encodeErr != nil {
+		_ = gzipWriter.Close()
+		return encodeErr
+	}
+	return gzipWriter.Close()
+}
+
+// ReadArchive reads an archive written by WriteArchive, gzip compressed archives are detected automatically.
+// The archive is not verified, see Archive.Verify.
+func ReadArchive(r io.Reader) (*Archive, error) {
+	reader := bufio.NewReader(r)
+	var src io.Reader = reader
+	// gzip magic number
+	if header, peekErr := reader.Peek(2); peekErr == nil && header[0] == 0x1f && header[1] == 0x8b {
+		gzipReader, gzipErr := gzip.NewReader(reader)
+		if gzipErr != nil {
+			return nil, gzipErr
+		}
+		defer gzipReader.Close()
+		src = gzipReader
+	}
+	var res Archive
+	if decodeErr := json.NewDecoder(src).Decode(&res); decodeErr != nil {
+		return nil, NewArchiveVerificationError("can't decode archive", decodeErr)
+	}
+	return &res, nil
+}
+
+// ArchiveImportMode describes how an archive is imported if the handler already contains data.
+type ArchiveImportMode int8
+
+const (
+	// ArchiveImportMerge keeps the existing data: periods and meetings with an id that already exists are skipped,
+	// a period or meeting with an existing slug or name but another id is a conflict.
+	ArchiveImportMerge ArchiveImportMode = iota
+	// ArchiveImportReplace deletes all periods and meetings before the archive is imported.
+	ArchiveImportReplace
+)
+
+func (mode ArchiveImportMode) String() string {
+	switch mode {
+	case ArchiveImportMerge:
+		return "merge"
+	case ArchiveImportReplace:
+		return "replace"
+	default:
+		return fmt.Sprintf("ArchiveImportMode(%d)", mode)
+	}
+}
+
+// ParseArchiveImportMode parses the mode from its string representation ("merge" or "replace").
+func ParseArchiveImportMode(s string) (ArchiveImportMode, error) {
+	switch s {
+	case "merge":
+		return ArchiveImportMerge, nil
+	case "replace":
+		return ArchiveImportReplace, nil
+	default:
+		return ArchiveImportMerge, fmt.Errorf("invalid import mode \"%s\"", s)
+	}
+}
+
+// ArchiveImportData is the content of an archive that is written by ArchiveImportHandler.WriteImport.
+// ChainEntries must be sorted by meeting and sequence number.
+type ArchiveImportData struct {
+	// Replace deletes all periods and meetings before the data is written
+	Replace      bool
+	Periods      []*PeriodSettingsModel
+	Meetings     []*MeetingModel
+	AuditEntries []*AuditEntryModel
+	ChainEntries []*ChainEntryModel
+}
+
+// ArchiveWriteResult is the result of ArchiveImportHandler.WriteImport.
+type ArchiveWriteResult struct {
+	PeriodsDeleted      int64
+	MeetingsDeleted     int64
+	AuditEntriesDeleted int64
+	ChainEntriesDeleted int64
+	AuditEntriesWritten int
+	ChainEntriesWritten int
+}
+
+// ArchiveImportHandler writes the content of imported archives, see ImportArchive.
+type ArchiveImportHandler interface {
+	// WriteImport writes the data in a single transaction: either everything is written or nothing
+	// (MongoDataHandler only guarantees this if the deployment supports transactions). If data.Replace is true all
+	// periods, meetings, audit entries and chain entries are deleted first: the archive replaces the whole history,
+	// old chains would not match the imported meetings.
+	// All models are validated and inserted with their ids, a DuplicateEntryError is returned if an id, name or slug
+	// already exists and an EntryNotFoundError if the period of a meeting doesn't exist.
+	//
+	// Otherwise the audit log and the chains are append-only: audit entries with an existing id are skipped, as are
+	// chain entries whose id is already stored with the same meeting and sequence number. Another entry with the same
+	// meeting and sequence number is a DuplicateEntryError (the chain would fork).
+	WriteImport(ctx context.Context, data *ArchiveImportData) (*ArchiveWriteResult, error)
+}
+
+// ArchiveImportResult describes the changes of ImportArchive.
+type ArchiveImportResult struct {
+	PeriodsDeleted       int64
+	MeetingsDeleted      int64
+	AuditEntriesDeleted  int64
+	ChainEntriesDeleted  int64
+	PeriodsImported      int
+	PeriodsSkipped       int
+	MeetingsImported     int
+	MeetingsSkipped      int
+	AuditEntriesImported int
+	AuditEntriesSkipped  int
+	ChainEntriesImported int
+	ChainEntriesSkipped  int
+}
+
+// ImportArchive verifies the archive and writes its content to the handler, see ArchiveImportMode.
+//
+// All ids are kept. In merge mode all conflicts are checked before anything is written and audit entries and chain
+// entries are merged, in replace mode they're replaced as well, see ArchiveImportHandler. The data is written with
+// ArchiveImportHandler.WriteImport, so the import is atomic: if an error occurs (for example because of a conflict
+// with a concurrent change) nothing is imported and in replace mode nothing is deleted.
+func ImportArchive(ctx context.Context, handler DataHandler, archive *Archive, mode ArchiveImportMode) (*ArchiveImportResult, error) {
+	if verifyErr := archive.Verify(); verifyErr != nil {
+		return nil, verifyErr
+	}
+	res := &ArchiveImportResult{}
+	data := &ArchiveImportData{
+		Replace:      mode == ArchiveImportReplace,
+		Periods:      make([]*PeriodSettingsModel, 0, len(archive.Periods)),
+		Meetings:     make([]*MeetingModel, 0, len(archive.Meetings)),
+		AuditEntries: make([]*AuditEntryModel, len(archive.AuditEntries)),
+		ChainEntries: make([]*ChainEntryModel, len(archive.Chains)),
+	}
+	for i, entry := range archive.AuditEntries {
+		data.AuditEntries[i] = entry.ToModel()
+	}
+	for i, entry := range archive.Chains {
+		data.ChainEntries[i] = entry.ToModel()
+	}
+	for _, period := range archive.Periods {
+		if !data.Replace {
+			skip, checkErr := checkPeriodImport(ctx, handler, period)
+			if checkErr != nil {
+				return nil, checkErr
+			}
+			if skip {
+				res.PeriodsSkipped++
+				continue
+			}
+		}
+		data.Periods = append(data.Periods, period.ToModel())
+	}
+	for _, meeting := range archive.Meetings {
+		if !data.Replace {
+			skip, checkErr := checkMeetingImport(ctx, handler, meeting)
+			if checkErr != nil {
+				return nil, checkErr
+			}
+			if skip {
+				res.MeetingsSkipped++
+				continue
+			}
+		}
+		model, modelErr := meeting.ToModel()
+		if modelErr != nil {
+			return nil, modelErr
+		}
+		data.Meetings = append(data.Meetings, model)
+	}
+	written, writeErr := handler.WriteImport(ctx, data)
+	if writeErr != nil {
+		return nil, fmt.Errorf("can't import archive: %w", writeErr)
+	}
+	res.PeriodsDeleted, res.MeetingsDeleted = written.PeriodsDeleted, written.MeetingsDeleted
+	res.AuditEntriesDeleted, res.ChainEntriesDeleted = written.AuditEntriesDeleted, written.ChainEntriesDeleted
+	res.PeriodsImported, res.MeetingsImported = len(data.Periods), len(data.Meetings)
+	res.AuditEntriesImported = written.AuditEntriesWritten
+	res.AuditEntriesSkipped = len(data.AuditEntries) - written.AuditEntriesWritten
+	res.ChainEntriesImported = written.ChainEntriesWritten
+	res.ChainEntriesSkipped = len(data.ChainEntries) - written.ChainEntriesWritten
+	return res, nil
+}
+
+func isEntryNotFound(err error) bool {
+	var notFound EntryNotFoundError
+	return errors.As(err, &notFound)
+}
+
+// importConflictError returns an ArchiveVerificationError for an entry of the archive that has the same value for
+// field as an existing entry with another id.
+func importConflictError(kind, field, value string) error {
+	return NewArchiveVerificationError(fmt.Sprintf("conflict: a %s with %s \"%s\" but another id already exists",
+		kind, field, value), nil)
+}
+
+// checkPeriodImport checks if the period can be imported in merge mode: skip is true if a period with the same id
+// exists, an error is returned if another period has the same slug or name.
+func checkPeriodImport(ctx context.Context, handler DataHandler, period *ArchivePeriod) (skip bool, err error) {
+	id, slug, name := period.Id, period.Slug, period.Name
+	_, getErr := handler.GetPeriod(ctx, NewPeriodSettingsQueryArgs().SetId(&id))
+	if getErr == nil {
+		return true, nil
+	}
+	if !isEntryNotFound(getErr) {
+		return false, getErr
+	}
+	if _, getErr = handler.GetPeriod(ctx, NewPeriodSettingsQueryArgs().SetSlug(&slug)); !isEntryNotFound(getErr) {
+		if getErr != nil {
+			return false, getErr
+		}
+		return false, importConflictError("period", "slug", slug)
+	}
+	if _, getErr = handler.GetPeriod(ctx, NewPeriodSettingsQueryArgs().SetName(&name)); !isEntryNotFound(getErr) {
+		if getErr != nil {
+			return false, getErr
+		}
+		return false, importConflictError("period", "name", name)
+	}
+	return false, nil
+}
+
+// checkMeetingImport works like checkPeriodImport for meetings.
+func checkMeetingImport(ctx context.Context, handler DataHandler, meeting *ArchiveMeeting) (skip bool, err error) {
+	id, slug, name := meeting.Id, meeting.Slug, meeting.Name
+	_, getErr := handler.GetMeeting(ctx, NewMeetingQueryArgs().SetId(&id))
+	if getErr == nil {
+		return true, nil
+	}
+	if !isEntryNotFound(getErr) {
+		return false, getErr
+	}
+	if _, getErr = handler.GetMeeting(ctx, NewMeetingQueryArgs().SetSlug(&slug)); !isEntryNotFound(getErr) {
+		if getErr != nil {
+			return false, getErr
+		}
+		return false, importConflictError("meeting", "slug", slug)
+	}
+	if _, getErr = handler.GetMeeting(ctx, NewMeetingQueryArgs().SetName(&name)); !isEntryNotFound(getErr) {
+		if getErr != nil {
+			return false, getErr
+		}
+		return false, importConflictError("meeting", "name", name)
+	}
+	return false, nil
+}
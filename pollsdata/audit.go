@@ -0,0 +1,390 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/FabianWe/pollsweb"
+	"github.com/google/uuid"
+	"reflect"
+	"sort"
+	"time"
+)
+
+var auditEntryModelType = reflect.TypeOf(EmptyAuditEntryModel())
+
+// Actions recorded in the audit log.
+const (
+	AuditPeriodCreated        = "period.created"
+	AuditPeriodDeleted        = "period.deleted"
+	AuditPeriodArchived       = "period.archived"
+	AuditPeriodVotersUpdated  = "period.voters_updated"
+	AuditPeriodRenamed        = "period.renamed"
+	AuditMeetingCreated       = "meeting.created"
+	AuditMeetingVotersUpdated = "meeting.voters_updated"
+	AuditMeetingPollsUpdated  = "meeting.polls_updated"
+	AuditPollStateChanged     = "poll.state_changed"
+	AuditVoteCast             = "vote.cast"
+	AuditResultsPublished     = "results.published"
+	AuditWebhookCreated       = "webhook.created"
+	AuditWebhookDeleted       = "webhook.deleted"
+)
+
+// AllAuditActions contains all audit actions in the order they should be displayed.
+var AllAuditActions = []string{
+	AuditPeriodCreated,
+	AuditPeriodDeleted,
+	AuditPeriodArchived,
+	AuditPeriodVotersUpdated,
+	AuditPeriodRenamed,
+	AuditMeetingCreated,
+	AuditMeetingVotersUpdated,
+	AuditMeetingPollsUpdated,
+	AuditPollStateChanged,
+	AuditVoteCast,
+	AuditResultsPublished,
+	AuditWebhookCreated,
+	AuditWebhookDeleted,
+}
+
+// IsAuditAction returns true if s is one of the constants in AllAuditActions.
+func IsAuditAction(s string) bool {
+	for _, action := range AllAuditActions {
+		if s == action {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditEntryModel records a single administrative or voting action.
+//
+// Actor is the one who performed the action (for example the user name from the request or "scheduler"), RemoteAddr
+// is the address the request came from (empty for actions not caused by a request).
+// PeriodId, MeetingId and PollId are the ids of the affected models, they are uuid.Nil if the action doesn't affect
+// such a model. Details contains additional action specific information, for example the new state of a poll.
+// Entries for votes never contain the content of the vote.
+type AuditEntryModel struct {
+	*IdModel   `bson:",inline"`
+	Time       time.Time
+	Actor      string
+	RemoteAddr string
+	Action     string
+	PeriodId   uuid.UUID
+	MeetingId  uuid.UUID
+	PollId     uuid.UUID
+	Details    map[string]string
+}
+
+func EmptyAuditEntryModel() *AuditEntryModel {
+	return &AuditEntryModel{
+		IdModel:    EmptyIdModel(),
+		Time:       time.Time{},
+		Actor:      "",
+		RemoteAddr: "",
+		Action:     "",
+		PeriodId:   uuid.Nil,
+		MeetingId:  uuid.Nil,
+		PollId:     uuid.Nil,
+		Details:    make(map[string]string),
+	}
+}
+
+// NewAuditEntryModel returns a new entry for the action at the current time of the clock.
+func NewAuditEntryModel(clock pollsweb.Clock, actor, remoteAddr, action string) *AuditEntryModel {
+	return &AuditEntryModel{
+		IdModel:    EmptyIdModel(),
+		Time:       clock.Now(),
+		Actor:      actor,
+		RemoteAddr: remoteAddr,
+		Action:     action,
+		PeriodId:   uuid.Nil,
+		MeetingId:  uuid.Nil,
+		PollId:     uuid.Nil,
+		Details:    make(map[string]string),
+	}
+}
+
+func (m *AuditEntryModel) SetPeriodId(id uuid.UUID) *AuditEntryModel {
+	m.PeriodId = id
+	return m
+}
+
+func (m *AuditEntryModel) SetMeetingId(id uuid.UUID) *AuditEntryModel {
+	m.MeetingId = id
+	return m
+}
+
+func (m *AuditEntryModel) SetPollId(id uuid.UUID) *AuditEntryModel {
+	m.PollId = id
+	return m
+}
+
+// SetDetail sets the value of a detail, the entry is returned.
+func (m *AuditEntryModel) SetDetail(key, value string) *AuditEntryModel {
+	if m.Details == nil {
+		m.Details = make(map[string]string)
+	}
+	m.Details[key] = value
+	return m
+}
+
+func (m *AuditEntryModel) String() string {
+	return fmt.Sprintf("AuditEntryModel(Id=%s, Time=%s, Actor=%s, RemoteAddr=%s, Action=%s, PeriodId=%s, MeetingId=%s, PollId=%s, Details=%v)",
+		m.Id, m.Time, m.Actor, m.RemoteAddr, m.Action, m.PeriodId, m.MeetingId, m.PollId, m.Details)
+}
+
+// DefaultAuditListLimit is the number of entries on a page if AuditQuery.Limit is not set.
+const DefaultAuditListLimit = 50
+
+// AuditQuery describes which entries are returned by AuditHandler.ListAuditEntries.
+//
+// All filters are optional, the zero value of a filter matches all entries:
+// Action and Actor must be equal to the action / actor of the entry, PeriodId, MeetingId and PollId match the entries
+// that affected that model and From and To restrict the time to From <= Time < To.
+//
+// The result is sorted by time, the most recent entry comes first. Limit is the maximum number of entries returned
+// (DefaultAuditListLimit if Limit <= 0). Cursor is the NextCursor of the previous page and is empty for the first
+// page.
+type AuditQuery struct {
+	Action    string
+	Actor     string
+	PeriodId  *uuid.UUID
+	MeetingId *uuid.UUID
+	PollId    *uuid.UUID
+	From      time.Time
+	To        time.Time
+	Limit     int64
+	Cursor    string
+}
+
+// NewAuditQuery returns a query that matches all entries.
+func NewAuditQuery() *AuditQuery {
+	return &AuditQuery{
+		Action:    "",
+		Actor:     "",
+		PeriodId:  nil,
+		MeetingId: nil,
+		PollId:    nil,
+		From:      time.Time{},
+		To:        time.Time{},
+		Limit:     DefaultAuditListLimit,
+		Cursor:    "",
+	}
+}
+
+func (query *AuditQuery) SetAction(action string) *AuditQuery {
+	query.Action = action
+	return query
+}
+
+func (query *AuditQuery) SetActor(actor string) *AuditQuery {
+	query.Actor = actor
+	return query
+}
+
+func (query *AuditQuery) SetPeriodId(periodId *uuid.UUID) *AuditQuery {
+	query.PeriodId = periodId
+	return query
+}
+
+func (query *AuditQuery) SetMeetingId(meetingId *uuid.UUID) *AuditQuery {
+	query.MeetingId = meetingId
+	return query
+}
+
+func (query *AuditQuery) SetPollId(pollId *uuid.UUID) *AuditQuery {
+	query.PollId = pollId
+	return query
+}
+
+func (query *AuditQuery) SetFrom(from time.Time) *AuditQuery {
+	query.From = from
+	return query
+}
+
+func (query *AuditQuery) SetTo(to time.Time) *AuditQuery {
+	query.To = to
+	return query
+}
+
+func (query *AuditQuery) SetLimit(limit int64) *AuditQuery {
+	query.Limit = limit
+	return query
+}
+
+func (query *AuditQuery) SetCursor(cursor string) *AuditQuery {
+	query.Cursor = cursor
+	return query
+}
+
+// GetLimit returns the maximum number of entries on a page.
+func (query *AuditQuery) GetLimit() int64 {
+	if query.Limit <= 0 {
+		return DefaultAuditListLimit
+	}
+	return query.Limit
+}
+
+// Matches returns true if the entry matches all filters of the query, the cursor is ignored.
+func (query *AuditQuery) Matches(entry *AuditEntryModel) bool {
+	if query.Action != "" && entry.Action != query.Action {
+		return false
+	}
+	if query.Actor != "" && entry.Actor != query.Actor {
+		return false
+	}
+	if query.PeriodId != nil && entry.PeriodId != *query.PeriodId {
+		return false
+	}
+	if query.MeetingId != nil && entry.MeetingId != *query.MeetingId {
+		return false
+	}
+	if query.PollId != nil && entry.PollId != *query.PollId {
+		return false
+	}
+	if !query.From.IsZero() && entry.Time.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && !entry.Time.Before(query.To) {
+		return false
+	}
+	return true
+}
+
+// AuditCursor is the decoded version of AuditPage.NextCursor, it contains the time and id of the last entry on a page.
+type AuditCursor struct {
+	Time time.Time `json:"time"`
+	Id   uuid.UUID `json:"id"`
+}
+
+// DecodeAuditCursor decodes the cursor of the query, it returns nil if the query has no cursor.
+// It returns an InvalidQueryArgsError if the cursor is invalid.
+func DecodeAuditCursor(query *AuditQuery) (*AuditCursor, error) {
+	if query.Cursor == "" {
+		return nil, nil
+	}
+	var res AuditCursor
+	if err := DecodeCursor(query.Cursor, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// After returns true if the entry comes after the cursor, that is if it is older than the last entry of the page.
+func (cursor *AuditCursor) After(entry *AuditEntryModel) bool {
+	return compareAuditEntries(entry.Time, entry.Id, cursor.Time, cursor.Id) < 0
+}
+
+// compareAuditEntries compares two entries by time (and by id if the times are equal).
+func compareAuditEntries(timeA time.Time, idA uuid.UUID, timeB time.Time, idB uuid.UUID) int {
+	if res := compareTimes(timeA, timeB); res != 0 {
+		return res
+	}
+	return bytes.Compare(idA[:], idB[:])
+}
+
+// AuditPage is a page of entries returned by AuditHandler.ListAuditEntries.
+// NextCursor is the cursor to get the next page, it is empty if this is the last page.
+type AuditPage struct {
+	Entries    []*AuditEntryModel
+	NextCursor string
+}
+
+// HasNext returns true if there is another page.
+func (page *AuditPage) HasNext() bool {
+	return page.NextCursor != ""
+}
+
+// NewAuditPage returns a page given the entries matching the query (and cursor) in sort order.
+// entries may contain more elements than the limit of the query, in this case the result is truncated and
+// NextCursor is set.
+func NewAuditPage(query *AuditQuery, entries []*AuditEntryModel) (*AuditPage, error) {
+	limit := query.GetLimit()
+	res := &AuditPage{
+		Entries:    entries,
+		NextCursor: "",
+	}
+	if int64(len(entries)) > limit {
+		res.Entries = entries[:limit]
+		last := res.Entries[limit-1]
+		cursor, cursorErr := EncodeCursor(&AuditCursor{Time: last.Time, Id: last.Id})
+		if cursorErr != nil {
+			return nil, cursorErr
+		}
+		res.NextCursor = cursor
+	}
+	return res, nil
+}
+
+// ListAuditEntries applies the query to a list of entries, it implements AuditHandler.ListAuditEntries for entries in
+// memory. The entries are not modified.
+func ListAuditEntries(entries []*AuditEntryModel, query *AuditQuery) (*AuditPage, error) {
+	cursor, cursorErr := DecodeAuditCursor(query)
+	if cursorErr != nil {
+		return nil, cursorErr
+	}
+	matching := make([]*AuditEntryModel, 0, len(entries))
+	for _, entry := range entries {
+		if !query.Matches(entry) {
+			continue
+		}
+		if cursor != nil && !cursor.After(entry) {
+			continue
+		}
+		matching = append(matching, entry)
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return compareAuditEntries(matching[i].Time, matching[i].Id, matching[j].Time, matching[j].Id) > 0
+	})
+	return NewAuditPage(query, matching)
+}
+
+// AllAuditEntries calls ListAuditEntries until all entries matching the query are read, the cursor of the query is
+// ignored. f is called for each entry, if it returns an error no further entries are read and the error is returned.
+func AllAuditEntries(ctx context.Context, handler AuditHandler, query *AuditQuery, f func(entry *AuditEntryModel) error) error {
+	pageQuery := *query
+	pageQuery.Cursor = ""
+	for {
+		page, err := handler.ListAuditEntries(ctx, &pageQuery)
+		if err != nil {
+			return err
+		}
+		for _, entry := range page.Entries {
+			if fErr := f(entry); fErr != nil {
+				return fErr
+			}
+		}
+		if !page.HasNext() {
+			return nil
+		}
+		pageQuery.Cursor = page.NextCursor
+	}
+}
+
+// AuditHandler stores the audit log.
+//
+// The log is append-only: there are no methods to change or delete entries, entries are not deleted together with
+// the models they reference.
+type AuditHandler interface {
+	// InsertAuditEntry inserts a new entry, the id of the entry is set by the handler.
+	InsertAuditEntry(ctx context.Context, entry *AuditEntryModel) (uuid.UUID, error)
+
+	// ListAuditEntries returns the entries matching the query, the most recent entry comes first.
+	// It returns an InvalidQueryArgsError if the cursor is invalid.
+	ListAuditEntries(ctx context.Context, query *AuditQuery) (*AuditPage, error)
+}
@@ -0,0 +1,1371 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/FabianWe/pollsweb"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// The buckets used by BoltDataHandler. The entries are stored by id (the bytes of the uuid), the values are encoded
+// with bson, this is the same representation as in mongodb.
+// The index buckets map the unique names and slugs to the ids of the entries. The keys of the chain bucket are the
+// meeting id followed by the sequence number, so the entries of a chain are stored in order.
+var (
+	boltPeriodsBucket           = []byte("periodsettings")
+	boltPeriodNamesBucket       = []byte("periodsettings.name")
+	boltPeriodSlugsBucket       = []byte("periodsettings.slug")
+	boltMeetingsBucket          = []byte("meetings")
+	boltMeetingNamesBucket      = []byte("meetings.name")
+	boltMeetingSlugsBucket      = []byte("meetings.slug")
+	boltWebhooksBucket          = []byte("webhooks")
+	boltWebhookDeliveriesBucket = []byte("webhookdeliveries")
+	boltAuditBucket             = []byte("audit")
+	boltChainBucket             = []byte("chain")
+)
+
+var boltBuckets = [][]byte{
+	boltPeriodsBucket,
+	boltPeriodNamesBucket,
+	boltPeriodSlugsBucket,
+	boltMeetingsBucket,
+	boltMeetingNamesBucket,
+	boltMeetingSlugsBucket,
+	boltWebhooksBucket,
+	boltWebhookDeliveriesBucket,
+	boltAuditBucket,
+	boltChainBucket,
+}
+
+// BoltStorageDriverName is the name of the bolt storage driver, its config section is "bolt".
+const BoltStorageDriverName = "bolt"
+
+func init() {
+	RegisterStorageDriver(&StorageDriver{
+		Name:      BoltStorageDriverName,
+		ConfigKey: "bolt",
+		NewConfig: func() interface{} {
+			return NewBoltConfig()
+		},
+		Open: func(ctx context.Context, config interface{}) (DataHandler, error) {
+			// bolt doesn't support contexts, wait for the file lock until the deadline
+			var timeout time.Duration
+			if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+				timeout = time.Until(deadline)
+				if timeout <= 0 {
+					return nil, context.DeadlineExceeded
+				}
+			}
+			handler, err := OpenBoltDataHandler(config.(*BoltConfig).Path, timeout)
+			if err != nil {
+				return nil, err
+			}
+			return handler, nil
+		},
+	})
+}
+
+// BoltConfig is the config of the bolt storage driver.
+type BoltConfig struct {
+	// Path is the path of the database file, it is created if it doesn't exist
+	Path string `valid:"stringlength(1|4096)"`
+}
+
+func NewBoltConfig() *BoltConfig {
+	return &BoltConfig{
+		Path: "pollsweb.db",
+	}
+}
+
+// BoltDataHandler is a DataHandler that stores everything in a single bbolt file, it is meant for small deployments
+// without a mongodb server.
+//
+// The names and slugs of periods and meetings are unique, a DuplicateEntryError is returned if an insert or update
+// violates this. Queries are evaluated in memory and have the same semantics as the queries of MongoDataHandler.
+// All operations run in a single transaction and are atomic.
+type BoltDataHandler struct {
+	DB *bolt.DB
+	// Clock is used to set the last updated time of periods and meetings, the transition times of polls, the time of
+	// chain entries and the time of audit entries, webhooks and deliveries if it is not set
+	Clock pollsweb.Clock
+}
+
+func NewBoltDataHandler(db *bolt.DB) *BoltDataHandler {
+	return &BoltDataHandler{
+		DB:    db,
+		Clock: pollsweb.NewSystemClock(),
+	}
+}
+
+// OpenBoltDataHandler opens (or creates) the database file and creates all buckets.
+// timeout is the time to wait for the file lock, 0 means wait forever.
+func OpenBoltDataHandler(path string, timeout time.Duration) (*BoltDataHandler, error) {
+	db, openErr := bolt.Open(path, 0600, &bolt.Options{Timeout: timeout})
+	if openErr != nil {
+		return nil, openErr
+	}
+	res := NewBoltDataHandler(db)
+	if createErr := res.CreateBuckets(); createErr != nil {
+		_ = db.Close()
+		return nil, createErr
+	}
+	return res, nil
+}
+
+// CreateBuckets creates all buckets that don't exist yet.
+func (h *BoltDataHandler) CreateBuckets() error {
+	return h.DB.Update(func(tx *bolt.Tx) error {
+		for _, name := range boltBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return fmt.Errorf("can't create bucket \"%s\": %w", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// SetClock sets the clock of the handler.
+func (h *BoltDataHandler) SetClock(clock pollsweb.Clock) {
+	h.Clock = clock
+}
+
+func (h *BoltDataHandler) Close(ctx context.Context) error {
+	return h.DB.Close()
+}
+
+// view runs f in a read-only transaction, bolt doesn't support contexts so the context is only checked
+// before the transaction starts.
+func (h *BoltDataHandler) view(ctx context.Context, f func(tx *bolt.Tx) error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return h.DB.View(f)
+}
+
+// update runs f in a read-write transaction, see view.
+func (h *BoltDataHandler) update(ctx context.Context, f func(tx *bolt.Tx) error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return h.DB.Update(f)
+}
+
+func boltPut(bucket *bolt.Bucket, id uuid.UUID, value interface{}) error {
+	data, marshalErr := bson.Marshal(value)
+	if marshalErr != nil {
+		return marshalErr
+	}
+	return bucket.Put(id[:], data)
+}
+
+// boltLookup returns the id stored for the key in an index bucket, ok is false if the key doesn't exist.
+func boltLookup(index *bolt.Bucket, key string) (id uuid.UUID, ok bool, err error) {
+	value := index.Get([]byte(key))
+	if value == nil {
+		return
+	}
+	id, err = uuid.FromBytes(value)
+	ok = err == nil
+	return
+}
+
+// boltCheckUnique returns a DuplicateEntryError if the key is already used by an entry other than id.
+func boltCheckUnique(index *bolt.Bucket, model reflect.Type, field, key string, id uuid.UUID) error {
+	existing, ok, lookupErr := boltLookup(index, key)
+	if lookupErr != nil {
+		return lookupErr
+	}
+	if ok && existing != id {
+		return NewDuplicateEntryError(model, field, key)
+	}
+	return nil
+}
+
+// boltUpdateIndex replaces oldKey by newKey in an index bucket, oldKey can be empty for new entries.
+func boltUpdateIndex(index *bolt.Bucket, oldKey, newKey string, id uuid.UUID) error {
+	if oldKey != "" && oldKey != newKey {
+		if err := index.Delete([]byte(oldKey)); err != nil {
+			return err
+		}
+	}
+	return index.Put([]byte(newKey), id[:])
+}
+
+// boltIdQuery returns the id an entry must have to match a query by id, slug or name, ok is false if no entry can
+// match.
+func boltIdQuery(tx *bolt.Tx, id *uuid.UUID, slug, name *string, slugs, names []byte) (res uuid.UUID, ok bool, err error) {
+	switch {
+	case id != nil:
+		return *id, true, nil
+	case slug != nil:
+		return boltLookup(tx.Bucket(slugs), *slug)
+	default:
+		return boltLookup(tx.Bucket(names), *name)
+	}
+}
+
+// periods
+
+func boltDecodePeriod(data []byte) (*PeriodSettingsModel, error) {
+	res := EmptyPeriodSettingsModel()
+	if err := bson.Unmarshal(data, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (h *BoltDataHandler) getPeriod(tx *bolt.Tx, id uuid.UUID) (*PeriodSettingsModel, error) {
+	data := tx.Bucket(boltPeriodsBucket).Get(id[:])
+	if data == nil {
+		return nil, nil
+	}
+	return boltDecodePeriod(data)
+}
+
+// findPeriod returns the period matching args, all given fields of args must match.
+func (h *BoltDataHandler) findPeriod(tx *bolt.Tx, args *PeriodSettingsQueryArgs) (*PeriodSettingsModel, error) {
+	if args.Id == nil && args.Slug == nil && args.Name == nil {
+		return nil, ErrInvalidPeriodSettingsQuery
+	}
+	notFound := NewEntryNotFoundError(periodSettingsModelType, reflect.ValueOf(args), nil)
+	id, ok, lookupErr := boltIdQuery(tx, args.Id, args.Slug, args.Name, boltPeriodSlugsBucket, boltPeriodNamesBucket)
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+	if !ok {
+		return nil, notFound
+	}
+	period, getErr := h.getPeriod(tx, id)
+	if getErr != nil {
+		return nil, getErr
+	}
+	if period == nil ||
+		(args.Slug != nil && period.Slug != *args.Slug) ||
+		(args.Name != nil && period.Name != *args.Name) {
+		return nil, notFound
+	}
+	return period, nil
+}
+
+func (h *BoltDataHandler) allPeriods(tx *bolt.Tx) ([]*PeriodSettingsModel, error) {
+	res := make([]*PeriodSettingsModel, 0, 42)
+	err := tx.Bucket(boltPeriodsBucket).ForEach(func(k, v []byte) error {
+		period, decodeErr := boltDecodePeriod(v)
+		if decodeErr != nil {
+			return decodeErr
+		}
+		res = append(res, period)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// putPeriod checks the unique constraints, updates the indexes and writes the period.
+// old is the period before the change, nil for new periods.
+func (h *BoltDataHandler) putPeriod(tx *bolt.Tx, old, period *PeriodSettingsModel) error {
+	names, slugs := tx.Bucket(boltPeriodNamesBucket), tx.Bucket(boltPeriodSlugsBucket)
+	if err := boltCheckUnique(names, periodSettingsModelType, "name", period.Name, period.Id); err != nil {
+		return err
+	}
+	if err := boltCheckUnique(slugs, periodSettingsModelType, "slug", period.Slug, period.Id); err != nil {
+		return err
+	}
+	oldName, oldSlug := "", ""
+	if old != nil {
+		oldName, oldSlug = old.Name, old.Slug
+	}
+	if err := boltUpdateIndex(names, oldName, period.Name, period.Id); err != nil {
+		return err
+	}
+	if err := boltUpdateIndex(slugs, oldSlug, period.Slug, period.Id); err != nil {
+		return err
+	}
+	return boltPut(tx.Bucket(boltPeriodsBucket), period.Id, period)
+}
+
+func (h *BoltDataHandler) deletePeriod(tx *bolt.Tx, period *PeriodSettingsModel) error {
+	if err := tx.Bucket(boltPeriodNamesBucket).Delete([]byte(period.Name)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltPeriodSlugsBucket).Delete([]byte(period.Slug)); err != nil {
+		return err
+	}
+	return tx.Bucket(boltPeriodsBucket).Delete(period.Id[:])
+}
+
+func (h *BoltDataHandler) InsertPeriod(ctx context.Context, periodSettings *PeriodSettingsModel) (uuid.UUID, error) {
+	objectId, uuidErr := pollsweb.GenUUID()
+	if uuidErr != nil {
+		return objectId, uuidErr
+	}
+	periodSettings.Id = objectId
+	if validateErr := periodSettings.ValidateModel(); validateErr != nil {
+		return uuid.Nil, validateErr
+	}
+	insertErr := h.update(ctx, func(tx *bolt.Tx) error {
+		return h.putPeriod(tx, nil, periodSettings)
+	})
+	return objectId, insertErr
+}
+
+func (h *BoltDataHandler) GetPeriod(ctx context.Context, args *PeriodSettingsQueryArgs) (res *PeriodSettingsModel, err error) {
+	err = h.view(ctx, func(tx *bolt.Tx) error {
+		var findErr error
+		res, findErr = h.findPeriod(tx, args)
+		return findErr
+	})
+	return
+}
+
+// getPeriods returns all periods for which filter returns true.
+func (h *BoltDataHandler) getPeriods(ctx context.Context, filter func(period *PeriodSettingsModel) bool) (res []*PeriodSettingsModel, err error) {
+	err = h.view(ctx, func(tx *bolt.Tx) error {
+		periods, allErr := h.allPeriods(tx)
+		if allErr != nil {
+			return allErr
+		}
+		res = make([]*PeriodSettingsModel, 0, len(periods))
+		for _, period := range periods {
+			if filter(period) {
+				res = append(res, period)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (h *BoltDataHandler) GetActivePeriods(ctx context.Context, referenceTime time.Time) ([]*PeriodSettingsModel, error) {
+	periods, err := h.getPeriods(ctx, func(period *PeriodSettingsModel) bool {
+		return !period.IsArchived() && period.IsActive(referenceTime)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return LatestPeriods(periods, 0, time.Time{}), nil
+}
+
+func (h *BoltDataHandler) GetLatestPeriods(ctx context.Context, limit int64, referenceTime time.Time) ([]*PeriodSettingsModel, error) {
+	periods, err := h.getPeriods(ctx, func(period *PeriodSettingsModel) bool {
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return LatestPeriods(periods, limit, referenceTime), nil
+}
+
+func (h *BoltDataHandler) ListPeriods(ctx context.Context, query *PeriodListQuery) (*PeriodListPage, error) {
+	periods, err := h.getPeriods(ctx, query.Matches)
+	if err != nil {
+		return nil, err
+	}
+	return ListPeriodModels(periods, query)
+}
+
+// modifyPeriod reads the period matching args, calls modify and writes the period back.
+func (h *BoltDataHandler) modifyPeriod(ctx context.Context, args *PeriodSettingsQueryArgs, modify func(period *PeriodSettingsModel) error) error {
+	return h.update(ctx, func(tx *bolt.Tx) error {
+		old, findErr := h.findPeriod(tx, args)
+		if findErr != nil {
+			return findErr
+		}
+		// decode again to get a copy of the period
+		period, getErr := h.getPeriod(tx, old.Id)
+		if getErr != nil {
+			return getErr
+		}
+		if modifyErr := modify(period); modifyErr != nil {
+			return modifyErr
+		}
+		period.LastUpdated = h.Clock.Now()
+		return h.putPeriod(tx, old, period)
+	})
+}
+
+func (h *BoltDataHandler) UpdatePeriodVoters(ctx context.Context, args *PeriodSettingsQueryArgs, voters []*VoterModel) error {
+	if validateErr := ValidateVoters(voters); validateErr != nil {
+		return validateErr
+	}
+	return h.modifyPeriod(ctx, args, func(period *PeriodSettingsModel) error {
+		period.Voters = voters
+		return nil
+	})
+}
+
+func (h *BoltDataHandler) RenamePeriod(ctx context.Context, args *PeriodSettingsQueryArgs, name, slug string) error {
+	return h.modifyPeriod(ctx, args, func(period *PeriodSettingsModel) error {
+		period.Name, period.Slug = name, slug
+		return period.ValidateModel()
+	})
+}
+
+func (h *BoltDataHandler) DeletePeriod(ctx context.Context, args *PeriodSettingsQueryArgs, mode PeriodDeleteMode) (int64, error) {
+	var res int64
+	err := h.update(ctx, func(tx *bolt.Tx) error {
+		res = 0
+		period, findErr := h.findPeriod(tx, args)
+		if findErr != nil {
+			var notFound EntryNotFoundError
+			if errors.As(findErr, &notFound) {
+				return nil
+			}
+			return findErr
+		}
+		meetings, meetingsErr := h.periodMeetings(tx, period.Id)
+		if meetingsErr != nil {
+			return meetingsErr
+		}
+		switch mode {
+		case PeriodDeleteRestrict:
+			if len(meetings) > 0 {
+				return NewPeriodInUseError(period.Id, int64(len(meetings)))
+			}
+		case PeriodDeleteCascade:
+			for _, meeting := range meetings {
+				if deleteErr := h.deleteMeeting(tx, meeting); deleteErr != nil {
+					return deleteErr
+				}
+			}
+		case PeriodDeleteArchive:
+			now := h.Clock.Now()
+			period.Archived, period.LastUpdated = now, now
+			if putErr := boltPut(tx.Bucket(boltPeriodsBucket), period.Id, period); putErr != nil {
+				return putErr
+			}
+			res = 1
+			return nil
+		default:
+			return fmt.Errorf("invalid delete mode %s", mode)
+		}
+		if deleteErr := h.deletePeriod(tx, period); deleteErr != nil {
+			return deleteErr
+		}
+		res = 1
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return res, nil
+}
+
+// meetings
+
+func boltDecodeMeeting(data []byte) (*MeetingModel, error) {
+	internalModel := emptyMongoMeetingModel()
+	if err := bson.Unmarshal(data, internalModel); err != nil {
+		return nil, err
+	}
+	return internalModel.toMeetingModel()
+}
+
+func (h *BoltDataHandler) getMeeting(tx *bolt.Tx, id uuid.UUID) (*MeetingModel, error) {
+	data := tx.Bucket(boltMeetingsBucket).Get(id[:])
+	if data == nil {
+		return nil, nil
+	}
+	return boltDecodeMeeting(data)
+}
+
+// findMeeting returns the meeting matching args, all given fields of args must match.
+func (h *BoltDataHandler) findMeeting(tx *bolt.Tx, args *MeetingQueryArgs) (*MeetingModel, error) {
+	if args.Id == nil && args.Slug == nil && args.Name == nil {
+		return nil, ErrInvalidMeetingQuery
+	}
+	notFound := NewEntryNotFoundError(meetingModelType, reflect.ValueOf(args), nil)
+	id, ok, lookupErr := boltIdQuery(tx, args.Id, args.Slug, args.Name, boltMeetingSlugsBucket, boltMeetingNamesBucket)
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+	if !ok {
+		return nil, notFound
+	}
+	meeting, getErr := h.getMeeting(tx, id)
+	if getErr != nil {
+		return nil, getErr
+	}
+	if meeting == nil ||
+		(args.Slug != nil && meeting.Slug != *args.Slug) ||
+		(args.Name != nil && meeting.Name != *args.Name) ||
+		(args.LastUpdated != nil && !meeting.LastUpdated.Equal(*args.LastUpdated)) ||
+		(args.UpdateToken != nil && meeting.UpdateToken != *args.UpdateToken) {
+		return nil, notFound
+	}
+	return meeting, nil
+}
+
+func (h *BoltDataHandler) allMeetings(tx *bolt.Tx) ([]*MeetingModel, error) {
+	res := make([]*MeetingModel, 0, 42)
+	err := tx.Bucket(boltMeetingsBucket).ForEach(func(k, v []byte) error {
+		meeting, decodeErr := boltDecodeMeeting(v)
+		if decodeErr != nil {
+			return decodeErr
+		}
+		res = append(res, meeting)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (h *BoltDataHandler) periodMeetings(tx *bolt.Tx, periodId uuid.UUID) ([]*MeetingModel, error) {
+	meetings, err := h.allMeetings(tx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*MeetingModel, 0, len(meetings))
+	for _, meeting := range meetings {
+		if meeting.PeriodId == periodId {
+			res = append(res, meeting)
+		}
+	}
+	return res, nil
+}
+
+// putMeeting checks the unique constraints, updates the indexes and writes the meeting.
+// old is the meeting before the change, nil for new meetings.
+func (h *BoltDataHandler) putMeeting(tx *bolt.Tx, old, meeting *MeetingModel) error {
+	names, slugs := tx.Bucket(boltMeetingNamesBucket), tx.Bucket(boltMeetingSlugsBucket)
+	if err := boltCheckUnique(names, meetingModelType, "name", meeting.Name, meeting.Id); err != nil {
+		return err
+	}
+	if err := boltCheckUnique(slugs, meetingModelType, "slug", meeting.Slug, meeting.Id); err != nil {
+		return err
+	}
+	oldName, oldSlug := "", ""
+	if old != nil {
+		oldName, oldSlug = old.Name, old.Slug
+	}
+	if err := boltUpdateIndex(names, oldName, meeting.Name, meeting.Id); err != nil {
+		return err
+	}
+	if err := boltUpdateIndex(slugs, oldSlug, meeting.Slug, meeting.Id); err != nil {
+		return err
+	}
+	return boltPut(tx.Bucket(boltMeetingsBucket), meeting.Id, meeting)
+}
+
+func (h *BoltDataHandler) deleteMeeting(tx *bolt.Tx, meeting *MeetingModel) error {
+	if err := tx.Bucket(boltMeetingNamesBucket).Delete([]byte(meeting.Name)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltMeetingSlugsBucket).Delete([]byte(meeting.Slug)); err != nil {
+		return err
+	}
+	return tx.Bucket(boltMeetingsBucket).Delete(meeting.Id[:])
+}
+
+// sortMeetings sorts the meetings by the time returned by key (ascending), meetings with the same time are sorted
+// by id.
+func sortMeetings(meetings []*MeetingModel, key func(meeting *MeetingModel) time.Time) {
+	sort.Slice(meetings, func(i, j int) bool {
+		if cmp := compareTimes(key(meetings[i]), key(meetings[j])); cmp != 0 {
+			return cmp < 0
+		}
+		return bytes.Compare(meetings[i].Id[:], meetings[j].Id[:]) < 0
+	})
+}
+
+// InsertMeeting inserts the meeting if its period exists.
+func (h *BoltDataHandler) InsertMeeting(ctx context.Context, meeting *MeetingModel) error {
+	if validateErr := meeting.ValidateModel(); validateErr != nil {
+		return validateErr
+	}
+	return h.update(ctx, func(tx *bolt.Tx) error {
+		period, findErr := h.findPeriod(tx, NewPeriodSettingsQueryArgs().SetId(&meeting.PeriodId))
+		if findErr != nil {
+			return findErr
+		}
+		if tx.Bucket(boltMeetingsBucket).Get(meeting.Id[:]) != nil {
+			return NewDuplicateEntryError(meetingModelType, "id", meeting.Id.String())
+		}
+		// the period is written like in MongoDataHandler.InsertMeeting
+		period.LastUpdated = h.Clock.Now()
+		if putErr := boltPut(tx.Bucket(boltPeriodsBucket), period.Id, period); putErr != nil {
+			return putErr
+		}
+		return h.putMeeting(tx, nil, meeting)
+	})
+}
+
+func (h *BoltDataHandler) GetMeeting(ctx context.Context, args *MeetingQueryArgs) (res *MeetingModel, err error) {
+	err = h.view(ctx, func(tx *bolt.Tx) error {
+		var findErr error
+		res, findErr = h.findMeeting(tx, args)
+		return findErr
+	})
+	return
+}
+
+// getMeetings returns all meetings for which filter returns true.
+func (h *BoltDataHandler) getMeetings(ctx context.Context, filter func(meeting *MeetingModel) bool) (res []*MeetingModel, err error) {
+	err = h.view(ctx, func(tx *bolt.Tx) error {
+		meetings, allErr := h.allMeetings(tx)
+		if allErr != nil {
+			return allErr
+		}
+		res = make([]*MeetingModel, 0, len(meetings))
+		for _, meeting := range meetings {
+			if filter(meeting) {
+				res = append(res, meeting)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (h *BoltDataHandler) GetMeetingsForPeriod(ctx context.Context, periodId uuid.UUID) ([]*MeetingModel, error) {
+	res, err := h.getMeetings(ctx, func(meeting *MeetingModel) bool {
+		return meeting.PeriodId == periodId
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortMeetings(res, func(meeting *MeetingModel) time.Time {
+		return meeting.MeetingTime
+	})
+	return res, nil
+}
+
+func (h *BoltDataHandler) GetOnlineVotingMeetings(ctx context.Context, referenceTime time.Time) ([]*MeetingModel, error) {
+	res, err := h.getMeetings(ctx, func(meeting *MeetingModel) bool {
+		return !referenceTime.Before(meeting.OnlineStart) && !referenceTime.After(meeting.OnlineEnd)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortMeetings(res, func(meeting *MeetingModel) time.Time {
+		return meeting.OnlineEnd
+	})
+	return res, nil
+}
+
+func (h *BoltDataHandler) GetVotingTransitionMeetings(ctx context.Context, referenceTime time.Time) ([]*MeetingModel, error) {
+	res, err := h.getMeetings(ctx, func(meeting *MeetingModel) bool {
+		if meeting.OnlineStart.IsZero() {
+			return false
+		}
+		if meeting.IsOnlineVotingOpen(referenceTime) {
+			return meeting.OnlineOpenedAt.IsZero()
+		}
+		return !meeting.OnlineEnd.IsZero() && !referenceTime.Before(meeting.OnlineEnd) &&
+			meeting.OnlineClosedAt.IsZero()
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortMeetings(res, func(meeting *MeetingModel) time.Time {
+		return meeting.OnlineStart
+	})
+	return res, nil
+}
+
+func (h *BoltDataHandler) ListMeetings(ctx context.Context, query *MeetingListQuery) (*MeetingListPage, error) {
+	meetings, err := h.getMeetings(ctx, func(meeting *MeetingModel) bool {
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ListMeetingSummaries(meetings, query)
+}
+
+// modifyMeeting reads the meeting matching args, calls modify and writes the meeting back.
+// LastUpdated is set to the current time and UpdateToken is incremented.
+func (h *BoltDataHandler) modifyMeeting(ctx context.Context, args *MeetingQueryArgs, modify func(meeting *MeetingModel) error) error {
+	return h.update(ctx, func(tx *bolt.Tx) error {
+		_, err := h.modifyMeetingTx(tx, args, modify)
+		return err
+	})
+}
+
+// modifyMeetingTx works like modifyMeeting in the given transaction, it returns the modified meeting.
+func (h *BoltDataHandler) modifyMeetingTx(tx *bolt.Tx, args *MeetingQueryArgs, modify func(meeting *MeetingModel) error) (*MeetingModel, error) {
+	meeting, findErr := h.findMeeting(tx, args)
+	if findErr != nil {
+		return nil, findErr
+	}
+	if modifyErr := modify(meeting); modifyErr != nil {
+		return nil, modifyErr
+	}
+	meeting.LastUpdated = h.Clock.Now()
+	meeting.UpdateToken++
+	// name and slug are not changed, so there is no need to update the indexes
+	if putErr := boltPut(tx.Bucket(boltMeetingsBucket), meeting.Id, meeting); putErr != nil {
+		return nil, putErr
+	}
+	return meeting, nil
+}
+
+// modifyMeetingGroups works like modifyMeeting and validates the poll groups after modify was called.
+func (h *BoltDataHandler) modifyMeetingGroups(ctx context.Context, args *MeetingQueryArgs, modify func(meeting *MeetingModel) error) error {
+	return h.modifyMeeting(ctx, args, func(meeting *MeetingModel) error {
+		if modifyErr := modify(meeting); modifyErr != nil {
+			return modifyErr
+		}
+		return ValidatePollGroups(meeting.Groups)
+	})
+}
+
+// modifyMeetingPolls works like modifyMeetingGroups, the definitions of all polls opened by modify are linked into
+// the chain of the meeting in the same transaction.
+func (h *BoltDataHandler) modifyMeetingPolls(ctx context.Context, args *MeetingQueryArgs, modify func(meeting *MeetingModel) error) error {
+	return h.update(ctx, func(tx *bolt.Tx) error {
+		var drafts map[uuid.UUID]struct{}
+		meeting, modifyErr := h.modifyMeetingTx(tx, args, func(meeting *MeetingModel) error {
+			drafts = draftPollIds(meeting)
+			if err := modify(meeting); err != nil {
+				return err
+			}
+			return ValidatePollGroups(meeting.Groups)
+		})
+		if modifyErr != nil {
+			return modifyErr
+		}
+		records, recordsErr := openedPollChainRecords(meeting, drafts)
+		if recordsErr != nil {
+			return recordsErr
+		}
+		return h.appendChain(tx, meeting.Id, records)
+	})
+}
+
+func (h *BoltDataHandler) UpdateMeetingVoters(ctx context.Context, args *MeetingQueryArgs, voters []*VoterModel) error {
+	if validateErr := ValidateVoters(voters); validateErr != nil {
+		return validateErr
+	}
+	return h.modifyMeeting(ctx, args, func(meeting *MeetingModel) error {
+		meeting.Voters = voters
+		return nil
+	})
+}
+
+func (h *BoltDataHandler) UpdateMeetingGroups(ctx context.Context, args *MeetingQueryArgs, groups []*PollGroupModel) error {
+	if validateErr := ValidatePollGroups(groups); validateErr != nil {
+		return validateErr
+	}
+	return h.modifyMeeting(ctx, args, func(meeting *MeetingModel) error {
+		if checkErr := CheckPollGroupsUpdate(meeting.Groups, groups); checkErr != nil {
+			return checkErr
+		}
+		meeting.Groups = groups
+		return nil
+	})
+}
+
+func (h *BoltDataHandler) UpdatePollState(ctx context.Context, args *MeetingQueryArgs, pollId uuid.UUID, state string) error {
+	return h.modifyMeetingPolls(ctx, args, func(meeting *MeetingModel) error {
+		return meeting.TransitionPoll(pollId, state, h.Clock.Now())
+	})
+}
+
+// AddVotes adds the votes and links them into the chain of the meeting in the same transaction.
+func (h *BoltDataHandler) AddVotes(ctx context.Context, args *MeetingQueryArgs, votes []*PollVote) error {
+	records, recordsErr := NewVoteChainRecords(votes)
+	if recordsErr != nil {
+		return recordsErr
+	}
+	return h.update(ctx, func(tx *bolt.Tx) error {
+		meeting, modifyErr := h.modifyMeetingTx(tx, args, func(meeting *MeetingModel) error {
+			if addErr := meeting.AddVotes(votes); addErr != nil {
+				return addErr
+			}
+			return ValidatePollGroups(meeting.Groups)
+		})
+		if modifyErr != nil {
+			return modifyErr
+		}
+		return h.appendChain(tx, meeting.Id, records)
+	})
+}
+
+func (h *BoltDataHandler) SetMeetingNotificationSent(ctx context.Context, meetingId uuid.UUID, notification string, sent time.Time) error {
+	return h.update(ctx, func(tx *bolt.Tx) error {
+		meeting, findErr := h.findMeeting(tx, NewMeetingQueryArgs().SetId(&meetingId))
+		if findErr != nil {
+			return findErr
+		}
+		if meeting.NotificationsSent == nil {
+			meeting.NotificationsSent = make(map[string]time.Time, 1)
+		}
+		meeting.NotificationsSent[notification] = sent
+		return boltPut(tx.Bucket(boltMeetingsBucket), meeting.Id, meeting)
+	})
+}
+
+func (h *BoltDataHandler) UpdateMeetingPollStates(ctx context.Context, args *MeetingQueryArgs, from, to string) (int, error) {
+	num := 0
+	err := h.modifyMeetingPolls(ctx, args, func(meeting *MeetingModel) error {
+		var transitionErr error
+		num, transitionErr = meeting.TransitionPolls(from, to, h.Clock.Now())
+		return transitionErr
+	})
+	if err != nil {
+		return 0, err
+	}
+	return num, nil
+}
+
+func (h *BoltDataHandler) ApplyVotingTransition(ctx context.Context, args *MeetingQueryArgs, transition *VotingTransition) (int, error) {
+	num := 0
+	err := h.modifyMeetingPolls(ctx, args, func(meeting *MeetingModel) error {
+		var transitionErr error
+		num, transitionErr = meeting.ApplyVotingTransition(transition, h.Clock.Now())
+		return transitionErr
+	})
+	if err != nil {
+		return 0, err
+	}
+	return num, nil
+}
+
+func (h *BoltDataHandler) DeleteMeeting(ctx context.Context, args *MeetingQueryArgs) (int64, error) {
+	var res int64
+	err := h.update(ctx, func(tx *bolt.Tx) error {
+		res = 0
+		meeting, findErr := h.findMeeting(tx, args)
+		if findErr != nil {
+			var notFound EntryNotFoundError
+			if errors.As(findErr, &notFound) {
+				return nil
+			}
+			return findErr
+		}
+		if deleteErr := h.deleteMeeting(tx, meeting); deleteErr != nil {
+			return deleteErr
+		}
+		res = 1
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return res, nil
+}
+
+// webhooks
+
+func (h *BoltDataHandler) InsertWebhook(ctx context.Context, webhook *WebhookModel) (uuid.UUID, error) {
+	objectId, uuidErr := pollsweb.GenUUID()
+	if uuidErr != nil {
+		return objectId, uuidErr
+	}
+	webhook.Id = objectId
+	if webhook.Created.IsZero() {
+		webhook.Created = h.Clock.Now()
+	}
+	insertErr := h.update(ctx, func(tx *bolt.Tx) error {
+		return boltPut(tx.Bucket(boltWebhooksBucket), webhook.Id, webhook)
+	})
+	return objectId, insertErr
+}
+
+func (h *BoltDataHandler) GetWebhook(ctx context.Context, id uuid.UUID) (res *WebhookModel, err error) {
+	err = h.view(ctx, func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltWebhooksBucket).Get(id[:])
+		if data == nil {
+			return NewEntryNotFoundError(webhookModelType, reflect.ValueOf(id), nil)
+		}
+		res = EmptyWebhookModel()
+		return bson.Unmarshal(data, res)
+	})
+	if err != nil {
+		res = nil
+	}
+	return
+}
+
+func (h *BoltDataHandler) GetWebhooks(ctx context.Context, event string) (res []*WebhookModel, err error) {
+	err = h.view(ctx, func(tx *bolt.Tx) error {
+		res = make([]*WebhookModel, 0)
+		return tx.Bucket(boltWebhooksBucket).ForEach(func(k, v []byte) error {
+			webhook := EmptyWebhookModel()
+			if decodeErr := bson.Unmarshal(v, webhook); decodeErr != nil {
+				return decodeErr
+			}
+			if event == "" || (webhook.Active && webhookHasEvent(webhook, event)) {
+				res = append(res, webhook)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Created.Before(res[j].Created)
+	})
+	return res, nil
+}
+
+func webhookHasEvent(webhook *WebhookModel, event string) bool {
+	for _, e := range webhook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *BoltDataHandler) DeleteWebhook(ctx context.Context, id uuid.UUID) (int64, error) {
+	var res int64
+	err := h.update(ctx, func(tx *bolt.Tx) error {
+		res = 0
+		webhooks := tx.Bucket(boltWebhooksBucket)
+		if webhooks.Get(id[:]) == nil {
+			return nil
+		}
+		if deleteErr := webhooks.Delete(id[:]); deleteErr != nil {
+			return deleteErr
+		}
+		res = 1
+		// the delivery history is not needed any more
+		deliveries, deliveriesErr := h.webhookDeliveries(tx, id)
+		if deliveriesErr != nil {
+			return deliveriesErr
+		}
+		deliveriesBucket := tx.Bucket(boltWebhookDeliveriesBucket)
+		for _, delivery := range deliveries {
+			if deleteErr := deliveriesBucket.Delete(delivery.Id[:]); deleteErr != nil {
+				return deleteErr
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return res, nil
+}
+
+func (h *BoltDataHandler) InsertWebhookDelivery(ctx context.Context, delivery *WebhookDeliveryModel) (uuid.UUID, error) {
+	objectId, uuidErr := pollsweb.GenUUID()
+	if uuidErr != nil {
+		return objectId, uuidErr
+	}
+	delivery.Id = objectId
+	if delivery.Time.IsZero() {
+		delivery.Time = h.Clock.Now()
+	}
+	insertErr := h.update(ctx, func(tx *bolt.Tx) error {
+		return boltPut(tx.Bucket(boltWebhookDeliveriesBucket), delivery.Id, delivery)
+	})
+	return objectId, insertErr
+}
+
+func (h *BoltDataHandler) webhookDeliveries(tx *bolt.Tx, webhookId uuid.UUID) ([]*WebhookDeliveryModel, error) {
+	res := make([]*WebhookDeliveryModel, 0)
+	err := tx.Bucket(boltWebhookDeliveriesBucket).ForEach(func(k, v []byte) error {
+		delivery := EmptyWebhookDeliveryModel()
+		if decodeErr := bson.Unmarshal(v, delivery); decodeErr != nil {
+			return decodeErr
+		}
+		if delivery.WebhookId == webhookId {
+			res = append(res, delivery)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (h *BoltDataHandler) GetWebhookDeliveries(ctx context.Context, webhookId uuid.UUID, limit int64) (res []*WebhookDeliveryModel, err error) {
+	err = h.view(ctx, func(tx *bolt.Tx) error {
+		var deliveriesErr error
+		res, deliveriesErr = h.webhookDeliveries(tx, webhookId)
+		return deliveriesErr
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Time.After(res[j].Time)
+	})
+	if limit > 0 && int64(len(res)) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func (h *BoltDataHandler) GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int64) (res []*WebhookDeliveryModel, err error) {
+	err = h.view(ctx, func(tx *bolt.Tx) error {
+		res = make([]*WebhookDeliveryModel, 0)
+		return tx.Bucket(boltWebhookDeliveriesBucket).ForEach(func(k, v []byte) error {
+			delivery := EmptyWebhookDeliveryModel()
+			if decodeErr := bson.Unmarshal(v, delivery); decodeErr != nil {
+				return decodeErr
+			}
+			if !delivery.RetryAt.IsZero() && !delivery.RetryAt.After(now) {
+				res = append(res, delivery)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].RetryAt.Before(res[j].RetryAt)
+	})
+	if limit > 0 && int64(len(res)) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func (h *BoltDataHandler) ClaimWebhookDeliveryRetry(ctx context.Context, id uuid.UUID) (bool, error) {
+	res := false
+	err := h.update(ctx, func(tx *bolt.Tx) error {
+		res = false
+		bucket := tx.Bucket(boltWebhookDeliveriesBucket)
+		data := bucket.Get(id[:])
+		if data == nil {
+			return nil
+		}
+		delivery := EmptyWebhookDeliveryModel()
+		if decodeErr := bson.Unmarshal(data, delivery); decodeErr != nil {
+			return decodeErr
+		}
+		if delivery.RetryAt.IsZero() {
+			return nil
+		}
+		delivery.RetryAt = time.Time{}
+		res = true
+		return boltPut(bucket, delivery.Id, delivery)
+	})
+	if err != nil {
+		return false, err
+	}
+	return res, nil
+}
+
+// audit log
+
+// InsertAuditEntry inserts the entry, entries that reference a meeting are linked into the chain of the meeting in
+// the same transaction.
+func (h *BoltDataHandler) InsertAuditEntry(ctx context.Context, entry *AuditEntryModel) (uuid.UUID, error) {
+	objectId, uuidErr := pollsweb.GenUUID()
+	if uuidErr != nil {
+		return objectId, uuidErr
+	}
+	entry.Id = objectId
+	if entry.Time.IsZero() {
+		entry.Time = h.Clock.Now()
+	}
+	record, recordErr := NewAuditChainRecord(entry)
+	if recordErr != nil {
+		return objectId, recordErr
+	}
+	insertErr := h.update(ctx, func(tx *bolt.Tx) error {
+		if putErr := boltPut(tx.Bucket(boltAuditBucket), entry.Id, entry); putErr != nil {
+			return putErr
+		}
+		if entry.MeetingId == uuid.Nil {
+			return nil
+		}
+		return h.appendChain(tx, entry.MeetingId, []*ChainRecord{record})
+	})
+	return objectId, insertErr
+}
+
+func (h *BoltDataHandler) ListAuditEntries(ctx context.Context, query *AuditQuery) (*AuditPage, error) {
+	entries := make([]*AuditEntryModel, 0)
+	err := h.view(ctx, func(tx *bolt.Tx) error {
+		return tx.Bucket(boltAuditBucket).ForEach(func(k, v []byte) error {
+			entry := EmptyAuditEntryModel()
+			if decodeErr := bson.Unmarshal(v, entry); decodeErr != nil {
+				return decodeErr
+			}
+			if query.Matches(entry) {
+				entries = append(entries, entry)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ListAuditEntries(entries, query)
+}
+
+// hash chains
+
+func boltChainKey(meetingId uuid.UUID, sequence int64) []byte {
+	res := make([]byte, len(meetingId)+8)
+	copy(res, meetingId[:])
+	binary.BigEndian.PutUint64(res[len(meetingId):], uint64(sequence))
+	return res
+}
+
+// chainHead returns the last entry of the chain of the meeting, nil if the chain is empty.
+func (h *BoltDataHandler) chainHead(tx *bolt.Tx, meetingId uuid.UUID) (*ChainEntryModel, error) {
+	cursor := tx.Bucket(boltChainBucket).Cursor()
+	// the key after the last possible entry of the chain, the entry before it is the head
+	k, v := cursor.Seek(boltChainKey(meetingId, -1))
+	if k == nil {
+		k, v = cursor.Last()
+	} else {
+		k, v = cursor.Prev()
+	}
+	if k == nil || !bytes.HasPrefix(k, meetingId[:]) {
+		return nil, nil
+	}
+	res := EmptyChainEntryModel()
+	if err := bson.Unmarshal(v, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// appendChain appends the records to the chain of the meeting.
+func (h *BoltDataHandler) appendChain(tx *bolt.Tx, meetingId uuid.UUID, records []*ChainRecord) error {
+	head, headErr := h.chainHead(tx, meetingId)
+	if headErr != nil {
+		return headErr
+	}
+	bucket := tx.Bucket(boltChainBucket)
+	for _, entry := range NewChainEntries(head, meetingId, h.Clock.Now(), records) {
+		objectId, uuidErr := pollsweb.GenUUID()
+		if uuidErr != nil {
+			return uuidErr
+		}
+		entry.Id = objectId
+		data, marshalErr := bson.Marshal(entry)
+		if marshalErr != nil {
+			return marshalErr
+		}
+		if putErr := bucket.Put(boltChainKey(meetingId, entry.Sequence), data); putErr != nil {
+			return putErr
+		}
+	}
+	return nil
+}
+
+// getChain returns all entries of the chain of the meeting.
+func (h *BoltDataHandler) getChain(tx *bolt.Tx, meetingId uuid.UUID) ([]*ChainEntryModel, error) {
+	res := make([]*ChainEntryModel, 0)
+	cursor := tx.Bucket(boltChainBucket).Cursor()
+	for k, v := cursor.Seek(meetingId[:]); k != nil && bytes.HasPrefix(k, meetingId[:]); k, v = cursor.Next() {
+		entry := EmptyChainEntryModel()
+		if decodeErr := bson.Unmarshal(v, entry); decodeErr != nil {
+			return nil, decodeErr
+		}
+		res = append(res, entry)
+	}
+	return res, nil
+}
+
+func (h *BoltDataHandler) GetChain(ctx context.Context, meetingId uuid.UUID) (res []*ChainEntryModel, err error) {
+	err = h.view(ctx, func(tx *bolt.Tx) error {
+		var chainErr error
+		res, chainErr = h.getChain(tx, meetingId)
+		return chainErr
+	})
+	if err != nil {
+		res = nil
+	}
+	return
+}
+
+func (h *BoltDataHandler) GetChainMeetingIds(ctx context.Context) (res []uuid.UUID, err error) {
+	err = h.view(ctx, func(tx *bolt.Tx) error {
+		res = make([]uuid.UUID, 0)
+		// the keys start with the meeting id (see boltChainKey), so they're sorted by meeting
+		return tx.Bucket(boltChainBucket).ForEach(func(k, v []byte) error {
+			var meetingId uuid.UUID
+			copy(meetingId[:], k)
+			if len(res) == 0 || res[len(res)-1] != meetingId {
+				res = append(res, meetingId)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		res = nil
+	}
+	return
+}
+
+func (h *BoltDataHandler) LinkUnchainedRecords(ctx context.Context, meetingId uuid.UUID) (int, error) {
+	var res int
+	err := h.update(ctx, func(tx *bolt.Tx) error {
+		res = 0
+		meeting, findErr := h.findMeeting(tx, NewMeetingQueryArgs().SetId(&meetingId))
+		if findErr != nil {
+			return findErr
+		}
+		chain, chainErr := h.getChain(tx, meetingId)
+		if chainErr != nil {
+			return chainErr
+		}
+		auditEntries := make([]*AuditEntryModel, 0)
+		auditErr := tx.Bucket(boltAuditBucket).ForEach(func(k, v []byte) error {
+			entry := EmptyAuditEntryModel()
+			if decodeErr := bson.Unmarshal(v, entry); decodeErr != nil {
+				return decodeErr
+			}
+			if entry.MeetingId == meetingId {
+				auditEntries = append(auditEntries, entry)
+			}
+			return nil
+		})
+		if auditErr != nil {
+			return auditErr
+		}
+		records, recordsErr := UnlinkedChainRecords(chain, meeting, auditEntries)
+		if recordsErr != nil {
+			return recordsErr
+		}
+		res = len(records)
+		return h.appendChain(tx, meetingId, records)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res, nil
+}
+
+// archive import
+
+// boltClearBucket removes all keys from the bucket and returns their number.
+func boltClearBucket(tx *bolt.Tx, name []byte) (int64, error) {
+	num := int64(tx.Bucket(name).Stats().KeyN)
+	if err := tx.DeleteBucket(name); err != nil {
+		return 0, err
+	}
+	_, err := tx.CreateBucket(name)
+	return num, err
+}
+
+func (h *BoltDataHandler) WriteImport(ctx context.Context, data *ArchiveImportData) (*ArchiveWriteResult, error) {
+	for _, period := range data.Periods {
+		if validateErr := period.ValidateModel(); validateErr != nil {
+			return nil, validateErr
+		}
+	}
+	for _, meeting := range data.Meetings {
+		if validateErr := meeting.ValidateModel(); validateErr != nil {
+			return nil, validateErr
+		}
+	}
+	var res *ArchiveWriteResult
+	err := h.update(ctx, func(tx *bolt.Tx) error {
+		res = &ArchiveWriteResult{}
+		if data.Replace {
+			meetings, meetingsErr := h.allMeetings(tx)
+			if meetingsErr != nil {
+				return meetingsErr
+			}
+			for _, meeting := range meetings {
+				if deleteErr := h.deleteMeeting(tx, meeting); deleteErr != nil {
+					return deleteErr
+				}
+				res.MeetingsDeleted++
+			}
+			periods, periodsErr := h.allPeriods(tx)
+			if periodsErr != nil {
+				return periodsErr
+			}
+			for _, period := range periods {
+				if deleteErr := h.deletePeriod(tx, period); deleteErr != nil {
+					return deleteErr
+				}
+				res.PeriodsDeleted++
+			}
+			var clearErr error
+			if res.AuditEntriesDeleted, clearErr = boltClearBucket(tx, boltAuditBucket); clearErr != nil {
+				return clearErr
+			}
+			if res.ChainEntriesDeleted, clearErr = boltClearBucket(tx, boltChainBucket); clearErr != nil {
+				return clearErr
+			}
+		}
+		for _, period := range data.Periods {
+			if tx.Bucket(boltPeriodsBucket).Get(period.Id[:]) != nil {
+				return NewDuplicateEntryError(periodSettingsModelType, "id", period.Id.String())
+			}
+			if putErr := h.putPeriod(tx, nil, period); putErr != nil {
+				return putErr
+			}
+		}
+		for _, meeting := range data.Meetings {
+			if _, findErr := h.findPeriod(tx, NewPeriodSettingsQueryArgs().SetId(&meeting.PeriodId)); findErr != nil {
+				return findErr
+			}
+			if tx.Bucket(boltMeetingsBucket).Get(meeting.Id[:]) != nil {
+				return NewDuplicateEntryError(meetingModelType, "id", meeting.Id.String())
+			}
+			if putErr := h.putMeeting(tx, nil, meeting); putErr != nil {
+				return putErr
+			}
+		}
+		auditBucket := tx.Bucket(boltAuditBucket)
+		for _, entry := range data.AuditEntries {
+			if auditBucket.Get(entry.Id[:]) != nil {
+				continue
+			}
+			if putErr := boltPut(auditBucket, entry.Id, entry); putErr != nil {
+				return putErr
+			}
+			res.AuditEntriesWritten++
+		}
+		chainBucket := tx.Bucket(boltChainBucket)
+		for _, entry := range data.ChainEntries {
+			key := boltChainKey(entry.MeetingId, entry.Sequence)
+			if existingData := chainBucket.Get(key); existingData != nil {
+				existing := EmptyChainEntryModel()
+				if decodeErr := bson.Unmarshal(existingData, existing); decodeErr != nil {
+					return decodeErr
+				}
+				if existing.Id != entry.Id {
+					return NewDuplicateEntryError(chainEntryModelType, "sequence", fmt.Sprintf("%s/%d", entry.MeetingId, entry.Sequence))
+				}
+				continue
+			}
+			encoded, marshalErr := bson.Marshal(entry)
+			if marshalErr != nil {
+				return marshalErr
+			}
+			if putErr := chainBucket.Put(key, encoded); putErr != nil {
+				return putErr
+			}
+			res.ChainEntriesWritten++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,693 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"reflect"
+	"sort"
+	"time"
+)
+
+var chainEntryModelType = reflect.TypeOf(EmptyChainEntryModel())
+
+// Kinds of records linked into the hash chain of a meeting.
+const (
+	ChainPollRecord  = "poll"
+	ChainVoteRecord  = "vote"
+	ChainAuditRecord = "audit"
+)
+
+// ChainGenesisHash is the previous hash of the first entry of a chain.
+var ChainGenesisHash = hex.EncodeToString(make([]byte, sha256.Size))
+
+// ChainRecord describes a poll definition, vote or audit entry that is linked into the chain of a meeting.
+//
+// RecordId is the id of the poll / vote / audit entry, PollId is the poll of a vote or poll definition (uuid.Nil for
+// audit entries). Digest is the sha256 hash of the content of the record, see PollDigest, VoteDigest and
+// AuditEntryDigest.
+type ChainRecord struct {
+	Kind     string
+	RecordId uuid.UUID
+	PollId   uuid.UUID
+	Digest   string
+}
+
+// NewPollChainRecord returns the record for the definition of a poll.
+func NewPollChainRecord(poll AbstractPollModel) (*ChainRecord, error) {
+	digest, digestErr := PollDigest(poll)
+	if digestErr != nil {
+		return nil, digestErr
+	}
+	return &ChainRecord{
+		Kind:     ChainPollRecord,
+		RecordId: poll.GetId(),
+		PollId:   poll.GetId(),
+		Digest:   digest,
+	}, nil
+}
+
+// draftPollIds returns the ids of all drafts of the meeting.
+func draftPollIds(meeting *MeetingModel) map[uuid.UUID]struct{} {
+	res := make(map[uuid.UUID]struct{})
+	for _, group := range meeting.Groups {
+		for _, poll := range group.Polls {
+			if poll.GetPollModel().GetState() == PollStateDraft {
+				res[poll.GetId()] = struct{}{}
+			}
+		}
+	}
+	return res
+}
+
+// openedPollChainRecords returns the records for the definitions of all polls of the meeting that were drafts
+// (see draftPollIds) and are no longer drafts, that is the polls that have been opened.
+func openedPollChainRecords(meeting *MeetingModel, drafts map[uuid.UUID]struct{}) ([]*ChainRecord, error) {
+	res := make([]*ChainRecord, 0)
+	for _, group := range meeting.Groups {
+		for _, poll := range group.Polls {
+			if _, wasDraft := drafts[poll.GetId()]; !wasDraft || poll.GetPollModel().GetState() == PollStateDraft {
+				continue
+			}
+			record, recordErr := NewPollChainRecord(poll)
+			if recordErr != nil {
+				return nil, recordErr
+			}
+			res = append(res, record)
+		}
+	}
+	return res, nil
+}
+
+// NewVoteChainRecord returns the record for a vote, the id of the vote must be set.
+func NewVoteChainRecord(pollVote *PollVote) (*ChainRecord, error) {
+	digest, digestErr := VoteDigest(pollVote.PollId, pollVote.Vote)
+	if digestErr != nil {
+		return nil, digestErr
+	}
+	return &ChainRecord{
+		Kind:     ChainVoteRecord,
+		RecordId: pollVote.Vote.GetId(),
+		PollId:   pollVote.PollId,
+		Digest:   digest,
+	}, nil
+}
+
+// NewVoteChainRecords returns the records for all votes, see NewVoteChainRecord.
+func NewVoteChainRecords(votes []*PollVote) ([]*ChainRecord, error) {
+	res := make([]*ChainRecord, len(votes))
+	for i, vote := range votes {
+		record, recordErr := NewVoteChainRecord(vote)
+		if recordErr != nil {
+			return nil, recordErr
+		}
+		res[i] = record
+	}
+	return res, nil
+}
+
+// NewAuditChainRecord returns the record for an audit entry, the id of the entry must be set.
+func NewAuditChainRecord(entry *AuditEntryModel) (*ChainRecord, error) {
+	digest, digestErr := AuditEntryDigest(entry)
+	if digestErr != nil {
+		return nil, digestErr
+	}
+	return &ChainRecord{
+		Kind:     ChainAuditRecord,
+		RecordId: entry.Id,
+		PollId:   uuid.Nil,
+		Digest:   digest,
+	}, nil
+}
+
+// chainTime returns the time as it is stored by the handlers (in UTC with millisecond precision), this way hashes
+// computed before and after storing a model are the same.
+func chainTime(t time.Time) string {
+	return t.UTC().Truncate(time.Millisecond).Format(time.RFC3339Nano)
+}
+
+// chainDigest returns the hex encoded sha256 hash of the json encoding of v.
+func chainDigest(v interface{}) (string, error) {
+	data, marshalErr := json.Marshal(v)
+	if marshalErr != nil {
+		return "", marshalErr
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// PollDigest returns the digest of the definition of a poll: the name, type, majority, the options and everything
+// else that can't be changed once the poll is open. The state and the votes are not covered.
+func PollDigest(poll AbstractPollModel) (string, error) {
+	content, archiveErr := NewArchivePoll(poll)
+	if archiveErr != nil {
+		return "", archiveErr
+	}
+	content.State = ""
+	content.Opened, content.Closed, content.Published = time.Time{}, time.Time{}, time.Time{}
+	content.Votes = nil
+	return chainDigest(content)
+}
+
+// chainVoteContent is the content of a vote that is hashed by VoteDigest.
+type chainVoteContent struct {
+	PollId    uuid.UUID   `json:"poll_id"`
+	Id        uuid.UUID   `json:"id"`
+	Type      string      `json:"type"`
+	VoterName string      `json:"voter_name"`
+	Slug      string      `json:"slug"`
+	Value     interface{} `json:"value"`
+}
+
+// VoteDigest returns the digest of a vote in the poll with the given id, it covers the voter and the content of the
+// vote.
+func VoteDigest(pollId uuid.UUID, vote AbstractVoteModel) (string, error) {
+	content := chainVoteContent{
+		PollId: pollId,
+		Id:     vote.GetId(),
+		Type:   vote.ModelVoteForType(),
+	}
+	switch typedVote := vote.(type) {
+	case *BasicPollVoteModel:
+		content.VoterName, content.Slug, content.Value = typedVote.VoterName, typedVote.Slug, typedVote.Answer
+	case *MedianPollVoteModel:
+		content.VoterName, content.Slug, content.Value = typedVote.VoterName, typedVote.Slug, typedVote.Value
+	case *SchulzePollVoteModel:
+		content.VoterName, content.Slug, content.Value = typedVote.VoterName, typedVote.Slug, typedVote.Ranking
+	default:
+		return "", fmt.Errorf("unsupported vote type %s", vote.ModelVoteForType())
+	}
+	return chainDigest(&content)
+}
+
+// chainAuditContent is the content of an audit entry that is hashed by AuditEntryDigest.
+type chainAuditContent struct {
+	Id         uuid.UUID         `json:"id"`
+	Time       string            `json:"time"`
+	Actor      string            `json:"actor"`
+	RemoteAddr string            `json:"remote_addr"`
+	Action     string            `json:"action"`
+	PeriodId   uuid.UUID         `json:"period_id"`
+	MeetingId  uuid.UUID         `json:"meeting_id"`
+	PollId     uuid.UUID         `json:"poll_id"`
+	Details    map[string]string `json:"details"`
+}
+
+// AuditEntryDigest returns the digest of an audit entry, it covers all fields of the entry.
+func AuditEntryDigest(entry *AuditEntryModel) (string, error) {
+	details := entry.Details
+	if details == nil {
+		details = make(map[string]string)
+	}
+	return chainDigest(&chainAuditContent{
+		Id:         entry.Id,
+		Time:       chainTime(entry.Time),
+		Actor:      entry.Actor,
+		RemoteAddr: entry.RemoteAddr,
+		Action:     entry.Action,
+		PeriodId:   entry.PeriodId,
+		MeetingId:  entry.MeetingId,
+		PollId:     entry.PollId,
+		Details:    details,
+	})
+}
+
+// ChainEntryModel is an entry in the hash chain of a meeting.
+//
+// The definitions of all polls of a meeting (once they're opened), all votes of the meeting and all audit entries
+// that reference the meeting are linked into the chain in the order they were stored. Sequence starts with 1 and is
+// incremented for each entry, PreviousHash is the Hash of the previous entry (ChainGenesisHash for the first entry)
+// and Hash is computed from all other fields, see ComputeHash. Changing, removing or inserting an entry breaks the
+// chain, changing a vote or audit entry no longer matches the Digest of its entry. Use VerifyChain to check a chain.
+type ChainEntryModel struct {
+	*IdModel     `bson:",inline"`
+	MeetingId    uuid.UUID
+	Sequence     int64
+	Time         time.Time
+	Kind         string
+	RecordId     uuid.UUID
+	PollId       uuid.UUID
+	Digest       string
+	PreviousHash string
+	Hash         string
+}
+
+func EmptyChainEntryModel() *ChainEntryModel {
+	return &ChainEntryModel{
+		IdModel:      EmptyIdModel(),
+		MeetingId:    uuid.Nil,
+		Sequence:     0,
+		Time:         time.Time{},
+		Kind:         "",
+		RecordId:     uuid.Nil,
+		PollId:       uuid.Nil,
+		Digest:       "",
+		PreviousHash: "",
+		Hash:         "",
+	}
+}
+
+// NewChainEntryModel returns the entry for the record that follows previous (nil for the first entry of a chain),
+// the hash is computed. The id of the entry is not set.
+func NewChainEntryModel(previous *ChainEntryModel, meetingId uuid.UUID, now time.Time, record *ChainRecord) *ChainEntryModel {
+	res := &ChainEntryModel{
+		IdModel:      EmptyIdModel(),
+		MeetingId:    meetingId,
+		Sequence:     1,
+		Time:         now.UTC().Truncate(time.Millisecond),
+		Kind:         record.Kind,
+		RecordId:     record.RecordId,
+		PollId:       record.PollId,
+		Digest:       record.Digest,
+		PreviousHash: ChainGenesisHash,
+		Hash:         "",
+	}
+	if previous != nil {
+		res.Sequence = previous.Sequence + 1
+		res.PreviousHash = previous.Hash
+	}
+	res.Hash = res.ComputeHash()
+	return res
+}
+
+// NewChainEntries returns the entries for all records, the first one follows previous (see NewChainEntryModel).
+func NewChainEntries(previous *ChainEntryModel, meetingId uuid.UUID, now time.Time, records []*ChainRecord) []*ChainEntryModel {
+	res := make([]*ChainEntryModel, len(records))
+	for i, record := range records {
+		previous = NewChainEntryModel(previous, meetingId, now, record)
+		res[i] = previous
+	}
+	return res
+}
+
+// chainEntryContent is the content of a chain entry that is hashed by ComputeHash.
+type chainEntryContent struct {
+	PreviousHash string    `json:"previous_hash"`
+	MeetingId    uuid.UUID `json:"meeting_id"`
+	Sequence     int64     `json:"sequence"`
+	Time         string    `json:"time"`
+	Kind         string    `json:"kind"`
+	RecordId     uuid.UUID `json:"record_id"`
+	PollId       uuid.UUID `json:"poll_id"`
+	Digest       string    `json:"digest"`
+}
+
+// ComputeHash computes the hash of the entry from all fields except the id and the hash itself.
+func (m *ChainEntryModel) ComputeHash() string {
+	res, err := chainDigest(&chainEntryContent{
+		PreviousHash: m.PreviousHash,
+		MeetingId:    m.MeetingId,
+		Sequence:     m.Sequence,
+		Time:         chainTime(m.Time),
+		Kind:         m.Kind,
+		RecordId:     m.RecordId,
+		PollId:       m.PollId,
+		Digest:       m.Digest,
+	})
+	if err != nil {
+		// can't happen, the content only consists of strings and numbers
+		panic(err)
+	}
+	return res
+}
+
+func (m *ChainEntryModel) String() string {
+	return fmt.Sprintf("ChainEntryModel(Id=%s, MeetingId=%s, Sequence=%d, Time=%s, Kind=%s, RecordId=%s, PollId=%s, Digest=%s, PreviousHash=%s, Hash=%s)",
+		m.Id, m.MeetingId, m.Sequence, m.Time, m.Kind, m.RecordId, m.PollId, m.Digest, m.PreviousHash, m.Hash)
+}
+
+// ChainProblem is an inconsistency found by VerifyChain.
+// Sequence is the sequence number of the affected chain entry, 0 if the problem is not related to an entry (for
+// example a vote that is not linked into the chain).
+type ChainProblem struct {
+	Sequence int64
+	Message  string
+}
+
+func (p *ChainProblem) String() string {
+	if p.Sequence == 0 {
+		return p.Message
+	}
+	return fmt.Sprintf("entry %d: %s", p.Sequence, p.Message)
+}
+
+// ChainReport is the result of VerifyChain.
+// Head is the hash of the last entry of the chain (ChainGenesisHash if the chain is empty), it can be published to
+// prove later that the chain has not been replaced, see CheckPublishedHead. MeetingDeleted is true if the meeting of
+// the chain has been deleted, see VerifyDeletedMeetingChain.
+type ChainReport struct {
+	MeetingId       uuid.UUID
+	MeetingDeleted  bool
+	NumEntries      int
+	NumPolls        int
+	NumVotes        int
+	NumAuditEntries int
+	Head            string
+	Problems        []*ChainProblem
+
+	// sequences maps the hash of each entry to its sequence number
+	sequences map[string]int64
+}
+
+// CheckPublishedHead checks a head that has been published earlier (for example in the minutes of the meeting): it
+// must be the hash of an entry of the chain, otherwise the chain has been replaced and a problem is added to the
+// report. Entries appended after the head has been published are fine.
+// It returns the sequence number of the entry, 0 if the head is not found.
+func (r *ChainReport) CheckPublishedHead(head string) int64 {
+	if head == ChainGenesisHash {
+		return 0
+	}
+	sequence, found := r.sequences[head]
+	if !found {
+		r.addProblem(0, "published head %s is not contained in the chain, the chain was replaced", head)
+	}
+	return sequence
+}
+
+// Valid returns true if no problems were found.
+func (r *ChainReport) Valid() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *ChainReport) addProblem(sequence int64, format string, a ...interface{}) {
+	r.Problems = append(r.Problems, &ChainProblem{
+		Sequence: sequence,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// VerifyChain checks the chain of the meeting (sorted by sequence number) against the votes of the meeting and the
+// audit entries that reference the meeting.
+//
+// It reports entries with a wrong sequence number, meeting, previous hash or hash (the chain was changed), poll
+// definitions (of polls that are not drafts), votes and audit entries that are not linked into the chain, that
+// don't match the digest of their entry (the record was changed) and entries whose record no longer exists (the
+// record was deleted).
+func VerifyChain(chain []*ChainEntryModel, meeting *MeetingModel, auditEntries []*AuditEntryModel) *ChainReport {
+	return verifyChain(chain, meeting.Id, meeting, auditEntries)
+}
+
+// VerifyDeletedMeetingChain checks the chain of a meeting that has been deleted, chains and audit entries are kept
+// when their meeting is deleted. The polls and votes have been deleted with the meeting, so only the entries
+// themselves and the audit entries that reference the meeting are checked (see VerifyChain).
+func VerifyDeletedMeetingChain(chain []*ChainEntryModel, meetingId uuid.UUID, auditEntries []*AuditEntryModel) *ChainReport {
+	res := verifyChain(chain, meetingId, nil, auditEntries)
+	res.MeetingDeleted = true
+	return res
+}
+
+// verifyChain implements VerifyChain, meeting is nil if the meeting has been deleted.
+func verifyChain(chain []*ChainEntryModel, meetingId uuid.UUID, meeting *MeetingModel, auditEntries []*AuditEntryModel) *ChainReport {
+	res := &ChainReport{
+		MeetingId:      meetingId,
+		MeetingDeleted: false,
+		NumEntries:     len(chain),
+		Head:           ChainGenesisHash,
+		Problems:       make([]*ChainProblem, 0),
+		sequences:      make(map[string]int64, len(chain)),
+	}
+	// the records stored in the chain by kind and record id
+	records := map[string]map[uuid.UUID]*ChainEntryModel{
+		ChainPollRecord:  make(map[uuid.UUID]*ChainEntryModel),
+		ChainVoteRecord:  make(map[uuid.UUID]*ChainEntryModel),
+		ChainAuditRecord: make(map[uuid.UUID]*ChainEntryModel),
+	}
+	var previous *ChainEntryModel
+	for i, entry := range chain {
+		expectedSequence := int64(i + 1)
+		expectedPrevious := ChainGenesisHash
+		if previous != nil {
+			expectedPrevious = previous.Hash
+		}
+		switch {
+		case entry.Sequence != expectedSequence:
+			res.addProblem(entry.Sequence, "expected sequence number %d, entries are missing or were inserted", expectedSequence)
+		case entry.MeetingId != meetingId:
+			res.addProblem(entry.Sequence, "entry belongs to meeting %s", entry.MeetingId)
+		case entry.PreviousHash != expectedPrevious:
+			res.addProblem(entry.Sequence, "previous hash %s doesn't match the hash %s of the previous entry", entry.PreviousHash, expectedPrevious)
+		case entry.Hash != entry.ComputeHash():
+			res.addProblem(entry.Sequence, "hash doesn't match the content of the entry, the entry was changed")
+		}
+		previous = entry
+		res.Head = entry.Hash
+		res.sequences[entry.Hash] = entry.Sequence
+		byId, knownKind := records[entry.Kind]
+		if !knownKind {
+			res.addProblem(entry.Sequence, "unknown record kind \"%s\"", entry.Kind)
+			continue
+		}
+		if _, duplicate := byId[entry.RecordId]; duplicate {
+			res.addProblem(entry.Sequence, "%s %s is linked more than once", entry.Kind, entry.RecordId)
+			continue
+		}
+		byId[entry.RecordId] = entry
+	}
+
+	checkRecord := func(kind string, id uuid.UUID, digest string, digestErr error, description string) {
+		entry, linked := records[kind][id]
+		switch {
+		case digestErr != nil:
+			res.addProblem(0, "can't compute digest of %s: %v", description, digestErr)
+		case !linked:
+			res.addProblem(0, "%s is not linked into the chain", description)
+		case entry.Digest != digest:
+			res.addProblem(entry.Sequence, "%s was changed", description)
+		}
+		delete(records[kind], id)
+	}
+	var groups []*PollGroupModel
+	if meeting != nil {
+		groups = meeting.Groups
+	}
+	for _, group := range groups {
+		for _, poll := range group.Polls {
+			// drafts can still be changed, they're linked when they're opened
+			if poll.GetPollModel().GetState() != PollStateDraft {
+				res.NumPolls++
+				digest, digestErr := PollDigest(poll)
+				checkRecord(ChainPollRecord, poll.GetId(), digest, digestErr,
+					fmt.Sprintf("definition of poll \"%s\" (%s)", poll.GetPollModel().Name, poll.GetId()))
+			}
+			for _, vote := range PollVotes(poll) {
+				res.NumVotes++
+				digest, digestErr := VoteDigest(poll.GetId(), vote)
+				checkRecord(ChainVoteRecord, vote.GetId(), digest, digestErr,
+					fmt.Sprintf("vote %s of %s in poll \"%s\"", vote.GetId(), voteVoterName(vote), poll.GetPollModel().Name))
+			}
+		}
+	}
+	for _, entry := range auditEntries {
+		res.NumAuditEntries++
+		digest, digestErr := AuditEntryDigest(entry)
+		checkRecord(ChainAuditRecord, entry.Id, digest, digestErr,
+			fmt.Sprintf("audit entry %s (%s at %s)", entry.Id, entry.Action, chainTime(entry.Time)))
+	}
+	// all entries still in the map reference records that don't exist any more, the polls and votes of a deleted
+	// meeting are expected to be gone
+	for _, entry := range chain {
+		if meeting == nil && entry.Kind != ChainAuditRecord {
+			continue
+		}
+		if missing, ok := records[entry.Kind][entry.RecordId]; ok && missing == entry {
+			res.addProblem(entry.Sequence, "%s %s was deleted", entry.Kind, entry.RecordId)
+		}
+	}
+	return res
+}
+
+// UnlinkedChainRecords returns the records for all poll definitions (of polls that are not drafts), votes and audit
+// entries of the meeting that are not linked into the chain, in the order polls, votes and audit entries (sorted by
+// time). Records that are linked but were changed are not returned, VerifyChain reports them.
+//
+// It's used to link polls, votes and audit entries that were stored before hash chains were introduced, see
+// ChainHandler.LinkUnchainedRecords.
+func UnlinkedChainRecords(chain []*ChainEntryModel, meeting *MeetingModel, auditEntries []*AuditEntryModel) ([]*ChainRecord, error) {
+	linked := make(map[string]map[uuid.UUID]struct{}, 3)
+	for _, entry := range chain {
+		if linked[entry.Kind] == nil {
+			linked[entry.Kind] = make(map[uuid.UUID]struct{})
+		}
+		linked[entry.Kind][entry.RecordId] = struct{}{}
+	}
+	isLinked := func(kind string, id uuid.UUID) bool {
+		_, ok := linked[kind][id]
+		return ok
+	}
+	polls := make([]*ChainRecord, 0)
+	votes := make([]*ChainRecord, 0)
+	for _, group := range meeting.Groups {
+		for _, poll := range group.Polls {
+			if poll.GetPollModel().GetState() != PollStateDraft && !isLinked(ChainPollRecord, poll.GetId()) {
+				record, recordErr := NewPollChainRecord(poll)
+				if recordErr != nil {
+					return nil, recordErr
+				}
+				polls = append(polls, record)
+			}
+			for _, vote := range PollVotes(poll) {
+				if isLinked(ChainVoteRecord, vote.GetId()) {
+					continue
+				}
+				record, recordErr := NewVoteChainRecord(NewPollVote(poll.GetId(), vote))
+				if recordErr != nil {
+					return nil, recordErr
+				}
+				votes = append(votes, record)
+			}
+		}
+	}
+	sortedEntries := make([]*AuditEntryModel, len(auditEntries))
+	copy(sortedEntries, auditEntries)
+	sort.SliceStable(sortedEntries, func(i, j int) bool {
+		return sortedEntries[i].Time.Before(sortedEntries[j].Time)
+	})
+	res := append(polls, votes...)
+	for _, entry := range sortedEntries {
+		if isLinked(ChainAuditRecord, entry.Id) {
+			continue
+		}
+		record, recordErr := NewAuditChainRecord(entry)
+		if recordErr != nil {
+			return nil, recordErr
+		}
+		res = append(res, record)
+	}
+	return res, nil
+}
+
+// LinkAllUnchainedRecords calls ChainHandler.LinkUnchainedRecords for all meetings, it returns the number of appended
+// chain entries.
+func LinkAllUnchainedRecords(ctx context.Context, handler DataHandler) (int, error) {
+	res := 0
+	query := NewMeetingListQuery().SetLimit(100)
+	for {
+		page, pageErr := handler.ListMeetings(ctx, query)
+		if pageErr != nil {
+			return res, pageErr
+		}
+		for _, meeting := range page.Meetings {
+			num, linkErr := handler.LinkUnchainedRecords(ctx, meeting.Id)
+			if linkErr != nil {
+				return res, fmt.Errorf("can't link the chain of meeting %s: %w", meeting.Id, linkErr)
+			}
+			res += num
+		}
+		if !page.HasNext() {
+			return res, nil
+		}
+		query.SetCursor(page.NextCursor)
+	}
+}
+
+// meetingChainData reads the chain and the audit entries of the meeting.
+func meetingChainData(ctx context.Context, handler DataHandler, meetingId uuid.UUID) ([]*ChainEntryModel, []*AuditEntryModel, error) {
+	chain, chainErr := handler.GetChain(ctx, meetingId)
+	if chainErr != nil {
+		return nil, nil, chainErr
+	}
+	auditEntries := make([]*AuditEntryModel, 0)
+	query := NewAuditQuery().SetMeetingId(&meetingId).SetLimit(500)
+	auditErr := AllAuditEntries(ctx, handler, query, func(entry *AuditEntryModel) error {
+		auditEntries = append(auditEntries, entry)
+		return nil
+	})
+	if auditErr != nil {
+		return nil, nil, auditErr
+	}
+	return chain, auditEntries, nil
+}
+
+// VerifyMeetingChain reads the chain and the audit entries of the meeting and checks them with VerifyChain.
+func VerifyMeetingChain(ctx context.Context, handler DataHandler, meeting *MeetingModel) (*ChainReport, error) {
+	chain, auditEntries, err := meetingChainData(ctx, handler, meeting.Id)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyChain(chain, meeting, auditEntries), nil
+}
+
+// VerifyAllChains checks all stored chains (see ChainHandler.GetChainMeetingIds) and returns a report for each chain.
+// The chains of existing meetings are checked with VerifyMeetingChain, the chains of deleted meetings with
+// VerifyDeletedMeetingChain.
+func VerifyAllChains(ctx context.Context, handler DataHandler) ([]*ChainReport, error) {
+	meetingIds, idsErr := handler.GetChainMeetingIds(ctx)
+	if idsErr != nil {
+		return nil, idsErr
+	}
+	res := make([]*ChainReport, 0, len(meetingIds))
+	for _, meetingId := range meetingIds {
+		meetingId := meetingId
+		meeting, getErr := handler.GetMeeting(ctx, NewMeetingQueryArgs().SetId(&meetingId))
+		if getErr != nil && !isEntryNotFound(getErr) {
+			return nil, getErr
+		}
+		if getErr == nil {
+			report, verifyErr := VerifyMeetingChain(ctx, handler, meeting)
+			if verifyErr != nil {
+				return nil, verifyErr
+			}
+			res = append(res, report)
+			continue
+		}
+		chain, auditEntries, dataErr := meetingChainData(ctx, handler, meetingId)
+		if dataErr != nil {
+			return nil, dataErr
+		}
+		res = append(res, VerifyDeletedMeetingChain(chain, meetingId, auditEntries))
+	}
+	return res, nil
+}
+
+// MeetingChainHead returns the hash of the last entry of the chain of the meeting, ChainGenesisHash if the chain is
+// empty. It's published in the minutes and the results so that a replaced chain can be detected, see
+// ChainReport.CheckPublishedHead.
+func MeetingChainHead(ctx context.Context, handler ChainHandler, meetingId uuid.UUID) (string, error) {
+	chain, chainErr := handler.GetChain(ctx, meetingId)
+	if chainErr != nil {
+		return "", chainErr
+	}
+	if len(chain) == 0 {
+		return ChainGenesisHash, nil
+	}
+	return chain[len(chain)-1].Hash, nil
+}
+
+// ChainHandler gives access to the hash chains of meetings.
+//
+// The handlers append an entry for each vote in MeetingsHandler.AddVotes, for each audit entry with a MeetingId in
+// AuditHandler.InsertAuditEntry and for the definition of each poll that is opened (MeetingsHandler.UpdatePollState,
+// UpdateMeetingPollStates and ApplyVotingTransition), together with the change itself. Polls and votes that are stored
+// together with a meeting (MeetingsHandler.InsertMeeting) are not linked, VerifyChain reports them until they're linked
+// with LinkUnchainedRecords. Archives contain the chains, they're imported with ArchiveImportHandler.WriteImport.
+// There are no methods to change or delete entries, chains (and the audit entries of a meeting) are not deleted
+// together with their meetings: the chains of deleted meetings are checked with VerifyDeletedMeetingChain.
+type ChainHandler interface {
+	// GetChain returns all entries of the chain of the meeting, sorted by sequence number.
+	GetChain(ctx context.Context, meetingId uuid.UUID) ([]*ChainEntryModel, error)
+	// GetChainMeetingIds returns the ids of all meetings that have a chain sorted by id, including meetings that
+	// have been deleted.
+	GetChainMeetingIds(ctx context.Context) ([]uuid.UUID, error)
+	// LinkUnchainedRecords appends the poll definitions, votes and audit entries of the meeting that are not linked
+	// into its chain yet (see UnlinkedChainRecords) in a single transaction (MongoDataHandler only if the deployment
+	// supports transactions). It returns the number of appended entries.
+	// It's used to link data that was stored before hash chains were introduced.
+	LinkUnchainedRecords(ctx context.Context, meetingId uuid.UUID) (int, error)
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Cursors are used for keyset pagination: a cursor stores the sort key of the last element of a page, the next page
+// starts after that element. Cursors are encoded as opaque url-safe strings.
+
+// EncodeCursor encodes a cursor value (that must be encodable as json) as an opaque string.
+func EncodeCursor(value interface{}) (string, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+// DecodeCursor decodes a cursor created with EncodeCursor into dst.
+// It returns an InvalidQueryArgsError if the cursor is not valid.
+func DecodeCursor(cursor string, dst interface{}) error {
+	decoded, base64Err := base64.RawURLEncoding.DecodeString(cursor)
+	if base64Err != nil {
+		return NewInvalidQueryArgsError(fmt.Sprintf("invalid cursor \"%s\"", cursor))
+	}
+	if jsonErr := json.Unmarshal(decoded, dst); jsonErr != nil {
+		return NewInvalidQueryArgsError(fmt.Sprintf("invalid cursor \"%s\"", cursor))
+	}
+	return nil
+}
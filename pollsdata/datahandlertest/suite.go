@@ -0,0 +1,1489 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package datahandlertest contains a behavioural test suite for implementations of pollsdata.DataHandler.
+//
+// Each storage backend should run the suite from its tests:
+//
+//	func TestConformance(t *testing.T) {
+//		datahandlertest.Run(t, func(t *testing.T) pollsdata.DataHandler {
+//			return newEmptyHandler(t)
+//		})
+//	}
+//
+// The suite only relies on the documented behaviour of the handler interfaces. All times used by the suite are
+// multiples of a millisecond, so backends that store times with millisecond precision pass it.
+package datahandlertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/google/uuid"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// NewHandlerFunc returns a new handler without any entries.
+//
+// It is called once for each test of the suite, the suite closes the handler at the end of the test. Other resources
+// (for example temporary files) can be removed with t.Cleanup.
+type NewHandlerFunc func(t *testing.T) pollsdata.DataHandler
+
+// suiteTest is a single test of the suite, it gets a new handler.
+type suiteTest struct {
+	name string
+	run  func(t *testing.T, h pollsdata.DataHandler)
+}
+
+var suiteTests = []suiteTest{
+	{"UniquePeriods", testUniquePeriods},
+	{"UniqueMeetings", testUniqueMeetings},
+	{"Validation", testValidation},
+	{"NotFound", testNotFound},
+	{"QueryArgs", testQueryArgs},
+	{"ActivePeriods", testActivePeriods},
+	{"PeriodOrdering", testPeriodOrdering},
+	{"MeetingOrdering", testMeetingOrdering},
+	{"OnlineVoting", testOnlineVoting},
+	{"Votes", testVotes},
+	{"PollStates", testPollStates},
+	{"Conflicts", testConflicts},
+	{"ConcurrentVotes", testConcurrentVotes},
+	{"NotificationsSent", testNotificationsSent},
+	{"DeleteMeeting", testDeleteMeeting},
+	{"DeletePeriod", testDeletePeriod},
+	{"Webhooks", testWebhooks},
+	{"AuditLog", testAuditLog},
+	{"HashChain", testHashChain},
+	{"WriteImport", testWriteImport},
+	{"WriteImportReplaceChains", testWriteImportReplaceChains},
+	{"LinkUnchainedRecords", testLinkUnchainedRecords},
+	{"Clock", testClock},
+}
+
+// Run runs all tests of the suite as subtests of t, each test gets a new handler from newHandler.
+func Run(t *testing.T, newHandler NewHandlerFunc) {
+	for _, test := range suiteTests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			h := newHandler(t)
+			defer func() {
+				if err := h.Close(context.Background()); err != nil {
+					t.Errorf("can't close handler: %v", err)
+				}
+			}()
+			test.run(t, h)
+		})
+	}
+}
+
+// suiteTime is the reference time of the suite.
+var suiteTime = time.Date(2020, 7, 1, 18, 0, 0, 0, time.UTC)
+
+const day = 24 * time.Hour
+
+func newPeriod(name, slug string, start, end time.Time) *pollsdata.PeriodSettingsModel {
+	return pollsdata.NewPeriodSettingsModel(pollsweb.NewFakeClock(suiteTime), name, slug,
+		pollsdata.NewMeetingTimeTemplateModel(time.Monday, 18, 0), nil, start, end)
+}
+
+func insertPeriod(t *testing.T, h pollsdata.DataHandler, name, slug string, start, end time.Time) *pollsdata.PeriodSettingsModel {
+	t.Helper()
+	period := newPeriod(name, slug, start, end)
+	if _, err := h.InsertPeriod(context.Background(), period); err != nil {
+		t.Fatalf("can't insert period \"%s\": %v", slug, err)
+	}
+	return period
+}
+
+// newMeeting returns a meeting with two voters and one group with a basic (roll call) and a median poll (both
+// drafts).
+func newMeeting(t *testing.T, slug string, periodId uuid.UUID, meetingTime, onlineStart, onlineEnd time.Time) *pollsdata.MeetingModel {
+	t.Helper()
+	voters := []*pollsdata.VoterModel{
+		pollsdata.NewVoterModel("Alice Voter", "alice-voter", 1),
+		pollsdata.NewVoterModel("Bob Voter", "bob-voter", 2),
+	}
+	majority := pollsdata.NewMajorityModel(1, 2)
+	motion := pollsdata.NewBasicPollModel("Motion", "motion", majority, false, nil)
+	motion.RollCall = true
+	group := pollsdata.NewPollGroupModel("Group", "group", []pollsdata.AbstractPollModel{
+		motion,
+		pollsdata.NewMedianPollModel("Budget", "budget", majority, false, 10000, "€", nil),
+	})
+	meeting := pollsdata.NewMeetingModel(pollsweb.NewFakeClock(suiteTime), "Meeting "+slug, slug, periodId,
+		meetingTime, onlineStart, onlineEnd, voters, []*pollsdata.PollGroupModel{group})
+	if err := meeting.GenIds(); err != nil {
+		t.Fatal(err)
+	}
+	return meeting
+}
+
+func insertMeeting(t *testing.T, h pollsdata.DataHandler, slug string, periodId uuid.UUID, meetingTime, onlineStart, onlineEnd time.Time) *pollsdata.MeetingModel {
+	t.Helper()
+	meeting := newMeeting(t, slug, periodId, meetingTime, onlineStart, onlineEnd)
+	if err := h.InsertMeeting(context.Background(), meeting); err != nil {
+		t.Fatalf("can't insert meeting \"%s\": %v", slug, err)
+	}
+	return meeting
+}
+
+func newBasicVote(voterName, voterSlug string, answer gopolls.BasicPollAnswer) *pollsdata.BasicPollVoteModel {
+	vote := pollsdata.NewBasicPollVoteModel(voterName, voterSlug, answer)
+	vote.SetId(uuid.New())
+	return vote
+}
+
+func periodById(id uuid.UUID) *pollsdata.PeriodSettingsQueryArgs {
+	return pollsdata.NewPeriodSettingsQueryArgs().SetId(&id)
+}
+
+func meetingById(id uuid.UUID) *pollsdata.MeetingQueryArgs {
+	return pollsdata.NewMeetingQueryArgs().SetId(&id)
+}
+
+func getMeeting(t *testing.T, h pollsdata.DataHandler, id uuid.UUID) *pollsdata.MeetingModel {
+	t.Helper()
+	meeting, err := h.GetMeeting(context.Background(), meetingById(id))
+	if err != nil {
+		t.Fatalf("can't get meeting %s: %v", id, err)
+	}
+	return meeting
+}
+
+func expectDuplicate(t *testing.T, err error, field string) {
+	t.Helper()
+	var duplicateErr pollsdata.DuplicateEntryError
+	if !errors.As(err, &duplicateErr) {
+		t.Errorf("expected a DuplicateEntryError for \"%s\", got %v", field, err)
+		return
+	}
+	if duplicateErr.Field != field {
+		t.Errorf("expected a DuplicateEntryError for \"%s\", got one for \"%s\"", field, duplicateErr.Field)
+	}
+}
+
+func expectNotFound(t *testing.T, err error, what string) {
+	t.Helper()
+	var notFound pollsdata.EntryNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("%s: expected an EntryNotFoundError, got %v", what, err)
+	}
+}
+
+func expectInvalidQuery(t *testing.T, err error, what string) {
+	t.Helper()
+	var invalidQuery pollsdata.InvalidQueryArgsError
+	if !errors.As(err, &invalidQuery) {
+		t.Errorf("%s: expected an InvalidQueryArgsError, got %v", what, err)
+	}
+}
+
+func expectValidationError(t *testing.T, err error, what string) {
+	t.Helper()
+	var validationErr *pollsdata.ModelValidationError
+	if !errors.As(err, &validationErr) {
+		t.Errorf("%s: expected a ModelValidationError, got %v", what, err)
+	}
+}
+
+func periodSlugs(periods []*pollsdata.PeriodSettingsModel) []string {
+	res := make([]string, len(periods))
+	for i, period := range periods {
+		res[i] = period.Slug
+	}
+	return res
+}
+
+func meetingSlugs(meetings []*pollsdata.MeetingModel) []string {
+	res := make([]string, len(meetings))
+	for i, meeting := range meetings {
+		res[i] = meeting.Slug
+	}
+	return res
+}
+
+func expectSlugs(t *testing.T, what string, got, expected []string) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("%s: expected %v, got %v", what, expected, got)
+	}
+}
+
+func sortedSlugs(slugs []string) []string {
+	res := append([]string(nil), slugs...)
+	sort.Strings(res)
+	return res
+}
+
+func pollVoterNames(t *testing.T, meeting *pollsdata.MeetingModel, pollId uuid.UUID) []string {
+	t.Helper()
+	poll := meeting.GetPoll(pollId)
+	if poll == nil {
+		t.Fatalf("poll %s not found", pollId)
+	}
+	names := make([]string, 0)
+	for name := range pollsdata.PollVoterNames(poll) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func testUniquePeriods(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	first := insertPeriod(t, h, "Period One", "period-one", suiteTime, suiteTime.Add(day))
+	insertPeriod(t, h, "Period Two", "period-two", suiteTime, suiteTime.Add(day))
+	_, nameErr := h.InsertPeriod(ctx, newPeriod("Period One", "other-slug", suiteTime, suiteTime.Add(day)))
+	expectDuplicate(t, nameErr, "name")
+	_, slugErr := h.InsertPeriod(ctx, newPeriod("Other Period", "period-one", suiteTime, suiteTime.Add(day)))
+	expectDuplicate(t, slugErr, "slug")
+	expectDuplicate(t, h.RenamePeriod(ctx, periodById(first.Id), "Period Two", "period-renamed"), "name")
+	expectDuplicate(t, h.RenamePeriod(ctx, periodById(first.Id), "Period Renamed", "period-two"), "slug")
+	// renaming to the same name is not a conflict
+	if err := h.RenamePeriod(ctx, periodById(first.Id), "Period One", "period-one"); err != nil {
+		t.Errorf("renaming a period to its own name failed: %v", err)
+	}
+	if err := h.RenamePeriod(ctx, periodById(first.Id), "Period Renamed", "period-renamed"); err != nil {
+		t.Fatalf("can't rename period: %v", err)
+	}
+	// the old name and slug can be used again
+	insertPeriod(t, h, "Period One", "period-one", suiteTime, suiteTime.Add(day))
+	page, listErr := h.ListPeriods(ctx, pollsdata.NewPeriodListQuery())
+	if listErr != nil {
+		t.Fatal(listErr)
+	}
+	expectSlugs(t, "periods", sortedSlugs(periodSlugs(page.Periods)), []string{"period-one", "period-renamed", "period-two"})
+}
+
+func testUniqueMeetings(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	period := insertPeriod(t, h, "Period One", "period-one", suiteTime, suiteTime.Add(day))
+	first := insertMeeting(t, h, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+	sameSlug := newMeeting(t, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+	sameSlug.Name = "Another Meeting"
+	expectDuplicate(t, h.InsertMeeting(ctx, sameSlug), "slug")
+	sameName := newMeeting(t, "meeting-two", period.Id, suiteTime, time.Time{}, time.Time{})
+	sameName.Name = first.Name
+	expectDuplicate(t, h.InsertMeeting(ctx, sameName), "name")
+	sameId := newMeeting(t, "meeting-three", period.Id, suiteTime, time.Time{}, time.Time{})
+	sameId.Id = first.Id
+	expectDuplicate(t, h.InsertMeeting(ctx, sameId), "id")
+	meetings, getErr := h.GetMeetingsForPeriod(ctx, period.Id)
+	if getErr != nil {
+		t.Fatal(getErr)
+	}
+	expectSlugs(t, "meetings", meetingSlugs(meetings), []string{"meeting-one"})
+	// after deleting the meeting the slug can be used again
+	if _, err := h.DeleteMeeting(ctx, meetingById(first.Id)); err != nil {
+		t.Fatal(err)
+	}
+	insertMeeting(t, h, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+}
+
+func testValidation(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	_, periodErr := h.InsertPeriod(ctx, newPeriod("Period One", "period-one", suiteTime, suiteTime.Add(-day)))
+	expectValidationError(t, periodErr, "period with start after end")
+	page, listErr := h.ListPeriods(ctx, pollsdata.NewPeriodListQuery())
+	if listErr != nil {
+		t.Fatal(listErr)
+	}
+	if len(page.Periods) != 0 {
+		t.Errorf("an invalid period was stored: %v", page.Periods)
+	}
+	period := insertPeriod(t, h, "Period One", "period-one", suiteTime, suiteTime.Add(day))
+	expectValidationError(t, h.RenamePeriod(ctx, periodById(period.Id), "Sh", "short"), "too short period name")
+	invalidVoters := []*pollsdata.VoterModel{pollsdata.NewVoterModel("Sh", "sh", 1)}
+	invalidVoters[0].SetId(uuid.New())
+	expectValidationError(t, h.UpdatePeriodVoters(ctx, periodById(period.Id), invalidVoters), "invalid period voters")
+
+	meeting := newMeeting(t, "meeting-one", period.Id, suiteTime, suiteTime.Add(day), suiteTime)
+	expectValidationError(t, h.InsertMeeting(ctx, meeting), "meeting with online start after online end")
+	meetings, getErr := h.GetMeetingsForPeriod(ctx, period.Id)
+	if getErr != nil {
+		t.Fatal(getErr)
+	}
+	if len(meetings) != 0 {
+		t.Errorf("an invalid meeting was stored: %v", meetings)
+	}
+	meeting = insertMeeting(t, h, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+	expectValidationError(t, h.UpdateMeetingVoters(ctx, meetingById(meeting.Id), invalidVoters), "invalid meeting voters")
+	stored := getMeeting(t, h, meeting.Id)
+	if len(stored.Voters) != 2 || stored.UpdateToken != meeting.UpdateToken {
+		t.Error("the meeting was changed by an invalid update")
+	}
+}
+
+func testNotFound(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	missing := uuid.New()
+	missingSlug := "missing"
+	_, periodErr := h.GetPeriod(ctx, periodById(missing))
+	expectNotFound(t, periodErr, "GetPeriod by id")
+	_, periodErr = h.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetSlug(&missingSlug))
+	expectNotFound(t, periodErr, "GetPeriod by slug")
+	_, periodErr = h.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetName(&missingSlug))
+	expectNotFound(t, periodErr, "GetPeriod by name")
+	expectNotFound(t, h.UpdatePeriodVoters(ctx, periodById(missing), nil), "UpdatePeriodVoters")
+	expectNotFound(t, h.RenamePeriod(ctx, periodById(missing), "Period One", "period-one"), "RenamePeriod")
+	_, meetingErr := h.GetMeeting(ctx, meetingById(missing))
+	expectNotFound(t, meetingErr, "GetMeeting by id")
+	_, meetingErr = h.GetMeeting(ctx, pollsdata.NewMeetingQueryArgs().SetSlug(&missingSlug))
+	expectNotFound(t, meetingErr, "GetMeeting by slug")
+	expectNotFound(t, h.UpdateMeetingVoters(ctx, meetingById(missing), nil), "UpdateMeetingVoters")
+	expectNotFound(t, h.UpdateMeetingGroups(ctx, meetingById(missing), nil), "UpdateMeetingGroups")
+	expectNotFound(t, h.UpdatePollState(ctx, meetingById(missing), uuid.New(), pollsdata.PollStateOpen), "UpdatePollState")
+	expectNotFound(t, h.AddVotes(ctx, meetingById(missing), nil), "AddVotes")
+	_, webhookErr := h.GetWebhook(ctx, missing)
+	expectNotFound(t, webhookErr, "GetWebhook")
+
+	// a meeting can only be inserted if its period exists
+	expectNotFound(t, h.InsertMeeting(ctx, newMeeting(t, "meeting-one", missing, suiteTime, time.Time{}, time.Time{})),
+		"InsertMeeting without period")
+	period := insertPeriod(t, h, "Period One", "period-one", suiteTime, suiteTime.Add(day))
+	meeting := insertMeeting(t, h, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+	expectNotFound(t, h.UpdatePollState(ctx, meetingById(meeting.Id), uuid.New(), pollsdata.PollStateOpen),
+		"UpdatePollState with unknown poll")
+
+	_, invalidErr := h.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs())
+	expectInvalidQuery(t, invalidErr, "GetPeriod without arguments")
+	_, invalidErr = h.GetMeeting(ctx, pollsdata.NewMeetingQueryArgs())
+	expectInvalidQuery(t, invalidErr, "GetMeeting without arguments")
+}
+
+func testQueryArgs(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	period := insertPeriod(t, h, "Period One", "period-one", suiteTime, suiteTime.Add(day))
+	insertPeriod(t, h, "Period Two", "period-two", suiteTime, suiteTime.Add(day))
+	name, slug, otherSlug := "Period One", "period-one", "period-two"
+	queries := map[string]*pollsdata.PeriodSettingsQueryArgs{
+		"id":          periodById(period.Id),
+		"name":        pollsdata.NewPeriodSettingsQueryArgs().SetName(&name),
+		"slug":        pollsdata.NewPeriodSettingsQueryArgs().SetSlug(&slug),
+		"id and slug": periodById(period.Id).SetSlug(&slug),
+	}
+	for what, args := range queries {
+		got, err := h.GetPeriod(ctx, args)
+		if err != nil {
+			t.Errorf("GetPeriod by %s: %v", what, err)
+			continue
+		}
+		if got.Id != period.Id || got.Name != period.Name || !got.Start.Equal(period.Start) || !got.End.Equal(period.End) {
+			t.Errorf("GetPeriod by %s: expected %v, got %v", what, period, got)
+		}
+	}
+	// all arguments must match
+	_, mismatchErr := h.GetPeriod(ctx, periodById(period.Id).SetSlug(&otherSlug))
+	expectNotFound(t, mismatchErr, "GetPeriod with id and slug of different periods")
+
+	meeting := insertMeeting(t, h, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+	meetingName, meetingSlug := meeting.Name, meeting.Slug
+	for what, args := range map[string]*pollsdata.MeetingQueryArgs{
+		"id":   meetingById(meeting.Id),
+		"name": pollsdata.NewMeetingQueryArgs().SetName(&meetingName),
+		"slug": pollsdata.NewMeetingQueryArgs().SetSlug(&meetingSlug),
+	} {
+		got, err := h.GetMeeting(ctx, args)
+		if err != nil {
+			t.Errorf("GetMeeting by %s: %v", what, err)
+			continue
+		}
+		if got.Id != meeting.Id || got.PeriodId != period.Id || !got.MeetingTime.Equal(meeting.MeetingTime) ||
+			len(got.Voters) != 2 || len(got.Groups) != 1 || len(got.Groups[0].Polls) != 2 {
+			t.Errorf("GetMeeting by %s: expected %v, got %v", what, meeting, got)
+		}
+	}
+}
+
+func testActivePeriods(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	start, end := suiteTime, suiteTime.Add(7*day)
+	insertPeriod(t, h, "Period Current", "current", start, end)
+	insertPeriod(t, h, "Period Next", "next", end.Add(time.Millisecond), end.Add(7*day))
+	archived := insertPeriod(t, h, "Period Archived", "archived", start, end)
+	if num, err := h.DeletePeriod(ctx, periodById(archived.Id), pollsdata.PeriodDeleteArchive); err != nil || num != 1 {
+		t.Fatalf("can't archive period: %d, %v", num, err)
+	}
+	tests := []struct {
+		referenceTime time.Time
+		expected      []string
+	}{
+		{start.Add(-time.Millisecond), []string{}},
+		{start, []string{"current"}},
+		{start.Add(day), []string{"current"}},
+		{end, []string{"current"}},
+		{end.Add(time.Millisecond), []string{"next"}},
+		{end.Add(8 * day), []string{}},
+	}
+	for _, test := range tests {
+		active, activeErr := h.GetActivePeriods(ctx, test.referenceTime)
+		if activeErr != nil {
+			t.Fatal(activeErr)
+		}
+		expectSlugs(t, fmt.Sprintf("GetActivePeriods(%s)", test.referenceTime), sortedSlugs(periodSlugs(active)), test.expected)
+		latest, latestErr := h.GetLatestPeriods(ctx, 0, test.referenceTime)
+		if latestErr != nil {
+			t.Fatal(latestErr)
+		}
+		expectSlugs(t, fmt.Sprintf("GetLatestPeriods(%s)", test.referenceTime), periodSlugs(latest), test.expected)
+		page, listErr := h.ListPeriods(ctx, pollsdata.NewPeriodListQuery().SetActiveAt(test.referenceTime))
+		if listErr != nil {
+			t.Fatal(listErr)
+		}
+		expectSlugs(t, fmt.Sprintf("ListPeriods(active at %s)", test.referenceTime), periodSlugs(page.Periods), test.expected)
+	}
+}
+
+func testPeriodOrdering(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	// inserted in an order different from the expected order
+	insertPeriod(t, h, "Period Early", "early", suiteTime.Add(-30*day), suiteTime.Add(-20*day))
+	insertPeriod(t, h, "Period Late", "late", suiteTime.Add(10*day), suiteTime.Add(40*day))
+	insertPeriod(t, h, "Period Short", "short", suiteTime.Add(20*day), suiteTime.Add(30*day))
+	insertPeriod(t, h, "Period Long", "long", suiteTime.Add(-10*day), suiteTime.Add(30*day))
+	expected := []string{"late", "short", "long", "early"}
+	latest, latestErr := h.GetLatestPeriods(ctx, 0, time.Time{})
+	if latestErr != nil {
+		t.Fatal(latestErr)
+	}
+	expectSlugs(t, "GetLatestPeriods", periodSlugs(latest), expected)
+	limited, limitedErr := h.GetLatestPeriods(ctx, 2, time.Time{})
+	if limitedErr != nil {
+		t.Fatal(limitedErr)
+	}
+	expectSlugs(t, "GetLatestPeriods with limit", periodSlugs(limited), expected[:2])
+
+	// page through the list in both directions
+	query := pollsdata.NewPeriodListQuery().SetLimit(3)
+	first, firstErr := h.ListPeriods(ctx, query)
+	if firstErr != nil {
+		t.Fatal(firstErr)
+	}
+	expectSlugs(t, "first page", periodSlugs(first.Periods), expected[:3])
+	if !first.HasNext() || first.HasPrev() {
+		t.Fatalf("expected only a next page, got %+v", first)
+	}
+	second, secondErr := h.ListPeriods(ctx, query.SetCursor(first.NextCursor))
+	if secondErr != nil {
+		t.Fatal(secondErr)
+	}
+	expectSlugs(t, "second page", periodSlugs(second.Periods), expected[3:])
+	if second.HasNext() || !second.HasPrev() {
+		t.Fatalf("expected only a previous page, got %+v", second)
+	}
+	prev, prevErr := h.ListPeriods(ctx, query.SetCursor(second.PrevCursor))
+	if prevErr != nil {
+		t.Fatal(prevErr)
+	}
+	expectSlugs(t, "previous page", periodSlugs(prev.Periods), expected[:3])
+	_, cursorErr := h.ListPeriods(ctx, pollsdata.NewPeriodListQuery().SetCursor("not a cursor"))
+	expectInvalidQuery(t, cursorErr, "ListPeriods with invalid cursor")
+}
+
+func testMeetingOrdering(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	period := insertPeriod(t, h, "Period One", "period-one", suiteTime.Add(-30*day), suiteTime.Add(30*day))
+	other := insertPeriod(t, h, "Period Two", "period-two", suiteTime.Add(-30*day), suiteTime.Add(30*day))
+	insertMeeting(t, h, "third", period.Id, suiteTime.Add(3*day), time.Time{}, time.Time{})
+	insertMeeting(t, h, "first", period.Id, suiteTime.Add(-day), time.Time{}, time.Time{})
+	insertMeeting(t, h, "other", other.Id, suiteTime, time.Time{}, time.Time{})
+	insertMeeting(t, h, "second", period.Id, suiteTime.Add(day), time.Time{}, time.Time{})
+	meetings, getErr := h.GetMeetingsForPeriod(ctx, period.Id)
+	if getErr != nil {
+		t.Fatal(getErr)
+	}
+	expectSlugs(t, "GetMeetingsForPeriod", meetingSlugs(meetings), []string{"first", "second", "third"})
+
+	// page through all meetings sorted by meeting time
+	query := pollsdata.NewMeetingListQuery().SetSort(pollsdata.MeetingSortMeetingTime, true).SetLimit(3)
+	first, firstErr := h.ListMeetings(ctx, query)
+	if firstErr != nil {
+		t.Fatal(firstErr)
+	}
+	slugs := make([]string, 0, 4)
+	for _, summary := range first.Meetings {
+		slugs = append(slugs, summary.Slug)
+	}
+	if !first.HasNext() {
+		t.Fatal("expected a second page")
+	}
+	second, secondErr := h.ListMeetings(ctx, query.SetCursor(first.NextCursor))
+	if secondErr != nil {
+		t.Fatal(secondErr)
+	}
+	for _, summary := range second.Meetings {
+		slugs = append(slugs, summary.Slug)
+	}
+	expectSlugs(t, "ListMeetings", slugs, []string{"third", "second", "other", "first"})
+	if second.HasNext() {
+		t.Error("expected no third page")
+	}
+	if summary := first.Meetings[0]; summary.NumVoters != 2 || summary.NumPolls != 2 || summary.PeriodId != period.Id {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	filtered, filterErr := h.ListMeetings(ctx, pollsdata.NewMeetingListQuery().SetPeriodId(&other.Id))
+	if filterErr != nil {
+		t.Fatal(filterErr)
+	}
+	if len(filtered.Meetings) != 1 || filtered.Meetings[0].Slug != "other" {
+		t.Errorf("expected only the meeting of the other period, got %v", filtered.Meetings)
+	}
+	_, cursorErr := h.ListMeetings(ctx, pollsdata.NewMeetingListQuery().SetCursor("not a cursor"))
+	expectInvalidQuery(t, cursorErr, "ListMeetings with invalid cursor")
+}
+
+func testOnlineVoting(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	period := insertPeriod(t, h, "Period One", "period-one", suiteTime.Add(-30*day), suiteTime.Add(30*day))
+	start := suiteTime
+	insertMeeting(t, h, "long", period.Id, start.Add(3*day), start, start.Add(3*day))
+	insertMeeting(t, h, "short", period.Id, start.Add(day), start, start.Add(day))
+	insertMeeting(t, h, "offline", period.Id, start, time.Time{}, time.Time{})
+	tests := []struct {
+		referenceTime time.Time
+		expected      []string
+	}{
+		{start.Add(-time.Millisecond), []string{}},
+		{start, []string{"short", "long"}},
+		{start.Add(day), []string{"short", "long"}},
+		{start.Add(day + time.Millisecond), []string{"long"}},
+		{start.Add(3*day + time.Millisecond), []string{}},
+	}
+	for _, test := range tests {
+		meetings, err := h.GetOnlineVotingMeetings(ctx, test.referenceTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectSlugs(t, fmt.Sprintf("GetOnlineVotingMeetings(%s)", test.referenceTime), meetingSlugs(meetings), test.expected)
+	}
+
+	// the result of GetVotingTransitionMeetings may contain additional meetings, so only check the due ones
+	transitionSlugs := func(referenceTime time.Time) map[string]bool {
+		meetings, err := h.GetVotingTransitionMeetings(ctx, referenceTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := make(map[string]bool, len(meetings))
+		for _, meeting := range meetings {
+			if meeting.Slug == "offline" {
+				t.Error("GetVotingTransitionMeetings returned a meeting without online voting")
+			}
+			if pollsdata.DueVotingTransition(meeting, referenceTime) != nil {
+				res[meeting.Slug] = true
+			}
+		}
+		return res
+	}
+	if due := transitionSlugs(start.Add(-time.Millisecond)); len(due) != 0 {
+		t.Errorf("expected no transitions before online voting, got %v", due)
+	}
+	if due := transitionSlugs(start); !due["short"] || !due["long"] {
+		t.Errorf("expected the drafts of both meetings to be opened, got %v", due)
+	}
+	// open the polls of short, after the end of its online voting they must be closed
+	if _, err := h.UpdateMeetingPollStates(ctx, pollsdata.NewMeetingQueryArgs().SetSlug(stringPtr("short")),
+		pollsdata.PollStateDraft, pollsdata.PollStateOpen); err != nil {
+		t.Fatal(err)
+	}
+	if due := transitionSlugs(start.Add(day)); !due["short"] || !due["long"] {
+		t.Errorf("expected short to be closed and long to be opened, got %v", due)
+	}
+
+	// applied transitions are recorded and not due again
+	shortArgs := pollsdata.NewMeetingQueryArgs().SetSlug(stringPtr("short"))
+	num, applyErr := h.ApplyVotingTransition(ctx, shortArgs, pollsdata.CloseVotingTransition)
+	if applyErr != nil {
+		t.Fatal(applyErr)
+	}
+	if num == 0 {
+		t.Error("expected the open polls of short to be closed")
+	}
+	if _, err := h.ApplyVotingTransition(ctx, pollsdata.NewMeetingQueryArgs().SetSlug(stringPtr("long")),
+		pollsdata.OpenVotingTransition); err != nil {
+		t.Fatal(err)
+	}
+	short, getErr := h.GetMeeting(ctx, shortArgs)
+	if getErr != nil {
+		t.Fatal(getErr)
+	}
+	if short.OnlineClosedAt.IsZero() || !short.OnlineOpenedAt.IsZero() {
+		t.Errorf("expected the close transition of short to be recorded, got %v / %v",
+			short.OnlineOpenedAt, short.OnlineClosedAt)
+	}
+	if open := short.CountPollsInState(pollsdata.PollStateOpen); open != 0 {
+		t.Errorf("expected all polls of short to be closed, got %d open polls", open)
+	}
+	if due := transitionSlugs(start.Add(day)); len(due) != 0 {
+		t.Errorf("expected no transitions once applied, got %v", due)
+	}
+	if due := transitionSlugs(start.Add(3 * day)); !due["long"] || due["short"] {
+		t.Errorf("expected only long to be closed, got %v", due)
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func testVotes(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	period := insertPeriod(t, h, "Period One", "period-one", suiteTime, suiteTime.Add(day))
+	meeting := insertMeeting(t, h, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+	motion, budget := meeting.Groups[0].Polls[0].GetId(), meeting.Groups[0].Polls[1].GetId()
+	args := meetingById(meeting.Id)
+	aliceVote := pollsdata.NewPollVote(motion, newBasicVote("Alice Voter", "alice-voter", gopolls.Aye))
+	var invalidVote pollsdata.InvalidVoteError
+	if err := h.AddVotes(ctx, args, []*pollsdata.PollVote{aliceVote}); !errors.As(err, &invalidVote) {
+		t.Errorf("expected an InvalidVoteError for a vote in a draft poll, got %v", err)
+	}
+	if err := h.UpdatePollState(ctx, args, motion, pollsdata.PollStateOpen); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AddVotes(ctx, args, []*pollsdata.PollVote{aliceVote}); err != nil {
+		t.Fatalf("can't add vote: %v", err)
+	}
+	// all or nothing: bob's vote is valid, but alice has already voted
+	bobVote := pollsdata.NewPollVote(motion, newBasicVote("Bob Voter", "bob-voter", gopolls.No))
+	aliceAgain := pollsdata.NewPollVote(motion, newBasicVote("Alice Voter", "alice-voter", gopolls.No))
+	if err := h.AddVotes(ctx, args, []*pollsdata.PollVote{bobVote, aliceAgain}); !errors.As(err, &invalidVote) {
+		t.Errorf("expected an InvalidVoteError for a second vote, got %v", err)
+	}
+	// a basic vote can't be added to a median poll
+	wrongType := pollsdata.NewPollVote(budget, newBasicVote("Bob Voter", "bob-voter", gopolls.No))
+	if err := h.AddVotes(ctx, args, []*pollsdata.PollVote{bobVote, wrongType}); !errors.As(err, &invalidVote) {
+		t.Errorf("expected an InvalidVoteError for a vote of the wrong type, got %v", err)
+	}
+	expectSlugs(t, "voters after rejected votes", pollVoterNames(t, getMeeting(t, h, meeting.Id), motion), []string{"Alice Voter"})
+	if err := h.AddVotes(ctx, args, []*pollsdata.PollVote{bobVote}); err != nil {
+		t.Fatalf("can't add vote: %v", err)
+	}
+	stored := getMeeting(t, h, meeting.Id)
+	expectSlugs(t, "voters", pollVoterNames(t, stored, motion), []string{"Alice Voter", "Bob Voter"})
+	votes := stored.GetPoll(motion).(*pollsdata.BasicPollModel).Votes
+	for _, vote := range votes {
+		if (vote.VoterName == "Alice Voter" && vote.Answer != gopolls.Aye) || (vote.VoterName == "Bob Voter" && vote.Answer != gopolls.No) {
+			t.Errorf("unexpected vote %v", vote)
+		}
+	}
+	// no votes after the poll is closed
+	if err := h.UpdatePollState(ctx, args, motion, pollsdata.PollStateClosed); err != nil {
+		t.Fatal(err)
+	}
+	lateVote := pollsdata.NewPollVote(motion, newBasicVote("Carol Voter", "carol-voter", gopolls.Aye))
+	if err := h.AddVotes(ctx, args, []*pollsdata.PollVote{lateVote}); !errors.As(err, &invalidVote) {
+		t.Errorf("expected an InvalidVoteError for a vote in a closed poll, got %v", err)
+	}
+}
+
+func testPollStates(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	period := insertPeriod(t, h, "Period One", "period-one", suiteTime, suiteTime.Add(day))
+	meeting := insertMeeting(t, h, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+	motion := meeting.Groups[0].Polls[0].GetId()
+	args := meetingById(meeting.Id)
+	var transitionErr pollsdata.PollStateTransitionError
+	if err := h.UpdatePollState(ctx, args, motion, pollsdata.PollStateClosed); !errors.As(err, &transitionErr) {
+		t.Errorf("expected a PollStateTransitionError for draft -> closed, got %v", err)
+	}
+	if err := h.UpdatePollState(ctx, args, motion, pollsdata.PollStateOpen); err != nil {
+		t.Fatal(err)
+	}
+	num, err := h.UpdateMeetingPollStates(ctx, args, pollsdata.PollStateDraft, pollsdata.PollStateOpen)
+	if err != nil || num != 1 {
+		t.Errorf("expected one poll to be opened, got %d (%v)", num, err)
+	}
+	num, err = h.UpdateMeetingPollStates(ctx, args, pollsdata.PollStateOpen, pollsdata.PollStateClosed)
+	if err != nil || num != 2 {
+		t.Errorf("expected two polls to be closed, got %d (%v)", num, err)
+	}
+	stored := getMeeting(t, h, meeting.Id)
+	if got := stored.CountPollsInState(pollsdata.PollStateClosed); got != 2 {
+		t.Errorf("expected two closed polls, got %d", got)
+	}
+	if stored.GetPoll(motion).GetPollModel().Opened.IsZero() {
+		t.Error("the time of the transition was not stored")
+	}
+	if !stored.GetPoll(motion).GetPollModel().RollCall || stored.Groups[0].Polls[1].GetPollModel().RollCall {
+		t.Error("the roll call flag was not stored")
+	}
+	// replacing the groups must not change states
+	if err := h.UpdateMeetingGroups(ctx, args, stored.Groups); err != nil {
+		t.Errorf("expected unchanged groups to be accepted, got %v", err)
+	}
+	stored.GetPoll(motion).GetPollModel().State = pollsdata.PollStatePublished
+	var updateErr pollsdata.InvalidPollsUpdateError
+	if err := h.UpdateMeetingGroups(ctx, args, stored.Groups); !errors.As(err, &updateErr) {
+		t.Errorf("expected an InvalidPollsUpdateError when publishing with UpdateMeetingGroups, got %v", err)
+	}
+	if err := h.UpdateMeetingGroups(ctx, args, nil); !errors.As(err, &updateErr) {
+		t.Errorf("expected an InvalidPollsUpdateError when removing closed polls, got %v", err)
+	}
+	if got := getMeeting(t, h, meeting.Id).CountPollsInState(pollsdata.PollStateClosed); got != 2 {
+		t.Errorf("expected two closed polls after rejected updates, got %d", got)
+	}
+}
+
+func testConflicts(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	period := insertPeriod(t, h, "Period One", "period-one", suiteTime, suiteTime.Add(day))
+	meeting := insertMeeting(t, h, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+	read := getMeeting(t, h, meeting.Id)
+	voters := []*pollsdata.VoterModel{pollsdata.NewVoterModel("Carol Voter", "carol-voter", 1)}
+	voters[0].SetId(uuid.New())
+	tokenArgs := meetingById(read.Id).SetUpdateToken(&read.UpdateToken)
+	if err := h.UpdateMeetingVoters(ctx, tokenArgs, voters); err != nil {
+		t.Fatalf("update with the current update token failed: %v", err)
+	}
+	// the update token has changed, so the same update must fail
+	expectNotFound(t, h.UpdateMeetingVoters(ctx, tokenArgs, voters[:0]), "update with a stale update token")
+	expectNotFound(t, h.UpdateMeetingGroups(ctx, tokenArgs, read.Groups), "update groups with a stale update token")
+	lastUpdatedArgs := meetingById(read.Id).SetLastUpdated(&read.LastUpdated)
+	expectNotFound(t, h.UpdateMeetingVoters(ctx, lastUpdatedArgs, voters[:0]), "update with a stale last updated time")
+	updated := getMeeting(t, h, meeting.Id)
+	if updated.UpdateToken == read.UpdateToken {
+		t.Error("the update token was not changed by an update")
+	}
+	if len(updated.Voters) != 1 || updated.Voters[0].Name != "Carol Voter" {
+		t.Errorf("the voters were changed by a failed update: %v", updated.Voters)
+	}
+	currentArgs := meetingById(updated.Id).SetUpdateToken(&updated.UpdateToken).SetLastUpdated(&updated.LastUpdated)
+	if _, err := h.GetMeeting(ctx, currentArgs); err != nil {
+		t.Errorf("GetMeeting with the current update token and last updated time failed: %v", err)
+	}
+	if err := h.UpdatePollState(ctx, currentArgs, read.Groups[0].Polls[0].GetId(), pollsdata.PollStateOpen); err != nil {
+		t.Errorf("UpdatePollState with the current update token failed: %v", err)
+	}
+	expectNotFound(t, h.UpdatePollState(ctx, currentArgs, read.Groups[0].Polls[1].GetId(), pollsdata.PollStateOpen),
+		"UpdatePollState with a stale update token")
+}
+
+// testConcurrentVotes adds votes concurrently. A handler may reject a vote because of a concurrent change (with an
+// EntryNotFoundError), but it must not lose a vote it accepted.
+func testConcurrentVotes(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	period := insertPeriod(t, h, "Period One", "period-one", suiteTime, suiteTime.Add(day))
+	meeting := insertMeeting(t, h, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+	motion := meeting.Groups[0].Polls[0].GetId()
+	args := meetingById(meeting.Id)
+	if err := h.UpdatePollState(ctx, args, motion, pollsdata.PollStateOpen); err != nil {
+		t.Fatal(err)
+	}
+	const numVoters = 10
+	var wg sync.WaitGroup
+	errs := make([]error, numVoters)
+	for i := 0; i < numVoters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("Voter %02d", i)
+			vote := pollsdata.NewPollVote(motion, newBasicVote(name, fmt.Sprintf("voter-%02d", i), gopolls.Aye))
+			errs[i] = h.AddVotes(ctx, args, []*pollsdata.PollVote{vote})
+		}(i)
+	}
+	wg.Wait()
+	accepted := make([]string, 0, numVoters)
+	for i, err := range errs {
+		if err == nil {
+			accepted = append(accepted, fmt.Sprintf("Voter %02d", i))
+			continue
+		}
+		expectNotFound(t, err, "concurrent vote")
+	}
+	if len(accepted) == 0 {
+		t.Error("no vote was accepted")
+	}
+	expectSlugs(t, "accepted votes", pollVoterNames(t, getMeeting(t, h, meeting.Id), motion), accepted)
+	// the chain contains the definition of the motion and exactly the accepted votes
+	expectValidChain(t, h, getMeeting(t, h, meeting.Id), len(accepted)+1)
+}
+
+func testNotificationsSent(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	period := insertPeriod(t, h, "Period One", "period-one", suiteTime, suiteTime.Add(day))
+	meeting := insertMeeting(t, h, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+	if getMeeting(t, h, meeting.Id).NotificationSent("voting_opened") {
+		t.Error("expected no notification to be sent for a new meeting")
+	}
+	for _, notification := range []string{"voting_opened", "voting_reminder"} {
+		if err := h.SetMeetingNotificationSent(ctx, meeting.Id, notification, suiteTime); err != nil {
+			t.Fatalf("can't mark notification %s as sent: %v", notification, err)
+		}
+	}
+	stored := getMeeting(t, h, meeting.Id)
+	if sent := stored.NotificationsSent["voting_opened"]; !sent.Equal(suiteTime) || !stored.NotificationSent("voting_reminder") {
+		t.Errorf("expected both notifications to be stored, got %v", stored.NotificationsSent)
+	}
+	if stored.UpdateToken != meeting.UpdateToken {
+		t.Error("marking a notification as sent must not change the update token")
+	}
+	expectNotFound(t, h.SetMeetingNotificationSent(ctx, uuid.New(), "voting_opened", suiteTime),
+		"SetMeetingNotificationSent")
+}
+
+func testDeleteMeeting(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	period := insertPeriod(t, h, "Period One", "period-one", suiteTime, suiteTime.Add(day))
+	first := insertMeeting(t, h, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+	insertMeeting(t, h, "meeting-two", period.Id, suiteTime.Add(time.Hour), time.Time{}, time.Time{})
+	wrongToken := first.UpdateToken + 1
+	if num, err := h.DeleteMeeting(ctx, meetingById(first.Id).SetUpdateToken(&wrongToken)); err != nil || num != 0 {
+		t.Errorf("expected no meeting to be deleted with a stale update token, got %d (%v)", num, err)
+	}
+	if num, err := h.DeleteMeeting(ctx, pollsdata.NewMeetingQueryArgs().SetSlug(stringPtr("meeting-one"))); err != nil || num != 1 {
+		t.Errorf("expected one deleted meeting, got %d (%v)", num, err)
+	}
+	if num, err := h.DeleteMeeting(ctx, meetingById(first.Id)); err != nil || num != 0 {
+		t.Errorf("expected no meeting to be deleted twice, got %d (%v)", num, err)
+	}
+	_, getErr := h.GetMeeting(ctx, meetingById(first.Id))
+	expectNotFound(t, getErr, "GetMeeting after delete")
+	meetings, listErr := h.GetMeetingsForPeriod(ctx, period.Id)
+	if listErr != nil {
+		t.Fatal(listErr)
+	}
+	expectSlugs(t, "remaining meetings", meetingSlugs(meetings), []string{"meeting-two"})
+}
+
+func testDeletePeriod(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	used := insertPeriod(t, h, "Period Used", "used", suiteTime, suiteTime.Add(day))
+	insertMeeting(t, h, "meeting-one", used.Id, suiteTime, time.Time{}, time.Time{})
+	// inserting a meeting writes the period, this way it conflicts with a concurrent delete
+	if touched, err := h.GetPeriod(ctx, periodById(used.Id)); err != nil || !touched.LastUpdated.After(used.LastUpdated) {
+		t.Errorf("expected the period to be updated by InsertMeeting, got %v (%v)", touched, err)
+	}
+	insertMeeting(t, h, "meeting-two", used.Id, suiteTime, time.Time{}, time.Time{})
+	var inUse pollsdata.PeriodInUseError
+	if _, err := h.DeletePeriod(ctx, periodById(used.Id), pollsdata.PeriodDeleteRestrict); !errors.As(err, &inUse) || inUse.NumMeetings != 2 {
+		t.Errorf("expected a PeriodInUseError with two meetings, got %v", err)
+	}
+	if num, err := h.DeletePeriod(ctx, periodById(used.Id), pollsdata.PeriodDeleteArchive); err != nil || num != 1 {
+		t.Errorf("expected one archived period, got %d (%v)", num, err)
+	}
+	archived, getErr := h.GetPeriod(ctx, periodById(used.Id))
+	if getErr != nil {
+		t.Fatal(getErr)
+	}
+	if !archived.IsArchived() {
+		t.Error("the period was not archived")
+	}
+	if meetings, err := h.GetMeetingsForPeriod(ctx, used.Id); err != nil || len(meetings) != 2 {
+		t.Errorf("expected the meetings of an archived period to be kept, got %v (%v)", meetings, err)
+	}
+	if num, err := h.DeletePeriod(ctx, periodById(used.Id), pollsdata.PeriodDeleteCascade); err != nil || num != 1 {
+		t.Errorf("expected one deleted period, got %d (%v)", num, err)
+	}
+	if meetings, err := h.GetMeetingsForPeriod(ctx, used.Id); err != nil || len(meetings) != 0 {
+		t.Errorf("expected the meetings to be deleted with the period, got %v (%v)", meetings, err)
+	}
+	_, meetingErr := h.GetMeeting(ctx, pollsdata.NewMeetingQueryArgs().SetSlug(stringPtr("meeting-one")))
+	expectNotFound(t, meetingErr, "GetMeeting after cascade")
+
+	unused := insertPeriod(t, h, "Period Unused", "unused", suiteTime, suiteTime.Add(day))
+	if num, err := h.DeletePeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetSlug(stringPtr("unused")), pollsdata.PeriodDeleteRestrict); err != nil || num != 1 {
+		t.Errorf("expected one deleted period, got %d (%v)", num, err)
+	}
+	for _, mode := range []pollsdata.PeriodDeleteMode{pollsdata.PeriodDeleteRestrict, pollsdata.PeriodDeleteCascade, pollsdata.PeriodDeleteArchive} {
+		if num, err := h.DeletePeriod(ctx, periodById(unused.Id), mode); err != nil || num != 0 {
+			t.Errorf("expected no period to be deleted twice (mode %s), got %d (%v)", mode, num, err)
+		}
+	}
+	_, periodErr := h.GetPeriod(ctx, periodById(unused.Id))
+	expectNotFound(t, periodErr, "GetPeriod after delete")
+}
+
+func testWebhooks(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	clock := pollsweb.NewFakeClock(suiteTime)
+	insertWebhook := func(url string, active bool, events ...string) *pollsdata.WebhookModel {
+		webhook := pollsdata.NewWebhookModel(clock, url, "secret", events)
+		webhook.Active = active
+		if _, err := h.InsertWebhook(ctx, webhook); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(time.Minute)
+		return webhook
+	}
+	meetings := insertWebhook("https://example.com/meetings", true, "meeting.created", "meeting.deleted")
+	insertWebhook("https://example.com/periods", true, "period.created")
+	insertWebhook("https://example.com/inactive", false, "meeting.created")
+	got, getErr := h.GetWebhook(ctx, meetings.Id)
+	if getErr != nil {
+		t.Fatal(getErr)
+	}
+	if got.URL != meetings.URL || len(got.Events) != 2 || !got.Active || !got.Created.Equal(meetings.Created) {
+		t.Errorf("expected %v, got %v", meetings, got)
+	}
+	webhookURLs := func(event string) []string {
+		webhooks, err := h.GetWebhooks(ctx, event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := make([]string, len(webhooks))
+		for i, webhook := range webhooks {
+			res[i] = webhook.URL
+		}
+		return res
+	}
+	expectSlugs(t, "all webhooks", webhookURLs(""),
+		[]string{"https://example.com/meetings", "https://example.com/periods", "https://example.com/inactive"})
+	expectSlugs(t, "webhooks for meeting.created", webhookURLs("meeting.created"), []string{"https://example.com/meetings"})
+	expectSlugs(t, "webhooks for unknown event", webhookURLs("unknown"), []string{})
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		delivery := pollsdata.NewWebhookDeliveryModel(clock, meetings.Id, uuid.New(), "meeting.created", attempt)
+		if _, err := h.InsertWebhookDelivery(ctx, delivery); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(time.Second)
+	}
+	deliveryAttempts := func(limit int64) []string {
+		deliveries, err := h.GetWebhookDeliveries(ctx, meetings.Id, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := make([]string, len(deliveries))
+		for i, delivery := range deliveries {
+			res[i] = fmt.Sprint(delivery.Attempt)
+		}
+		return res
+	}
+	expectSlugs(t, "deliveries", deliveryAttempts(0), []string{"3", "2", "1"})
+	expectSlugs(t, "deliveries with limit", deliveryAttempts(2), []string{"3", "2"})
+
+	pending := pollsdata.NewWebhookDeliveryModel(clock, meetings.Id, uuid.New(), "meeting.created", 4)
+	pending.Payload = []byte(`{"event":"meeting.created"}`)
+	pending.RetryAt = clock.Now().Add(time.Minute)
+	if _, err := h.InsertWebhookDelivery(ctx, pending); err != nil {
+		t.Fatal(err)
+	}
+	dueAttempts := func() []string {
+		deliveries, err := h.GetDueWebhookDeliveries(ctx, clock.Now(), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := make([]string, len(deliveries))
+		for i, delivery := range deliveries {
+			res[i] = fmt.Sprint(delivery.Attempt)
+			if string(delivery.Payload) != string(pending.Payload) {
+				t.Errorf("expected payload %s, got %s", pending.Payload, delivery.Payload)
+			}
+		}
+		return res
+	}
+	expectSlugs(t, "due deliveries before retry", dueAttempts(), []string{})
+	clock.Advance(time.Minute)
+	expectSlugs(t, "due deliveries", dueAttempts(), []string{"4"})
+	if claimed, err := h.ClaimWebhookDeliveryRetry(ctx, pending.Id); err != nil || !claimed {
+		t.Errorf("expected retry to be claimed, got %v (%v)", claimed, err)
+	}
+	if claimed, err := h.ClaimWebhookDeliveryRetry(ctx, pending.Id); err != nil || claimed {
+		t.Errorf("expected retry to be claimed only once, got %v (%v)", claimed, err)
+	}
+	expectSlugs(t, "due deliveries after claim", dueAttempts(), []string{})
+
+	if num, err := h.DeleteWebhook(ctx, meetings.Id); err != nil || num != 1 {
+		t.Errorf("expected one deleted webhook, got %d (%v)", num, err)
+	}
+	if num, err := h.DeleteWebhook(ctx, meetings.Id); err != nil || num != 0 {
+		t.Errorf("expected no webhook to be deleted twice, got %d (%v)", num, err)
+	}
+	_, deletedErr := h.GetWebhook(ctx, meetings.Id)
+	expectNotFound(t, deletedErr, "GetWebhook after delete")
+	expectSlugs(t, "deliveries after delete", deliveryAttempts(0), []string{})
+}
+
+func testAuditLog(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	clock := pollsweb.NewFakeClock(suiteTime)
+	period := insertPeriod(t, h, "Period One", "period-one", suiteTime, suiteTime.Add(day))
+	meeting := insertMeeting(t, h, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+	pollId := uuid.New()
+	newEntry := func(actor, action string) *pollsdata.AuditEntryModel {
+		return pollsdata.NewAuditEntryModel(clock, actor, "127.0.0.1", action).SetPeriodId(period.Id)
+	}
+	insertEntry := func(entry *pollsdata.AuditEntryModel) *pollsdata.AuditEntryModel {
+		id, err := h.InsertAuditEntry(ctx, entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id == uuid.Nil || id != entry.Id {
+			t.Fatalf("expected the id of the entry to be set, got %s (entry %s)", id, entry.Id)
+		}
+		return entry
+	}
+	insertEntry(newEntry("admin", pollsdata.AuditPeriodCreated).SetDetail("slug", "period-one"))
+	clock.Advance(time.Minute)
+	insertEntry(newEntry("admin", pollsdata.AuditMeetingPollsUpdated))
+	clock.Advance(time.Minute)
+	// two entries at the same time, they're sorted by id
+	for i := 0; i < 2; i++ {
+		insertEntry(pollsdata.NewAuditEntryModel(clock, "scheduler", "", pollsdata.AuditPollStateChanged).
+			SetMeetingId(meeting.Id).SetPollId(pollId).SetDetail("to", "open"))
+	}
+	clock.Advance(day)
+	insertEntry(newEntry("voter", pollsdata.AuditVoteCast).SetMeetingId(meeting.Id))
+
+	list := func(query *pollsdata.AuditQuery) []*pollsdata.AuditEntryModel {
+		var res []*pollsdata.AuditEntryModel
+		if err := pollsdata.AllAuditEntries(ctx, h, query, func(entry *pollsdata.AuditEntryModel) error {
+			res = append(res, entry)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	actions := func(entries []*pollsdata.AuditEntryModel) []string {
+		res := make([]string, len(entries))
+		for i, entry := range entries {
+			res[i] = entry.Action
+		}
+		return res
+	}
+	all := list(pollsdata.NewAuditQuery().SetLimit(1))
+	expectSlugs(t, "audit entries", actions(all), []string{pollsdata.AuditVoteCast, pollsdata.AuditPollStateChanged,
+		pollsdata.AuditPollStateChanged, pollsdata.AuditMeetingPollsUpdated, pollsdata.AuditPeriodCreated})
+	for i := 1; i < len(all); i++ {
+		if all[i-1].Time.Equal(all[i].Time) && all[i-1].Id.String() < all[i].Id.String() {
+			t.Errorf("expected entries at the same time to be sorted by id descending, got %s before %s",
+				all[i-1].Id, all[i].Id)
+		}
+	}
+	if oldest := all[len(all)-1]; oldest.Actor != "admin" || oldest.RemoteAddr != "127.0.0.1" ||
+		oldest.PeriodId != period.Id || oldest.MeetingId != uuid.Nil || oldest.Details["slug"] != "period-one" ||
+		!oldest.Time.Equal(suiteTime) {
+		t.Errorf("the entry was not stored correctly, got %v", oldest)
+	}
+
+	expectSlugs(t, "entries by action", actions(list(pollsdata.NewAuditQuery().SetAction(pollsdata.AuditPollStateChanged))),
+		[]string{pollsdata.AuditPollStateChanged, pollsdata.AuditPollStateChanged})
+	expectSlugs(t, "entries by actor", actions(list(pollsdata.NewAuditQuery().SetActor("admin"))),
+		[]string{pollsdata.AuditMeetingPollsUpdated, pollsdata.AuditPeriodCreated})
+	expectSlugs(t, "entries by meeting", actions(list(pollsdata.NewAuditQuery().SetMeetingId(&meeting.Id))),
+		[]string{pollsdata.AuditVoteCast, pollsdata.AuditPollStateChanged, pollsdata.AuditPollStateChanged})
+	expectSlugs(t, "entries by poll", actions(list(pollsdata.NewAuditQuery().SetPollId(&pollId))),
+		[]string{pollsdata.AuditPollStateChanged, pollsdata.AuditPollStateChanged})
+	expectSlugs(t, "entries by period", actions(list(pollsdata.NewAuditQuery().SetPeriodId(&period.Id))),
+		[]string{pollsdata.AuditVoteCast, pollsdata.AuditMeetingPollsUpdated, pollsdata.AuditPeriodCreated})
+	expectSlugs(t, "entries by time", actions(list(pollsdata.NewAuditQuery().SetFrom(suiteTime.Add(time.Minute)).SetTo(suiteTime.Add(day)))),
+		[]string{pollsdata.AuditPollStateChanged, pollsdata.AuditPollStateChanged, pollsdata.AuditMeetingPollsUpdated})
+
+	first, firstErr := h.ListAuditEntries(ctx, pollsdata.NewAuditQuery().SetLimit(4))
+	if firstErr != nil {
+		t.Fatal(firstErr)
+	}
+	if len(first.Entries) != 4 || !first.HasNext() {
+		t.Fatalf("expected a page with four entries and a next page, got %d entries (next %v)", len(first.Entries), first.HasNext())
+	}
+	second, secondErr := h.ListAuditEntries(ctx, pollsdata.NewAuditQuery().SetLimit(4).SetCursor(first.NextCursor))
+	if secondErr != nil {
+		t.Fatal(secondErr)
+	}
+	if len(second.Entries) != 1 || second.HasNext() || second.Entries[0].Action != pollsdata.AuditPeriodCreated {
+		t.Errorf("expected the last page to contain only the oldest entry, got %v (next %v)", second.Entries, second.HasNext())
+	}
+	_, cursorErr := h.ListAuditEntries(ctx, pollsdata.NewAuditQuery().SetCursor("not a cursor"))
+	expectInvalidQuery(t, cursorErr, "ListAuditEntries with invalid cursor")
+
+	if num, err := h.DeleteMeeting(ctx, meetingById(meeting.Id)); err != nil || num != 1 {
+		t.Fatalf("expected one deleted meeting, got %d (%v)", num, err)
+	}
+	if num, err := h.DeletePeriod(ctx, periodById(period.Id), pollsdata.PeriodDeleteCascade); err != nil || num != 1 {
+		t.Fatalf("expected one deleted period, got %d (%v)", num, err)
+	}
+	if entries := list(pollsdata.NewAuditQuery()); len(entries) != len(all) {
+		t.Errorf("expected the audit log to be kept after deleting the models, got %d entries", len(entries))
+	}
+}
+
+// expectValidChain verifies the chain of the meeting and checks the number of entries.
+func expectValidChain(t *testing.T, h pollsdata.DataHandler, meeting *pollsdata.MeetingModel, numEntries int) {
+	t.Helper()
+	report, err := pollsdata.VerifyMeetingChain(context.Background(), h, meeting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() {
+		t.Errorf("expected a valid chain, got problems %v", report.Problems)
+	}
+	if report.NumEntries != numEntries {
+		t.Errorf("expected %d chain entries, got %d", numEntries, report.NumEntries)
+	}
+}
+
+func testHashChain(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	clock := pollsweb.NewFakeClock(suiteTime)
+	period := insertPeriod(t, h, "Period One", "period-one", suiteTime, suiteTime.Add(day))
+	meeting := insertMeeting(t, h, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+	other := insertMeeting(t, h, "meeting-two", period.Id, suiteTime, time.Time{}, time.Time{})
+	motion, budget := meeting.Groups[0].Polls[0].GetId(), meeting.Groups[0].Polls[1].GetId()
+	args := meetingById(meeting.Id)
+	expectValidChain(t, h, meeting, 0)
+	for _, pollId := range []uuid.UUID{motion, budget} {
+		if err := h.UpdatePollState(ctx, args, pollId, pollsdata.PollStateOpen); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insertEntry := func(meetingId uuid.UUID, action string) {
+		entry := pollsdata.NewAuditEntryModel(clock, "admin", "127.0.0.1", action).
+			SetPeriodId(period.Id).
+			SetMeetingId(meetingId)
+		if _, err := h.InsertAuditEntry(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(time.Second)
+	}
+	insertEntry(meeting.Id, pollsdata.AuditPollStateChanged)
+	insertEntry(uuid.Nil, pollsdata.AuditPeriodCreated)
+	insertEntry(other.Id, pollsdata.AuditMeetingPollsUpdated)
+	votes := []*pollsdata.PollVote{
+		pollsdata.NewPollVote(motion, newBasicVote("Alice Voter", "alice-voter", gopolls.Aye)),
+		pollsdata.NewPollVote(budget, pollsdata.NewMedianPollVoteModel("Alice Voter", "alice-voter", 500)),
+	}
+	votes[1].Vote.SetId(uuid.New())
+	if err := h.AddVotes(ctx, args, votes); err != nil {
+		t.Fatal(err)
+	}
+	// rejected votes are not linked
+	again := pollsdata.NewPollVote(motion, newBasicVote("Alice Voter", "alice-voter", gopolls.No))
+	if err := h.AddVotes(ctx, args, []*pollsdata.PollVote{again}); err == nil {
+		t.Error("expected a second vote to be rejected")
+	}
+	if err := h.AddVotes(ctx, args, []*pollsdata.PollVote{pollsdata.NewPollVote(motion, newBasicVote("Bob Voter", "bob-voter", gopolls.No))}); err != nil {
+		t.Fatal(err)
+	}
+	insertEntry(meeting.Id, pollsdata.AuditVoteCast)
+
+	chain, chainErr := h.GetChain(ctx, meeting.Id)
+	if chainErr != nil {
+		t.Fatal(chainErr)
+	}
+	kinds := make([]string, len(chain))
+	for i, entry := range chain {
+		kinds[i] = entry.Kind
+		if entry.Sequence != int64(i+1) {
+			t.Errorf("expected sequence number %d, got %d", i+1, entry.Sequence)
+		}
+		if i == 0 && entry.PreviousHash != pollsdata.ChainGenesisHash {
+			t.Errorf("expected the first entry to follow the genesis hash, got %s", entry.PreviousHash)
+		}
+		if i > 0 && entry.PreviousHash != chain[i-1].Hash {
+			t.Errorf("entry %d is not linked to the previous entry", entry.Sequence)
+		}
+	}
+	expectSlugs(t, "chain", kinds, []string{pollsdata.ChainPollRecord, pollsdata.ChainPollRecord,
+		pollsdata.ChainAuditRecord, pollsdata.ChainVoteRecord, pollsdata.ChainVoteRecord, pollsdata.ChainVoteRecord,
+		pollsdata.ChainAuditRecord})
+	if chain[0].RecordId != motion || chain[1].RecordId != budget {
+		t.Errorf("expected the first entries to reference the opened polls, got %v and %v", chain[0], chain[1])
+	}
+	if chain[3].RecordId != votes[0].Vote.GetId() || chain[3].PollId != motion {
+		t.Errorf("expected the entry to reference the vote, got %v", chain[3])
+	}
+	stored := getMeeting(t, h, meeting.Id)
+	expectValidChain(t, h, stored, 7)
+	if head, err := pollsdata.MeetingChainHead(ctx, h, meeting.Id); err != nil || head != chain[6].Hash {
+		t.Errorf("expected the head of the chain to be %s, got %s (%v)", chain[6].Hash, head, err)
+	}
+	// closing a poll doesn't link it again
+	if err := h.UpdatePollState(ctx, args, motion, pollsdata.PollStateClosed); err != nil {
+		t.Fatal(err)
+	}
+	expectValidChain(t, h, getMeeting(t, h, meeting.Id), 7)
+	expectValidChain(t, h, getMeeting(t, h, other.Id), 1)
+
+	// the chain is kept after the meeting is deleted
+	if num, err := h.DeleteMeeting(ctx, args); err != nil || num != 1 {
+		t.Fatalf("expected one deleted meeting, got %d (%v)", num, err)
+	}
+	if kept, err := h.GetChain(ctx, meeting.Id); err != nil || len(kept) != 7 {
+		t.Errorf("expected the chain to be kept after deleting the meeting, got %d entries (%v)", len(kept), err)
+	}
+	// chains of deleted meetings are still verified and exported
+	reports, verifyErr := pollsdata.VerifyAllChains(ctx, h)
+	if verifyErr != nil {
+		t.Fatal(verifyErr)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("expected two chains, got %d", len(reports))
+	}
+	for _, report := range reports {
+		if !report.Valid() {
+			t.Errorf("expected the chain of meeting %s to be valid, got problems %v", report.MeetingId, report.Problems)
+		}
+		switch report.MeetingId {
+		case meeting.Id:
+			if !report.MeetingDeleted || report.NumEntries != 7 || report.NumAuditEntries != 2 || report.Head != chain[6].Hash {
+				t.Errorf("unexpected report for the deleted meeting: %+v", report)
+			}
+		case other.Id:
+			if report.MeetingDeleted || report.NumEntries != 1 {
+				t.Errorf("unexpected report for the existing meeting: %+v", report)
+			}
+		default:
+			t.Errorf("unexpected chain of meeting %s", report.MeetingId)
+		}
+	}
+	archive, exportErr := pollsdata.ExportArchive(ctx, h, suiteTime)
+	if exportErr != nil {
+		t.Fatal(exportErr)
+	}
+	if len(archive.Chains) != 8 {
+		t.Errorf("expected the export to contain all 8 chain entries, got %d", len(archive.Chains))
+	}
+	if err := archive.Verify(); err != nil {
+		t.Errorf("expected the exported archive to be valid, got %v", err)
+	}
+}
+
+func testWriteImport(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	existing := insertPeriod(t, h, "Period Existing", "existing", suiteTime, suiteTime.Add(day))
+	insertMeeting(t, h, "existing-meeting", existing.Id, suiteTime, time.Time{}, time.Time{})
+
+	period := newPeriod("Period Imported", "imported", suiteTime, suiteTime.Add(day))
+	period.Id = uuid.New()
+	meeting := newMeeting(t, "imported-meeting", period.Id, suiteTime, time.Time{}, time.Time{})
+	// the meeting conflicts with the existing meeting, nothing must be written
+	conflict := newMeeting(t, "existing-meeting", period.Id, suiteTime, time.Time{}, time.Time{})
+	conflict.Name = "Meeting Conflict"
+	data := &pollsdata.ArchiveImportData{
+		Periods:  []*pollsdata.PeriodSettingsModel{period},
+		Meetings: []*pollsdata.MeetingModel{meeting, conflict},
+	}
+	_, conflictErr := h.WriteImport(ctx, data)
+	expectDuplicate(t, conflictErr, "slug")
+	_, periodErr := h.GetPeriod(ctx, periodById(period.Id))
+	expectNotFound(t, periodErr, "GetPeriod after a failed import")
+	_, meetingErr := h.GetMeeting(ctx, meetingById(meeting.Id))
+	expectNotFound(t, meetingErr, "GetMeeting after a failed import")
+
+	// a failed replace doesn't delete anything
+	data.Replace = true
+	data.Meetings = []*pollsdata.MeetingModel{meeting, newMeeting(t, "unknown-period", uuid.New(), suiteTime, time.Time{}, time.Time{})}
+	_, unknownErr := h.WriteImport(ctx, data)
+	expectNotFound(t, unknownErr, "WriteImport with an unknown period")
+	if meetings, err := h.GetMeetingsForPeriod(ctx, existing.Id); err != nil || len(meetings) != 1 {
+		t.Errorf("expected the existing meeting to be kept after a failed replace, got %v (%v)", meetings, err)
+	}
+
+	// the audit entry and its chain are imported with their ids
+	entry := pollsdata.NewAuditEntryModel(pollsweb.NewFakeClock(suiteTime), "admin", "", pollsdata.AuditMeetingCreated)
+	entry.Id, entry.MeetingId = uuid.New(), meeting.Id
+	record, recordErr := pollsdata.NewAuditChainRecord(entry)
+	if recordErr != nil {
+		t.Fatal(recordErr)
+	}
+	chain := pollsdata.NewChainEntries(nil, meeting.Id, suiteTime, []*pollsdata.ChainRecord{record})
+	chain[0].Id = uuid.New()
+	data.Meetings = []*pollsdata.MeetingModel{meeting}
+	data.AuditEntries, data.ChainEntries = []*pollsdata.AuditEntryModel{entry}, chain
+	written, replaceErr := h.WriteImport(ctx, data)
+	if replaceErr != nil {
+		t.Fatal(replaceErr)
+	}
+	expected := &pollsdata.ArchiveWriteResult{PeriodsDeleted: 1, MeetingsDeleted: 1, AuditEntriesWritten: 1, ChainEntriesWritten: 1}
+	if *written != *expected {
+		t.Errorf("expected %+v, got %+v", expected, written)
+	}
+	imported, getErr := h.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetSlug(stringPtr("imported")))
+	if getErr != nil {
+		t.Fatal(getErr)
+	}
+	if imported.Id != period.Id {
+		t.Errorf("expected the period to be imported with id %s, got %s", period.Id, imported.Id)
+	}
+	if stored := getMeeting(t, h, meeting.Id); stored.PeriodId != period.Id {
+		t.Error("imported meeting doesn't reference the imported period")
+	}
+	_, existingErr := h.GetPeriod(ctx, periodById(existing.Id))
+	expectNotFound(t, existingErr, "GetPeriod after replace")
+	expectValidChain(t, h, getMeeting(t, h, meeting.Id), 1)
+
+	// without replace the ids must not exist
+	data.Replace = false
+	_, duplicateErr := h.WriteImport(ctx, data)
+	expectDuplicate(t, duplicateErr, "id")
+
+	// audit and chain entries that exist are skipped, a chain must not fork
+	data.Periods, data.Meetings = nil, nil
+	written, mergeErr := h.WriteImport(ctx, data)
+	if mergeErr != nil || written.AuditEntriesWritten != 0 || written.ChainEntriesWritten != 0 {
+		t.Errorf("expected existing audit and chain entries to be skipped, got %+v (%v)", written, mergeErr)
+	}
+	fork := pollsdata.NewChainEntries(nil, meeting.Id, suiteTime, []*pollsdata.ChainRecord{record})
+	fork[0].Id = uuid.New()
+	data.ChainEntries = fork
+	_, forkErr := h.WriteImport(ctx, data)
+	expectDuplicate(t, forkErr, "sequence")
+}
+
+func testWriteImportReplaceChains(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	clock := pollsweb.NewFakeClock(suiteTime)
+	period := insertPeriod(t, h, "Period One", "period-one", suiteTime, suiteTime.Add(day))
+	meeting := insertMeeting(t, h, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+	if err := h.UpdatePollState(ctx, meetingById(meeting.Id), meeting.Groups[0].Polls[0].GetId(), pollsdata.PollStateOpen); err != nil {
+		t.Fatal(err)
+	}
+	for _, meetingId := range []uuid.UUID{meeting.Id, uuid.Nil} {
+		entry := pollsdata.NewAuditEntryModel(clock, "admin", "", pollsdata.AuditPollStateChanged).SetMeetingId(meetingId)
+		if _, err := h.InsertAuditEntry(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectValidChain(t, h, getMeeting(t, h, meeting.Id), 2)
+
+	// the archive contains the meeting with another chain that starts at the same sequence numbers
+	imported := newMeeting(t, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+	imported.Id = meeting.Id
+	entry := pollsdata.NewAuditEntryModel(clock, "admin", "", pollsdata.AuditMeetingCreated).SetMeetingId(meeting.Id)
+	entry.Id = uuid.New()
+	record, recordErr := pollsdata.NewAuditChainRecord(entry)
+	if recordErr != nil {
+		t.Fatal(recordErr)
+	}
+	chain := pollsdata.NewChainEntries(nil, meeting.Id, suiteTime, []*pollsdata.ChainRecord{record})
+	chain[0].Id = uuid.New()
+	data := &pollsdata.ArchiveImportData{
+		Replace:      true,
+		Periods:      []*pollsdata.PeriodSettingsModel{period},
+		Meetings:     []*pollsdata.MeetingModel{imported},
+		AuditEntries: []*pollsdata.AuditEntryModel{entry},
+		ChainEntries: chain,
+	}
+	written, err := h.WriteImport(ctx, data)
+	if err != nil {
+		t.Fatalf("expected the chains to be replaced, got %v", err)
+	}
+	if written.AuditEntriesDeleted != 2 || written.ChainEntriesDeleted != 2 || written.ChainEntriesWritten != 1 {
+		t.Errorf("expected the old audit log and chain to be deleted, got %+v", written)
+	}
+	expectValidChain(t, h, getMeeting(t, h, meeting.Id), 1)
+	if stored, getErr := h.GetChain(ctx, meeting.Id); getErr != nil || len(stored) != 1 || stored[0].Id != chain[0].Id {
+		t.Errorf("expected only the imported chain entry, got %v (%v)", stored, getErr)
+	}
+	page, listErr := h.ListAuditEntries(ctx, pollsdata.NewAuditQuery())
+	if listErr != nil {
+		t.Fatal(listErr)
+	}
+	if len(page.Entries) != 1 || page.Entries[0].Id != entry.Id {
+		t.Errorf("expected only the imported audit entry, got %v", page.Entries)
+	}
+}
+
+func testLinkUnchainedRecords(t *testing.T, h pollsdata.DataHandler) {
+	ctx := context.Background()
+	period := insertPeriod(t, h, "Period One", "period-one", suiteTime, suiteTime.Add(day))
+	// an open poll with a vote and an audit entry stored without a chain, as before chains were introduced
+	meeting := newMeeting(t, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+	motion := meeting.Groups[0].Polls[0].(*pollsdata.BasicPollModel)
+	motion.State = pollsdata.PollStateOpen
+	motion.Votes = []*pollsdata.BasicPollVoteModel{newBasicVote("Alice Voter", "alice-voter", gopolls.Aye)}
+	if err := h.InsertMeeting(ctx, meeting); err != nil {
+		t.Fatal(err)
+	}
+	entry := pollsdata.NewAuditEntryModel(pollsweb.NewFakeClock(suiteTime), "admin", "", pollsdata.AuditVoteCast).
+		SetMeetingId(meeting.Id)
+	entry.Id = uuid.New()
+	if _, err := h.WriteImport(ctx, &pollsdata.ArchiveImportData{AuditEntries: []*pollsdata.AuditEntryModel{entry}}); err != nil {
+		t.Fatal(err)
+	}
+	report, verifyErr := pollsdata.VerifyMeetingChain(ctx, h, getMeeting(t, h, meeting.Id))
+	if verifyErr != nil {
+		t.Fatal(verifyErr)
+	}
+	if len(report.Problems) != 3 {
+		t.Errorf("expected the poll, the vote and the audit entry to be reported, got %v", report.Problems)
+	}
+	if num, err := h.LinkUnchainedRecords(ctx, meeting.Id); err != nil || num != 3 {
+		t.Errorf("expected three linked records, got %d (%v)", num, err)
+	}
+	expectValidChain(t, h, getMeeting(t, h, meeting.Id), 3)
+	// linking again doesn't change the chain
+	if num, err := h.LinkUnchainedRecords(ctx, meeting.Id); err != nil || num != 0 {
+		t.Errorf("expected no linked records, got %d (%v)", num, err)
+	}
+	expectValidChain(t, h, getMeeting(t, h, meeting.Id), 3)
+	_, notFoundErr := h.LinkUnchainedRecords(ctx, uuid.New())
+	expectNotFound(t, notFoundErr, "LinkUnchainedRecords of an unknown meeting")
+}
+
+// testClock checks that the clock set with SetClock is used by all parts of the handler: the time of chain entries
+// and the default time of audit entries, webhooks and deliveries.
+func testClock(t *testing.T, h pollsdata.DataHandler) {
+	clockSetter, ok := h.(pollsdata.ClockSetter)
+	if !ok {
+		t.Skip("handler doesn't implement ClockSetter")
+	}
+	ctx := context.Background()
+	now := suiteTime.Add(42 * day)
+	clockSetter.SetClock(pollsweb.NewFakeClock(now))
+	period := insertPeriod(t, h, "Period One", "period-one", suiteTime, suiteTime.Add(day))
+	meeting := insertMeeting(t, h, "meeting-one", period.Id, suiteTime, time.Time{}, time.Time{})
+	expectTime := func(what string, got time.Time) {
+		if !got.Equal(now) {
+			t.Errorf("expected %s at %s, got %s", what, now, got)
+		}
+	}
+
+	entry := pollsdata.EmptyAuditEntryModel()
+	entry.Actor = "admin"
+	entry.Action = pollsdata.AuditMeetingPollsUpdated
+	entry.PeriodId = period.Id
+	entry.MeetingId = meeting.Id
+	if _, err := h.InsertAuditEntry(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	expectTime("audit entry", entry.Time)
+	chain, chainErr := h.GetChain(ctx, meeting.Id)
+	if chainErr != nil {
+		t.Fatal(chainErr)
+	}
+	if len(chain) == 0 {
+		t.Fatal("expected the audit entry in the chain of the meeting")
+	}
+	expectTime("chain entry", chain[len(chain)-1].Time)
+
+	webhook := pollsdata.EmptyWebhookModel()
+	webhook.URL = "https://example.com/hook"
+	webhook.Events = []string{"meeting.created"}
+	webhook.Active = true
+	if _, err := h.InsertWebhook(ctx, webhook); err != nil {
+		t.Fatal(err)
+	}
+	expectTime("webhook", webhook.Created)
+	delivery := pollsdata.EmptyWebhookDeliveryModel()
+	delivery.WebhookId = webhook.Id
+	if _, err := h.InsertWebhookDelivery(ctx, delivery); err != nil {
+		t.Fatal(err)
+	}
+	deliveries, deliveriesErr := h.GetWebhookDeliveries(ctx, webhook.Id, 0)
+	if deliveriesErr != nil {
+		t.Fatal(deliveriesErr)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("expected one delivery, got %v", deliveries)
+	}
+	expectTime("delivery", deliveries[0].Time)
+}
@@ -72,6 +72,33 @@ func (e InvalidQueryArgsError) Unwrap() error {
 	return nil
 }
 
+// DuplicateEntryError is an error returned if an entry can't be written because another entry already uses the same
+// value for a unique field (for example the name or slug of a period).
+//
+// It embeds PollWebError and is thus an internal error.
+type DuplicateEntryError struct {
+	pollsweb.PollWebError
+	Model reflect.Type
+	Field string
+	Value string
+}
+
+func NewDuplicateEntryError(model reflect.Type, field, value string) DuplicateEntryError {
+	return DuplicateEntryError{
+		Model: model,
+		Field: field,
+		Value: value,
+	}
+}
+
+func (e DuplicateEntryError) Error() string {
+	return fmt.Sprintf("entry of type \"%v\" with %s \"%s\" already exists", e.Model, e.Field, e.Value)
+}
+
+func (e DuplicateEntryError) Unwrap() error {
+	return nil
+}
+
 func formatSimpleQueryArgs(argsType reflect.Type, arguments []string) string {
 	var buf strings.Builder
 	buf.WriteString(argsType.String())
@@ -194,21 +221,79 @@ func (args *MeetingQueryArgs) String() string {
 var ErrInvalidPeriodSettingsQuery = NewInvalidQueryArgsError("invalid query for PeriodSettingsModel: Id, Name or Slug must be given")
 var ErrInvalidMeetingQuery = NewInvalidQueryArgsError("invalid query for MeetingModel: Id, Name or Slug must be given")
 
+// The insert and update methods of the handlers validate the models (see ValidatorModel) and return a
+// ModelValidationError if a model is not valid, nothing is written in this case.
+
 type PeriodSettingsHandler interface {
+	// InsertPeriod generates a new id for the period and inserts it.
 	InsertPeriod(ctx context.Context, meetingTime *PeriodSettingsModel) (uuid.UUID, error)
 
 	GetPeriod(ctx context.Context, args *PeriodSettingsQueryArgs) (*PeriodSettingsModel, error)
 	GetActivePeriods(ctx context.Context, referenceTime time.Time) ([]*PeriodSettingsModel, error)
 	GetLatestPeriods(ctx context.Context, limit int64, referenceTime time.Time) ([]*PeriodSettingsModel, error)
-
-	DeletePeriod(ctx context.Context, args *PeriodSettingsQueryArgs) (int64, error)
+	// ListPeriods returns a page of periods that match the query, see PeriodListQuery.
+	// It returns an InvalidQueryArgsError if the cursor of the query is not valid.
+	ListPeriods(ctx context.Context, query *PeriodListQuery) (*PeriodListPage, error)
+
+	// UpdatePeriodVoters replaces the voters of a period, it returns an EntryNotFoundError if the period does not
+	// exist. The voters are validated with ValidateVoters.
+	UpdatePeriodVoters(ctx context.Context, args *PeriodSettingsQueryArgs, voters []*VoterModel) error
+	// RenamePeriod changes the name and slug of a period, it returns an EntryNotFoundError if the period does not
+	// exist. Meetings reference periods by id, so they still belong to the period.
+	RenamePeriod(ctx context.Context, args *PeriodSettingsQueryArgs, name, slug string) error
+
+	// DeletePeriod deletes a period, mode describes what happens with the meetings of the period (see
+	// PeriodDeleteMode). It returns the number of deleted (or archived) periods, 0 if the period does not exist.
+	// The period and its meetings are changed atomically if the storage supports it.
+	DeletePeriod(ctx context.Context, args *PeriodSettingsQueryArgs, mode PeriodDeleteMode) (int64, error)
 }
 
 type MeetingsHandler interface {
+	// InsertMeeting inserts the meeting, the ids must already be set (see MeetingModel.GenIds).
+	// It returns an EntryNotFoundError if the period of the meeting does not exist.
 	InsertMeeting(ctx context.Context, meeting *MeetingModel) error
 
 	GetMeeting(ctx context.Context, args *MeetingQueryArgs) (*MeetingModel, error)
-
+	// GetMeetingsForPeriod returns all meetings of the period with the given id, sorted by meeting time.
+	GetMeetingsForPeriod(ctx context.Context, periodId uuid.UUID) ([]*MeetingModel, error)
+	// GetOnlineVotingMeetings returns all meetings with OnlineStart <= referenceTime <= OnlineEnd.
+	GetOnlineVotingMeetings(ctx context.Context, referenceTime time.Time) ([]*MeetingModel, error)
+	// GetVotingTransitionMeetings returns all meetings with a scheduled transition that has not been applied yet at
+	// referenceTime: meetings with OnlineStart <= referenceTime < OnlineEnd that have not been opened and meetings
+	// with OnlineEnd <= referenceTime that have not been closed. Meetings without an online voting window are
+	// ignored. The result may contain additional meetings, use DueVotingTransition to check a meeting.
+	GetVotingTransitionMeetings(ctx context.Context, referenceTime time.Time) ([]*MeetingModel, error)
+	// ListMeetings returns a page of meeting summaries that match the query, see MeetingListQuery.
+	// It returns an InvalidQueryArgsError if the cursor of the query is not valid.
+	ListMeetings(ctx context.Context, query *MeetingListQuery) (*MeetingListPage, error)
+
+	// UpdateMeetingVoters replaces the voters of a meeting, LastUpdated is set to the current time and UpdateToken is
+	// incremented. It returns an EntryNotFoundError if the meeting does not exist (or LastUpdated / UpdateToken in
+	// args don't match). The voters are validated with ValidateVoters.
+	UpdateMeetingVoters(ctx context.Context, args *MeetingQueryArgs, voters []*VoterModel) error
+	// UpdateMeetingGroups replaces the poll groups of a meeting, it works like UpdateMeetingVoters.
+	// The groups are validated with ValidatePollGroups. States and votes can't be changed this way, it returns an
+	// InvalidPollsUpdateError if the update is not allowed, see CheckPollGroupsUpdate.
+	UpdateMeetingGroups(ctx context.Context, args *MeetingQueryArgs, groups []*PollGroupModel) error
+	// UpdatePollState changes the state of a poll in the meeting, see PollModel.Transition. It returns a
+	// PollStateTransitionError if the poll can't change to that state.
+	UpdatePollState(ctx context.Context, args *MeetingQueryArgs, pollId uuid.UUID, state string) error
+	// AddVotes adds votes to the polls of the meeting, see MeetingModel.AddVotes. Either all votes are added or none,
+	// an InvalidVoteError is returned if a vote is not accepted (for example because the poll is not open).
+	AddVotes(ctx context.Context, args *MeetingQueryArgs, votes []*PollVote) error
+	// UpdateMeetingPollStates changes the state of all polls in the meeting that are in the state from to the state
+	// to, it returns the number of changed polls.
+	UpdateMeetingPollStates(ctx context.Context, args *MeetingQueryArgs, from, to string) (int, error)
+	// ApplyVotingTransition applies a scheduled transition of the online voting window to the meeting and records
+	// that it has been applied, see MeetingModel.ApplyVotingTransition. It returns the number of changed polls.
+	ApplyVotingTransition(ctx context.Context, args *MeetingQueryArgs, transition *VotingTransition) (int, error)
+	// SetMeetingNotificationSent records that the notification has been sent for the meeting with the given id at
+	// the time sent (see MeetingModel.NotificationsSent). LastUpdated and UpdateToken are not changed, the meeting
+	// itself has not been changed. It returns an EntryNotFoundError if the meeting does not exist.
+	SetMeetingNotificationSent(ctx context.Context, meetingId uuid.UUID, notification string, sent time.Time) error
+
+	// DeleteMeeting deletes the meeting and returns the number of deleted meetings. The chain of the meeting and the
+	// audit entries that reference it are kept, see ChainHandler.
 	DeleteMeeting(ctx context.Context, args *MeetingQueryArgs) (int64, error)
 }
 
@@ -218,5 +303,9 @@ type MeetingsHandler interface {
 type DataHandler interface {
 	PeriodSettingsHandler
 	MeetingsHandler
+	WebhooksHandler
+	AuditHandler
+	ChainHandler
+	ArchiveImportHandler
 	Close(ctx context.Context) error
 }
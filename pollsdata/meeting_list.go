@@ -0,0 +1,376 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/google/uuid"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultMeetingListLimit is the number of meetings on a page if MeetingListQuery.Limit is not set.
+const DefaultMeetingListLimit = 25
+
+// MeetingListSort describes by which field meetings are sorted in a MeetingListQuery.
+// Meetings with the same value are sorted by their id.
+type MeetingListSort int8
+
+const (
+	MeetingSortMeetingTime MeetingListSort = iota
+	MeetingSortName
+	MeetingSortCreated
+)
+
+func (s MeetingListSort) String() string {
+	switch s {
+	case MeetingSortMeetingTime:
+		return "meetingtime"
+	case MeetingSortName:
+		return "name"
+	case MeetingSortCreated:
+		return "created"
+	default:
+		return fmt.Sprintf("MeetingListSort(%d)", s)
+	}
+}
+
+// ParseMeetingListSort parses the sort field from its string representation ("meetingtime", "name" or "created").
+func ParseMeetingListSort(s string) (MeetingListSort, error) {
+	switch s {
+	case "meetingtime":
+		return MeetingSortMeetingTime, nil
+	case "name":
+		return MeetingSortName, nil
+	case "created":
+		return MeetingSortCreated, nil
+	default:
+		return MeetingSortMeetingTime, fmt.Errorf("invalid meeting sort field \"%s\"", s)
+	}
+}
+
+// MeetingListQuery describes which meetings are returned by MeetingsHandler.ListMeetings.
+//
+// All filters are optional, the zero value of a filter matches all meetings:
+// PeriodId only matches the meetings of that period, From and To restrict the MeetingTime to From <= MeetingTime < To,
+// OpenForVoting only matches meetings for which online voting is open at that time (see
+// MeetingModel.IsOnlineVotingOpen) and NamePrefix matches meetings with a name that starts with the prefix
+// (case insensitive).
+//
+// The result is sorted by SortBy, Limit is the maximum number of meetings returned (DefaultMeetingListLimit if
+// Limit <= 0). Cursor is the NextCursor of the previous page and is empty for the first page, a cursor is only valid
+// for the same SortBy and Descending values.
+type MeetingListQuery struct {
+	PeriodId      *uuid.UUID
+	From          time.Time
+	To            time.Time
+	OpenForVoting time.Time
+	NamePrefix    string
+	SortBy        MeetingListSort
+	Descending    bool
+	Limit         int64
+	Cursor        string
+}
+
+// NewMeetingListQuery returns a query that matches all meetings sorted by meeting time.
+func NewMeetingListQuery() *MeetingListQuery {
+	return &MeetingListQuery{
+		PeriodId:      nil,
+		From:          time.Time{},
+		To:            time.Time{},
+		OpenForVoting: time.Time{},
+		NamePrefix:    "",
+		SortBy:        MeetingSortMeetingTime,
+		Descending:    false,
+		Limit:         DefaultMeetingListLimit,
+		Cursor:        "",
+	}
+}
+
+// NewUpcomingMeetingsQuery returns a query for all meetings that take place at or after the reference time, the
+// next meeting comes first.
+func NewUpcomingMeetingsQuery(referenceTime time.Time) *MeetingListQuery {
+	return NewMeetingListQuery().SetFrom(referenceTime)
+}
+
+// NewPastMeetingsQuery returns a query for all meetings that took place before the reference time, the most recent
+// meeting comes first.
+func NewPastMeetingsQuery(referenceTime time.Time) *MeetingListQuery {
+	return NewMeetingListQuery().SetTo(referenceTime).SetSort(MeetingSortMeetingTime, true)
+}
+
+func (query *MeetingListQuery) SetPeriodId(periodId *uuid.UUID) *MeetingListQuery {
+	query.PeriodId = periodId
+	return query
+}
+
+func (query *MeetingListQuery) SetFrom(from time.Time) *MeetingListQuery {
+	query.From = from
+	return query
+}
+
+func (query *MeetingListQuery) SetTo(to time.Time) *MeetingListQuery {
+	query.To = to
+	return query
+}
+
+func (query *MeetingListQuery) SetOpenForVoting(referenceTime time.Time) *MeetingListQuery {
+	query.OpenForVoting = referenceTime
+	return query
+}
+
+func (query *MeetingListQuery) SetNamePrefix(prefix string) *MeetingListQuery {
+	query.NamePrefix = prefix
+	return query
+}
+
+func (query *MeetingListQuery) SetSort(sortBy MeetingListSort, descending bool) *MeetingListQuery {
+	query.SortBy = sortBy
+	query.Descending = descending
+	return query
+}
+
+func (query *MeetingListQuery) SetLimit(limit int64) *MeetingListQuery {
+	query.Limit = limit
+	return query
+}
+
+func (query *MeetingListQuery) SetCursor(cursor string) *MeetingListQuery {
+	query.Cursor = cursor
+	return query
+}
+
+// GetLimit returns the maximum number of meetings on a page.
+func (query *MeetingListQuery) GetLimit() int64 {
+	if query.Limit <= 0 {
+		return DefaultMeetingListLimit
+	}
+	return query.Limit
+}
+
+// Matches returns true if the meeting matches all filters of the query, the cursor is ignored.
+func (query *MeetingListQuery) Matches(meeting *MeetingSummary) bool {
+	if query.PeriodId != nil && meeting.PeriodId != *query.PeriodId {
+		return false
+	}
+	if !query.From.IsZero() && meeting.MeetingTime.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && !meeting.MeetingTime.Before(query.To) {
+		return false
+	}
+	if !query.OpenForVoting.IsZero() && !meeting.IsOnlineVotingOpen(query.OpenForVoting) {
+		return false
+	}
+	if query.NamePrefix != "" && !strings.HasPrefix(strings.ToLower(meeting.Name), strings.ToLower(query.NamePrefix)) {
+		return false
+	}
+	return true
+}
+
+// MeetingListCursor is the decoded version of MeetingListPage.NextCursor, it contains the sort key of the last meeting
+// on a page. Depending on SortBy either Time or Name is set.
+type MeetingListCursor struct {
+	SortBy     MeetingListSort `json:"sort"`
+	Descending bool            `json:"desc"`
+	Time       time.Time       `json:"time,omitempty"`
+	Name       string          `json:"name,omitempty"`
+	Id         uuid.UUID       `json:"id"`
+}
+
+// NewMeetingListCursor returns the cursor for a page that ends with the given meeting.
+func NewMeetingListCursor(query *MeetingListQuery, last *MeetingSummary) *MeetingListCursor {
+	res := &MeetingListCursor{
+		SortBy:     query.SortBy,
+		Descending: query.Descending,
+		Id:         last.Id,
+	}
+	switch query.SortBy {
+	case MeetingSortName:
+		res.Name = last.Name
+	case MeetingSortCreated:
+		res.Time = last.Created
+	default:
+		res.Time = last.MeetingTime
+	}
+	return res
+}
+
+// DecodeMeetingListCursor decodes the cursor of the query, it returns nil if the query has no cursor.
+// It returns an InvalidQueryArgsError if the cursor is invalid or was created for a different sort order.
+func DecodeMeetingListCursor(query *MeetingListQuery) (*MeetingListCursor, error) {
+	if query.Cursor == "" {
+		return nil, nil
+	}
+	var res MeetingListCursor
+	if err := DecodeCursor(query.Cursor, &res); err != nil {
+		return nil, err
+	}
+	if res.SortBy != query.SortBy || res.Descending != query.Descending {
+		return nil, NewInvalidQueryArgsError("cursor was created for a different sort order")
+	}
+	return &res, nil
+}
+
+// key returns a summary with the sort key of the cursor.
+func (cursor *MeetingListCursor) key() *MeetingSummary {
+	return &MeetingSummary{
+		Id:          cursor.Id,
+		Name:        cursor.Name,
+		Created:     cursor.Time,
+		MeetingTime: cursor.Time,
+	}
+}
+
+// After returns true if the meeting comes after the cursor in the sort order of the cursor.
+func (cursor *MeetingListCursor) After(meeting *MeetingSummary) bool {
+	cmp := compareMeetingSummaries(cursor.SortBy, meeting, cursor.key())
+	if cursor.Descending {
+		return cmp < 0
+	}
+	return cmp > 0
+}
+
+// compareMeetingSummaries compares two meetings by the sort field (and by id if the field is equal), the result is
+// negative if a comes before b in ascending order, 0 if they're equal and positive otherwise.
+func compareMeetingSummaries(sortBy MeetingListSort, a, b *MeetingSummary) int {
+	var res int
+	switch sortBy {
+	case MeetingSortName:
+		res = strings.Compare(a.Name, b.Name)
+	case MeetingSortCreated:
+		res = compareTimes(a.Created, b.Created)
+	default:
+		res = compareTimes(a.MeetingTime, b.MeetingTime)
+	}
+	if res == 0 {
+		res = bytes.Compare(a.Id[:], b.Id[:])
+	}
+	return res
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// MeetingSummary is a lightweight version of a MeetingModel without voters and polls, it is returned by
+// MeetingsHandler.ListMeetings.
+type MeetingSummary struct {
+	Id          uuid.UUID
+	Name        string
+	Slug        string
+	PeriodId    uuid.UUID
+	Created     time.Time
+	MeetingTime time.Time
+	OnlineStart time.Time
+	OnlineEnd   time.Time
+	NumVoters   int
+	NumPolls    int
+}
+
+// NewMeetingSummary returns the summary of a meeting.
+func NewMeetingSummary(meeting *MeetingModel) *MeetingSummary {
+	numPolls := 0
+	for _, group := range meeting.Groups {
+		numPolls += len(group.Polls)
+	}
+	return &MeetingSummary{
+		Id:          meeting.Id,
+		Name:        meeting.Name,
+		Slug:        meeting.Slug,
+		PeriodId:    meeting.PeriodId,
+		Created:     meeting.Created,
+		MeetingTime: meeting.MeetingTime,
+		OnlineStart: meeting.OnlineStart,
+		OnlineEnd:   meeting.OnlineEnd,
+		NumVoters:   len(meeting.Voters),
+		NumPolls:    numPolls,
+	}
+}
+
+// IsOnlineVotingOpen works as MeetingModel.IsOnlineVotingOpen.
+func (summary *MeetingSummary) IsOnlineVotingOpen(referenceTime time.Time) bool {
+	hasOnlineVoting := !summary.OnlineStart.IsZero() && !summary.OnlineEnd.IsZero()
+	return hasOnlineVoting && !referenceTime.Before(summary.OnlineStart) && referenceTime.Before(summary.OnlineEnd)
+}
+
+// MeetingListPage is a page of meetings returned by MeetingsHandler.ListMeetings.
+// NextCursor is the cursor to get the next page, it is empty if this is the last page.
+type MeetingListPage struct {
+	Meetings   []*MeetingSummary
+	NextCursor string
+}
+
+// HasNext returns true if there is another page.
+func (page *MeetingListPage) HasNext() bool {
+	return page.NextCursor != ""
+}
+
+// NewMeetingListPage returns a page given the meetings matching the query (and cursor) in sort order.
+// meetings may contain more elements than the limit of the query, in this case the result is truncated and
+// NextCursor is set.
+func NewMeetingListPage(query *MeetingListQuery, meetings []*MeetingSummary) (*MeetingListPage, error) {
+	limit := query.GetLimit()
+	res := &MeetingListPage{
+		Meetings:   meetings,
+		NextCursor: "",
+	}
+	if int64(len(meetings)) > limit {
+		res.Meetings = meetings[:limit]
+		cursor, cursorErr := EncodeCursor(NewMeetingListCursor(query, res.Meetings[limit-1]))
+		if cursorErr != nil {
+			return nil, cursorErr
+		}
+		res.NextCursor = cursor
+	}
+	return res, nil
+}
+
+// ListMeetingSummaries applies the query to a list of meetings, it implements MeetingsHandler.ListMeetings for
+// meetings in memory. The meetings are not modified.
+func ListMeetingSummaries(meetings []*MeetingModel, query *MeetingListQuery) (*MeetingListPage, error) {
+	cursor, cursorErr := DecodeMeetingListCursor(query)
+	if cursorErr != nil {
+		return nil, cursorErr
+	}
+	summaries := make([]*MeetingSummary, 0, len(meetings))
+	for _, meeting := range meetings {
+		summary := NewMeetingSummary(meeting)
+		if !query.Matches(summary) {
+			continue
+		}
+		if cursor != nil && !cursor.After(summary) {
+			continue
+		}
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		cmp := compareMeetingSummaries(query.SortBy, summaries[i], summaries[j])
+		if query.Descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	return NewMeetingListPage(query, summaries)
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/google/uuid"
 	"math/rand"
 	"reflect"
+	"sort"
 	"time"
 )
 
@@ -87,7 +88,8 @@ type AbstractIdModel interface {
 }
 
 type IdModel struct {
-	Id uuid.UUID `bson:"_id" valid:"uuidv4"`
+	// govalidator can't check uuid.UUID values, the version is checked in ValidateModel
+	Id uuid.UUID `bson:"_id" valid:"-"`
 }
 
 func EmptyIdModel() *IdModel {
@@ -147,6 +149,8 @@ type PeriodSettingsModel struct {
 	End                 time.Time
 	Created             time.Time
 	LastUpdated         time.Time
+	// Archived is the time the period was archived, zero if the period is not archived (see PeriodDeleteArchive)
+	Archived time.Time
 }
 
 func EmptyPeriodSettingsModel() *PeriodSettingsModel {
@@ -160,12 +164,14 @@ func EmptyPeriodSettingsModel() *PeriodSettingsModel {
 		End:                 time.Time{},
 		Created:             time.Time{},
 		LastUpdated:         time.Time{},
+		Archived:            time.Time{},
 	}
 }
 
 // TODO where are ids for voters generated?
-func NewPeriodSettingsModel(name, slug string, meetingDateTemplate *MeetingTimeTemplateModel, voters []*VoterModel, start, end time.Time) *PeriodSettingsModel {
-	now := pollsweb.UTCNow()
+// Created and LastUpdated are set to the current time of the clock.
+func NewPeriodSettingsModel(clock pollsweb.Clock, name, slug string, meetingDateTemplate *MeetingTimeTemplateModel, voters []*VoterModel, start, end time.Time) *PeriodSettingsModel {
+	now := clock.Now()
 	return &PeriodSettingsModel{
 		IdModel:             EmptyIdModel(),
 		Name:                name,
@@ -176,12 +182,42 @@ func NewPeriodSettingsModel(name, slug string, meetingDateTemplate *MeetingTimeT
 		End:                 end,
 		Created:             now,
 		LastUpdated:         now,
+		Archived:            time.Time{},
 	}
 }
 
 func (m *PeriodSettingsModel) String() string {
-	return fmt.Sprintf("PeriodSettingsModel(Id=%s, Name=%s, Slug=%s, MettingDateTemplate=%s, Voters=%v, Start=%s, End=%s, Created=%s, LastUpdated=%s)",
-		m.Id, m.Name, m.Slug, m.MeetingDateTemplate, m.Voters, m.Start, m.End, m.Created, m.LastUpdated)
+	return fmt.Sprintf("PeriodSettingsModel(Id=%s, Name=%s, Slug=%s, MettingDateTemplate=%s, Voters=%v, Start=%s, End=%s, Created=%s, LastUpdated=%s, Archived=%s)",
+		m.Id, m.Name, m.Slug, m.MeetingDateTemplate, m.Voters, m.Start, m.End, m.Created, m.LastUpdated, m.Archived)
+}
+
+// IsActive returns true if the reference time is between Start and End (both inclusive).
+func (m *PeriodSettingsModel) IsActive(referenceTime time.Time) bool {
+	return !referenceTime.Before(m.Start) && !referenceTime.After(m.End)
+}
+
+// LatestPeriods returns the periods sorted by End and then Start (both descending), this is the order used by
+// PeriodSettingsHandler.GetLatestPeriods.
+//
+// Archived periods are ignored. If referenceTime is not zero only periods active at that time are returned, if
+// limit > 0 at most limit periods are returned. The periods slice is not modified.
+func LatestPeriods(periods []*PeriodSettingsModel, limit int64, referenceTime time.Time) []*PeriodSettingsModel {
+	res := make([]*PeriodSettingsModel, 0, len(periods))
+	for _, period := range periods {
+		if !period.IsArchived() && (referenceTime.IsZero() || period.IsActive(referenceTime)) {
+			res = append(res, period)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if !res[i].End.Equal(res[j].End) {
+			return res[i].End.After(res[j].End)
+		}
+		return res[i].Start.After(res[j].Start)
+	})
+	if limit > 0 && int64(len(res)) > limit {
+		res = res[:limit]
+	}
+	return res
 }
 
 type VoterModel struct {
@@ -189,6 +225,8 @@ type VoterModel struct {
 	Name     string `valid:"runelength(5|250)"`
 	Slug     string
 	Weight   gopolls.Weight
+	// Email is optional and used for notifications
+	Email string `bson:",omitempty" valid:"email,optional"`
 }
 
 func EmptyVoterModel() *VoterModel {
@@ -197,6 +235,7 @@ func EmptyVoterModel() *VoterModel {
 		Name:    "",
 		Slug:    "",
 		Weight:  gopolls.NoWeight,
+		Email:   "",
 	}
 }
 
@@ -206,12 +245,18 @@ func NewVoterModel(name, slug string, weight gopolls.Weight) *VoterModel {
 		Name:    name,
 		Slug:    slug,
 		Weight:  weight,
+		Email:   "",
 	}
 }
 
+func (m *VoterModel) SetEmail(email string) *VoterModel {
+	m.Email = email
+	return m
+}
+
 func (m *VoterModel) String() string {
-	return fmt.Sprintf("VoterModel(Id=%s, Name=%s, Slug=%s, Weight=%d)",
-		m.Id, m.Name, m.Slug, m.Weight)
+	return fmt.Sprintf("VoterModel(Id=%s, Name=%s, Slug=%s, Weight=%d, Email=%s)",
+		m.Id, m.Name, m.Slug, m.Weight, m.Email)
 }
 
 type MajorityModel struct {
@@ -240,6 +285,7 @@ func (m *MajorityModel) String() string {
 
 type AbstractVoteModel interface {
 	AbstractIdModel
+	ValidatorModel
 	ModelVoteForType() string
 }
 
@@ -357,9 +403,12 @@ func (vote *SchulzePollVoteModel) String() string {
 
 type AbstractPollModel interface {
 	AbstractIdModel
+	ValidatorModel
 	ModelPollForType() string
 	// GenId for model itself and also for all votes
 	GenIds() error
+	// GetPollModel returns the fields common to all polls
+	GetPollModel() *PollModel
 }
 
 type PollModel struct {
@@ -367,8 +416,17 @@ type PollModel struct {
 	Name             string `valid:"runelength(5|250)"`
 	Slug             string `valid:"-"`
 	Majority         *MajorityModel
-	AbsoluteMajority bool   `valid:"-"`
-	Type             string `valid:"in(basic|median|schulze)"`
+	AbsoluteMajority bool `valid:"-"`
+	// RollCall is true if the votes of the voters are on record, only then the votes of the voters can be included
+	// in the results. All other polls are secret, only the aggregated results are shown.
+	RollCall bool   `valid:"-"`
+	Type     string `valid:"in(basic|median|schulze)"`
+	// State is one of the PollState constants, see Transition
+	State string `valid:"in(draft|open|closed|published)"`
+	// the times of the transitions, zero if the poll has not (yet) been in that state
+	Opened    time.Time
+	Closed    time.Time
+	Published time.Time
 }
 
 func EmptyPollModel() *PollModel {
@@ -378,7 +436,12 @@ func EmptyPollModel() *PollModel {
 		Slug:             "",
 		Majority:         EmptyMajorityModel(),
 		AbsoluteMajority: false,
+		RollCall:         false,
 		Type:             "",
+		State:            PollStateDraft,
+		Opened:           time.Time{},
+		Closed:           time.Time{},
+		Published:        time.Time{},
 	}
 }
 
@@ -389,13 +452,22 @@ func NewPollModel(name, slug string, majority *MajorityModel, absoluteMajority b
 		Slug:             slug,
 		Majority:         majority,
 		AbsoluteMajority: absoluteMajority,
+		RollCall:         false,
 		Type:             _type,
+		State:            PollStateDraft,
+		Opened:           time.Time{},
+		Closed:           time.Time{},
+		Published:        time.Time{},
 	}
 }
 
+func (poll *PollModel) GetPollModel() *PollModel {
+	return poll
+}
+
 func (poll *PollModel) String() string {
-	return fmt.Sprintf("PollModel(Id=%s, Name=%s, Slug=%s, Majority=%s, AbsoluteMajority=%v, Type=%s)",
-		poll.Id, poll.Name, poll.Slug, poll.Majority, poll.AbsoluteMajority, poll.Type)
+	return fmt.Sprintf("PollModel(Id=%s, Name=%s, Slug=%s, Majority=%s, AbsoluteMajority=%v, RollCall=%v, Type=%s, State=%s)",
+		poll.Id, poll.Name, poll.Slug, poll.Majority, poll.AbsoluteMajority, poll.RollCall, poll.Type, poll.GetState())
 }
 
 type BasicPollModel struct {
@@ -597,12 +669,60 @@ func (group *PollGroupModel) GenIds() error {
 	return nil
 }
 
+// PollVoterNames returns the names of all voters that have a vote in the poll.
+func PollVoterNames(poll AbstractPollModel) pollsweb.StringSet {
+	var res pollsweb.StringSet
+	switch typedPoll := poll.(type) {
+	case *BasicPollModel:
+		res = pollsweb.NewStringSet(len(typedPoll.Votes))
+		for _, vote := range typedPoll.Votes {
+			res.Add(vote.VoterName)
+		}
+	case *MedianPollModel:
+		res = pollsweb.NewStringSet(len(typedPoll.Votes))
+		for _, vote := range typedPoll.Votes {
+			res.Add(vote.VoterName)
+		}
+	case *SchulzePollModel:
+		res = pollsweb.NewStringSet(len(typedPoll.Votes))
+		for _, vote := range typedPoll.Votes {
+			res.Add(vote.VoterName)
+		}
+	default:
+		res = pollsweb.NewStringSet(-1)
+	}
+	return res
+}
+
+// PollVotes returns all votes of the poll.
+func PollVotes(poll AbstractPollModel) []AbstractVoteModel {
+	var res []AbstractVoteModel
+	switch typedPoll := poll.(type) {
+	case *BasicPollModel:
+		res = make([]AbstractVoteModel, len(typedPoll.Votes))
+		for i, vote := range typedPoll.Votes {
+			res[i] = vote
+		}
+	case *MedianPollModel:
+		res = make([]AbstractVoteModel, len(typedPoll.Votes))
+		for i, vote := range typedPoll.Votes {
+			res[i] = vote
+		}
+	case *SchulzePollModel:
+		res = make([]AbstractVoteModel, len(typedPoll.Votes))
+		for i, vote := range typedPoll.Votes {
+			res[i] = vote
+		}
+	}
+	return res
+}
+
 type MeetingModel struct {
 	*IdModel    `bson:",inline"`
 	Name        string
 	Slug        string
 	Created     time.Time
-	Period      string
+	PeriodId    uuid.UUID // the id of the period the meeting belongs to
 	MeetingTime time.Time
 	OnlineStart time.Time
 	OnlineEnd   time.Time
@@ -610,16 +730,24 @@ type MeetingModel struct {
 	Groups      []*PollGroupModel
 	LastUpdated time.Time
 	UpdateToken int64
+	// NotificationsSent maps the name of each notification that has been sent for the meeting to the time it was
+	// sent, see MeetingsHandler.SetMeetingNotificationSent.
+	// The field is omitted if empty, a null value could not be extended in place by mongo.
+	NotificationsSent map[string]time.Time `bson:",omitempty"`
+	// OnlineOpenedAt and OnlineClosedAt are the times the scheduled transitions of the online voting window have
+	// been applied, they're zero if the transition has not been applied yet. Each transition is applied only once,
+	// see DueVotingTransition.
+	OnlineOpenedAt time.Time
+	OnlineClosedAt time.Time
 }
 
 func EmptyMeetingModel() *MeetingModel {
-	now := pollsweb.UTCNow()
 	return &MeetingModel{
 		IdModel:     EmptyIdModel(),
 		Name:        "",
 		Slug:        "",
-		Created:     now,
-		Period:      "",
+		Created:     time.Time{},
+		PeriodId:    uuid.Nil,
 		MeetingTime: time.Time{},
 		OnlineStart: time.Time{},
 		OnlineEnd:   time.Time{},
@@ -627,17 +755,22 @@ func EmptyMeetingModel() *MeetingModel {
 		Groups:      nil,
 		LastUpdated: time.Time{},
 		UpdateToken: rand.Int63(),
+
+		NotificationsSent: nil,
+		OnlineOpenedAt:    time.Time{},
+		OnlineClosedAt:    time.Time{},
 	}
 }
 
-func NewMeetingModel(name, slug string, period string, meetingTime, onlineStart, onlineEnd time.Time, voters []*VoterModel, groups []*PollGroupModel) *MeetingModel {
-	now := pollsweb.UTCNow()
+// NewMeetingModel returns a new meeting, Created and LastUpdated are set to the current time of the clock.
+func NewMeetingModel(clock pollsweb.Clock, name, slug string, periodId uuid.UUID, meetingTime, onlineStart, onlineEnd time.Time, voters []*VoterModel, groups []*PollGroupModel) *MeetingModel {
+	now := clock.Now()
 	return &MeetingModel{
 		IdModel:     EmptyIdModel(),
 		Name:        name,
 		Slug:        slug,
 		Created:     now,
-		Period:      period,
+		PeriodId:    periodId,
 		MeetingTime: meetingTime,
 		OnlineStart: onlineStart,
 		OnlineEnd:   onlineEnd,
@@ -645,12 +778,22 @@ func NewMeetingModel(name, slug string, period string, meetingTime, onlineStart,
 		Groups:      groups,
 		LastUpdated: now,
 		UpdateToken: rand.Int63(),
+
+		NotificationsSent: nil,
+		OnlineOpenedAt:    time.Time{},
+		OnlineClosedAt:    time.Time{},
 	}
 }
 
+// NotificationSent returns true if the notification has already been sent for the meeting.
+func (meeting *MeetingModel) NotificationSent(notification string) bool {
+	_, sent := meeting.NotificationsSent[notification]
+	return sent
+}
+
 func (meeting *MeetingModel) String() string {
-	return fmt.Sprintf("MeetingModel(Id=%s, Name=%s, Slug=%s, Created=%s, Period=%s, MeetingTime=%s, OnlineStart=%s, OnlineEnd=%s, Voters=%v, Groups=%v, LastUpdated=%s, UpdateToken=%d)",
-		meeting.Id, meeting.Name, meeting.Slug, meeting.Created, meeting.Period, meeting.MeetingTime,
+	return fmt.Sprintf("MeetingModel(Id=%s, Name=%s, Slug=%s, Created=%s, PeriodId=%s, MeetingTime=%s, OnlineStart=%s, OnlineEnd=%s, Voters=%v, Groups=%v, LastUpdated=%s, UpdateToken=%d)",
+		meeting.Id, meeting.Name, meeting.Slug, meeting.Created, meeting.PeriodId, meeting.MeetingTime,
 		meeting.OnlineStart, meeting.OnlineEnd, meeting.Voters, meeting.Groups, meeting.LastUpdated,
 		meeting.UpdateToken)
 }
@@ -684,3 +827,27 @@ func (meeting *MeetingModel) GenIds() error {
 	}
 	return nil
 }
+
+// VotersWithMissingVotes returns all voters of the meeting that have not voted in at least one open poll, polls in
+// other states are ignored because they don't accept votes.
+func (meeting *MeetingModel) VotersWithMissingVotes() []*VoterModel {
+	pollVoters := make([]pollsweb.StringSet, 0)
+	for _, group := range meeting.Groups {
+		for _, poll := range group.Polls {
+			if !poll.GetPollModel().IsOpen() {
+				continue
+			}
+			pollVoters = append(pollVoters, PollVoterNames(poll))
+		}
+	}
+	res := make([]*VoterModel, 0, len(meeting.Voters))
+	for _, voter := range meeting.Voters {
+		for _, voterNames := range pollVoters {
+			if !voterNames.Contains(voter.Name) {
+				res = append(res, voter)
+				break
+			}
+		}
+	}
+	return res
+}
@@ -17,22 +17,64 @@ package pollsdata
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/FabianWe/pollsweb"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"reflect"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 )
 
+// mongoDuplicateKeyCode is the code of the error returned by mongodb if a unique index is violated.
+const mongoDuplicateKeyCode = 11000
+
+var mongoDuplicateKeyIndexRegex = regexp.MustCompile(`index: (\S+) dup key`)
+
+// mongoDuplicateKeyError converts a duplicate key error of mongodb to a DuplicateEntryError, other errors (and nil)
+// are returned unchanged.
+// The field is derived from the name of the violated index, values maps the fields to the values of the entry.
+func mongoDuplicateKeyError(err error, model reflect.Type, values map[string]string) error {
+	var writeErr mongo.WriteException
+	if !errors.As(err, &writeErr) {
+		return err
+	}
+	for _, e := range writeErr.WriteErrors {
+		if e.Code != mongoDuplicateKeyCode {
+			continue
+		}
+		field := "id"
+		if match := mongoDuplicateKeyIndexRegex.FindStringSubmatch(e.Message); match != nil && match[1] != "_id_" {
+			field = strings.TrimSuffix(match[1], "_1")
+		}
+		return NewDuplicateEntryError(model, field, values[field])
+	}
+	return err
+}
+
+func mongoUniqueValues(id uuid.UUID, name, slug string) map[string]string {
+	return map[string]string{
+		"id":   id.String(),
+		"name": name,
+		"slug": slug,
+	}
+}
+
 type MongoPeriodSettingsHandler struct {
 	Collection *mongo.Collection
+	// Clock is used to set the last updated time of periods
+	Clock pollsweb.Clock
 }
 
 func NewMongoPeriodSettingsHandler(collection *mongo.Collection) *MongoPeriodSettingsHandler {
 	return &MongoPeriodSettingsHandler{
 		Collection: collection,
+		Clock:      pollsweb.NewSystemClock(),
 	}
 }
 
@@ -46,6 +88,7 @@ func (h *MongoPeriodSettingsHandler) endStartIndex() mongo.IndexModel {
 		Keys: bson.D{
 			{"end", -1},
 			{"start", -1},
+			{"_id", -1},
 		},
 		Options: options.Index(),
 	}
@@ -84,8 +127,17 @@ func (h *MongoPeriodSettingsHandler) InsertPeriod(ctx context.Context, periodSet
 		return objectId, uuidErr
 	}
 	periodSettings.Id = objectId
+	if validateErr := periodSettings.ValidateModel(); validateErr != nil {
+		return uuid.Nil, validateErr
+	}
+	return objectId, h.insertPeriod(ctx, periodSettings)
+}
+
+// insertPeriod inserts the (already validated) period with its id.
+func (h *MongoPeriodSettingsHandler) insertPeriod(ctx context.Context, periodSettings *PeriodSettingsModel) error {
 	_, insertErr := h.Collection.InsertOne(ctx, periodSettings)
-	return objectId, insertErr
+	return mongoDuplicateKeyError(insertErr, periodSettingsModelType,
+		mongoUniqueValues(periodSettings.Id, periodSettings.Name, periodSettings.Slug))
 }
 
 func (h *MongoPeriodSettingsHandler) generateFilter(args *PeriodSettingsQueryArgs) (bson.M, error) {
@@ -97,7 +149,7 @@ func (h *MongoPeriodSettingsHandler) generateFilter(args *PeriodSettingsQueryArg
 		res["slug"] = *args.Slug
 	}
 	if args.Name != nil {
-		res["name"] = *args.Slug
+		res["name"] = *args.Name
 	}
 	if len(res) == 0 {
 		return nil, ErrInvalidPeriodSettingsQuery
@@ -126,9 +178,20 @@ func (h *MongoPeriodSettingsHandler) GetPeriod(ctx context.Context, args *Period
 	return h.getSingle(ctx, filter, args)
 }
 
+// notArchivedFilter matches all periods that are not archived, periods stored before archiving was added don't have the
+// field at all.
+func (h *MongoPeriodSettingsHandler) notArchivedFilter() bson.D {
+	return bson.D{
+		{"archived", bson.D{
+			{"$in", bson.A{time.Time{}, nil}},
+		}},
+	}
+}
+
 func (h *MongoPeriodSettingsHandler) GetActivePeriods(ctx context.Context, referenceTime time.Time) (res []*PeriodSettingsModel, err error) {
 	filter := bson.D{
 		{"$and", bson.A{
+			h.notArchivedFilter(),
 			bson.D{
 				{"end", bson.D{
 					{"$gte", referenceTime},
@@ -174,10 +237,11 @@ func (h *MongoPeriodSettingsHandler) GetActivePeriods(ctx context.Context, refer
 }
 
 func (h *MongoPeriodSettingsHandler) GetLatestPeriods(ctx context.Context, limit int64, referenceTime time.Time) (res []*PeriodSettingsModel, err error) {
-	filter := bson.D{}
+	filter := h.notArchivedFilter()
 	if !referenceTime.IsZero() {
 		filter = bson.D{
 			{"$and", bson.A{
+				h.notArchivedFilter(),
 				bson.D{
 					{"end", bson.D{
 						{"$gte", referenceTime},
@@ -228,6 +292,134 @@ func (h *MongoPeriodSettingsHandler) GetLatestPeriods(ctx context.Context, limit
 	return
 }
 
+// periodListFilter returns the filter for the query, cursor can be nil.
+func (h *MongoPeriodSettingsHandler) periodListFilter(query *PeriodListQuery, cursor *PeriodListCursor) bson.A {
+	filters := bson.A{}
+	if !query.IncludeArchived {
+		filters = append(filters, h.notArchivedFilter())
+	}
+	if !query.ActiveAt.IsZero() {
+		filters = append(filters,
+			bson.D{{"start", bson.D{{"$lte", query.ActiveAt}}}},
+			bson.D{{"end", bson.D{{"$gte", query.ActiveAt}}}},
+		)
+	}
+	if query.Name != "" {
+		regex := primitive.Regex{Pattern: regexp.QuoteMeta(query.Name), Options: "i"}
+		filters = append(filters, bson.D{{"name", regex}})
+	}
+	if cursor != nil {
+		// periods are sorted in descending order, the next page contains the smaller keys
+		op := "$lt"
+		if cursor.Backward {
+			op = "$gt"
+		}
+		filters = append(filters, bson.D{
+			{"$or", bson.A{
+				bson.D{{"end", bson.D{{op, cursor.End}}}},
+				bson.D{{"end", cursor.End}, {"start", bson.D{{op, cursor.Start}}}},
+				bson.D{{"end", cursor.End}, {"start", cursor.Start}, {"_id", bson.D{{op, cursor.Id}}}},
+			}},
+		})
+	}
+	return filters
+}
+
+func (h *MongoPeriodSettingsHandler) ListPeriods(ctx context.Context, query *PeriodListQuery) (res *PeriodListPage, err error) {
+	cursor, cursorErr := DecodePeriodListCursor(query)
+	if cursorErr != nil {
+		err = cursorErr
+		return
+	}
+	direction := -1
+	if cursor != nil && cursor.Backward {
+		direction = 1
+	}
+	filter := bson.D{}
+	if filters := h.periodListFilter(query, cursor); len(filters) > 0 {
+		filter = bson.D{{"$and", filters}}
+	}
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{
+		{"end", direction},
+		{"start", direction},
+		{"_id", direction},
+	})
+	// one more than the limit to check if there is another page
+	findOptions.SetLimit(query.GetLimit() + 1)
+	cur, curErr := h.Collection.Find(ctx, filter, findOptions)
+	if curErr != nil {
+		err = curErr
+		return
+	}
+	// takes care of closing the cursor
+	defer func() {
+		closeErr := cur.Close(ctx)
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			res = nil
+		}
+	}()
+	periods := make([]*PeriodSettingsModel, 0, query.GetLimit()+1)
+	for cur.Next(ctx) {
+		next := EmptyPeriodSettingsModel()
+		err = cur.Decode(next)
+		if err != nil {
+			return
+		}
+		periods = append(periods, next)
+	}
+	err = cur.Err()
+	if err != nil {
+		return
+	}
+	res, err = NewPeriodListPage(query, cursor, periods)
+	return
+}
+
+func (h *MongoPeriodSettingsHandler) UpdatePeriodVoters(ctx context.Context, args *PeriodSettingsQueryArgs, voters []*VoterModel) error {
+	filter, queryErr := h.generateFilter(args)
+	if queryErr != nil {
+		return queryErr
+	}
+	if validateErr := ValidateVoters(voters); validateErr != nil {
+		return validateErr
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"voters":      voters,
+			"lastupdated": h.Clock.Now(),
+		},
+	}
+	updateRes, updateErr := h.Collection.UpdateOne(ctx, filter, update)
+	if updateErr != nil {
+		return updateErr
+	}
+	if updateRes.MatchedCount == 0 {
+		return NewEntryNotFoundError(periodSettingsModelType, reflect.ValueOf(args), nil)
+	}
+	return nil
+}
+
+// touchPeriod sets the last updated time of the period, it returns an EntryNotFoundError if the period doesn't exist.
+func (h *MongoPeriodSettingsHandler) touchPeriod(ctx context.Context, id uuid.UUID) error {
+	update := bson.M{
+		"$set": bson.M{
+			"lastupdated": h.Clock.Now(),
+		},
+	}
+	updateRes, updateErr := h.Collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if updateErr != nil {
+		return updateErr
+	}
+	if updateRes.MatchedCount == 0 {
+		return NewEntryNotFoundError(periodSettingsModelType, reflect.ValueOf(id), nil)
+	}
+	return nil
+}
+
 func (h *MongoPeriodSettingsHandler) deleteOnePeriod(ctx context.Context, filter interface{}) (int64, error) {
 	deleteRes, deleteErr := h.Collection.DeleteOne(ctx, filter, options.Delete())
 	if deleteErr != nil {
@@ -236,21 +428,44 @@ func (h *MongoPeriodSettingsHandler) deleteOnePeriod(ctx context.Context, filter
 	return deleteRes.DeletedCount, nil
 }
 
-func (h *MongoPeriodSettingsHandler) DeletePeriod(ctx context.Context, args *PeriodSettingsQueryArgs) (int64, error) {
-	filter, queryErr := h.generateFilter(args)
-	if queryErr != nil {
-		return -1, queryErr
+func (h *MongoPeriodSettingsHandler) RenamePeriod(ctx context.Context, args *PeriodSettingsQueryArgs, name, slug string) error {
+	period, getErr := h.GetPeriod(ctx, args)
+	if getErr != nil {
+		return getErr
+	}
+	period.Name, period.Slug = name, slug
+	if validateErr := period.ValidateModel(); validateErr != nil {
+		return validateErr
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"name":        name,
+			"slug":        slug,
+			"lastupdated": h.Clock.Now(),
+		},
 	}
-	return h.deleteOnePeriod(ctx, filter)
+	updateRes, updateErr := h.Collection.UpdateOne(ctx, bson.M{"_id": period.Id}, update)
+	if updateErr != nil {
+		return mongoDuplicateKeyError(updateErr, periodSettingsModelType, mongoUniqueValues(period.Id, name, slug))
+	}
+	if updateRes.MatchedCount == 0 {
+		return NewEntryNotFoundError(periodSettingsModelType, reflect.ValueOf(args), nil)
+	}
+	return nil
 }
 
+// DeletePeriod is implemented by MongoDataHandler because the meetings of the period must be changed too.
+
 type MongoMeetingHandler struct {
 	Collection *mongo.Collection
+	// Clock is used to set the last updated time of meetings and the transition times of polls
+	Clock pollsweb.Clock
 }
 
 func NewMongoMeetingHandler(collection *mongo.Collection) *MongoMeetingHandler {
 	return &MongoMeetingHandler{
 		Collection: collection,
+		Clock:      pollsweb.NewSystemClock(),
 	}
 }
 
@@ -326,7 +541,7 @@ func (h *MongoMeetingHandler) createdIndex() mongo.IndexModel {
 func (h *MongoMeetingHandler) periodIndex() mongo.IndexModel {
 	return mongo.IndexModel{
 		Keys: bson.D{
-			{"period", 1},
+			{"periodid", 1},
 		},
 		Options: options.Index(),
 	}
@@ -352,8 +567,11 @@ func (h *MongoMeetingHandler) onlineVoteIndex() mongo.IndexModel {
 }
 
 func (h *MongoMeetingHandler) InsertMeeting(ctx context.Context, meeting *MeetingModel) error {
+	if validateErr := meeting.ValidateModel(); validateErr != nil {
+		return validateErr
+	}
 	_, insertErr := h.Collection.InsertOne(ctx, meeting)
-	return insertErr
+	return mongoDuplicateKeyError(insertErr, meetingModelType, mongoUniqueValues(meeting.Id, meeting.Name, meeting.Slug))
 }
 
 func (h *MongoMeetingHandler) getSingle(ctx context.Context, filter, key interface{}) (*MeetingModel, error) {
@@ -377,7 +595,7 @@ func (h *MongoMeetingHandler) generateFilter(args *MeetingQueryArgs) (bson.M, er
 		res["slug"] = *args.Slug
 	}
 	if args.Name != nil {
-		res["name"] = *args.Slug
+		res["name"] = *args.Name
 	}
 	if len(res) == 0 {
 		return nil, ErrInvalidMeetingQuery
@@ -400,6 +618,381 @@ func (h *MongoMeetingHandler) GetMeeting(ctx context.Context, args *MeetingQuery
 	return h.getSingle(ctx, filter, args)
 }
 
+func (h *MongoMeetingHandler) findMeetings(ctx context.Context, filter interface{}, findOptions *options.FindOptions) (res []*MeetingModel, err error) {
+	cur, curErr := h.Collection.Find(ctx, filter, findOptions)
+	if curErr != nil {
+		err = curErr
+		return
+	}
+	// takes care of closing the cursor
+	defer func() {
+		closeErr := cur.Close(ctx)
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			res = nil
+		}
+	}()
+	res = make([]*MeetingModel, 0, 42)
+	for cur.Next(ctx) {
+		next := emptyMongoMeetingModel()
+		err = cur.Decode(next)
+		if err != nil {
+			return
+		}
+		var meeting *MeetingModel
+		meeting, err = next.toMeetingModel()
+		if err != nil {
+			return
+		}
+		res = append(res, meeting)
+	}
+	err = cur.Err()
+	return
+}
+
+func (h *MongoMeetingHandler) GetMeetingsForPeriod(ctx context.Context, periodId uuid.UUID) ([]*MeetingModel, error) {
+	filter := bson.D{
+		{"periodid", periodId},
+	}
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{
+		{"meetingtime", 1},
+	})
+	return h.findMeetings(ctx, filter, findOptions)
+}
+
+func (h *MongoMeetingHandler) GetOnlineVotingMeetings(ctx context.Context, referenceTime time.Time) ([]*MeetingModel, error) {
+	filter := bson.D{
+		{"$and", bson.A{
+			bson.D{
+				{"onlineend", bson.D{
+					{"$gte", referenceTime},
+				}},
+			},
+			bson.D{
+				{"onlinestart", bson.D{
+					{"$lte", referenceTime},
+				}},
+			},
+		},
+		}}
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{
+		{"onlineend", 1},
+	})
+	return h.findMeetings(ctx, filter, findOptions)
+}
+
+func (h *MongoMeetingHandler) GetVotingTransitionMeetings(ctx context.Context, referenceTime time.Time) ([]*MeetingModel, error) {
+	// meetings stored before the transitions were recorded don't have the fields
+	notApplied := bson.D{
+		{"$in", bson.A{time.Time{}, nil}},
+	}
+	filter := bson.D{
+		{"onlinestart", bson.D{
+			{"$gt", time.Time{}},
+		}},
+		{"$or", bson.A{
+			bson.D{
+				{"onlinestart", bson.D{
+					{"$lte", referenceTime},
+				}},
+				{"onlineend", bson.D{
+					{"$gt", referenceTime},
+				}},
+				{"onlineopenedat", notApplied},
+			},
+			bson.D{
+				{"onlineend", bson.D{
+					{"$lte", referenceTime},
+					{"$gt", time.Time{}},
+				}},
+				{"onlineclosedat", notApplied},
+			},
+		}},
+	}
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{
+		{"onlinestart", 1},
+	})
+	return h.findMeetings(ctx, filter, findOptions)
+}
+
+// mongoMeetingSummary is the projection of a meeting document used for MeetingSummary.
+type mongoMeetingSummary struct {
+	Id          uuid.UUID `bson:"_id"`
+	Name        string
+	Slug        string
+	PeriodId    uuid.UUID
+	Created     time.Time
+	MeetingTime time.Time
+	OnlineStart time.Time
+	OnlineEnd   time.Time
+	NumVoters   int
+	NumPolls    int
+}
+
+func (m *mongoMeetingSummary) toMeetingSummary() *MeetingSummary {
+	return &MeetingSummary{
+		Id:          m.Id,
+		Name:        m.Name,
+		Slug:        m.Slug,
+		PeriodId:    m.PeriodId,
+		Created:     m.Created,
+		MeetingTime: m.MeetingTime,
+		OnlineStart: m.OnlineStart,
+		OnlineEnd:   m.OnlineEnd,
+		NumVoters:   m.NumVoters,
+		NumPolls:    m.NumPolls,
+	}
+}
+
+func (h *MongoMeetingHandler) meetingListSortField(sortBy MeetingListSort) string {
+	switch sortBy {
+	case MeetingSortName:
+		return "name"
+	case MeetingSortCreated:
+		return "created"
+	default:
+		return "meetingtime"
+	}
+}
+
+// meetingListFilter returns the filter for the query, cursor can be nil.
+func (h *MongoMeetingHandler) meetingListFilter(query *MeetingListQuery, cursor *MeetingListCursor) bson.A {
+	filters := bson.A{}
+	if query.PeriodId != nil {
+		filters = append(filters, bson.D{{"periodid", *query.PeriodId}})
+	}
+	if !query.From.IsZero() {
+		filters = append(filters, bson.D{{"meetingtime", bson.D{{"$gte", query.From}}}})
+	}
+	if !query.To.IsZero() {
+		filters = append(filters, bson.D{{"meetingtime", bson.D{{"$lt", query.To}}}})
+	}
+	if !query.OpenForVoting.IsZero() {
+		filters = append(filters,
+			bson.D{{"onlinestart", bson.D{{"$gt", time.Time{}}, {"$lte", query.OpenForVoting}}}},
+			bson.D{{"onlineend", bson.D{{"$gt", query.OpenForVoting}}}},
+		)
+	}
+	if query.NamePrefix != "" {
+		regex := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(query.NamePrefix), Options: "i"}
+		filters = append(filters, bson.D{{"name", regex}})
+	}
+	if cursor != nil {
+		field := h.meetingListSortField(cursor.SortBy)
+		var value interface{} = cursor.Time
+		if cursor.SortBy == MeetingSortName {
+			value = cursor.Name
+		}
+		op := "$gt"
+		if cursor.Descending {
+			op = "$lt"
+		}
+		filters = append(filters, bson.D{
+			{"$or", bson.A{
+				bson.D{{field, bson.D{{op, value}}}},
+				bson.D{{field, value}, {"_id", bson.D{{op, cursor.Id}}}},
+			}},
+		})
+	}
+	return filters
+}
+
+func (h *MongoMeetingHandler) ListMeetings(ctx context.Context, query *MeetingListQuery) (res *MeetingListPage, err error) {
+	cursor, cursorErr := DecodeMeetingListCursor(query)
+	if cursorErr != nil {
+		err = cursorErr
+		return
+	}
+	direction := 1
+	if query.Descending {
+		direction = -1
+	}
+	match := bson.D{}
+	if filters := h.meetingListFilter(query, cursor); len(filters) > 0 {
+		match = bson.D{{"$and", filters}}
+	}
+	pipeline := mongo.Pipeline{
+		{{"$match", match}},
+		{{"$sort", bson.D{
+			{h.meetingListSortField(query.SortBy), direction},
+			{"_id", direction},
+		}}},
+		// one more than the limit to check if there is a next page
+		{{"$limit", query.GetLimit() + 1}},
+		{{"$project", bson.D{
+			{"name", 1},
+			{"slug", 1},
+			{"periodid", 1},
+			{"created", 1},
+			{"meetingtime", 1},
+			{"onlinestart", 1},
+			{"onlineend", 1},
+			{"numvoters", bson.D{{"$size", bson.D{{"$ifNull", bson.A{"$voters", bson.A{}}}}}}},
+			{"numpolls", bson.D{{"$sum", bson.D{{"$map", bson.D{
+				{"input", bson.D{{"$ifNull", bson.A{"$groups", bson.A{}}}}},
+				{"as", "group"},
+				{"in", bson.D{{"$size", bson.D{{"$ifNull", bson.A{"$$group.polls", bson.A{}}}}}}},
+			}}}}}},
+		}}},
+	}
+	cur, curErr := h.Collection.Aggregate(ctx, pipeline)
+	if curErr != nil {
+		err = curErr
+		return
+	}
+	// takes care of closing the cursor
+	defer func() {
+		closeErr := cur.Close(ctx)
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			res = nil
+		}
+	}()
+	summaries := make([]*MeetingSummary, 0, query.GetLimit()+1)
+	for cur.Next(ctx) {
+		var next mongoMeetingSummary
+		err = cur.Decode(&next)
+		if err != nil {
+			return
+		}
+		summaries = append(summaries, next.toMeetingSummary())
+	}
+	err = cur.Err()
+	if err != nil {
+		return
+	}
+	res, err = NewMeetingListPage(query, summaries)
+	return
+}
+
+// updateMeeting sets the given fields, updates lastupdated and increments the update token.
+func (h *MongoMeetingHandler) updateMeeting(ctx context.Context, args *MeetingQueryArgs, fields bson.M) error {
+	filter, queryErr := h.generateFilter(args)
+	if queryErr != nil {
+		return queryErr
+	}
+	fields["lastupdated"] = h.Clock.Now()
+	update := bson.M{
+		"$set": fields,
+		"$inc": bson.M{
+			"updatetoken": 1,
+		},
+	}
+	updateRes, updateErr := h.Collection.UpdateOne(ctx, filter, update)
+	if updateErr != nil {
+		return updateErr
+	}
+	if updateRes.MatchedCount == 0 {
+		return NewEntryNotFoundError(meetingModelType, reflect.ValueOf(args), nil)
+	}
+	return nil
+}
+
+func (h *MongoMeetingHandler) UpdateMeetingVoters(ctx context.Context, args *MeetingQueryArgs, voters []*VoterModel) error {
+	if validateErr := ValidateVoters(voters); validateErr != nil {
+		return validateErr
+	}
+	return h.updateMeeting(ctx, args, bson.M{"voters": voters})
+}
+
+func (h *MongoMeetingHandler) UpdateMeetingGroups(ctx context.Context, args *MeetingQueryArgs, groups []*PollGroupModel) error {
+	if validateErr := ValidatePollGroups(groups); validateErr != nil {
+		return validateErr
+	}
+	return h.modifyMeetingGroups(ctx, args, func(meeting *MeetingModel) error {
+		if checkErr := CheckPollGroupsUpdate(meeting.Groups, groups); checkErr != nil {
+			return checkErr
+		}
+		meeting.Groups = groups
+		return nil
+	})
+}
+
+// modifyMeetingGroups reads the meeting, calls modify and writes the poll groups back.
+// The update token of the meeting that was read makes sure that the meeting has not been changed in the meantime.
+func (h *MongoMeetingHandler) modifyMeetingGroups(ctx context.Context, args *MeetingQueryArgs, modify func(meeting *MeetingModel) error) error {
+	meeting, getErr := h.GetMeeting(ctx, args)
+	if getErr != nil {
+		return getErr
+	}
+	if modifyErr := modify(meeting); modifyErr != nil {
+		return modifyErr
+	}
+	if validateErr := ValidatePollGroups(meeting.Groups); validateErr != nil {
+		return validateErr
+	}
+	updateArgs := NewMeetingQueryArgs().
+		SetId(&meeting.Id).
+		SetUpdateToken(&meeting.UpdateToken)
+	update := bson.M{
+		"groups":         meeting.Groups,
+		"onlineopenedat": meeting.OnlineOpenedAt,
+		"onlineclosedat": meeting.OnlineClosedAt,
+	}
+	return h.updateMeeting(ctx, updateArgs, update)
+}
+
+func (h *MongoMeetingHandler) UpdatePollState(ctx context.Context, args *MeetingQueryArgs, pollId uuid.UUID, state string) error {
+	return h.modifyMeetingGroups(ctx, args, func(meeting *MeetingModel) error {
+		return meeting.TransitionPoll(pollId, state, h.Clock.Now())
+	})
+}
+
+func (h *MongoMeetingHandler) AddVotes(ctx context.Context, args *MeetingQueryArgs, votes []*PollVote) error {
+	return h.modifyMeetingGroups(ctx, args, func(meeting *MeetingModel) error {
+		return meeting.AddVotes(votes)
+	})
+}
+
+func (h *MongoMeetingHandler) UpdateMeetingPollStates(ctx context.Context, args *MeetingQueryArgs, from, to string) (int, error) {
+	num := 0
+	err := h.modifyMeetingGroups(ctx, args, func(meeting *MeetingModel) error {
+		var transitionErr error
+		num, transitionErr = meeting.TransitionPolls(from, to, h.Clock.Now())
+		return transitionErr
+	})
+	if err != nil {
+		return 0, err
+	}
+	return num, nil
+}
+
+func (h *MongoMeetingHandler) ApplyVotingTransition(ctx context.Context, args *MeetingQueryArgs, transition *VotingTransition) (int, error) {
+	num := 0
+	err := h.modifyMeetingGroups(ctx, args, func(meeting *MeetingModel) error {
+		var transitionErr error
+		num, transitionErr = meeting.ApplyVotingTransition(transition, h.Clock.Now())
+		return transitionErr
+	})
+	if err != nil {
+		return 0, err
+	}
+	return num, nil
+}
+
+func (h *MongoMeetingHandler) SetMeetingNotificationSent(ctx context.Context, meetingId uuid.UUID, notification string, sent time.Time) error {
+	update := bson.M{
+		"$set": bson.M{
+			"notificationssent." + notification: sent,
+		},
+	}
+	updateRes, updateErr := h.Collection.UpdateOne(ctx, bson.M{"_id": meetingId}, update)
+	if updateErr != nil {
+		return updateErr
+	}
+	if updateRes.MatchedCount == 0 {
+		return NewEntryNotFoundError(meetingModelType, reflect.ValueOf(meetingId), nil)
+	}
+	return nil
+}
+
 func (h *MongoMeetingHandler) deleteOneMeeting(ctx context.Context, filter interface{}) (int64, error) {
 	deleteRes, deleteErr := h.Collection.DeleteOne(ctx, filter, options.Delete())
 	if deleteErr != nil {
@@ -419,7 +1012,19 @@ func (h *MongoMeetingHandler) DeleteMeeting(ctx context.Context, args *MeetingQu
 type MongoDataHandler struct {
 	*MongoPeriodSettingsHandler
 	*MongoMeetingHandler
-	Client *mongo.Client
+	*MongoWebhooksHandler
+	*MongoAuditHandler
+	*MongoChainHandler
+	Client   *mongo.Client
+	Database *mongo.Database
+
+	// cached result of SupportsTransactions, nil if not checked yet
+	transactionsMutex sync.Mutex
+	transactions      *bool
+	// meetings with records that have been written without being linked into the chain (only without transactions),
+	// see chainedWrite
+	unlinkedMutex    sync.Mutex
+	unlinkedMeetings map[uuid.UUID]struct{}
 }
 
 func NewMongoDataHandler(client *mongo.Client, databaseName string) *MongoDataHandler {
@@ -427,10 +1032,488 @@ func NewMongoDataHandler(client *mongo.Client, databaseName string) *MongoDataHa
 	return &MongoDataHandler{
 		MongoPeriodSettingsHandler: NewMongoPeriodSettingsHandler(database.Collection("periodsettings")),
 		MongoMeetingHandler:        NewMongoMeetingHandler(database.Collection("meetings")),
+		MongoWebhooksHandler:       NewMongoWebhooksHandler(database.Collection("webhooks"), database.Collection("webhookdeliveries")),
+		MongoAuditHandler:          NewMongoAuditHandler(database.Collection("audit")),
+		MongoChainHandler:          NewMongoChainHandler(database.Collection("chain")),
 		Client:                     client,
+		Database:                   database,
+		unlinkedMeetings:           make(map[uuid.UUID]struct{}),
+	}
+}
+
+// CollectionNames returns the names of all collections used by the handler (including the migrations collection).
+func (h *MongoDataHandler) CollectionNames() []string {
+	return []string{
+		h.MongoPeriodSettingsHandler.Collection.Name(),
+		h.MongoMeetingHandler.Collection.Name(),
+		h.MongoWebhooksHandler.Collection.Name(),
+		h.MongoWebhooksHandler.DeliveryCollection.Name(),
+		h.MongoAuditHandler.Collection.Name(),
+		h.MongoChainHandler.Collection.Name(),
+		MongoMigrationsCollection,
+	}
+}
+
+// CreateCollections creates all collections that don't exist yet and returns the names of the created collections.
+func (h *MongoDataHandler) CreateCollections(ctx context.Context) ([]string, error) {
+	res := make([]string, 0, 5)
+	for _, name := range h.CollectionNames() {
+		created, err := createCollection(ctx, h.Database, name)
+		if err != nil {
+			return res, err
+		}
+		if created {
+			res = append(res, name)
+		}
+	}
+	return res, nil
+}
+
+// IsEmpty returns true if no collection (except the migrations collection) contains a document.
+func (h *MongoDataHandler) IsEmpty(ctx context.Context) (bool, error) {
+	for _, name := range h.CollectionNames() {
+		if name == MongoMigrationsCollection {
+			continue
+		}
+		count, countErr := h.Database.Collection(name).CountDocuments(ctx, bson.D{}, options.Count().SetLimit(1))
+		if countErr != nil {
+			return false, countErr
+		}
+		if count > 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// CreateIndexes creates the indexes of all collections (including the unique constraints on names and slugs) and
+// returns their names. Existing indexes with the same specification are not changed.
+func (h *MongoDataHandler) CreateIndexes(ctx context.Context) ([]string, error) {
+	res := make([]string, 0, 16)
+	creators := []func(ctx context.Context) ([]string, error){
+		h.MongoPeriodSettingsHandler.CreateIndexes,
+		h.MongoMeetingHandler.CreateIndexes,
+		h.MongoWebhooksHandler.CreateIndexes,
+		h.MongoAuditHandler.CreateIndexes,
+		h.MongoChainHandler.CreateIndexes,
+	}
+	for _, create := range creators {
+		names, err := create(ctx)
+		res = append(res, names...)
+		if err != nil {
+			return res, err
+		}
 	}
+	return res, nil
+}
+
+// Migrator returns a migrator for the database of the handler.
+func (h *MongoDataHandler) Migrator() *MongoMigrator {
+	res := NewMongoMigrator(h.Database)
+	res.Clock = h.MongoMeetingHandler.Clock
+	return res
+}
+
+// SetClock sets the clock of all handlers.
+func (h *MongoDataHandler) SetClock(clock pollsweb.Clock) {
+	h.MongoPeriodSettingsHandler.Clock = clock
+	h.MongoMeetingHandler.Clock = clock
+	h.MongoWebhooksHandler.Clock = clock
+	h.MongoAuditHandler.Clock = clock
+	h.MongoChainHandler.Clock = clock
 }
 
 func (h *MongoDataHandler) Close(ctx context.Context) error {
 	return h.Client.Disconnect(ctx)
 }
+
+type mongoIsMasterResult struct {
+	SetName string `bson:"setName"`
+	Msg     string `bson:"msg"`
+}
+
+// SupportsTransactions returns true if the deployment supports multi-document transactions, that is if it is a
+// replica set or a sharded cluster. Without transactions records and their chain entries are not written atomically,
+// see chainedWrite.
+func (h *MongoDataHandler) SupportsTransactions(ctx context.Context) (bool, error) {
+	h.transactionsMutex.Lock()
+	defer h.transactionsMutex.Unlock()
+	if h.transactions != nil {
+		return *h.transactions, nil
+	}
+	var result mongoIsMasterResult
+	if err := h.Client.Database("admin").RunCommand(ctx, bson.D{{"isMaster", 1}}).Decode(&result); err != nil {
+		return false, err
+	}
+	supported := result.SetName != "" || result.Msg == "isdbgrid"
+	h.transactions = &supported
+	return supported, nil
+}
+
+// withTransaction calls f in a transaction if the deployment supports transactions, f must use the context it is
+// called with. Otherwise f is called without a transaction and the changes made by f are not atomic.
+//
+// f might be called more than once if the transaction is retried.
+func (h *MongoDataHandler) withTransaction(ctx context.Context, f func(ctx context.Context) error) error {
+	supported, checkErr := h.SupportsTransactions(ctx)
+	if checkErr != nil {
+		return checkErr
+	}
+	if !supported {
+		return f(ctx)
+	}
+	session, sessionErr := h.Client.StartSession()
+	if sessionErr != nil {
+		return sessionErr
+	}
+	defer session.EndSession(ctx)
+	_, err := session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, f(sessionCtx)
+	})
+	return err
+}
+
+// InsertMeeting inserts the meeting if its period exists.
+//
+// The last updated time of the period is set in the same transaction. Reading the period is not enough: a concurrent
+// DeletePeriod could delete the period after it was read (write skew), writing it makes one of the transactions fail
+// with a write conflict.
+func (h *MongoDataHandler) InsertMeeting(ctx context.Context, meeting *MeetingModel) error {
+	return h.withTransaction(ctx, func(ctx context.Context) error {
+		if touchErr := h.MongoPeriodSettingsHandler.touchPeriod(ctx, meeting.PeriodId); touchErr != nil {
+			return touchErr
+		}
+		return h.MongoMeetingHandler.InsertMeeting(ctx, meeting)
+	})
+}
+
+// UnlinkedChainWriteError is returned by writes of a MongoDataHandler without transactions if the records have been
+// written but could not be linked into the chain of the meeting. They're linked before the next write that appends to
+// a chain (and on startup, see LinkAllUnchainedRecords).
+type UnlinkedChainWriteError struct {
+	pollsweb.PollWebError
+	MeetingId uuid.UUID
+	Wrapped   error
+}
+
+func NewUnlinkedChainWriteError(meetingId uuid.UUID, wrapped error) UnlinkedChainWriteError {
+	return UnlinkedChainWriteError{
+		MeetingId: meetingId,
+		Wrapped:   wrapped,
+	}
+}
+
+func (e UnlinkedChainWriteError) Error() string {
+	return fmt.Sprintf("the records have been written without a transaction but could not be linked into the chain of meeting %s, they're linked with the next write: %v",
+		e.MeetingId, e.Wrapped)
+}
+
+func (e UnlinkedChainWriteError) Unwrap() error {
+	return e.Wrapped
+}
+
+// chainedWrite calls write and appends the records returned by write to the chain of the meeting.
+//
+// If the deployment supports transactions both happens in a transaction. Otherwise the records are written first and
+// the chain entries are appended afterwards: if appending fails the meeting is remembered and LinkUnchainedRecords is
+// called for it before the next chained write, an UnlinkedChainWriteError is returned. Records that have not been
+// linked because the process stopped in between are linked on startup by LinkAllUnchainedRecords.
+func (h *MongoDataHandler) chainedWrite(ctx context.Context, write func(ctx context.Context) (uuid.UUID, []*ChainRecord, error)) error {
+	supported, checkErr := h.SupportsTransactions(ctx)
+	if checkErr != nil {
+		return checkErr
+	}
+	if supported {
+		return h.withTransaction(ctx, func(ctx context.Context) error {
+			meetingId, records, writeErr := write(ctx)
+			if writeErr != nil {
+				return writeErr
+			}
+			return h.appendChain(ctx, meetingId, records)
+		})
+	}
+	if linkErr := h.linkUnlinkedMeetings(ctx); linkErr != nil {
+		return linkErr
+	}
+	meetingId, records, writeErr := write(ctx)
+	if writeErr != nil {
+		return writeErr
+	}
+	if appendErr := h.appendChain(ctx, meetingId, records); appendErr != nil {
+		h.unlinkedMutex.Lock()
+		h.unlinkedMeetings[meetingId] = struct{}{}
+		h.unlinkedMutex.Unlock()
+		return NewUnlinkedChainWriteError(meetingId, appendErr)
+	}
+	return nil
+}
+
+// linkUnlinkedMeetings calls LinkUnchainedRecords for all meetings remembered by chainedWrite, meetings that have
+// been deleted in the meantime are skipped.
+func (h *MongoDataHandler) linkUnlinkedMeetings(ctx context.Context) error {
+	h.unlinkedMutex.Lock()
+	defer h.unlinkedMutex.Unlock()
+	for meetingId := range h.unlinkedMeetings {
+		if _, linkErr := h.LinkUnchainedRecords(ctx, meetingId); linkErr != nil && !isEntryNotFound(linkErr) {
+			return linkErr
+		}
+		delete(h.unlinkedMeetings, meetingId)
+	}
+	return nil
+}
+
+// AddVotes adds the votes and links them into the chain of the meeting, see chainedWrite.
+func (h *MongoDataHandler) AddVotes(ctx context.Context, args *MeetingQueryArgs, votes []*PollVote) error {
+	records, recordsErr := NewVoteChainRecords(votes)
+	if recordsErr != nil {
+		return recordsErr
+	}
+	return h.chainedWrite(ctx, func(ctx context.Context) (uuid.UUID, []*ChainRecord, error) {
+		var meetingId uuid.UUID
+		addErr := h.MongoMeetingHandler.modifyMeetingGroups(ctx, args, func(meeting *MeetingModel) error {
+			meetingId = meeting.Id
+			return meeting.AddVotes(votes)
+		})
+		if addErr != nil {
+			return uuid.Nil, nil, addErr
+		}
+		return meetingId, records, nil
+	})
+}
+
+// modifyMeetingPolls works like MongoMeetingHandler.modifyMeetingGroups, the definitions of all polls opened by
+// modify are linked into the chain of the meeting (see chainedWrite).
+func (h *MongoDataHandler) modifyMeetingPolls(ctx context.Context, args *MeetingQueryArgs, modify func(meeting *MeetingModel) error) error {
+	return h.chainedWrite(ctx, func(ctx context.Context) (uuid.UUID, []*ChainRecord, error) {
+		var modified *MeetingModel
+		var drafts map[uuid.UUID]struct{}
+		modifyErr := h.MongoMeetingHandler.modifyMeetingGroups(ctx, args, func(meeting *MeetingModel) error {
+			modified = meeting
+			drafts = draftPollIds(meeting)
+			return modify(meeting)
+		})
+		if modifyErr != nil {
+			return uuid.Nil, nil, modifyErr
+		}
+		records, recordsErr := openedPollChainRecords(modified, drafts)
+		if recordsErr != nil {
+			return uuid.Nil, nil, recordsErr
+		}
+		return modified.Id, records, nil
+	})
+}
+
+func (h *MongoDataHandler) UpdatePollState(ctx context.Context, args *MeetingQueryArgs, pollId uuid.UUID, state string) error {
+	return h.modifyMeetingPolls(ctx, args, func(meeting *MeetingModel) error {
+		return meeting.TransitionPoll(pollId, state, h.MongoMeetingHandler.Clock.Now())
+	})
+}
+
+func (h *MongoDataHandler) UpdateMeetingPollStates(ctx context.Context, args *MeetingQueryArgs, from, to string) (int, error) {
+	num := 0
+	err := h.modifyMeetingPolls(ctx, args, func(meeting *MeetingModel) error {
+		var transitionErr error
+		num, transitionErr = meeting.TransitionPolls(from, to, h.MongoMeetingHandler.Clock.Now())
+		return transitionErr
+	})
+	if err != nil {
+		return 0, err
+	}
+	return num, nil
+}
+
+func (h *MongoDataHandler) ApplyVotingTransition(ctx context.Context, args *MeetingQueryArgs, transition *VotingTransition) (int, error) {
+	num := 0
+	err := h.modifyMeetingPolls(ctx, args, func(meeting *MeetingModel) error {
+		var transitionErr error
+		num, transitionErr = meeting.ApplyVotingTransition(transition, h.MongoMeetingHandler.Clock.Now())
+		return transitionErr
+	})
+	if err != nil {
+		return 0, err
+	}
+	return num, nil
+}
+
+// InsertAuditEntry inserts the entry, entries that reference a meeting are linked into the chain of the meeting (see
+// chainedWrite).
+func (h *MongoDataHandler) InsertAuditEntry(ctx context.Context, entry *AuditEntryModel) (uuid.UUID, error) {
+	if entry.MeetingId == uuid.Nil {
+		return h.MongoAuditHandler.InsertAuditEntry(ctx, entry)
+	}
+	var res uuid.UUID
+	err := h.chainedWrite(ctx, func(ctx context.Context) (uuid.UUID, []*ChainRecord, error) {
+		var insertErr error
+		res, insertErr = h.MongoAuditHandler.InsertAuditEntry(ctx, entry)
+		if insertErr != nil {
+			return uuid.Nil, nil, insertErr
+		}
+		record, recordErr := NewAuditChainRecord(entry)
+		if recordErr != nil {
+			return uuid.Nil, nil, recordErr
+		}
+		return entry.MeetingId, []*ChainRecord{record}, nil
+	})
+	return res, err
+}
+
+func (h *MongoDataHandler) LinkUnchainedRecords(ctx context.Context, meetingId uuid.UUID) (int, error) {
+	var res int
+	err := h.withTransaction(ctx, func(ctx context.Context) error {
+		res = 0
+		meeting, getErr := h.GetMeeting(ctx, NewMeetingQueryArgs().SetId(&meetingId))
+		if getErr != nil {
+			return getErr
+		}
+		chain, chainErr := h.GetChain(ctx, meetingId)
+		if chainErr != nil {
+			return chainErr
+		}
+		auditEntries := make([]*AuditEntryModel, 0)
+		query := NewAuditQuery().SetMeetingId(&meetingId).SetLimit(500)
+		auditErr := AllAuditEntries(ctx, h, query, func(entry *AuditEntryModel) error {
+			auditEntries = append(auditEntries, entry)
+			return nil
+		})
+		if auditErr != nil {
+			return auditErr
+		}
+		records, recordsErr := UnlinkedChainRecords(chain, meeting, auditEntries)
+		if recordsErr != nil {
+			return recordsErr
+		}
+		res = len(records)
+		return h.appendChain(ctx, meetingId, records)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res, nil
+}
+
+func (h *MongoDataHandler) DeletePeriod(ctx context.Context, args *PeriodSettingsQueryArgs, mode PeriodDeleteMode) (int64, error) {
+	var res int64
+	err := h.withTransaction(ctx, func(ctx context.Context) error {
+		res = 0
+		period, getErr := h.GetPeriod(ctx, args)
+		if getErr != nil {
+			var notFound EntryNotFoundError
+			if errors.As(getErr, &notFound) {
+				return nil
+			}
+			return getErr
+		}
+		meetingsFilter := bson.M{"periodid": period.Id}
+		switch mode {
+		case PeriodDeleteRestrict:
+			numMeetings, countErr := h.MongoMeetingHandler.Collection.CountDocuments(ctx, meetingsFilter)
+			if countErr != nil {
+				return countErr
+			}
+			if numMeetings > 0 {
+				return NewPeriodInUseError(period.Id, numMeetings)
+			}
+		case PeriodDeleteCascade:
+			if _, deleteErr := h.MongoMeetingHandler.Collection.DeleteMany(ctx, meetingsFilter); deleteErr != nil {
+				return deleteErr
+			}
+		case PeriodDeleteArchive:
+			now := h.MongoPeriodSettingsHandler.Clock.Now()
+			update := bson.M{
+				"$set": bson.M{
+					"archived":    now,
+					"lastupdated": now,
+				},
+			}
+			updateRes, updateErr := h.MongoPeriodSettingsHandler.Collection.UpdateOne(ctx, bson.M{"_id": period.Id}, update)
+			if updateErr != nil {
+				return updateErr
+			}
+			res = updateRes.MatchedCount
+			return nil
+		default:
+			return fmt.Errorf("invalid delete mode %s", mode)
+		}
+		var deleteErr error
+		res, deleteErr = h.deleteOnePeriod(ctx, bson.M{"_id": period.Id})
+		return deleteErr
+	})
+	if err != nil {
+		return -1, err
+	}
+	return res, nil
+}
+
+// WriteImport writes the data in a transaction if the deployment supports transactions.
+func (h *MongoDataHandler) WriteImport(ctx context.Context, data *ArchiveImportData) (*ArchiveWriteResult, error) {
+	for _, period := range data.Periods {
+		if validateErr := period.ValidateModel(); validateErr != nil {
+			return nil, validateErr
+		}
+	}
+	for _, meeting := range data.Meetings {
+		if validateErr := meeting.ValidateModel(); validateErr != nil {
+			return nil, validateErr
+		}
+	}
+	var res *ArchiveWriteResult
+	err := h.withTransaction(ctx, func(ctx context.Context) error {
+		res = &ArchiveWriteResult{}
+		if data.Replace {
+			meetingsRes, meetingsErr := h.MongoMeetingHandler.Collection.DeleteMany(ctx, bson.M{})
+			if meetingsErr != nil {
+				return meetingsErr
+			}
+			periodsRes, periodsErr := h.MongoPeriodSettingsHandler.Collection.DeleteMany(ctx, bson.M{})
+			if periodsErr != nil {
+				return periodsErr
+			}
+			auditRes, auditErr := h.MongoAuditHandler.Collection.DeleteMany(ctx, bson.M{})
+			if auditErr != nil {
+				return auditErr
+			}
+			chainRes, chainErr := h.MongoChainHandler.Collection.DeleteMany(ctx, bson.M{})
+			if chainErr != nil {
+				return chainErr
+			}
+			res.PeriodsDeleted, res.MeetingsDeleted = periodsRes.DeletedCount, meetingsRes.DeletedCount
+			res.AuditEntriesDeleted, res.ChainEntriesDeleted = auditRes.DeletedCount, chainRes.DeletedCount
+		}
+		for _, period := range data.Periods {
+			if insertErr := h.insertPeriod(ctx, period); insertErr != nil {
+				return insertErr
+			}
+		}
+		for _, meeting := range data.Meetings {
+			if _, getErr := h.GetPeriod(ctx, NewPeriodSettingsQueryArgs().SetId(&meeting.PeriodId)); getErr != nil {
+				return getErr
+			}
+			if insertErr := h.MongoMeetingHandler.InsertMeeting(ctx, meeting); insertErr != nil {
+				return insertErr
+			}
+		}
+		for _, entry := range data.AuditEntries {
+			inserted, insertErr := h.importAuditEntry(ctx, entry)
+			if insertErr != nil {
+				return insertErr
+			}
+			if inserted {
+				res.AuditEntriesWritten++
+			}
+		}
+		for _, entry := range data.ChainEntries {
+			inserted, insertErr := h.importChainEntry(ctx, entry)
+			if insertErr != nil {
+				return insertErr
+			}
+			if inserted {
+				res.ChainEntriesWritten++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,172 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"context"
+	"github.com/FabianWe/pollsweb"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoAuditHandler stores the audit log in a collection, entries are only ever inserted.
+type MongoAuditHandler struct {
+	Collection *mongo.Collection
+	// Clock is used to set the time of entries without a time
+	Clock pollsweb.Clock
+}
+
+func NewMongoAuditHandler(collection *mongo.Collection) *MongoAuditHandler {
+	return &MongoAuditHandler{
+		Collection: collection,
+		Clock:      pollsweb.NewSystemClock(),
+	}
+}
+
+func (h *MongoAuditHandler) CreateIndexes(ctx context.Context) ([]string, error) {
+	indexes := []mongo.IndexModel{h.timeIndex(), h.meetingTimeIndex()}
+	return h.Collection.Indexes().CreateMany(ctx, indexes, options.CreateIndexes())
+}
+
+func (h *MongoAuditHandler) timeIndex() mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys: bson.D{
+			{"time", -1},
+			{"_id", -1},
+		},
+		Options: options.Index(),
+	}
+}
+
+func (h *MongoAuditHandler) meetingTimeIndex() mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys: bson.D{
+			{"meetingid", 1},
+			{"time", -1},
+		},
+		Options: options.Index(),
+	}
+}
+
+func (h *MongoAuditHandler) InsertAuditEntry(ctx context.Context, entry *AuditEntryModel) (uuid.UUID, error) {
+	objectId, uuidErr := pollsweb.GenUUID()
+	if uuidErr != nil {
+		return objectId, uuidErr
+	}
+	entry.Id = objectId
+	if entry.Time.IsZero() {
+		entry.Time = h.Clock.Now()
+	}
+	_, insertErr := h.Collection.InsertOne(ctx, entry)
+	return objectId, insertErr
+}
+
+// importAuditEntry inserts the entry with its id, it returns false if an entry with the id already exists.
+// The id is checked before the entry is inserted: a failed insert would abort the transaction of the import.
+func (h *MongoAuditHandler) importAuditEntry(ctx context.Context, entry *AuditEntryModel) (bool, error) {
+	num, countErr := h.Collection.CountDocuments(ctx, bson.M{"_id": entry.Id})
+	if countErr != nil {
+		return false, countErr
+	}
+	if num > 0 {
+		return false, nil
+	}
+	_, insertErr := h.Collection.InsertOne(ctx, entry)
+	return insertErr == nil, mongoDuplicateKeyError(insertErr, auditEntryModelType, nil)
+}
+
+func (h *MongoAuditHandler) auditFilter(query *AuditQuery, cursor *AuditCursor) bson.D {
+	filters := bson.A{}
+	if query.Action != "" {
+		filters = append(filters, bson.D{{"action", query.Action}})
+	}
+	if query.Actor != "" {
+		filters = append(filters, bson.D{{"actor", query.Actor}})
+	}
+	if query.PeriodId != nil {
+		filters = append(filters, bson.D{{"periodid", *query.PeriodId}})
+	}
+	if query.MeetingId != nil {
+		filters = append(filters, bson.D{{"meetingid", *query.MeetingId}})
+	}
+	if query.PollId != nil {
+		filters = append(filters, bson.D{{"pollid", *query.PollId}})
+	}
+	if !query.From.IsZero() {
+		filters = append(filters, bson.D{{"time", bson.D{{"$gte", query.From}}}})
+	}
+	if !query.To.IsZero() {
+		filters = append(filters, bson.D{{"time", bson.D{{"$lt", query.To}}}})
+	}
+	if cursor != nil {
+		filters = append(filters, bson.D{
+			{"$or", bson.A{
+				bson.D{{"time", bson.D{{"$lt", cursor.Time}}}},
+				bson.D{{"time", cursor.Time}, {"_id", bson.D{{"$lt", cursor.Id}}}},
+			}},
+		})
+	}
+	if len(filters) == 0 {
+		return bson.D{}
+	}
+	return bson.D{{"$and", filters}}
+}
+
+func (h *MongoAuditHandler) ListAuditEntries(ctx context.Context, query *AuditQuery) (res *AuditPage, err error) {
+	cursor, cursorErr := DecodeAuditCursor(query)
+	if cursorErr != nil {
+		err = cursorErr
+		return
+	}
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{
+		{"time", -1},
+		{"_id", -1},
+	})
+	// one more than the limit to check if there is a next page
+	findOptions.SetLimit(query.GetLimit() + 1)
+	cur, curErr := h.Collection.Find(ctx, h.auditFilter(query, cursor), findOptions)
+	if curErr != nil {
+		err = curErr
+		return
+	}
+	// takes care of closing the cursor
+	defer func() {
+		closeErr := cur.Close(ctx)
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			res = nil
+		}
+	}()
+	entries := make([]*AuditEntryModel, 0, query.GetLimit()+1)
+	for cur.Next(ctx) {
+		next := EmptyAuditEntryModel()
+		err = cur.Decode(next)
+		if err != nil {
+			return
+		}
+		entries = append(entries, next)
+	}
+	err = cur.Err()
+	if err != nil {
+		return
+	}
+	res, err = NewAuditPage(query, entries)
+	return
+}
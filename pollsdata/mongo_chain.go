@@ -0,0 +1,206 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/FabianWe/pollsweb"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// MongoChainAppendAttempts is the number of times an entry is appended to a chain if another entry with the same
+// sequence number was appended concurrently. In a transaction the entry is not appended again, the whole
+// transaction is retried instead.
+const MongoChainAppendAttempts = 5
+
+// MongoChainHandler stores the hash chains of all meetings in a collection, entries are only ever inserted.
+// The unique index on the meeting id and sequence number makes sure that a chain doesn't fork.
+type MongoChainHandler struct {
+	Collection *mongo.Collection
+	// Clock is used to set the time of chain entries
+	Clock pollsweb.Clock
+}
+
+func NewMongoChainHandler(collection *mongo.Collection) *MongoChainHandler {
+	return &MongoChainHandler{
+		Collection: collection,
+		Clock:      pollsweb.NewSystemClock(),
+	}
+}
+
+func (h *MongoChainHandler) CreateIndexes(ctx context.Context) ([]string, error) {
+	indexes := []mongo.IndexModel{h.meetingSequenceIndex()}
+	return h.Collection.Indexes().CreateMany(ctx, indexes, options.CreateIndexes())
+}
+
+func (h *MongoChainHandler) meetingSequenceIndex() mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys: bson.D{
+			{"meetingid", 1},
+			{"sequence", 1},
+		},
+		Options: options.Index().SetUnique(true),
+	}
+}
+
+// chainHead returns the last entry of the chain of the meeting, nil if the chain is empty.
+func (h *MongoChainHandler) chainHead(ctx context.Context, meetingId uuid.UUID) (*ChainEntryModel, error) {
+	findOptions := options.FindOne()
+	findOptions.SetSort(bson.D{
+		{"sequence", -1},
+	})
+	res := EmptyChainEntryModel()
+	err := h.Collection.FindOne(ctx, bson.M{"meetingid": meetingId}, findOptions).Decode(res)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// appendChain appends the records to the chain of the meeting, see appendChainRecord.
+func (h *MongoChainHandler) appendChain(ctx context.Context, meetingId uuid.UUID, records []*ChainRecord) error {
+	now := h.Clock.Now()
+	for _, record := range records {
+		if err := h.appendChainRecord(ctx, meetingId, now, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendChainRecord appends a record to the chain of the meeting. If another entry was appended since the head of
+// the chain was read the unique index is violated, in this case the head is read again (at most
+// MongoChainAppendAttempts times).
+//
+// If ctx is the context of a transaction (see MongoDataHandler.withTransaction) the error is returned without
+// retrying: the transaction is aborted by the error and session.WithTransaction retries the whole transaction.
+func (h *MongoChainHandler) appendChainRecord(ctx context.Context, meetingId uuid.UUID, now time.Time, record *ChainRecord) error {
+	attempts := MongoChainAppendAttempts
+	if _, inTransaction := ctx.(mongo.SessionContext); inTransaction {
+		attempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		head, headErr := h.chainHead(ctx, meetingId)
+		if headErr != nil {
+			return headErr
+		}
+		entry := NewChainEntryModel(head, meetingId, now, record)
+		objectId, uuidErr := pollsweb.GenUUID()
+		if uuidErr != nil {
+			return uuidErr
+		}
+		entry.Id = objectId
+		_, insertErr := h.Collection.InsertOne(ctx, entry)
+		insertErr = mongoDuplicateKeyError(insertErr, chainEntryModelType, nil)
+		var duplicate DuplicateEntryError
+		if insertErr == nil || !errors.As(insertErr, &duplicate) || attempt >= attempts {
+			return insertErr
+		}
+	}
+}
+
+// importChainEntry inserts the entry with its id and sequence number, it returns false if the entry is already stored.
+// Another entry with the same meeting and sequence number is a DuplicateEntryError.
+func (h *MongoChainHandler) importChainEntry(ctx context.Context, entry *ChainEntryModel) (bool, error) {
+	existing := EmptyChainEntryModel()
+	findErr := h.Collection.FindOne(ctx, bson.M{"meetingid": entry.MeetingId, "sequence": entry.Sequence}).Decode(existing)
+	switch {
+	case findErr == nil:
+		if existing.Id != entry.Id {
+			return false, NewDuplicateEntryError(chainEntryModelType, "sequence", fmt.Sprintf("%s/%d", entry.MeetingId, entry.Sequence))
+		}
+		return false, nil
+	case !errors.Is(findErr, mongo.ErrNoDocuments):
+		return false, findErr
+	}
+	_, insertErr := h.Collection.InsertOne(ctx, entry)
+	return insertErr == nil, mongoDuplicateKeyError(insertErr, chainEntryModelType, nil)
+}
+
+func (h *MongoChainHandler) GetChainMeetingIds(ctx context.Context) (res []uuid.UUID, err error) {
+	pipeline := mongo.Pipeline{
+		{{"$group", bson.D{{"_id", "$meetingid"}}}},
+		{{"$sort", bson.D{{"_id", 1}}}},
+	}
+	cur, curErr := h.Collection.Aggregate(ctx, pipeline)
+	if curErr != nil {
+		err = curErr
+		return
+	}
+	// takes care of closing the cursor
+	defer func() {
+		closeErr := cur.Close(ctx)
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			res = nil
+		}
+	}()
+	res = make([]uuid.UUID, 0)
+	for cur.Next(ctx) {
+		var next struct {
+			MeetingId uuid.UUID `bson:"_id"`
+		}
+		if err = cur.Decode(&next); err != nil {
+			return
+		}
+		res = append(res, next.MeetingId)
+	}
+	err = cur.Err()
+	return
+}
+
+func (h *MongoChainHandler) GetChain(ctx context.Context, meetingId uuid.UUID) (res []*ChainEntryModel, err error) {
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{
+		{"sequence", 1},
+	})
+	cur, curErr := h.Collection.Find(ctx, bson.M{"meetingid": meetingId}, findOptions)
+	if curErr != nil {
+		err = curErr
+		return
+	}
+	// takes care of closing the cursor
+	defer func() {
+		closeErr := cur.Close(ctx)
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			res = nil
+		}
+	}()
+	res = make([]*ChainEntryModel, 0)
+	for cur.Next(ctx) {
+		next := EmptyChainEntryModel()
+		err = cur.Decode(next)
+		if err != nil {
+			return
+		}
+		res = append(res, next)
+	}
+	err = cur.Err()
+	return
+}
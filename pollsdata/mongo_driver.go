@@ -0,0 +1,310 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MongoStorageDriverName is the name of the mongodb storage driver, its config section is "mongodb".
+const MongoStorageDriverName = "mongo"
+
+func init() {
+	RegisterStorageDriver(&StorageDriver{
+		Name:      MongoStorageDriverName,
+		ConfigKey: "mongodb",
+		NewConfig: func() interface{} {
+			return NewMongoConfig()
+		},
+		Open: func(ctx context.Context, config interface{}) (DataHandler, error) {
+			handler, err := ConnectMongo(ctx, config.(*MongoConfig))
+			if err != nil {
+				return nil, err
+			}
+			return handler, nil
+		},
+	})
+}
+
+// MongoConfig describes the connection to the mongodb server.
+//
+// If URI is set it is used as the base of the connection, otherwise the URI is built from Host and Port. All other
+// options are applied on top of the URI and overwrite the options from the URI.
+//
+// Credentials don't need to be part of the config file: The user name and password can be read from a file
+// (UserNameFile, PasswordFile) or an environment variable (UserNameEnv, PasswordEnv), see ResolveCredentials.
+type MongoConfig struct {
+	URI          string
+	UserName     string `mapstructure:"username"`
+	UserNameFile string `mapstructure:"username_file"`
+	UserNameEnv  string `mapstructure:"username_env"`
+	Password     string
+	PasswordFile string `mapstructure:"password_file"`
+	PasswordEnv  string `mapstructure:"password_env"`
+	Host         string
+	Port         int
+	// AuthSource is the database the user is defined in, the driver defaults to "admin"
+	AuthSource string `mapstructure:"auth_source"`
+	ReplicaSet string `mapstructure:"replica_set"`
+	// TLS enables TLS, it is enabled implicitly if one of the TLS files is set
+	TLS         bool
+	TLSCAFile   string `mapstructure:"tls_ca_file"`
+	TLSCertFile string `mapstructure:"tls_cert_file"`
+	TLSKeyFile  string `mapstructure:"tls_key_file"`
+	// MaxPoolSize is the maximal number of connections to the server, 0 means the driver default
+	MaxPoolSize uint64 `mapstructure:"max_pool_size"`
+	// ReadPreference is one of "primary", "primaryPreferred", "secondary", "secondaryPreferred" or "nearest"
+	ReadPreference string `mapstructure:"read_preference"`
+	// WriteConcern is "majority", the number of nodes that must acknowledge a write or the name of a tag set
+	WriteConcern        string
+	WriteConcernJournal bool          `mapstructure:"write_concern_journal"`
+	WriteConcernTimeout time.Duration `mapstructure:"write_concern_timeout"`
+	ConnectTimeout      time.Duration `mapstructure:"connect_timeout"`
+	Database            string
+}
+
+func NewMongoConfig() *MongoConfig {
+	return &MongoConfig{
+		URI:                 "",
+		UserName:            "",
+		UserNameFile:        "",
+		UserNameEnv:         "",
+		Password:            "",
+		PasswordFile:        "",
+		PasswordEnv:         "",
+		Host:                "localhost",
+		Port:                27017,
+		AuthSource:          "",
+		ReplicaSet:          "",
+		TLS:                 false,
+		TLSCAFile:           "",
+		TLSCertFile:         "",
+		TLSKeyFile:          "",
+		MaxPoolSize:         0,
+		ReadPreference:      "",
+		WriteConcern:        "",
+		WriteConcernJournal: false,
+		WriteConcernTimeout: 0,
+		ConnectTimeout:      time.Second * 10,
+		Database:            "gopolls",
+	}
+}
+
+// GetMongoURI returns the connection string for a single mongodb server.
+//
+// Username and password are escaped the way the driver unescapes them, so they may contain characters like "@" or ":".
+func GetMongoURI(username, password, host string, port int) string {
+	uri := "mongodb://"
+
+	if username != "" || password != "" {
+		uri += fmt.Sprintf("%s:%s@", url.QueryEscape(username), url.QueryEscape(password))
+	}
+	uri += net.JoinHostPort(host, strconv.Itoa(port))
+	return uri
+}
+
+// readConfigSecret returns the content of file (without surrounding whitespace) if file is not empty, the value of the
+// environment variable env if env is not empty and value otherwise.
+func readConfigSecret(value, file, env string) (string, error) {
+	switch {
+	case file != "":
+		content, readErr := ioutil.ReadFile(file)
+		if readErr != nil {
+			return "", readErr
+		}
+		return strings.TrimSpace(string(content)), nil
+	case env != "":
+		envValue, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", env)
+		}
+		return envValue, nil
+	default:
+		return value, nil
+	}
+}
+
+// ResolveCredentials returns the user name and password from the config, reading them from a file or an environment
+// variable if configured.
+func (config *MongoConfig) ResolveCredentials() (username, password string, err error) {
+	username, err = readConfigSecret(config.UserName, config.UserNameFile, config.UserNameEnv)
+	if err != nil {
+		err = fmt.Errorf("can't read mongodb user name: %w", err)
+		return
+	}
+	password, err = readConfigSecret(config.Password, config.PasswordFile, config.PasswordEnv)
+	if err != nil {
+		err = fmt.Errorf("can't read mongodb password: %w", err)
+		return
+	}
+	return
+}
+
+// tlsConfig returns the TLS configuration, nil if TLS is not enabled.
+func (config *MongoConfig) tlsConfig() (*tls.Config, error) {
+	if !config.TLS && config.TLSCAFile == "" && config.TLSCertFile == "" && config.TLSKeyFile == "" {
+		return nil, nil
+	}
+	res := &tls.Config{}
+	if config.TLSCAFile != "" {
+		caCert, readErr := ioutil.ReadFile(config.TLSCAFile)
+		if readErr != nil {
+			return nil, fmt.Errorf("can't read mongodb CA file: %w", readErr)
+		}
+		res.RootCAs = x509.NewCertPool()
+		if !res.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in mongodb CA file %s", config.TLSCAFile)
+		}
+	}
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		return nil, errors.New("tls_cert_file and tls_key_file must be set together")
+	}
+	if config.TLSCertFile != "" {
+		cert, certErr := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+		if certErr != nil {
+			return nil, fmt.Errorf("can't load mongodb client certificate: %w", certErr)
+		}
+		res.Certificates = []tls.Certificate{cert}
+	}
+	return res, nil
+}
+
+// writeConcern returns the write concern, nil if none is configured.
+func (config *MongoConfig) writeConcern() *writeconcern.WriteConcern {
+	if config.WriteConcern == "" && !config.WriteConcernJournal && config.WriteConcernTimeout == 0 {
+		return nil
+	}
+	concernOptions := make([]writeconcern.Option, 0, 3)
+	if config.WriteConcern == "majority" {
+		concernOptions = append(concernOptions, writeconcern.WMajority())
+	} else if w, wErr := strconv.Atoi(config.WriteConcern); wErr == nil {
+		concernOptions = append(concernOptions, writeconcern.W(w))
+	} else if config.WriteConcern != "" {
+		concernOptions = append(concernOptions, writeconcern.WTagSet(config.WriteConcern))
+	}
+	if config.WriteConcernJournal {
+		concernOptions = append(concernOptions, writeconcern.J(true))
+	}
+	if config.WriteConcernTimeout > 0 {
+		concernOptions = append(concernOptions, writeconcern.WTimeout(config.WriteConcernTimeout))
+	}
+	return writeconcern.New(concernOptions...)
+}
+
+// ClientOptions returns the options used to connect to the server.
+func (config *MongoConfig) ClientOptions() (*options.ClientOptions, error) {
+	uri := config.URI
+	if uri == "" {
+		uri = GetMongoURI("", "", config.Host, config.Port)
+	}
+	clientOptions := options.Client().ApplyURI(uri).SetConnectTimeout(config.ConnectTimeout)
+	if uriErr := clientOptions.Validate(); uriErr != nil {
+		return nil, uriErr
+	}
+	username, password, credentialsErr := config.ResolveCredentials()
+	if credentialsErr != nil {
+		return nil, credentialsErr
+	}
+	if username != "" || password != "" || config.AuthSource != "" {
+		var credential options.Credential
+		if clientOptions.Auth != nil {
+			credential = *clientOptions.Auth
+		}
+		if username != "" {
+			credential.Username = username
+		}
+		if password != "" {
+			credential.Password = password
+			credential.PasswordSet = true
+		}
+		if config.AuthSource != "" {
+			credential.AuthSource = config.AuthSource
+		}
+		if credential.Username == "" {
+			return nil, errors.New("mongodb credentials require a user name")
+		}
+		clientOptions.SetAuth(credential)
+	}
+	if config.ReplicaSet != "" {
+		clientOptions.SetReplicaSet(config.ReplicaSet)
+	}
+	tlsConfig, tlsErr := config.tlsConfig()
+	if tlsErr != nil {
+		return nil, tlsErr
+	}
+	if tlsConfig != nil {
+		clientOptions.SetTLSConfig(tlsConfig)
+	}
+	if config.MaxPoolSize > 0 {
+		clientOptions.SetMaxPoolSize(config.MaxPoolSize)
+	}
+	if config.ReadPreference != "" {
+		mode, modeErr := readpref.ModeFromString(config.ReadPreference)
+		if modeErr != nil {
+			return nil, fmt.Errorf("invalid mongodb read preference: %w", modeErr)
+		}
+		readPref, readPrefErr := readpref.New(mode)
+		if readPrefErr != nil {
+			return nil, readPrefErr
+		}
+		clientOptions.SetReadPreference(readPref)
+	}
+	if writeConcern := config.writeConcern(); writeConcern != nil {
+		clientOptions.SetWriteConcern(writeConcern)
+	}
+	return clientOptions, nil
+}
+
+// ConnectMongo connects to the mongodb server from the config and returns a handler for the configured database.
+func ConnectMongo(ctx context.Context, config *MongoConfig) (*MongoDataHandler, error) {
+	clientOptions, optionsErr := config.ClientOptions()
+	if optionsErr != nil {
+		return nil, optionsErr
+	}
+	mongoClient, connectErr := mongo.Connect(ctx, clientOptions)
+	if connectErr != nil {
+		return nil, connectErr
+	}
+	pingErr := mongoClient.Ping(ctx, nil)
+	if pingErr != nil {
+		_ = mongoClient.Disconnect(ctx)
+		return nil, pingErr
+	}
+	return NewMongoDataHandler(mongoClient, config.Database), nil
+}
+
+// PendingMigrations returns the number of migrations that are not applied yet, see Migrator.
+func (h *MongoDataHandler) PendingMigrations(ctx context.Context) (int, error) {
+	pending, err := h.Migrator().Pending(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return len(pending), nil
+}
@@ -0,0 +1,408 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/FabianWe/pollsweb"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sort"
+	"time"
+)
+
+// MongoMigrationsCollection is the name of the collection in which applied migrations are recorded.
+const MongoMigrationsCollection = "migrations"
+
+// mongoNamespaceExistsCode is the error code returned by the "create" command if the collection already exists.
+const mongoNamespaceExistsCode = 48
+
+// MongoMigration is a versioned change of the documents stored in mongodb.
+//
+// Migrations are applied in the order of their version and are recorded in the migrations collection once they're
+// applied. Apply must be idempotent: a migration that was interrupted before it was recorded is applied again.
+// The clock is the clock of the migrator.
+type MongoMigration struct {
+	Version     int
+	Description string
+	Apply       func(ctx context.Context, database *mongo.Database, clock pollsweb.Clock) error
+}
+
+// MongoMigrationRecord is the document stored in the migrations collection for each applied migration.
+type MongoMigrationRecord struct {
+	Version     int `bson:"_id"`
+	Description string
+	Applied     time.Time
+}
+
+// MongoMigrationStatus describes if a migration is applied, Applied is the zero time if it is still pending.
+type MongoMigrationStatus struct {
+	Migration *MongoMigration
+	Applied   time.Time
+}
+
+// IsApplied returns true if the migration was applied.
+func (status *MongoMigrationStatus) IsApplied() bool {
+	return !status.Applied.IsZero()
+}
+
+// DefaultMongoMigrations are all migrations of the mongo schema, sorted by version.
+// New migrations must be appended with a new version, existing migrations must never be changed.
+var DefaultMongoMigrations = []*MongoMigration{
+	{
+		Version:     1,
+		Description: "reference periods by id instead of slug in meetings, restore missing periods",
+		Apply:       migrateMeetingPeriodIds,
+	},
+	{
+		Version:     2,
+		Description: "set the state of polls without a state, published for past meetings and polls with votes",
+		Apply:       migratePollStates,
+	},
+	{
+		Version:     3,
+		Description: "link polls, votes and audit entries stored before hash chains into the chains",
+		Apply:       migrateLinkChains,
+	},
+}
+
+// RestoredPeriodName returns the name of the placeholder period that migrateMeetingPeriodIds creates for meetings
+// of a period that doesn't exist anymore.
+func RestoredPeriodName(slug string) string {
+	return fmt.Sprintf("Restored period %s", slug)
+}
+
+// restoreMissingPeriods creates a placeholder period for each slug that is referenced by a meeting (in the field
+// "period") but doesn't exist: before meetings referenced periods by id a period could be deleted while it still had
+// meetings.
+// The placeholder is archived, has the slug of the deleted period, the name RestoredPeriodName and spans the meeting
+// times of its meetings. It has no voters.
+func restoreMissingPeriods(ctx context.Context, database *mongo.Database, clock pollsweb.Clock) (err error) {
+	meetings := database.Collection("meetings")
+	periods := database.Collection("periodsettings")
+	pipeline := mongo.Pipeline{
+		{{"$match", bson.D{{"period", bson.D{{"$exists", true}}}}}},
+		{{"$group", bson.D{
+			{"_id", "$period"},
+			{"start", bson.D{{"$min", "$meetingtime"}}},
+			{"end", bson.D{{"$max", "$meetingtime"}}},
+		}}},
+	}
+	cur, curErr := meetings.Aggregate(ctx, pipeline)
+	if curErr != nil {
+		return curErr
+	}
+	defer func() {
+		closeErr := cur.Close(ctx)
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	for cur.Next(ctx) {
+		var referenced struct {
+			Slug  string `bson:"_id"`
+			Start time.Time
+			End   time.Time
+		}
+		if err = cur.Decode(&referenced); err != nil {
+			return
+		}
+		count, countErr := periods.CountDocuments(ctx, bson.D{{"slug", referenced.Slug}})
+		if countErr != nil {
+			err = countErr
+			return
+		}
+		if count > 0 {
+			continue
+		}
+		start := referenced.Start.UTC()
+		template := NewMeetingTimeTemplateModel(start.Weekday(), uint8(start.Hour()), uint8(start.Minute()))
+		// the end must be after the start, also if there is only one meeting
+		placeholder := NewPeriodSettingsModel(clock, RestoredPeriodName(referenced.Slug), referenced.Slug, template,
+			nil, start, referenced.End.Add(24*time.Hour))
+		placeholder.Archived = clock.Now()
+		if placeholder.Id, err = pollsweb.GenUUID(); err != nil {
+			return
+		}
+		if _, err = periods.InsertOne(ctx, placeholder); err != nil {
+			return
+		}
+	}
+	err = cur.Err()
+	return
+}
+
+// migrateMeetingPeriodIds replaces the field "period" (the slug of the period) of meetings by "periodid".
+// Meetings that reference a period that doesn't exist are moved to a placeholder period, see restoreMissingPeriods.
+func migrateMeetingPeriodIds(ctx context.Context, database *mongo.Database, clock pollsweb.Clock) (err error) {
+	if err = restoreMissingPeriods(ctx, database, clock); err != nil {
+		return
+	}
+	meetings := database.Collection("meetings")
+	periods := database.Collection("periodsettings")
+	filter := bson.D{{"period", bson.D{{"$exists", true}}}}
+	cur, curErr := meetings.Find(ctx, filter, options.Find().SetProjection(bson.D{{"period", 1}}))
+	if curErr != nil {
+		return curErr
+	}
+	defer func() {
+		closeErr := cur.Close(ctx)
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	for cur.Next(ctx) {
+		var meeting struct {
+			Id     uuid.UUID `bson:"_id"`
+			Period string
+		}
+		if err = cur.Decode(&meeting); err != nil {
+			return
+		}
+		var period struct {
+			Id uuid.UUID `bson:"_id"`
+		}
+		if err = periods.FindOne(ctx, bson.D{{"slug", meeting.Period}}).Decode(&period); err != nil {
+			return
+		}
+		_, err = meetings.UpdateOne(ctx,
+			bson.D{{"_id", meeting.Id}},
+			bson.D{
+				{"$set", bson.D{{"periodid", period.Id}}},
+				{"$unset", bson.D{{"period", ""}}},
+			})
+		if err != nil {
+			return
+		}
+	}
+	err = cur.Err()
+	return
+}
+
+// migratePollStates sets the state of all polls that were stored before poll states were introduced.
+// Polls that already have votes or belong to a meeting that has taken place (before the time of the clock) are
+// published with the meeting time as publishing time, this way their results stay visible. Only the polls of future
+// meetings without votes become drafts.
+func migratePollStates(ctx context.Context, database *mongo.Database, clock pollsweb.Clock) (err error) {
+	meetings := database.Collection("meetings")
+	filter := bson.D{{"groups.polls.state", bson.D{{"$in", bson.A{"", nil}}}}}
+	projection := bson.D{{"meetingtime", 1}, {"groups.polls.state", 1}, {"groups.polls.votes", 1}}
+	cur, curErr := meetings.Find(ctx, filter, options.Find().SetProjection(projection))
+	if curErr != nil {
+		return curErr
+	}
+	defer func() {
+		closeErr := cur.Close(ctx)
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	now := clock.Now()
+	for cur.Next(ctx) {
+		var meeting struct {
+			Id          uuid.UUID `bson:"_id"`
+			MeetingTime time.Time
+			Groups      []struct {
+				Polls []struct {
+					// nil if the state is null or missing
+					State *string
+					Votes []bson.Raw
+				}
+			}
+		}
+		if err = cur.Decode(&meeting); err != nil {
+			return
+		}
+		set := bson.D{}
+		for i, group := range meeting.Groups {
+			for j, poll := range group.Polls {
+				if poll.State != nil && *poll.State != "" {
+					continue
+				}
+				prefix := fmt.Sprintf("groups.%d.polls.%d.", i, j)
+				if len(poll.Votes) > 0 || meeting.MeetingTime.Before(now) {
+					set = append(set,
+						bson.E{Key: prefix + "state", Value: PollStatePublished},
+						bson.E{Key: prefix + "published", Value: meeting.MeetingTime})
+				} else {
+					set = append(set, bson.E{Key: prefix + "state", Value: PollStateDraft})
+				}
+			}
+		}
+		if len(set) == 0 {
+			continue
+		}
+		if _, err = meetings.UpdateOne(ctx, bson.D{{"_id", meeting.Id}}, bson.D{{"$set", set}}); err != nil {
+			return
+		}
+	}
+	err = cur.Err()
+	return
+}
+
+// migrateLinkChains links the poll definitions, votes and audit entries of all meetings that are not linked into the
+// chain of their meeting, see LinkAllUnchainedRecords.
+func migrateLinkChains(ctx context.Context, database *mongo.Database, clock pollsweb.Clock) error {
+	handler := NewMongoDataHandler(database.Client(), database.Name())
+	handler.SetClock(clock)
+	_, err := LinkAllUnchainedRecords(ctx, handler)
+	return err
+}
+
+// MongoMigrator applies the migrations to a database and records them in the migrations collection.
+type MongoMigrator struct {
+	Database   *mongo.Database
+	Collection *mongo.Collection
+	Migrations []*MongoMigration
+	Clock      pollsweb.Clock
+}
+
+// NewMongoMigrator returns a migrator for DefaultMongoMigrations.
+func NewMongoMigrator(database *mongo.Database) *MongoMigrator {
+	return &MongoMigrator{
+		Database:   database,
+		Collection: database.Collection(MongoMigrationsCollection),
+		Migrations: DefaultMongoMigrations,
+		Clock:      pollsweb.NewSystemClock(),
+	}
+}
+
+func (m *MongoMigrator) appliedMigrations(ctx context.Context) (res map[int]*MongoMigrationRecord, err error) {
+	cur, curErr := m.Collection.Find(ctx, bson.D{})
+	if curErr != nil {
+		err = curErr
+		return
+	}
+	// takes care of closing the cursor
+	defer func() {
+		closeErr := cur.Close(ctx)
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			res = nil
+		}
+	}()
+	res = make(map[int]*MongoMigrationRecord)
+	for cur.Next(ctx) {
+		var record MongoMigrationRecord
+		err = cur.Decode(&record)
+		if err != nil {
+			return
+		}
+		res[record.Version] = &record
+	}
+	err = cur.Err()
+	return
+}
+
+// Status returns the status of all migrations sorted by version.
+func (m *MongoMigrator) Status(ctx context.Context) ([]*MongoMigrationStatus, error) {
+	applied, appliedErr := m.appliedMigrations(ctx)
+	if appliedErr != nil {
+		return nil, appliedErr
+	}
+	res := make([]*MongoMigrationStatus, len(m.Migrations))
+	for i, migration := range m.Migrations {
+		status := &MongoMigrationStatus{Migration: migration}
+		if record, ok := applied[migration.Version]; ok {
+			status.Applied = record.Applied
+		}
+		res[i] = status
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Migration.Version < res[j].Migration.Version
+	})
+	return res, nil
+}
+
+// Pending returns all migrations that are not applied yet sorted by version.
+func (m *MongoMigrator) Pending(ctx context.Context) ([]*MongoMigration, error) {
+	status, statusErr := m.Status(ctx)
+	if statusErr != nil {
+		return nil, statusErr
+	}
+	res := make([]*MongoMigration, 0, len(status))
+	for _, migrationStatus := range status {
+		if !migrationStatus.IsApplied() {
+			res = append(res, migrationStatus.Migration)
+		}
+	}
+	return res, nil
+}
+
+// Migrate applies all pending migrations and returns the applied migrations.
+// If a migration fails the migrations applied before are still recorded and returned together with the error.
+func (m *MongoMigrator) Migrate(ctx context.Context) ([]*MongoMigration, error) {
+	pending, pendingErr := m.Pending(ctx)
+	if pendingErr != nil {
+		return nil, pendingErr
+	}
+	res := make([]*MongoMigration, 0, len(pending))
+	for _, migration := range pending {
+		if applyErr := migration.Apply(ctx, m.Database, m.Clock); applyErr != nil {
+			return res, fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Description, applyErr)
+		}
+		if recordErr := m.record(ctx, migration); recordErr != nil {
+			return res, recordErr
+		}
+		res = append(res, migration)
+	}
+	return res, nil
+}
+
+// record stores the migration as applied at the current time of the clock.
+func (m *MongoMigrator) record(ctx context.Context, migration *MongoMigration) error {
+	record := MongoMigrationRecord{
+		Version:     migration.Version,
+		Description: migration.Description,
+		Applied:     m.Clock.Now(),
+	}
+	// upsert in case another process applied the same migration concurrently
+	_, err := m.Collection.ReplaceOne(ctx, bson.D{{"_id", migration.Version}}, record,
+		options.Replace().SetUpsert(true))
+	return err
+}
+
+// MarkApplied records all pending migrations as applied without applying them and returns them.
+// This should only be used for a new database that doesn't contain any documents that could be migrated.
+func (m *MongoMigrator) MarkApplied(ctx context.Context) ([]*MongoMigration, error) {
+	pending, pendingErr := m.Pending(ctx)
+	if pendingErr != nil {
+		return nil, pendingErr
+	}
+	res := make([]*MongoMigration, 0, len(pending))
+	for _, migration := range pending {
+		if recordErr := m.record(ctx, migration); recordErr != nil {
+			return res, recordErr
+		}
+		res = append(res, migration)
+	}
+	return res, nil
+}
+
+// createCollection creates a collection, it does nothing if the collection already exists.
+func createCollection(ctx context.Context, database *mongo.Database, name string) (bool, error) {
+	err := database.RunCommand(ctx, bson.D{{"create", name}}).Err()
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && commandErr.Code == mongoNamespaceExistsCode {
+		return false, nil
+	}
+	return err == nil, err
+}
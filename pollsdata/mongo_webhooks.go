@@ -0,0 +1,256 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"context"
+	"errors"
+	"github.com/FabianWe/pollsweb"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"time"
+)
+
+type MongoWebhooksHandler struct {
+	Collection         *mongo.Collection
+	DeliveryCollection *mongo.Collection
+	// Clock is used to set the creation time of webhooks and the time of deliveries if they're not set
+	Clock pollsweb.Clock
+}
+
+func NewMongoWebhooksHandler(collection, deliveryCollection *mongo.Collection) *MongoWebhooksHandler {
+	return &MongoWebhooksHandler{
+		Collection:         collection,
+		DeliveryCollection: deliveryCollection,
+		Clock:              pollsweb.NewSystemClock(),
+	}
+}
+
+func (h *MongoWebhooksHandler) CreateIndexes(ctx context.Context) ([]string, error) {
+	webhookIndexes := []mongo.IndexModel{h.eventsIndex()}
+	res, err := h.Collection.Indexes().CreateMany(ctx, webhookIndexes, options.CreateIndexes())
+	if err != nil {
+		return res, err
+	}
+	deliveryIndexes := []mongo.IndexModel{h.deliveryWebhookTimeIndex(), h.deliveryRetryAtIndex()}
+	deliveryRes, deliveryErr := h.DeliveryCollection.Indexes().CreateMany(ctx, deliveryIndexes, options.CreateIndexes())
+	return append(res, deliveryRes...), deliveryErr
+}
+
+func (h *MongoWebhooksHandler) eventsIndex() mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys: bson.D{
+			{"events", 1},
+		},
+		Options: options.Index(),
+	}
+}
+
+func (h *MongoWebhooksHandler) deliveryWebhookTimeIndex() mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys: bson.D{
+			{"webhookid", 1},
+			{"time", -1},
+		},
+		Options: options.Index(),
+	}
+}
+
+func (h *MongoWebhooksHandler) deliveryRetryAtIndex() mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys: bson.D{
+			{"retryat", 1},
+		},
+		Options: options.Index(),
+	}
+}
+
+func (h *MongoWebhooksHandler) InsertWebhook(ctx context.Context, webhook *WebhookModel) (uuid.UUID, error) {
+	objectId, uuidErr := pollsweb.GenUUID()
+	if uuidErr != nil {
+		return objectId, uuidErr
+	}
+	webhook.Id = objectId
+	if webhook.Created.IsZero() {
+		webhook.Created = h.Clock.Now()
+	}
+	_, insertErr := h.Collection.InsertOne(ctx, webhook)
+	return objectId, insertErr
+}
+
+func (h *MongoWebhooksHandler) GetWebhook(ctx context.Context, id uuid.UUID) (*WebhookModel, error) {
+	modelInstance := EmptyWebhookModel()
+	err := h.Collection.FindOne(ctx, bson.M{"_id": id}).Decode(modelInstance)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, NewEntryNotFoundError(webhookModelType, reflect.ValueOf(id), err)
+		}
+		return nil, err
+	}
+	return modelInstance, nil
+}
+
+func (h *MongoWebhooksHandler) GetWebhooks(ctx context.Context, event string) (res []*WebhookModel, err error) {
+	filter := bson.D{}
+	if event != "" {
+		filter = bson.D{
+			{"events", event},
+			{"active", true},
+		}
+	}
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{
+		{"created", 1},
+	})
+	cur, curErr := h.Collection.Find(ctx, filter, findOptions)
+	if curErr != nil {
+		err = curErr
+		return
+	}
+	// takes care of closing the cursor
+	defer func() {
+		closeErr := cur.Close(ctx)
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			res = nil
+		}
+	}()
+	res = make([]*WebhookModel, 0)
+	for cur.Next(ctx) {
+		next := EmptyWebhookModel()
+		err = cur.Decode(next)
+		if err != nil {
+			return
+		}
+		res = append(res, next)
+	}
+	err = cur.Err()
+	return
+}
+
+func (h *MongoWebhooksHandler) DeleteWebhook(ctx context.Context, id uuid.UUID) (int64, error) {
+	deleteRes, deleteErr := h.Collection.DeleteOne(ctx, bson.M{"_id": id}, options.Delete())
+	if deleteErr != nil {
+		return -1, deleteErr
+	}
+	// the delivery history is not needed any more
+	if _, deliveriesErr := h.DeliveryCollection.DeleteMany(ctx, bson.M{"webhookid": id}, options.Delete()); deliveriesErr != nil {
+		return deleteRes.DeletedCount, deliveriesErr
+	}
+	return deleteRes.DeletedCount, nil
+}
+
+func (h *MongoWebhooksHandler) InsertWebhookDelivery(ctx context.Context, delivery *WebhookDeliveryModel) (uuid.UUID, error) {
+	objectId, uuidErr := pollsweb.GenUUID()
+	if uuidErr != nil {
+		return objectId, uuidErr
+	}
+	delivery.Id = objectId
+	if delivery.Time.IsZero() {
+		delivery.Time = h.Clock.Now()
+	}
+	_, insertErr := h.DeliveryCollection.InsertOne(ctx, delivery)
+	return objectId, insertErr
+}
+
+func (h *MongoWebhooksHandler) GetWebhookDeliveries(ctx context.Context, webhookId uuid.UUID, limit int64) (res []*WebhookDeliveryModel, err error) {
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{
+		{"time", -1},
+	})
+	if limit > 0 {
+		findOptions.SetLimit(limit)
+	}
+	cur, curErr := h.DeliveryCollection.Find(ctx, bson.M{"webhookid": webhookId}, findOptions)
+	if curErr != nil {
+		err = curErr
+		return
+	}
+	// takes care of closing the cursor
+	defer func() {
+		closeErr := cur.Close(ctx)
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			res = nil
+		}
+	}()
+	res = make([]*WebhookDeliveryModel, 0)
+	for cur.Next(ctx) {
+		next := EmptyWebhookDeliveryModel()
+		err = cur.Decode(next)
+		if err != nil {
+			return
+		}
+		res = append(res, next)
+	}
+	err = cur.Err()
+	return
+}
+
+func (h *MongoWebhooksHandler) GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int64) (res []*WebhookDeliveryModel, err error) {
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{
+		{"retryat", 1},
+	})
+	if limit > 0 {
+		findOptions.SetLimit(limit)
+	}
+	// no retry is pending if retryat is the zero time
+	filter := bson.M{"retryat": bson.M{"$gt": time.Time{}, "$lte": now}}
+	cur, curErr := h.DeliveryCollection.Find(ctx, filter, findOptions)
+	if curErr != nil {
+		err = curErr
+		return
+	}
+	// takes care of closing the cursor
+	defer func() {
+		closeErr := cur.Close(ctx)
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			res = nil
+		}
+	}()
+	res = make([]*WebhookDeliveryModel, 0)
+	for cur.Next(ctx) {
+		next := EmptyWebhookDeliveryModel()
+		err = cur.Decode(next)
+		if err != nil {
+			return
+		}
+		res = append(res, next)
+	}
+	err = cur.Err()
+	return
+}
+
+func (h *MongoWebhooksHandler) ClaimWebhookDeliveryRetry(ctx context.Context, id uuid.UUID) (bool, error) {
+	// the filter makes sure that only one caller can claim the retry
+	filter := bson.M{"_id": id, "retryat": bson.M{"$gt": time.Time{}}}
+	update := bson.M{"$set": bson.M{"retryat": time.Time{}}}
+	updateRes, updateErr := h.DeliveryCollection.UpdateOne(ctx, filter, update)
+	if updateErr != nil {
+		return false, updateErr
+	}
+	return updateRes.ModifiedCount > 0, nil
+}
@@ -17,6 +17,7 @@ package pollsdata
 import (
 	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 	"time"
 )
@@ -85,7 +86,7 @@ type mongoMeetingModel struct {
 	Name        string
 	Slug        string
 	Created     time.Time
-	Period      string
+	PeriodId    uuid.UUID
 	MeetingTime time.Time
 	OnlineStart time.Time
 	OnlineEnd   time.Time
@@ -93,6 +94,10 @@ type mongoMeetingModel struct {
 	Groups      []*mongoPollGroupModel
 	LastUpdated time.Time
 	UpdateToken int64
+
+	NotificationsSent map[string]time.Time `bson:",omitempty"`
+	OnlineOpenedAt    time.Time
+	OnlineClosedAt    time.Time
 }
 
 func emptyMongoMeetingModel() *mongoMeetingModel {
@@ -101,7 +106,7 @@ func emptyMongoMeetingModel() *mongoMeetingModel {
 		Name:        "",
 		Slug:        "",
 		Created:     time.Time{},
-		Period:      "",
+		PeriodId:    uuid.Nil,
 		MeetingTime: time.Time{},
 		OnlineStart: time.Time{},
 		OnlineEnd:   time.Time{},
@@ -110,6 +115,10 @@ func emptyMongoMeetingModel() *mongoMeetingModel {
 		LastUpdated: time.Time{},
 		// no need to create a random here
 		UpdateToken: -1,
+
+		NotificationsSent: nil,
+		OnlineOpenedAt:    time.Time{},
+		OnlineClosedAt:    time.Time{},
 	}
 }
 
@@ -130,13 +139,24 @@ func (m *mongoMeetingModel) toMeetingModel() (*MeetingModel, error) {
 	if groupsErr != nil {
 		return nil, groupsErr
 	}
-	// create new instance with the given values
-	res := NewMeetingModel(m.Name, m.Slug, m.Period, m.MeetingTime, m.OnlineStart, m.OnlineEnd,
-		m.Voters, groups)
-	// set the id (not provided in the constructor)
-	res.IdModel = m.IdModel
-	// also set last updated and update token
-	res.LastUpdated = m.LastUpdated
-	res.UpdateToken = m.UpdateToken
+	// create new instance with the stored values, the constructor would set created to the current time
+	res := &MeetingModel{
+		IdModel:     m.IdModel,
+		Name:        m.Name,
+		Slug:        m.Slug,
+		Created:     m.Created,
+		PeriodId:    m.PeriodId,
+		MeetingTime: m.MeetingTime,
+		OnlineStart: m.OnlineStart,
+		OnlineEnd:   m.OnlineEnd,
+		Voters:      m.Voters,
+		Groups:      groups,
+		LastUpdated: m.LastUpdated,
+		UpdateToken: m.UpdateToken,
+
+		NotificationsSent: m.NotificationsSent,
+		OnlineOpenedAt:    m.OnlineOpenedAt,
+		OnlineClosedAt:    m.OnlineClosedAt,
+	}
 	return res, nil
 }
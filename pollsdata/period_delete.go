@@ -0,0 +1,86 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"fmt"
+	"github.com/FabianWe/pollsweb"
+	"github.com/google/uuid"
+)
+
+// PeriodDeleteMode describes what happens to the meetings of a period when the period is deleted, see
+// PeriodSettingsHandler.DeletePeriod.
+type PeriodDeleteMode int8
+
+const (
+	// PeriodDeleteRestrict refuses to delete a period that still has meetings, a PeriodInUseError is returned.
+	PeriodDeleteRestrict PeriodDeleteMode = iota
+	// PeriodDeleteCascade deletes the period together with all its meetings. The chains and audit entries of the
+	// meetings are kept, like with MeetingsHandler.DeleteMeeting.
+	PeriodDeleteCascade
+	// PeriodDeleteArchive doesn't delete anything, the period is marked as archived and its meetings are kept.
+	PeriodDeleteArchive
+)
+
+func (mode PeriodDeleteMode) String() string {
+	switch mode {
+	case PeriodDeleteRestrict:
+		return "restrict"
+	case PeriodDeleteCascade:
+		return "cascade"
+	case PeriodDeleteArchive:
+		return "archive"
+	default:
+		return fmt.Sprintf("PeriodDeleteMode(%d)", mode)
+	}
+}
+
+// ParsePeriodDeleteMode parses the mode from its string representation ("restrict", "cascade" or "archive").
+func ParsePeriodDeleteMode(s string) (PeriodDeleteMode, error) {
+	switch s {
+	case "restrict":
+		return PeriodDeleteRestrict, nil
+	case "cascade":
+		return PeriodDeleteCascade, nil
+	case "archive":
+		return PeriodDeleteArchive, nil
+	default:
+		return PeriodDeleteRestrict, fmt.Errorf("invalid delete mode \"%s\"", s)
+	}
+}
+
+// PeriodInUseError is returned if a period can't be deleted because meetings still reference it.
+type PeriodInUseError struct {
+	pollsweb.PollWebError
+	PeriodId    uuid.UUID
+	NumMeetings int64
+}
+
+func NewPeriodInUseError(periodId uuid.UUID, numMeetings int64) PeriodInUseError {
+	return PeriodInUseError{
+		PeriodId:    periodId,
+		NumMeetings: numMeetings,
+	}
+}
+
+func (e PeriodInUseError) Error() string {
+	return fmt.Sprintf("period %s can't be deleted, it still has %d meeting(s)", e.PeriodId, e.NumMeetings)
+}
+
+// IsArchived returns true if the period has been archived, archived periods are not returned by
+// GetActivePeriods and GetLatestPeriods.
+func (m *PeriodSettingsModel) IsArchived() bool {
+	return !m.Archived.IsZero()
+}
@@ -0,0 +1,242 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"bytes"
+	"github.com/google/uuid"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultPeriodListLimit is the number of periods on a page if PeriodListQuery.Limit is not set.
+const DefaultPeriodListLimit = 25
+
+// PeriodListQuery describes which periods are returned by PeriodSettingsHandler.ListPeriods.
+//
+// Periods are sorted by End, Start and Id (all descending), the order of LatestPeriods.
+// Name matches all periods with a name that contains Name (case insensitive), if ActiveAt is not zero only periods
+// active at that time are returned (see PeriodSettingsModel.IsActive). Archived periods are only returned if
+// IncludeArchived is true.
+//
+// Limit is the maximum number of periods on a page (DefaultPeriodListLimit if Limit <= 0), Cursor is either the
+// NextCursor or PrevCursor of another page and is empty for the first page.
+type PeriodListQuery struct {
+	Name            string
+	ActiveAt        time.Time
+	IncludeArchived bool
+	Limit           int64
+	Cursor          string
+}
+
+// NewPeriodListQuery returns a query for the first page of all periods that are not archived.
+func NewPeriodListQuery() *PeriodListQuery {
+	return &PeriodListQuery{
+		Name:            "",
+		ActiveAt:        time.Time{},
+		IncludeArchived: false,
+		Limit:           DefaultPeriodListLimit,
+		Cursor:          "",
+	}
+}
+
+func (query *PeriodListQuery) SetName(name string) *PeriodListQuery {
+	query.Name = name
+	return query
+}
+
+func (query *PeriodListQuery) SetActiveAt(referenceTime time.Time) *PeriodListQuery {
+	query.ActiveAt = referenceTime
+	return query
+}
+
+func (query *PeriodListQuery) SetIncludeArchived(includeArchived bool) *PeriodListQuery {
+	query.IncludeArchived = includeArchived
+	return query
+}
+
+func (query *PeriodListQuery) SetLimit(limit int64) *PeriodListQuery {
+	query.Limit = limit
+	return query
+}
+
+func (query *PeriodListQuery) SetCursor(cursor string) *PeriodListQuery {
+	query.Cursor = cursor
+	return query
+}
+
+// GetLimit returns the maximum number of periods on a page.
+func (query *PeriodListQuery) GetLimit() int64 {
+	if query.Limit <= 0 {
+		return DefaultPeriodListLimit
+	}
+	return query.Limit
+}
+
+// Matches returns true if the period matches all filters of the query, the cursor is ignored.
+func (query *PeriodListQuery) Matches(period *PeriodSettingsModel) bool {
+	if !query.IncludeArchived && period.IsArchived() {
+		return false
+	}
+	if !query.ActiveAt.IsZero() && !period.IsActive(query.ActiveAt) {
+		return false
+	}
+	if query.Name != "" && !strings.Contains(strings.ToLower(period.Name), strings.ToLower(query.Name)) {
+		return false
+	}
+	return true
+}
+
+// PeriodListCursor is the decoded version of PeriodListPage.NextCursor and PeriodListPage.PrevCursor.
+// It contains the sort key of the first (for Backward cursors) or last period of a page, a Backward cursor
+// selects the periods before the key, otherwise the periods after the key are selected.
+type PeriodListCursor struct {
+	End      time.Time `json:"end"`
+	Start    time.Time `json:"start"`
+	Id       uuid.UUID `json:"id"`
+	Backward bool      `json:"back,omitempty"`
+}
+
+// NewPeriodListCursor returns the cursor for the periods before (backward is true) or after the period.
+func NewPeriodListCursor(period *PeriodSettingsModel, backward bool) *PeriodListCursor {
+	return &PeriodListCursor{
+		End:      period.End,
+		Start:    period.Start,
+		Id:       period.Id,
+		Backward: backward,
+	}
+}
+
+// DecodePeriodListCursor decodes the cursor of the query, it returns nil if the query has no cursor.
+// It returns an InvalidQueryArgsError if the cursor is invalid.
+func DecodePeriodListCursor(query *PeriodListQuery) (*PeriodListCursor, error) {
+	if query.Cursor == "" {
+		return nil, nil
+	}
+	var res PeriodListCursor
+	if err := DecodeCursor(query.Cursor, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Selects returns true if the period is on the side of the cursor selected by the cursor.
+func (cursor *PeriodListCursor) Selects(period *PeriodSettingsModel) bool {
+	cmp := comparePeriods(period.End, period.Start, period.Id, cursor.End, cursor.Start, cursor.Id)
+	// periods are sorted in descending order, so the periods after the cursor are the smaller ones
+	if cursor.Backward {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+// comparePeriods compares the sort keys of two periods, the result is negative if the first key is smaller,
+// 0 if they're equal and positive otherwise.
+func comparePeriods(endA, startA time.Time, idA uuid.UUID, endB, startB time.Time, idB uuid.UUID) int {
+	if res := compareTimes(endA, endB); res != 0 {
+		return res
+	}
+	if res := compareTimes(startA, startB); res != 0 {
+		return res
+	}
+	return bytes.Compare(idA[:], idB[:])
+}
+
+// PeriodListPage is a page of periods returned by PeriodSettingsHandler.ListPeriods.
+// NextCursor and PrevCursor are the cursors for the next and previous page, they're empty if there is no such page.
+type PeriodListPage struct {
+	Periods    []*PeriodSettingsModel
+	PrevCursor string
+	NextCursor string
+}
+
+// HasPrev returns true if there is a previous page.
+func (page *PeriodListPage) HasPrev() bool {
+	return page.PrevCursor != ""
+}
+
+// HasNext returns true if there is a next page.
+func (page *PeriodListPage) HasNext() bool {
+	return page.NextCursor != ""
+}
+
+// NewPeriodListPage returns a page given the periods selected by the query and cursor (which can be nil).
+// The periods must be in the order in which they're read: descending for forward cursors, ascending (beginning with
+// the period nearest to the cursor) for backward cursors. periods may contain more elements than the limit of the
+// query, this is used to check if there are more pages. The slice is modified.
+func NewPeriodListPage(query *PeriodListQuery, cursor *PeriodListCursor, periods []*PeriodSettingsModel) (*PeriodListPage, error) {
+	limit := query.GetLimit()
+	backward := cursor != nil && cursor.Backward
+	more := int64(len(periods)) > limit
+	if more {
+		periods = periods[:limit]
+	}
+	if backward {
+		for i, j := 0, len(periods)-1; i < j; i, j = i+1, j-1 {
+			periods[i], periods[j] = periods[j], periods[i]
+		}
+	}
+	res := &PeriodListPage{
+		Periods:    periods,
+		PrevCursor: "",
+		NextCursor: "",
+	}
+	if len(periods) == 0 {
+		return res, nil
+	}
+	// if we came from another page there is always a page in that direction
+	hasPrev := (backward && more) || (cursor != nil && !backward)
+	hasNext := (!backward && more) || backward
+	if hasPrev {
+		prevCursor, prevErr := EncodeCursor(NewPeriodListCursor(periods[0], true))
+		if prevErr != nil {
+			return nil, prevErr
+		}
+		res.PrevCursor = prevCursor
+	}
+	if hasNext {
+		nextCursor, nextErr := EncodeCursor(NewPeriodListCursor(periods[len(periods)-1], false))
+		if nextErr != nil {
+			return nil, nextErr
+		}
+		res.NextCursor = nextCursor
+	}
+	return res, nil
+}
+
+// ListPeriodModels applies the query to a list of periods, it implements PeriodSettingsHandler.ListPeriods for
+// periods in memory. The periods slice is not modified.
+func ListPeriodModels(periods []*PeriodSettingsModel, query *PeriodListQuery) (*PeriodListPage, error) {
+	cursor, cursorErr := DecodePeriodListCursor(query)
+	if cursorErr != nil {
+		return nil, cursorErr
+	}
+	backward := cursor != nil && cursor.Backward
+	res := make([]*PeriodSettingsModel, 0, len(periods))
+	for _, period := range periods {
+		if query.Matches(period) && (cursor == nil || cursor.Selects(period)) {
+			res = append(res, period)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		cmp := comparePeriods(res[i].End, res[i].Start, res[i].Id, res[j].End, res[j].Start, res[j].Id)
+		if backward {
+			return cmp < 0
+		}
+		return cmp > 0
+	})
+	return NewPeriodListPage(query, cursor, res)
+}
@@ -0,0 +1,407 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/FabianWe/pollsweb"
+	"github.com/google/uuid"
+	"reflect"
+	"time"
+)
+
+// The states of a poll.
+//
+// A poll is created as a draft, once it's open votes are accepted. After the poll is closed no votes are accepted,
+// the results are available to the chair. Once the results are published they're visible to the voters.
+// There is no way back: a poll that has been closed can't be opened again, this way nobody can see partial results
+// of a poll that is still open.
+const (
+	PollStateDraft     = "draft"
+	PollStateOpen      = "open"
+	PollStateClosed    = "closed"
+	PollStatePublished = "published"
+)
+
+// pollStateTransitions maps each state to the only state that can follow it.
+var pollStateTransitions = map[string]string{
+	PollStateDraft:  PollStateOpen,
+	PollStateOpen:   PollStateClosed,
+	PollStateClosed: PollStatePublished,
+}
+
+// NextPollState returns the state that can follow state, it returns false if there is no such state.
+func NextPollState(state string) (string, bool) {
+	next, has := pollStateTransitions[state]
+	return next, has
+}
+
+// PollStateTransitionError is returned if a poll can't be moved from its current state to the requested one.
+type PollStateTransitionError struct {
+	pollsweb.PollWebError
+	PollId    uuid.UUID
+	State     string
+	Requested string
+}
+
+func NewPollStateTransitionError(pollId uuid.UUID, state, requested string) PollStateTransitionError {
+	return PollStateTransitionError{
+		PollId:    pollId,
+		State:     state,
+		Requested: requested,
+	}
+}
+
+func (e PollStateTransitionError) Error() string {
+	return fmt.Sprintf("poll %s can't change state from \"%s\" to \"%s\"", e.PollId, e.State, e.Requested)
+}
+
+// InvalidVoteError is returned if a vote can't be added to a poll, for example because the poll is not open.
+type InvalidVoteError struct {
+	pollsweb.PollWebError
+	PollId    uuid.UUID
+	VoterName string
+	Message   string
+}
+
+func NewInvalidVoteError(pollId uuid.UUID, voterName, message string) InvalidVoteError {
+	return InvalidVoteError{
+		PollId:    pollId,
+		VoterName: voterName,
+		Message:   message,
+	}
+}
+
+func (e InvalidVoteError) Error() string {
+	return fmt.Sprintf("invalid vote of \"%s\" in poll %s: %s", e.VoterName, e.PollId, e.Message)
+}
+
+// GetState returns the state of the poll, polls stored before states were introduced don't have a state and are
+// drafts.
+func (poll *PollModel) GetState() string {
+	if poll.State == "" {
+		return PollStateDraft
+	}
+	return poll.State
+}
+
+// Transition changes the state of the poll and sets the time of the transition to now.
+// It returns a PollStateTransitionError if the new state can't follow the current state.
+func (poll *PollModel) Transition(state string, now time.Time) error {
+	current := poll.GetState()
+	if next, has := NextPollState(current); !has || next != state {
+		return NewPollStateTransitionError(poll.Id, current, state)
+	}
+	poll.State = state
+	switch state {
+	case PollStateOpen:
+		poll.Opened = now
+	case PollStateClosed:
+		poll.Closed = now
+	case PollStatePublished:
+		poll.Published = now
+	}
+	return nil
+}
+
+// NextState returns the state that can follow the current state of the poll, it returns an empty string if the
+// poll is already published.
+func (poll *PollModel) NextState() string {
+	next, _ := NextPollState(poll.GetState())
+	return next
+}
+
+// IsOpen returns true if votes are accepted.
+func (poll *PollModel) IsOpen() bool {
+	return poll.GetState() == PollStateOpen
+}
+
+// ResultsVisible returns true if the results of the poll are published, before that nobody should see any results.
+// All results (exports, minutes and live updates) must be checked with this method.
+func (poll *PollModel) ResultsVisible() bool {
+	return poll.GetState() == PollStatePublished
+}
+
+// GetPoll returns the poll with the given id or nil if the meeting has no such poll.
+func (meeting *MeetingModel) GetPoll(id uuid.UUID) AbstractPollModel {
+	for _, group := range meeting.Groups {
+		for _, poll := range group.Polls {
+			if poll.GetId() == id {
+				return poll
+			}
+		}
+	}
+	return nil
+}
+
+// PollVote is a vote for the poll with the given id.
+type PollVote struct {
+	PollId uuid.UUID
+	Vote   AbstractVoteModel
+}
+
+func NewPollVote(pollId uuid.UUID, vote AbstractVoteModel) *PollVote {
+	return &PollVote{
+		PollId: pollId,
+		Vote:   vote,
+	}
+}
+
+func voteVoterName(vote AbstractVoteModel) string {
+	switch typedVote := vote.(type) {
+	case *BasicPollVoteModel:
+		return typedVote.VoterName
+	case *MedianPollVoteModel:
+		return typedVote.VoterName
+	case *SchulzePollVoteModel:
+		return typedVote.VoterName
+	default:
+		return ""
+	}
+}
+
+// AddPollVote adds the vote to the poll.
+//
+// It returns an InvalidVoteError if the poll is not open, the voter has already voted in the poll or the type of
+// the vote doesn't match the poll.
+func AddPollVote(poll AbstractPollModel, vote AbstractVoteModel) error {
+	voterName := voteVoterName(vote)
+	if !poll.GetPollModel().IsOpen() {
+		return NewInvalidVoteError(poll.GetId(), voterName,
+			fmt.Sprintf("poll is %s, votes are only accepted in open polls", poll.GetPollModel().GetState()))
+	}
+	if vote.ModelVoteForType() != poll.ModelPollForType() {
+		return NewInvalidVoteError(poll.GetId(), voterName,
+			fmt.Sprintf("can't add %s vote to %s poll", vote.ModelVoteForType(), poll.ModelPollForType()))
+	}
+	if PollVoterNames(poll).Contains(voterName) {
+		return NewInvalidVoteError(poll.GetId(), voterName, "voter has already voted")
+	}
+	switch typedPoll := poll.(type) {
+	case *BasicPollModel:
+		typedPoll.Votes = append(typedPoll.Votes, vote.(*BasicPollVoteModel))
+	case *MedianPollModel:
+		typedPoll.Votes = append(typedPoll.Votes, vote.(*MedianPollVoteModel))
+	case *SchulzePollModel:
+		typedPoll.Votes = append(typedPoll.Votes, vote.(*SchulzePollVoteModel))
+	}
+	return nil
+}
+
+// AddVotes adds all votes to the polls of the meeting, see AddPollVote.
+// The meeting is changed even if an error is returned, so it should not be used in this case.
+func (meeting *MeetingModel) AddVotes(votes []*PollVote) error {
+	for _, pollVote := range votes {
+		poll := meeting.GetPoll(pollVote.PollId)
+		if poll == nil {
+			return NewInvalidVoteError(pollVote.PollId, voteVoterName(pollVote.Vote), "poll does not exist")
+		}
+		if err := AddPollVote(poll, pollVote.Vote); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InvalidPollsUpdateError is returned if the poll groups of a meeting can't be replaced because the state or the
+// votes of a poll would change, see CheckPollGroupsUpdate.
+type InvalidPollsUpdateError struct {
+	pollsweb.PollWebError
+	PollId  uuid.UUID
+	Message string
+}
+
+func NewInvalidPollsUpdateError(pollId uuid.UUID, message string) InvalidPollsUpdateError {
+	return InvalidPollsUpdateError{
+		PollId:  pollId,
+		Message: message,
+	}
+}
+
+func (e InvalidPollsUpdateError) Error() string {
+	return fmt.Sprintf("can't update poll %s: %s", e.PollId, e.Message)
+}
+
+// pollFingerprint returns a string that is equal for two polls iff they're equal, including state and votes.
+func pollFingerprint(poll AbstractPollModel) (string, error) {
+	archivePoll, archiveErr := NewArchivePoll(poll)
+	if archiveErr != nil {
+		return "", archiveErr
+	}
+	archivePoll.Opened = archivePoll.Opened.UTC()
+	archivePoll.Closed = archivePoll.Closed.UTC()
+	archivePoll.Published = archivePoll.Published.UTC()
+	encoded, encodeErr := json.Marshal(archivePoll)
+	if encodeErr != nil {
+		return "", encodeErr
+	}
+	return string(encoded), nil
+}
+
+// pollIsEditable returns true if the poll is a draft without votes, only such polls can be changed or removed.
+func pollIsEditable(poll AbstractPollModel) bool {
+	return poll.GetPollModel().GetState() == PollStateDraft && len(PollVoterNames(poll)) == 0
+}
+
+// CheckPollGroupsUpdate checks if the poll groups current of a meeting can be replaced by groups.
+//
+// The state of a poll is only changed by TransitionPoll (and TransitionPolls) and votes are only added by AddVotes,
+// replacing the groups must not bypass this. Thus all polls in current that are not drafts without votes must be
+// contained unchanged in groups and all other polls in groups must be drafts without votes.
+// It returns an InvalidPollsUpdateError if this is not the case.
+func CheckPollGroupsUpdate(current, groups []*PollGroupModel) error {
+	fixed := make(map[uuid.UUID]string)
+	for _, group := range current {
+		for _, poll := range group.Polls {
+			if pollIsEditable(poll) {
+				continue
+			}
+			fingerprint, fingerprintErr := pollFingerprint(poll)
+			if fingerprintErr != nil {
+				return fingerprintErr
+			}
+			fixed[poll.GetId()] = fingerprint
+		}
+	}
+	for _, group := range groups {
+		for _, poll := range group.Polls {
+			expected, isFixed := fixed[poll.GetId()]
+			if !isFixed {
+				if !pollIsEditable(poll) {
+					return NewInvalidPollsUpdateError(poll.GetId(), "new polls must be drafts without votes")
+				}
+				continue
+			}
+			fingerprint, fingerprintErr := pollFingerprint(poll)
+			if fingerprintErr != nil {
+				return fingerprintErr
+			}
+			if fingerprint != expected {
+				return NewInvalidPollsUpdateError(poll.GetId(),
+					fmt.Sprintf("the poll is %s, it can't be changed", poll.GetPollModel().GetState()))
+			}
+			delete(fixed, poll.GetId())
+		}
+	}
+	for pollId := range fixed {
+		return NewInvalidPollsUpdateError(pollId, "only drafts without votes can be removed")
+	}
+	return nil
+}
+
+// TransitionPoll changes the state of the poll with the given id, see PollModel.Transition.
+func (meeting *MeetingModel) TransitionPoll(pollId uuid.UUID, state string, now time.Time) error {
+	poll := meeting.GetPoll(pollId)
+	if poll == nil {
+		return NewEntryNotFoundError(meetingModelType, reflect.ValueOf(pollId), nil)
+	}
+	return poll.GetPollModel().Transition(state, now)
+}
+
+// TransitionPolls changes the state of all polls in the state from to the state to, it returns the number of
+// changed polls.
+func (meeting *MeetingModel) TransitionPolls(from, to string, now time.Time) (int, error) {
+	num := 0
+	for _, group := range meeting.Groups {
+		for _, poll := range group.Polls {
+			pollModel := poll.GetPollModel()
+			if pollModel.GetState() != from {
+				continue
+			}
+			if err := pollModel.Transition(to, now); err != nil {
+				return num, err
+			}
+			num++
+		}
+	}
+	return num, nil
+}
+
+// CountPollsInState returns the number of polls of the meeting in the given state.
+func (meeting *MeetingModel) CountPollsInState(state string) int {
+	num := 0
+	for _, group := range meeting.Groups {
+		for _, poll := range group.Polls {
+			if poll.GetPollModel().GetState() == state {
+				num++
+			}
+		}
+	}
+	return num
+}
+
+// HasOnlineVoting returns true if the meeting has an online voting window.
+func (meeting *MeetingModel) HasOnlineVoting() bool {
+	return !meeting.OnlineStart.IsZero() && !meeting.OnlineEnd.IsZero()
+}
+
+// IsOnlineVotingOpen returns true if the meeting has online voting and the reference time is in the voting window,
+// that is between OnlineStart (inclusive) and OnlineEnd (exclusive).
+func (meeting *MeetingModel) IsOnlineVotingOpen(referenceTime time.Time) bool {
+	return meeting.HasOnlineVoting() && !referenceTime.Before(meeting.OnlineStart) && referenceTime.Before(meeting.OnlineEnd)
+}
+
+// VotingTransition changes the state of all polls of a meeting from one state to another.
+type VotingTransition struct {
+	From string
+	To   string
+}
+
+var (
+	// OpenVotingTransition opens all draft polls at the start of online voting
+	OpenVotingTransition = &VotingTransition{From: PollStateDraft, To: PollStateOpen}
+	// CloseVotingTransition closes all open polls at the end of online voting
+	CloseVotingTransition = &VotingTransition{From: PollStateOpen, To: PollStateClosed}
+)
+
+// DueVotingTransition returns the transition of the online voting window that is due at now, nil if there is no
+// such transition.
+// At OnlineStart all drafts are opened, at OnlineEnd all open polls are closed. Each transition is done only once:
+// it's due as long as it has not been applied (see MeetingModel.ApplyVotingTransition), so polls the chair opens by
+// hand after the end are not closed again and drafts added after the start are not opened. Drafts are not opened
+// after OnlineEnd.
+func DueVotingTransition(meeting *MeetingModel, now time.Time) *VotingTransition {
+	if !meeting.HasOnlineVoting() {
+		return nil
+	}
+	switch {
+	case !now.Before(meeting.OnlineEnd):
+		if meeting.OnlineClosedAt.IsZero() {
+			return CloseVotingTransition
+		}
+	case !now.Before(meeting.OnlineStart):
+		if meeting.OnlineOpenedAt.IsZero() {
+			return OpenVotingTransition
+		}
+	}
+	return nil
+}
+
+// ApplyVotingTransition applies a scheduled transition of the online voting window: the polls are changed with
+// TransitionPolls and the time of the transition is stored in OnlineOpenedAt or OnlineClosedAt.
+// It returns the number of changed polls.
+func (meeting *MeetingModel) ApplyVotingTransition(transition *VotingTransition, now time.Time) (int, error) {
+	num, err := meeting.TransitionPolls(transition.From, transition.To, now)
+	if err != nil {
+		return 0, err
+	}
+	if transition.To == PollStateOpen {
+		meeting.OnlineOpenedAt = now
+	} else {
+		meeting.OnlineClosedAt = now
+	}
+	return num, nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"context"
+	"fmt"
+	"github.com/FabianWe/pollsweb"
+	"github.com/asaskevich/govalidator"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// StorageDriver opens a DataHandler for a storage backend.
+//
+// Drivers are registered with RegisterStorageDriver (usually in an init function) and selected by their name in the
+// config. Each driver has its own config section, the section is decoded into the value returned by NewConfig and
+// passed to Open.
+type StorageDriver struct {
+	// Name is the name used to select the driver
+	Name string
+	// ConfigKey is the key of the config section of the driver
+	ConfigKey string
+	// NewConfig returns a new config with the default values, it must return a pointer to a struct
+	NewConfig func() interface{}
+	// Open opens the storage, config is a value returned by NewConfig (with the config section decoded into it).
+	// The driver should respect the deadline of the context.
+	Open func(ctx context.Context, config interface{}) (DataHandler, error)
+}
+
+var (
+	storageDriversMutex sync.RWMutex
+	storageDrivers      = make(map[string]*StorageDriver)
+)
+
+// RegisterStorageDriver makes a storage driver available by its name, it panics if a driver with the same name is
+// already registered.
+func RegisterStorageDriver(driver *StorageDriver) {
+	storageDriversMutex.Lock()
+	defer storageDriversMutex.Unlock()
+	if _, exists := storageDrivers[driver.Name]; exists {
+		panic(fmt.Sprintf("storage driver \"%s\" registered twice", driver.Name))
+	}
+	storageDrivers[driver.Name] = driver
+}
+
+// GetStorageDriver returns the driver with the given name.
+func GetStorageDriver(name string) (*StorageDriver, error) {
+	storageDriversMutex.RLock()
+	defer storageDriversMutex.RUnlock()
+	driver, exists := storageDrivers[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown storage driver \"%s\", registered drivers: %s",
+			name, strings.Join(storageDriverNames(), ", "))
+	}
+	return driver, nil
+}
+
+func storageDriverNames() []string {
+	res := make([]string, 0, len(storageDrivers))
+	for name := range storageDrivers {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// StorageDriverNames returns the sorted names of all registered drivers.
+func StorageDriverNames() []string {
+	storageDriversMutex.RLock()
+	defer storageDriversMutex.RUnlock()
+	return storageDriverNames()
+}
+
+// NewStorageDriverConfigs returns the default configs of all registered drivers, the keys are the config keys of
+// the drivers.
+func NewStorageDriverConfigs() map[string]interface{} {
+	storageDriversMutex.RLock()
+	defer storageDriversMutex.RUnlock()
+	res := make(map[string]interface{}, len(storageDrivers))
+	for _, driver := range storageDrivers {
+		res[driver.ConfigKey] = driver.NewConfig()
+	}
+	return res
+}
+
+// OpenStorage opens the storage with the driver of the given name. configs contains the configs of the drivers by
+// their config keys (see NewStorageDriverConfigs), if there is no config for the driver its default config is used.
+// The config is validated with govalidator before the storage is opened.
+func OpenStorage(ctx context.Context, name string, configs map[string]interface{}) (DataHandler, error) {
+	driver, driverErr := GetStorageDriver(name)
+	if driverErr != nil {
+		return nil, driverErr
+	}
+	config, hasConfig := configs[driver.ConfigKey]
+	if !hasConfig || config == nil {
+		config = driver.NewConfig()
+	}
+	if ok, validateErr := govalidator.ValidateStruct(config); !ok || validateErr != nil {
+		return nil, fmt.Errorf("invalid config for storage driver \"%s\": %v", name, validateErr)
+	}
+	return driver.Open(ctx, config)
+}
+
+// ClockSetter is implemented by data handlers that use a clock, for example to set the last updated time of entries.
+type ClockSetter interface {
+	SetClock(clock pollsweb.Clock)
+}
+
+// MigrationChecker is implemented by data handlers that require migrations after an update.
+type MigrationChecker interface {
+	// PendingMigrations returns the number of migrations that are not applied yet.
+	PendingMigrations(ctx context.Context) (int, error)
+}
+
+// TransactionChecker is implemented by data handlers that write records and their chain entries atomically only if
+// the storage supports transactions (for example MongoDB requires a replica set).
+type TransactionChecker interface {
+	// SupportsTransactions returns true if records and their chain entries are written atomically.
+	SupportsTransactions(ctx context.Context) (bool, error)
+}
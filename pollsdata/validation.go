@@ -0,0 +1,346 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"errors"
+	"fmt"
+	"github.com/FabianWe/pollsweb"
+	"github.com/asaskevich/govalidator"
+	"github.com/google/uuid"
+)
+
+// This file implements ValidatorModel for all models.
+// The valid struct tags are checked with govalidator, govalidator does not descend into slices of models and can't
+// check uuid.UUID values, these checks are done by hand.
+// The DataHandler implementations call ValidateModel before a model is written.
+
+// validateTags checks the valid struct tags of the model.
+//
+// govalidator also validates empty strings (even if the tag contains "optional"), errors for the fields in emptyFields
+// are ignored, the caller must make sure that these fields are empty.
+func validateTags(model interface{}, emptyFields ...string) error {
+	_, err := govalidator.ValidateStruct(model)
+	if err == nil {
+		return nil
+	}
+	if errs, ok := err.(govalidator.Errors); ok && len(emptyFields) > 0 {
+		remaining := make(govalidator.Errors, 0, len(errs))
+		for _, fieldErr := range errs {
+			if isEmptyFieldError(fieldErr, emptyFields) {
+				continue
+			}
+			remaining = append(remaining, fieldErr)
+		}
+		if len(remaining) == 0 {
+			return nil
+		}
+		err = remaining
+	}
+	return NewModelValidationError("invalid field value").SetWrapped(err)
+}
+
+func isEmptyFieldError(err error, emptyFields []string) bool {
+	fieldErr, ok := err.(govalidator.Error)
+	if !ok || len(fieldErr.Path) > 0 {
+		return false
+	}
+	for _, name := range emptyFields {
+		if fieldErr.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// nestedValidationError prefixes the field name of a ModelValidationError with the name of the field the nested model
+// is stored in, all other errors are returned unchanged.
+func nestedValidationError(fieldName string, err error) error {
+	var validationErr *ModelValidationError
+	if errors.As(err, &validationErr) {
+		if validationErr.FieldName == "" {
+			validationErr.FieldName = fieldName
+		} else {
+			validationErr.FieldName = fieldName + "." + validationErr.FieldName
+		}
+	}
+	return err
+}
+
+// uniqueSlugs returns an error if a slug is empty or occurs more than once, slug returns the slug of element i.
+func uniqueSlugs(fieldName string, n int, slug func(i int) string) error {
+	slugs := pollsweb.NewStringSet(n)
+	for i := 0; i < n; i++ {
+		s := slug(i)
+		if s == "" {
+			return NewModelValidationError("slug must not be empty").SetFieldName(fmt.Sprintf("%s[%d].Slug", fieldName, i))
+		}
+		if !slugs.Add(s) {
+			return NewModelValidationError(fmt.Sprintf("duplicate slug \"%s\"", s)).SetFieldName(fmt.Sprintf("%s[%d].Slug", fieldName, i))
+		}
+	}
+	return nil
+}
+
+// ValidateModel checks that the id is a random (version 4) UUID, the ids are generated with pollsweb.GenUUID.
+func (m *IdModel) ValidateModel() error {
+	if m == nil || m.Id == uuid.Nil {
+		return NewModelValidationError("id is not set").SetFieldName("Id")
+	}
+	if m.Id.Version() != 4 {
+		return NewModelValidationError(fmt.Sprintf("id %s is not a version 4 UUID", m.Id)).SetFieldName("Id")
+	}
+	return nil
+}
+
+func (m *MeetingTimeTemplateModel) ValidateModel() error {
+	return validateTags(m)
+}
+
+func (m *PeriodSettingsModel) ValidateModel() error {
+	if err := m.IdModel.ValidateModel(); err != nil {
+		return err
+	}
+	if m.MeetingDateTemplate == nil {
+		return NewModelValidationError("meeting time template is missing").SetFieldName("MeetingDateTemplate")
+	}
+	// also checks the meeting time template
+	if err := validateTags(m); err != nil {
+		return err
+	}
+	if !m.Start.Before(m.End) {
+		return NewModelValidationError(fmt.Sprintf("start %s is not before end %s", m.Start, m.End)).SetFieldName("End")
+	}
+	return ValidateVoters(m.Voters)
+}
+
+// ValidateModel validates the voter, the email is optional.
+func (m *VoterModel) ValidateModel() error {
+	if err := m.IdModel.ValidateModel(); err != nil {
+		return err
+	}
+	if m.Email == "" {
+		return validateTags(m, "Email")
+	}
+	return validateTags(m)
+}
+
+// ValidateVoters validates all voters and checks that the slugs of the voters are unique.
+func ValidateVoters(voters []*VoterModel) error {
+	for i, voter := range voters {
+		if err := voter.ValidateModel(); err != nil {
+			return nestedValidationError(fmt.Sprintf("Voters[%d]", i), err)
+		}
+	}
+	return uniqueSlugs("Voters", len(voters), func(i int) string {
+		return voters[i].Slug
+	})
+}
+
+// ValidateModel checks that the majority is a fraction between 0 and 1.
+func (m *MajorityModel) ValidateModel() error {
+	if m.Denominator <= 0 {
+		return NewModelValidationError(fmt.Sprintf("denominator must be positive, got %d", m.Denominator)).
+			SetFieldName("Denominator")
+	}
+	if m.Numerator < 0 || m.Numerator > m.Denominator {
+		return NewModelValidationError(fmt.Sprintf("numerator must be between 0 and %d, got %d", m.Denominator, m.Numerator)).
+			SetFieldName("Numerator")
+	}
+	return nil
+}
+
+func (m *VoteModel) ValidateModel() error {
+	if err := m.IdModel.ValidateModel(); err != nil {
+		return err
+	}
+	return validateTags(m)
+}
+
+func (vote *BasicPollVoteModel) ValidateModel() error {
+	if err := vote.VoteModel.ValidateModel(); err != nil {
+		return err
+	}
+	// govalidator formats the answer with its String method, so the range tag can't be checked
+	if !vote.Answer.IsValid() {
+		return NewModelValidationError(fmt.Sprintf("invalid answer %d", vote.Answer)).SetFieldName("Answer")
+	}
+	return nil
+}
+
+func (vote *MedianPollVoteModel) ValidateModel() error {
+	return vote.VoteModel.ValidateModel()
+}
+
+func (vote *SchulzePollVoteModel) ValidateModel() error {
+	return vote.VoteModel.ValidateModel()
+}
+
+// validateVotes calls validate for all votes of a poll and checks that the slugs of the votes are unique.
+func validateVotes(n int, vote func(i int) *VoteModel, validate func(i int) error) error {
+	for i := 0; i < n; i++ {
+		if err := validate(i); err != nil {
+			return nestedValidationError(fmt.Sprintf("Votes[%d]", i), err)
+		}
+	}
+	return uniqueSlugs("Votes", n, func(i int) string {
+		return vote(i).Slug
+	})
+}
+
+// ValidateModel validates the fields common to all polls, it does not check the type of the poll.
+func (poll *PollModel) ValidateModel() error {
+	if err := poll.IdModel.ValidateModel(); err != nil {
+		return err
+	}
+	if poll.Majority == nil {
+		return NewModelValidationError("majority is missing").SetFieldName("Majority")
+	}
+	if err := poll.Majority.ValidateModel(); err != nil {
+		return nestedValidationError("Majority", err)
+	}
+	// polls without a state are drafts, see GetState
+	if poll.State == "" {
+		return validateTags(poll, "State")
+	}
+	return validateTags(poll)
+}
+
+// validatePollType checks that the type stored in the poll matches the actual type of the poll.
+func validatePollType(poll AbstractPollModel) error {
+	if actual := poll.GetPollModel().Type; actual != poll.ModelPollForType() {
+		return NewModelValidationError(fmt.Sprintf("type must be \"%s\", got \"%s\"", poll.ModelPollForType(), actual)).
+			SetFieldName("Type")
+	}
+	return nil
+}
+
+func (poll *BasicPollModel) ValidateModel() error {
+	if err := poll.PollModel.ValidateModel(); err != nil {
+		return err
+	}
+	if err := validatePollType(poll); err != nil {
+		return err
+	}
+	return validateVotes(len(poll.Votes), func(i int) *VoteModel {
+		return poll.Votes[i].VoteModel
+	}, func(i int) error {
+		return poll.Votes[i].ValidateModel()
+	})
+}
+
+// ValidateModel validates the poll and checks that no vote is greater than the value of the poll.
+func (poll *MedianPollModel) ValidateModel() error {
+	if err := poll.PollModel.ValidateModel(); err != nil {
+		return err
+	}
+	if err := validatePollType(poll); err != nil {
+		return err
+	}
+	if err := validateTags(poll); err != nil {
+		return err
+	}
+	return validateVotes(len(poll.Votes), func(i int) *VoteModel {
+		return poll.Votes[i].VoteModel
+	}, func(i int) error {
+		vote := poll.Votes[i]
+		if err := vote.ValidateModel(); err != nil {
+			return err
+		}
+		if vote.Value > poll.Value {
+			return NewModelValidationError(fmt.Sprintf("value %d is greater than the value of the poll (%d)", vote.Value, poll.Value)).
+				SetFieldName("Value")
+		}
+		return nil
+	})
+}
+
+// ValidateModel validates the poll and checks that the ranking of each vote contains an entry for each option.
+func (poll *SchulzePollModel) ValidateModel() error {
+	if err := poll.PollModel.ValidateModel(); err != nil {
+		return err
+	}
+	if err := validatePollType(poll); err != nil {
+		return err
+	}
+	if len(poll.Options) == 0 {
+		return NewModelValidationError("poll has no options").SetFieldName("Options")
+	}
+	return validateVotes(len(poll.Votes), func(i int) *VoteModel {
+		return poll.Votes[i].VoteModel
+	}, func(i int) error {
+		vote := poll.Votes[i]
+		if err := vote.ValidateModel(); err != nil {
+			return err
+		}
+		if len(vote.Ranking) != len(poll.Options) {
+			return NewModelValidationError(fmt.Sprintf("ranking has length %d, the poll has %d options", len(vote.Ranking), len(poll.Options))).
+				SetFieldName("Ranking")
+		}
+		return nil
+	})
+}
+
+func (group *PollGroupModel) ValidateModel() error {
+	if err := group.IdModel.ValidateModel(); err != nil {
+		return err
+	}
+	for i, poll := range group.Polls {
+		if err := poll.ValidateModel(); err != nil {
+			return nestedValidationError(fmt.Sprintf("Polls[%d]", i), err)
+		}
+	}
+	return uniqueSlugs("Polls", len(group.Polls), func(i int) string {
+		return group.Polls[i].GetPollModel().Slug
+	})
+}
+
+// ValidatePollGroups validates all groups and checks that the slugs of the groups are unique.
+func ValidatePollGroups(groups []*PollGroupModel) error {
+	for i, group := range groups {
+		if err := group.ValidateModel(); err != nil {
+			return nestedValidationError(fmt.Sprintf("Groups[%d]", i), err)
+		}
+	}
+	return uniqueSlugs("Groups", len(groups), func(i int) string {
+		return groups[i].Slug
+	})
+}
+
+// ValidateModel validates the meeting including all voters and poll groups, online voting must either be disabled
+// (OnlineStart and OnlineEnd are zero) or OnlineStart must be before OnlineEnd.
+func (meeting *MeetingModel) ValidateModel() error {
+	if err := meeting.IdModel.ValidateModel(); err != nil {
+		return err
+	}
+	if err := validateTags(meeting); err != nil {
+		return err
+	}
+	if meeting.PeriodId == uuid.Nil {
+		return NewModelValidationError("period is not set").SetFieldName("PeriodId")
+	}
+	if meeting.OnlineStart.IsZero() != meeting.OnlineEnd.IsZero() {
+		return NewModelValidationError("online start and online end must either both be set or both be empty").
+			SetFieldName("OnlineEnd")
+	}
+	if meeting.HasOnlineVoting() && !meeting.OnlineStart.Before(meeting.OnlineEnd) {
+		return NewModelValidationError(fmt.Sprintf("online start %s is not before online end %s", meeting.OnlineStart, meeting.OnlineEnd)).
+			SetFieldName("OnlineEnd")
+	}
+	if err := ValidateVoters(meeting.Voters); err != nil {
+		return err
+	}
+	return ValidatePollGroups(meeting.Groups)
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsdata
+
+import (
+	"context"
+	"fmt"
+	"github.com/FabianWe/pollsweb"
+	"github.com/google/uuid"
+	"reflect"
+	"time"
+)
+
+var (
+	webhookModelType = reflect.TypeOf(EmptyWebhookModel())
+)
+
+// WebhookModel is a URL that receives events.
+// Secret is used to sign the payloads, Events contains the event types the webhook is registered for.
+type WebhookModel struct {
+	*IdModel `bson:",inline"`
+	URL      string `valid:"url"`
+	Secret   string
+	Events   []string
+	Active   bool
+	Created  time.Time
+}
+
+func EmptyWebhookModel() *WebhookModel {
+	return &WebhookModel{
+		IdModel: EmptyIdModel(),
+		URL:     "",
+		Secret:  "",
+		Events:  nil,
+		Active:  false,
+		Created: time.Time{},
+	}
+}
+
+func NewWebhookModel(clock pollsweb.Clock, url, secret string, events []string) *WebhookModel {
+	return &WebhookModel{
+		IdModel: EmptyIdModel(),
+		URL:     url,
+		Secret:  secret,
+		Events:  events,
+		Active:  true,
+		Created: clock.Now(),
+	}
+}
+
+func (m *WebhookModel) String() string {
+	return fmt.Sprintf("WebhookModel(Id=%s, URL=%s, Events=%v, Active=%v, Created=%s)",
+		m.Id, m.URL, m.Events, m.Active, m.Created)
+}
+
+// WebhookDeliveryModel records a single attempt to deliver an event to a webhook.
+//
+// If the attempt failed and another attempt should be made RetryAt is the time of the next attempt and Payload
+// contains the body to send again. RetryAt is zero if no retry is pending (or the retry was already claimed, see
+// WebhooksHandler.ClaimWebhookDeliveryRetry).
+type WebhookDeliveryModel struct {
+	*IdModel   `bson:",inline"`
+	WebhookId  uuid.UUID
+	EventId    uuid.UUID
+	Event      string
+	Attempt    int
+	Time       time.Time
+	Duration   time.Duration
+	StatusCode int
+	Error      string
+	Success    bool
+
+	Payload []byte
+	RetryAt time.Time
+}
+
+func EmptyWebhookDeliveryModel() *WebhookDeliveryModel {
+	return &WebhookDeliveryModel{
+		IdModel:    EmptyIdModel(),
+		WebhookId:  uuid.Nil,
+		EventId:    uuid.Nil,
+		Event:      "",
+		Attempt:    0,
+		Time:       time.Time{},
+		Duration:   0,
+		StatusCode: 0,
+		Error:      "",
+		Success:    false,
+
+		Payload: nil,
+		RetryAt: time.Time{},
+	}
+}
+
+func NewWebhookDeliveryModel(clock pollsweb.Clock, webhookId, eventId uuid.UUID, event string, attempt int) *WebhookDeliveryModel {
+	return &WebhookDeliveryModel{
+		IdModel:    EmptyIdModel(),
+		WebhookId:  webhookId,
+		EventId:    eventId,
+		Event:      event,
+		Attempt:    attempt,
+		Time:       clock.Now(),
+		Duration:   0,
+		StatusCode: 0,
+		Error:      "",
+		Success:    false,
+
+		Payload: nil,
+		RetryAt: time.Time{},
+	}
+}
+
+func (m *WebhookDeliveryModel) String() string {
+	return fmt.Sprintf("WebhookDeliveryModel(Id=%s, WebhookId=%s, EventId=%s, Event=%s, Attempt=%d, Time=%s, Duration=%s, StatusCode=%d, Error=%s, Success=%v, RetryAt=%s)",
+		m.Id, m.WebhookId, m.EventId, m.Event, m.Attempt, m.Time, m.Duration, m.StatusCode, m.Error, m.Success, m.RetryAt)
+}
+
+type WebhooksHandler interface {
+	InsertWebhook(ctx context.Context, webhook *WebhookModel) (uuid.UUID, error)
+
+	GetWebhook(ctx context.Context, id uuid.UUID) (*WebhookModel, error)
+	// GetWebhooks returns all webhooks, if event is not empty only the active webhooks registered for this event
+	// are returned.
+	GetWebhooks(ctx context.Context, event string) ([]*WebhookModel, error)
+
+	DeleteWebhook(ctx context.Context, id uuid.UUID) (int64, error)
+
+	InsertWebhookDelivery(ctx context.Context, delivery *WebhookDeliveryModel) (uuid.UUID, error)
+	// GetWebhookDeliveries returns the latest deliveries of a webhook (newest first), limit <= 0 means no limit.
+	GetWebhookDeliveries(ctx context.Context, webhookId uuid.UUID, limit int64) ([]*WebhookDeliveryModel, error)
+	// GetDueWebhookDeliveries returns the deliveries with a pending retry that is due at now (oldest retry first),
+	// limit <= 0 means no limit.
+	GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int64) ([]*WebhookDeliveryModel, error)
+	// ClaimWebhookDeliveryRetry resets RetryAt of the delivery, it returns false if there is no pending retry
+	// (for example because it was claimed by another process). Only the caller that claimed the retry should
+	// retry the delivery.
+	ClaimWebhookDeliveryRetry(ctx context.Context, id uuid.UUID) (bool, error)
+}
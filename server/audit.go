@@ -0,0 +1,449 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// AuditAnonymousActor is the actor of requests without a user name.
+	AuditAnonymousActor = "anonymous"
+	// AuditSchedulerActor is the actor of actions done by the MeetingScheduler.
+	AuditSchedulerActor = "scheduler"
+)
+
+// AuditConfig describes how the actor and the remote address of audited requests are determined.
+type AuditConfig struct {
+	// ActorHeader is the request header that contains the name of the authenticated user, for example "X-Remote-User"
+	// if the server runs behind an authenticating proxy. The header can be set by any client, so it is only read if
+	// the request comes from one of the TrustedProxyAddrs. If it is empty or not used the actor is anonymous.
+	ActorHeader string `mapstructure:"actor_header"`
+	// RemoteAddrHeader is the request header that contains the addresses of the client and the proxies, for example
+	// "X-Forwarded-For". If it is empty or the header doesn't contain enough addresses the address of the connection
+	// is used.
+	RemoteAddrHeader string `mapstructure:"remote_addr_header"`
+	// TrustedProxies is the number of proxies in front of the server that append to RemoteAddrHeader.
+	// Each proxy appends the address it received the request from, so the client address is the TrustedProxies-th
+	// address from the right. All addresses left of it can be set by the client and are ignored.
+	TrustedProxies int `mapstructure:"trusted_proxies"`
+	// TrustedProxyAddrs are the addresses (IPs or CIDR networks) the trusted proxies connect from, see ActorHeader.
+	TrustedProxyAddrs []string `mapstructure:"trusted_proxy_addrs"`
+}
+
+func NewAuditConfig() *AuditConfig {
+	return &AuditConfig{
+		ActorHeader:       "",
+		RemoteAddrHeader:  "",
+		TrustedProxies:    1,
+		TrustedProxyAddrs: nil,
+	}
+}
+
+// ProxyNetworks parses TrustedProxyAddrs, a single IP is a network that contains only this IP.
+func (config *AuditConfig) ProxyNetworks() ([]*net.IPNet, error) {
+	res := make([]*net.IPNet, 0, len(config.TrustedProxyAddrs))
+	for _, addr := range config.TrustedProxyAddrs {
+		if !strings.Contains(addr, "/") {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy address \"%s\"", addr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			res = append(res, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, parseErr := net.ParseCIDR(addr)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid trusted proxy address \"%s\": %w", addr, parseErr)
+		}
+		res = append(res, network)
+	}
+	return res, nil
+}
+
+// fromTrustedProxy returns true if the connection of the request comes from one of the TrustedProxyAddrs.
+// Invalid addresses are ignored, they're reported by NewAppContextFromConfig.
+func (config *AuditConfig) fromTrustedProxy(r *http.Request) bool {
+	host, _, splitErr := net.SplitHostPort(r.RemoteAddr)
+	if splitErr != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	networks, _ := config.ProxyNetworks()
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditActor returns the actor of the request, see AuditConfig.
+// The user name from HTTP basic authentication is never used because the server doesn't check it.
+func (appContext *AppContext) AuditActor(r *http.Request) string {
+	if appContext.Audit.ActorHeader != "" && appContext.Audit.fromTrustedProxy(r) {
+		if actor := strings.TrimSpace(r.Header.Get(appContext.Audit.ActorHeader)); actor != "" {
+			return actor
+		}
+	}
+	return AuditAnonymousActor
+}
+
+// forwardedAddr returns the address appended by the first of numProxies proxies to a list of addresses like
+// X-Forwarded-For, the list may be split into multiple header values.
+// It returns an empty string if the list contains less than numProxies addresses.
+func forwardedAddr(values []string, numProxies int) string {
+	if numProxies < 1 {
+		numProxies = 1
+	}
+	addrs := make([]string, 0)
+	for _, value := range values {
+		for _, addr := range strings.Split(value, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	if len(addrs) < numProxies {
+		return ""
+	}
+	return addrs[len(addrs)-numProxies]
+}
+
+// AuditRemoteAddr returns the address of the client, see AuditConfig. The port is removed.
+func (appContext *AppContext) AuditRemoteAddr(r *http.Request) string {
+	if appContext.Audit.RemoteAddrHeader != "" {
+		values := r.Header.Values(appContext.Audit.RemoteAddrHeader)
+		if addr := forwardedAddr(values, appContext.Audit.TrustedProxies); addr != "" {
+			return addr
+		}
+	}
+	host, _, splitErr := net.SplitHostPort(r.RemoteAddr)
+	if splitErr != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// NewAuditEntry returns a new audit entry for an action caused by the request.
+func (appContext *AppContext) NewAuditEntry(r *http.Request, action string) *pollsdata.AuditEntryModel {
+	return pollsdata.NewAuditEntryModel(appContext.Clock, appContext.AuditActor(r), appContext.AuditRemoteAddr(r), action)
+}
+
+// AuditLog inserts the entries into the audit log.
+//
+// Errors are logged and counted (see NumAuditFailures), the first error is returned. The action the entries describe
+// has already been done, so most callers can ignore the error. Callers for which the audit log is essential (votes
+// and published results) should report it.
+func (appContext *AppContext) AuditLog(ctx context.Context, entries ...*pollsdata.AuditEntryModel) error {
+	var res error
+	for _, entry := range entries {
+		if _, insertErr := appContext.DataHandler.InsertAuditEntry(ctx, entry); insertErr != nil {
+			atomic.AddUint64(&appContext.auditFailures, 1)
+			appContext.Logger.Errorw("can't write audit log entry",
+				"entry", entry,
+				"error", insertErr)
+			if res == nil {
+				res = insertErr
+			}
+		}
+	}
+	return res
+}
+
+// NumAuditFailures returns the number of audit log entries that could not be written since the start.
+func (appContext *AppContext) NumAuditFailures() uint64 {
+	return atomic.LoadUint64(&appContext.auditFailures)
+}
+
+// AuditListForm contains the filters of the audit log, all fields are optional.
+// Period and Meeting are either the slug or the id of a period / meeting (the id can be used for deleted models),
+// From and To are dates in the format InternalDateFormat (both are inclusive). Cursor is the cursor of the page (see
+// pollsdata.AuditQuery).
+type AuditListForm struct {
+	Action  string `schema:"action"`
+	Actor   string `schema:"actor"`
+	Period  string `schema:"period"`
+	Meeting string `schema:"meeting"`
+	From    string `schema:"from"`
+	To      string `schema:"to"`
+	Cursor  string `schema:"cursor"`
+}
+
+func DecodeAuditListForm(src map[string][]string) (*AuditListForm, error) {
+	res := AuditListForm{}
+	err := DecodeForm(&res, src)
+	return &res, err
+}
+
+func (form *AuditListForm) ValidateForm() error {
+	if form.Action != "" && !pollsdata.IsAuditAction(form.Action) {
+		return NewFormValidationError(fmt.Sprintf("invalid action \"%s\"", form.Action)).SetFieldName("action")
+	}
+	for name, value := range map[string]string{"from": form.From, "to": form.To} {
+		if value == "" {
+			continue
+		}
+		if _, err := ParseDateFormField(value); err != nil {
+			return NewFormValidationError(fmt.Sprintf("invalid date \"%s\"", value)).SetFieldName(name).SetWrapped(err)
+		}
+	}
+	return nil
+}
+
+// ToQuery returns the query for the filters of the form, periods and meetings given by slug are looked up.
+func (form *AuditListForm) ToQuery(ctx context.Context, requestContext *RequestContext) (*pollsdata.AuditQuery, error) {
+	query := pollsdata.NewAuditQuery().
+		SetAction(form.Action).
+		SetActor(form.Actor).
+		SetCursor(form.Cursor)
+	if form.Period != "" {
+		id, idErr := uuid.Parse(form.Period)
+		if idErr != nil {
+			period, getErr := requestContext.DataHandler.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetSlug(&form.Period))
+			if getErr != nil {
+				return nil, notFoundAsHandlerError(getErr)
+			}
+			id = period.Id
+		}
+		query.SetPeriodId(&id)
+	}
+	if form.Meeting != "" {
+		id, idErr := uuid.Parse(form.Meeting)
+		if idErr != nil {
+			meeting, getErr := requestContext.DataHandler.GetMeeting(ctx, pollsdata.NewMeetingQueryArgs().SetSlug(&form.Meeting))
+			if getErr != nil {
+				return nil, notFoundAsHandlerError(getErr)
+			}
+			id = meeting.Id
+		}
+		query.SetMeetingId(&id)
+	}
+	// the form was validated, so the dates can be parsed
+	if form.From != "" {
+		from, _ := ParseDateFormField(form.From)
+		query.SetFrom(time.Time(from))
+	}
+	if form.To != "" {
+		to, _ := ParseDateFormField(form.To)
+		query.SetTo(time.Time(to).AddDate(0, 0, 1))
+	}
+	return query, nil
+}
+
+func auditQueryFromRequest(ctx context.Context, requestContext *RequestContext, r *http.Request) (*AuditListForm, *pollsdata.AuditQuery, error) {
+	form, formErr := DecodeAuditListForm(r.URL.Query())
+	if formErr != nil {
+		return nil, nil, NewError(formErr, http.StatusBadRequest)
+	}
+	query, queryErr := form.ToQuery(ctx, requestContext)
+	if queryErr != nil {
+		return nil, nil, queryErr
+	}
+	return form, query, nil
+}
+
+// AuditListHandleFunc shows the audit log filtered by AuditListForm, the most recent entry comes first.
+func AuditListHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	form, query, queryErr := auditQueryFromRequest(ctx, requestContext, r)
+	if queryErr != nil {
+		return queryErr
+	}
+	page, listErr := requestContext.DataHandler.ListAuditEntries(ctx, query)
+	if listErr != nil {
+		var invalidQuery pollsdata.InvalidQueryArgsError
+		if errors.As(listErr, &invalidQuery) {
+			return NewError(listErr, http.StatusBadRequest)
+		}
+		return listErr
+	}
+	entries := make([]*AuditExportEntry, len(page.Entries))
+	for i, entry := range page.Entries {
+		entries[i] = NewAuditExportEntry(entry)
+	}
+	data := requestContext.PrepareTemplateRenderData()
+	data["form"] = form
+	data["page"] = page
+	data["entries"] = entries
+	data["actions"] = pollsdata.AllAuditActions
+	data["audit_failures"] = requestContext.NumAuditFailures()
+	return executeBuffered(requestContext.Templates.TemplateMap["audit-list"], data, w)
+}
+
+// AuditExportLimit is the number of entries read at once when exporting the audit log.
+const AuditExportLimit = 500
+
+// AuditExportHandleFunc exports all entries of the audit log matching AuditListForm as csv or json.
+func AuditExportHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	_, query, queryErr := auditQueryFromRequest(ctx, requestContext, r)
+	if queryErr != nil {
+		return queryErr
+	}
+	entries := make([]*pollsdata.AuditEntryModel, 0)
+	readErr := pollsdata.AllAuditEntries(ctx, requestContext.DataHandler, query.SetLimit(AuditExportLimit),
+		func(entry *pollsdata.AuditEntryModel) error {
+			entries = append(entries, entry)
+			return nil
+		})
+	if readErr != nil {
+		return readErr
+	}
+	var buf bytes.Buffer
+	var writeErr error
+	var contentType string
+	format := mux.Vars(r)["format"]
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+		writeErr = WriteAuditCSV(&buf, entries)
+	case "json":
+		contentType = "application/json; charset=utf-8"
+		writeErr = WriteAuditJSON(&buf, entries)
+	default:
+		return NewError(fmt.Errorf("unsupported audit export format \"%s\"", format), http.StatusNotFound)
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"audit-%s.%s\"",
+		requestContext.Clock.Now().UTC().Format("20060102-150405"), format))
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// AuditExportEntry is the representation of an audit entry in exports and in the audit log view, ids of models not
+// affected by the action are nil.
+type AuditExportEntry struct {
+	Id         uuid.UUID         `json:"id"`
+	Time       time.Time         `json:"time"`
+	Actor      string            `json:"actor"`
+	RemoteAddr string            `json:"remote_addr"`
+	Action     string            `json:"action"`
+	PeriodId   *uuid.UUID        `json:"period_id,omitempty"`
+	MeetingId  *uuid.UUID        `json:"meeting_id,omitempty"`
+	PollId     *uuid.UUID        `json:"poll_id,omitempty"`
+	Details    map[string]string `json:"details"`
+}
+
+func optionalUUID(id uuid.UUID) *uuid.UUID {
+	if id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
+
+func NewAuditExportEntry(entry *pollsdata.AuditEntryModel) *AuditExportEntry {
+	details := entry.Details
+	if details == nil {
+		details = make(map[string]string)
+	}
+	return &AuditExportEntry{
+		Id:         entry.Id,
+		Time:       entry.Time.UTC(),
+		Actor:      entry.Actor,
+		RemoteAddr: entry.RemoteAddr,
+		Action:     entry.Action,
+		PeriodId:   optionalUUID(entry.PeriodId),
+		MeetingId:  optionalUUID(entry.MeetingId),
+		PollId:     optionalUUID(entry.PollId),
+		Details:    details,
+	}
+}
+
+// FormatAuditDetails formats the details of an entry as "key=value" pairs sorted by key.
+func FormatAuditDetails(details map[string]string) string {
+	keys := make([]string, 0, len(details))
+	for key := range details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + details[key]
+	}
+	return strings.Join(pairs, "; ")
+}
+
+// AuditCSVHead returns the head of the csv audit export.
+func AuditCSVHead() []string {
+	return []string{"id", "time", "actor", "remote_addr", "action", "period_id", "meeting_id", "poll_id", "details"}
+}
+
+func uuidCSVValue(id uuid.UUID) string {
+	if id == uuid.Nil {
+		return ""
+	}
+	return id.String()
+}
+
+// WriteAuditCSV writes the entries as csv, see AuditCSVHead.
+func WriteAuditCSV(w io.Writer, entries []*pollsdata.AuditEntryModel) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(AuditCSVHead()); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		record := []string{
+			entry.Id.String(),
+			entry.Time.UTC().Format(time.RFC3339Nano),
+			entry.Actor,
+			entry.RemoteAddr,
+			entry.Action,
+			uuidCSVValue(entry.PeriodId),
+			uuidCSVValue(entry.MeetingId),
+			uuidCSVValue(entry.PollId),
+			FormatAuditDetails(entry.Details),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteAuditJSON writes the entries as a json list of AuditExportEntry.
+func WriteAuditJSON(w io.Writer, entries []*pollsdata.AuditEntryModel) error {
+	res := make([]*AuditExportEntry, len(entries))
+	for i, entry := range entries {
+		res[i] = NewAuditExportEntry(entry)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(res)
+}
@@ -0,0 +1,243 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+const (
+	PeriodCreatedEvent    = "period.created"
+	MeetingCreatedEvent   = "meeting.created"
+	MeetingUpdatedEvent   = "meeting.updated"
+	VotingOpenedEvent     = "voting.opened"
+	VotingClosedEvent     = "voting.closed"
+	VoteCastEvent         = "vote.cast"
+	ResultsPublishedEvent = "results.published"
+)
+
+// AllEventTypes contains all event types in the order they should be displayed.
+var AllEventTypes = []string{
+	PeriodCreatedEvent,
+	MeetingCreatedEvent,
+	MeetingUpdatedEvent,
+	VotingOpenedEvent,
+	VotingClosedEvent,
+	VoteCastEvent,
+	ResultsPublishedEvent,
+}
+
+// IsEventType returns true if s is one of the constants in AllEventTypes.
+func IsEventType(s string) bool {
+	for _, eventType := range AllEventTypes {
+		if s == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is an event in the lifecycle of periods, meetings and polls.
+//
+// Data contains the event specific data, for example a MeetingEventData, it must be JSON encodable.
+type Event struct {
+	Id      uuid.UUID   `json:"id"`
+	Type    string      `json:"event"`
+	Created time.Time   `json:"created"`
+	Data    interface{} `json:"data"`
+}
+
+// NewEvent returns a new event with a random id, created is set to the current time of the clock.
+func NewEvent(clock pollsweb.Clock, eventType string, data interface{}) (*Event, error) {
+	id, idErr := pollsweb.GenUUID()
+	if idErr != nil {
+		return nil, idErr
+	}
+	return &Event{
+		Id:      id,
+		Type:    eventType,
+		Created: clock.Now(),
+		Data:    data,
+	}, nil
+}
+
+type PeriodEventData struct {
+	Id    uuid.UUID `json:"id"`
+	Name  string    `json:"name"`
+	Slug  string    `json:"slug"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func NewPeriodEventData(period *pollsdata.PeriodSettingsModel) *PeriodEventData {
+	return &PeriodEventData{
+		Id:    period.Id,
+		Name:  period.Name,
+		Slug:  period.Slug,
+		Start: period.Start,
+		End:   period.End,
+	}
+}
+
+type MeetingEventData struct {
+	Id          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Slug        string    `json:"slug"`
+	PeriodId    uuid.UUID `json:"period_id"`
+	MeetingTime time.Time `json:"meeting_time"`
+	OnlineStart time.Time `json:"online_start"`
+	OnlineEnd   time.Time `json:"online_end"`
+}
+
+func NewMeetingEventData(meeting *pollsdata.MeetingModel) *MeetingEventData {
+	return &MeetingEventData{
+		Id:          meeting.Id,
+		Name:        meeting.Name,
+		Slug:        meeting.Slug,
+		PeriodId:    meeting.PeriodId,
+		MeetingTime: meeting.MeetingTime,
+		OnlineStart: meeting.OnlineStart,
+		OnlineEnd:   meeting.OnlineEnd,
+	}
+}
+
+// MeetingId returns the id of the meeting, see MeetingEvent.
+func (data *MeetingEventData) MeetingId() uuid.UUID {
+	return data.Id
+}
+
+// VoteCastEventData describes a vote, it never contains the content of the vote.
+type VoteCastEventData struct {
+	Meeting uuid.UUID `json:"meeting"`
+	Poll    uuid.UUID `json:"poll"`
+	Voter   string    `json:"voter"`
+}
+
+func NewVoteCastEventData(meeting *pollsdata.MeetingModel, poll pollsdata.AbstractPollModel, voterName string) *VoteCastEventData {
+	return &VoteCastEventData{
+		Meeting: meeting.Id,
+		Poll:    poll.GetId(),
+		Voter:   voterName,
+	}
+}
+
+// MeetingId returns the id of the meeting the vote was cast in, see MeetingEvent.
+func (data *VoteCastEventData) MeetingId() uuid.UUID {
+	return data.Meeting
+}
+
+// PollEventData describes a change of the state of a poll.
+type PollEventData struct {
+	Meeting uuid.UUID `json:"meeting"`
+	Poll    uuid.UUID `json:"poll"`
+	Name    string    `json:"name"`
+	State   string    `json:"state"`
+}
+
+func NewPollEventData(meeting *pollsdata.MeetingModel, poll pollsdata.AbstractPollModel) *PollEventData {
+	return &PollEventData{
+		Meeting: meeting.Id,
+		Poll:    poll.GetId(),
+		Name:    poll.GetPollModel().Name,
+		State:   poll.GetPollModel().GetState(),
+	}
+}
+
+// MeetingId returns the id of the meeting the poll belongs to, see MeetingEvent.
+func (data *PollEventData) MeetingId() uuid.UUID {
+	return data.Meeting
+}
+
+// PollStateEvent returns the event that is published when a poll changes to the state, it returns an empty string
+// if there is no such event.
+func PollStateEvent(state string) string {
+	switch state {
+	case pollsdata.PollStateOpen:
+		return VotingOpenedEvent
+	case pollsdata.PollStateClosed:
+		return VotingClosedEvent
+	case pollsdata.PollStatePublished:
+		return ResultsPublishedEvent
+	default:
+		return ""
+	}
+}
+
+// MeetingEvent is implemented by all event data that belongs to a meeting.
+type MeetingEvent interface {
+	MeetingId() uuid.UUID
+}
+
+// EventHandler is called for each published event.
+// Handlers are called synchronously, so they should not block (for example by moving work to another goroutine).
+type EventHandler func(event *Event)
+
+// EventBroker distributes events in process to all subscribed handlers.
+type EventBroker struct {
+	mutex       sync.RWMutex
+	nextId      int
+	subscribers map[int]EventHandler
+}
+
+func NewEventBroker() *EventBroker {
+	return &EventBroker{
+		nextId:      0,
+		subscribers: make(map[int]EventHandler),
+	}
+}
+
+// Subscribe registers a handler, the returned function removes the handler again.
+func (b *EventBroker) Subscribe(handler EventHandler) func() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	id := b.nextId
+	b.nextId++
+	b.subscribers[id] = handler
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		delete(b.subscribers, id)
+	}
+}
+
+// Publish calls all subscribed handlers with the event.
+func (b *EventBroker) Publish(event *Event) {
+	b.mutex.RLock()
+	handlers := make([]EventHandler, 0, len(b.subscribers))
+	for _, handler := range b.subscribers {
+		handlers = append(handlers, handler)
+	}
+	b.mutex.RUnlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// PublishEvent creates a new event and publishes it on the event broker.
+// Errors are only logged, the caller should not fail because an event can't be created.
+func (appContext *AppContext) PublishEvent(eventType string, data interface{}) {
+	event, eventErr := NewEvent(appContext.Clock, eventType, data)
+	if eventErr != nil {
+		appContext.Logger.Errorw("can't create event",
+			"event", eventType,
+			"error", eventErr)
+		return
+	}
+	appContext.Events.Publish(event)
+}
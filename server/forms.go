@@ -17,7 +17,9 @@ package server
 import (
 	"fmt"
 	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/goslugify"
 	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
 	"github.com/gorilla/schema"
 	"reflect"
 	"regexp"
@@ -95,11 +97,11 @@ func decodeHourMinuteFormField(s string) reflect.Value {
 
 const InternalDateFormat = "2006/01/02"
 
-var InternalDateFormatMomentJS = pollsweb.MomentJSDateFormatter.ConvertFormat(InternalDateFormat)
+var InternalDateFormatMomentJS = pollsweb.MomentJSDateFormatter.MustConvertFormat(InternalDateFormat)
 
 const InternalDateTimeFormat = "2006/01/02 15:04"
 
-var InternalDateTimeFormatMomentJS = pollsweb.MomentJSDateFormatter.ConvertFormat(InternalDateTimeFormat)
+var InternalDateTimeFormatMomentJS = pollsweb.MomentJSDateFormatter.MustConvertFormat(InternalDateTimeFormat)
 
 type DateFormField time.Time
 
@@ -240,6 +242,33 @@ func (form PeriodForm) ValidateForm() error {
 	return nil
 }
 
+// VotersToModels converts the voters of a form to voter models, ids and slugs are generated for all voters.
+func VotersToModels(voters []*gopolls.Voter) ([]*pollsdata.VoterModel, error) {
+	res := make([]*pollsdata.VoterModel, len(voters))
+	for i, voter := range voters {
+		id, idErr := pollsweb.GenUUID()
+		if idErr != nil {
+			return nil, idErr
+		}
+		model := pollsdata.NewVoterModel(voter.Name, goslugify.GenerateSlug(voter.Name), voter.Weight)
+		model.SetId(id)
+		res[i] = model
+	}
+	return res, nil
+}
+
+// ToModel creates a new period from the form, the slug is generated from the name.
+func (form PeriodForm) ToModel(clock pollsweb.Clock) (*pollsdata.PeriodSettingsModel, error) {
+	voters, votersErr := VotersToModels(form.Voters.Voters)
+	if votersErr != nil {
+		return nil, votersErr
+	}
+	meetingTime := pollsdata.NewMeetingTimeTemplateModel(time.Weekday(form.Weekday), form.MeetingTime.Hour,
+		form.MeetingTime.Minute)
+	return pollsdata.NewPeriodSettingsModel(clock, form.Name, goslugify.GenerateSlug(form.Name), meetingTime, voters,
+		time.Time(form.Start), time.Time(form.End)), nil
+}
+
 func DecodePeriodForm(src map[string][]string) (*PeriodForm, error) {
 	res := PeriodForm{}
 	err := DecodeForm(&res, src)
@@ -16,9 +16,26 @@ package server
 
 import (
 	"context"
+	"github.com/FabianWe/pollsweb/pollsdata"
 	"net/http"
 )
 
+// HomeMeetingsLimit is the number of upcoming meetings shown on the home page.
+const HomeMeetingsLimit = 5
+
 func HomeHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
-	return executeBuffered(requestContext.Templates.TemplateMap["home"], requestContext.PrepareTemplateRenderData(), w)
+	now := requestContext.Clock.Now()
+	open, openErr := requestContext.DataHandler.ListMeetings(ctx, pollsdata.NewMeetingListQuery().SetOpenForVoting(now))
+	if openErr != nil {
+		return openErr
+	}
+	upcoming, upcomingErr := requestContext.DataHandler.ListMeetings(ctx,
+		pollsdata.NewUpcomingMeetingsQuery(now).SetLimit(HomeMeetingsLimit))
+	if upcomingErr != nil {
+		return upcomingErr
+	}
+	data := requestContext.PrepareTemplateRenderData()
+	data["open_meetings"] = open
+	data["upcoming_meetings"] = upcoming
+	return executeBuffered(requestContext.Templates.TemplateMap["home"], data, w)
 }
@@ -22,8 +22,6 @@ import (
 	"github.com/FabianWe/pollsweb"
 	"github.com/FabianWe/pollsweb/pollsdata"
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 	"html/template"
 	"io"
@@ -36,24 +34,57 @@ import (
 
 const slugRegexString = `[a-zA-Z0-9_-]+`
 
-type MongoConfig struct {
-	UserName       string `mapstructure:"username"`
-	Password       string
-	Host           string
-	Port           int
-	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
-	Database       string
+const uuidRegexString = `[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{12}`
+
+// StorageConfig selects the storage driver, see pollsdata.StorageDriver.
+type StorageConfig struct {
+	Driver string
+	// Timeout is the timeout for opening and closing the storage
+	Timeout time.Duration
+	// DriverConfigs contains the configs of all registered drivers by their config key, the config sections are not
+	// decoded with the rest of the config, see DecodeDriverConfigs.
+	DriverConfigs map[string]interface{} `mapstructure:"-" valid:"-"`
+	// AllowPendingMigrations starts the server even if the database has pending migrations, this should only be used
+	// if the migrations are known to be compatible with the running version
+	AllowPendingMigrations bool `mapstructure:"allow_pending_migrations"`
+}
+
+func NewStorageConfig() *StorageConfig {
+	return &StorageConfig{
+		Driver:        pollsdata.MongoStorageDriverName,
+		Timeout:       time.Second * 10,
+		DriverConfigs: pollsdata.NewStorageDriverConfigs(),
+
+		AllowPendingMigrations: false,
+	}
+}
+
+// PendingMigrationsError is returned by NewAppContextFromConfig if the database has pending migrations and they're
+// not allowed, see StorageConfig.AllowPendingMigrations.
+type PendingMigrationsError struct {
+	NumPending int
+}
+
+func NewPendingMigrationsError(numPending int) PendingMigrationsError {
+	return PendingMigrationsError{
+		NumPending: numPending,
+	}
+}
+
+func (e PendingMigrationsError) Error() string {
+	return fmt.Sprintf("the database has %d pending migration(s), run \"pollsweb db migrate\" first or allow them with \"--allow-pending-migrations\"",
+		e.NumPending)
 }
 
-func NewMongoConfig() *MongoConfig {
-	return &MongoConfig{
-		UserName:       "",
-		Password:       "",
-		Host:           "localhost",
-		Port:           27017,
-		ConnectTimeout: time.Second * 10,
-		Database:       "gopolls",
+// DecodeDriverConfigs calls decode for the config of each driver, decode must decode the config section with the
+// given key into dst.
+func (config *StorageConfig) DecodeDriverConfigs(decode func(key string, dst interface{}) error) error {
+	for key, driverConfig := range config.DriverConfigs {
+		if err := decode(key, driverConfig); err != nil {
+			return fmt.Errorf("invalid config section \"%s\": %w", key, err)
+		}
 	}
+	return nil
 }
 
 type LocalizationConfig struct {
@@ -61,6 +92,9 @@ type LocalizationConfig struct {
 	DefaultDateFormat   string `mapstructure:"date_format"`
 	DefaultTimeFormat   string `mapstructure:"time_format"`
 	DefaultLanguage     string `mapstructure:"language"`
+	// FormatSyntax is the syntax used in DefaultDateFormat and DefaultTimeFormat, either "go" or the name of
+	// a translator in pollsweb.TimeFormatTranslators (for example "strftime").
+	FormatSyntax string `mapstructure:"format_syntax"`
 }
 
 func NewLocalizationConfig() *LocalizationConfig {
@@ -69,9 +103,53 @@ func NewLocalizationConfig() *LocalizationConfig {
 		DefaultDateFormat:   "02.01.2006",
 		DefaultTimeFormat:   "02.01.2006 15:04",
 		DefaultLanguage:     "de-DE",
+		FormatSyntax:        "go",
 	}
 }
 
+// ConvertFormatsToGo converts DefaultDateFormat and DefaultTimeFormat to Go layouts if FormatSyntax is not
+// "go". After a successful conversion FormatSyntax is set to "go".
+func (config *LocalizationConfig) ConvertFormatsToGo() error {
+	if config.FormatSyntax == "" || config.FormatSyntax == "go" {
+		config.FormatSyntax = "go"
+		return nil
+	}
+	translator, has := pollsweb.GetTimeFormatTranslator(config.FormatSyntax)
+	if !has {
+		return fmt.Errorf("unknown time format syntax \"%s\"", config.FormatSyntax)
+	}
+	dateFormat, dateErr := translator.ToGoLayout(config.DefaultDateFormat)
+	if dateErr != nil {
+		return dateErr
+	}
+	timeFormat, timeErr := translator.ToGoLayout(config.DefaultTimeFormat)
+	if timeErr != nil {
+		return timeErr
+	}
+	config.DefaultDateFormat, config.DefaultTimeFormat = dateFormat, timeFormat
+	config.FormatSyntax = "go"
+	return nil
+}
+
+// MomentJSFormats returns DefaultDateFormat and DefaultTimeFormat as moment.js formats, see
+// pollsweb.MomentJSDateFormatter. Formats in another syntax are converted to Go layouts first (the config is not
+// changed).
+func (config *LocalizationConfig) MomentJSFormats() (string, string, error) {
+	goConfig := *config
+	if convertErr := goConfig.ConvertFormatsToGo(); convertErr != nil {
+		return "", "", convertErr
+	}
+	dateFormat, dateErr := pollsweb.MomentJSDateFormatter.ConvertFormat(goConfig.DefaultDateFormat)
+	if dateErr != nil {
+		return "", "", dateErr
+	}
+	dateTimeFormat, dateTimeErr := pollsweb.MomentJSDateFormatter.ConvertFormat(goConfig.DefaultTimeFormat)
+	if dateTimeErr != nil {
+		return "", "", dateTimeErr
+	}
+	return dateFormat, dateTimeFormat, nil
+}
+
 type VotersLimitsConfig struct {
 	MaxNumVoters        int            `mapstructure:"max_num_voters"`
 	MaxVotersNameLength int            `mapstructure:"max_voters_name_length" valid:"range(5|250)"`
@@ -86,29 +164,68 @@ func NewVotersLimitsConfig() *VotersLimitsConfig {
 	}
 }
 
+type PollsLimitsConfig struct {
+	MaxNumPolls       int `mapstructure:"max_num_polls"`
+	MaxNumLines       int `mapstructure:"max_num_lines"`
+	MaxPollNameLength int `mapstructure:"max_poll_name_length" valid:"range(5|250)"`
+	MaxNumOptions     int `mapstructure:"max_num_options"`
+	MaxOptionLength   int `mapstructure:"max_option_length"`
+	MaxCurrencyValue  int `mapstructure:"max_currency_value"`
+}
+
+func NewPollsLimitsConfig() *PollsLimitsConfig {
+	return &PollsLimitsConfig{
+		MaxNumPolls:       200,
+		MaxNumLines:       5000,
+		MaxPollNameLength: 250,
+		MaxNumOptions:     50,
+		MaxOptionLength:   250,
+		MaxCurrencyValue:  -1,
+	}
+}
+
 type LimitsConfig struct {
 	Voters *VotersLimitsConfig
+	Polls  *PollsLimitsConfig
 }
 
 func NewLimitsConfig() *LimitsConfig {
-	return &LimitsConfig{Voters: NewVotersLimitsConfig()}
+	return &LimitsConfig{
+		Voters: NewVotersLimitsConfig(),
+		Polls:  NewPollsLimitsConfig(),
+	}
 }
 
 type AppConfig struct {
-	Mongodb      *MongoConfig
+	Storage      *StorageConfig
 	Localization *LocalizationConfig
 	Limits       *LimitsConfig
+	Calendar     *CalendarConfig
+	Mail         *MailConfig
+	Webhooks     *WebhookConfig
+	Minutes      *MinutesConfig
+	Scheduler    *SchedulerConfig
+	Audit        *AuditConfig
 }
 
 func NewAppConfig() *AppConfig {
 	return &AppConfig{
-		Mongodb:      NewMongoConfig(),
+		Storage:      NewStorageConfig(),
 		Localization: NewLocalizationConfig(),
 		Limits:       NewLimitsConfig(),
+		Calendar:     NewCalendarConfig(),
+		Mail:         NewMailConfig(),
+		Webhooks:     NewWebhookConfig(),
+		Minutes:      NewMinutesConfig(),
+		Scheduler:    NewSchedulerConfig(),
+		Audit:        NewAuditConfig(),
 	}
 }
 
 type AppContext struct {
+	// the number of audit log entries that could not be written, see AuditLog
+	// it's the first field to be aligned for atomic access on 32 bit platforms
+	auditFailures uint64
 	*AppConfig
 	Logger         *zap.SugaredLogger
 	DataHandler    pollsdata.DataHandler
@@ -125,6 +242,18 @@ type AppContext struct {
 	DefaultMomentJSDateTimeFormat string
 	// used to parse voters in all kinds of contexts
 	VotersParser *gopolls.VotersParser
+	// used to parse poll skeletons (agendas)
+	PollCollectionParser *gopolls.PollCollectionParser
+	// sends notifications to voters, nil if sending emails is disabled
+	// must be set by hand, the NewAppContext... methods don't do this. You can use InitNotifier.
+	Notifier *Notifier
+	// in process distribution of lifecycle events
+	Events *EventBroker
+	// generates meeting minutes
+	// must be set by hand, the NewAppContext... methods don't do this. You can use InitMinutes.
+	MinutesGenerator *MinutesGenerator
+	// the source of the current time, handlers should use it instead of time.Now
+	Clock pollsweb.Clock
 }
 
 func NewAppContext(config *AppConfig, logger *zap.SugaredLogger, dataHandler pollsdata.DataHandler, templateRoot string) *AppContext {
@@ -132,7 +261,17 @@ func NewAppContext(config *AppConfig, logger *zap.SugaredLogger, dataHandler pol
 	votersParser.MaxNumVoters = config.Limits.Voters.MaxNumVoters
 	votersParser.MaxVotersNameLength = config.Limits.Voters.MaxVotersNameLength
 	votersParser.MaxVotersWeight = config.Limits.Voters.MaxVotersWeight
+	pollsParser := gopolls.NewPollCollectionParser()
+	pollsParser.MaxNumPolls = config.Limits.Polls.MaxNumPolls
+	pollsParser.MaxNumLines = config.Limits.Polls.MaxNumLines
+	pollsParser.MaxPollNameLength = config.Limits.Polls.MaxPollNameLength
+	pollsParser.MaxGroupNameLength = config.Limits.Polls.MaxPollNameLength
+	pollsParser.MaxTitleLength = config.Limits.Polls.MaxPollNameLength
+	pollsParser.MaxNumOptions = config.Limits.Polls.MaxNumOptions
+	pollsParser.MaxOptionLength = config.Limits.Polls.MaxOptionLength
+	pollsParser.MaxCurrencyValue = config.Limits.Polls.MaxCurrencyValue
 	return &AppContext{
+		auditFailures:                 0,
 		AppConfig:                     config,
 		Logger:                        logger,
 		DataHandler:                   dataHandler,
@@ -143,41 +282,124 @@ func NewAppContext(config *AppConfig, logger *zap.SugaredLogger, dataHandler pol
 		DefaultMomentJSDateFormat:     "",
 		DefaultMomentJSDateTimeFormat: "",
 		VotersParser:                  votersParser,
+		PollCollectionParser:          pollsParser,
+		Notifier:                      nil,
+		Events:                        NewEventBroker(),
+		MinutesGenerator:              nil,
+		Clock:                         pollsweb.NewSystemClock(),
 	}
 }
 
-func NewAppContextMongo(ctx context.Context, config *AppConfig, logger *zap.SugaredLogger, templateRoot string) (*AppContext, error) {
-	uri := GetMongoURI(config.Mongodb.UserName,
-		config.Mongodb.Password,
-		config.Mongodb.Host,
-		config.Mongodb.Port)
+// NewAppContextFromConfig creates a new context with the storage selected in the config, see
+// pollsdata.OpenStorage.
+// If the storage has pending migrations a PendingMigrationsError is returned unless
+// StorageConfig.AllowPendingMigrations is set, the DataHandler of the returned context is set in this case anyway and
+// must be closed. If the storage doesn't support transactions (see pollsdata.TransactionChecker) a warning is logged
+// and records that have not been linked into their chain are linked (see pollsdata.LinkAllUnchainedRecords).
+// Invalid trusted proxy addresses in the audit config (see AuditConfig.ProxyNetworks) are reported
+// before the storage is opened.
+func NewAppContextFromConfig(ctx context.Context, config *AppConfig, logger *zap.SugaredLogger, templateRoot string) (*AppContext, error) {
 	res := NewAppContext(config, logger, nil, templateRoot)
-	logger.Info("connecting to mongodb")
-	mongoClient, connectErr := mongo.Connect(ctx, options.Client().ApplyURI(uri))
-	if connectErr != nil {
-		return res, connectErr
-	}
-	pingErr := mongoClient.Ping(ctx, nil)
-	if pingErr != nil {
-		return res, pingErr
-	}
-	logger.Info("connection to mongodb established")
-	mongoHandler := pollsdata.NewMongoDataHandler(mongoClient, config.Mongodb.Database)
-	res.DataHandler = mongoHandler
+	if _, proxiesErr := config.Audit.ProxyNetworks(); proxiesErr != nil {
+		return res, proxiesErr
+	}
+	logger.Infow("opening storage",
+		"driver", config.Storage.Driver)
+	dataHandler, openErr := pollsdata.OpenStorage(ctx, config.Storage.Driver, config.Storage.DriverConfigs)
+	if openErr != nil {
+		return res, openErr
+	}
+	logger.Info("storage opened")
+	res.DataHandler = dataHandler
+	if clockSetter, ok := dataHandler.(pollsdata.ClockSetter); ok {
+		clockSetter.SetClock(res.Clock)
+	}
+	numPending := 0
+	if migrationChecker, ok := dataHandler.(pollsdata.MigrationChecker); ok {
+		var pendingErr error
+		numPending, pendingErr = migrationChecker.PendingMigrations(ctx)
+		if pendingErr != nil {
+			return res, pendingErr
+		}
+		switch {
+		case numPending > 0 && !config.Storage.AllowPendingMigrations:
+			return res, NewPendingMigrationsError(numPending)
+		case numPending > 0:
+			logger.Warnw("the database has pending migrations, run \"pollsweb db migrate\"",
+				"num-pending", numPending)
+		}
+	}
+	if transactionChecker, ok := dataHandler.(pollsdata.TransactionChecker); ok {
+		supported, checkErr := transactionChecker.SupportsTransactions(ctx)
+		if checkErr != nil {
+			return res, checkErr
+		}
+		if !supported {
+			logger.Warnw("the storage doesn't support transactions (MongoDB requires a replica set), votes, polls and audit entries are not written atomically with their hash chain entries",
+				"driver", config.Storage.Driver)
+		}
+		// records might have been written without being linked into their chain before the server stopped, the
+		// chains can only be linked once the database is migrated
+		if !supported && numPending == 0 {
+			numLinked, linkErr := pollsdata.LinkAllUnchainedRecords(ctx, dataHandler)
+			if linkErr != nil {
+				return res, linkErr
+			}
+			if numLinked > 0 {
+				logger.Warnw("linked records that were written without being linked into their hash chain",
+					"num-linked", numLinked)
+			}
+		}
+	}
 	return res, nil
 }
 
-func (appContext *AppContext) SetTimeFormats() {
+func (appContext *AppContext) SetTimeFormats() error {
+	if convertErr := appContext.Localization.ConvertFormatsToGo(); convertErr != nil {
+		return convertErr
+	}
 	goDateFormat, goDateTimeFormat := appContext.Localization.DefaultDateFormat, appContext.Localization.DefaultTimeFormat
-	momentDateFormat, momentDateTimeFormat := pollsweb.MomentJSDateFormatter.ConvertFormat(goDateFormat),
-		pollsweb.MomentJSDateFormatter.ConvertFormat(goDateTimeFormat)
+	momentDateFormat, momentDateTimeFormat, momentErr := appContext.Localization.MomentJSFormats()
+	if momentErr != nil {
+		return momentErr
+	}
 	appContext.DefaultMomentJSDateFormat = momentDateFormat
 	appContext.DefaultMomentJSDateTimeFormat = momentDateTimeFormat
 	appContext.Logger.Debugw("automatically transformed time formats for support libraries",
-		"go-date-format", goDateTimeFormat,
+		"go-date-format", goDateFormat,
 		"moment-js-date-format", momentDateFormat,
 		"go-date-time-format", goDateTimeFormat,
 		"moment-js-date-time-format", momentDateTimeFormat)
+	return nil
+}
+
+// InitNotifier creates the Notifier from the mail config, if no mail driver is configured Notifier is set to nil.
+func (appContext *AppContext) InitNotifier() error {
+	mailer, mailerErr := NewMailerFromConfig(appContext.Mail, appContext.Clock, appContext.Logger)
+	if mailerErr != nil {
+		return mailerErr
+	}
+	if mailer == nil {
+		appContext.Logger.Info("no mail driver configured, notifications are disabled")
+		appContext.Notifier = nil
+		return nil
+	}
+	templates, templatesErr := LoadMailTemplates(appContext.Templates.RootPath, appContext.Localization)
+	if templatesErr != nil {
+		return templatesErr
+	}
+	appContext.Notifier = NewNotifier(appContext, mailer, templates)
+	return nil
+}
+
+// InitMinutes loads the minutes templates from the minutes config.
+func (appContext *AppContext) InitMinutes() error {
+	generator, err := LoadMinutesGenerator(appContext.Templates.RootPath, appContext.Minutes, appContext.Localization)
+	if err != nil {
+		return err
+	}
+	appContext.MinutesGenerator = generator
+	return nil
 }
 
 // TODO defer call to close, defer call to logger.sync
@@ -246,12 +468,38 @@ func (requestContext *RequestContext) GetTimezoneName() string {
 	return requestContext.Localization.DefaultTimezoneName
 }
 
+// GetMomentJSDateFormat returns the configured date format as moment.js format. The format converted by
+// SetTimeFormats is used if it has been called, otherwise the format is converted with
+// LocalizationConfig.MomentJSFormats. If the conversion fails the error is logged and the format of the date inputs
+// (InternalDateFormatMomentJS) is returned.
 func (requestContext *RequestContext) GetMomentJSDateFormat() string {
-	return pollsweb.MomentJSDateFormatter.ConvertFormat(requestContext.GetDateFormat())
+	if requestContext.DefaultMomentJSDateFormat != "" {
+		return requestContext.DefaultMomentJSDateFormat
+	}
+	dateFormat, _, err := requestContext.Localization.MomentJSFormats()
+	if err != nil {
+		requestContext.Logger.Errorw("can't convert the date format to a moment.js format",
+			"date-format", requestContext.Localization.DefaultDateFormat,
+			"error", err)
+		return InternalDateFormatMomentJS
+	}
+	return dateFormat
 }
 
+// GetMomentJSDateTimeFormat works like GetMomentJSDateFormat for the date time format, InternalDateTimeFormatMomentJS
+// is returned if the conversion fails.
 func (requestContext *RequestContext) GetMomentJSDateTimeFormat() string {
-	return pollsweb.MomentJSDateFormatter.ConvertFormat(requestContext.GetDateTimeFormat())
+	if requestContext.DefaultMomentJSDateTimeFormat != "" {
+		return requestContext.DefaultMomentJSDateTimeFormat
+	}
+	_, dateTimeFormat, err := requestContext.Localization.MomentJSFormats()
+	if err != nil {
+		requestContext.Logger.Errorw("can't convert the date time format to a moment.js format",
+			"date-time-format", requestContext.Localization.DefaultTimeFormat,
+			"error", err)
+		return InternalDateTimeFormatMomentJS
+	}
+	return dateTimeFormat
 }
 
 func (requestContext *RequestContext) FormatMeetingTime(meetingTime *pollsdata.MeetingTimeTemplateModel) string {
@@ -273,13 +521,14 @@ func (requestContext *RequestContext) URLString(name string, pairs ...string) (s
 }
 
 // TODO document: always close context
-func initWithMongo(config *AppConfig, logger *zap.SugaredLogger, templateRoot string) (*AppContext, error) {
-	ctx, startCtxCancel := context.WithTimeout(context.Background(), config.Mongodb.ConnectTimeout)
+func initStorage(config *AppConfig, logger *zap.SugaredLogger, templateRoot string) (*AppContext, error) {
+	ctx, startCtxCancel := context.WithTimeout(context.Background(), config.Storage.Timeout)
 	defer startCtxCancel()
-	return NewAppContextMongo(ctx, config, logger, templateRoot)
+	return NewAppContextFromConfig(ctx, config, logger, templateRoot)
 }
 
-func RunServerMongo(config *AppConfig, templateRoot, host string, port int, debug bool) {
+// RunServer runs the server with the storage selected in the config.
+func RunServer(config *AppConfig, templateRoot, host string, port int, debug bool) {
 	start := time.Now()
 	logger, loggerErr := pollsweb.InitLogger(debug)
 	if loggerErr != nil {
@@ -288,12 +537,12 @@ func RunServerMongo(config *AppConfig, templateRoot, host string, port int, debu
 	logger.Info("starting application")
 	logger.Debugw("running with configuration",
 		"config", config)
-	appContext, initErr := initWithMongo(config, logger, templateRoot)
+	appContext, initErr := initStorage(config, logger, templateRoot)
 	defer func() {
 		runtime := time.Since(start)
 		logger.Infow("stopping application",
 			"app-runtime", runtime)
-		closeCtx, closeDeferFunc := context.WithTimeout(context.Background(), config.Mongodb.ConnectTimeout)
+		closeCtx, closeDeferFunc := context.WithTimeout(context.Background(), config.Storage.Timeout)
 		defer closeDeferFunc()
 		if closeErr := appContext.Close(closeCtx); closeErr != nil {
 			logger.Errorw("shutting down application caused an error",
@@ -302,13 +551,17 @@ func RunServerMongo(config *AppConfig, templateRoot, host string, port int, debu
 		_ = logger.Sync()
 	}()
 	if initErr != nil {
-		logger.Errorw("error while setting up mongodb connection, exiting",
+		logger.Errorw("error while opening the storage, exiting",
 			"error", initErr)
 		return
 	}
 
 	// get the correct time formats for moment js
-	appContext.SetTimeFormats()
+	if formatErr := appContext.SetTimeFormats(); formatErr != nil {
+		logger.Errorw("invalid date / time format in config, exiting",
+			"error", formatErr)
+		return
+	}
 	// register form field decoders depending on the config
 	appContext.RegisterFormDecoders()
 	logger.Infow("loading templates",
@@ -326,6 +579,31 @@ func RunServerMongo(config *AppConfig, templateRoot, host string, port int, debu
 		logger.Infof("loaded %d templates", numTemplates)
 	}
 
+	if minutesErr := appContext.InitMinutes(); minutesErr != nil {
+		logger.Errorw("can't load minutes templates, exiting",
+			"error", minutesErr)
+		return
+	}
+
+	if notifierErr := appContext.InitNotifier(); notifierErr != nil {
+		logger.Errorw("can't initialize notifications, exiting",
+			"error", notifierErr)
+		return
+	}
+	if appContext.Notifier != nil {
+		schedulerCtx, cancelScheduler := context.WithCancel(context.Background())
+		defer cancelScheduler()
+		go NewNotificationScheduler(appContext.Notifier).Run(schedulerCtx)
+	}
+
+	webhooksCtx, cancelWebhooks := context.WithCancel(context.Background())
+	defer cancelWebhooks()
+	NewWebhookDispatcher(appContext).Start(webhooksCtx)
+
+	meetingSchedulerCtx, cancelMeetingScheduler := context.WithCancel(context.Background())
+	defer cancelMeetingScheduler()
+	go NewMeetingScheduler(appContext).Run(meetingSchedulerCtx)
+
 	r := mux.NewRouter()
 	// set router in context
 	appContext.Router = r
@@ -349,12 +627,99 @@ func RunServerMongo(config *AppConfig, templateRoot, host string, port int, debu
 		AppContext: appContext,
 		HandleFunc: EditPeriodDetailsHandleFunc,
 	}
+	deletePeriodHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: DeletePeriodHandleFunc,
+	}
+	periodMeetingsICalHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: PeriodMeetingsICalHandleFunc,
+	}
+	meetingICalHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: MeetingICalHandleFunc,
+	}
+	newMeetingHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: NewMeetingHandleFunc,
+	}
+	periodVotersImportHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: PeriodVotersImportHandleFunc,
+	}
+	meetingVotersImportHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: MeetingVotersImportHandleFunc,
+	}
+	meetingPollsImportHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: MeetingPollsImportHandleFunc,
+	}
+	meetingVotesImportHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: MeetingVotesImportHandleFunc,
+	}
+	meetingVotesTemplateHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: MeetingVotesTemplateHandleFunc,
+	}
+	meetingResultsHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: MeetingResultsHandleFunc,
+	}
+	meetingResultsPrintHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: MeetingResultsPrintHandleFunc,
+	}
+	meetingMinutesHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: MeetingMinutesHandleFunc,
+	}
+	meetingLiveHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: MeetingLiveHandleFunc,
+	}
+	meetingEventsHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: MeetingEventsHandleFunc,
+	}
+	meetingPollsHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: MeetingPollsHandleFunc,
+	}
+	webhooksListHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: WebhooksListHandleFunc,
+	}
+	listMeetingsHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: ListMeetingsHandleFunc,
+	}
+	deleteWebhookHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: DeleteWebhookHandleFunc,
+	}
+	webhookDeliveriesHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: WebhookDeliveriesHandleFunc,
+	}
+	auditListHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: AuditListHandleFunc,
+	}
+	auditExportHandler := Handler{
+		AppContext: appContext,
+		HandleFunc: AuditExportHandleFunc,
+	}
 	r.PathPrefix("/static/{file}").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./static")))).
 		Methods(http.MethodGet).
 		Name("static")
 	r.Handle("/", &homeHandler).
 		Methods(http.MethodGet).
 		Name("home")
+	r.Handle("/meetings", &listMeetingsHandler).
+		Methods(http.MethodGet).
+		Name("meetings-list")
 	r.Handle("/periods", &listPeriodsHandler).
 		Methods(http.MethodGet).
 		Name("periods-list")
@@ -367,6 +732,66 @@ func RunServerMongo(config *AppConfig, templateRoot, host string, port int, debu
 	r.Handle(fmt.Sprintf("/period/{slug:%s}/edit", slugRegexString), &editPeriodHandler).
 		Methods(http.MethodGet, http.MethodPost).
 		Name("periods-edit")
+	r.Handle(fmt.Sprintf("/period/{slug:%s}/delete", slugRegexString), &deletePeriodHandler).
+		Methods(http.MethodPost).
+		Name("periods-delete")
+	r.Handle(fmt.Sprintf("/period/{slug:%s}/meetings.ics", slugRegexString), &periodMeetingsICalHandler).
+		Methods(http.MethodGet).
+		Name("periods-meetings-ical")
+	r.Handle(fmt.Sprintf("/meeting/{slug:%s}.ics", slugRegexString), &meetingICalHandler).
+		Methods(http.MethodGet).
+		Name("meetings-ical")
+	r.Handle(fmt.Sprintf("/period/{slug:%s}/meetings/new", slugRegexString), &newMeetingHandler).
+		Methods(http.MethodGet, http.MethodPost).
+		Name("meetings-new")
+	r.Handle(fmt.Sprintf("/period/{slug:%s}/voters/import", slugRegexString), &periodVotersImportHandler).
+		Methods(http.MethodGet, http.MethodPost).
+		Name("periods-voters-import")
+	r.Handle(fmt.Sprintf("/meeting/{slug:%s}/voters/import", slugRegexString), &meetingVotersImportHandler).
+		Methods(http.MethodGet, http.MethodPost).
+		Name("meetings-voters-import")
+	r.Handle(fmt.Sprintf("/meeting/{slug:%s}/polls", slugRegexString), &meetingPollsHandler).
+		Methods(http.MethodGet, http.MethodPost).
+		Name("meetings-polls")
+	r.Handle(fmt.Sprintf("/meeting/{slug:%s}/polls/import", slugRegexString), &meetingPollsImportHandler).
+		Methods(http.MethodGet, http.MethodPost).
+		Name("meetings-polls-import")
+	r.Handle(fmt.Sprintf("/meeting/{slug:%s}/votes/import", slugRegexString), &meetingVotesImportHandler).
+		Methods(http.MethodGet, http.MethodPost).
+		Name("meetings-votes-import")
+	r.Handle(fmt.Sprintf("/meeting/{slug:%s}/votes/template.csv", slugRegexString), &meetingVotesTemplateHandler).
+		Methods(http.MethodGet).
+		Name("meetings-votes-template")
+	r.Handle(fmt.Sprintf("/meeting/{slug:%s}/results.{format:csv|json|md}", slugRegexString), &meetingResultsHandler).
+		Methods(http.MethodGet).
+		Name("meetings-results")
+	r.Handle(fmt.Sprintf("/meeting/{slug:%s}/results/print", slugRegexString), &meetingResultsPrintHandler).
+		Methods(http.MethodGet).
+		Name("meetings-results-print")
+	r.Handle(fmt.Sprintf("/meeting/{slug:%s}/minutes.{format:[a-z0-9]+}", slugRegexString), &meetingMinutesHandler).
+		Methods(http.MethodGet).
+		Name("meetings-minutes")
+	r.Handle(fmt.Sprintf("/meeting/{slug:%s}/live", slugRegexString), &meetingLiveHandler).
+		Methods(http.MethodGet).
+		Name("meetings-live")
+	r.Handle(fmt.Sprintf("/meeting/{slug:%s}/events", slugRegexString), &meetingEventsHandler).
+		Methods(http.MethodGet).
+		Name("meetings-events")
+	r.Handle("/webhooks", &webhooksListHandler).
+		Methods(http.MethodGet, http.MethodPost).
+		Name("webhooks-list")
+	r.Handle(fmt.Sprintf("/webhook/{id:%s}/delete", uuidRegexString), &deleteWebhookHandler).
+		Methods(http.MethodPost).
+		Name("webhooks-delete")
+	r.Handle(fmt.Sprintf("/webhook/{id:%s}/deliveries", uuidRegexString), &webhookDeliveriesHandler).
+		Methods(http.MethodGet).
+		Name("webhooks-deliveries")
+	r.Handle("/audit", &auditListHandler).
+		Methods(http.MethodGet).
+		Name("audit-list")
+	r.Handle("/audit/export.{format:csv|json}", &auditExportHandler).
+		Methods(http.MethodGet).
+		Name("audit-export")
 
 	// TODO test if shutdown later works correctly (closing mongodb)
 	http.Handle("/", r)
@@ -0,0 +1,480 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	iCalUTCFormat   = "20060102T150405Z"
+	iCalLocalFormat = "20060102T150405"
+	// lines longer than this (in octets) must be folded
+	iCalMaxLineLength = 75
+)
+
+type CalendarConfig struct {
+	// UIDDomain is appended to all event UIDs, it should be a domain name of the deployment
+	UIDDomain string `mapstructure:"uid_domain"`
+	// MeetingDuration is used as the duration of meetings (there is no end time stored for a meeting)
+	MeetingDuration time.Duration `mapstructure:"meeting_duration"`
+	// RefreshInterval is the interval suggested to calendar clients that subscribe to a feed
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+}
+
+func NewCalendarConfig() *CalendarConfig {
+	return &CalendarConfig{
+		UIDDomain:       "pollsweb",
+		MeetingDuration: 2 * time.Hour,
+		RefreshInterval: time.Hour,
+	}
+}
+
+// ICalEvent is an event (VEVENT) in an iCalendar file.
+//
+// If Location is nil Start and End are written in UTC, otherwise they're written as local time together with the
+// name of the location (TZID), the calendar then contains a VTIMEZONE for the location.
+// RecurrenceRule is optional and must be a valid RRULE value, ExceptionDates are occurrences of the rule that are
+// excluded (EXDATE), they must match the time of an occurrence.
+type ICalEvent struct {
+	UID            string
+	Summary        string
+	Description    string
+	URL            string
+	Start          time.Time
+	End            time.Time
+	Location       *time.Location
+	RecurrenceRule string
+	ExceptionDates []time.Time
+	LastModified   time.Time
+}
+
+// ICalendar is an iCalendar (RFC 5545) object containing a list of events.
+//
+// RefreshInterval is written as a hint for subscribed clients, it is ignored if it is zero.
+// Stamp is used as DTSTAMP for events without a LastModified time.
+type ICalendar struct {
+	ProductID       string
+	Name            string
+	RefreshInterval time.Duration
+	Stamp           time.Time
+	Events          []*ICalEvent
+}
+
+// NewICalendar returns a new calendar without events, Stamp is set to the current time of the clock.
+func NewICalendar(clock pollsweb.Clock, name string, refreshInterval time.Duration) *ICalendar {
+	return &ICalendar{
+		ProductID:       "-//FabianWe//pollsweb//EN",
+		Name:            name,
+		RefreshInterval: refreshInterval,
+		Stamp:           clock.Now(),
+		Events:          make([]*ICalEvent, 0),
+	}
+}
+
+// EscapeICalText escapes a string to be used as a TEXT value in an iCalendar file.
+func EscapeICalText(s string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	)
+	return replacer.Replace(s)
+}
+
+// FoldICalLine folds a content line such that no line is longer than 75 octets, continuation lines start with a
+// single space. Multi-byte characters are never split.
+func FoldICalLine(line string) string {
+	if len(line) <= iCalMaxLineLength {
+		return line
+	}
+	var buf strings.Builder
+	lineLength := 0
+	for _, r := range line {
+		runeLength := utf8.RuneLen(r)
+		if lineLength+runeLength > iCalMaxLineLength {
+			buf.WriteString("\r\n ")
+			// the space counts to the length of the line
+			lineLength = 1
+		}
+		buf.WriteRune(r)
+		lineLength += runeLength
+	}
+	return buf.String()
+}
+
+func formatICalTime(name string, t time.Time, loc *time.Location) string {
+	if loc == nil {
+		return fmt.Sprintf("%s:%s", name, t.UTC().Format(iCalUTCFormat))
+	}
+	return fmt.Sprintf("%s;TZID=%s:%s", name, loc.String(), t.In(loc).Format(iCalLocalFormat))
+}
+
+func formatICalOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, offset/3600, (offset%3600)/60)
+}
+
+// iCalTransition is a change of the UTC offset of a location.
+type iCalTransition struct {
+	at         time.Time
+	fromOffset int
+	toOffset   int
+	name       string
+}
+
+// iCalTransitions returns all changes of the UTC offset of loc between start and end.
+// It assumes that the offset changes at most once a day.
+func iCalTransitions(loc *time.Location, start, end time.Time) []iCalTransition {
+	res := make([]iCalTransition, 0, 2)
+	_, prevOffset := start.In(loc).Zone()
+	for t := start; t.Before(end); {
+		next := t.Add(24 * time.Hour)
+		_, nextOffset := next.In(loc).Zone()
+		if nextOffset != prevOffset {
+			// find the first second with the new offset
+			lo, hi := t, next
+			for hi.Sub(lo) > time.Second {
+				mid := lo.Add(hi.Sub(lo) / 2)
+				if _, offset := mid.In(loc).Zone(); offset == prevOffset {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			at := hi.Truncate(time.Second)
+			name, _ := at.In(loc).Zone()
+			res = append(res, iCalTransition{
+				at:         at,
+				fromOffset: prevOffset,
+				toOffset:   nextOffset,
+				name:       name,
+			})
+		}
+		t, prevOffset = next, nextOffset
+	}
+	return res
+}
+
+// iCalTimezone returns the lines of the VTIMEZONE component for loc, it must be valid for all times after reference.
+//
+// The observances are derived from the offset changes of loc in the year before reference, each is repeated yearly
+// on the same weekday of the month (for example the last Sunday in March). This matches the rules of most time zones.
+// A location without offset changes gets a single STANDARD observance.
+func iCalTimezone(loc *time.Location, reference time.Time) []string {
+	res := []string{"BEGIN:VTIMEZONE", "TZID:" + loc.String()}
+	start := time.Date(reference.In(loc).Year()-1, time.January, 1, 0, 0, 0, 0, time.UTC)
+	transitions := iCalTransitions(loc, start, start.AddDate(1, 0, 0))
+	if len(transitions) == 0 {
+		name, offset := start.In(loc).Zone()
+		return append(res,
+			"BEGIN:STANDARD",
+			"DTSTART:19700101T000000",
+			"TZOFFSETFROM:"+formatICalOffset(offset),
+			"TZOFFSETTO:"+formatICalOffset(offset),
+			"TZNAME:"+name,
+			"END:STANDARD",
+			"END:VTIMEZONE")
+	}
+	for _, transition := range transitions {
+		component := "STANDARD"
+		if transition.toOffset > transition.fromOffset {
+			component = "DAYLIGHT"
+		}
+		// DTSTART is the local time before the change
+		local := transition.at.In(time.FixedZone("", transition.fromOffset))
+		week := strconv.Itoa((local.Day()-1)/7 + 1)
+		if local.AddDate(0, 0, 7).Month() != local.Month() {
+			week = "-1"
+		}
+		weekday := strings.ToUpper(local.Weekday().String()[:2])
+		res = append(res,
+			"BEGIN:"+component,
+			"DTSTART:"+local.Format(iCalLocalFormat),
+			fmt.Sprintf("RRULE:FREQ=YEARLY;BYMONTH=%d;BYDAY=%s%s", local.Month(), week, weekday),
+			"TZOFFSETFROM:"+formatICalOffset(transition.fromOffset),
+			"TZOFFSETTO:"+formatICalOffset(transition.toOffset),
+			"TZNAME:"+transition.name,
+			"END:"+component)
+	}
+	return append(res, "END:VTIMEZONE")
+}
+
+func (cal *ICalendar) WriteTo(w io.Writer) (int64, error) {
+	writer := bufio.NewWriter(w)
+	var written int64
+	var writeErr error
+	writeLine := func(line string) {
+		if writeErr != nil {
+			return
+		}
+		var n int
+		n, writeErr = writer.WriteString(FoldICalLine(line) + "\r\n")
+		written += int64(n)
+	}
+	writeLine("BEGIN:VCALENDAR")
+	writeLine("VERSION:2.0")
+	writeLine("PRODID:" + cal.ProductID)
+	writeLine("CALSCALE:GREGORIAN")
+	writeLine("METHOD:PUBLISH")
+	if cal.Name != "" {
+		writeLine("X-WR-CALNAME:" + EscapeICalText(cal.Name))
+	}
+	if cal.RefreshInterval > 0 {
+		minutes := int64(cal.RefreshInterval / time.Minute)
+		if minutes < 1 {
+			minutes = 1
+		}
+		writeLine(fmt.Sprintf("REFRESH-INTERVAL;VALUE=DURATION:PT%dM", minutes))
+		writeLine(fmt.Sprintf("X-PUBLISHED-TTL:PT%dM", minutes))
+	}
+	// each location used by an event needs a VTIMEZONE, it must be valid from the earliest event on
+	locations := make([]*time.Location, 0)
+	earliest := make(map[string]time.Time)
+	for _, event := range cal.Events {
+		if event.Location == nil {
+			continue
+		}
+		name := event.Location.String()
+		first, has := earliest[name]
+		if !has {
+			locations = append(locations, event.Location)
+		}
+		if !has || event.Start.Before(first) {
+			earliest[name] = event.Start
+		}
+	}
+	for _, loc := range locations {
+		for _, line := range iCalTimezone(loc, earliest[loc.String()]) {
+			writeLine(line)
+		}
+	}
+	for _, event := range cal.Events {
+		stamp := event.LastModified
+		if stamp.IsZero() {
+			stamp = cal.Stamp
+		}
+		writeLine("BEGIN:VEVENT")
+		writeLine("UID:" + event.UID)
+		writeLine("DTSTAMP:" + stamp.UTC().Format(iCalUTCFormat))
+		if !event.LastModified.IsZero() {
+			writeLine("LAST-MODIFIED:" + event.LastModified.UTC().Format(iCalUTCFormat))
+		}
+		writeLine(formatICalTime("DTSTART", event.Start, event.Location))
+		if !event.End.IsZero() {
+			writeLine(formatICalTime("DTEND", event.End, event.Location))
+		}
+		if event.RecurrenceRule != "" {
+			writeLine("RRULE:" + event.RecurrenceRule)
+		}
+		for _, exception := range event.ExceptionDates {
+			writeLine(formatICalTime("EXDATE", exception, event.Location))
+		}
+		writeLine("SUMMARY:" + EscapeICalText(event.Summary))
+		if event.Description != "" {
+			writeLine("DESCRIPTION:" + EscapeICalText(event.Description))
+		}
+		if event.URL != "" {
+			writeLine("URL:" + event.URL)
+		}
+		writeLine("END:VEVENT")
+	}
+	writeLine("END:VCALENDAR")
+	if writeErr != nil {
+		return written, writeErr
+	}
+	return written, writer.Flush()
+}
+
+// MeetingICalEvents returns the events for a meeting: the meeting itself and (if set) the online voting window.
+//
+// The UIDs depend only on the id of the meeting, this way clients update the events instead of adding new ones.
+func MeetingICalEvents(meeting *pollsdata.MeetingModel, periodName string, config *CalendarConfig) []*ICalEvent {
+	res := make([]*ICalEvent, 0, 2)
+	description := ""
+	if periodName != "" {
+		description = "Period: " + periodName
+	}
+	res = append(res, &ICalEvent{
+		UID:          fmt.Sprintf("meeting-%s@%s", meeting.Id, config.UIDDomain),
+		Summary:      meeting.Name,
+		Description:  description,
+		Start:        meeting.MeetingTime,
+		End:          meeting.MeetingTime.Add(config.MeetingDuration),
+		LastModified: meeting.LastUpdated,
+	})
+	if !meeting.OnlineStart.IsZero() && !meeting.OnlineEnd.IsZero() {
+		res = append(res, &ICalEvent{
+			UID:          fmt.Sprintf("meeting-%s-voting@%s", meeting.Id, config.UIDDomain),
+			Summary:      "Online voting: " + meeting.Name,
+			Description:  description,
+			Start:        meeting.OnlineStart,
+			End:          meeting.OnlineEnd,
+			LastModified: meeting.LastUpdated,
+		})
+	}
+	return res
+}
+
+// PeriodTemplateICalEvent returns a weekly recurring event for the meeting time template of a period.
+//
+// The weekday and time of the template are interpreted in loc. The first occurrence is the first matching date on or
+// after the start of the period, the recurrence ends with the end of the period.
+// If there is no occurrence within the period nil is returned.
+func PeriodTemplateICalEvent(period *pollsdata.PeriodSettingsModel, loc *time.Location, config *CalendarConfig) *ICalEvent {
+	template := period.MeetingDateTemplate
+	if template == nil {
+		return nil
+	}
+	localStart := period.Start.In(loc)
+	first := time.Date(localStart.Year(), localStart.Month(), localStart.Day(),
+		int(template.Hour), int(template.Minute), 0, 0, loc)
+	daysUntil := (int(template.Weekday) - int(first.Weekday()) + 7) % 7
+	first = first.AddDate(0, 0, daysUntil)
+	if first.Before(period.Start) {
+		first = first.AddDate(0, 0, 7)
+	}
+	if !period.End.IsZero() && first.After(period.End) {
+		return nil
+	}
+	rule := "FREQ=WEEKLY"
+	if !period.End.IsZero() {
+		rule += ";UNTIL=" + period.End.UTC().Format(iCalUTCFormat)
+	}
+	return &ICalEvent{
+		UID:            fmt.Sprintf("period-%s-template@%s", period.Id, config.UIDDomain),
+		Summary:        period.Name,
+		Start:          first,
+		End:            first.Add(config.MeetingDuration),
+		Location:       loc,
+		RecurrenceRule: rule,
+		LastModified:   period.LastUpdated,
+	}
+}
+
+// TemplateExceptionDates returns the occurrences of a template event (see PeriodTemplateICalEvent) that are replaced
+// by one of the meetings: all occurrences on the same day (in the location of the event) as a meeting.
+// They should be used as ExceptionDates, otherwise calendar clients show these meetings twice.
+func TemplateExceptionDates(event *ICalEvent, meetings []*pollsdata.MeetingModel) []time.Time {
+	loc := event.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	start := event.Start.In(loc)
+	res := make([]time.Time, 0)
+	seen := make(map[int64]struct{})
+	for _, meeting := range meetings {
+		day := meeting.MeetingTime.In(loc)
+		occurrence := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), start.Second(), 0, loc)
+		if occurrence.Weekday() != start.Weekday() || occurrence.Before(event.Start) {
+			continue
+		}
+		if _, has := seen[occurrence.Unix()]; has {
+			continue
+		}
+		seen[occurrence.Unix()] = struct{}{}
+		res = append(res, occurrence)
+	}
+	return res
+}
+
+func writeICalendar(cal *ICalendar, fileName string, w http.ResponseWriter) error {
+	buff := getByteBuffer()
+	defer releaseBytesBuffer(buff)
+	if _, calErr := cal.WriteTo(buff); calErr != nil {
+		return calErr
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", fileName))
+	_, copyErr := io.Copy(w, buff)
+	return copyErr
+}
+
+// notFoundAsHandlerError returns an error with http status 404 if err is an EntryNotFoundError,
+// otherwise err is returned.
+func notFoundAsHandlerError(err error) error {
+	var notFound pollsdata.EntryNotFoundError
+	if errors.As(err, &notFound) {
+		return NewError(err, http.StatusNotFound)
+	}
+	return err
+}
+
+func PeriodMeetingsICalHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	slug := mux.Vars(r)["slug"]
+	period, getErr := requestContext.DataHandler.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetSlug(&slug))
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	meetings, meetingsErr := requestContext.DataHandler.GetMeetingsForPeriod(ctx, period.Id)
+	if meetingsErr != nil {
+		return meetingsErr
+	}
+	loc, locErr := time.LoadLocation(requestContext.GetTimezoneName())
+	if locErr != nil {
+		return locErr
+	}
+	config := requestContext.Calendar
+	cal := NewICalendar(requestContext.Clock, period.Name, config.RefreshInterval)
+	if templateEvent := PeriodTemplateICalEvent(period, loc, config); templateEvent != nil {
+		templateEvent.ExceptionDates = TemplateExceptionDates(templateEvent, meetings)
+		cal.Events = append(cal.Events, templateEvent)
+	}
+	for _, meeting := range meetings {
+		cal.Events = append(cal.Events, MeetingICalEvents(meeting, period.Name, config)...)
+	}
+	return writeICalendar(cal, period.Slug+".ics", w)
+}
+
+func MeetingICalHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	slug := mux.Vars(r)["slug"]
+	meeting, getErr := requestContext.DataHandler.GetMeeting(ctx, pollsdata.NewMeetingQueryArgs().SetSlug(&slug))
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	// the period is only used for the description, so a missing period is not an error
+	periodName := ""
+	period, periodErr := requestContext.DataHandler.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetId(&meeting.PeriodId))
+	var notFound pollsdata.EntryNotFoundError
+	switch {
+	case periodErr == nil:
+		periodName = period.Name
+	case !errors.As(periodErr, &notFound):
+		return periodErr
+	}
+	config := requestContext.Calendar
+	cal := NewICalendar(requestContext.Clock, meeting.Name, config.RefreshInterval)
+	cal.Events = append(cal.Events, MeetingICalEvents(meeting, periodName, config)...)
+	return writeICalendar(cal, meeting.Slug+".ics", w)
+}
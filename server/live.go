@@ -0,0 +1,235 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// LiveTurnoutEvent is the server-sent event containing the turnout of all polls
+	LiveTurnoutEvent = "turnout"
+	// LiveResultsEvent is the server-sent event containing the turnout and the results of all polls
+	LiveResultsEvent = "results"
+)
+
+// LivePollStatus is the live status of a poll: how many voters have voted and how much weight they represent.
+// Result is only set in a LiveResultsEvent.
+type LivePollStatus struct {
+	Id          uuid.UUID      `json:"id"`
+	Group       string         `json:"group"`
+	Name        string         `json:"name"`
+	NumVoted    int            `json:"num_voted"`
+	NumVoters   int            `json:"num_voters"`
+	WeightVoted gopolls.Weight `json:"weight_voted"`
+	WeightTotal gopolls.Weight `json:"weight_total"`
+	Result      string         `json:"result,omitempty"`
+}
+
+// ComputeTurnout returns the status of all polls in the meeting, the result is not set.
+func ComputeTurnout(meeting *pollsdata.MeetingModel) []*LivePollStatus {
+	weights := make(map[string]gopolls.Weight, len(meeting.Voters))
+	var totalWeight gopolls.Weight
+	for _, voter := range meeting.Voters {
+		weights[voter.Name] = voter.Weight
+		totalWeight += voter.Weight
+	}
+	res := make([]*LivePollStatus, 0)
+	for _, group := range meeting.Groups {
+		for _, poll := range group.Polls {
+			status := &LivePollStatus{
+				Id:          poll.GetId(),
+				Group:       group.Name,
+				Name:        pollName(poll),
+				NumVoters:   len(meeting.Voters),
+				WeightTotal: totalWeight,
+			}
+			for name := range pollsdata.PollVoterNames(poll) {
+				status.NumVoted++
+				status.WeightVoted += weights[name]
+			}
+			res = append(res, status)
+		}
+	}
+	return res
+}
+
+// ComputeLiveResults returns the status of all polls in the meeting including the results, the result of a poll is
+// pending until it is visible (see PollModel.ResultsVisible).
+func ComputeLiveResults(meeting *pollsdata.MeetingModel) ([]*LivePollStatus, error) {
+	res := ComputeTurnout(meeting)
+	// the generation time is not part of the live status
+	results, evalErr := EvaluateMeeting(meeting, false, time.Time{})
+	if evalErr != nil {
+		return nil, evalErr
+	}
+	i := 0
+	for _, group := range results.Groups {
+		for _, poll := range group.Polls {
+			res[i].Result = poll.OutcomeString()
+			i++
+		}
+	}
+	return res, nil
+}
+
+// InitialLiveEvent returns the event sent when a client connects to the live updates: a LiveResultsEvent if the
+// results of at least one poll are visible and a LiveTurnoutEvent otherwise.
+// This way a client that connects (or reconnects) after the results were published gets them right away.
+func InitialLiveEvent(meeting *pollsdata.MeetingModel) (string, []*LivePollStatus, error) {
+	for _, group := range meeting.Groups {
+		for _, poll := range group.Polls {
+			if poll.GetPollModel().ResultsVisible() {
+				results, evalErr := ComputeLiveResults(meeting)
+				return LiveResultsEvent, results, evalErr
+			}
+		}
+	}
+	return LiveTurnoutEvent, ComputeTurnout(meeting), nil
+}
+
+// WriteServerSentEvent writes a single server-sent event, data is encoded as JSON.
+func WriteServerSentEvent(w io.Writer, event string, data interface{}) error {
+	encoded, encodeErr := json.Marshal(data)
+	if encodeErr != nil {
+		return encodeErr
+	}
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, encoded)
+	return err
+}
+
+// MeetingEventsHandleFunc streams live updates of a meeting as server-sent events.
+//
+// On connect the event returned by InitialLiveEvent is sent. Whenever a vote is cast in the meeting a
+// LiveTurnoutEvent is sent, once voting is closed or the results are published a LiveResultsEvent is sent. Updates are coalesced: if many votes are cast at once the
+// meeting is read only once.
+// The stream is closed once the handler timeout is reached, clients (EventSource) reconnect automatically and get
+// the current state again.
+func MeetingEventsHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return NewError(errors.New("streaming is not supported"), http.StatusInternalServerError)
+	}
+	slug := mux.Vars(r)["slug"]
+	queryArgs := pollsdata.NewMeetingQueryArgs().
+		SetSlug(&slug)
+	meeting, getErr := requestContext.DataHandler.GetMeeting(ctx, queryArgs)
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	meetingId := meeting.Id
+
+	// buffered with size one: if an update is already pending the new one can be dropped
+	turnoutUpdates := make(chan struct{}, 1)
+	resultsUpdates := make(chan struct{}, 1)
+	notify := func(ch chan struct{}) {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	unsubscribe := requestContext.Events.Subscribe(func(event *Event) {
+		data, isMeetingEvent := event.Data.(MeetingEvent)
+		if !isMeetingEvent || data.MeetingId() != meetingId {
+			return
+		}
+		switch event.Type {
+		case VoteCastEvent, MeetingUpdatedEvent:
+			notify(turnoutUpdates)
+		case VotingClosedEvent, ResultsPublishedEvent:
+			notify(resultsUpdates)
+		}
+	})
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if _, err := io.WriteString(w, "retry: 2000\n\n"); err != nil {
+		return err
+	}
+	initialEvent, initialData, initialErr := InitialLiveEvent(meeting)
+	if initialErr != nil {
+		return initialErr
+	}
+	if err := WriteServerSentEvent(w, initialEvent, initialData); err != nil {
+		return err
+	}
+	flusher.Flush()
+
+	for {
+		var eventType string
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.Context().Done():
+			return nil
+		case <-turnoutUpdates:
+			eventType = LiveTurnoutEvent
+		case <-resultsUpdates:
+			eventType = LiveResultsEvent
+		}
+		meeting, getErr = requestContext.DataHandler.GetMeeting(ctx, queryArgs)
+		if getErr != nil {
+			// the response has already started, the error can't be reported to the client
+			requestContext.Logger.Errorw("can't load meeting for live updates",
+				"meeting", slug,
+				"error", getErr)
+			return nil
+		}
+		var data []*LivePollStatus
+		if eventType == LiveResultsEvent {
+			var evalErr error
+			data, evalErr = ComputeLiveResults(meeting)
+			if evalErr != nil {
+				requestContext.Logger.Errorw("can't compute live results",
+					"meeting", slug,
+					"error", evalErr)
+				return nil
+			}
+		} else {
+			data = ComputeTurnout(meeting)
+		}
+		if err := WriteServerSentEvent(w, eventType, data); err != nil {
+			return nil
+		}
+		flusher.Flush()
+	}
+}
+
+// MeetingLiveHandleFunc renders the live view of a meeting, the page is updated with MeetingEventsHandleFunc.
+func MeetingLiveHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	slug := mux.Vars(r)["slug"]
+	queryArgs := pollsdata.NewMeetingQueryArgs().
+		SetSlug(&slug)
+	meeting, getErr := requestContext.DataHandler.GetMeeting(ctx, queryArgs)
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	data := requestContext.PrepareTemplateRenderData()
+	data["meeting"] = meeting
+	data["turnout"] = ComputeTurnout(meeting)
+	return executeBuffered(requestContext.Templates.TemplateMap["meetings-live"], data, w)
+}
@@ -0,0 +1,214 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/FabianWe/pollsweb"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type MailConfig struct {
+	// Driver is one of "smtp", "file" or "log", an empty string disables sending emails
+	Driver   string
+	Host     string
+	Port     int
+	UserName string `mapstructure:"username"`
+	Password string
+	From     string
+	// Directory is the directory the "file" driver writes emails to
+	Directory string
+	// BaseURL is used to create links in emails, for example "https://polls.example.com"
+	BaseURL string `mapstructure:"base_url"`
+	// ReminderBefore is the duration before the end of online voting when reminders are sent
+	ReminderBefore time.Duration `mapstructure:"reminder_before"`
+	// CheckInterval is the interval in which the NotificationScheduler checks for meetings
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+}
+
+func NewMailConfig() *MailConfig {
+	return &MailConfig{
+		Driver:         "",
+		Host:           "localhost",
+		Port:           25,
+		UserName:       "",
+		Password:       "",
+		From:           "",
+		Directory:      "mails",
+		BaseURL:        "http://localhost:8080",
+		ReminderBefore: 24 * time.Hour,
+		CheckInterval:  time.Minute,
+	}
+}
+
+// Mail is a plain text email.
+type Mail struct {
+	From    string
+	To      []string
+	Subject string
+	Body    string
+}
+
+func NewMail(from string, to []string, subject, body string) *Mail {
+	return &Mail{
+		From:    from,
+		To:      to,
+		Subject: subject,
+		Body:    body,
+	}
+}
+
+// Bytes returns the message in RFC 5322 format (headers and body), lines are terminated by CRLF.
+func (m *Mail) Bytes(date time.Time) []byte {
+	var buf bytes.Buffer
+	writeHeader := func(name, value string) {
+		buf.WriteString(name)
+		buf.WriteString(": ")
+		buf.WriteString(value)
+		buf.WriteString("\r\n")
+	}
+	writeHeader("From", m.From)
+	writeHeader("To", strings.Join(m.To, ", "))
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	writeHeader("Date", date.Format(time.RFC1123Z))
+	writeHeader("MIME-Version", "1.0")
+	writeHeader("Content-Type", "text/plain; charset=utf-8")
+	writeHeader("Content-Transfer-Encoding", "8bit")
+	buf.WriteString("\r\n")
+	body := strings.ReplaceAll(m.Body, "\r\n", "\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(ctx context.Context, mail *Mail) error
+}
+
+// SMTPMailer sends emails with an SMTP server.
+// If UserName is not empty PLAIN authentication is used (net/smtp only allows this over TLS or to localhost).
+// Clock is used for the date of the emails.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	UserName string
+	Password string
+	Clock    pollsweb.Clock
+}
+
+func NewSMTPMailer(clock pollsweb.Clock, host string, port int, userName, password string) *SMTPMailer {
+	return &SMTPMailer{
+		Host:     host,
+		Port:     port,
+		UserName: userName,
+		Password: password,
+		Clock:    clock,
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, mail *Mail) error {
+	var auth smtp.Auth
+	if m.UserName != "" {
+		auth = smtp.PlainAuth("", m.UserName, m.Password, m.Host)
+	}
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	// net/smtp does not support contexts, so we run it in the background and stop waiting on cancellation
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, mail.From, mail.To, mail.Bytes(m.Clock.Now()))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// FileMailer writes each email to a file in Directory instead of sending it, this is useful for testing.
+// Clock is used for the date of the emails and the file names.
+type FileMailer struct {
+	Directory string
+	Clock     pollsweb.Clock
+	mutex     sync.Mutex
+	counter   int
+}
+
+func NewFileMailer(clock pollsweb.Clock, directory string) *FileMailer {
+	return &FileMailer{
+		Directory: directory,
+		Clock:     clock,
+	}
+}
+
+func (m *FileMailer) Send(ctx context.Context, mail *Mail) error {
+	if mkdirErr := os.MkdirAll(m.Directory, 0750); mkdirErr != nil {
+		return mkdirErr
+	}
+	m.mutex.Lock()
+	m.counter++
+	counter := m.counter
+	m.mutex.Unlock()
+	now := m.Clock.Now()
+	fileName := fmt.Sprintf("%s-%04d.eml", now.Format("20060102T150405.000000000"), counter)
+	return ioutil.WriteFile(filepath.Join(m.Directory, fileName), mail.Bytes(now), 0640)
+}
+
+// LogMailer writes emails to a logger instead of sending them, this is useful for testing.
+type LogMailer struct {
+	Logger *zap.SugaredLogger
+}
+
+func NewLogMailer(logger *zap.SugaredLogger) *LogMailer {
+	return &LogMailer{Logger: logger}
+}
+
+func (m *LogMailer) Send(ctx context.Context, mail *Mail) error {
+	m.Logger.Infow("sending mail (log only)",
+		"from", mail.From,
+		"to", mail.To,
+		"subject", mail.Subject,
+		"body", mail.Body)
+	return nil
+}
+
+// NewMailerFromConfig returns the Mailer described by the config, the clock is used for the date of the emails.
+// If no driver is set nil is returned (and no error).
+func NewMailerFromConfig(config *MailConfig, clock pollsweb.Clock, logger *zap.SugaredLogger) (Mailer, error) {
+	switch config.Driver {
+	case "":
+		return nil, nil
+	case "smtp":
+		return NewSMTPMailer(clock, config.Host, config.Port, config.UserName, config.Password), nil
+	case "file":
+		return NewFileMailer(clock, config.Directory), nil
+	case "log":
+		return NewLogMailer(logger), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver \"%s\"", config.Driver)
+	}
+}
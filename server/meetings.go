@@ -0,0 +1,210 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/FabianWe/goslugify"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+)
+
+// MeetingListForm contains the filters of the meetings list, all fields are optional.
+// When is one of "upcoming", "past" or "all" (the default is "upcoming"), Period is the slug of a period,
+// Name is a prefix of the meeting name and Cursor is the cursor of the page (see pollsdata.MeetingListQuery).
+type MeetingListForm struct {
+	When   string `schema:"when"`
+	Period string `schema:"period"`
+	Name   string `schema:"name"`
+	Cursor string `schema:"cursor"`
+}
+
+func DecodeMeetingListForm(src map[string][]string) (*MeetingListForm, error) {
+	res := MeetingListForm{}
+	err := DecodeForm(&res, src)
+	return &res, err
+}
+
+func (form *MeetingListForm) ValidateForm() error {
+	switch form.When {
+	case "":
+		form.When = "upcoming"
+	case "upcoming", "past", "all":
+	default:
+		return NewFormValidationError(fmt.Sprintf("invalid value \"%s\"", form.When)).SetFieldName("when")
+	}
+	return nil
+}
+
+func ListMeetingsHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	form, formErr := DecodeMeetingListForm(r.URL.Query())
+	if formErr != nil {
+		return NewError(formErr, http.StatusBadRequest)
+	}
+	now := requestContext.Clock.Now()
+	var query *pollsdata.MeetingListQuery
+	switch form.When {
+	case "past":
+		query = pollsdata.NewPastMeetingsQuery(now)
+	case "all":
+		query = pollsdata.NewMeetingListQuery().SetSort(pollsdata.MeetingSortMeetingTime, true)
+	default:
+		query = pollsdata.NewUpcomingMeetingsQuery(now)
+	}
+	query.SetNamePrefix(form.Name).SetCursor(form.Cursor)
+	if form.Period != "" {
+		period, periodErr := requestContext.DataHandler.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetSlug(&form.Period))
+		if periodErr != nil {
+			return notFoundAsHandlerError(periodErr)
+		}
+		query.SetPeriodId(&period.Id)
+	}
+	page, listErr := requestContext.DataHandler.ListMeetings(ctx, query)
+	if listErr != nil {
+		var invalidQuery pollsdata.InvalidQueryArgsError
+		if errors.As(listErr, &invalidQuery) {
+			return NewError(listErr, http.StatusBadRequest)
+		}
+		return listErr
+	}
+	periods, periodsErr := requestContext.DataHandler.GetLatestPeriods(ctx, -1, time.Time{})
+	if periodsErr != nil {
+		return periodsErr
+	}
+	data := requestContext.PrepareTemplateRenderData()
+	data["form"] = form
+	data["periods"] = periods
+	data["page"] = page
+	return executeBuffered(requestContext.Templates.TemplateMap["meetings-list"], data, w)
+}
+
+// MeetingForm is the form to create a new meeting in a period, all times are in UTC in the format
+// InternalDateTimeFormat.
+// OnlineStart and OnlineEnd are optional, if both are set the meeting has an online voting window.
+type MeetingForm struct {
+	Name        string            `schema:"meeting_name" valid:"runelength(5|250)"`
+	MeetingTime DateTimeFormField `schema:"meeting_time" valid:"-"`
+	OnlineStart string            `schema:"online_start" valid:"-"`
+	OnlineEnd   string            `schema:"online_end" valid:"-"`
+}
+
+func DecodeMeetingForm(src map[string][]string) (*MeetingForm, error) {
+	res := MeetingForm{}
+	err := DecodeForm(&res, src)
+	return &res, err
+}
+
+// onlineVoting returns the online voting window, both times are zero if there is no online voting.
+func (form *MeetingForm) onlineVoting() (start, end time.Time, err error) {
+	if form.OnlineStart == "" && form.OnlineEnd == "" {
+		return
+	}
+	if form.OnlineStart == "" || form.OnlineEnd == "" {
+		err = NewFormValidationError("start and end of online voting must be given both or not at all")
+		return
+	}
+	startField, startErr := ParseDateTimeFormField(form.OnlineStart)
+	if startErr != nil {
+		err = startErr.(*FormValidationError).SetFieldName("online_start")
+		return
+	}
+	endField, endErr := ParseDateTimeFormField(form.OnlineEnd)
+	if endErr != nil {
+		err = endErr.(*FormValidationError).SetFieldName("online_end")
+		return
+	}
+	start, end = time.Time(startField), time.Time(endField)
+	if !end.After(start) {
+		err = NewFormValidationError(fmt.Sprintf("online voting must end after it starts: start=\"%s\", end=\"%s\"",
+			form.OnlineStart, form.OnlineEnd))
+	}
+	return
+}
+
+func (form *MeetingForm) ValidateForm() error {
+	_, _, err := form.onlineVoting()
+	return err
+}
+
+// ToModel creates a new meeting in the period from the form, the slug is generated from the name and the voters
+// are copied from the period. All ids are generated.
+func (form *MeetingForm) ToModel(clock pollsweb.Clock, period *pollsdata.PeriodSettingsModel) (*pollsdata.MeetingModel, error) {
+	onlineStart, onlineEnd, onlineErr := form.onlineVoting()
+	if onlineErr != nil {
+		return nil, onlineErr
+	}
+	voters := make([]*pollsdata.VoterModel, len(period.Voters))
+	for i, voter := range period.Voters {
+		voters[i] = pollsdata.NewVoterModel(voter.Name, voter.Slug, voter.Weight).SetEmail(voter.Email)
+	}
+	res := pollsdata.NewMeetingModel(clock, form.Name, goslugify.GenerateSlug(form.Name), period.Id,
+		time.Time(form.MeetingTime), onlineStart, onlineEnd, voters, make([]*pollsdata.PollGroupModel, 0))
+	if idErr := res.GenIds(); idErr != nil {
+		return nil, idErr
+	}
+	return res, nil
+}
+
+// NewMeetingHandleFunc creates a new meeting in a period (see MeetingForm), the voters are notified about the new
+// meeting.
+func NewMeetingHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	slug := mux.Vars(r)["slug"]
+	period, getErr := requestContext.DataHandler.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetSlug(&slug))
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	if r.Method == http.MethodGet {
+		data := requestContext.PrepareTemplateRenderData()
+		data["period"] = period
+		return executeBuffered(requestContext.Templates.TemplateMap["meetings-new"], data, w)
+	}
+	if parseErr := r.ParseForm(); parseErr != nil {
+		return NewError(parseErr, http.StatusBadRequest)
+	}
+	form, formErr := DecodeMeetingForm(r.PostForm)
+	if formErr != nil {
+		return NewError(formErr, http.StatusBadRequest)
+	}
+	meeting, modelErr := form.ToModel(requestContext.Clock, period)
+	if modelErr != nil {
+		return modelErr
+	}
+	if insertErr := requestContext.DataHandler.InsertMeeting(ctx, meeting); insertErr != nil {
+		return validationAsHandlerError(insertErr)
+	}
+	requestContext.AuditLog(ctx, requestContext.NewAuditEntry(r, pollsdata.AuditMeetingCreated).
+		SetPeriodId(period.Id).
+		SetMeetingId(meeting.Id).
+		SetDetail("name", meeting.Name).
+		SetDetail("slug", meeting.Slug))
+	requestContext.PublishEvent(MeetingCreatedEvent, NewMeetingEventData(meeting))
+	if _, notifyErr := requestContext.Notifier.notifyOnce(ctx, MeetingCreatedNotification, meeting,
+		requestContext.Notifier.NotifyMeetingCreated); notifyErr != nil {
+		requestContext.Logger.Errorw("unable to notify voters about new meeting",
+			"meeting", meeting.Slug,
+			"error", notifyErr)
+	}
+	pollsURL, urlErr := requestContext.URLString("meetings-polls", "slug", meeting.Slug)
+	if urlErr != nil {
+		return urlErr
+	}
+	http.Redirect(w, r, pollsURL, http.StatusSeeOther)
+	return nil
+}
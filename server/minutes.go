@@ -0,0 +1,216 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// MinutesConfig configures the templates used to generate meeting minutes.
+type MinutesConfig struct {
+	// Templates maps a format (for example "md") to the template file used for it, relative paths are relative to
+	// the template root. The built-in formats "md" and "tex" can be replaced this way and new formats can be added.
+	Templates map[string]string
+	// ContentTypes maps a format to the content type of the generated document, it defaults to text/plain
+	ContentTypes map[string]string `mapstructure:"content_types"`
+}
+
+func NewMinutesConfig() *MinutesConfig {
+	return &MinutesConfig{
+		Templates: map[string]string{
+			"md":  filepath.Join("minutes", "minutes.md.gotxt"),
+			"tex": filepath.Join("minutes", "minutes.tex.gotxt"),
+		},
+		ContentTypes: map[string]string{
+			"md":  "text/markdown; charset=utf-8",
+			"tex": "application/x-tex; charset=utf-8",
+		},
+	}
+}
+
+// MinutesVoter is a voter in the minutes.
+type MinutesVoter struct {
+	Name   string
+	Weight gopolls.Weight
+}
+
+// MinutesData is passed to the minutes templates.
+//
+// There are no attendance records for a meeting, a voter is considered attending if it voted in at least one poll.
+type MinutesData struct {
+	Meeting         *pollsdata.MeetingModel
+	Results         *MeetingResults
+	Attending       []*MinutesVoter
+	Absent          []*MinutesVoter
+	AttendingWeight gopolls.Weight
+	TotalWeight     gopolls.Weight
+	Generated       time.Time
+}
+
+// NewMinutesData combines the meeting and its results, the results are computed by EvaluateMeeting.
+func NewMinutesData(meeting *pollsdata.MeetingModel, results *MeetingResults) *MinutesData {
+	voted := make(map[string]struct{}, len(meeting.Voters))
+	for _, group := range meeting.Groups {
+		for _, poll := range group.Polls {
+			for name := range pollsdata.PollVoterNames(poll) {
+				voted[name] = struct{}{}
+			}
+		}
+	}
+	res := &MinutesData{
+		Meeting:   meeting,
+		Results:   results,
+		Generated: results.Generated,
+	}
+	for _, voter := range meeting.Voters {
+		minutesVoter := &MinutesVoter{Name: voter.Name, Weight: voter.Weight}
+		res.TotalWeight += voter.Weight
+		if _, attending := voted[voter.Name]; attending {
+			res.Attending = append(res.Attending, minutesVoter)
+			res.AttendingWeight += voter.Weight
+		} else {
+			res.Absent = append(res.Absent, minutesVoter)
+		}
+	}
+	return res
+}
+
+var (
+	latexReplacer = strings.NewReplacer(
+		`\`, `\textbackslash{}`,
+		`{`, `\{`,
+		`}`, `\}`,
+		`$`, `\$`,
+		`&`, `\&`,
+		`#`, `\#`,
+		`^`, `\textasciicircum{}`,
+		`_`, `\_`,
+		`~`, `\textasciitilde{}`,
+		`%`, `\%`,
+	)
+	markdownReplacer = strings.NewReplacer(
+		`\`, `\\`,
+		"`", "\\`",
+		`*`, `\*`,
+		`_`, `\_`,
+		`#`, `\#`,
+		`|`, `\|`,
+		`[`, `\[`,
+		`]`, `\]`,
+	)
+)
+
+func minutesFuncMap(localization *LocalizationConfig) texttemplate.FuncMap {
+	res := mailFuncMap(localization)
+	res["latex"] = func(s interface{}) string {
+		return latexReplacer.Replace(fmt.Sprint(s))
+	}
+	res["md"] = func(s interface{}) string {
+		return markdownReplacer.Replace(fmt.Sprint(s))
+	}
+	res["join"] = strings.Join
+	return res
+}
+
+// MinutesGenerator generates meeting minutes from templates, one template per format.
+type MinutesGenerator struct {
+	Templates    map[string]*texttemplate.Template
+	ContentTypes map[string]string
+}
+
+// LoadMinutesGenerator loads all templates from the config, relative paths are relative to templateRoot.
+func LoadMinutesGenerator(templateRoot string, config *MinutesConfig, localization *LocalizationConfig) (*MinutesGenerator, error) {
+	res := &MinutesGenerator{
+		Templates:    make(map[string]*texttemplate.Template, len(config.Templates)),
+		ContentTypes: make(map[string]string, len(config.ContentTypes)),
+	}
+	funcMap := minutesFuncMap(localization)
+	for format, path := range config.Templates {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(templateRoot, path)
+		}
+		t, parseErr := texttemplate.New(filepath.Base(path)).Funcs(funcMap).ParseFiles(path)
+		if parseErr != nil {
+			return nil, fmt.Errorf("can't load minutes template for format \"%s\": %w", format, parseErr)
+		}
+		res.Templates[format] = t
+	}
+	for format, contentType := range config.ContentTypes {
+		res.ContentTypes[format] = contentType
+	}
+	return res, nil
+}
+
+// HasFormat returns true if a template for the format exists.
+func (generator *MinutesGenerator) HasFormat(format string) bool {
+	_, has := generator.Templates[format]
+	return has
+}
+
+// ContentType returns the content type of the format, it defaults to text/plain.
+func (generator *MinutesGenerator) ContentType(format string) string {
+	if contentType, has := generator.ContentTypes[format]; has {
+		return contentType
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// Generate writes the minutes in the given format to w.
+func (generator *MinutesGenerator) Generate(w io.Writer, format string, data *MinutesData) error {
+	t, has := generator.Templates[format]
+	if !has {
+		return fmt.Errorf("unknown minutes format \"%s\"", format)
+	}
+	return t.Execute(w, data)
+}
+
+// MeetingMinutesHandleFunc generates the minutes of a meeting, the format is given in the route.
+// The minutes contain the head of the hash chain of the meeting (Results.ChainHead).
+func MeetingMinutesHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	slug, format := vars["slug"], vars["format"]
+	if requestContext.MinutesGenerator == nil || !requestContext.MinutesGenerator.HasFormat(format) {
+		return NewError(fmt.Errorf("unknown minutes format \"%s\"", format), http.StatusNotFound)
+	}
+	queryArgs := pollsdata.NewMeetingQueryArgs().
+		SetSlug(&slug)
+	meeting, getErr := requestContext.DataHandler.GetMeeting(ctx, queryArgs)
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	results, evalErr := evaluatePublishedMeeting(ctx, requestContext, meeting, false)
+	if evalErr != nil {
+		return evalErr
+	}
+	var buf bytes.Buffer
+	if genErr := requestContext.MinutesGenerator.Generate(&buf, format, NewMinutesData(meeting, results)); genErr != nil {
+		return genErr
+	}
+	w.Header().Set("Content-Type", requestContext.MinutesGenerator.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-minutes.%s\"", meeting.Slug, format))
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,268 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+const (
+	MeetingCreatedNotification   = "meeting_created"
+	VotingOpenedNotification     = "voting_opened"
+	VotingReminderNotification   = "voting_reminder"
+	ResultsPublishedNotification = "results_published"
+)
+
+// MailTemplateData is passed to the mail templates.
+type MailTemplateData struct {
+	Voter      *pollsdata.VoterModel
+	Meeting    *pollsdata.MeetingModel
+	MeetingURL string
+}
+
+func mailFuncMap(localization *LocalizationConfig) texttemplate.FuncMap {
+	return texttemplate.FuncMap{
+		"format_datetime": func(t time.Time) string {
+			if t.IsZero() {
+				return ""
+			}
+			if loc, locErr := time.LoadLocation(localization.DefaultTimezoneName); locErr == nil {
+				t = t.In(loc)
+			}
+			return t.Format(localization.DefaultTimeFormat)
+		},
+	}
+}
+
+// LoadMailTemplates loads the templates for all notifications from the directory "mail" in templateRoot.
+//
+// Each notification has its own file (for example "voting_opened.gotxt") which must define the templates "subject"
+// and "body".
+func LoadMailTemplates(templateRoot string, localization *LocalizationConfig) (map[string]*texttemplate.Template, error) {
+	names := []string{
+		MeetingCreatedNotification,
+		VotingOpenedNotification,
+		VotingReminderNotification,
+		ResultsPublishedNotification,
+	}
+	res := make(map[string]*texttemplate.Template, len(names))
+	funcMap := mailFuncMap(localization)
+	for _, name := range names {
+		fileName := name + ".gotxt"
+		t, parseErr := texttemplate.New(fileName).Funcs(funcMap).
+			ParseFiles(filepath.Join(templateRoot, "mail", fileName))
+		if parseErr != nil {
+			return nil, fmt.Errorf("can't load mail template \"%s\": %w", name, parseErr)
+		}
+		res[name] = t
+	}
+	return res, nil
+}
+
+// Notifier sends notifications about meetings to voters.
+//
+// Voters without an email address are skipped. All methods can be called on a nil Notifier, in this case they
+// don't do anything (this way sending emails can be disabled).
+type Notifier struct {
+	*AppContext
+	Mailer    Mailer
+	Templates map[string]*texttemplate.Template
+}
+
+func NewNotifier(appContext *AppContext, mailer Mailer, templates map[string]*texttemplate.Template) *Notifier {
+	return &Notifier{
+		AppContext: appContext,
+		Mailer:     mailer,
+		Templates:  templates,
+	}
+}
+
+func (n *Notifier) meetingURL(meeting *pollsdata.MeetingModel) string {
+	return strings.TrimSuffix(n.Mail.BaseURL, "/") + "/meeting/" + meeting.Slug
+}
+
+func (n *Notifier) render(notification string, data *MailTemplateData) (subject, body string, err error) {
+	t, has := n.Templates[notification]
+	if !has {
+		err = fmt.Errorf("no mail template for notification \"%s\"", notification)
+		return
+	}
+	var buf strings.Builder
+	if err = t.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return
+	}
+	subject = strings.TrimSpace(buf.String())
+	buf.Reset()
+	if err = t.ExecuteTemplate(&buf, "body", data); err != nil {
+		return
+	}
+	body = strings.TrimSpace(buf.String()) + "\n"
+	return
+}
+
+// notify sends the notification to all voters (with an email address), it returns the number of emails sent.
+// Errors for single voters are logged and the first error is returned after all emails have been sent.
+func (n *Notifier) notify(ctx context.Context, notification string, meeting *pollsdata.MeetingModel, voters []*pollsdata.VoterModel) (int, error) {
+	if n == nil {
+		return 0, nil
+	}
+	var firstErr error
+	sent := 0
+	for _, voter := range voters {
+		if voter.Email == "" {
+			continue
+		}
+		data := &MailTemplateData{
+			Voter:      voter,
+			Meeting:    meeting,
+			MeetingURL: n.meetingURL(meeting),
+		}
+		subject, body, renderErr := n.render(notification, data)
+		if renderErr != nil {
+			return sent, renderErr
+		}
+		mail := NewMail(n.Mail.From, []string{voter.Email}, subject, body)
+		if sendErr := n.Mailer.Send(ctx, mail); sendErr != nil {
+			n.Logger.Errorw("unable to send notification",
+				"notification", notification,
+				"meeting", meeting.Slug,
+				"voter", voter.Name,
+				"error", sendErr)
+			if firstErr == nil {
+				firstErr = sendErr
+			}
+			continue
+		}
+		sent++
+	}
+	n.Logger.Infow("sent notifications",
+		"notification", notification,
+		"meeting", meeting.Slug,
+		"num-mails", sent)
+	return sent, firstErr
+}
+
+func (n *Notifier) NotifyMeetingCreated(ctx context.Context, meeting *pollsdata.MeetingModel) (int, error) {
+	return n.notify(ctx, MeetingCreatedNotification, meeting, meeting.Voters)
+}
+
+func (n *Notifier) NotifyVotingOpened(ctx context.Context, meeting *pollsdata.MeetingModel) (int, error) {
+	return n.notify(ctx, VotingOpenedNotification, meeting, meeting.Voters)
+}
+
+// NotifyVotingReminder sends a reminder to all voters that have not voted in all open polls of the meeting.
+func (n *Notifier) NotifyVotingReminder(ctx context.Context, meeting *pollsdata.MeetingModel) (int, error) {
+	return n.notify(ctx, VotingReminderNotification, meeting, meeting.VotersWithMissingVotes())
+}
+
+func (n *Notifier) NotifyResultsPublished(ctx context.Context, meeting *pollsdata.MeetingModel) (int, error) {
+	return n.notify(ctx, ResultsPublishedNotification, meeting, meeting.Voters)
+}
+
+// notifyOnce calls send unless the notification has already been sent for the meeting (see
+// pollsdata.MeetingModel.NotificationsSent).
+// The notification is marked as sent if send succeeded or if it was sent to at least one voter. The failures of a
+// partial success are logged by send and returned, but the notification is not sent again (otherwise all voters would
+// get it again each time the notifications are checked). If it wasn't sent to any voter it is tried again the next
+// time.
+func (n *Notifier) notifyOnce(ctx context.Context, notification string, meeting *pollsdata.MeetingModel,
+	send func(ctx context.Context, meeting *pollsdata.MeetingModel) (int, error)) (int, error) {
+	if n == nil || meeting.NotificationSent(notification) {
+		return 0, nil
+	}
+	sent, sendErr := send(ctx, meeting)
+	if sendErr != nil && sent == 0 {
+		return sent, sendErr
+	}
+	now := n.Clock.Now()
+	if markErr := n.DataHandler.SetMeetingNotificationSent(ctx, meeting.Id, notification, now); markErr != nil {
+		return sent, markErr
+	}
+	if meeting.NotificationsSent == nil {
+		meeting.NotificationsSent = make(map[string]time.Time, 1)
+	}
+	meeting.NotificationsSent[notification] = now
+	return sent, sendErr
+}
+
+// NotificationScheduler periodically checks for meetings with open online voting and sends the
+// "voting opened" notification and the reminders.
+//
+// Each notification is sent only once for a meeting, the notifications sent are stored in the meeting.
+type NotificationScheduler struct {
+	Notifier *Notifier
+}
+
+func NewNotificationScheduler(notifier *Notifier) *NotificationScheduler {
+	return &NotificationScheduler{
+		Notifier: notifier,
+	}
+}
+
+// Check sends all notifications that are due at referenceTime.
+//
+// An error for one meeting doesn't stop the notifications for the other meetings, errors are logged and the first
+// error is returned once all meetings have been checked.
+func (s *NotificationScheduler) Check(ctx context.Context, referenceTime time.Time) error {
+	notifier := s.Notifier
+	meetings, getErr := notifier.DataHandler.GetOnlineVotingMeetings(ctx, referenceTime)
+	if getErr != nil {
+		return getErr
+	}
+	var firstErr error
+	handleErr := func(notification string, meeting *pollsdata.MeetingModel, err error) {
+		notifier.Logger.Errorw("unable to send notification for meeting",
+			"notification", notification,
+			"meeting", meeting.Slug,
+			"error", err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, meeting := range meetings {
+		if _, notifyErr := notifier.notifyOnce(ctx, VotingOpenedNotification, meeting, notifier.NotifyVotingOpened); notifyErr != nil {
+			handleErr(VotingOpenedNotification, meeting, notifyErr)
+		}
+		if meeting.OnlineEnd.Sub(referenceTime) <= notifier.Mail.ReminderBefore {
+			if _, notifyErr := notifier.notifyOnce(ctx, VotingReminderNotification, meeting, notifier.NotifyVotingReminder); notifyErr != nil {
+				handleErr(VotingReminderNotification, meeting, notifyErr)
+			}
+		}
+	}
+	return firstErr
+}
+
+// Run calls Check every Mail.CheckInterval until ctx is done.
+func (s *NotificationScheduler) Run(ctx context.Context) {
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, s.Notifier.HandlerTimeout)
+		if checkErr := s.Check(checkCtx, s.Notifier.Clock.Now()); checkErr != nil {
+			s.Notifier.Logger.Errorw("error while checking for notifications",
+				"error", checkErr)
+		}
+		cancel()
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.Notifier.Clock.After(s.Notifier.Mail.CheckInterval):
+		}
+	}
+}
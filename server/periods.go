@@ -16,23 +16,57 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/FabianWe/goslugify"
 	"github.com/FabianWe/pollsweb/pollsdata"
 	"github.com/gorilla/mux"
 	"net/http"
-	"time"
 )
 
 // TODO return not founds
 // TODO dates / times: what is the meaning of Start for example? is this some UTC time? or always that day in local?
 
+// PeriodListForm contains the filters of the periods list, all fields are optional.
+// Name is a part of the period name, Active only shows the currently active periods and Archived includes archived
+// periods. Cursor is the cursor of the page (see pollsdata.PeriodListQuery).
+type PeriodListForm struct {
+	Name     string `schema:"name"`
+	Active   bool   `schema:"active"`
+	Archived bool   `schema:"archived"`
+	Cursor   string `schema:"cursor"`
+}
+
+func DecodePeriodListForm(src map[string][]string) (*PeriodListForm, error) {
+	res := PeriodListForm{}
+	err := DecodeForm(&res, src)
+	return &res, err
+}
+
 func ShowPeriodSettingsListHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
-	periods, periodsGetErr := requestContext.DataHandler.GetLatestPeriods(ctx, -1, time.Time{})
+	form, formErr := DecodePeriodListForm(r.URL.Query())
+	if formErr != nil {
+		return NewError(formErr, http.StatusBadRequest)
+	}
+	query := pollsdata.NewPeriodListQuery().
+		SetName(form.Name).
+		SetIncludeArchived(form.Archived).
+		SetCursor(form.Cursor)
+	if form.Active {
+		query.SetActiveAt(requestContext.Clock.Now())
+	}
+	page, periodsGetErr := requestContext.DataHandler.ListPeriods(ctx, query)
 	if periodsGetErr != nil {
+		var invalidQuery pollsdata.InvalidQueryArgsError
+		if errors.As(periodsGetErr, &invalidQuery) {
+			return NewError(periodsGetErr, http.StatusBadRequest)
+		}
 		return periodsGetErr
 	}
 	data := requestContext.PrepareTemplateRenderData()
-	data["periods_list"] = periods
+	data["form"] = form
+	data["page"] = page
+	data["periods_list"] = page.Periods
 	return executeBuffered(requestContext.Templates.TemplateMap["periods-list"], data, w)
 }
 
@@ -45,16 +79,78 @@ func PeriodDetailsHandleFunc(ctx context.Context, requestContext *RequestContext
 	if getErr != nil {
 		return getErr
 	}
+	meetings, meetingsErr := requestContext.DataHandler.GetMeetingsForPeriod(ctx, period.Id)
+	if meetingsErr != nil {
+		return meetingsErr
+	}
 	data := requestContext.PrepareTemplateRenderData()
 	data["period"] = period
+	data["meetings"] = meetings
 	return executeBuffered(requestContext.Templates.TemplateMap["periods-detail"], data, w)
 }
 
-func getEditPeriodDetailsHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+// PeriodRenameForm is the form to change the name and slug of a period, the slug is generated from the name if it
+// is empty. The meetings of the period reference it by id and are not affected.
+type PeriodRenameForm struct {
+	Name string `schema:"period_name" valid:"runelength(5|250)"`
+	Slug string `schema:"period_slug" valid:"-"`
+}
+
+func DecodePeriodRenameForm(src map[string][]string) (*PeriodRenameForm, error) {
+	res := PeriodRenameForm{}
+	err := DecodeForm(&res, src)
+	return &res, err
+}
+
+func (form *PeriodRenameForm) ValidateForm() error {
+	if form.Slug == "" {
+		form.Slug = goslugify.GenerateSlug(form.Name)
+	}
 	return nil
 }
 
+func getEditPeriodDetailsHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	slug := mux.Vars(r)["slug"]
+	period, getErr := requestContext.DataHandler.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetSlug(&slug))
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	data := requestContext.PrepareTemplateRenderData()
+	data["period"] = period
+	return executeBuffered(requestContext.Templates.TemplateMap["periods-edit"], data, w)
+}
+
 func postEditPeriodDetailsHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	slug := mux.Vars(r)["slug"]
+	period, getErr := requestContext.DataHandler.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetSlug(&slug))
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	if parseErr := r.ParseForm(); parseErr != nil {
+		return NewError(parseErr, http.StatusBadRequest)
+	}
+	form, formErr := DecodePeriodRenameForm(r.PostForm)
+	if formErr != nil {
+		return NewError(formErr, http.StatusBadRequest)
+	}
+	renameErr := requestContext.DataHandler.RenamePeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetId(&period.Id),
+		form.Name, form.Slug)
+	if renameErr != nil {
+		return validationAsHandlerError(renameErr)
+	}
+	auditErr := requestContext.AuditLog(ctx, requestContext.NewAuditEntry(r, pollsdata.AuditPeriodRenamed).
+		SetPeriodId(period.Id).
+		SetDetail("name", form.Name).
+		SetDetail("slug", form.Slug).
+		SetDetail("old_slug", period.Slug))
+	if auditErr != nil {
+		return fmt.Errorf("period has been renamed but can't be recorded in the audit log: %w", auditErr)
+	}
+	detailURL, urlErr := requestContext.URLString("periods-detail", "slug", form.Slug)
+	if urlErr != nil {
+		return urlErr
+	}
+	http.Redirect(w, r, detailURL, http.StatusSeeOther)
 	return nil
 }
 
@@ -79,9 +175,25 @@ func postNewPeriodHandleFunc(ctx context.Context, requestContext *RequestContext
 	// TODO deal with multierror etc here?
 	form, formErr := DecodePeriodForm(r.Form)
 	if formErr != nil {
-		return formErr
+		return NewError(formErr, http.StatusBadRequest)
+	}
+	period, periodErr := form.ToModel(requestContext.Clock)
+	if periodErr != nil {
+		return periodErr
+	}
+	if _, insertErr := requestContext.DataHandler.InsertPeriod(ctx, period); insertErr != nil {
+		return validationAsHandlerError(insertErr)
 	}
-	fmt.Println(form)
+	requestContext.PublishEvent(PeriodCreatedEvent, NewPeriodEventData(period))
+	requestContext.AuditLog(ctx, requestContext.NewAuditEntry(r, pollsdata.AuditPeriodCreated).
+		SetPeriodId(period.Id).
+		SetDetail("name", period.Name).
+		SetDetail("slug", period.Slug))
+	detailURL, urlErr := requestContext.URLString("periods-detail", "slug", period.Slug)
+	if urlErr != nil {
+		return urlErr
+	}
+	http.Redirect(w, r, detailURL, http.StatusSeeOther)
 	return nil
 }
 
@@ -91,3 +203,60 @@ func NewPeriodHandleFunc(ctx context.Context, requestContext *RequestContext, w
 	}
 	return postNewPeriodHandleFunc(ctx, requestContext, w, r)
 }
+
+// PeriodDeleteForm is the form to delete a period, Mode is a PeriodDeleteMode ("restrict", "cascade" or "archive").
+type PeriodDeleteForm struct {
+	Mode string `schema:"mode" valid:"in(restrict|cascade|archive)"`
+}
+
+func DecodePeriodDeleteForm(src map[string][]string) (*PeriodDeleteForm, error) {
+	res := PeriodDeleteForm{}
+	err := DecodeForm(&res, src)
+	return &res, err
+}
+
+// DeletePeriodHandleFunc deletes a period, see PeriodDeleteForm.
+// It returns an error with status conflict if the period still has meetings and the mode is "restrict".
+func DeletePeriodHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	slug := mux.Vars(r)["slug"]
+	if parseErr := r.ParseForm(); parseErr != nil {
+		return NewError(parseErr, http.StatusBadRequest)
+	}
+	form, formErr := DecodePeriodDeleteForm(r.PostForm)
+	if formErr != nil {
+		return NewError(formErr, http.StatusBadRequest)
+	}
+	mode, modeErr := pollsdata.ParsePeriodDeleteMode(form.Mode)
+	if modeErr != nil {
+		return NewError(modeErr, http.StatusBadRequest)
+	}
+	period, getErr := requestContext.DataHandler.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetSlug(&slug))
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	num, deleteErr := requestContext.DataHandler.DeletePeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetId(&period.Id), mode)
+	if deleteErr != nil {
+		var inUse pollsdata.PeriodInUseError
+		if errors.As(deleteErr, &inUse) {
+			return NewError(deleteErr, http.StatusConflict)
+		}
+		return deleteErr
+	}
+	if num == 0 {
+		return NewError(fmt.Errorf("period \"%s\" not found", slug), http.StatusNotFound)
+	}
+	action := pollsdata.AuditPeriodDeleted
+	if mode == pollsdata.PeriodDeleteArchive {
+		action = pollsdata.AuditPeriodArchived
+	}
+	requestContext.AuditLog(ctx, requestContext.NewAuditEntry(r, action).
+		SetPeriodId(period.Id).
+		SetDetail("slug", period.Slug).
+		SetDetail("mode", mode.String()))
+	listURL, urlErr := requestContext.URLString("periods-list")
+	if urlErr != nil {
+		return urlErr
+	}
+	http.Redirect(w, r, listURL, http.StatusSeeOther)
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// pollStateAsHandlerError returns a handler error with status conflict for errors caused by the state of a poll
+// (PollStateTransitionError, InvalidVoteError and InvalidPollsUpdateError), see also notFoundAsHandlerError.
+func pollStateAsHandlerError(err error) error {
+	var transitionErr pollsdata.PollStateTransitionError
+	var voteErr pollsdata.InvalidVoteError
+	var updateErr pollsdata.InvalidPollsUpdateError
+	if errors.As(err, &transitionErr) || errors.As(err, &voteErr) || errors.As(err, &updateErr) {
+		return NewError(err, http.StatusConflict)
+	}
+	return validationAsHandlerError(err)
+}
+
+// validationAsHandlerError returns a handler error with status bad request if err is a ModelValidationError and with
+// status conflict if err is a DuplicateEntryError, see also notFoundAsHandlerError.
+func validationAsHandlerError(err error) error {
+	var validationErr *pollsdata.ModelValidationError
+	if errors.As(err, &validationErr) {
+		return NewError(err, http.StatusBadRequest)
+	}
+	var duplicateErr pollsdata.DuplicateEntryError
+	if errors.As(err, &duplicateErr) {
+		return NewError(err, http.StatusConflict)
+	}
+	return notFoundAsHandlerError(err)
+}
+
+// PollStateForm is the form to change the state of a poll, UpdateToken is the update token of the meeting when the
+// form was rendered.
+type PollStateForm struct {
+	PollId      string `schema:"poll_id" valid:"uuidv4"`
+	State       string `schema:"state" valid:"in(open|closed|published)"`
+	UpdateToken int64  `schema:"update_token" valid:"-"`
+}
+
+func DecodePollStateForm(src map[string][]string) (*PollStateForm, error) {
+	res := PollStateForm{}
+	err := DecodeForm(&res, src)
+	return &res, err
+}
+
+// MeetingPollsHandleFunc lists the polls of a meeting with their state, a post request changes the state of a
+// poll (see PollStateForm).
+func MeetingPollsHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	slug := mux.Vars(r)["slug"]
+	queryArgs := pollsdata.NewMeetingQueryArgs().
+		SetSlug(&slug)
+	meeting, getErr := requestContext.DataHandler.GetMeeting(ctx, queryArgs)
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	if r.Method == http.MethodGet {
+		data := requestContext.PrepareTemplateRenderData()
+		data["meeting"] = meeting
+		return executeBuffered(requestContext.Templates.TemplateMap["meetings-polls"], data, w)
+	}
+	if parseErr := r.ParseForm(); parseErr != nil {
+		return NewError(parseErr, http.StatusBadRequest)
+	}
+	form, formErr := DecodePollStateForm(r.PostForm)
+	if formErr != nil {
+		return NewError(formErr, http.StatusBadRequest)
+	}
+	pollId, idErr := uuid.Parse(form.PollId)
+	if idErr != nil {
+		return NewError(idErr, http.StatusBadRequest)
+	}
+	// the update token makes sure that the chair has seen the current state of the meeting
+	updateArgs := pollsdata.NewMeetingQueryArgs().
+		SetId(&meeting.Id).
+		SetUpdateToken(&form.UpdateToken)
+	if updateErr := requestContext.DataHandler.UpdatePollState(ctx, updateArgs, pollId, form.State); updateErr != nil {
+		return pollStateAsHandlerError(updateErr)
+	}
+	if poll := meeting.GetPoll(pollId); poll != nil {
+		from := poll.GetPollModel().GetState()
+		poll.GetPollModel().State = form.State
+		requestContext.PublishEvent(PollStateEvent(form.State), NewPollEventData(meeting, poll))
+		action := pollsdata.AuditPollStateChanged
+		if form.State == pollsdata.PollStatePublished {
+			action = pollsdata.AuditResultsPublished
+		}
+		auditErr := requestContext.AuditLog(ctx, requestContext.NewAuditEntry(r, action).
+			SetPeriodId(meeting.PeriodId).
+			SetMeetingId(meeting.Id).
+			SetPollId(pollId).
+			SetDetail("poll", poll.GetPollModel().Name).
+			SetDetail("from", from).
+			SetDetail("to", form.State))
+		// the voters are notified once the results of all polls are published, the state has already changed
+		numPublished := meeting.CountPollsInState(pollsdata.PollStatePublished)
+		if form.State == pollsdata.PollStatePublished && numPublished == pollsdata.NewMeetingSummary(meeting).NumPolls {
+			if _, notifyErr := requestContext.Notifier.notifyOnce(ctx, ResultsPublishedNotification, meeting,
+				requestContext.Notifier.NotifyResultsPublished); notifyErr != nil {
+				requestContext.Logger.Errorw("unable to notify voters about published results",
+					"meeting", meeting.Slug,
+					"error", notifyErr)
+			}
+		}
+		if auditErr != nil && form.State == pollsdata.PollStatePublished {
+			return fmt.Errorf("results have been published but can't be recorded in the audit log: %w", auditErr)
+		}
+	}
+	pollsURL, urlErr := requestContext.URLString("meetings-polls", "slug", meeting.Slug)
+	if urlErr != nil {
+		return urlErr
+	}
+	http.Redirect(w, r, pollsURL, http.StatusSeeOther)
+	return nil
+}
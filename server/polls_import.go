@@ -0,0 +1,350 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/goslugify"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/gorilla/mux"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PollsImportMaxFileSize is the maximal size of an uploaded skeleton file in bytes.
+const PollsImportMaxFileSize = 1 << 20
+
+// SkeletonToPollModel converts a skeleton to a poll (without votes).
+//
+// A MoneyPollSkeleton becomes a MedianPollModel, a PollSkeleton with exactly two options becomes a BasicPollModel
+// and a PollSkeleton with more options becomes a SchulzePollModel.
+// This is the same translation as in gopolls.DefaultSkeletonConverter.
+func SkeletonToPollModel(skel gopolls.AbstractPollSkeleton, majority *pollsdata.MajorityModel, absoluteMajority bool) (pollsdata.AbstractPollModel, error) {
+	name := skel.GetName()
+	slug := goslugify.GenerateSlug(name)
+	switch typedSkel := skel.(type) {
+	case *gopolls.MoneyPollSkeleton:
+		if typedSkel.Value.ValueCents < 0 {
+			return nil, fmt.Errorf("value for median poll \"%s\" is not allowed to be < 0", name)
+		}
+		return pollsdata.NewMedianPollModel(name, slug, majority, absoluteMajority,
+			gopolls.MedianUnit(typedSkel.Value.ValueCents), typedSkel.Value.Currency,
+			make([]*pollsdata.MedianPollVoteModel, 0)), nil
+	case *gopolls.PollSkeleton:
+		switch numOptions := len(typedSkel.Options); {
+		case numOptions < 2:
+			return nil, fmt.Errorf("poll \"%s\" has only %d options, at least two are required", name, numOptions)
+		case numOptions == 2:
+			return pollsdata.NewBasicPollModel(name, slug, majority, absoluteMajority,
+				make([]*pollsdata.BasicPollVoteModel, 0)), nil
+		default:
+			options := make([]string, numOptions)
+			copy(options, typedSkel.Options)
+			return pollsdata.NewSchulzePollModel(name, slug, majority, absoluteMajority, options,
+				make([]*pollsdata.SchulzePollVoteModel, 0)), nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported skeleton type %s", skel.SkeletonType())
+	}
+}
+
+// SkeletonCollectionToGroups converts all groups of a collection to poll groups, all ids are generated.
+func SkeletonCollectionToGroups(collection *gopolls.PollSkeletonCollection, majority *pollsdata.MajorityModel, absoluteMajority bool) ([]*pollsdata.PollGroupModel, error) {
+	res := make([]*pollsdata.PollGroupModel, len(collection.Groups))
+	for i, group := range collection.Groups {
+		polls := make([]pollsdata.AbstractPollModel, len(group.Skeletons))
+		for j, skel := range group.Skeletons {
+			poll, pollErr := SkeletonToPollModel(skel, majority, absoluteMajority)
+			if pollErr != nil {
+				return nil, pollErr
+			}
+			polls[j] = poll
+		}
+		groupModel := pollsdata.NewPollGroupModel(group.Title, goslugify.GenerateSlug(group.Title), polls)
+		if idErr := groupModel.GenIds(); idErr != nil {
+			return nil, idErr
+		}
+		res[i] = groupModel
+	}
+	return res, nil
+}
+
+// DescribePoll returns a short description of the type and content of a poll, it is used to compare polls in
+// DiffPollGroups.
+func DescribePoll(poll pollsdata.AbstractPollModel) string {
+	var res string
+	switch typedPoll := poll.(type) {
+	case *pollsdata.BasicPollModel:
+		res = "basic poll"
+	case *pollsdata.MedianPollModel:
+		value := gopolls.NewCurrencyValue(int(typedPoll.Value), typedPoll.Currency)
+		res = "median poll: " + value.DefaultFormatString(".")
+	case *pollsdata.SchulzePollModel:
+		res = "schulze poll: " + strings.Join(typedPoll.Options, ", ")
+	default:
+		res = poll.ModelPollForType()
+	}
+	if poll.GetPollModel().RollCall {
+		res += " (roll call)"
+	}
+	return res
+}
+
+func pollName(poll pollsdata.AbstractPollModel) string {
+	switch typedPoll := poll.(type) {
+	case *pollsdata.BasicPollModel:
+		return typedPoll.Name
+	case *pollsdata.MedianPollModel:
+		return typedPoll.Name
+	case *pollsdata.SchulzePollModel:
+		return typedPoll.Name
+	default:
+		return ""
+	}
+}
+
+const (
+	PollDiffAdded     = "added"
+	PollDiffRemoved   = "removed"
+	PollDiffChanged   = "changed"
+	PollDiffUnchanged = "unchanged"
+)
+
+// PollDiffEntry describes the difference of a single poll between the current polls of a meeting and the imported
+// polls. Old and New are descriptions as returned by DescribePoll, NumVotes is the number of votes that exist for
+// the current poll (these votes are lost if the poll is changed or removed).
+type PollDiffEntry struct {
+	Kind     string
+	Group    string
+	Poll     string
+	Old      string
+	New      string
+	NumVotes int
+}
+
+type pollWithGroup struct {
+	group *pollsdata.PollGroupModel
+	poll  pollsdata.AbstractPollModel
+}
+
+func pollKey(group, poll string) string {
+	return group + "\x00" + poll
+}
+
+func indexPolls(groups []*pollsdata.PollGroupModel) map[string]pollWithGroup {
+	res := make(map[string]pollWithGroup)
+	for _, group := range groups {
+		for _, poll := range group.Polls {
+			res[pollKey(group.Name, pollName(poll))] = pollWithGroup{group: group, poll: poll}
+		}
+	}
+	return res
+}
+
+// DiffPollGroups compares the current polls with the new polls, polls are identified by the name of their group and
+// their own name.
+//
+// The entries for the new polls come first (in the order of newGroups), followed by the removed polls.
+func DiffPollGroups(oldGroups, newGroups []*pollsdata.PollGroupModel) []*PollDiffEntry {
+	oldPolls := indexPolls(oldGroups)
+	res := make([]*PollDiffEntry, 0, len(oldPolls))
+	seen := make(map[string]bool, len(oldPolls))
+	for _, group := range newGroups {
+		for _, poll := range group.Polls {
+			name := pollName(poll)
+			key := pollKey(group.Name, name)
+			seen[key] = true
+			entry := &PollDiffEntry{
+				Kind:  PollDiffAdded,
+				Group: group.Name,
+				Poll:  name,
+				New:   DescribePoll(poll),
+			}
+			if old, has := oldPolls[key]; has {
+				entry.Old = DescribePoll(old.poll)
+				entry.NumVotes = len(pollsdata.PollVoterNames(old.poll))
+				if entry.Old == entry.New {
+					entry.Kind = PollDiffUnchanged
+				} else {
+					entry.Kind = PollDiffChanged
+				}
+			}
+			res = append(res, entry)
+		}
+	}
+	for _, group := range oldGroups {
+		for _, poll := range group.Polls {
+			name := pollName(poll)
+			if seen[pollKey(group.Name, name)] {
+				continue
+			}
+			res = append(res, &PollDiffEntry{
+				Kind:     PollDiffRemoved,
+				Group:    group.Name,
+				Poll:     name,
+				Old:      DescribePoll(poll),
+				NumVotes: len(pollsdata.PollVoterNames(poll)),
+			})
+		}
+	}
+	return res
+}
+
+// MergePollGroups returns newGroups, but each unchanged poll (see DiffPollGroups) is replaced by the current poll.
+// This way ids and votes of unchanged polls are kept when polls are imported again.
+func MergePollGroups(oldGroups, newGroups []*pollsdata.PollGroupModel) []*pollsdata.PollGroupModel {
+	oldPolls := indexPolls(oldGroups)
+	for _, group := range newGroups {
+		for i, poll := range group.Polls {
+			old, has := oldPolls[pollKey(group.Name, pollName(poll))]
+			if has && DescribePoll(old.poll) == DescribePoll(poll) {
+				group.Polls[i] = old.poll
+				group.SetId(old.group.Id)
+			}
+		}
+	}
+	return newGroups
+}
+
+// PreviewPollsImport converts the collection to poll groups and merges them with the current groups of a meeting (see
+// DiffPollGroups and MergePollGroups), if rollCall is true all new polls are roll calls.
+// It returns an error if a poll can't be converted, if a poll that is not a draft would be changed (see
+// pollsdata.CheckPollGroupsUpdate) or if the merged groups are not valid (see pollsdata.ValidatePollGroups), so the
+// groups of a preview without an error can be stored.
+func PreviewPollsImport(current []*pollsdata.PollGroupModel, collection *gopolls.PollSkeletonCollection, rollCall bool) ([]*PollDiffEntry, []*pollsdata.PollGroupModel, error) {
+	groups, convertErr := SkeletonCollectionToGroups(collection, pollsdata.NewMajorityModel(1, 2), false)
+	if convertErr != nil {
+		return nil, nil, convertErr
+	}
+	for _, group := range groups {
+		for _, poll := range group.Polls {
+			poll.GetPollModel().RollCall = rollCall
+		}
+	}
+	diff := DiffPollGroups(current, groups)
+	groups = MergePollGroups(current, groups)
+	// polls that are not drafts can't be changed, this would change their state or votes
+	if checkErr := pollsdata.CheckPollGroupsUpdate(current, groups); checkErr != nil {
+		return diff, nil, checkErr
+	}
+	if validateErr := pollsdata.ValidatePollGroups(groups); validateErr != nil {
+		return diff, nil, validateErr
+	}
+	return diff, groups, nil
+}
+
+// PollsImportForm is the form for importing polls from a skeleton.
+//
+// The skeleton can also be uploaded in the multipart field "skeleton_file", in this case it replaces Skeleton.
+// Action is either "preview" or "apply". If RollCall is true all imported polls are roll calls
+// (see PollModel.RollCall).
+type PollsImportForm struct {
+	Skeleton string `schema:"skeleton" valid:"-"`
+	RollCall bool   `schema:"roll_call" valid:"-"`
+	Action   string `schema:"action" valid:"in(preview|apply)"`
+}
+
+func DecodePollsImportForm(src map[string][]string) (*PollsImportForm, error) {
+	res := PollsImportForm{}
+	err := DecodeForm(&res, src)
+	return &res, err
+}
+
+func readPollsImportFile(r *http.Request, form *PollsImportForm) (string, error) {
+	file, _, fileErr := r.FormFile("skeleton_file")
+	if fileErr != nil {
+		if fileErr == http.ErrMissingFile {
+			return form.Skeleton, nil
+		}
+		return "", NewError(fileErr, http.StatusBadRequest)
+	}
+	defer file.Close()
+	content, readErr := ioutil.ReadAll(io.LimitReader(file, PollsImportMaxFileSize))
+	if readErr != nil {
+		return "", readErr
+	}
+	return string(content), nil
+}
+
+func MeetingPollsImportHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	slug := mux.Vars(r)["slug"]
+	queryArgs := pollsdata.NewMeetingQueryArgs().
+		SetSlug(&slug)
+	meeting, getErr := requestContext.DataHandler.GetMeeting(ctx, queryArgs)
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	data := requestContext.PrepareTemplateRenderData()
+	data["meeting"] = meeting
+	if r.Method == http.MethodGet {
+		return executeBuffered(requestContext.Templates.TemplateMap["meetings-polls-import"], data, w)
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 2*PollsImportMaxFileSize)
+	if parseErr := r.ParseMultipartForm(PollsImportMaxFileSize); parseErr != nil {
+		return NewError(parseErr, http.StatusBadRequest)
+	}
+	form, formErr := DecodePollsImportForm(r.PostForm)
+	if formErr != nil {
+		return NewError(formErr, http.StatusBadRequest)
+	}
+	skeleton, readErr := readPollsImportFile(r, form)
+	if readErr != nil {
+		return readErr
+	}
+	data["skeleton"] = skeleton
+	data["roll_call"] = form.RollCall
+	collection, parseErr := requestContext.PollCollectionParser.ParseCollectionSkeletons(strings.NewReader(skeleton),
+		gopolls.DefaultCurrencyHandler)
+	if parseErr != nil {
+		// show the error in the form, it is most likely a syntax error in the skeleton
+		data["parse_error"] = parseErr.Error()
+		return executeBuffered(requestContext.Templates.TemplateMap["meetings-polls-import"], data, w)
+	}
+	if name, hasDuplicate := collection.HasDuplicateSkeleton(); hasDuplicate {
+		data["parse_error"] = fmt.Sprintf("duplicate poll \"%s\"", name)
+		return executeBuffered(requestContext.Templates.TemplateMap["meetings-polls-import"], data, w)
+	}
+	diff, groups, previewErr := PreviewPollsImport(meeting.Groups, collection, form.RollCall)
+	if diff != nil {
+		data["diff"] = diff
+	}
+	if previewErr != nil {
+		data["parse_error"] = previewErr.Error()
+		return executeBuffered(requestContext.Templates.TemplateMap["meetings-polls-import"], data, w)
+	}
+	if form.Action == "apply" {
+		// the update token makes sure that the meeting was not changed in the meantime
+		updateArgs := pollsdata.NewMeetingQueryArgs().
+			SetId(&meeting.Id).
+			SetUpdateToken(&meeting.UpdateToken)
+		if updateErr := requestContext.DataHandler.UpdateMeetingGroups(ctx, updateArgs, groups); updateErr != nil {
+			return pollStateAsHandlerError(updateErr)
+		}
+		meeting.Groups = groups
+		requestContext.PublishEvent(MeetingUpdatedEvent, NewMeetingEventData(meeting))
+		requestContext.AuditLog(ctx, requestContext.NewAuditEntry(r, pollsdata.AuditMeetingPollsUpdated).
+			SetPeriodId(meeting.PeriodId).
+			SetMeetingId(meeting.Id).
+			SetDetail("groups", strconv.Itoa(len(groups))).
+			SetDetail("polls", strconv.Itoa(pollsdata.NewMeetingSummary(meeting).NumPolls)))
+		data["applied"] = true
+	}
+	return executeBuffered(requestContext.Templates.TemplateMap["meetings-polls-import"], data, w)
+}
@@ -0,0 +1,611 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResultsFormatVersion is the version of the JSON results format (MeetingResults).
+//
+// It is increased whenever a field is removed or its meaning changes, new fields may be added without changing the
+// version. Version 2 replaced the period slug of the meeting with the period id.
+const ResultsFormatVersion = 2
+
+const (
+	PollOutcomeAccepted = "accepted"
+	PollOutcomeRejected = "rejected"
+	// PollOutcomeNoVotes is the outcome of a poll without any votes
+	PollOutcomeNoVotes = "no_votes"
+	// PollOutcomeRanked is the outcome of a schulze poll, the result is the ranking
+	PollOutcomeRanked = "ranked"
+	// PollOutcomePending is the outcome of a poll whose results are not published yet, no results are available
+	PollOutcomePending = "pending"
+)
+
+// MajorityResult describes the majority required in a poll.
+//
+// Numerator / Denominator is the majority from the MajorityModel (for example 1/2), if Absolute is true the majority
+// is computed on the weight of all voters of the meeting, otherwise on the votes cast (for basic polls abstentions
+// are not counted). Base is this weight and Required the majority computed from it: strictly more than Required
+// votes (by weight) are needed.
+type MajorityResult struct {
+	Numerator   int64          `json:"numerator"`
+	Denominator int64          `json:"denominator"`
+	Absolute    bool           `json:"absolute"`
+	Base        gopolls.Weight `json:"base"`
+	Required    gopolls.Weight `json:"required"`
+}
+
+func newMajorityResult(majority *pollsdata.MajorityModel, absolute bool, base gopolls.Weight) *MajorityResult {
+	res := &MajorityResult{
+		Numerator:   majority.Numerator,
+		Denominator: majority.Denominator,
+		Absolute:    absolute,
+		Base:        base,
+		Required:    0,
+	}
+	if majority.Denominator > 0 {
+		res.Required = gopolls.ComputeMajority(big.NewRat(majority.Numerator, majority.Denominator), base)
+	}
+	return res
+}
+
+func (m *MajorityResult) String() string {
+	s := fmt.Sprintf("%d/%d", m.Numerator, m.Denominator)
+	if m.Absolute {
+		s += " (absolute)"
+	}
+	return s
+}
+
+// BasicCounts counts the answers in a basic poll, either by number of voters or by weight.
+type BasicCounts struct {
+	Ayes        gopolls.Weight `json:"ayes"`
+	Noes        gopolls.Weight `json:"noes"`
+	Abstentions gopolls.Weight `json:"abstentions"`
+}
+
+func newBasicCounts(counter *gopolls.BasicPollCounter) *BasicCounts {
+	return &BasicCounts{
+		Ayes:        counter.NumAyes,
+		Noes:        counter.NumNoes,
+		Abstentions: counter.NumAbstention,
+	}
+}
+
+// BasicPollOutcome is the result of a basic (yes / no / abstention) poll.
+type BasicPollOutcome struct {
+	Unweighted *BasicCounts `json:"unweighted"`
+	Weighted   *BasicCounts `json:"weighted"`
+}
+
+// MedianPollOutcome is the result of a median poll, all values are in cents.
+// MajorityValue is the highest value that got the required majority, it is -1 if there is no such value.
+type MedianPollOutcome struct {
+	Value         int64  `json:"value"`
+	Currency      string `json:"currency"`
+	MajorityValue int64  `json:"majority_value"`
+}
+
+// SchulzePollOutcome is the result of a schulze poll.
+// RankedGroups contains the options grouped by their rank, the first group contains the winners.
+type SchulzePollOutcome struct {
+	Options      []string   `json:"options"`
+	RankedGroups [][]string `json:"ranked_groups"`
+}
+
+// VoterVoteResult is the vote of a single voter, Vote is a human readable representation of the vote.
+type VoterVoteResult struct {
+	Voter  string         `json:"voter"`
+	Weight gopolls.Weight `json:"weight"`
+	Vote   string         `json:"vote"`
+}
+
+// PollResult is the result of a single poll.
+//
+// Type is one of "basic", "median" and "schulze", exactly one of Basic, Median and Schulze is set depending on the
+// type. NumVoters is the number of voters that voted in the poll and WeightSum the sum of their weights.
+// Votes is only set if the votes of the voters were requested and the poll is a roll call.
+// If the results of the poll are not published yet (see State) the outcome is pending and neither the results nor
+// the votes are set.
+type PollResult struct {
+	Name      string              `json:"name"`
+	Slug      string              `json:"slug"`
+	Type      string              `json:"type"`
+	State     string              `json:"state"`
+	Majority  *MajorityResult     `json:"majority"`
+	NumVoters gopolls.Weight      `json:"num_voters"`
+	WeightSum gopolls.Weight      `json:"weight_sum"`
+	Outcome   string              `json:"outcome"`
+	Basic     *BasicPollOutcome   `json:"basic,omitempty"`
+	Median    *MedianPollOutcome  `json:"median,omitempty"`
+	Schulze   *SchulzePollOutcome `json:"schulze,omitempty"`
+	Votes     []*VoterVoteResult  `json:"votes,omitempty"`
+}
+
+// OutcomeString returns a human readable description of the outcome.
+func (res *PollResult) OutcomeString() string {
+	switch {
+	case res.Outcome == PollOutcomeNoVotes:
+		return "no votes"
+	case res.Outcome == PollOutcomePending:
+		return "pending"
+	case res.Median != nil:
+		if res.Median.MajorityValue < 0 {
+			return "no value with a majority"
+		}
+		return formatCents(res.Median.MajorityValue, res.Median.Currency)
+	case res.Schulze != nil:
+		groups := make([]string, len(res.Schulze.RankedGroups))
+		for i, group := range res.Schulze.RankedGroups {
+			groups[i] = strings.Join(group, " = ")
+		}
+		return strings.Join(groups, " > ")
+	default:
+		return res.Outcome
+	}
+}
+
+// PollGroupResults contains the results of all polls in a group.
+type PollGroupResults struct {
+	Name  string        `json:"name"`
+	Slug  string        `json:"slug"`
+	Polls []*PollResult `json:"polls"`
+}
+
+type MeetingInfo struct {
+	Name        string    `json:"name"`
+	Slug        string    `json:"slug"`
+	PeriodId    uuid.UUID `json:"period_id"`
+	MeetingTime time.Time `json:"meeting_time"`
+	NumVoters   int       `json:"num_voters"`
+	WeightSum   uint64    `json:"weight_sum"`
+}
+
+// MeetingResults contains the results of all polls of a meeting, it is the JSON results format.
+//
+// The format (version 2) is an object with the keys:
+// "version" (the format version, see ResultsFormatVersion),
+// "generated" (the time the results were computed, RFC 3339),
+// "meeting" (name, slug, period_id, meeting_time, num_voters and weight_sum of all voters of the meeting),
+// "chain_head" (the head of the hash chain of the meeting at the time of the export, see
+// pollsdata.MeetingChainHead, omitted if unknown) and "groups", a list of poll groups (name, slug and polls).
+//
+// Each poll contains name, slug, type ("basic", "median" or "schulze"), state ("draft", "open", "closed" or
+// "published"), majority (numerator, denominator, absolute, base and required, see MajorityResult), num_voters,
+// weight_sum and outcome ("accepted", "rejected", "no_votes", "ranked" for schulze polls or "pending" for polls whose
+// results are not published yet). Pending polls contain no further results. Depending on the type a poll also contains one of
+// the objects "basic" (weighted and
+// unweighted counts of ayes, noes and abstentions), "median" (value, currency and majority_value, all values in
+// cents, majority_value is -1 if no value has a majority) or "schulze" (options and ranked_groups, a list of lists of
+// options, the first list contains the winners).
+// If the votes were requested a roll call poll contains "votes", a list of objects with voter, weight and vote.
+type MeetingResults struct {
+	Version   int                 `json:"version"`
+	Generated time.Time           `json:"generated"`
+	Meeting   *MeetingInfo        `json:"meeting"`
+	ChainHead string              `json:"chain_head,omitempty"`
+	Groups    []*PollGroupResults `json:"groups"`
+}
+
+func formatCents(value int64, currency string) string {
+	return gopolls.NewCurrencyValue(int(value), currency).DefaultFormatString(".")
+}
+
+func formatBasicAnswer(answer gopolls.BasicPollAnswer) string {
+	switch answer {
+	case gopolls.Aye:
+		return "aye"
+	case gopolls.No:
+		return "no"
+	case gopolls.Abstention:
+		return "abstention"
+	default:
+		return "invalid"
+	}
+}
+
+func formatSchulzeRanking(ranking gopolls.SchulzeRanking) string {
+	parts := make([]string, len(ranking))
+	for i, pos := range ranking {
+		parts[i] = strconv.Itoa(pos)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// EvaluatePoll computes the result of a poll, voters are the voters of the meeting (they are used to look up the
+// weight of each vote and to compute absolute majorities). If includeVotes is true the votes of all voters are
+// included in the result, but only if the poll is a roll call (see PollModel.RollCall): the votes of all other polls
+// are secret.
+//
+// Results are only computed once they're visible (see PollModel.ResultsVisible), for all other polls the outcome is
+// pending.
+func EvaluatePoll(poll pollsdata.AbstractPollModel, voters []*pollsdata.VoterModel, includeVotes bool) (*PollResult, error) {
+	common := poll.GetPollModel()
+	includeVotes = includeVotes && common.RollCall
+	weights := make(map[string]gopolls.Weight, len(voters))
+	var totalWeight gopolls.Weight
+	for _, voter := range voters {
+		weights[voter.Name] = voter.Weight
+		totalWeight += voter.Weight
+	}
+	gopollsVoter := func(name string) *gopolls.Voter {
+		return gopolls.NewVoter(name, weights[name])
+	}
+	res := &PollResult{}
+	addVote := func(name, vote string) {
+		if includeVotes {
+			res.Votes = append(res.Votes, &VoterVoteResult{Voter: name, Weight: weights[name], Vote: vote})
+		}
+	}
+	var base gopolls.Weight
+	// the median poll must be tallied once the majority is known
+	var medianPoll *gopolls.MedianPoll
+	switch typedPoll := poll.(type) {
+	case *pollsdata.BasicPollModel:
+		votes := make([]*gopolls.BasicVote, len(typedPoll.Votes))
+		for i, vote := range typedPoll.Votes {
+			votes[i] = gopolls.NewBasicVote(gopollsVoter(vote.VoterName), vote.Answer)
+			addVote(vote.VoterName, formatBasicAnswer(vote.Answer))
+		}
+		tally := gopolls.NewBasicPoll(votes).Tally()
+		res.NumVoters, res.WeightSum = tally.VotersCount, tally.VotesSum
+		res.Basic = &BasicPollOutcome{
+			Unweighted: newBasicCounts(tally.NumberVoters),
+			Weighted:   newBasicCounts(tally.WeightedVotes),
+		}
+		base = res.Basic.Weighted.Ayes + res.Basic.Weighted.Noes
+	case *pollsdata.MedianPollModel:
+		votes := make([]*gopolls.MedianVote, len(typedPoll.Votes))
+		for i, vote := range typedPoll.Votes {
+			votes[i] = gopolls.NewMedianVote(gopollsVoter(vote.VoterName), vote.Value)
+			addVote(vote.VoterName, formatCents(int64(vote.Value), typedPoll.Currency))
+		}
+		medianPoll = gopolls.NewMedianPoll(typedPoll.Value, votes)
+		res.NumVoters, res.WeightSum = gopolls.Weight(len(votes)), medianPoll.WeightSum()
+		res.Median = &MedianPollOutcome{
+			Value:         int64(typedPoll.Value),
+			Currency:      typedPoll.Currency,
+			MajorityValue: -1,
+		}
+		base = res.WeightSum
+	case *pollsdata.SchulzePollModel:
+		votes := make([]*gopolls.SchulzeVote, len(typedPoll.Votes))
+		for i, vote := range typedPoll.Votes {
+			votes[i] = gopolls.NewSchulzeVote(gopollsVoter(vote.VoterName), vote.Ranking)
+			addVote(vote.VoterName, formatSchulzeRanking(vote.Ranking))
+		}
+		schulzePoll := gopolls.NewSchulzePoll(len(typedPoll.Options), votes)
+		schulzePoll.TruncateVoters()
+		tally := schulzePoll.Tally()
+		res.NumVoters, res.WeightSum = gopolls.Weight(len(schulzePoll.Votes)), tally.WeightSum
+		ranked := make([][]string, len(tally.RankedGroups))
+		for i, group := range tally.RankedGroups {
+			ranked[i] = make([]string, len(group))
+			for j, option := range group {
+				ranked[i][j] = typedPoll.Options[option]
+			}
+		}
+		res.Schulze = &SchulzePollOutcome{
+			Options:      typedPoll.Options,
+			RankedGroups: ranked,
+		}
+		base = res.WeightSum
+	default:
+		return nil, fmt.Errorf("unsupported poll type %s", poll.ModelPollForType())
+	}
+	res.Name, res.Slug, res.Type, res.State = common.Name, common.Slug, common.Type, common.GetState()
+	if common.AbsoluteMajority {
+		base = totalWeight
+	}
+	res.Majority = newMajorityResult(common.Majority, common.AbsoluteMajority, base)
+	if !common.ResultsVisible() {
+		// nobody should see results before they're published, the base of a relative majority would reveal the votes
+		res.Outcome = PollOutcomePending
+		res.Basic, res.Median, res.Schulze, res.Votes = nil, nil, nil, nil
+		if !common.AbsoluteMajority {
+			res.Majority.Base, res.Majority.Required = 0, 0
+		}
+		return res, nil
+	}
+
+	switch {
+	case res.NumVoters == 0:
+		res.Outcome = PollOutcomeNoVotes
+	case res.Basic != nil:
+		res.Outcome = PollOutcomeRejected
+		if res.Basic.Weighted.Ayes > res.Majority.Required {
+			res.Outcome = PollOutcomeAccepted
+		}
+	case medianPoll != nil:
+		tally := medianPoll.Tally(res.Majority.Required)
+		res.Outcome = PollOutcomeRejected
+		if tally.MajorityValue != gopolls.NoMedianUnitValue {
+			res.Median.MajorityValue = int64(tally.MajorityValue)
+			res.Outcome = PollOutcomeAccepted
+		}
+	case res.Schulze != nil:
+		res.Outcome = PollOutcomeRanked
+	}
+	return res, nil
+}
+
+// EvaluateMeeting computes the results of all polls in the meeting, see EvaluatePoll.
+// generated is the time stored in the results, usually the current time.
+func EvaluateMeeting(meeting *pollsdata.MeetingModel, includeVotes bool, generated time.Time) (*MeetingResults, error) {
+	var weightSum uint64
+	for _, voter := range meeting.Voters {
+		weightSum += uint64(voter.Weight)
+	}
+	res := &MeetingResults{
+		Version:   ResultsFormatVersion,
+		Generated: generated,
+		Meeting: &MeetingInfo{
+			Name:        meeting.Name,
+			Slug:        meeting.Slug,
+			PeriodId:    meeting.PeriodId,
+			MeetingTime: meeting.MeetingTime,
+			NumVoters:   len(meeting.Voters),
+			WeightSum:   weightSum,
+		},
+		Groups: make([]*PollGroupResults, len(meeting.Groups)),
+	}
+	for i, group := range meeting.Groups {
+		groupRes := &PollGroupResults{
+			Name:  group.Name,
+			Slug:  group.Slug,
+			Polls: make([]*PollResult, len(group.Polls)),
+		}
+		for j, poll := range group.Polls {
+			pollRes, evalErr := EvaluatePoll(poll, meeting.Voters, includeVotes)
+			if evalErr != nil {
+				return nil, evalErr
+			}
+			groupRes.Polls[j] = pollRes
+		}
+		res.Groups[i] = groupRes
+	}
+	return res, nil
+}
+
+func weightString(w gopolls.Weight) string {
+	return strconv.FormatUint(uint64(w), 10)
+}
+
+// ResultsCSVHead returns the columns of the CSV results format, if includeVotes is true the columns for the
+// voter, weight and vote are added.
+func ResultsCSVHead(includeVotes bool) []string {
+	res := []string{"group", "poll", "type", "state", "majority", "absolute_majority", "majority_base", "required_majority",
+		"num_voters", "weight_sum", "ayes", "noes", "abstentions", "weighted_ayes", "weighted_noes",
+		"weighted_abstentions", "value", "majority_value", "ranking", "outcome"}
+	if includeVotes {
+		res = append(res, "voter", "voter_weight", "vote")
+	}
+	return res
+}
+
+func pollResultCSVRecord(group *PollGroupResults, poll *PollResult) []string {
+	res := []string{group.Name, poll.Name, poll.Type, poll.State,
+		fmt.Sprintf("%d/%d", poll.Majority.Numerator, poll.Majority.Denominator),
+		strconv.FormatBool(poll.Majority.Absolute), weightString(poll.Majority.Base),
+		weightString(poll.Majority.Required), weightString(poll.NumVoters), weightString(poll.WeightSum),
+		"", "", "", "", "", "", "", "", "", poll.Outcome}
+	switch {
+	case poll.Basic != nil:
+		res[10], res[11], res[12] = weightString(poll.Basic.Unweighted.Ayes),
+			weightString(poll.Basic.Unweighted.Noes), weightString(poll.Basic.Unweighted.Abstentions)
+		res[13], res[14], res[15] = weightString(poll.Basic.Weighted.Ayes),
+			weightString(poll.Basic.Weighted.Noes), weightString(poll.Basic.Weighted.Abstentions)
+	case poll.Median != nil:
+		res[16] = formatCents(poll.Median.Value, poll.Median.Currency)
+		if poll.Median.MajorityValue >= 0 {
+			res[17] = formatCents(poll.Median.MajorityValue, poll.Median.Currency)
+		}
+	case poll.Schulze != nil:
+		res[18] = poll.OutcomeString()
+	}
+	return res
+}
+
+// WriteResultsCSV writes the results as CSV, the columns are described by ResultsCSVHead.
+//
+// Each poll is written in one row. If includeVotes is true the row of a poll is repeated for each vote in the poll
+// with the voter, its weight and its vote in the additional columns (polls without votes are written once with empty
+// vote columns).
+func WriteResultsCSV(w io.Writer, results *MeetingResults, includeVotes bool) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(ResultsCSVHead(includeVotes)); err != nil {
+		return err
+	}
+	for _, group := range results.Groups {
+		for _, poll := range group.Polls {
+			record := pollResultCSVRecord(group, poll)
+			if !includeVotes {
+				if err := writer.Write(record); err != nil {
+					return err
+				}
+				continue
+			}
+			if len(poll.Votes) == 0 {
+				if err := writer.Write(append(record, "", "", "")); err != nil {
+					return err
+				}
+				continue
+			}
+			for _, vote := range poll.Votes {
+				voteRecord := make([]string, len(record), len(record)+3)
+				copy(voteRecord, record)
+				voteRecord = append(voteRecord, vote.Voter, weightString(vote.Weight), vote.Vote)
+				if err := writer.Write(voteRecord); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteResultsJSON writes the results in the JSON format described in MeetingResults.
+func WriteResultsJSON(w io.Writer, results *MeetingResults) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(results)
+}
+
+var markdownCellReplacer = strings.NewReplacer("|", "\\|", "\n", " ")
+
+// WriteResultsMarkdown writes the results as a Markdown document.
+func WriteResultsMarkdown(w io.Writer, results *MeetingResults) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Results: %s\n\n", results.Meeting.Name)
+	fmt.Fprintf(&buf, "* Meeting time: %s\n", results.Meeting.MeetingTime.Format("2006-01-02 15:04 MST"))
+	fmt.Fprintf(&buf, "* Voters: %d (total weight %d)\n", results.Meeting.NumVoters, results.Meeting.WeightSum)
+	fmt.Fprintf(&buf, "* Generated: %s\n", results.Generated.Format(time.RFC3339))
+	if results.ChainHead != "" {
+		fmt.Fprintf(&buf, "* Chain head: `%s`\n", results.ChainHead)
+	}
+	for _, group := range results.Groups {
+		fmt.Fprintf(&buf, "\n## %s\n", group.Name)
+		for _, poll := range group.Polls {
+			fmt.Fprintf(&buf, "\n### %s\n\n", poll.Name)
+			fmt.Fprintf(&buf, "* Type: %s\n", poll.Type)
+			fmt.Fprintf(&buf, "* State: %s\n", poll.State)
+			fmt.Fprintf(&buf, "* Majority: %s, more than %d of %d required\n",
+				poll.Majority, poll.Majority.Required, poll.Majority.Base)
+			fmt.Fprintf(&buf, "* Voters: %d (weight %d)\n", poll.NumVoters, poll.WeightSum)
+			if poll.Median != nil {
+				fmt.Fprintf(&buf, "* Value: %s\n", formatCents(poll.Median.Value, poll.Median.Currency))
+			}
+			fmt.Fprintf(&buf, "* **Result: %s**\n", poll.OutcomeString())
+			if poll.Basic != nil {
+				buf.WriteString("\n| | Ayes | Noes | Abstentions |\n|---|---:|---:|---:|\n")
+				fmt.Fprintf(&buf, "| Voters | %d | %d | %d |\n",
+					poll.Basic.Unweighted.Ayes, poll.Basic.Unweighted.Noes, poll.Basic.Unweighted.Abstentions)
+				fmt.Fprintf(&buf, "| Weighted | %d | %d | %d |\n",
+					poll.Basic.Weighted.Ayes, poll.Basic.Weighted.Noes, poll.Basic.Weighted.Abstentions)
+			}
+			if len(poll.Votes) > 0 {
+				buf.WriteString("\n| Voter | Weight | Vote |\n|---|---:|---|\n")
+				for _, vote := range poll.Votes {
+					fmt.Fprintf(&buf, "| %s | %d | %s |\n",
+						markdownCellReplacer.Replace(vote.Voter), vote.Weight, markdownCellReplacer.Replace(vote.Vote))
+				}
+			}
+		}
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// ChainHeadHeader is the response header that contains the head of the hash chain of the meeting in results
+// exports, the csv format has no other place for it.
+const ChainHeadHeader = "X-Chain-Head"
+
+// evaluatePublishedMeeting evaluates the meeting with EvaluateMeeting at the current time and sets the head of its
+// hash chain, the results are meant to be published.
+func evaluatePublishedMeeting(ctx context.Context, requestContext *RequestContext, meeting *pollsdata.MeetingModel, includeVotes bool) (*MeetingResults, error) {
+	results, evalErr := EvaluateMeeting(meeting, includeVotes, requestContext.Clock.Now())
+	if evalErr != nil {
+		return nil, evalErr
+	}
+	head, headErr := pollsdata.MeetingChainHead(ctx, requestContext.DataHandler, meeting.Id)
+	if headErr != nil {
+		return nil, headErr
+	}
+	results.ChainHead = head
+	return results, nil
+}
+
+// MeetingResultsHandleFunc exports the results of a meeting, the format ("csv", "json" or "md") is given in the
+// route. The votes of the voters in roll call polls are included if the query parameter "votes" is set to "1".
+// The head of the hash chain of the meeting is included in the results and sent in the ChainHeadHeader.
+func MeetingResultsHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	slug := vars["slug"]
+	queryArgs := pollsdata.NewMeetingQueryArgs().
+		SetSlug(&slug)
+	meeting, getErr := requestContext.DataHandler.GetMeeting(ctx, queryArgs)
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	includeVotes := r.URL.Query().Get("votes") == "1"
+	results, evalErr := evaluatePublishedMeeting(ctx, requestContext, meeting, includeVotes)
+	if evalErr != nil {
+		return evalErr
+	}
+	var buf bytes.Buffer
+	var writeErr error
+	var contentType string
+	format := vars["format"]
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+		writeErr = WriteResultsCSV(&buf, results, includeVotes)
+	case "json":
+		contentType = "application/json; charset=utf-8"
+		writeErr = WriteResultsJSON(&buf, results)
+	case "md":
+		contentType = "text/markdown; charset=utf-8"
+		writeErr = WriteResultsMarkdown(&buf, results)
+	default:
+		return NewError(fmt.Errorf("unsupported results format \"%s\"", format), http.StatusNotFound)
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-results.%s\"", meeting.Slug, format))
+	w.Header().Set(ChainHeadHeader, results.ChainHead)
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// MeetingResultsPrintHandleFunc renders the results of a meeting as a printable html page, the query parameter
+// "votes" works as in MeetingResultsHandleFunc.
+func MeetingResultsPrintHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	slug := mux.Vars(r)["slug"]
+	queryArgs := pollsdata.NewMeetingQueryArgs().
+		SetSlug(&slug)
+	meeting, getErr := requestContext.DataHandler.GetMeeting(ctx, queryArgs)
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	includeVotes := r.URL.Query().Get("votes") == "1"
+	results, evalErr := evaluatePublishedMeeting(ctx, requestContext, meeting, includeVotes)
+	if evalErr != nil {
+		return evalErr
+	}
+	data := requestContext.PrepareTemplateRenderData()
+	data["meeting"] = meeting
+	data["results"] = results
+	data["include_votes"] = includeVotes
+	return executeBuffered(requestContext.Templates.TemplateMap["meetings-results-print"], data, w)
+}
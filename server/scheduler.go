@@ -0,0 +1,121 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"strconv"
+	"time"
+)
+
+type SchedulerConfig struct {
+	// CheckInterval is the interval in which the MeetingScheduler checks for meetings, polls are opened and closed
+	// at most CheckInterval after OnlineStart / OnlineEnd
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+}
+
+func NewSchedulerConfig() *SchedulerConfig {
+	return &SchedulerConfig{
+		CheckInterval: 15 * time.Second,
+	}
+}
+
+// MeetingScheduler opens and closes the polls of meetings at OnlineStart and OnlineEnd.
+//
+// The scheduler doesn't keep any state: on each check the due transitions are derived from the database (see
+// pollsdata.DueVotingTransition), so transitions missed while the server was not running are done on the first
+// check after a restart. Applied transitions are recorded in the meeting, each transition is done only once.
+// For each transition that changed polls a VotingOpenedEvent or VotingClosedEvent is published.
+// The time is taken from AppContext.Clock.
+type MeetingScheduler struct {
+	*AppContext
+}
+
+func NewMeetingScheduler(appContext *AppContext) *MeetingScheduler {
+	return &MeetingScheduler{
+		AppContext: appContext,
+	}
+}
+
+func votingTransitionEvent(transition *pollsdata.VotingTransition) string {
+	if transition.To == pollsdata.PollStateOpen {
+		return VotingOpenedEvent
+	}
+	return VotingClosedEvent
+}
+
+// Check does all transitions that are due at the current time of the clock.
+//
+// If a meeting can't be changed (for example because it was changed concurrently) the error is logged and the
+// transition is tried again on the next check. Only errors when loading the meetings are returned.
+func (s *MeetingScheduler) Check(ctx context.Context) error {
+	now := s.Clock.Now()
+	meetings, getErr := s.DataHandler.GetVotingTransitionMeetings(ctx, now)
+	if getErr != nil {
+		return getErr
+	}
+	for _, meeting := range meetings {
+		transition := pollsdata.DueVotingTransition(meeting, now)
+		if transition == nil {
+			continue
+		}
+		args := pollsdata.NewMeetingQueryArgs().
+			SetId(&meeting.Id).
+			SetUpdateToken(&meeting.UpdateToken)
+		num, updateErr := s.DataHandler.ApplyVotingTransition(ctx, args, transition)
+		if updateErr != nil {
+			s.Logger.Errorw("can't change state of polls",
+				"meeting", meeting.Slug,
+				"from", transition.From,
+				"to", transition.To,
+				"error", updateErr)
+			continue
+		}
+		s.Logger.Infow("changed state of polls",
+			"meeting", meeting.Slug,
+			"from", transition.From,
+			"to", transition.To,
+			"num-polls", num)
+		if num == 0 {
+			continue
+		}
+		s.PublishEvent(votingTransitionEvent(transition), NewMeetingEventData(meeting))
+		s.AuditLog(ctx, pollsdata.NewAuditEntryModel(s.Clock, AuditSchedulerActor, "", pollsdata.AuditPollStateChanged).
+			SetPeriodId(meeting.PeriodId).
+			SetMeetingId(meeting.Id).
+			SetDetail("from", transition.From).
+			SetDetail("to", transition.To).
+			SetDetail("polls", strconv.Itoa(num)))
+	}
+	return nil
+}
+
+// Run calls Check every Scheduler.CheckInterval until ctx is done, the first check is done immediately.
+func (s *MeetingScheduler) Run(ctx context.Context) {
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, s.HandlerTimeout)
+		if checkErr := s.Check(checkCtx); checkErr != nil {
+			s.Logger.Errorw("error while checking for voting transitions",
+				"error", checkErr)
+		}
+		cancel()
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.Clock.After(s.Scheduler.CheckInterval):
+		}
+	}
+}
@@ -67,6 +67,7 @@ func NewTemplateProvider(root string) *TemplateProvider {
 func (provider *TemplateProvider) InitBase() error {
 	paths := []string{"base.gohtml",
 		filepath.Join("voters", "voters_table.gohtml"),
+		filepath.Join("meetings", "meetings_table.gohtml"),
 		filepath.Join("periods", "period_form.gohtml"),
 	}
 	for i, file := range paths {
@@ -106,6 +107,11 @@ func (provider *TemplateProvider) registerHomeTemplate() error {
 	return err
 }
 
+func (provider *TemplateProvider) registerMeetingsListTemplate() error {
+	_, err := provider.RegisterTemplate("meetings-list", filepath.Join("meetings", "meetings_list.gohtml"))
+	return err
+}
+
 func (provider *TemplateProvider) registerPeriodsListTemplate() error {
 	_, err := provider.RegisterTemplate("periods-list", filepath.Join("periods", "periods_list.gohtml"))
 	return err
@@ -121,13 +127,80 @@ func (provider *TemplateProvider) registerNewPeriodTemplate() error {
 	return err
 }
 
+func (provider *TemplateProvider) registerEditPeriodTemplate() error {
+	_, err := provider.RegisterTemplate("periods-edit", filepath.Join("periods", "periods_edit.gohtml"))
+	return err
+}
+
+func (provider *TemplateProvider) registerWebhooksListTemplate() error {
+	_, err := provider.RegisterTemplate("webhooks-list", filepath.Join("webhooks", "webhooks_list.gohtml"))
+	return err
+}
+
+func (provider *TemplateProvider) registerWebhooksDeliveriesTemplate() error {
+	_, err := provider.RegisterTemplate("webhooks-deliveries", filepath.Join("webhooks", "webhooks_deliveries.gohtml"))
+	return err
+}
+
+func (provider *TemplateProvider) registerVotersImportTemplate() error {
+	_, err := provider.RegisterTemplate("voters-import", filepath.Join("voters", "voters_import.gohtml"))
+	return err
+}
+
+func (provider *TemplateProvider) registerMeetingsPollsImportTemplate() error {
+	_, err := provider.RegisterTemplate("meetings-polls-import", filepath.Join("meetings", "meetings_polls_import.gohtml"))
+	return err
+}
+
+func (provider *TemplateProvider) registerMeetingsVotesImportTemplate() error {
+	_, err := provider.RegisterTemplate("meetings-votes-import", filepath.Join("meetings", "meetings_votes_import.gohtml"))
+	return err
+}
+
+func (provider *TemplateProvider) registerMeetingsResultsPrintTemplate() error {
+	_, err := provider.RegisterTemplate("meetings-results-print", filepath.Join("meetings", "meetings_results_print.gohtml"))
+	return err
+}
+
+func (provider *TemplateProvider) registerMeetingsLiveTemplate() error {
+	_, err := provider.RegisterTemplate("meetings-live", filepath.Join("meetings", "meetings_live.gohtml"))
+	return err
+}
+
+func (provider *TemplateProvider) registerMeetingsPollsTemplate() error {
+	_, err := provider.RegisterTemplate("meetings-polls", filepath.Join("meetings", "meetings_polls.gohtml"))
+	return err
+}
+
+func (provider *TemplateProvider) registerNewMeetingTemplate() error {
+	_, err := provider.RegisterTemplate("meetings-new", filepath.Join("meetings", "meetings_new.gohtml"))
+	return err
+}
+
+func (provider *TemplateProvider) registerAuditListTemplate() error {
+	_, err := provider.RegisterTemplate("audit-list", filepath.Join("audit", "audit_list.gohtml"))
+	return err
+}
+
 func (provider *TemplateProvider) RegisterDefaults() (int, error) {
 	// all functions have the same form, store them in a slice and apply them
 	generators := []func() error{
 		provider.registerHomeTemplate,
+		provider.registerMeetingsListTemplate,
 		provider.registerPeriodsListTemplate,
 		provider.registerPeriodsDetailTemplate,
 		provider.registerNewPeriodTemplate,
+		provider.registerEditPeriodTemplate,
+		provider.registerWebhooksListTemplate,
+		provider.registerWebhooksDeliveriesTemplate,
+		provider.registerVotersImportTemplate,
+		provider.registerMeetingsPollsImportTemplate,
+		provider.registerMeetingsVotesImportTemplate,
+		provider.registerMeetingsResultsPrintTemplate,
+		provider.registerMeetingsLiveTemplate,
+		provider.registerMeetingsPollsTemplate,
+		provider.registerNewMeetingTemplate,
+		provider.registerAuditListTemplate,
 	}
 	numTemplates := len(generators)
 	for _, generator := range generators {
@@ -0,0 +1,540 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/goslugify"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/asaskevich/govalidator"
+	"github.com/gorilla/mux"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	VotersImportHeaderAuto = "auto"
+	VotersImportHeaderYes  = "yes"
+	VotersImportHeaderNo   = "no"
+)
+
+// VotersImportDelimiters are the delimiters that are considered when detecting the delimiter of a CSV file.
+// Spreadsheet programs usually use ',' or ';' (depending on the locale) and '\t' for "tab separated values".
+var VotersImportDelimiters = []rune{',', ';', '\t', '|'}
+
+// VotersImportOptions describes how voters are read from a CSV file.
+//
+// The columns are either the name of a column in the header or the (1-based) number of the column.
+// WeightColumn and EmailColumn can be empty, in this case all voters get the weight 1 / no email.
+// A Delimiter of 0 means that the delimiter is detected from the first line.
+// Header is one of the VotersImportHeader constants, for "auto" the first line is considered a header if the value
+// in the weight column is not a valid weight (or if the name column is not a number and it is found in the first
+// line).
+type VotersImportOptions struct {
+	NameColumn   string
+	WeightColumn string
+	EmailColumn  string
+	Delimiter    rune
+	Header       string
+}
+
+func NewVotersImportOptions() *VotersImportOptions {
+	return &VotersImportOptions{
+		NameColumn:   "1",
+		WeightColumn: "2",
+		EmailColumn:  "",
+		Delimiter:    0,
+		Header:       VotersImportHeaderAuto,
+	}
+}
+
+// VotersImportRow is a single row of an imported file.
+// Line is the number of the record in the file (starting with 1), completely empty lines are not counted.
+// Voter is nil if the row could not be parsed, Errors contains all errors found for the row.
+type VotersImportRow struct {
+	Line   int
+	Voter  *pollsdata.VoterModel
+	Errors []string
+}
+
+func (row *VotersImportRow) Valid() bool {
+	return len(row.Errors) == 0
+}
+
+func (row *VotersImportRow) addError(format string, a ...interface{}) {
+	row.Errors = append(row.Errors, fmt.Sprintf(format, a...))
+}
+
+// VotersImportPreview is the result of reading a voters file, it is shown to the user before the voters are
+// applied.
+//
+// Errors contains errors that are not related to a single row (for example too many voters).
+type VotersImportPreview struct {
+	Delimiter rune
+	HasHeader bool
+	Rows      []*VotersImportRow
+	Errors    []string
+}
+
+// Valid returns true if neither the preview nor one of its rows has an error.
+func (preview *VotersImportPreview) Valid() bool {
+	if len(preview.Errors) > 0 {
+		return false
+	}
+	for _, row := range preview.Rows {
+		if !row.Valid() {
+			return false
+		}
+	}
+	return true
+}
+
+// NumInvalidRows returns the number of rows with at least one error.
+func (preview *VotersImportPreview) NumInvalidRows() int {
+	res := 0
+	for _, row := range preview.Rows {
+		if !row.Valid() {
+			res++
+		}
+	}
+	return res
+}
+
+// DelimiterString returns a readable representation of the delimiter.
+func (preview *VotersImportPreview) DelimiterString() string {
+	if preview.Delimiter == '\t' {
+		return "tab"
+	}
+	return string(preview.Delimiter)
+}
+
+// Voters returns all voters of the preview, rows with errors are ignored.
+func (preview *VotersImportPreview) Voters() []*pollsdata.VoterModel {
+	res := make([]*pollsdata.VoterModel, 0, len(preview.Rows))
+	for _, row := range preview.Rows {
+		if row.Valid() && row.Voter != nil {
+			res = append(res, row.Voter)
+		}
+	}
+	return res
+}
+
+// DetectCSVDelimiter returns the delimiter from VotersImportDelimiters that appears most often in line (quoted parts
+// are ignored). If none of them appears ',' is returned.
+func DetectCSVDelimiter(line string) rune {
+	counts := make(map[rune]int, len(VotersImportDelimiters))
+	inQuotes := false
+	for _, r := range line {
+		if r == '"' {
+			inQuotes = !inQuotes
+			continue
+		}
+		if !inQuotes {
+			counts[r]++
+		}
+	}
+	res, max := ',', 0
+	for _, delimiter := range VotersImportDelimiters {
+		if counts[delimiter] > max {
+			res, max = delimiter, counts[delimiter]
+		}
+	}
+	return res
+}
+
+// resolveColumn returns the (0-based) index of column, -1 if column is empty.
+func resolveColumn(column string, header []string) (int, error) {
+	column = strings.TrimSpace(column)
+	if column == "" {
+		return -1, nil
+	}
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), column) {
+			return i, nil
+		}
+	}
+	if num, numErr := strconv.Atoi(column); numErr == nil {
+		if num < 1 {
+			return -1, fmt.Errorf("invalid column number %d", num)
+		}
+		return num - 1, nil
+	}
+	return -1, fmt.Errorf("column \"%s\" not found", column)
+}
+
+func isHeaderColumn(column string, header []string) bool {
+	column = strings.TrimSpace(column)
+	if _, numErr := strconv.Atoi(column); numErr == nil || column == "" {
+		return false
+	}
+	for _, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), column) {
+			return true
+		}
+	}
+	return false
+}
+
+func detectHeader(options *VotersImportOptions, first []string) bool {
+	switch options.Header {
+	case VotersImportHeaderYes:
+		return true
+	case VotersImportHeaderNo:
+		return false
+	}
+	if isHeaderColumn(options.NameColumn, first) || isHeaderColumn(options.WeightColumn, first) {
+		return true
+	}
+	if weightIndex, indexErr := resolveColumn(options.WeightColumn, nil); indexErr == nil && weightIndex >= 0 &&
+		weightIndex < len(first) {
+		_, weightErr := gopolls.ParseWeight(strings.TrimSpace(first[weightIndex]))
+		return weightErr != nil
+	}
+	return false
+}
+
+func getColumn(record []string, index int) string {
+	if index < 0 || index >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[index])
+}
+
+// ImportVotersCSV reads voters from a CSV file and returns a preview.
+//
+// The returned error is only set if the file can't be read at all (for example if it is not valid CSV or a column
+// can't be found), all validation errors (also those checked against limits) are reported in the preview.
+// Each voter is validated with ValidateModel and the slugs generated from the names must be unique, so the voters of
+// a valid preview can be stored without further errors.
+// limits can be nil, in this case no limits are checked. Only valid rows count against the maximal number of voters.
+// The voters in the preview already have a random id and a slug generated from their name.
+func ImportVotersCSV(r io.Reader, options *VotersImportOptions, limits *VotersLimitsConfig) (*VotersImportPreview, error) {
+	content, readErr := ioutil.ReadAll(r)
+	if readErr != nil {
+		return nil, readErr
+	}
+	// spreadsheet programs often write a byte order mark
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(content) {
+		return nil, NewFormValidationError("file is not a valid utf-8 file")
+	}
+	delimiter := options.Delimiter
+	if delimiter == 0 {
+		firstLine, _ := bufio.NewReader(bytes.NewReader(content)).ReadString('\n')
+		delimiter = DetectCSVDelimiter(firstLine)
+	}
+	csvReader := csv.NewReader(bytes.NewReader(content))
+	csvReader.Comma = delimiter
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+	records, csvErr := csvReader.ReadAll()
+	if csvErr != nil {
+		return nil, NewFormValidationError("invalid csv file").SetWrapped(csvErr)
+	}
+	preview := &VotersImportPreview{
+		Delimiter: delimiter,
+		HasHeader: false,
+		Rows:      make([]*VotersImportRow, 0, len(records)),
+	}
+	if len(records) == 0 {
+		return preview, nil
+	}
+	var header []string
+	if detectHeader(options, records[0]) {
+		preview.HasHeader = true
+		header = records[0]
+	}
+	nameIndex, nameErr := resolveColumn(options.NameColumn, header)
+	if nameErr != nil {
+		return nil, NewFormValidationError(nameErr.Error()).SetFieldName("name_column")
+	}
+	if nameIndex < 0 {
+		return nil, NewFormValidationError("name column is required").SetFieldName("name_column")
+	}
+	weightIndex, weightErr := resolveColumn(options.WeightColumn, header)
+	if weightErr != nil {
+		return nil, NewFormValidationError(weightErr.Error()).SetFieldName("weight_column")
+	}
+	emailIndex, emailErr := resolveColumn(options.EmailColumn, header)
+	if emailErr != nil {
+		return nil, NewFormValidationError(emailErr.Error()).SetFieldName("email_column")
+	}
+
+	names := pollsweb.NewStringSet(len(records))
+	// maps the slugs of the voters to their names
+	slugs := make(map[string]string, len(records))
+	for i, record := range records {
+		if i == 0 && preview.HasHeader {
+			continue
+		}
+		if isEmptyRecord(record) {
+			continue
+		}
+		row := &VotersImportRow{Line: i + 1}
+		preview.Rows = append(preview.Rows, row)
+
+		name := getColumn(record, nameIndex)
+		switch {
+		case name == "":
+			row.addError("name is empty")
+		case limits != nil && limits.MaxVotersNameLength >= 0 && utf8.RuneCountInString(name) > limits.MaxVotersNameLength:
+			row.addError("name is too long, allowed are %d characters", limits.MaxVotersNameLength)
+		case !names.Add(name):
+			row.addError("duplicate name \"%s\"", name)
+		}
+
+		weight := gopolls.Weight(1)
+		if weightIndex >= 0 {
+			var parseErr error
+			weight, parseErr = gopolls.ParseWeight(getColumn(record, weightIndex))
+			if parseErr != nil {
+				row.addError("invalid weight \"%s\"", getColumn(record, weightIndex))
+			} else if limits != nil && limits.MaxVotersWeight != gopolls.NoWeight && weight > limits.MaxVotersWeight {
+				row.addError("weight %d is too large, allowed is a weight of %d", weight, limits.MaxVotersWeight)
+			}
+		}
+
+		email := getColumn(record, emailIndex)
+		if email != "" && !govalidator.IsEmail(email) {
+			row.addError("invalid email \"%s\"", email)
+		}
+
+		if !row.Valid() {
+			continue
+		}
+		id, idErr := pollsweb.GenUUID()
+		if idErr != nil {
+			return nil, idErr
+		}
+		voter := pollsdata.NewVoterModel(name, goslugify.GenerateSlug(name), weight).SetEmail(email)
+		voter.SetId(id)
+		if validateErr := voter.ValidateModel(); validateErr != nil {
+			row.addError("invalid voter: %v", validateErr)
+			continue
+		}
+		if voter.Slug == "" {
+			row.addError("can't generate a slug for the name \"%s\"", name)
+			continue
+		}
+		if other, exists := slugs[voter.Slug]; exists {
+			row.addError("name \"%s\" has the same slug \"%s\" as \"%s\"", name, voter.Slug, other)
+			continue
+		}
+		slugs[voter.Slug] = name
+		row.Voter = voter
+	}
+	if numValid := len(preview.Rows) - preview.NumInvalidRows(); limits != nil && limits.MaxNumVoters >= 0 && numValid > limits.MaxNumVoters {
+		preview.Errors = append(preview.Errors, fmt.Sprintf("too many voters: got %d, allowed are %d",
+			numValid, limits.MaxNumVoters))
+	}
+	return preview, nil
+}
+
+func isEmptyRecord(record []string) bool {
+	for _, entry := range record {
+		if strings.TrimSpace(entry) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// VotersImportMaxFileSize is the maximal size of an uploaded voters file in bytes.
+const VotersImportMaxFileSize = 2 << 20
+
+var votersImportDelimiterNames = map[string]rune{
+	"auto":      0,
+	"comma":     ',',
+	"semicolon": ';',
+	"tab":       '\t',
+	"pipe":      '|',
+}
+
+// VotersImportForm is the form for uploading a voters file.
+//
+// The file itself is uploaded in the multipart field "voters_file". When the preview is rendered the content of the
+// file is sent along in Content, this way the file doesn't have to be uploaded again when the voters are applied.
+// Action is either "preview" or "apply".
+type VotersImportForm struct {
+	NameColumn   string `schema:"name_column" valid:"runelength(1|250)"`
+	WeightColumn string `schema:"weight_column" valid:"runelength(0|250)"`
+	EmailColumn  string `schema:"email_column" valid:"runelength(0|250)"`
+	Delimiter    string `schema:"delimiter" valid:"in(auto|comma|semicolon|tab|pipe)"`
+	Header       string `schema:"header" valid:"in(auto|yes|no)"`
+	Content      string `schema:"content" valid:"-"`
+	Action       string `schema:"action" valid:"in(preview|apply)"`
+}
+
+func NewVotersImportForm() *VotersImportForm {
+	options := NewVotersImportOptions()
+	return &VotersImportForm{
+		NameColumn:   options.NameColumn,
+		WeightColumn: options.WeightColumn,
+		EmailColumn:  options.EmailColumn,
+		Delimiter:    "auto",
+		Header:       options.Header,
+		Content:      "",
+		Action:       "preview",
+	}
+}
+
+func (form *VotersImportForm) ToOptions() *VotersImportOptions {
+	return &VotersImportOptions{
+		NameColumn:   form.NameColumn,
+		WeightColumn: form.WeightColumn,
+		EmailColumn:  form.EmailColumn,
+		Delimiter:    votersImportDelimiterNames[form.Delimiter],
+		Header:       form.Header,
+	}
+}
+
+func DecodeVotersImportForm(src map[string][]string) (*VotersImportForm, error) {
+	res := VotersImportForm{}
+	err := DecodeForm(&res, src)
+	return &res, err
+}
+
+// readVotersImportFile returns the content of the uploaded file, if no file was uploaded the Content of the form
+// is returned.
+func readVotersImportFile(r *http.Request, form *VotersImportForm) (string, error) {
+	file, _, fileErr := r.FormFile("voters_file")
+	if fileErr != nil {
+		if fileErr == http.ErrMissingFile {
+			return form.Content, nil
+		}
+		return "", NewError(fileErr, http.StatusBadRequest)
+	}
+	defer file.Close()
+	content, readErr := ioutil.ReadAll(io.LimitReader(file, VotersImportMaxFileSize))
+	if readErr != nil {
+		return "", readErr
+	}
+	return string(content), nil
+}
+
+// votersImportTarget is a period or a meeting the voters are imported to.
+type votersImportTarget struct {
+	Kind    string
+	Name    string
+	BackURL string
+	apply   func(ctx context.Context, voters []*pollsdata.VoterModel) error
+}
+
+func votersImportHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request, target *votersImportTarget) error {
+	data := requestContext.PrepareTemplateRenderData()
+	data["target"] = target
+	if r.Method == http.MethodGet {
+		data["form"] = NewVotersImportForm()
+		return executeBuffered(requestContext.Templates.TemplateMap["voters-import"], data, w)
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 2*VotersImportMaxFileSize)
+	if parseErr := r.ParseMultipartForm(VotersImportMaxFileSize); parseErr != nil {
+		return NewError(parseErr, http.StatusBadRequest)
+	}
+	form, formErr := DecodeVotersImportForm(r.PostForm)
+	if formErr != nil {
+		return NewError(formErr, http.StatusBadRequest)
+	}
+	content, contentErr := readVotersImportFile(r, form)
+	if contentErr != nil {
+		return contentErr
+	}
+	form.Content = content
+	preview, importErr := ImportVotersCSV(strings.NewReader(content), form.ToOptions(), requestContext.Limits.Voters)
+	if importErr != nil {
+		return NewError(importErr, http.StatusBadRequest)
+	}
+	data["form"] = form
+	data["preview"] = preview
+	if form.Action == "apply" && preview.Valid() {
+		voters := preview.Voters()
+		if applyErr := target.apply(ctx, voters); applyErr != nil {
+			return validationAsHandlerError(applyErr)
+		}
+		data["applied"] = len(voters)
+	}
+	return executeBuffered(requestContext.Templates.TemplateMap["voters-import"], data, w)
+}
+
+func PeriodVotersImportHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	slug := mux.Vars(r)["slug"]
+	queryArgs := pollsdata.NewPeriodSettingsQueryArgs().
+		SetSlug(&slug)
+	period, getErr := requestContext.DataHandler.GetPeriod(ctx, queryArgs)
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	backURL, urlErr := requestContext.URLString("periods-detail", "slug", period.Slug)
+	if urlErr != nil {
+		return urlErr
+	}
+	target := &votersImportTarget{
+		Kind:    "period",
+		Name:    period.Name,
+		BackURL: backURL,
+		apply: func(ctx context.Context, voters []*pollsdata.VoterModel) error {
+			if updateErr := requestContext.DataHandler.UpdatePeriodVoters(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetId(&period.Id), voters); updateErr != nil {
+				return updateErr
+			}
+			requestContext.AuditLog(ctx, requestContext.NewAuditEntry(r, pollsdata.AuditPeriodVotersUpdated).
+				SetPeriodId(period.Id).
+				SetDetail("voters", strconv.Itoa(len(voters))))
+			return nil
+		},
+	}
+	return votersImportHandleFunc(ctx, requestContext, w, r, target)
+}
+
+func MeetingVotersImportHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	slug := mux.Vars(r)["slug"]
+	queryArgs := pollsdata.NewMeetingQueryArgs().
+		SetSlug(&slug)
+	meeting, getErr := requestContext.DataHandler.GetMeeting(ctx, queryArgs)
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	target := &votersImportTarget{
+		Kind:    "meeting",
+		Name:    meeting.Name,
+		BackURL: "",
+		apply: func(ctx context.Context, voters []*pollsdata.VoterModel) error {
+			// the update token makes sure that the meeting was not changed in the meantime
+			updateArgs := pollsdata.NewMeetingQueryArgs().
+				SetId(&meeting.Id).
+				SetUpdateToken(&meeting.UpdateToken)
+			if updateErr := requestContext.DataHandler.UpdateMeetingVoters(ctx, updateArgs, voters); updateErr != nil {
+				return updateErr
+			}
+			meeting.Voters = voters
+			requestContext.PublishEvent(MeetingUpdatedEvent, NewMeetingEventData(meeting))
+			requestContext.AuditLog(ctx, requestContext.NewAuditEntry(r, pollsdata.AuditMeetingVotersUpdated).
+				SetPeriodId(meeting.PeriodId).
+				SetMeetingId(meeting.Id).
+				SetDetail("voters", strconv.Itoa(len(voters))))
+			return nil
+		},
+	}
+	return votersImportHandleFunc(ctx, requestContext, w, r, target)
+}
@@ -0,0 +1,398 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/gorilla/mux"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// VotesImportMaxFileSize is the maximal size of an uploaded votes file in bytes.
+const VotesImportMaxFileSize = 2 << 20
+
+// PollModelToSkeleton returns the skeleton for a poll, this is the inverse of SkeletonToPollModel.
+// The skeleton of a BasicPollModel has the options "Yes" and "No".
+func PollModelToSkeleton(poll pollsdata.AbstractPollModel) (gopolls.AbstractPollSkeleton, error) {
+	switch typedPoll := poll.(type) {
+	case *pollsdata.BasicPollModel:
+		res := gopolls.NewPollSkeleton(typedPoll.Name)
+		res.Options = []string{"Yes", "No"}
+		return res, nil
+	case *pollsdata.MedianPollModel:
+		value := gopolls.NewCurrencyValue(int(typedPoll.Value), typedPoll.Currency)
+		return gopolls.NewMoneyPollSkeleton(typedPoll.Name, value), nil
+	case *pollsdata.SchulzePollModel:
+		res := gopolls.NewPollSkeleton(typedPoll.Name)
+		res.Options = make([]string, len(typedPoll.Options))
+		copy(res.Options, typedPoll.Options)
+		return res, nil
+	default:
+		return nil, fmt.Errorf("unsupported poll type %s", poll.ModelPollForType())
+	}
+}
+
+// VotesColumnName returns the name of the column of a poll in a votes file, it contains the name of the group and
+// the poll because polls in different groups may have the same name.
+func VotesColumnName(group *pollsdata.PollGroupModel, poll pollsdata.AbstractPollModel) string {
+	return fmt.Sprintf("%s / %s", group.Name, pollName(poll))
+}
+
+// votesColumnSkeleton is a poll skeleton that is written with the column name of the poll (see VotesColumnName).
+type votesColumnSkeleton struct {
+	gopolls.AbstractPollSkeleton
+	column string
+}
+
+func (skel votesColumnSkeleton) GetName() string {
+	return skel.column
+}
+
+// WriteVotesCSVTemplate writes an empty CSV file for the meeting, it contains a row for each voter and a column for
+// each poll (see VotesColumnName). It can be filled and imported with ImportVotesCSV.
+func WriteVotesCSVTemplate(w io.Writer, meeting *pollsdata.MeetingModel) error {
+	voters := make([]*gopolls.Voter, len(meeting.Voters))
+	for i, voter := range meeting.Voters {
+		voters[i] = gopolls.NewVoter(voter.Name, voter.Weight)
+	}
+	skeletons := make([]gopolls.AbstractPollSkeleton, 0)
+	for _, group := range meeting.Groups {
+		for _, poll := range group.Polls {
+			skel, skelErr := PollModelToSkeleton(poll)
+			if skelErr != nil {
+				return skelErr
+			}
+			skeletons = append(skeletons, votesColumnSkeleton{AbstractPollSkeleton: skel, column: VotesColumnName(group, poll)})
+		}
+	}
+	return gopolls.NewVotesCSVWriter(w).GenerateEmptyTemplate(voters, skeletons)
+}
+
+// VotesImportCellError is an error for a single cell of an imported votes file.
+type VotesImportCellError struct {
+	Line    int
+	Voter   string
+	Poll    string
+	Value   string
+	Message string
+}
+
+func (e *VotesImportCellError) String() string {
+	return fmt.Sprintf("line %d, voter \"%s\", poll \"%s\": %s", e.Line, e.Voter, e.Poll, e.Message)
+}
+
+// ImportedVote is a vote read from a votes file, it is not yet part of the poll.
+type ImportedVote struct {
+	Voter *pollsdata.VoterModel
+	Poll  pollsdata.AbstractPollModel
+	Vote  pollsdata.AbstractVoteModel
+}
+
+// VotesImportResult is the result of reading a votes file.
+//
+// Errors contains errors for whole lines or columns (unknown voters and polls), CellErrors all errors for single
+// votes. Votes contains all valid votes.
+type VotesImportResult struct {
+	Errors     []string
+	CellErrors []*VotesImportCellError
+	Votes      []*ImportedVote
+}
+
+// Valid returns true if the file doesn't contain any errors.
+func (res *VotesImportResult) Valid() bool {
+	return len(res.Errors) == 0 && len(res.CellErrors) == 0
+}
+
+func (res *VotesImportResult) addError(format string, a ...interface{}) {
+	res.Errors = append(res.Errors, fmt.Sprintf(format, a...))
+}
+
+// PollVotes generates ids for all votes and returns them as votes for the data handler (see
+// pollsdata.MeetingsHandler.AddVotes), it should only be called if the result is valid.
+func (res *VotesImportResult) PollVotes() ([]*pollsdata.PollVote, error) {
+	votes := make([]*pollsdata.PollVote, len(res.Votes))
+	for i, imported := range res.Votes {
+		id, idErr := pollsweb.GenUUID()
+		if idErr != nil {
+			return nil, idErr
+		}
+		imported.Vote.SetId(id)
+		votes[i] = pollsdata.NewPollVote(imported.Poll.GetId(), imported.Vote)
+	}
+	return votes, nil
+}
+
+func newVoteParser(poll pollsdata.AbstractPollModel) (gopolls.VoteParser, error) {
+	switch typedPoll := poll.(type) {
+	case *pollsdata.BasicPollModel:
+		return gopolls.NewBasicVoteParser(), nil
+	case *pollsdata.MedianPollModel:
+		return gopolls.NewMedianVoteParser(gopolls.DefaultCurrencyHandler).WithMaxValue(typedPoll.Value), nil
+	case *pollsdata.SchulzePollModel:
+		return gopolls.NewSchulzeVoteParser(len(typedPoll.Options)), nil
+	default:
+		return nil, fmt.Errorf("unsupported poll type %s", poll.ModelPollForType())
+	}
+}
+
+func voteToModel(vote gopolls.AbstractVote, voter *pollsdata.VoterModel) (pollsdata.AbstractVoteModel, error) {
+	switch typedVote := vote.(type) {
+	case *gopolls.BasicVote:
+		return pollsdata.NewBasicPollVoteModel(voter.Name, voter.Slug, typedVote.Choice), nil
+	case *gopolls.MedianVote:
+		return pollsdata.NewMedianPollVoteModel(voter.Name, voter.Slug, typedVote.Value), nil
+	case *gopolls.SchulzeVote:
+		return pollsdata.NewSchulzePollVoteModel(voter.Name, voter.Slug, typedVote.Ranking), nil
+	default:
+		return nil, fmt.Errorf("unsupported vote type %s", vote.VoteType())
+	}
+}
+
+// ImportVotesCSV reads votes for the meeting from a CSV file (as created by WriteVotesCSVTemplate).
+//
+// The first column contains the voter names, the head contains the column names of the polls (see VotesColumnName).
+// Empty cells are ignored (the voter
+// didn't vote in that poll). Unknown voters and polls, invalid votes and votes for polls in which the voter has
+// already voted are reported in the result.
+// The returned error is only set if the file can't be read at all.
+// The meeting is not changed, the votes can be stored with PollVotes.
+func ImportVotesCSV(r io.Reader, meeting *pollsdata.MeetingModel, limits *VotersLimitsConfig) (*VotesImportResult, error) {
+	content, readErr := ioutil.ReadAll(r)
+	if readErr != nil {
+		return nil, readErr
+	}
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	firstLine, _ := bufio.NewReader(bytes.NewReader(content)).ReadString('\n')
+	csvReader := gopolls.NewVotesCSVReader(bytes.NewReader(content))
+	csvReader.Sep = DetectCSVDelimiter(firstLine)
+	if limits != nil {
+		csvReader.MaxVotersNameLength = limits.MaxVotersNameLength
+		if limits.MaxNumVoters >= 0 {
+			csvReader.MaxNumLines = limits.MaxNumVoters + 1
+		}
+	}
+	head, lines, csvErr := csvReader.ReadRecords()
+	if csvErr != nil {
+		return nil, NewFormValidationError("invalid votes file").SetWrapped(csvErr)
+	}
+
+	res := &VotesImportResult{}
+	polls := make(map[string]pollsdata.AbstractPollModel)
+	for _, group := range meeting.Groups {
+		for _, poll := range group.Polls {
+			polls[VotesColumnName(group, poll)] = poll
+		}
+	}
+	voters := make(map[string]*pollsdata.VoterModel, len(meeting.Voters))
+	for _, voter := range meeting.Voters {
+		voters[voter.Name] = voter
+	}
+
+	// columns: the poll for each column (nil if unknown) and a parser
+	columnPolls := make([]pollsdata.AbstractPollModel, len(head))
+	columnParsers := make([]gopolls.VoteParser, len(head))
+	columnVoters := make([]pollsweb.StringSet, len(head))
+	seenPolls := pollsweb.NewStringSet(len(head))
+	for i := 1; i < len(head); i++ {
+		name := strings.TrimSpace(head[i])
+		poll, has := polls[name]
+		if !has {
+			res.addError("unknown poll \"%s\" in column %d", name, i+1)
+			continue
+		}
+		if !seenPolls.Add(name) {
+			res.addError("duplicate poll \"%s\" in column %d", name, i+1)
+			continue
+		}
+		parser, parserErr := newVoteParser(poll)
+		if parserErr != nil {
+			return nil, parserErr
+		}
+		columnPolls[i] = poll
+		columnParsers[i] = parser
+		columnVoters[i] = pollsdata.PollVoterNames(poll)
+	}
+
+	seenVoters := pollsweb.NewStringSet(len(lines))
+	for lineIndex, line := range lines {
+		// the head is line 1
+		lineNum := lineIndex + 2
+		voterName := strings.TrimSpace(line[0])
+		voter, has := voters[voterName]
+		if !has {
+			res.addError("unknown voter \"%s\" in line %d", voterName, lineNum)
+			continue
+		}
+		if !seenVoters.Add(voterName) {
+			res.addError("duplicate voter \"%s\" in line %d", voterName, lineNum)
+			continue
+		}
+		gopollsVoter := gopolls.NewVoter(voter.Name, voter.Weight)
+		for i := 1; i < len(line); i++ {
+			value := strings.TrimSpace(line[i])
+			poll := columnPolls[i]
+			if value == "" || poll == nil {
+				continue
+			}
+			cellErr := &VotesImportCellError{
+				Line:  lineNum,
+				Voter: voterName,
+				Poll:  strings.TrimSpace(head[i]),
+				Value: value,
+			}
+			if !poll.GetPollModel().IsOpen() {
+				cellErr.Message = fmt.Sprintf("poll is %s, votes are only accepted in open polls",
+					poll.GetPollModel().GetState())
+				res.CellErrors = append(res.CellErrors, cellErr)
+				continue
+			}
+			if columnVoters[i].Contains(voterName) {
+				cellErr.Message = "voter has already voted in this poll"
+				res.CellErrors = append(res.CellErrors, cellErr)
+				continue
+			}
+			vote, parseErr := columnParsers[i].ParseFromString(value, gopollsVoter)
+			if parseErr != nil {
+				cellErr.Message = parseErr.Error()
+				res.CellErrors = append(res.CellErrors, cellErr)
+				continue
+			}
+			voteModel, modelErr := voteToModel(vote, voter)
+			if modelErr != nil {
+				return nil, modelErr
+			}
+			res.Votes = append(res.Votes, &ImportedVote{Voter: voter, Poll: poll, Vote: voteModel})
+		}
+	}
+	return res, nil
+}
+
+func MeetingVotesTemplateHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	slug := mux.Vars(r)["slug"]
+	queryArgs := pollsdata.NewMeetingQueryArgs().
+		SetSlug(&slug)
+	meeting, getErr := requestContext.DataHandler.GetMeeting(ctx, queryArgs)
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	var buf bytes.Buffer
+	if writeErr := WriteVotesCSVTemplate(&buf, meeting); writeErr != nil {
+		return writeErr
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-votes.csv\"", meeting.Slug))
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// VotesImportForm is the form for importing votes, the file is uploaded in the multipart field "votes_file".
+// Content and Action work as in VotersImportForm, UpdateToken is the update token of the meeting when the preview
+// was rendered.
+type VotesImportForm struct {
+	Content     string `schema:"content" valid:"-"`
+	Action      string `schema:"action" valid:"in(preview|apply)"`
+	UpdateToken int64  `schema:"update_token" valid:"-"`
+}
+
+func DecodeVotesImportForm(src map[string][]string) (*VotesImportForm, error) {
+	res := VotesImportForm{}
+	err := DecodeForm(&res, src)
+	return &res, err
+}
+
+func MeetingVotesImportHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	slug := mux.Vars(r)["slug"]
+	queryArgs := pollsdata.NewMeetingQueryArgs().
+		SetSlug(&slug)
+	meeting, getErr := requestContext.DataHandler.GetMeeting(ctx, queryArgs)
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	data := requestContext.PrepareTemplateRenderData()
+	data["meeting"] = meeting
+	if r.Method == http.MethodGet {
+		return executeBuffered(requestContext.Templates.TemplateMap["meetings-votes-import"], data, w)
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 2*VotesImportMaxFileSize)
+	if parseErr := r.ParseMultipartForm(VotesImportMaxFileSize); parseErr != nil {
+		return NewError(parseErr, http.StatusBadRequest)
+	}
+	form, formErr := DecodeVotesImportForm(r.PostForm)
+	if formErr != nil {
+		return NewError(formErr, http.StatusBadRequest)
+	}
+	content := form.Content
+	file, _, fileErr := r.FormFile("votes_file")
+	switch {
+	case fileErr == nil:
+		defer file.Close()
+		fileContent, readErr := ioutil.ReadAll(io.LimitReader(file, VotesImportMaxFileSize))
+		if readErr != nil {
+			return readErr
+		}
+		content = string(fileContent)
+	case fileErr != http.ErrMissingFile:
+		return NewError(fileErr, http.StatusBadRequest)
+	}
+	data["content"] = content
+	result, importErr := ImportVotesCSV(strings.NewReader(content), meeting, requestContext.Limits.Voters)
+	if importErr != nil {
+		return NewError(importErr, http.StatusBadRequest)
+	}
+	data["result"] = result
+	if form.Action == "apply" && result.Valid() {
+		votes, votesErr := result.PollVotes()
+		if votesErr != nil {
+			return votesErr
+		}
+		// the update token makes sure that the meeting has not changed since the preview was rendered
+		updateArgs := pollsdata.NewMeetingQueryArgs().
+			SetId(&meeting.Id).
+			SetUpdateToken(&form.UpdateToken)
+		if addErr := requestContext.DataHandler.AddVotes(ctx, updateArgs, votes); addErr != nil {
+			return pollStateAsHandlerError(addErr)
+		}
+		auditEntries := make([]*pollsdata.AuditEntryModel, 0, len(result.Votes))
+		for _, imported := range result.Votes {
+			requestContext.PublishEvent(VoteCastEvent, NewVoteCastEventData(meeting, imported.Poll, imported.Voter.Name))
+			// never record the content of the vote
+			auditEntries = append(auditEntries, requestContext.NewAuditEntry(r, pollsdata.AuditVoteCast).
+				SetPeriodId(meeting.PeriodId).
+				SetMeetingId(meeting.Id).
+				SetPollId(imported.Poll.GetId()).
+				SetDetail("voter", imported.Voter.Name))
+		}
+		if auditErr := requestContext.AuditLog(ctx, auditEntries...); auditErr != nil {
+			return fmt.Errorf("votes have been stored but can't be recorded in the audit log: %w", auditErr)
+		}
+		// AddVotes changed the meeting (votes and update token), render the stored meeting
+		reloaded, reloadErr := requestContext.DataHandler.GetMeeting(ctx, pollsdata.NewMeetingQueryArgs().SetId(&meeting.Id))
+		if reloadErr != nil {
+			return notFoundAsHandlerError(reloadErr)
+		}
+		data["meeting"] = reloaded
+		data["applied"] = len(result.Votes)
+	}
+	return executeBuffered(requestContext.Templates.TemplateMap["meetings-votes-import"], data, w)
+}
@@ -0,0 +1,485 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	WebhookSignatureHeader = "X-Pollsweb-Signature"
+	WebhookTimestampHeader = "X-Pollsweb-Timestamp"
+	WebhookEventHeader     = "X-Pollsweb-Event"
+	WebhookDeliveryHeader  = "X-Pollsweb-Delivery"
+)
+
+// WebhookConfig configures the WebhookDispatcher. QueueSize is the size of the queue of published events and of the
+// delivery queue of each webhook.
+type WebhookConfig struct {
+	QueueSize      int           `mapstructure:"queue_size"`
+	MaxAttempts    int           `mapstructure:"max_attempts"`
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+	Timeout        time.Duration
+	RetryInterval  time.Duration `mapstructure:"retry_interval"`
+}
+
+func NewWebhookConfig() *WebhookConfig {
+	return &WebhookConfig{
+		QueueSize:      100,
+		MaxAttempts:    5,
+		InitialBackoff: 10 * time.Second,
+		MaxBackoff:     time.Hour,
+		Timeout:        10 * time.Second,
+		RetryInterval:  5 * time.Second,
+	}
+}
+
+// Backoff returns the time to wait before the given attempt (starting with 1), the time doubles with each attempt
+// and is capped at MaxBackoff.
+func (config *WebhookConfig) Backoff(attempt int) time.Duration {
+	res := config.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		res *= 2
+		if res >= config.MaxBackoff {
+			return config.MaxBackoff
+		}
+	}
+	return res
+}
+
+// SignWebhookPayload returns the signature of a payload sent at the given time, it is sent in the header
+// WebhookSignatureHeader and the time (unix time in seconds) in the header WebhookTimestampHeader.
+// The signature is the hex encoded HMAC-SHA256 of "<timestamp>.<body>", prefixed with "sha256=". The timestamp is
+// signed as well, receivers should reject old timestamps such that captured requests can't be replayed.
+func SignWebhookPayload(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type webhookJob struct {
+	webhook *pollsdata.WebhookModel
+	event   *Event
+	body    []byte
+	attempt int
+}
+
+// WebhookDispatcher delivers events published on the EventBroker to all registered webhooks.
+//
+// Events are handled one after the other in the order they're published. Each webhook has its own queue with a
+// single worker, thus the first attempts of the deliveries to a webhook are sent in the order of the events.
+// Failed deliveries are retried with an exponential backoff, a retry is sent after the deliveries of the events
+// published in the meantime (receivers can order events by their created time).
+// Each attempt is stored as a WebhookDeliveryModel, a failed attempt stores the time of the next attempt. The
+// dispatcher checks for due retries every RetryInterval, thus retries are not lost if the server is restarted.
+type WebhookDispatcher struct {
+	*AppContext
+	Client *http.Client
+	events chan *Event
+	ctx    context.Context
+	wg     sync.WaitGroup
+
+	// the queues of the webhooks by webhook id, the worker of a queue is started with the queue
+	queuesMutex sync.Mutex
+	queues      map[uuid.UUID]chan *webhookJob
+}
+
+func NewWebhookDispatcher(appContext *AppContext) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		AppContext: appContext,
+		Client: &http.Client{
+			Timeout: appContext.Webhooks.Timeout,
+		},
+		events: make(chan *Event, appContext.Webhooks.QueueSize),
+		queues: make(map[uuid.UUID]chan *webhookJob),
+	}
+}
+
+// Start subscribes to the event broker and starts handling events and retries, the workers stop once ctx is done.
+func (d *WebhookDispatcher) Start(ctx context.Context) {
+	d.ctx = ctx
+	unsubscribe := d.Events.Subscribe(d.handleEvent)
+	d.wg.Add(1)
+	go d.dispatch()
+	d.wg.Add(1)
+	go d.retry()
+	go func() {
+		<-ctx.Done()
+		unsubscribe()
+	}()
+}
+
+// Wait waits until all workers have stopped.
+func (d *WebhookDispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// webhookQueue returns the queue of the webhook, the queue and its worker are created on first use.
+func (d *WebhookDispatcher) webhookQueue(webhookId uuid.UUID) chan *webhookJob {
+	d.queuesMutex.Lock()
+	defer d.queuesMutex.Unlock()
+	queue, exists := d.queues[webhookId]
+	if !exists {
+		queue = make(chan *webhookJob, d.Webhooks.QueueSize)
+		d.queues[webhookId] = queue
+		d.wg.Add(1)
+		go d.work(queue)
+	}
+	return queue
+}
+
+func (d *WebhookDispatcher) enqueue(job *webhookJob) {
+	select {
+	case d.webhookQueue(job.webhook.Id) <- job:
+	case <-d.ctx.Done():
+	default:
+		d.Logger.Errorw("webhook queue is full, dropping delivery",
+			"webhook", job.webhook.Id,
+			"event", job.event.Type,
+			"event-id", job.event.Id)
+	}
+}
+
+func (d *WebhookDispatcher) handleEvent(event *Event) {
+	// don't block the publisher, looking up webhooks requires a database query
+	select {
+	case d.events <- event:
+	default:
+		d.Logger.Errorw("webhook event queue is full, dropping event",
+			"event", event.Type,
+			"event-id", event.Id)
+	}
+}
+
+// dispatch handles the published events in order until ctx is done.
+func (d *WebhookDispatcher) dispatch() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case event := <-d.events:
+			d.dispatchEvent(event)
+		}
+	}
+}
+
+// dispatchEvent enqueues a delivery of the event for each webhook that subscribed to it.
+func (d *WebhookDispatcher) dispatchEvent(event *Event) {
+	ctx, cancel := context.WithTimeout(d.ctx, d.HandlerTimeout)
+	defer cancel()
+	webhooks, getErr := d.DataHandler.GetWebhooks(ctx, event.Type)
+	if getErr != nil {
+		d.Logger.Errorw("can't get webhooks for event",
+			"event", event.Type,
+			"error", getErr)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+	body, encodeErr := json.Marshal(event)
+	if encodeErr != nil {
+		d.Logger.Errorw("can't encode event",
+			"event", event.Type,
+			"error", encodeErr)
+		return
+	}
+	for _, webhook := range webhooks {
+		d.enqueue(&webhookJob{
+			webhook: webhook,
+			event:   event,
+			body:    body,
+			attempt: 1,
+		})
+	}
+}
+
+func (d *WebhookDispatcher) work(queue chan *webhookJob) {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case job := <-queue:
+			d.process(job)
+		}
+	}
+}
+
+func (d *WebhookDispatcher) process(job *webhookJob) {
+	ctx, cancel := context.WithTimeout(d.ctx, d.HandlerTimeout)
+	defer cancel()
+	delivery := d.Deliver(ctx, job.webhook, job.event, job.body, job.attempt)
+	switch {
+	case delivery.Success:
+	case job.attempt >= d.Webhooks.MaxAttempts:
+		d.Logger.Warnw("webhook delivery failed, giving up",
+			"webhook", job.webhook.Id,
+			"event", job.event.Type,
+			"attempts", job.attempt)
+	default:
+		delivery.Payload = job.body
+		delivery.RetryAt = delivery.Time.Add(d.Webhooks.Backoff(job.attempt))
+	}
+	if _, insertErr := d.DataHandler.InsertWebhookDelivery(ctx, delivery); insertErr != nil {
+		d.Logger.Errorw("can't store webhook delivery",
+			"webhook", job.webhook.Id,
+			"error", insertErr)
+	}
+}
+
+func (d *WebhookDispatcher) retry() {
+	defer d.wg.Done()
+	for {
+		// also runs directly after the start, retries might be due from before a restart
+		if retryErr := d.RetryDue(d.ctx); retryErr != nil && d.ctx.Err() == nil {
+			d.Logger.Errorw("can't retry webhook deliveries",
+				"error", retryErr)
+		}
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-d.Clock.After(d.Webhooks.RetryInterval):
+		}
+	}
+}
+
+// RetryDue enqueues a new attempt for each stored delivery with a retry that is due now.
+// It blocks until all retries are enqueued (or ctx is done).
+func (d *WebhookDispatcher) RetryDue(ctx context.Context) error {
+	getCtx, cancel := context.WithTimeout(ctx, d.HandlerTimeout)
+	defer cancel()
+	deliveries, getErr := d.DataHandler.GetDueWebhookDeliveries(getCtx, d.Clock.Now(), int64(d.Webhooks.QueueSize))
+	if getErr != nil {
+		return getErr
+	}
+	for _, delivery := range deliveries {
+		job, jobErr := d.retryJob(ctx, delivery)
+		if jobErr != nil {
+			return jobErr
+		}
+		if job == nil {
+			continue
+		}
+		select {
+		case d.webhookQueue(job.webhook.Id) <- job:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// retryJob claims the retry of a delivery and returns the job for the next attempt.
+// It returns nil if the retry was already claimed or the webhook was deleted or deactivated.
+func (d *WebhookDispatcher) retryJob(ctx context.Context, delivery *pollsdata.WebhookDeliveryModel) (*webhookJob, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.HandlerTimeout)
+	defer cancel()
+	webhook, getErr := d.DataHandler.GetWebhook(ctx, delivery.WebhookId)
+	var notFound pollsdata.EntryNotFoundError
+	if errors.As(getErr, &notFound) {
+		webhook, getErr = nil, nil
+	}
+	if getErr != nil {
+		return nil, getErr
+	}
+	claimed, claimErr := d.DataHandler.ClaimWebhookDeliveryRetry(ctx, delivery.Id)
+	if claimErr != nil {
+		return nil, claimErr
+	}
+	if !claimed || webhook == nil || !webhook.Active {
+		return nil, nil
+	}
+	return &webhookJob{
+		webhook: webhook,
+		event: &Event{
+			Id:   delivery.EventId,
+			Type: delivery.Event,
+		},
+		body:    delivery.Payload,
+		attempt: delivery.Attempt + 1,
+	}, nil
+}
+
+// Deliver sends the body to the webhook once and returns the result as a WebhookDeliveryModel (the result is not
+// stored).
+// Each status code in the range 200 - 299 is considered a success.
+func (d *WebhookDispatcher) Deliver(ctx context.Context, webhook *pollsdata.WebhookModel, event *Event, body []byte, attempt int) *pollsdata.WebhookDeliveryModel {
+	delivery := pollsdata.NewWebhookDeliveryModel(d.Clock, webhook.Id, event.Id, event.Type, attempt)
+	start := time.Now()
+	defer func() {
+		delivery.Duration = time.Since(start)
+	}()
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if requestErr != nil {
+		delivery.Error = requestErr.Error()
+		return delivery
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "pollsweb-webhooks")
+	request.Header.Set(WebhookEventHeader, event.Type)
+	request.Header.Set(WebhookDeliveryHeader, event.Id.String())
+	request.Header.Set(WebhookTimestampHeader, strconv.FormatInt(delivery.Time.Unix(), 10))
+	request.Header.Set(WebhookSignatureHeader, SignWebhookPayload(webhook.Secret, delivery.Time, body))
+	response, responseErr := d.Client.Do(request)
+	if responseErr != nil {
+		delivery.Error = responseErr.Error()
+		return delivery
+	}
+	defer response.Body.Close()
+	// read the body (but ignore it) such that the connection can be re-used
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64*1024))
+	delivery.StatusCode = response.StatusCode
+	delivery.Success = response.StatusCode >= 200 && response.StatusCode < 300
+	if !delivery.Success {
+		delivery.Error = response.Status
+	}
+	return delivery
+}
+
+type WebhookForm struct {
+	URL    string   `schema:"url" valid:"url,required"`
+	Secret string   `schema:"secret" valid:"runelength(16|250)"`
+	Events []string `schema:"events" valid:"-"`
+}
+
+func (form WebhookForm) ValidateForm() error {
+	if len(form.Events) == 0 {
+		return NewFormValidationError("at least one event must be selected").SetFieldName("events")
+	}
+	for _, event := range form.Events {
+		if !IsEventType(event) {
+			return NewFormValidationError(fmt.Sprintf("unknown event \"%s\"", event)).SetFieldName("events")
+		}
+	}
+	return nil
+}
+
+func DecodeWebhookForm(src map[string][]string) (*WebhookForm, error) {
+	res := WebhookForm{}
+	err := DecodeForm(&res, src)
+	return &res, err
+}
+
+func parseWebhookId(r *http.Request) (uuid.UUID, error) {
+	id, parseErr := uuid.Parse(mux.Vars(r)["id"])
+	if parseErr != nil {
+		return id, NewError(parseErr, http.StatusNotFound)
+	}
+	return id, nil
+}
+
+func getWebhooksListHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	webhooks, getErr := requestContext.DataHandler.GetWebhooks(ctx, "")
+	if getErr != nil {
+		return getErr
+	}
+	data := requestContext.PrepareTemplateRenderData()
+	data["webhooks"] = webhooks
+	data["event_types"] = AllEventTypes
+	return executeBuffered(requestContext.Templates.TemplateMap["webhooks-list"], data, w)
+}
+
+func postWebhooksListHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	if parseErr := r.ParseForm(); parseErr != nil {
+		return parseErr
+	}
+	form, formErr := DecodeWebhookForm(r.PostForm)
+	if formErr != nil {
+		return NewError(formErr, http.StatusBadRequest)
+	}
+	webhook := pollsdata.NewWebhookModel(requestContext.Clock, form.URL, form.Secret, form.Events)
+	if _, insertErr := requestContext.DataHandler.InsertWebhook(ctx, webhook); insertErr != nil {
+		return insertErr
+	}
+	requestContext.AuditLog(ctx, requestContext.NewAuditEntry(r, pollsdata.AuditWebhookCreated).
+		SetDetail("webhook", webhook.Id.String()).
+		SetDetail("url", webhook.URL).
+		SetDetail("events", strings.Join(webhook.Events, ",")))
+	listURL, urlErr := requestContext.URLString("webhooks-list")
+	if urlErr != nil {
+		return urlErr
+	}
+	http.Redirect(w, r, listURL, http.StatusSeeOther)
+	return nil
+}
+
+func WebhooksListHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	if r.Method == http.MethodGet {
+		return getWebhooksListHandleFunc(ctx, requestContext, w, r)
+	}
+	return postWebhooksListHandleFunc(ctx, requestContext, w, r)
+}
+
+func DeleteWebhookHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	id, idErr := parseWebhookId(r)
+	if idErr != nil {
+		return idErr
+	}
+	num, deleteErr := requestContext.DataHandler.DeleteWebhook(ctx, id)
+	if deleteErr != nil {
+		return deleteErr
+	}
+	if num > 0 {
+		requestContext.AuditLog(ctx, requestContext.NewAuditEntry(r, pollsdata.AuditWebhookDeleted).
+			SetDetail("webhook", id.String()))
+	}
+	listURL, urlErr := requestContext.URLString("webhooks-list")
+	if urlErr != nil {
+		return urlErr
+	}
+	http.Redirect(w, r, listURL, http.StatusSeeOther)
+	return nil
+}
+
+func WebhookDeliveriesHandleFunc(ctx context.Context, requestContext *RequestContext, w http.ResponseWriter, r *http.Request) error {
+	id, idErr := parseWebhookId(r)
+	if idErr != nil {
+		return idErr
+	}
+	webhook, getErr := requestContext.DataHandler.GetWebhook(ctx, id)
+	if getErr != nil {
+		return notFoundAsHandlerError(getErr)
+	}
+	deliveries, deliveriesErr := requestContext.DataHandler.GetWebhookDeliveries(ctx, id, 100)
+	if deliveriesErr != nil {
+		return deliveriesErr
+	}
+	data := requestContext.PrepareTemplateRenderData()
+	data["webhook"] = webhook
+	data["deliveries"] = deliveries
+	return executeBuffered(requestContext.Templates.TemplateMap["webhooks-deliveries"], data, w)
+}
@@ -79,3 +79,34 @@ function initPeriodForm(formPrefix) {
         $.post('?' + $.param(queryData) );
     });
 }
+
+function updateLivePollStatus(status) {
+    let row = $('#poll-' + status.id);
+    if (row.length === 0) {
+        return;
+    }
+    row.find('.live-voted').text(status.num_voted + ' / ' + status.num_voters);
+    row.find('.live-weight').text(status.weight_voted + ' / ' + status.weight_total);
+    let percentage = status.weight_total > 0 ? Math.round(100 * status.weight_voted / status.weight_total) : 0;
+    row.find('.progress-bar').css('width', percentage + '%').text(percentage + '%');
+    if (status.result !== undefined) {
+        row.find('.live-result').text(status.result);
+    }
+}
+
+// listens for the server-sent events of a meeting and updates the rows of the live table
+function initMeetingLive(eventsURL) {
+    let statusBadge = $('#liveStatus');
+    let source = new EventSource(eventsURL);
+    let handler = function (e) {
+        JSON.parse(e.data).forEach(updateLivePollStatus);
+    };
+    source.addEventListener('turnout', handler);
+    source.addEventListener('results', handler);
+    source.onopen = function () {
+        statusBadge.removeClass('badge-secondary badge-danger').addClass('badge-success').text('live');
+    };
+    source.onerror = function () {
+        statusBadge.removeClass('badge-success').addClass('badge-danger').text('reconnecting');
+    };
+}
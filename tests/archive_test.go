@@ -0,0 +1,292 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/google/uuid"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// archiveTestHandler is an in-memory DataHandler with the methods used by the archive functions.
+type archiveTestHandler struct {
+	pollsdata.DataHandler
+	periods  []*pollsdata.PeriodSettingsModel
+	meetings []*pollsdata.MeetingModel
+	audit    []*pollsdata.AuditEntryModel
+	chains   map[uuid.UUID][]*pollsdata.ChainEntryModel
+}
+
+func (h *archiveTestHandler) GetPeriod(ctx context.Context, args *pollsdata.PeriodSettingsQueryArgs) (*pollsdata.PeriodSettingsModel, error) {
+	for _, period := range h.periods {
+		if (args.Id != nil && period.Id == *args.Id) || (args.Slug != nil && period.Slug == *args.Slug) ||
+			(args.Name != nil && period.Name == *args.Name) {
+			return period, nil
+		}
+	}
+	return nil, pollsdata.NewEntryNotFoundError(reflect.TypeOf(pollsdata.PeriodSettingsModel{}), reflect.ValueOf(args), nil)
+}
+
+func (h *archiveTestHandler) ListPeriods(ctx context.Context, query *pollsdata.PeriodListQuery) (*pollsdata.PeriodListPage, error) {
+	return pollsdata.ListPeriodModels(h.periods, query)
+}
+
+func (h *archiveTestHandler) GetMeeting(ctx context.Context, args *pollsdata.MeetingQueryArgs) (*pollsdata.MeetingModel, error) {
+	for _, meeting := range h.meetings {
+		if (args.Id != nil && meeting.Id == *args.Id) || (args.Slug != nil && meeting.Slug == *args.Slug) ||
+			(args.Name != nil && meeting.Name == *args.Name) {
+			return meeting, nil
+		}
+	}
+	return nil, pollsdata.NewEntryNotFoundError(reflect.TypeOf(pollsdata.MeetingModel{}), reflect.ValueOf(args), nil)
+}
+
+func (h *archiveTestHandler) ListMeetings(ctx context.Context, query *pollsdata.MeetingListQuery) (*pollsdata.MeetingListPage, error) {
+	return pollsdata.ListMeetingSummaries(h.meetings, query)
+}
+
+func (h *archiveTestHandler) ListAuditEntries(ctx context.Context, query *pollsdata.AuditQuery) (*pollsdata.AuditPage, error) {
+	return pollsdata.ListAuditEntries(h.audit, query)
+}
+
+func (h *archiveTestHandler) GetChain(ctx context.Context, meetingId uuid.UUID) ([]*pollsdata.ChainEntryModel, error) {
+	return h.chains[meetingId], nil
+}
+
+func (h *archiveTestHandler) GetChainMeetingIds(ctx context.Context) ([]uuid.UUID, error) {
+	res := make([]uuid.UUID, 0, len(h.chains))
+	for meetingId, chain := range h.chains {
+		if len(chain) > 0 {
+			res = append(res, meetingId)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return bytes.Compare(res[i][:], res[j][:]) < 0
+	})
+	return res, nil
+}
+
+func (h *archiveTestHandler) WriteImport(ctx context.Context, data *pollsdata.ArchiveImportData) (*pollsdata.ArchiveWriteResult, error) {
+	res := &pollsdata.ArchiveWriteResult{}
+	if data.Replace {
+		res.PeriodsDeleted, res.MeetingsDeleted = int64(len(h.periods)), int64(len(h.meetings))
+		res.AuditEntriesDeleted = int64(len(h.audit))
+		for _, chain := range h.chains {
+			res.ChainEntriesDeleted += int64(len(chain))
+		}
+		h.periods, h.meetings, h.audit, h.chains = nil, nil, nil, nil
+	}
+	h.periods = append(h.periods, data.Periods...)
+	h.meetings = append(h.meetings, data.Meetings...)
+	existing := make(map[uuid.UUID]struct{}, len(h.audit))
+	for _, entry := range h.audit {
+		existing[entry.Id] = struct{}{}
+	}
+	for _, entry := range data.AuditEntries {
+		if _, ok := existing[entry.Id]; !ok {
+			h.audit = append(h.audit, entry)
+			res.AuditEntriesWritten++
+		}
+	}
+	if h.chains == nil {
+		h.chains = make(map[uuid.UUID][]*pollsdata.ChainEntryModel)
+	}
+	for _, entry := range data.ChainEntries {
+		if int(entry.Sequence) > len(h.chains[entry.MeetingId]) {
+			h.chains[entry.MeetingId] = append(h.chains[entry.MeetingId], entry)
+			res.ChainEntriesWritten++
+		}
+	}
+	return res, nil
+}
+
+func newArchiveTestHandler(t *testing.T) *archiveTestHandler {
+	clock := pollsweb.NewFakeClock(testMeetingTime)
+	period := pollsdata.NewPeriodSettingsModel(clock, "Period 2020", "period-2020",
+		pollsdata.NewMeetingTimeTemplateModel(time.Monday, 18, 0), nil,
+		testMeetingTime.Add(-time.Hour), testMeetingTime.Add(time.Hour))
+	period.Id = uuid.New()
+	meeting := testMeeting(t)
+	meeting.PeriodId = period.Id
+	meeting.Groups[0].Polls[0].GetPollModel().RollCall = true
+	entry := pollsdata.NewAuditEntryModel(clock, "admin", "192.0.2.1", pollsdata.AuditMeetingCreated)
+	entry.Id, entry.MeetingId = uuid.New(), meeting.Id
+	record, recordErr := pollsdata.NewAuditChainRecord(entry)
+	if recordErr != nil {
+		t.Fatal(recordErr)
+	}
+	chain := pollsdata.NewChainEntries(nil, meeting.Id, testMeetingTime, []*pollsdata.ChainRecord{record})
+	chain[0].Id = uuid.New()
+	return &archiveTestHandler{
+		periods:  []*pollsdata.PeriodSettingsModel{period},
+		meetings: []*pollsdata.MeetingModel{meeting},
+		audit:    []*pollsdata.AuditEntryModel{entry},
+		chains:   map[uuid.UUID][]*pollsdata.ChainEntryModel{meeting.Id: chain},
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := newArchiveTestHandler(t)
+	archive, exportErr := pollsdata.ExportArchive(ctx, src, testMeetingTime)
+	if exportErr != nil {
+		t.Fatal(exportErr)
+	}
+	for _, compress := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := pollsdata.WriteArchive(&buf, archive, compress); err != nil {
+			t.Fatal(err)
+		}
+		read, readErr := pollsdata.ReadArchive(&buf)
+		if readErr != nil {
+			t.Fatal(readErr)
+		}
+		if err := read.Verify(); err != nil {
+			t.Fatalf("expected a valid archive (compress = %v), got %v", compress, err)
+		}
+		dst := &archiveTestHandler{}
+		res, importErr := pollsdata.ImportArchive(ctx, dst, read, pollsdata.ArchiveImportMerge)
+		if importErr != nil {
+			t.Fatal(importErr)
+		}
+		if res.PeriodsImported != 1 || res.MeetingsImported != 1 {
+			t.Errorf("expected one period and one meeting to be imported, got %+v", res)
+		}
+		if dst.periods[0].Id != archive.Periods[0].Id || dst.meetings[0].PeriodId != dst.periods[0].Id {
+			t.Error("expected the ids from the archive to be kept")
+		}
+		reexported, reexportErr := pollsdata.ExportArchive(ctx, dst, testMeetingTime)
+		if reexportErr != nil {
+			t.Fatal(reexportErr)
+		}
+		if !reflect.DeepEqual(reexported.Periods, archive.Periods) || !reflect.DeepEqual(reexported.Meetings, archive.Meetings) {
+			t.Error("the imported data differs from the exported data")
+		}
+		if len(read.AuditEntries) != 1 || len(read.Chains) != 1 || res.AuditEntriesImported != 1 || res.ChainEntriesImported != 1 {
+			t.Errorf("expected the audit entry and the chain to be imported, got %+v", res)
+		}
+		if !reflect.DeepEqual(reexported.AuditEntries, archive.AuditEntries) || !reflect.DeepEqual(reexported.Chains, archive.Chains) {
+			t.Error("the imported audit log or chain differs from the exported data")
+		}
+	}
+}
+
+func TestArchiveVerify(t *testing.T) {
+	archive, exportErr := pollsdata.ExportArchive(context.Background(), newArchiveTestHandler(t), testMeetingTime)
+	if exportErr != nil {
+		t.Fatal(exportErr)
+	}
+	var verificationErr pollsdata.ArchiveVerificationError
+	// change a vote without updating the checksum
+	answer := *archive.Meetings[0].Groups[0].Polls[0].Votes[0].Answer + 1
+	archive.Meetings[0].Groups[0].Polls[0].Votes[0].Answer = &answer
+	if err := archive.Verify(); !errors.As(err, &verificationErr) {
+		t.Errorf("expected a checksum error, got %v", err)
+	}
+	// a meeting of an unknown period
+	archive.Meetings[0].PeriodId = uuid.New()
+	if err := archive.UpdateChecksum(); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Verify(); !errors.As(err, &verificationErr) {
+		t.Errorf("expected an error for an unknown period, got %v", err)
+	}
+	// unsupported version
+	archive.Meetings[0].PeriodId = archive.Periods[0].Id
+	archive.Version = pollsdata.ArchiveFormatVersion + 1
+	if err := archive.UpdateChecksum(); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Verify(); !errors.As(err, &verificationErr) {
+		t.Errorf("expected an error for an unsupported version, got %v", err)
+	}
+	// a chain entry that doesn't match its hash
+	archive.Version = pollsdata.ArchiveFormatVersion
+	archive.Chains[0].Digest = "changed"
+	if err := archive.UpdateChecksum(); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Verify(); !errors.As(err, &verificationErr) {
+		t.Errorf("expected an error for a changed chain entry, got %v", err)
+	}
+}
+
+func TestArchiveImportModes(t *testing.T) {
+	ctx := context.Background()
+	src := newArchiveTestHandler(t)
+	archive, exportErr := pollsdata.ExportArchive(ctx, src, testMeetingTime)
+	if exportErr != nil {
+		t.Fatal(exportErr)
+	}
+	// importing into the same handler skips everything
+	res, mergeErr := pollsdata.ImportArchive(ctx, src, archive, pollsdata.ArchiveImportMerge)
+	if mergeErr != nil {
+		t.Fatal(mergeErr)
+	}
+	if res.PeriodsSkipped != 1 || res.MeetingsSkipped != 1 || res.PeriodsImported != 0 || res.MeetingsImported != 0 {
+		t.Errorf("expected everything to be skipped, got %+v", res)
+	}
+	var verificationErr pollsdata.ArchiveVerificationError
+	// a period with the same slug but another id is a conflict, nothing is written
+	dst := newArchiveTestHandler(t)
+	if _, err := pollsdata.ImportArchive(ctx, dst, archive, pollsdata.ArchiveImportMerge); !errors.As(err, &verificationErr) {
+		t.Errorf("expected a conflict for a period with the same slug, got %v", err)
+	}
+	if len(dst.periods) != 1 || len(dst.meetings) != 1 {
+		t.Error("expected nothing to be imported after a conflict")
+	}
+	// the same for a meeting with the same name but another id and slug
+	dst = &archiveTestHandler{periods: src.periods}
+	other := testMeeting(t)
+	other.PeriodId, other.Slug = src.periods[0].Id, "other-meeting"
+	dst.meetings = []*pollsdata.MeetingModel{other}
+	if _, err := pollsdata.ImportArchive(ctx, dst, archive, pollsdata.ArchiveImportMerge); !errors.As(err, &verificationErr) {
+		t.Errorf("expected a conflict for a meeting with the same name, got %v", err)
+	}
+	if len(dst.meetings) != 1 {
+		t.Error("expected nothing to be imported after a conflict")
+	}
+	dst = newArchiveTestHandler(t)
+	// replace deletes the existing data first
+	res, replaceErr := pollsdata.ImportArchive(ctx, dst, archive, pollsdata.ArchiveImportReplace)
+	if replaceErr != nil {
+		t.Fatal(replaceErr)
+	}
+	if res.PeriodsDeleted != 1 || res.MeetingsDeleted != 1 || res.PeriodsImported != 1 || res.MeetingsImported != 1 {
+		t.Errorf("unexpected import result %+v", res)
+	}
+	if len(dst.meetings) != 1 || dst.meetings[0].Id != archive.Meetings[0].Id {
+		t.Error("expected the meeting from the archive after replace")
+	}
+}
+
+func TestParseArchiveImportMode(t *testing.T) {
+	for _, mode := range []pollsdata.ArchiveImportMode{pollsdata.ArchiveImportMerge, pollsdata.ArchiveImportReplace} {
+		parsed, err := pollsdata.ParseArchiveImportMode(mode.String())
+		if err != nil || parsed != mode {
+			t.Errorf("can't parse mode %s: got %s, %v", mode, parsed, err)
+		}
+	}
+	if _, err := pollsdata.ParseArchiveImportMode("append"); err == nil {
+		t.Error("expected an error for an invalid import mode")
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/FabianWe/pollsweb/server"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAuditActor(t *testing.T) {
+	config := server.NewAppConfig()
+	config.Audit.ActorHeader = "X-Remote-User"
+	config.Audit.RemoteAddrHeader = "X-Forwarded-For"
+	appContext := server.NewAppContext(config, zap.NewNop().Sugar(), nil, "")
+
+	r := httptest.NewRequest("POST", "/periods/create", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	if actor := appContext.AuditActor(r); actor != server.AuditAnonymousActor {
+		t.Errorf("expected actor %s, got %s", server.AuditAnonymousActor, actor)
+	}
+	if addr := appContext.AuditRemoteAddr(r); addr != "192.0.2.1" {
+		t.Errorf("expected remote address 192.0.2.1, got %s", addr)
+	}
+	// basic auth is not checked by the server, so the user name is not used
+	r.SetBasicAuth("alice", "secret")
+	if actor := appContext.AuditActor(r); actor != server.AuditAnonymousActor {
+		t.Errorf("expected actor %s with basic auth, got %s", server.AuditAnonymousActor, actor)
+	}
+	r.Header.Set("X-Remote-User", "bob")
+	r.Header.Set("X-Forwarded-For", "198.51.100.7, 10.0.0.1")
+	// the header is only read from trusted proxies
+	if actor := appContext.AuditActor(r); actor != server.AuditAnonymousActor {
+		t.Errorf("expected the header of an untrusted client to be ignored, got %s", actor)
+	}
+	appContext.Audit.TrustedProxyAddrs = []string{"198.51.100.0/24", "192.0.2.1"}
+	if actor := appContext.AuditActor(r); actor != "bob" {
+		t.Errorf("expected actor bob from the header, got %s", actor)
+	}
+	// by default only the proxy in front of the server is trusted
+	if addr := appContext.AuditRemoteAddr(r); addr != "10.0.0.1" {
+		t.Errorf("expected remote address 10.0.0.1, got %s", addr)
+	}
+	// the client can set the header itself, only the addresses appended by trusted proxies are used
+	r.Header.Add("X-Forwarded-For", "203.0.113.9")
+	appContext.Audit.TrustedProxies = 2
+	if addr := appContext.AuditRemoteAddr(r); addr != "10.0.0.1" {
+		t.Errorf("expected remote address 10.0.0.1, got %s", addr)
+	}
+	appContext.Audit.TrustedProxies = 4
+	if addr := appContext.AuditRemoteAddr(r); addr != "192.0.2.1" {
+		t.Errorf("expected remote address of the connection with too few forwarded addresses, got %s", addr)
+	}
+
+	// headers are ignored if they're not configured
+	appContext = server.NewAppContext(server.NewAppConfig(), zap.NewNop().Sugar(), nil, "")
+	appContext.Audit.TrustedProxyAddrs = []string{"192.0.2.1"}
+	if actor := appContext.AuditActor(r); actor != server.AuditAnonymousActor {
+		t.Errorf("expected actor %s, got %s", server.AuditAnonymousActor, actor)
+	}
+	if addr := appContext.AuditRemoteAddr(r); addr != "192.0.2.1" {
+		t.Errorf("expected remote address 192.0.2.1, got %s", addr)
+	}
+}
+
+func TestAuditProxyNetworks(t *testing.T) {
+	config := server.NewAuditConfig()
+	config.TrustedProxyAddrs = []string{"10.0.0.1", "192.0.2.0/24", "::1"}
+	networks, err := config.ProxyNetworks()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(networks) != 3 || !networks[0].Contains(net.ParseIP("10.0.0.1")) || networks[0].Contains(net.ParseIP("10.0.0.2")) {
+		t.Errorf("unexpected networks %v", networks)
+	}
+	config.TrustedProxyAddrs = []string{"proxy.example.com"}
+	if _, err := config.ProxyNetworks(); err == nil {
+		t.Error("expected an error for a host name")
+	}
+}
+
+func TestAuditLogFailures(t *testing.T) {
+	handler, _, closeHandler := openBoltTestHandler(t)
+	appContext := server.NewAppContext(server.NewAppConfig(), zap.NewNop().Sugar(), handler, "")
+	r := httptest.NewRequest("POST", "/periods/create", nil)
+	if err := appContext.AuditLog(context.Background(), appContext.NewAuditEntry(r, pollsdata.AuditPeriodCreated)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// writing to a closed database fails
+	closeHandler()
+	err := appContext.AuditLog(context.Background(),
+		appContext.NewAuditEntry(r, pollsdata.AuditVoteCast),
+		appContext.NewAuditEntry(r, pollsdata.AuditVoteCast))
+	if err == nil {
+		t.Error("expected an error for a closed database")
+	}
+	if num := appContext.NumAuditFailures(); num != 2 {
+		t.Errorf("expected 2 failed entries, got %d", num)
+	}
+}
+
+func TestAuditListForm(t *testing.T) {
+	tests := []struct {
+		src   map[string][]string
+		field string
+	}{
+		{map[string][]string{}, ""},
+		{map[string][]string{"action": {pollsdata.AuditVoteCast}, "from": {"2020/07/01"}, "to": {"2020/07/31"}}, ""},
+		{map[string][]string{"action": {"meeting.renamed"}}, "action"},
+		{map[string][]string{"from": {"01.07.2020"}}, "from"},
+		{map[string][]string{"to": {"tomorrow"}}, "to"},
+	}
+	for _, tc := range tests {
+		// the form is validated while decoding
+		_, err := server.DecodeAuditListForm(tc.src)
+		if tc.field == "" {
+			if err != nil {
+				t.Errorf("expected %v to be valid, got %v", tc.src, err)
+			}
+			continue
+		}
+		validationErr, ok := err.(*server.FormValidationError)
+		if !ok || validationErr.FieldName != tc.field {
+			t.Errorf("expected a validation error for field %s, got %v", tc.field, err)
+		}
+	}
+}
+
+func auditTestEntries() []*pollsdata.AuditEntryModel {
+	clock := pollsweb.NewFakeClock(time.Date(2020, 7, 1, 18, 0, 0, 0, time.UTC))
+	created := pollsdata.NewAuditEntryModel(clock, "alice", "192.0.2.1", pollsdata.AuditPeriodCreated).
+		SetPeriodId(uuid.MustParse("7e4a5c6a-2f0a-4a8b-9d41-1a5d0b3c9e11")).
+		SetDetail("slug", "period-one").
+		SetDetail("name", "Period One")
+	created.Id = uuid.MustParse("0b7c5a9e-5b0e-4a36-8d8c-5e0c3b5f1a01")
+	clock.Advance(time.Minute)
+	vote := pollsdata.NewAuditEntryModel(clock, "bob", "198.51.100.7", pollsdata.AuditVoteCast).
+		SetMeetingId(uuid.MustParse("3f6b1d2e-8c4a-4f5e-a7b9-0c1d2e3f4a5b")).
+		SetPollId(uuid.MustParse("9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d")).
+		SetDetail("voter", "bob")
+	vote.Id = uuid.MustParse("0b7c5a9e-5b0e-4a36-8d8c-5e0c3b5f1a02")
+	return []*pollsdata.AuditEntryModel{created, vote}
+}
+
+func TestFormatAuditDetails(t *testing.T) {
+	if got := server.FormatAuditDetails(map[string]string{"slug": "period-one", "name": "Period One"}); got != "name=Period One; slug=period-one" {
+		t.Errorf("unexpected details %q", got)
+	}
+	if got := server.FormatAuditDetails(nil); got != "" {
+		t.Errorf("expected empty details, got %q", got)
+	}
+}
+
+func TestWriteAuditCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := server.WriteAuditCSV(&buf, auditTestEntries()); err != nil {
+		t.Fatal(err)
+	}
+	records, readErr := csv.NewReader(&buf).ReadAll()
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	expected := [][]string{
+		server.AuditCSVHead(),
+		{"0b7c5a9e-5b0e-4a36-8d8c-5e0c3b5f1a01", "2020-07-01T18:00:00Z", "alice", "192.0.2.1", "period.created",
+			"7e4a5c6a-2f0a-4a8b-9d41-1a5d0b3c9e11", "", "", "name=Period One; slug=period-one"},
+		{"0b7c5a9e-5b0e-4a36-8d8c-5e0c3b5f1a02", "2020-07-01T18:01:00Z", "bob", "198.51.100.7", "vote.cast",
+			"", "3f6b1d2e-8c4a-4f5e-a7b9-0c1d2e3f4a5b", "9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d", "voter=bob"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected csv\n%v\ngot\n%v", expected, records)
+	}
+}
+
+func TestWriteAuditJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := server.WriteAuditJSON(&buf, auditTestEntries()); err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected two entries, got %d", len(got))
+	}
+	if got[0]["action"] != "period.created" || got[0]["period_id"] != "7e4a5c6a-2f0a-4a8b-9d41-1a5d0b3c9e11" ||
+		got[0]["time"] != "2020-07-01T18:00:00Z" {
+		t.Errorf("unexpected entry %v", got[0])
+	}
+	if _, ok := got[0]["meeting_id"]; ok {
+		t.Errorf("expected no meeting id for entry %v", got[0])
+	}
+	details, ok := got[1]["details"].(map[string]interface{})
+	if !ok || details["voter"] != "bob" || got[1]["poll_id"] != "9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d" {
+		t.Errorf("unexpected entry %v", got[1])
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/google/uuid"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// openBoltTestHandler opens a bolt handler in a new temporary directory, the returned function closes the handler
+// and removes the directory.
+func openBoltTestHandler(t *testing.T) (*pollsdata.BoltDataHandler, string, func()) {
+	dir, dirErr := ioutil.TempDir("", "pollsweb-bolt")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	path := filepath.Join(dir, "pollsweb.db")
+	handler, openErr := pollsdata.OpenBoltDataHandler(path, time.Second)
+	if openErr != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatal(openErr)
+	}
+	handler.SetClock(pollsweb.NewFakeClock(testMeetingTime))
+	return handler, path, func() {
+		_ = handler.Close(context.Background())
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func boltTestPeriod(name, slug string, start, end time.Time) *pollsdata.PeriodSettingsModel {
+	return pollsdata.NewPeriodSettingsModel(pollsweb.NewFakeClock(testMeetingTime), name, slug,
+		pollsdata.NewMeetingTimeTemplateModel(time.Monday, 18, 0), nil, start, end)
+}
+
+func expectDuplicateEntry(t *testing.T, err error, field string) {
+	t.Helper()
+	var duplicateErr pollsdata.DuplicateEntryError
+	if !errors.As(err, &duplicateErr) {
+		t.Errorf("expected a DuplicateEntryError for field \"%s\", got %v", field, err)
+		return
+	}
+	if duplicateErr.Field != field {
+		t.Errorf("expected a DuplicateEntryError for field \"%s\", got \"%s\"", field, duplicateErr.Field)
+	}
+}
+
+func expectNotFound(t *testing.T, err error) {
+	t.Helper()
+	var notFound pollsdata.EntryNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("expected an EntryNotFoundError, got %v", err)
+	}
+}
+
+func TestBoltPeriods(t *testing.T) {
+	handler, _, closeHandler := openBoltTestHandler(t)
+	defer closeHandler()
+	ctx := context.Background()
+	hour := time.Hour
+	current := boltTestPeriod("Period 2020", "period-2020", testMeetingTime.Add(-hour), testMeetingTime.Add(hour))
+	if _, err := handler.InsertPeriod(ctx, current); err != nil {
+		t.Fatal(err)
+	}
+	past := boltTestPeriod("Period 2019", "period-2019", testMeetingTime.Add(-3*hour), testMeetingTime.Add(-2*hour))
+	if _, err := handler.InsertPeriod(ctx, past); err != nil {
+		t.Fatal(err)
+	}
+	_, nameErr := handler.InsertPeriod(ctx,
+		boltTestPeriod("Period 2020", "other-slug", testMeetingTime, testMeetingTime.Add(hour)))
+	expectDuplicateEntry(t, nameErr, "name")
+	_, slugErr := handler.InsertPeriod(ctx,
+		boltTestPeriod("Other Period", "period-2020", testMeetingTime, testMeetingTime.Add(hour)))
+	expectDuplicateEntry(t, slugErr, "slug")
+
+	slug := "period-2020"
+	period, getErr := handler.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetSlug(&slug))
+	if getErr != nil {
+		t.Fatal(getErr)
+	}
+	if period.Id != current.Id || !period.Start.Equal(current.Start) || period.MeetingDateTemplate.Hour != 18 {
+		t.Errorf("expected %v, got %v", current, period)
+	}
+	otherName := "Period 2019"
+	_, mismatchErr := handler.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetSlug(&slug).SetName(&otherName))
+	expectNotFound(t, mismatchErr)
+	if _, err := handler.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs()); err != pollsdata.ErrInvalidPeriodSettingsQuery {
+		t.Errorf("expected ErrInvalidPeriodSettingsQuery, got %v", err)
+	}
+
+	active, activeErr := handler.GetActivePeriods(ctx, testMeetingTime)
+	if activeErr != nil {
+		t.Fatal(activeErr)
+	}
+	if len(active) != 1 || active[0].Id != current.Id {
+		t.Errorf("expected only the current period to be active, got %v", active)
+	}
+	latest, latestErr := handler.GetLatestPeriods(ctx, 0, time.Time{})
+	if latestErr != nil {
+		t.Fatal(latestErr)
+	}
+	if len(latest) != 2 || latest[0].Id != current.Id || latest[1].Id != past.Id {
+		t.Errorf("expected the periods sorted by end, got %v", latest)
+	}
+
+	byId := pollsdata.NewPeriodSettingsQueryArgs().SetId(&past.Id)
+	expectDuplicateEntry(t, handler.RenamePeriod(ctx, byId, "Period 2020", "period-renamed"), "name")
+	if err := handler.RenamePeriod(ctx, byId, "Period Renamed", "period-renamed"); err != nil {
+		t.Fatal(err)
+	}
+	// the old slug can be used again
+	if _, err := handler.InsertPeriod(ctx, boltTestPeriod("Period Reused", "period-2019", testMeetingTime, testMeetingTime.Add(hour))); err != nil {
+		t.Errorf("expected the old slug to be free after the rename, got %v", err)
+	}
+	renamed := "period-renamed"
+	if _, err := handler.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetSlug(&renamed)); err != nil {
+		t.Errorf("expected to find renamed period, got %v", err)
+	}
+
+	page, listErr := handler.ListPeriods(ctx, pollsdata.NewPeriodListQuery().SetName("renamed"))
+	if listErr != nil {
+		t.Fatal(listErr)
+	}
+	if len(page.Periods) != 1 || page.Periods[0].Id != past.Id {
+		t.Errorf("expected only the renamed period, got %v", page.Periods)
+	}
+}
+
+func TestBoltMeetings(t *testing.T) {
+	handler, _, closeHandler := openBoltTestHandler(t)
+	defer closeHandler()
+	ctx := context.Background()
+	period := boltTestPeriod("Period 2020", "period-2020", testMeetingTime.Add(-time.Hour), testMeetingTime.Add(time.Hour))
+	if _, err := handler.InsertPeriod(ctx, period); err != nil {
+		t.Fatal(err)
+	}
+	meeting := testMeeting(t)
+	// Carol votes after the motion is opened
+	motion := meeting.Groups[0].Polls[0].(*pollsdata.BasicPollModel)
+	motion.State = pollsdata.PollStateDraft
+	motion.Votes = motion.Votes[:2]
+	expectNotFound(t, handler.InsertMeeting(ctx, meeting))
+	meeting.PeriodId = period.Id
+	if err := handler.InsertMeeting(ctx, meeting); err != nil {
+		t.Fatal(err)
+	}
+	duplicate := testMeeting(t)
+	duplicate.PeriodId = period.Id
+	duplicate.Name = "Other Meeting"
+	expectDuplicateEntry(t, handler.InsertMeeting(ctx, duplicate), "slug")
+
+	slug := "meeting"
+	stored, getErr := handler.GetMeeting(ctx, pollsdata.NewMeetingQueryArgs().SetSlug(&slug))
+	if getErr != nil {
+		t.Fatal(getErr)
+	}
+	if !reflect.DeepEqual(stored.Groups[0].Polls, meeting.Groups[0].Polls) {
+		t.Errorf("expected the polls with votes to be stored, got %v", stored.Groups[0].Polls)
+	}
+
+	wrongToken := stored.UpdateToken + 1
+	voters := []*pollsdata.VoterModel{pollsdata.NewVoterModel("Carol Voter", "carol-voter", 1)}
+	voters[0].Id = uuid.New()
+	expectNotFound(t, handler.UpdateMeetingVoters(ctx,
+		pollsdata.NewMeetingQueryArgs().SetId(&stored.Id).SetUpdateToken(&wrongToken), voters))
+	if err := handler.UpdateMeetingVoters(ctx,
+		pollsdata.NewMeetingQueryArgs().SetId(&stored.Id).SetUpdateToken(&stored.UpdateToken), voters); err != nil {
+		t.Fatal(err)
+	}
+	motion = stored.Groups[0].Polls[0].(*pollsdata.BasicPollModel)
+	byId := pollsdata.NewMeetingQueryArgs().SetId(&stored.Id)
+	if err := handler.UpdatePollState(ctx, byId, motion.GetId(), pollsdata.PollStateOpen); err != nil {
+		t.Fatal(err)
+	}
+	voteModel := pollsdata.NewBasicPollVoteModel("Carol Voter", "carol-voter", gopolls.Abstention)
+	voteModel.SetId(uuid.New())
+	vote := pollsdata.NewPollVote(motion.GetId(), voteModel)
+	if err := handler.AddVotes(ctx, byId, []*pollsdata.PollVote{vote}); err != nil {
+		t.Fatal(err)
+	}
+	updated, updatedErr := handler.GetMeeting(ctx, byId)
+	if updatedErr != nil {
+		t.Fatal(updatedErr)
+	}
+	if updated.UpdateToken != stored.UpdateToken+3 {
+		t.Errorf("expected the update token to be incremented three times, got %d (was %d)",
+			updated.UpdateToken, stored.UpdateToken)
+	}
+	if len(updated.Voters) != 1 || updated.Voters[0].Name != "Carol Voter" {
+		t.Errorf("expected the voters to be replaced, got %v", updated.Voters)
+	}
+	if voterNames := pollsdata.PollVoterNames(updated.Groups[0].Polls[0]); !voterNames.Contains("Carol Voter") {
+		t.Errorf("expected the vote to be added, got voters %v", voterNames)
+	}
+
+	transition, transitionErr := handler.GetVotingTransitionMeetings(ctx, testMeetingTime)
+	if transitionErr != nil {
+		t.Fatal(transitionErr)
+	}
+	if len(transition) != 1 {
+		t.Errorf("expected the meeting that has not been opened to need a transition, got %v", transition)
+	}
+	page, listErr := handler.ListMeetings(ctx, pollsdata.NewMeetingListQuery().SetPeriodId(&period.Id))
+	if listErr != nil {
+		t.Fatal(listErr)
+	}
+	if len(page.Meetings) != 1 || page.Meetings[0].NumPolls != 5 || page.Meetings[0].NumVoters != 1 {
+		t.Errorf("expected a summary of the meeting, got %v", page.Meetings)
+	}
+
+	periodArgs := pollsdata.NewPeriodSettingsQueryArgs().SetId(&period.Id)
+	_, restrictErr := handler.DeletePeriod(ctx, periodArgs, pollsdata.PeriodDeleteRestrict)
+	var inUse pollsdata.PeriodInUseError
+	if !errors.As(restrictErr, &inUse) || inUse.NumMeetings != 1 {
+		t.Errorf("expected a PeriodInUseError, got %v", restrictErr)
+	}
+	num, cascadeErr := handler.DeletePeriod(ctx, periodArgs, pollsdata.PeriodDeleteCascade)
+	if cascadeErr != nil || num != 1 {
+		t.Fatalf("expected one deleted period, got %d (%v)", num, cascadeErr)
+	}
+	expectNotFound(t, func() error {
+		_, err := handler.GetMeeting(ctx, byId)
+		return err
+	}())
+	if num, err := handler.DeleteMeeting(ctx, byId); err != nil || num != 0 {
+		t.Errorf("expected no meeting to be deleted, got %d (%v)", num, err)
+	}
+	// the period is deleted, the name and slug of the deleted meeting are free again
+	reinserted := testMeeting(t)
+	reinserted.PeriodId = period.Id
+	expectNotFound(t, handler.InsertMeeting(ctx, reinserted))
+	if _, err := handler.InsertPeriod(ctx, period); err != nil {
+		t.Fatal(err)
+	}
+	reinserted.PeriodId = period.Id
+	if err := handler.InsertMeeting(ctx, reinserted); err != nil {
+		t.Errorf("expected the meeting to be inserted again, got %v", err)
+	}
+}
+
+func TestBoltPersistence(t *testing.T) {
+	handler, path, closeHandler := openBoltTestHandler(t)
+	defer closeHandler()
+	ctx := context.Background()
+	period := boltTestPeriod("Period 2020", "period-2020", testMeetingTime.Add(-time.Hour), testMeetingTime.Add(time.Hour))
+	if _, err := handler.InsertPeriod(ctx, period); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reopened, openErr := pollsdata.OpenBoltDataHandler(path, time.Second)
+	if openErr != nil {
+		t.Fatal(openErr)
+	}
+	defer reopened.Close(ctx)
+	name := "Period 2020"
+	if _, err := reopened.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetName(&name)); err != nil {
+		t.Errorf("expected the period to be stored in the file, got %v", err)
+	}
+}
+
+func TestBoltWebhooks(t *testing.T) {
+	handler, _, closeHandler := openBoltTestHandler(t)
+	defer closeHandler()
+	ctx := context.Background()
+	clock := pollsweb.NewFakeClock(testMeetingTime)
+	meetings := pollsdata.NewWebhookModel(clock, "https://example.com/meetings", "secret", []string{"meeting.created"})
+	if _, err := handler.InsertWebhook(ctx, meetings); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	inactive := pollsdata.NewWebhookModel(clock, "https://example.com/inactive", "secret", []string{"meeting.created"})
+	inactive.Active = false
+	if _, err := handler.InsertWebhook(ctx, inactive); err != nil {
+		t.Fatal(err)
+	}
+	all, allErr := handler.GetWebhooks(ctx, "")
+	if allErr != nil {
+		t.Fatal(allErr)
+	}
+	if len(all) != 2 || all[0].Id != meetings.Id {
+		t.Errorf("expected all webhooks sorted by creation, got %v", all)
+	}
+	registered, registeredErr := handler.GetWebhooks(ctx, "meeting.created")
+	if registeredErr != nil {
+		t.Fatal(registeredErr)
+	}
+	if len(registered) != 1 || registered[0].Id != meetings.Id {
+		t.Errorf("expected only the active webhook, got %v", registered)
+	}
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		delivery := pollsdata.NewWebhookDeliveryModel(clock, meetings.Id, uuid.New(), "meeting.created", attempt)
+		if _, err := handler.InsertWebhookDelivery(ctx, delivery); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(time.Second)
+	}
+	deliveries, deliveriesErr := handler.GetWebhookDeliveries(ctx, meetings.Id, 2)
+	if deliveriesErr != nil {
+		t.Fatal(deliveriesErr)
+	}
+	if len(deliveries) != 2 || deliveries[0].Attempt != 3 || deliveries[1].Attempt != 2 {
+		t.Errorf("expected the two latest deliveries, got %v", deliveries)
+	}
+	if num, err := handler.DeleteWebhook(ctx, meetings.Id); err != nil || num != 1 {
+		t.Fatalf("expected one deleted webhook, got %d (%v)", num, err)
+	}
+	_, getErr := handler.GetWebhook(ctx, meetings.Id)
+	expectNotFound(t, getErr)
+	deliveries, deliveriesErr = handler.GetWebhookDeliveries(ctx, meetings.Id, 0)
+	if deliveriesErr != nil || len(deliveries) != 0 {
+		t.Errorf("expected the deliveries to be deleted, got %v (%v)", deliveries, deliveriesErr)
+	}
+}
@@ -0,0 +1,358 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"context"
+	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// chainTestData returns a meeting with votes, an audit entry for the meeting and the chain linking all poll
+// definitions, votes and the audit entry.
+func chainTestData(t *testing.T) (*pollsdata.MeetingModel, []*pollsdata.AuditEntryModel, []*pollsdata.ChainEntryModel) {
+	meeting := testMeeting(t)
+	clock := pollsweb.NewFakeClock(testMeetingTime)
+	entry := pollsdata.NewAuditEntryModel(clock, "admin", "192.0.2.1", pollsdata.AuditResultsPublished).
+		SetMeetingId(meeting.Id).
+		SetDetail("poll", "motion")
+	entry.Id = uuid.New()
+	records := make([]*pollsdata.ChainRecord, 0)
+	for _, group := range meeting.Groups {
+		for _, poll := range group.Polls {
+			record, err := pollsdata.NewPollChainRecord(poll)
+			if err != nil {
+				t.Fatal(err)
+			}
+			records = append(records, record)
+		}
+	}
+	for _, group := range meeting.Groups {
+		for _, poll := range group.Polls {
+			for _, vote := range pollsdata.PollVotes(poll) {
+				record, err := pollsdata.NewVoteChainRecord(pollsdata.NewPollVote(poll.GetId(), vote))
+				if err != nil {
+					t.Fatal(err)
+				}
+				records = append(records, record)
+			}
+		}
+	}
+	auditRecord, auditErr := pollsdata.NewAuditChainRecord(entry)
+	if auditErr != nil {
+		t.Fatal(auditErr)
+	}
+	records = append(records, auditRecord)
+	chain := pollsdata.NewChainEntries(nil, meeting.Id, clock.Now(), records)
+	return meeting, []*pollsdata.AuditEntryModel{entry}, chain
+}
+
+// expectChainProblem checks that the report contains a problem matching the regular expression.
+func expectChainProblem(t *testing.T, report *pollsdata.ChainReport, pattern string) {
+	t.Helper()
+	if report.Valid() {
+		t.Errorf("expected problem %s, but the chain is valid", pattern)
+		return
+	}
+	expr := regexp.MustCompile(pattern)
+	for _, problem := range report.Problems {
+		if expr.MatchString(problem.String()) {
+			return
+		}
+	}
+	t.Errorf("expected problem %s, got %v", pattern, report.Problems)
+}
+
+func TestVerifyChain(t *testing.T) {
+	meeting, auditEntries, chain := chainTestData(t)
+	report := pollsdata.VerifyChain(chain, meeting, auditEntries)
+	if !report.Valid() {
+		t.Fatalf("expected a valid chain, got %v", report.Problems)
+	}
+	if report.NumEntries != 17 || report.NumPolls != 5 || report.NumVotes != 11 || report.NumAuditEntries != 1 ||
+		report.Head != chain[16].Hash {
+		t.Errorf("unexpected report %+v", report)
+	}
+	empty := pollsdata.VerifyChain(nil, pollsdata.EmptyMeetingModel(), nil)
+	if !empty.Valid() || empty.Head != pollsdata.ChainGenesisHash {
+		t.Errorf("expected an empty chain to be valid, got %+v", empty)
+	}
+
+	tests := []struct {
+		name       string
+		manipulate func(meeting *pollsdata.MeetingModel, auditEntries []*pollsdata.AuditEntryModel, chain []*pollsdata.ChainEntryModel) ([]*pollsdata.AuditEntryModel, []*pollsdata.ChainEntryModel)
+		problem    string
+	}{
+		{
+			"vote changed",
+			func(meeting *pollsdata.MeetingModel, auditEntries []*pollsdata.AuditEntryModel, chain []*pollsdata.ChainEntryModel) ([]*pollsdata.AuditEntryModel, []*pollsdata.ChainEntryModel) {
+				meeting.Groups[0].Polls[0].(*pollsdata.BasicPollModel).Votes[2].Answer = gopolls.Aye
+				return auditEntries, chain
+			},
+			`^entry 8: vote .* of Carol Voter in poll "Motion" was changed$`,
+		},
+		{
+			"poll definition changed",
+			func(meeting *pollsdata.MeetingModel, auditEntries []*pollsdata.AuditEntryModel, chain []*pollsdata.ChainEntryModel) ([]*pollsdata.AuditEntryModel, []*pollsdata.ChainEntryModel) {
+				meeting.Groups[0].Polls[0].GetPollModel().AbsoluteMajority = true
+				return auditEntries, chain
+			},
+			`^entry 1: definition of poll "Motion" .* was changed$`,
+		},
+		{
+			"poll opened without link",
+			func(meeting *pollsdata.MeetingModel, auditEntries []*pollsdata.AuditEntryModel, chain []*pollsdata.ChainEntryModel) ([]*pollsdata.AuditEntryModel, []*pollsdata.ChainEntryModel) {
+				// the entries of the definitions are removed, all other entries are chained again
+				records := make([]*pollsdata.ChainRecord, 0, len(chain)-5)
+				for _, entry := range chain[5:] {
+					records = append(records, &pollsdata.ChainRecord{Kind: entry.Kind, RecordId: entry.RecordId, PollId: entry.PollId, Digest: entry.Digest})
+				}
+				return auditEntries, pollsdata.NewChainEntries(nil, meeting.Id, chain[0].Time, records)
+			},
+			`^definition of poll "Budget" .* is not linked into the chain$`,
+		},
+		{
+			"ranking changed",
+			func(meeting *pollsdata.MeetingModel, auditEntries []*pollsdata.AuditEntryModel, chain []*pollsdata.ChainEntryModel) ([]*pollsdata.AuditEntryModel, []*pollsdata.ChainEntryModel) {
+				meeting.Groups[0].Polls[3].(*pollsdata.SchulzePollModel).Votes[0].Ranking[0] = 2
+				return auditEntries, chain
+			},
+			`^entry \d+: vote .* of Alice Voter in poll "Chair" was changed$`,
+		},
+		{
+			"vote deleted",
+			func(meeting *pollsdata.MeetingModel, auditEntries []*pollsdata.AuditEntryModel, chain []*pollsdata.ChainEntryModel) ([]*pollsdata.AuditEntryModel, []*pollsdata.ChainEntryModel) {
+				poll := meeting.Groups[0].Polls[2].(*pollsdata.MedianPollModel)
+				poll.Votes = poll.Votes[:2]
+				return auditEntries, chain
+			},
+			`^entry 13: vote .* was deleted$`,
+		},
+		{
+			"vote inserted",
+			func(meeting *pollsdata.MeetingModel, auditEntries []*pollsdata.AuditEntryModel, chain []*pollsdata.ChainEntryModel) ([]*pollsdata.AuditEntryModel, []*pollsdata.ChainEntryModel) {
+				poll := meeting.Groups[0].Polls[4].(*pollsdata.BasicPollModel)
+				vote := pollsdata.NewBasicPollVoteModel("Alice Voter", "alice-voter", gopolls.No)
+				vote.Id = uuid.New()
+				poll.Votes = append(poll.Votes, vote)
+				return auditEntries, chain
+			},
+			`^vote .* of Alice Voter in poll "Empty" is not linked into the chain$`,
+		},
+		{
+			"audit entry changed",
+			func(meeting *pollsdata.MeetingModel, auditEntries []*pollsdata.AuditEntryModel, chain []*pollsdata.ChainEntryModel) ([]*pollsdata.AuditEntryModel, []*pollsdata.ChainEntryModel) {
+				auditEntries[0].Actor = "someone else"
+				return auditEntries, chain
+			},
+			`^entry 17: audit entry .* \(results.published at .*\) was changed$`,
+		},
+		{
+			"audit entry deleted",
+			func(meeting *pollsdata.MeetingModel, auditEntries []*pollsdata.AuditEntryModel, chain []*pollsdata.ChainEntryModel) ([]*pollsdata.AuditEntryModel, []*pollsdata.ChainEntryModel) {
+				return nil, chain
+			},
+			`^entry 17: audit .* was deleted$`,
+		},
+		{
+			"entry changed",
+			func(meeting *pollsdata.MeetingModel, auditEntries []*pollsdata.AuditEntryModel, chain []*pollsdata.ChainEntryModel) ([]*pollsdata.AuditEntryModel, []*pollsdata.ChainEntryModel) {
+				chain[9].Time = chain[9].Time.Add(time.Hour)
+				return auditEntries, chain
+			},
+			`^entry 10: hash doesn't match`,
+		},
+		{
+			"entry rehashed",
+			func(meeting *pollsdata.MeetingModel, auditEntries []*pollsdata.AuditEntryModel, chain []*pollsdata.ChainEntryModel) ([]*pollsdata.AuditEntryModel, []*pollsdata.ChainEntryModel) {
+				// the vote and its entry are changed consistently, but the next entry still references the old hash
+				vote := meeting.Groups[0].Polls[1].(*pollsdata.BasicPollModel).Votes[0]
+				vote.Answer = gopolls.No
+				digest, err := pollsdata.VoteDigest(meeting.Groups[0].Polls[1].GetId(), vote)
+				if err != nil {
+					t.Fatal(err)
+				}
+				chain[8].Digest = digest
+				chain[8].Hash = chain[8].ComputeHash()
+				return auditEntries, chain
+			},
+			`^entry 10: previous hash`,
+		},
+		{
+			"entry removed",
+			func(meeting *pollsdata.MeetingModel, auditEntries []*pollsdata.AuditEntryModel, chain []*pollsdata.ChainEntryModel) ([]*pollsdata.AuditEntryModel, []*pollsdata.ChainEntryModel) {
+				return auditEntries, append(chain[:10], chain[11:]...)
+			},
+			`^entry 12: expected sequence number 11`,
+		},
+		{
+			"entry of another meeting",
+			func(meeting *pollsdata.MeetingModel, auditEntries []*pollsdata.AuditEntryModel, chain []*pollsdata.ChainEntryModel) ([]*pollsdata.AuditEntryModel, []*pollsdata.ChainEntryModel) {
+				chain[0].MeetingId = uuid.New()
+				chain[0].Hash = chain[0].ComputeHash()
+				return auditEntries, chain
+			},
+			`^entry 1: entry belongs to meeting`,
+		},
+	}
+	for _, tc := range tests {
+		meeting, auditEntries, chain := chainTestData(t)
+		auditEntries, chain = tc.manipulate(meeting, auditEntries, chain)
+		t.Run(tc.name, func(t *testing.T) {
+			expectChainProblem(t, pollsdata.VerifyChain(chain, meeting, auditEntries), tc.problem)
+		})
+	}
+}
+
+func TestBoltChainManipulation(t *testing.T) {
+	handler, _, closeHandler := openBoltTestHandler(t)
+	defer closeHandler()
+	ctx := context.Background()
+	period := boltTestPeriod("Period 2020", "period-2020", testMeetingTime.Add(-time.Hour), testMeetingTime.Add(time.Hour))
+	if _, err := handler.InsertPeriod(ctx, period); err != nil {
+		t.Fatal(err)
+	}
+	meeting := testMeeting(t)
+	meeting.PeriodId = period.Id
+	// votes stored with the meeting are not linked into the chain, remove them
+	for _, poll := range meeting.Groups[0].Polls {
+		poll.GetPollModel().State = pollsdata.PollStateDraft
+		switch typedPoll := poll.(type) {
+		case *pollsdata.BasicPollModel:
+			typedPoll.Votes = nil
+		case *pollsdata.MedianPollModel:
+			typedPoll.Votes = nil
+		case *pollsdata.SchulzePollModel:
+			typedPoll.Votes = nil
+		}
+	}
+	if err := handler.InsertMeeting(ctx, meeting); err != nil {
+		t.Fatal(err)
+	}
+	args := pollsdata.NewMeetingQueryArgs().SetId(&meeting.Id)
+	poll := meeting.Groups[0].Polls[0]
+	if err := handler.UpdatePollState(ctx, args, poll.GetId(), pollsdata.PollStateOpen); err != nil {
+		t.Fatal(err)
+	}
+	vote := pollsdata.NewBasicPollVoteModel("Carol Voter", "carol-voter", gopolls.No)
+	vote.Id = uuid.New()
+	if err := handler.AddVotes(ctx, args, []*pollsdata.PollVote{pollsdata.NewPollVote(poll.GetId(), vote)}); err != nil {
+		t.Fatal(err)
+	}
+	entry := pollsdata.NewAuditEntryModel(pollsweb.NewFakeClock(testMeetingTime), "admin", "", pollsdata.AuditVoteCast).
+		SetMeetingId(meeting.Id).
+		SetPollId(poll.GetId())
+	if _, err := handler.InsertAuditEntry(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	verify := func() *pollsdata.ChainReport {
+		stored, getErr := handler.GetMeeting(ctx, args)
+		if getErr != nil {
+			t.Fatal(getErr)
+		}
+		report, verifyErr := pollsdata.VerifyMeetingChain(ctx, handler, stored)
+		if verifyErr != nil {
+			t.Fatal(verifyErr)
+		}
+		return report
+	}
+	if report := verify(); !report.Valid() {
+		t.Fatalf("expected a valid chain, got %v", report.Problems)
+	}
+
+	// change the stored documents without the handler
+	stored, getErr := handler.GetMeeting(ctx, args)
+	if getErr != nil {
+		t.Fatal(getErr)
+	}
+	stored.GetPoll(poll.GetId()).(*pollsdata.BasicPollModel).Votes[0].Answer = gopolls.Aye
+	updateErr := handler.DB.Update(func(tx *bolt.Tx) error {
+		data, marshalErr := bson.Marshal(stored)
+		if marshalErr != nil {
+			return marshalErr
+		}
+		if putErr := tx.Bucket([]byte("meetings")).Put(meeting.Id[:], data); putErr != nil {
+			return putErr
+		}
+		return tx.Bucket([]byte("audit")).Delete(entry.Id[:])
+	})
+	if updateErr != nil {
+		t.Fatal(updateErr)
+	}
+	report := verify()
+	if len(report.Problems) != 2 {
+		t.Errorf("expected two problems, got %v", report.Problems)
+	}
+	expectChainProblem(t, report, `^entry 2: vote .* of Carol Voter in poll .* was changed$`)
+	expectChainProblem(t, report, `^entry 3: audit .* was deleted$`)
+}
+
+func TestChainPublishedHead(t *testing.T) {
+	meeting, auditEntries, chain := chainTestData(t)
+	// entries appended after the head has been published are fine
+	published := chain[10].Hash
+	report := pollsdata.VerifyChain(chain, meeting, auditEntries)
+	if sequence := report.CheckPublishedHead(published); sequence != 11 || !report.Valid() {
+		t.Errorf("expected the published head to be found at entry 11, got %d (%v)", sequence, report.Problems)
+	}
+	// a chain that was replaced as a whole is valid in itself, but doesn't contain the published head
+	records := make([]*pollsdata.ChainRecord, len(chain))
+	for i, entry := range chain {
+		records[i] = &pollsdata.ChainRecord{Kind: entry.Kind, RecordId: entry.RecordId, PollId: entry.PollId, Digest: entry.Digest}
+	}
+	replaced := pollsdata.NewChainEntries(nil, meeting.Id, chain[0].Time.Add(time.Hour), records)
+	report = pollsdata.VerifyChain(replaced, meeting, auditEntries)
+	if !report.Valid() {
+		t.Fatalf("expected the replaced chain to be valid in itself, got %v", report.Problems)
+	}
+	if sequence := report.CheckPublishedHead(published); sequence != 0 {
+		t.Errorf("expected the published head not to be found, got entry %d", sequence)
+	}
+	expectChainProblem(t, report, `^published head .* is not contained in the chain`)
+}
+
+func TestUnlinkedChainRecords(t *testing.T) {
+	meeting, auditEntries, chain := chainTestData(t)
+	records, err := pollsdata.UnlinkedChainRecords(nil, meeting, auditEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linked := pollsdata.NewChainEntries(nil, meeting.Id, chain[0].Time, records)
+	if len(linked) != len(chain) || linked[len(linked)-1].Hash != chain[len(chain)-1].Hash {
+		t.Errorf("expected all polls, votes and audit entries to be unlinked in the order of the chain, got %d records", len(records))
+	}
+	// only the records not in the chain are returned, appending them makes the chain valid
+	records, err = pollsdata.UnlinkedChainRecords(chain[:10], meeting, auditEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 7 {
+		t.Fatalf("expected 7 unlinked records, got %d", len(records))
+	}
+	completed := append(chain[:10:10], pollsdata.NewChainEntries(chain[9], meeting.Id, chain[0].Time, records)...)
+	if report := pollsdata.VerifyChain(completed, meeting, auditEntries); !report.Valid() {
+		t.Errorf("expected a valid chain after linking, got %v", report.Problems)
+	}
+	if records, err = pollsdata.UnlinkedChainRecords(chain, meeting, auditEntries); err != nil || len(records) != 0 {
+		t.Errorf("expected no unlinked records, got %d (%v)", len(records), err)
+	}
+}
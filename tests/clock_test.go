@@ -0,0 +1,168 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+var clockTestStart = time.Date(2020, 7, 1, 18, 0, 0, 0, time.UTC)
+
+func TestFakeClock(t *testing.T) {
+	clock := pollsweb.NewFakeClock(clockTestStart)
+	if now := clock.Now(); !now.Equal(clockTestStart) {
+		t.Errorf("expected time %v, got %v", clockTestStart, now)
+	}
+	ch := clock.After(time.Minute)
+	if waiters := clock.Waiters(); waiters != 1 {
+		t.Errorf("expected one waiter, got %d", waiters)
+	}
+	clock.Advance(30 * time.Second)
+	select {
+	case got := <-ch:
+		t.Errorf("channel must not fire before the deadline, got %v", got)
+	default:
+	}
+	clock.Advance(30 * time.Second)
+	select {
+	case got := <-ch:
+		if expected := clockTestStart.Add(time.Minute); !got.Equal(expected) {
+			t.Errorf("expected channel to receive %v, got %v", expected, got)
+		}
+	default:
+		t.Error("channel must fire once the deadline is reached")
+	}
+	if waiters := clock.Waiters(); waiters != 0 {
+		t.Errorf("expected no waiters, got %d", waiters)
+	}
+	select {
+	case <-clock.After(0):
+	default:
+		t.Error("channel with a non-positive duration must fire immediately")
+	}
+}
+
+func TestPeriodIsActive(t *testing.T) {
+	clock := pollsweb.NewFakeClock(clockTestStart)
+	period := pollsdata.NewPeriodSettingsModel(clock, "Summer", "summer", nil, nil,
+		clockTestStart.Add(24*time.Hour), clockTestStart.Add(48*time.Hour))
+	if !period.Created.Equal(clockTestStart) || !period.LastUpdated.Equal(clockTestStart) {
+		t.Errorf("expected period to be created at %v, got %v and %v", clockTestStart, period.Created,
+			period.LastUpdated)
+	}
+	if period.IsActive(clock.Now()) {
+		t.Error("period must not be active before the start")
+	}
+	clock.Advance(24 * time.Hour)
+	if !period.IsActive(clock.Now()) {
+		t.Error("period must be active at the start")
+	}
+	clock.Advance(24 * time.Hour)
+	if !period.IsActive(clock.Now()) {
+		t.Error("period must be active at the end")
+	}
+	clock.Advance(time.Second)
+	if period.IsActive(clock.Now()) {
+		t.Error("period must not be active after the end")
+	}
+}
+
+func TestLatestPeriods(t *testing.T) {
+	clock := pollsweb.NewFakeClock(clockTestStart)
+	day := 24 * time.Hour
+	newPeriod := func(slug string, start, end time.Duration) *pollsdata.PeriodSettingsModel {
+		return pollsdata.NewPeriodSettingsModel(clock, slug, slug, nil, nil,
+			clockTestStart.Add(start), clockTestStart.Add(end))
+	}
+	periods := []*pollsdata.PeriodSettingsModel{
+		newPeriod("past", -10*day, -5*day),
+		newPeriod("current", -1*day, 10*day),
+		newPeriod("long", -20*day, 10*day),
+		newPeriod("future", 5*day, 20*day),
+	}
+	slugs := func(periods []*pollsdata.PeriodSettingsModel) []string {
+		res := make([]string, len(periods))
+		for i, period := range periods {
+			res[i] = period.Slug
+		}
+		return res
+	}
+	tests := []struct {
+		limit    int64
+		now      time.Time
+		expected []string
+	}{
+		{-1, time.Time{}, []string{"future", "current", "long", "past"}},
+		{2, time.Time{}, []string{"future", "current"}},
+		{-1, clock.Now(), []string{"current", "long"}},
+		{1, clock.Now(), []string{"current"}},
+		{-1, clock.Now().Add(-7 * day), []string{"long", "past"}},
+		{-1, clock.Now().Add(30 * day), []string{}},
+	}
+	for _, tc := range tests {
+		got := slugs(pollsdata.LatestPeriods(periods, tc.limit, tc.now))
+		if len(got) != len(tc.expected) {
+			t.Errorf("expected periods %v for limit %d at %v, got %v", tc.expected, tc.limit, tc.now, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.expected[i] {
+				t.Errorf("expected periods %v for limit %d at %v, got %v", tc.expected, tc.limit, tc.now, got)
+				break
+			}
+		}
+	}
+	if periods[0].Slug != "past" {
+		t.Error("LatestPeriods must not modify the input")
+	}
+}
+
+func TestLatestPeriodsSkipsArchived(t *testing.T) {
+	clock := pollsweb.NewFakeClock(clockTestStart)
+	day := 24 * time.Hour
+	active := pollsdata.NewPeriodSettingsModel(clock, "active", "active", nil, nil,
+		clockTestStart.Add(-day), clockTestStart.Add(day))
+	archived := pollsdata.NewPeriodSettingsModel(clock, "archived", "archived", nil, nil,
+		clockTestStart.Add(-day), clockTestStart.Add(day))
+	archived.Archived = clockTestStart
+	got := pollsdata.LatestPeriods([]*pollsdata.PeriodSettingsModel{archived, active}, -1, clock.Now())
+	if len(got) != 1 || got[0].Slug != "active" {
+		t.Errorf("expected only the active period, got %v", got)
+	}
+}
+
+func TestMeetingIsOnlineVotingOpen(t *testing.T) {
+	clock := pollsweb.NewFakeClock(clockTestStart)
+	meeting := pollsdata.NewMeetingModel(clock, "Meeting", "meeting", uuid.New(), clockTestStart.Add(3*time.Hour),
+		clockTestStart.Add(time.Hour), clockTestStart.Add(2*time.Hour), nil, nil)
+	if !meeting.Created.Equal(clockTestStart) {
+		t.Errorf("expected meeting to be created at %v, got %v", clockTestStart, meeting.Created)
+	}
+	expected := []bool{false, true, false}
+	for i, open := range expected {
+		if got := meeting.IsOnlineVotingOpen(clock.Now()); got != open {
+			t.Errorf("expected voting open = %v after %d hours, got %v", open, i, got)
+		}
+		clock.Advance(time.Hour)
+	}
+	meeting.OnlineStart = time.Time{}
+	if meeting.IsOnlineVotingOpen(clockTestStart.Add(90 * time.Minute)) {
+		t.Error("voting must not be open for a meeting without online voting")
+	}
+}
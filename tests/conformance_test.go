@@ -0,0 +1,111 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/FabianWe/pollsweb/pollsdata/datahandlertest"
+	"github.com/google/uuid"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBoltConformance(t *testing.T) {
+	datahandlertest.Run(t, func(t *testing.T) pollsdata.DataHandler {
+		dir, dirErr := ioutil.TempDir("", "pollsweb-bolt")
+		if dirErr != nil {
+			t.Fatal(dirErr)
+		}
+		t.Cleanup(func() {
+			_ = os.RemoveAll(dir)
+		})
+		handler, openErr := pollsdata.OpenBoltDataHandler(filepath.Join(dir, "pollsweb.db"), time.Second)
+		if openErr != nil {
+			t.Fatal(openErr)
+		}
+		return handler
+	})
+}
+
+// mongoConformanceHandler drops the database of the handler when it is closed.
+type mongoConformanceHandler struct {
+	*pollsdata.MongoDataHandler
+}
+
+func (h mongoConformanceHandler) Close(ctx context.Context) error {
+	dropErr := h.Database.Drop(ctx)
+	closeErr := h.MongoDataHandler.Close(ctx)
+	if dropErr != nil {
+		return dropErr
+	}
+	return closeErr
+}
+
+// mongoTestConfig returns the config of the MongoDB server for tests, the test is skipped unless
+// POLLSWEB_TEST_MONGO_HOST is set (the port can be set with POLLSWEB_TEST_MONGO_PORT).
+func mongoTestConfig(t *testing.T) *pollsdata.MongoConfig {
+	host := os.Getenv("POLLSWEB_TEST_MONGO_HOST")
+	if host == "" {
+		t.Skip("POLLSWEB_TEST_MONGO_HOST not set")
+	}
+	config := pollsdata.NewMongoConfig()
+	config.Host = host
+	if portStr := os.Getenv("POLLSWEB_TEST_MONGO_PORT"); portStr != "" {
+		port, portErr := strconv.Atoi(portStr)
+		if portErr != nil {
+			t.Fatalf("invalid POLLSWEB_TEST_MONGO_PORT: %v", portErr)
+		}
+		config.Port = port
+	}
+	return config
+}
+
+// connectMongoTestDatabase connects to a new database, the returned handler drops the database when it is closed.
+func connectMongoTestDatabase(t *testing.T, config *pollsdata.MongoConfig) mongoConformanceHandler {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	testConfig := *config
+	testConfig.Database = fmt.Sprintf("pollsweb_test_%s", strings.ReplaceAll(uuid.New().String(), "-", ""))
+	handler, connectErr := pollsdata.ConnectMongo(ctx, &testConfig)
+	if connectErr != nil {
+		t.Fatal(connectErr)
+	}
+	return mongoConformanceHandler{handler}
+}
+
+// TestMongoConformance runs the conformance suite against a MongoDB server, it is skipped unless
+// POLLSWEB_TEST_MONGO_HOST is set (see mongoTestConfig).
+// Each test uses its own database which is dropped afterwards. The server must support transactions (for example a
+// single node replica set), otherwise the WriteImport test fails because the import is not atomic.
+func TestMongoConformance(t *testing.T) {
+	config := mongoTestConfig(t)
+	datahandlertest.Run(t, func(t *testing.T) pollsdata.DataHandler {
+		handler := connectMongoTestDatabase(t, config)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := handler.CreateIndexes(ctx); err != nil {
+			_ = handler.Close(ctx)
+			t.Fatal(err)
+		}
+		return handler
+	})
+}
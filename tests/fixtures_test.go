@@ -0,0 +1,77 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+// testMeetingTime is the time the test meeting is created, it is also used as the reference time (for example when
+// the results are evaluated).
+var testMeetingTime = time.Date(2020, 7, 1, 18, 0, 0, 0, time.UTC)
+
+// testMeeting returns a valid meeting with ids, the names satisfy the length constraints of the models.
+// It has three voters (Alice Voter, Bob Voter with weight 2 and Carol Voter) and one group with the polls Motion,
+// Statute (absolute 2/3 majority), Budget (median), Chair (Schulze) and Empty (no votes). All polls are published
+// roll calls, tests adjust the states and votes they need (see schedulerTestMeeting).
+func testMeeting(t *testing.T) *pollsdata.MeetingModel {
+	voters := []*pollsdata.VoterModel{
+		pollsdata.NewVoterModel("Alice Voter", "alice-voter", 1).SetEmail("alice@example.com"),
+		pollsdata.NewVoterModel("Bob Voter", "bob-voter", 2),
+		pollsdata.NewVoterModel("Carol Voter", "carol-voter", 1),
+	}
+	majority := pollsdata.NewMajorityModel(1, 2)
+	basic := pollsdata.NewBasicPollModel("Motion", "motion", majority, false,
+		[]*pollsdata.BasicPollVoteModel{
+			pollsdata.NewBasicPollVoteModel("Alice Voter", "alice-voter", gopolls.Aye),
+			pollsdata.NewBasicPollVoteModel("Bob Voter", "bob-voter", gopolls.Aye),
+			pollsdata.NewBasicPollVoteModel("Carol Voter", "carol-voter", gopolls.No),
+		})
+	absolute := pollsdata.NewBasicPollModel("Statute", "statute", pollsdata.NewMajorityModel(2, 3), true,
+		[]*pollsdata.BasicPollVoteModel{
+			pollsdata.NewBasicPollVoteModel("Bob Voter", "bob-voter", gopolls.Aye),
+			pollsdata.NewBasicPollVoteModel("Carol Voter", "carol-voter", gopolls.Abstention),
+		})
+	median := pollsdata.NewMedianPollModel("Budget", "budget", majority, false, 10000, "€",
+		[]*pollsdata.MedianPollVoteModel{
+			pollsdata.NewMedianPollVoteModel("Alice Voter", "alice-voter", 5000),
+			pollsdata.NewMedianPollVoteModel("Bob Voter", "bob-voter", 8000),
+			pollsdata.NewMedianPollVoteModel("Carol Voter", "carol-voter", 0),
+		})
+	schulze := pollsdata.NewSchulzePollModel("Chair", "chair", majority, false, []string{"A", "B", "C"},
+		[]*pollsdata.SchulzePollVoteModel{
+			pollsdata.NewSchulzePollVoteModel("Alice Voter", "alice-voter", gopolls.SchulzeRanking{0, 1, 2}),
+			pollsdata.NewSchulzePollVoteModel("Bob Voter", "bob-voter", gopolls.SchulzeRanking{0, 1, 2}),
+			pollsdata.NewSchulzePollVoteModel("Carol Voter", "carol-voter", gopolls.SchulzeRanking{2, 1, 0}),
+		})
+	empty := pollsdata.NewBasicPollModel("Empty", "empty", majority, false, nil)
+	group := pollsdata.NewPollGroupModel("Group", "group",
+		[]pollsdata.AbstractPollModel{basic, absolute, median, schulze, empty})
+	for _, poll := range group.Polls {
+		poll.GetPollModel().State = pollsdata.PollStatePublished
+		poll.GetPollModel().RollCall = true
+	}
+	meeting := pollsdata.NewMeetingModel(pollsweb.NewFakeClock(testMeetingTime), "Meeting", "meeting", uuid.New(),
+		testMeetingTime, testMeetingTime, testMeetingTime.Add(time.Hour), voters, []*pollsdata.PollGroupModel{group})
+	if err := meeting.GenIds(); err != nil {
+		t.Fatalf("can't generate ids: %v", err)
+	}
+	return meeting
+}
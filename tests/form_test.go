@@ -16,7 +16,10 @@ package tests
 
 import (
 	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
 	"github.com/FabianWe/pollsweb/server"
+	"github.com/google/uuid"
 	"testing"
 	"time"
 )
@@ -271,3 +274,84 @@ func TestDecodeVotersFormField(t *testing.T) {
 		}
 	}
 }
+
+func TestMeetingForm(t *testing.T) {
+	period := pollsdata.NewPeriodSettingsModel(pollsweb.NewFakeClock(testMeetingTime), "Period 2020", "period-2020",
+		pollsdata.NewMeetingTimeTemplateModel(time.Monday, 18, 0),
+		[]*pollsdata.VoterModel{pollsdata.NewVoterModel("Alice Voter", "alice-voter", 2).SetEmail("alice@example.com")},
+		testMeetingTime.Add(-time.Hour), testMeetingTime.Add(time.Hour))
+	period.Id = uuid.New()
+	tests := []struct {
+		onlineStart, onlineEnd string
+		expectsErr             bool
+	}{
+		{"", "", false},
+		{"2020/07/01 10:00", "2020/07/01 18:00", false},
+		{"2020/07/01 10:00", "", true},
+		{"2020/07/01 18:00", "2020/07/01 10:00", true},
+		{"2020/07/01 10:00", "tomorrow", true},
+	}
+	for _, tc := range tests {
+		form, formErr := server.DecodeMeetingForm(map[string][]string{
+			"meeting_name": {"Meeting One"},
+			"meeting_time": {"2020/07/01 18:00"},
+			"online_start": {tc.onlineStart},
+			"online_end":   {tc.onlineEnd},
+		})
+		if tc.expectsErr {
+			if formErr == nil {
+				t.Errorf("expected error for online voting \"%s\" - \"%s\"", tc.onlineStart, tc.onlineEnd)
+			}
+			continue
+		}
+		if formErr != nil {
+			t.Errorf("expected no error for online voting \"%s\" - \"%s\", got %v", tc.onlineStart, tc.onlineEnd, formErr)
+			continue
+		}
+		meeting, modelErr := form.ToModel(pollsweb.NewFakeClock(testMeetingTime), period)
+		if modelErr != nil {
+			t.Fatal(modelErr)
+		}
+		if meeting.Slug != "meeting-one" || meeting.PeriodId != period.Id || meeting.HasOnlineVoting() != (tc.onlineStart != "") {
+			t.Errorf("unexpected meeting %s", meeting)
+		}
+		if len(meeting.Voters) != 1 || meeting.Voters[0].Email != "alice@example.com" || meeting.Voters[0].Id == period.Voters[0].Id {
+			t.Errorf("expected the voters of the period to be copied, got %v", meeting.Voters)
+		}
+		if err := meeting.ValidateModel(); err != nil {
+			t.Errorf("expected a valid meeting, got %v", err)
+		}
+	}
+}
+
+func TestPeriodRenameForm(t *testing.T) {
+	tests := []struct {
+		name, slug   string
+		expectedSlug string
+		expectsErr   bool
+	}{
+		{"Period 2021", "", "period-2021", false},
+		{"Period 2021", "custom-slug", "custom-slug", false},
+		{"P21", "", "", true},
+	}
+	for _, tc := range tests {
+		form, formErr := server.DecodePeriodRenameForm(map[string][]string{
+			"period_name": {tc.name},
+			"period_slug": {tc.slug},
+		})
+		if tc.expectsErr {
+			if formErr == nil {
+				t.Errorf("expected error for name \"%s\"", tc.name)
+			}
+			continue
+		}
+		if formErr != nil {
+			t.Errorf("expected no error for name \"%s\", got %v", tc.name, formErr)
+			continue
+		}
+		if form.Slug != tc.expectedSlug {
+			t.Errorf("expected slug \"%s\" for name \"%s\" and slug \"%s\", got \"%s\"",
+				tc.expectedSlug, tc.name, tc.slug, form.Slug)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/FabianWe/pollsweb/server"
+	"github.com/google/uuid"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFoldICalLine(t *testing.T) {
+	tests := []string{
+		"SUMMARY:short",
+		"DESCRIPTION:" + strings.Repeat("a", 200),
+		"DESCRIPTION:" + strings.Repeat("ä", 100),
+	}
+	for _, tc := range tests {
+		folded := server.FoldICalLine(tc)
+		lines := strings.Split(folded, "\r\n")
+		for i, line := range lines {
+			if len(line) > 75 {
+				t.Errorf("folded line must not be longer than 75 octets, got %d octets", len(line))
+			}
+			if i > 0 && !strings.HasPrefix(line, " ") {
+				t.Errorf("continuation line must start with a space, got \"%s\"", line)
+			}
+		}
+		unfolded := strings.ReplaceAll(folded, "\r\n ", "")
+		if unfolded != tc {
+			t.Errorf("unfolding must return the original line, expected \"%s\" but got \"%s\"", tc, unfolded)
+		}
+	}
+}
+
+func TestEscapeICalText(t *testing.T) {
+	in := "Meeting; agenda, part 1\\2\nsecond line"
+	expected := `Meeting\; agenda\, part 1\\2\nsecond line`
+	if res := server.EscapeICalText(in); res != expected {
+		t.Errorf("expected \"%s\" but got \"%s\"", expected, res)
+	}
+}
+
+func TestMeetingICalEvents(t *testing.T) {
+	config := server.NewCalendarConfig()
+	meetingTime := time.Date(2020, 7, 9, 18, 0, 0, 0, time.UTC)
+	clock := pollsweb.NewFakeClock(meetingTime.Add(-48 * time.Hour))
+	meeting := pollsdata.NewMeetingModel(clock, "Meeting", "meeting", uuid.New(), meetingTime,
+		meetingTime.Add(-24*time.Hour), meetingTime, nil, nil)
+	meeting.Id = uuid.MustParse("2b3c2c8b-3b8a-4a7e-9f3c-62b4f0f3f7e1")
+	events := server.MeetingICalEvents(meeting, "Period", config)
+	if len(events) != 2 {
+		t.Fatalf("expected two events (meeting and voting window), got %d", len(events))
+	}
+	if events[0].UID == events[1].UID {
+		t.Errorf("events must have different UIDs, got \"%s\" twice", events[0].UID)
+	}
+	// UIDs must be stable
+	again := server.MeetingICalEvents(meeting, "Period", config)
+	for i := range events {
+		if events[i].UID != again[i].UID {
+			t.Errorf("UIDs must not change, got \"%s\" and \"%s\"", events[i].UID, again[i].UID)
+		}
+	}
+	var buf strings.Builder
+	cal := server.NewICalendar(clock, "Meeting", config.RefreshInterval)
+	cal.Events = events
+	if _, writeErr := cal.WriteTo(&buf); writeErr != nil {
+		t.Fatalf("writing calendar must not fail, got %v", writeErr)
+	}
+	if !strings.Contains(buf.String(), "DTSTART:20200709T180000Z\r\n") {
+		t.Errorf("expected meeting start in calendar, got\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "VTIMEZONE") {
+		t.Errorf("expected no time zone for events in UTC, got\n%s", buf.String())
+	}
+}
+
+func TestPeriodTemplateICalEvent(t *testing.T) {
+	config := server.NewCalendarConfig()
+	loc, locErr := time.LoadLocation("Europe/Berlin")
+	if locErr != nil {
+		t.Skipf("time zone data not available: %v", locErr)
+	}
+	template := pollsdata.NewMeetingTimeTemplateModel(time.Thursday, 19, 30)
+	// July 1st 2020 is a Wednesday
+	period := pollsdata.NewPeriodSettingsModel(pollsweb.NewSystemClock(), "Summer", "summer", template, nil,
+		time.Date(2020, 7, 1, 0, 0, 0, 0, loc), time.Date(2020, 9, 30, 0, 0, 0, 0, loc))
+	event := server.PeriodTemplateICalEvent(period, loc, config)
+	if event == nil {
+		t.Fatal("expected an event for the period")
+	}
+	expectedStart := time.Date(2020, 7, 2, 19, 30, 0, 0, loc)
+	if !event.Start.Equal(expectedStart) {
+		t.Errorf("expected first occurrence at %s, got %s", expectedStart, event.Start)
+	}
+	if !strings.HasPrefix(event.RecurrenceRule, "FREQ=WEEKLY;UNTIL=") {
+		t.Errorf("expected weekly recurrence until end of period, got \"%s\"", event.RecurrenceRule)
+	}
+	// the meeting on Thursday replaces the occurrence of the template, the one on Wednesday doesn't
+	clock := pollsweb.NewFakeClock(period.Start)
+	meetings := []*pollsdata.MeetingModel{
+		pollsdata.NewMeetingModel(clock, "Thursday", "thursday", period.Id, time.Date(2020, 7, 9, 19, 0, 0, 0, loc),
+			time.Time{}, time.Time{}, nil, nil),
+		pollsdata.NewMeetingModel(clock, "Wednesday", "wednesday", period.Id, time.Date(2020, 7, 15, 19, 30, 0, 0, loc),
+			time.Time{}, time.Time{}, nil, nil),
+	}
+	event.ExceptionDates = server.TemplateExceptionDates(event, meetings)
+	if len(event.ExceptionDates) != 1 || !event.ExceptionDates[0].Equal(time.Date(2020, 7, 9, 19, 30, 0, 0, loc)) {
+		t.Errorf("expected the occurrence on July 9th to be excluded, got %v", event.ExceptionDates)
+	}
+	var buf strings.Builder
+	cal := server.NewICalendar(clock, "Summer", config.RefreshInterval)
+	cal.Events = append(cal.Events, event)
+	if _, writeErr := cal.WriteTo(&buf); writeErr != nil {
+		t.Fatalf("writing calendar must not fail, got %v", writeErr)
+	}
+	// every TZID must be defined in a VTIMEZONE
+	for _, expected := range []string{
+		"EXDATE;TZID=Europe/Berlin:20200709T193000\r\n",
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Berlin\r\n",
+		"BEGIN:DAYLIGHT\r\nDTSTART:20190331T020000\r\nRRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU\r\n" +
+			"TZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\nTZNAME:CEST\r\nEND:DAYLIGHT\r\n",
+		"BEGIN:STANDARD\r\nDTSTART:20191027T030000\r\nRRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU\r\n" +
+			"TZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\nTZNAME:CET\r\nEND:STANDARD\r\n",
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in calendar, got\n%s", expected, buf.String())
+		}
+	}
+	// a period without an occurrence
+	period.End = time.Date(2020, 7, 2, 12, 0, 0, 0, loc)
+	if event := server.PeriodTemplateICalEvent(period, loc, config); event != nil {
+		t.Errorf("expected no event for a period without an occurrence, got %v", event)
+	}
+}
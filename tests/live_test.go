@@ -0,0 +1,96 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bytes"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/FabianWe/pollsweb/server"
+	"strings"
+	"testing"
+)
+
+func TestComputeTurnout(t *testing.T) {
+	turnout := server.ComputeTurnout(testMeeting(t))
+	if len(turnout) != 5 {
+		t.Fatalf("expected 5 polls, got %d", len(turnout))
+	}
+	// Statute: Bob (2) and Carol (1) voted
+	statute := turnout[1]
+	if statute.Name != "Statute" || statute.Group != "Group" {
+		t.Errorf("expected poll Statute in Group, got %s in %s", statute.Name, statute.Group)
+	}
+	if statute.NumVoted != 2 || statute.NumVoters != 3 {
+		t.Errorf("expected 2 of 3 voters, got %d of %d", statute.NumVoted, statute.NumVoters)
+	}
+	if statute.WeightVoted != 3 || statute.WeightTotal != 4 {
+		t.Errorf("expected weight 3 of 4, got %d of %d", statute.WeightVoted, statute.WeightTotal)
+	}
+	if statute.Result != "" {
+		t.Errorf("expected no result in turnout, got %s", statute.Result)
+	}
+}
+
+func TestComputeLiveResults(t *testing.T) {
+	status, err := server.ComputeLiveResults(testMeeting(t))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := []string{"accepted", "rejected", "50.00 €", "A > B > C", "no votes"}
+	for i, result := range expected {
+		if status[i].Result != result {
+			t.Errorf("expected result %s for poll %s, got %s", result, status[i].Name, status[i].Result)
+		}
+	}
+}
+
+func TestInitialLiveEvent(t *testing.T) {
+	meeting := testMeeting(t)
+	for _, poll := range meeting.Groups[0].Polls {
+		poll.GetPollModel().State = pollsdata.PollStateClosed
+	}
+	event, status, err := server.InitialLiveEvent(meeting)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if event != server.LiveTurnoutEvent || len(status) != 5 || status[0].Result != "" {
+		t.Errorf("expected turnout before the results are published, got %s", event)
+	}
+	meeting.Groups[0].Polls[0].GetPollModel().State = pollsdata.PollStatePublished
+	event, status, err = server.InitialLiveEvent(meeting)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if event != server.LiveResultsEvent {
+		t.Fatalf("expected results once a result is published, got %s", event)
+	}
+	if status[0].Result != "accepted" || status[1].Result != "pending" {
+		t.Errorf("expected only the published result, got %s and %s", status[0].Result, status[1].Result)
+	}
+}
+
+func TestWriteServerSentEvent(t *testing.T) {
+	var buf bytes.Buffer
+	if err := server.WriteServerSentEvent(&buf, server.LiveTurnoutEvent, map[string]int{"a": 1}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := "event: turnout\ndata: {\"a\":1}\n\n"
+	if got := buf.String(); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if strings.Count(buf.String(), "\n") != 3 {
+		t.Errorf("expected data in a single line, got %q", buf.String())
+	}
+}
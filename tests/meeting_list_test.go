@@ -0,0 +1,183 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"errors"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+func meetingListTestMeetings(t *testing.T) []*pollsdata.MeetingModel {
+	clock := pollsweb.NewFakeClock(clockTestStart)
+	day := 24 * time.Hour
+	periodA, periodB := uuid.New(), uuid.New()
+	newMeeting := func(name string, periodId uuid.UUID, offset time.Duration, online bool) *pollsdata.MeetingModel {
+		meetingTime := clockTestStart.Add(offset)
+		var onlineStart, onlineEnd time.Time
+		if online {
+			onlineStart, onlineEnd = meetingTime.Add(-2*day), meetingTime
+		}
+		voters := []*pollsdata.VoterModel{pollsdata.NewVoterModel("Alice", "alice", 1)}
+		groups := []*pollsdata.PollGroupModel{
+			pollsdata.NewPollGroupModel("Group", "group", []pollsdata.AbstractPollModel{
+				pollsdata.NewBasicPollModel("Motion A", "motion-a", pollsdata.NewMajorityModel(1, 2), false, nil),
+				pollsdata.NewBasicPollModel("Motion B", "motion-b", pollsdata.NewMajorityModel(1, 2), false, nil),
+			}),
+		}
+		meeting := pollsdata.NewMeetingModel(clock, name, name, periodId, meetingTime, onlineStart, onlineEnd, voters, groups)
+		if err := meeting.GenIds(); err != nil {
+			t.Fatal(err)
+		}
+		return meeting
+	}
+	july := newMeeting("july", periodB, 3*day, false)
+	// same meeting time as july, fixed ids to get a deterministic order
+	julyExtra := newMeeting("july-extra", periodB, 3*day, false)
+	july.Id = uuid.MustParse("00000000-0000-4000-8000-000000000001")
+	julyExtra.Id = uuid.MustParse("00000000-0000-4000-8000-000000000002")
+	return []*pollsdata.MeetingModel{
+		newMeeting("march", periodA, -3*day, false),
+		newMeeting("april", periodA, -day, true),
+		newMeeting("may", periodA, day, true),
+		newMeeting("june", periodB, 2*day, false),
+		july,
+		julyExtra,
+	}
+}
+
+func meetingSummarySlugs(page *pollsdata.MeetingListPage) []string {
+	res := make([]string, len(page.Meetings))
+	for i, meeting := range page.Meetings {
+		res[i] = meeting.Slug
+	}
+	return res
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestListMeetingSummariesFilters(t *testing.T) {
+	meetings := meetingListTestMeetings(t)
+	periodB := meetings[3].PeriodId
+	tests := []struct {
+		name     string
+		query    *pollsdata.MeetingListQuery
+		expected []string
+	}{
+		{"all", pollsdata.NewMeetingListQuery(), []string{"march", "april", "may", "june", "july", "july-extra"}},
+		{"upcoming", pollsdata.NewUpcomingMeetingsQuery(clockTestStart), []string{"may", "june", "july", "july-extra"}},
+		{"past", pollsdata.NewPastMeetingsQuery(clockTestStart), []string{"april", "march"}},
+		{"period", pollsdata.NewMeetingListQuery().SetPeriodId(&periodB), []string{"june", "july", "july-extra"}},
+		{"open for voting", pollsdata.NewMeetingListQuery().SetOpenForVoting(clockTestStart), []string{"may"}},
+		{"name prefix", pollsdata.NewMeetingListQuery().SetNamePrefix("JU"), []string{"june", "july", "july-extra"}},
+		{"by name", pollsdata.NewMeetingListQuery().SetSort(pollsdata.MeetingSortName, false),
+			[]string{"april", "july", "july-extra", "june", "march", "may"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := pollsdata.ListMeetingSummaries(meetings, tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := meetingSummarySlugs(page)
+			if !equalStrings(got, tc.expected) {
+				t.Errorf("expected meetings %v, got %v", tc.expected, got)
+			}
+			if page.HasNext() {
+				t.Error("expected only one page")
+			}
+		})
+	}
+}
+
+func TestListMeetingSummariesSummary(t *testing.T) {
+	meetings := meetingListTestMeetings(t)
+	page, err := pollsdata.ListMeetingSummaries(meetings, pollsdata.NewMeetingListQuery().SetLimit(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := page.Meetings[0]
+	if summary.Id != meetings[0].Id || summary.NumVoters != 1 || summary.NumPolls != 2 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
+
+func TestListMeetingSummariesPagination(t *testing.T) {
+	meetings := meetingListTestMeetings(t)
+	for _, descending := range []bool{false, true} {
+		all, allErr := pollsdata.ListMeetingSummaries(meetings, pollsdata.NewMeetingListQuery().
+			SetSort(pollsdata.MeetingSortMeetingTime, descending))
+		if allErr != nil {
+			t.Fatal(allErr)
+		}
+		expected := meetingSummarySlugs(all)
+		// some limits put the page boundary between july and july-extra which have the same meeting time
+		for limit := 1; limit <= len(meetings); limit++ {
+			query := pollsdata.NewMeetingListQuery().SetSort(pollsdata.MeetingSortMeetingTime, descending).
+				SetLimit(int64(limit))
+			got := make([]string, 0, len(meetings))
+			numPages := 0
+			for {
+				page, err := pollsdata.ListMeetingSummaries(meetings, query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				numPages++
+				got = append(got, meetingSummarySlugs(page)...)
+				if !page.HasNext() {
+					break
+				}
+				query.SetCursor(page.NextCursor)
+			}
+			if expectedPages := (len(meetings) + limit - 1) / limit; numPages != expectedPages {
+				t.Errorf("expected %d pages for limit %d, got %d", expectedPages, limit, numPages)
+			}
+			if !equalStrings(got, expected) {
+				t.Errorf("expected meetings %v for limit %d, got %v (descending = %v)", expected, limit, got, descending)
+			}
+		}
+	}
+}
+
+func TestListMeetingSummariesInvalidCursor(t *testing.T) {
+	meetings := meetingListTestMeetings(t)
+	page, err := pollsdata.ListMeetingSummaries(meetings, pollsdata.NewMeetingListQuery().SetLimit(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var invalidQuery pollsdata.InvalidQueryArgsError
+	_, err = pollsdata.ListMeetingSummaries(meetings, pollsdata.NewMeetingListQuery().
+		SetSort(pollsdata.MeetingSortName, false).SetCursor(page.NextCursor))
+	if !errors.As(err, &invalidQuery) {
+		t.Errorf("expected an InvalidQueryArgsError for a cursor with another sort order, got %v", err)
+	}
+	_, err = pollsdata.ListMeetingSummaries(meetings, pollsdata.NewMeetingListQuery().SetCursor("not a cursor"))
+	if !errors.As(err, &invalidQuery) {
+		t.Errorf("expected an InvalidQueryArgsError for an invalid cursor, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"context"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+	"time"
+)
+
+func TestDefaultMongoMigrations(t *testing.T) {
+	lastVersion := 0
+	for _, migration := range pollsdata.DefaultMongoMigrations {
+		if migration.Version <= lastVersion {
+			t.Errorf("migration versions must be increasing, got %d after %d", migration.Version, lastVersion)
+		}
+		if migration.Description == "" || migration.Apply == nil {
+			t.Errorf("migration %d must have a description and an apply function", migration.Version)
+		}
+		lastVersion = migration.Version
+	}
+}
+
+// legacyMeetingDocument returns a meeting as stored before the migrations: the period is referenced by its slug and
+// the polls don't have a state. The first poll has a vote if voted is true.
+func legacyMeetingDocument(slug, periodSlug string, meetingTime time.Time, voted bool) bson.D {
+	votes := bson.A{}
+	if voted {
+		votes = append(votes, bson.D{{"_id", uuid.New()}, {"votername", "Alice"}, {"voterslug", "alice"}, {"answer", 0}})
+	}
+	polls := bson.A{
+		bson.D{{"_id", uuid.New()}, {"type", pollsdata.BasicPollStringName}, {"name", "Motion"}, {"slug", "motion"},
+			{"votes", votes}},
+		bson.D{{"_id", uuid.New()}, {"type", pollsdata.BasicPollStringName}, {"name", "Other Motion"},
+			{"slug", "other-motion"}, {"votes", bson.A{}}},
+	}
+	return bson.D{
+		{"_id", uuid.New()},
+		{"name", slug},
+		{"slug", slug},
+		{"period", periodSlug},
+		{"meetingtime", meetingTime},
+		{"groups", bson.A{bson.D{{"_id", uuid.New()}, {"name", "Group"}, {"slug", "group"}, {"polls", polls}}}},
+	}
+}
+
+func TestMongoMigrations(t *testing.T) {
+	handler := connectMongoTestDatabase(t, mongoTestConfig(t))
+	ctx := context.Background()
+	defer handler.Close(ctx)
+	now := time.Date(2020, 7, 1, 18, 0, 0, 0, time.UTC)
+	handler.SetClock(pollsweb.NewFakeClock(now))
+
+	period := pollsdata.NewPeriodSettingsModel(pollsweb.NewFakeClock(now), "Period One", "period-one",
+		pollsdata.NewMeetingTimeTemplateModel(time.Monday, 18, 0), nil, now.Add(-24*time.Hour), now.Add(24*time.Hour))
+	if _, err := handler.InsertPeriod(ctx, period); err != nil {
+		t.Fatal(err)
+	}
+	meetings := handler.Database.Collection("meetings")
+	documents := []interface{}{
+		legacyMeetingDocument("past", "period-one", now.Add(-time.Hour), false),
+		legacyMeetingDocument("future", "period-one", now.Add(time.Hour), true),
+		// the period of this meeting has been deleted
+		legacyMeetingDocument("orphan", "deleted-period", now.Add(-time.Hour), false),
+	}
+	if _, err := meetings.InsertMany(ctx, documents); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handler.Migrator().Migrate(ctx); err != nil {
+		t.Fatalf("expected no error migrating, got %v", err)
+	}
+
+	getMeeting := func(slug string) *pollsdata.MeetingModel {
+		meeting, err := handler.GetMeeting(ctx, pollsdata.NewMeetingQueryArgs().SetSlug(&slug))
+		if err != nil {
+			t.Fatalf("can't get meeting %s: %v", slug, err)
+		}
+		return meeting
+	}
+	expectStates := func(meeting *pollsdata.MeetingModel, states ...string) {
+		for i, poll := range meeting.Groups[0].Polls {
+			if state := poll.GetPollModel().State; state != states[i] {
+				t.Errorf("expected state %s for poll %d of meeting %s, got %s", states[i], i, meeting.Slug, state)
+			}
+		}
+	}
+	past := getMeeting("past")
+	if past.PeriodId != period.Id {
+		t.Errorf("expected period %s, got %s", period.Id, past.PeriodId)
+	}
+	expectStates(past, pollsdata.PollStatePublished, pollsdata.PollStatePublished)
+	expectStates(getMeeting("future"), pollsdata.PollStatePublished, pollsdata.PollStateDraft)
+
+	orphan := getMeeting("orphan")
+	restored, restoredErr := handler.GetPeriod(ctx, pollsdata.NewPeriodSettingsQueryArgs().SetId(&orphan.PeriodId))
+	if restoredErr != nil {
+		t.Fatalf("expected a placeholder for the deleted period, got %v", restoredErr)
+	}
+	if restored.Slug != "deleted-period" || restored.Name != pollsdata.RestoredPeriodName("deleted-period") ||
+		!restored.IsArchived() {
+		t.Errorf("unexpected placeholder period %s", restored)
+	}
+}
+
+func TestMongoInitMarksMigrations(t *testing.T) {
+	handler := connectMongoTestDatabase(t, mongoTestConfig(t))
+	ctx := context.Background()
+	defer handler.Close(ctx)
+	if _, err := handler.CreateCollections(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if empty, err := handler.IsEmpty(ctx); err != nil || !empty {
+		t.Fatalf("expected a new database to be empty, got empty=%v, err=%v", empty, err)
+	}
+	if _, err := handler.Migrator().MarkApplied(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := handler.PendingMigrations(ctx); err != nil || pending != 0 {
+		t.Errorf("expected no pending migrations, got %d (err=%v)", pending, err)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bytes"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/FabianWe/pollsweb/server"
+	"strings"
+	"testing"
+)
+
+func minutesTestData(t *testing.T) *server.MinutesData {
+	meeting := testMeeting(t)
+	meeting.Name = "Meeting #1 & more"
+	meeting.Voters = append(meeting.Voters, pollsdata.NewVoterModel("Dave", "dave", 3))
+	results, err := server.EvaluateMeeting(meeting, false, testMeetingTime)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	results.ChainHead = pollsdata.ChainGenesisHash
+	return server.NewMinutesData(meeting, results)
+}
+
+func TestNewMinutesData(t *testing.T) {
+	data := minutesTestData(t)
+	if len(data.Attending) != 3 || data.AttendingWeight != 4 {
+		t.Errorf("expected 3 attending voters with weight 4, got %d and %d", len(data.Attending), data.AttendingWeight)
+	}
+	if len(data.Absent) != 1 || data.Absent[0].Name != "Dave" {
+		t.Errorf("expected Dave to be absent, got %v", data.Absent)
+	}
+	if data.TotalWeight != 7 {
+		t.Errorf("expected total weight 7, got %d", data.TotalWeight)
+	}
+}
+
+func TestMinutesGenerator(t *testing.T) {
+	generator, err := server.LoadMinutesGenerator("../templates", server.NewMinutesConfig(),
+		server.NewLocalizationConfig())
+	if err != nil {
+		t.Fatalf("can't load minutes templates: %v", err)
+	}
+	if generator.HasFormat("docx") {
+		t.Error("expected format docx to be unknown")
+	}
+	tests := []struct {
+		format   string
+		expected []string
+	}{
+		{"md", []string{"# Minutes: Meeting \\#1 & more", "* Alice Voter (weight 1)", "Absent: Dave",
+			"## Group", "### Motion", "**Result: accepted**", "**Result: A > B > C**",
+			"chain head `" + pollsdata.ChainGenesisHash + "`"}},
+		{"tex", []string{"\\title{Minutes: Meeting \\#1 \\& more}", "\\item Alice Voter (weight 1)", "Absent: Dave.",
+			"\\section{Group}", "\\subsection{Motion}", "\\textbf{Result: accepted}", "\\end{document}",
+			"chain head \\texttt{" + pollsdata.ChainGenesisHash + "}"}},
+	}
+	data := minutesTestData(t)
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		if err := generator.Generate(&buf, tc.format, data); err != nil {
+			t.Errorf("can't generate %s minutes: %v", tc.format, err)
+			continue
+		}
+		got := buf.String()
+		for _, expected := range tc.expected {
+			if !strings.Contains(got, expected) {
+				t.Errorf("expected %q in %s minutes, got\n%s", expected, tc.format, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetMongoURIEscapes(t *testing.T) {
+	tests := []struct {
+		username, password string
+	}{
+		{"", ""},
+		{"alice", "secret"},
+		{"al@ice", "p@ss:w/rd?#%+ 1"},
+	}
+	for _, test := range tests {
+		uri := pollsdata.GetMongoURI(test.username, test.password, "db.example.com", 27018)
+		clientOptions := options.Client().ApplyURI(uri)
+		if err := clientOptions.Validate(); err != nil {
+			t.Errorf("invalid uri %s: %v", uri, err)
+			continue
+		}
+		if len(clientOptions.Hosts) != 1 || clientOptions.Hosts[0] != "db.example.com:27018" {
+			t.Errorf("expected host db.example.com:27018, got %v", clientOptions.Hosts)
+		}
+		if test.username == "" {
+			if clientOptions.Auth != nil {
+				t.Errorf("expected no credentials in %s", uri)
+			}
+			continue
+		}
+		if clientOptions.Auth == nil || clientOptions.Auth.Username != test.username || clientOptions.Auth.Password != test.password {
+			t.Errorf("credentials not preserved in %s: %+v", uri, clientOptions.Auth)
+		}
+	}
+}
+
+func TestMongoConfigCredentials(t *testing.T) {
+	dir, dirErr := ioutil.TempDir("", "pollsweb-mongo")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	defer os.RemoveAll(dir)
+	passwordFile := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(passwordFile, []byte("from:file@\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	const envName = "POLLSWEB_TEST_MONGO_USER"
+	if err := os.Setenv(envName, "env-user"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv(envName)
+
+	config := pollsdata.NewMongoConfig()
+	config.UserName = "ignored"
+	config.UserNameEnv = envName
+	config.Password = "ignored"
+	config.PasswordFile = passwordFile
+	config.AuthSource = "pollsweb"
+	clientOptions, err := config.ClientOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := clientOptions.Auth
+	if auth == nil || auth.Username != "env-user" || auth.Password != "from:file@" || auth.AuthSource != "pollsweb" {
+		t.Errorf("unexpected credentials %+v", auth)
+	}
+
+	config.UserNameEnv = "POLLSWEB_TEST_MONGO_NOT_SET"
+	if _, err := config.ClientOptions(); err == nil {
+		t.Error("expected an error for a missing environment variable")
+	}
+	config.UserNameEnv = ""
+	config.PasswordFile = filepath.Join(dir, "missing")
+	if _, err := config.ClientOptions(); err == nil {
+		t.Error("expected an error for a missing password file")
+	}
+
+	// credentials from the URI are kept, the auth source is added
+	uriConfig := pollsdata.NewMongoConfig()
+	uriConfig.URI = "mongodb://bob:pw@one.example.com,two.example.com/?replicaSet=rs0"
+	uriConfig.AuthSource = "admin"
+	clientOptions, err = uriConfig.ClientOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth := clientOptions.Auth; auth == nil || auth.Username != "bob" || auth.Password != "pw" || auth.AuthSource != "admin" {
+		t.Errorf("unexpected credentials %+v", auth)
+	}
+	if len(clientOptions.Hosts) != 2 || clientOptions.ReplicaSet == nil || *clientOptions.ReplicaSet != "rs0" {
+		t.Errorf("options from the uri not applied: %v, %v", clientOptions.Hosts, clientOptions.ReplicaSet)
+	}
+
+	noUser := pollsdata.NewMongoConfig()
+	noUser.AuthSource = "admin"
+	if _, err := noUser.ClientOptions(); err == nil {
+		t.Error("expected an error for an auth source without a user name")
+	}
+}
+
+func TestMongoConfigOptions(t *testing.T) {
+	config := pollsdata.NewMongoConfig()
+	config.ReplicaSet = "rs1"
+	config.MaxPoolSize = 42
+	config.ReadPreference = "secondaryPreferred"
+	config.WriteConcern = "majority"
+	config.WriteConcernJournal = true
+	config.WriteConcernTimeout = 5 * time.Second
+	config.TLS = true
+	clientOptions, err := config.ClientOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clientOptions.ReplicaSet == nil || *clientOptions.ReplicaSet != "rs1" {
+		t.Errorf("expected replica set rs1, got %v", clientOptions.ReplicaSet)
+	}
+	if clientOptions.MaxPoolSize == nil || *clientOptions.MaxPoolSize != 42 {
+		t.Errorf("expected max pool size 42, got %v", clientOptions.MaxPoolSize)
+	}
+	if clientOptions.ReadPreference == nil || clientOptions.ReadPreference.Mode() != readpref.SecondaryPreferredMode {
+		t.Errorf("expected read preference secondaryPreferred, got %v", clientOptions.ReadPreference)
+	}
+	writeConcern := clientOptions.WriteConcern
+	if writeConcern == nil || writeConcern.GetW() != "majority" || !writeConcern.GetJ() || writeConcern.GetWTimeout() != 5*time.Second {
+		t.Errorf("unexpected write concern %v", writeConcern)
+	}
+	if clientOptions.TLSConfig == nil {
+		t.Error("expected TLS to be enabled")
+	}
+
+	config = pollsdata.NewMongoConfig()
+	config.WriteConcern = "2"
+	clientOptions, err = config.ClientOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clientOptions.WriteConcern == nil || clientOptions.WriteConcern.GetW() != 2 {
+		t.Errorf("expected write concern w=2, got %v", clientOptions.WriteConcern)
+	}
+	if clientOptions.TLSConfig != nil || clientOptions.ReadPreference != nil || clientOptions.Auth != nil {
+		t.Error("expected only the write concern to be set")
+	}
+
+	invalid := []func(config *pollsdata.MongoConfig){
+		func(config *pollsdata.MongoConfig) { config.ReadPreference = "anywhere" },
+		func(config *pollsdata.MongoConfig) { config.TLSCertFile = "client.pem" },
+		func(config *pollsdata.MongoConfig) { config.TLSCAFile = "/does/not/exist.pem" },
+		func(config *pollsdata.MongoConfig) { config.URI = "http://localhost" },
+	}
+	for i, modify := range invalid {
+		config := pollsdata.NewMongoConfig()
+		modify(config)
+		if _, err := config.ClientOptions(); err == nil {
+			t.Errorf("expected an error for invalid config %d", i)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/FabianWe/pollsweb/server"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordingMailer struct {
+	mails []*server.Mail
+}
+
+func (m *recordingMailer) Send(ctx context.Context, mail *server.Mail) error {
+	m.mails = append(m.mails, mail)
+	return nil
+}
+
+func TestNotifyVotingReminder(t *testing.T) {
+	config := server.NewAppConfig()
+	config.Mail.From = "polls@example.com"
+	appContext := server.NewAppContext(config, zap.NewNop().Sugar(), nil, "../templates")
+	templates, templatesErr := server.LoadMailTemplates(appContext.Templates.RootPath, config.Localization)
+	if templatesErr != nil {
+		t.Fatalf("can't load mail templates: %v", templatesErr)
+	}
+	mailer := &recordingMailer{}
+	notifier := server.NewNotifier(appContext, mailer, templates)
+
+	voters := []*pollsdata.VoterModel{
+		pollsdata.NewVoterModel("Alice Voter", "alice-voter", 1).SetEmail("alice@example.com"),
+		pollsdata.NewVoterModel("Bob Voter", "bob-voter", 1).SetEmail("bob@example.com"),
+		pollsdata.NewVoterModel("Carol Voter", "carol-voter", 1),
+	}
+	poll := pollsdata.NewBasicPollModel("First Poll", "first-poll", pollsdata.NewMajorityModel(1, 2), false,
+		[]*pollsdata.BasicPollVoteModel{
+			pollsdata.NewBasicPollVoteModel("Alice Voter", "alice-voter", gopolls.Aye),
+		})
+	poll.State = pollsdata.PollStateOpen
+	// nobody can vote in a closed poll, it must not be counted
+	closed := pollsdata.NewBasicPollModel("Closed Poll", "closed-poll", pollsdata.NewMajorityModel(1, 2), false, nil)
+	closed.State = pollsdata.PollStateClosed
+	group := pollsdata.NewPollGroupModel("Group", "group", []pollsdata.AbstractPollModel{poll, closed})
+	clock := pollsweb.NewFakeClock(time.Date(2020, 7, 1, 18, 0, 0, 0, time.UTC))
+	now := clock.Now()
+	meeting := pollsdata.NewMeetingModel(clock, "Meeting", "meeting", uuid.New(), now, now.Add(-time.Hour),
+		now.Add(time.Hour), voters, []*pollsdata.PollGroupModel{group})
+
+	missing := meeting.VotersWithMissingVotes()
+	if len(missing) != 2 {
+		t.Fatalf("expected two voters with missing votes, got %v", missing)
+	}
+
+	sent, notifyErr := notifier.NotifyVotingReminder(context.Background(), meeting)
+	if notifyErr != nil {
+		t.Fatalf("expected no error sending reminders, got %v", notifyErr)
+	}
+	// Carol has no email, Alice has already voted
+	if sent != 1 || len(mailer.mails) != 1 {
+		t.Fatalf("expected exactly one reminder, got %d", len(mailer.mails))
+	}
+	mail := mailer.mails[0]
+	if len(mail.To) != 1 || mail.To[0] != "bob@example.com" {
+		t.Errorf("expected reminder to be sent to bob@example.com, got %v", mail.To)
+	}
+	if !strings.Contains(mail.Subject, "Meeting") {
+		t.Errorf("expected meeting name in subject, got \"%s\"", mail.Subject)
+	}
+	if !strings.Contains(mail.Body, "Bob Voter") {
+		t.Errorf("expected voter name in body, got \"%s\"", mail.Body)
+	}
+}
+
+func TestNilNotifier(t *testing.T) {
+	var notifier *server.Notifier
+	meeting := pollsdata.EmptyMeetingModel()
+	if sent, err := notifier.NotifyMeetingCreated(context.Background(), meeting); sent != 0 || err != nil {
+		t.Errorf("nil notifier must not send anything, got sent=%d, err=%v", sent, err)
+	}
+}
+
+// notificationTestHandler returns copies of its meetings (as read from a database) and stores the notifications
+// sent.
+type notificationTestHandler struct {
+	pollsdata.DataHandler
+	meetings []*pollsdata.MeetingModel
+	sent     map[uuid.UUID]map[string]time.Time
+}
+
+func (h *notificationTestHandler) GetOnlineVotingMeetings(ctx context.Context, referenceTime time.Time) ([]*pollsdata.MeetingModel, error) {
+	res := make([]*pollsdata.MeetingModel, len(h.meetings))
+	for i, meeting := range h.meetings {
+		meetingCopy := *meeting
+		meetingCopy.NotificationsSent = make(map[string]time.Time)
+		for notification, sent := range h.sent[meeting.Id] {
+			meetingCopy.NotificationsSent[notification] = sent
+		}
+		res[i] = &meetingCopy
+	}
+	return res, nil
+}
+
+func (h *notificationTestHandler) SetMeetingNotificationSent(ctx context.Context, meetingId uuid.UUID, notification string, sent time.Time) error {
+	if h.sent[meetingId] == nil {
+		h.sent[meetingId] = make(map[string]time.Time)
+	}
+	h.sent[meetingId][notification] = sent
+	return nil
+}
+
+// failingMailer fails for all mails to the address failFor.
+type failingMailer struct {
+	recordingMailer
+	failFor string
+}
+
+func (m *failingMailer) Send(ctx context.Context, mail *server.Mail) error {
+	if mail.To[0] == m.failFor {
+		return errors.New("mailbox unavailable")
+	}
+	return m.recordingMailer.Send(ctx, mail)
+}
+
+func TestNotificationSchedulerCheck(t *testing.T) {
+	clock := pollsweb.NewFakeClock(time.Date(2020, 7, 1, 18, 0, 0, 0, time.UTC))
+	now := clock.Now()
+	newMeeting := func(name, email string) *pollsdata.MeetingModel {
+		voters := []*pollsdata.VoterModel{pollsdata.NewVoterModel("Alice Voter", "alice-voter", 1).SetEmail(email)}
+		meeting := pollsdata.NewMeetingModel(clock, name, strings.ToLower(name), uuid.New(), now,
+			now.Add(-time.Hour), now.Add(24*time.Hour), voters, nil)
+		meeting.Id = uuid.New()
+		return meeting
+	}
+	failing := newMeeting("Failing", "failing@example.com")
+	working := newMeeting("Working", "working@example.com")
+	handler := &notificationTestHandler{
+		meetings: []*pollsdata.MeetingModel{failing, working},
+		sent:     make(map[uuid.UUID]map[string]time.Time),
+	}
+
+	config := server.NewAppConfig()
+	config.Mail.From = "polls@example.com"
+	appContext := server.NewAppContext(config, zap.NewNop().Sugar(), handler, "../templates")
+	appContext.Clock = clock
+	templates, templatesErr := server.LoadMailTemplates(appContext.Templates.RootPath, config.Localization)
+	if templatesErr != nil {
+		t.Fatalf("can't load mail templates: %v", templatesErr)
+	}
+	mailer := &failingMailer{failFor: "failing@example.com"}
+	scheduler := server.NewNotificationScheduler(server.NewNotifier(appContext, mailer, templates))
+
+	// the error for the first meeting must not stop the notification for the second one
+	if err := scheduler.Check(context.Background(), now); err == nil {
+		t.Error("expected the error of the failing meeting to be returned")
+	}
+	if len(mailer.mails) != 1 || mailer.mails[0].To[0] != "working@example.com" {
+		t.Fatalf("expected one mail for the working meeting, got %v", mailer.mails)
+	}
+	if _, sent := handler.sent[working.Id][server.VotingOpenedNotification]; !sent {
+		t.Error("expected the notification to be stored as sent")
+	}
+	if _, sent := handler.sent[failing.Id][server.VotingOpenedNotification]; sent {
+		t.Error("notification stored as sent although sending failed")
+	}
+
+	// the stored markers survive a new scheduler (a restart), the failed notification is sent again
+	mailer.failFor = ""
+	mailer.mails = nil
+	scheduler = server.NewNotificationScheduler(server.NewNotifier(appContext, mailer, templates))
+	if err := scheduler.Check(context.Background(), now); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(mailer.mails) != 1 || mailer.mails[0].To[0] != "failing@example.com" {
+		t.Errorf("expected only the failed notification to be sent again, got %v", mailer.mails)
+	}
+}
+
+func TestNotificationPartialFailure(t *testing.T) {
+	clock := pollsweb.NewFakeClock(time.Date(2020, 7, 1, 18, 0, 0, 0, time.UTC))
+	now := clock.Now()
+	voters := []*pollsdata.VoterModel{
+		pollsdata.NewVoterModel("Alice Voter", "alice-voter", 1).SetEmail("alice@example.com"),
+		pollsdata.NewVoterModel("Bob Voter", "bob-voter", 1).SetEmail("bob@example.com"),
+	}
+	meeting := pollsdata.NewMeetingModel(clock, "Meeting", "meeting", uuid.New(), now,
+		now.Add(-time.Hour), now.Add(24*time.Hour), voters, nil)
+	meeting.Id = uuid.New()
+	handler := &notificationTestHandler{
+		meetings: []*pollsdata.MeetingModel{meeting},
+		sent:     make(map[uuid.UUID]map[string]time.Time),
+	}
+
+	config := server.NewAppConfig()
+	config.Mail.From = "polls@example.com"
+	appContext := server.NewAppContext(config, zap.NewNop().Sugar(), handler, "../templates")
+	appContext.Clock = clock
+	templates, templatesErr := server.LoadMailTemplates(appContext.Templates.RootPath, config.Localization)
+	if templatesErr != nil {
+		t.Fatalf("can't load mail templates: %v", templatesErr)
+	}
+	mailer := &failingMailer{failFor: "bob@example.com"}
+	scheduler := server.NewNotificationScheduler(server.NewNotifier(appContext, mailer, templates))
+
+	if err := scheduler.Check(context.Background(), now); err == nil {
+		t.Error("expected the error for bob@example.com to be returned")
+	}
+	if _, sent := handler.sent[meeting.Id][server.VotingOpenedNotification]; !sent {
+		t.Error("expected the notification to be stored as sent after a partial success")
+	}
+	// the next check must not send the notification to all voters again
+	mailer.mails = nil
+	if err := scheduler.Check(context.Background(), now); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(mailer.mails) != 0 {
+		t.Errorf("expected no mails on the next check, got %v", mailer.mails)
+	}
+}
+
+func TestFileMailerClock(t *testing.T) {
+	dir, dirErr := ioutil.TempDir("", "pollsweb-mails")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Date(2020, 7, 9, 18, 0, 0, 0, time.UTC)
+	mailer := server.NewFileMailer(pollsweb.NewFakeClock(now), dir)
+	mail := server.NewMail("polls@example.com", []string{"alice@example.com"}, "Subject", "Body")
+	if err := mailer.Send(context.Background(), mail); err != nil {
+		t.Fatal(err)
+	}
+	files, readErr := ioutil.ReadDir(dir)
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	if len(files) != 1 || !strings.HasPrefix(files[0].Name(), "20200709T180000") {
+		t.Fatalf("expected one file named by the time of the clock, got %v", files)
+	}
+	content, contentErr := ioutil.ReadFile(filepath.Join(dir, files[0].Name()))
+	if contentErr != nil {
+		t.Fatal(contentErr)
+	}
+	if expected := "Date: " + now.Format(time.RFC1123Z) + "\r\n"; !strings.Contains(string(content), expected) {
+		t.Errorf("expected %q in the mail, got\n%s", expected, content)
+	}
+}
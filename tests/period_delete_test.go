@@ -0,0 +1,56 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/google/uuid"
+	"testing"
+)
+
+func TestParsePeriodDeleteMode(t *testing.T) {
+	modes := []pollsdata.PeriodDeleteMode{
+		pollsdata.PeriodDeleteRestrict,
+		pollsdata.PeriodDeleteCascade,
+		pollsdata.PeriodDeleteArchive,
+	}
+	for _, mode := range modes {
+		parsed, err := pollsdata.ParsePeriodDeleteMode(mode.String())
+		if err != nil {
+			t.Errorf("can't parse mode %s: %v", mode, err)
+			continue
+		}
+		if parsed != mode {
+			t.Errorf("expected mode %s, got %s", mode, parsed)
+		}
+	}
+	if _, err := pollsdata.ParsePeriodDeleteMode("delete"); err == nil {
+		t.Error("expected an error for an invalid delete mode")
+	}
+}
+
+func TestPeriodInUseError(t *testing.T) {
+	periodId := uuid.New()
+	err := fmt.Errorf("can't delete period: %w", pollsdata.NewPeriodInUseError(periodId, 2))
+	var inUse pollsdata.PeriodInUseError
+	if !errors.As(err, &inUse) {
+		t.Fatal("expected a PeriodInUseError")
+	}
+	if inUse.PeriodId != periodId || inUse.NumMeetings != 2 {
+		t.Errorf("unexpected error values: %v", inUse)
+	}
+}
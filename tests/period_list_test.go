@@ -0,0 +1,151 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+// periodListTestPeriods returns 7 periods: "period-0" to "period-5" with decreasing end times, "period-2" and
+// "period-3" have the same start and end. "period-6" is archived.
+func periodListTestPeriods(t *testing.T) []*pollsdata.PeriodSettingsModel {
+	clock := pollsweb.NewFakeClock(clockTestStart)
+	day := 24 * time.Hour
+	offsets := []time.Duration{10 * day, 5 * day, 0, 0, -5 * day, -10 * day, 20 * day}
+	res := make([]*pollsdata.PeriodSettingsModel, len(offsets))
+	for i, offset := range offsets {
+		name := fmt.Sprintf("Period %d", i)
+		slug := fmt.Sprintf("period-%d", i)
+		period := pollsdata.NewPeriodSettingsModel(clock, name, slug, nil, nil,
+			clockTestStart.Add(offset-7*day), clockTestStart.Add(offset))
+		res[i] = period
+	}
+	// fixed ids to get a deterministic order for period-2 and period-3
+	for i, period := range res {
+		period.Id = uuid.MustParse(fmt.Sprintf("00000000-0000-4000-8000-%012d", len(res)-i))
+	}
+	res[6].Archived = clockTestStart
+	return res
+}
+
+func periodListSlugs(page *pollsdata.PeriodListPage) []string {
+	res := make([]string, len(page.Periods))
+	for i, period := range page.Periods {
+		res[i] = period.Slug
+	}
+	return res
+}
+
+func TestListPeriodModelsFilters(t *testing.T) {
+	periods := periodListTestPeriods(t)
+	tests := []struct {
+		name     string
+		query    *pollsdata.PeriodListQuery
+		expected []string
+	}{
+		{"all", pollsdata.NewPeriodListQuery(),
+			[]string{"period-0", "period-1", "period-2", "period-3", "period-4", "period-5"}},
+		{"archived", pollsdata.NewPeriodListQuery().SetIncludeArchived(true),
+			[]string{"period-6", "period-0", "period-1", "period-2", "period-3", "period-4", "period-5"}},
+		{"active", pollsdata.NewPeriodListQuery().SetActiveAt(clockTestStart),
+			[]string{"period-1", "period-2", "period-3"}},
+		{"name", pollsdata.NewPeriodListQuery().SetName("OD 4"), []string{"period-4"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := pollsdata.ListPeriodModels(periods, tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := periodListSlugs(page); !equalStrings(got, tc.expected) {
+				t.Errorf("expected periods %v, got %v", tc.expected, got)
+			}
+			if page.HasPrev() || page.HasNext() {
+				t.Error("expected only one page")
+			}
+		})
+	}
+}
+
+func TestListPeriodModelsPagination(t *testing.T) {
+	periods := periodListTestPeriods(t)
+	all, allErr := pollsdata.ListPeriodModels(periods, pollsdata.NewPeriodListQuery())
+	if allErr != nil {
+		t.Fatal(allErr)
+	}
+	expected := periodListSlugs(all)
+	for limit := 1; limit <= len(expected); limit++ {
+		// walk forward through all pages and remember them
+		query := pollsdata.NewPeriodListQuery().SetLimit(int64(limit))
+		var pages [][]string
+		var page *pollsdata.PeriodListPage
+		for {
+			var err error
+			page, err = pollsdata.ListPeriodModels(periods, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pages) == 0 && page.HasPrev() {
+				t.Errorf("first page must not have a previous page (limit %d)", limit)
+			}
+			pages = append(pages, periodListSlugs(page))
+			if !page.HasNext() {
+				break
+			}
+			query.SetCursor(page.NextCursor)
+		}
+		got := make([]string, 0, len(expected))
+		for _, slugs := range pages {
+			got = append(got, slugs...)
+		}
+		if !equalStrings(got, expected) {
+			t.Errorf("expected periods %v for limit %d, got %v", expected, limit, got)
+		}
+		// walk backward from the last page, we must get the same pages
+		for i := len(pages) - 2; i >= 0; i-- {
+			if !page.HasPrev() {
+				t.Fatalf("page %d must have a previous page (limit %d)", i+1, limit)
+			}
+			var err error
+			page, err = pollsdata.ListPeriodModels(periods, query.SetCursor(page.PrevCursor))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := periodListSlugs(page); !equalStrings(got, pages[i]) {
+				t.Errorf("expected previous page %v for limit %d, got %v", pages[i], limit, got)
+			}
+			if !page.HasNext() {
+				t.Errorf("page %d must have a next page (limit %d)", i, limit)
+			}
+		}
+		if page.HasPrev() {
+			t.Errorf("first page must not have a previous page (limit %d)", limit)
+		}
+	}
+}
+
+func TestListPeriodModelsInvalidCursor(t *testing.T) {
+	_, err := pollsdata.ListPeriodModels(periodListTestPeriods(t), pollsdata.NewPeriodListQuery().SetCursor("???"))
+	var invalidQuery pollsdata.InvalidQueryArgsError
+	if !errors.As(err, &invalidQuery) {
+		t.Errorf("expected an InvalidQueryArgsError, got %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"errors"
+	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/FabianWe/pollsweb/server"
+	"github.com/google/uuid"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPollTransition(t *testing.T) {
+	poll := pollsdata.NewBasicPollModel("Motion", "motion", pollsdata.NewMajorityModel(1, 2), false, nil)
+	if poll.GetState() != pollsdata.PollStateDraft {
+		t.Fatalf("expected new poll to be a draft, got %s", poll.GetState())
+	}
+	now := time.Date(2020, 7, 1, 18, 0, 0, 0, time.UTC)
+	// can't skip a state
+	err := poll.Transition(pollsdata.PollStateClosed, now)
+	var transitionErr pollsdata.PollStateTransitionError
+	if !errors.As(err, &transitionErr) {
+		t.Fatalf("expected PollStateTransitionError, got %v", err)
+	}
+	for i, state := range []string{pollsdata.PollStateOpen, pollsdata.PollStateClosed, pollsdata.PollStatePublished} {
+		if err := poll.Transition(state, now.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("expected transition to %s, got %v", state, err)
+		}
+	}
+	if !poll.Opened.Equal(now) || !poll.Closed.Equal(now.Add(time.Hour)) || !poll.Published.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("unexpected transition times %v, %v, %v", poll.Opened, poll.Closed, poll.Published)
+	}
+	if poll.NextState() != "" {
+		t.Errorf("expected no state after published, got %s", poll.NextState())
+	}
+	// no way back
+	if err := poll.Transition(pollsdata.PollStateOpen, now); err == nil {
+		t.Error("expected error when opening a published poll")
+	}
+}
+
+func TestPollStateLegacy(t *testing.T) {
+	poll := pollsdata.EmptyPollModel()
+	poll.State = ""
+	if poll.GetState() != pollsdata.PollStateDraft {
+		t.Errorf("expected poll without state to be a draft, got %s", poll.GetState())
+	}
+	if poll.ResultsVisible() {
+		t.Error("expected no results for draft")
+	}
+}
+
+func TestResultsVisible(t *testing.T) {
+	poll := pollsdata.EmptyPollModel()
+	now := time.Date(2020, 7, 1, 18, 0, 0, 0, time.UTC)
+	for _, state := range []string{pollsdata.PollStateOpen, pollsdata.PollStateClosed} {
+		if err := poll.Transition(state, now); err != nil {
+			t.Fatal(err)
+		}
+		if poll.ResultsVisible() {
+			t.Errorf("expected no results for %s poll", state)
+		}
+	}
+	if err := poll.Transition(pollsdata.PollStatePublished, now); err != nil {
+		t.Fatal(err)
+	}
+	if !poll.ResultsVisible() {
+		t.Error("expected results for published poll")
+	}
+}
+
+func TestCheckPollGroupsUpdate(t *testing.T) {
+	majority := pollsdata.NewMajorityModel(1, 2)
+	newGroups := func() []*pollsdata.PollGroupModel {
+		motion := pollsdata.NewBasicPollModel("Motion", "motion", majority, false, nil)
+		motion.Id = uuid.MustParse("b4b3e8a8-6cb0-4d33-a5a9-1d3d8b2a0c01")
+		motion.State = pollsdata.PollStateOpen
+		motion.Votes = []*pollsdata.BasicPollVoteModel{pollsdata.NewBasicPollVoteModel("Alice", "alice", gopolls.Aye)}
+		draft := pollsdata.NewBasicPollModel("Draft", "draft", majority, false, nil)
+		draft.Id = uuid.MustParse("b4b3e8a8-6cb0-4d33-a5a9-1d3d8b2a0c02")
+		return []*pollsdata.PollGroupModel{
+			pollsdata.NewPollGroupModel("Group", "group", []pollsdata.AbstractPollModel{motion, draft}),
+		}
+	}
+	current := newGroups()
+	var updateErr pollsdata.InvalidPollsUpdateError
+	tests := []struct {
+		name    string
+		change  func(groups []*pollsdata.PollGroupModel) []*pollsdata.PollGroupModel
+		invalid bool
+	}{
+		{"unchanged", func(groups []*pollsdata.PollGroupModel) []*pollsdata.PollGroupModel {
+			return groups
+		}, false},
+		{"remove draft", func(groups []*pollsdata.PollGroupModel) []*pollsdata.PollGroupModel {
+			groups[0].Polls = groups[0].Polls[:1]
+			return groups
+		}, false},
+		{"change draft", func(groups []*pollsdata.PollGroupModel) []*pollsdata.PollGroupModel {
+			groups[0].Polls[1].GetPollModel().AbsoluteMajority = true
+			return groups
+		}, false},
+		{"open draft", func(groups []*pollsdata.PollGroupModel) []*pollsdata.PollGroupModel {
+			groups[0].Polls[1].GetPollModel().State = pollsdata.PollStateOpen
+			return groups
+		}, true},
+		{"close poll", func(groups []*pollsdata.PollGroupModel) []*pollsdata.PollGroupModel {
+			groups[0].Polls[0].GetPollModel().State = pollsdata.PollStateClosed
+			return groups
+		}, true},
+		{"change vote", func(groups []*pollsdata.PollGroupModel) []*pollsdata.PollGroupModel {
+			groups[0].Polls[0].(*pollsdata.BasicPollModel).Votes[0].Answer = gopolls.No
+			return groups
+		}, true},
+		{"remove open poll", func(groups []*pollsdata.PollGroupModel) []*pollsdata.PollGroupModel {
+			groups[0].Polls = groups[0].Polls[1:]
+			return groups
+		}, true},
+	}
+	for _, tc := range tests {
+		err := pollsdata.CheckPollGroupsUpdate(current, tc.change(newGroups()))
+		switch {
+		case tc.invalid && !errors.As(err, &updateErr):
+			t.Errorf("%s: expected an InvalidPollsUpdateError, got %v", tc.name, err)
+		case !tc.invalid && err != nil:
+			t.Errorf("%s: expected no error, got %v", tc.name, err)
+		}
+	}
+}
+
+func TestAddPollVote(t *testing.T) {
+	poll := pollsdata.NewBasicPollModel("Motion", "motion", pollsdata.NewMajorityModel(1, 2), false, nil)
+	vote := pollsdata.NewBasicPollVoteModel("Alice", "alice", gopolls.Aye)
+	var voteErr pollsdata.InvalidVoteError
+	if err := pollsdata.AddPollVote(poll, vote); !errors.As(err, &voteErr) {
+		t.Errorf("expected InvalidVoteError for draft poll, got %v", err)
+	}
+	poll.State = pollsdata.PollStateOpen
+	if err := pollsdata.AddPollVote(poll, vote); err != nil {
+		t.Fatalf("expected vote to be added, got %v", err)
+	}
+	if err := pollsdata.AddPollVote(poll, pollsdata.NewBasicPollVoteModel("Alice", "alice", gopolls.No)); err == nil {
+		t.Error("expected error for second vote of Alice")
+	}
+	if err := pollsdata.AddPollVote(poll, pollsdata.NewMedianPollVoteModel("Bob", "bob", 100)); err == nil {
+		t.Error("expected error for median vote in basic poll")
+	}
+	if len(poll.Votes) != 1 {
+		t.Errorf("expected one vote, got %d", len(poll.Votes))
+	}
+	poll.State = pollsdata.PollStateClosed
+	if err := pollsdata.AddPollVote(poll, pollsdata.NewBasicPollVoteModel("Bob", "bob", gopolls.No)); err == nil {
+		t.Error("expected error for vote in closed poll")
+	}
+}
+
+func TestMeetingAddVotes(t *testing.T) {
+	meeting := votesImportTestMeeting(t)
+	motion := meeting.Groups[0].Polls[0]
+	votes := []*pollsdata.PollVote{
+		pollsdata.NewPollVote(motion.GetId(), pollsdata.NewBasicPollVoteModel("Alice", "alice", gopolls.Aye)),
+		pollsdata.NewPollVote(uuid.New(), pollsdata.NewBasicPollVoteModel("Bob", "bob", gopolls.Aye)),
+	}
+	if err := meeting.AddVotes(votes); err == nil {
+		t.Error("expected error for unknown poll")
+	}
+	if err := meeting.TransitionPoll(motion.GetId(), pollsdata.PollStateClosed, time.Now()); err != nil {
+		t.Errorf("expected poll to be closed, got %v", err)
+	}
+	if err := meeting.TransitionPoll(uuid.New(), pollsdata.PollStateClosed, time.Now()); err == nil {
+		t.Error("expected error for unknown poll")
+	}
+}
+
+func TestImportVotesCSVClosedPoll(t *testing.T) {
+	meeting := votesImportTestMeeting(t)
+	meeting.Groups[0].Polls[2].GetPollModel().State = pollsdata.PollStateClosed
+	input := "voter,Group / Motion,Group / Budget,Group / Chair\nAlice Voter,yes,50.00,\n"
+	result, err := server.ImportVotesCSV(strings.NewReader(input), meeting, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(result.CellErrors) != 1 || result.CellErrors[0].Poll != "Group / Budget" {
+		t.Errorf("expected one error for closed poll Budget, got %v", result.CellErrors)
+	}
+	if len(result.Votes) != 1 {
+		t.Errorf("expected one valid vote, got %d", len(result.Votes))
+	}
+}
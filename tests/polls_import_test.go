@@ -0,0 +1,159 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"errors"
+	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/FabianWe/pollsweb/server"
+	"testing"
+)
+
+const testSkeleton = `# Meeting
+
+## Finances
+
+### Budget
+- 123.45 €
+
+### Motion
+* Yes
+* No
+
+## Elections
+
+### Chair
+* Alice
+* Bob
+* Carol
+`
+
+func parseTestSkeleton(t *testing.T, s string) []*pollsdata.PollGroupModel {
+	collection, parseErr := gopolls.NewPollCollectionParser().ParseCollectionSkeletonsFromString(nil, s)
+	if parseErr != nil {
+		t.Fatalf("can't parse skeleton: %v", parseErr)
+	}
+	groups, convertErr := server.SkeletonCollectionToGroups(collection, pollsdata.NewMajorityModel(1, 2), false)
+	if convertErr != nil {
+		t.Fatalf("can't convert skeleton: %v", convertErr)
+	}
+	return groups
+}
+
+func TestSkeletonCollectionToGroups(t *testing.T) {
+	groups := parseTestSkeleton(t, testSkeleton)
+	if len(groups) != 2 || len(groups[0].Polls) != 2 || len(groups[1].Polls) != 1 {
+		t.Fatalf("unexpected groups: %v", groups)
+	}
+	if groups[0].Slug != "finances" {
+		t.Errorf("expected slug \"finances\", got \"%s\"", groups[0].Slug)
+	}
+	median, isMedian := groups[0].Polls[0].(*pollsdata.MedianPollModel)
+	if !isMedian {
+		t.Fatalf("expected a median poll, got %v", groups[0].Polls[0])
+	}
+	if median.Value != 12345 || median.Currency != "€" {
+		t.Errorf("expected value 12345 €, got %d %s", median.Value, median.Currency)
+	}
+	if _, isBasic := groups[0].Polls[1].(*pollsdata.BasicPollModel); !isBasic {
+		t.Errorf("expected a basic poll, got %v", groups[0].Polls[1])
+	}
+	schulze, isSchulze := groups[1].Polls[0].(*pollsdata.SchulzePollModel)
+	if !isSchulze {
+		t.Fatalf("expected a schulze poll, got %v", groups[1].Polls[0])
+	}
+	if len(schulze.Options) != 3 || schulze.Options[2] != "Carol" {
+		t.Errorf("unexpected options %v", schulze.Options)
+	}
+}
+
+func TestDiffPollGroups(t *testing.T) {
+	oldGroups := parseTestSkeleton(t, testSkeleton)
+	motion := oldGroups[0].Polls[1].(*pollsdata.BasicPollModel)
+	motion.Votes = append(motion.Votes, pollsdata.NewBasicPollVoteModel("Alice", "alice", gopolls.Aye))
+	newGroups := parseTestSkeleton(t, `# Meeting
+
+## Finances
+
+### Budget
+- 200.00 €
+
+### Motion
+* Yes
+* No
+
+### Another Motion
+* Yes
+* No
+`)
+	diff := server.DiffPollGroups(oldGroups, newGroups)
+	expected := []struct {
+		kind, poll string
+	}{
+		{server.PollDiffChanged, "Budget"},
+		{server.PollDiffUnchanged, "Motion"},
+		{server.PollDiffAdded, "Another Motion"},
+		{server.PollDiffRemoved, "Chair"},
+	}
+	if len(diff) != len(expected) {
+		t.Fatalf("expected %d diff entries, got %d", len(expected), len(diff))
+	}
+	for i, entry := range diff {
+		if entry.Kind != expected[i].kind || entry.Poll != expected[i].poll {
+			t.Errorf("expected %s %s, got %s %s", expected[i].kind, expected[i].poll, entry.Kind, entry.Poll)
+		}
+	}
+	if diff[1].NumVotes != 1 {
+		t.Errorf("expected one vote for the unchanged poll, got %d", diff[1].NumVotes)
+	}
+	merged := server.MergePollGroups(oldGroups, newGroups)
+	if merged[0].Polls[1] != motion {
+		t.Error("expected the unchanged poll to be kept with its votes")
+	}
+}
+
+func TestPreviewPollsImport(t *testing.T) {
+	parser := gopolls.NewPollCollectionParser()
+	current := parseTestSkeleton(t, testSkeleton)
+	collection, parseErr := parser.ParseCollectionSkeletonsFromString(nil, testSkeleton+`
+### Audit
+* Yes
+* No
+`)
+	if parseErr != nil {
+		t.Fatal(parseErr)
+	}
+	diff, groups, err := server.PreviewPollsImport(current, collection, true)
+	if err != nil {
+		t.Fatalf("expected a valid preview, got %v", err)
+	}
+	if len(diff) != 4 || len(groups) != 2 || len(groups[1].Polls) != 2 || !groups[1].Polls[1].GetPollModel().RollCall {
+		t.Errorf("unexpected preview %v, %v", diff, groups)
+	}
+	// a poll name that is too short is reported before the groups are stored
+	invalid, parseErr := parser.ParseCollectionSkeletonsFromString(nil, testSkeleton+`
+### Tax
+* Yes
+* No
+`)
+	if parseErr != nil {
+		t.Fatal(parseErr)
+	}
+	var validationErr *pollsdata.ModelValidationError
+	if _, _, err := server.PreviewPollsImport(current, invalid, false); !errors.As(err, &validationErr) {
+		t.Errorf("expected a validation error, got %v", err)
+	}
+}
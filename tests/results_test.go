@@ -0,0 +1,208 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/FabianWe/pollsweb/server"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateMeeting(t *testing.T) {
+	results, err := server.EvaluateMeeting(testMeeting(t), false, testMeetingTime)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if results.Version != server.ResultsFormatVersion {
+		t.Errorf("expected version %d, got %d", server.ResultsFormatVersion, results.Version)
+	}
+	if !results.Generated.Equal(testMeetingTime) {
+		t.Errorf("expected results to be generated at %v, got %v", testMeetingTime, results.Generated)
+	}
+	if results.Meeting.NumVoters != 3 || results.Meeting.WeightSum != 4 {
+		t.Errorf("expected 3 voters with weight 4, got %d and %d",
+			results.Meeting.NumVoters, results.Meeting.WeightSum)
+	}
+	polls := results.Groups[0].Polls
+	if len(polls) != 5 {
+		t.Fatalf("expected 5 polls, got %d", len(polls))
+	}
+
+	basic := polls[0]
+	if basic.Outcome != server.PollOutcomeAccepted {
+		t.Errorf("expected motion to be accepted, got %s", basic.Outcome)
+	}
+	if basic.Basic.Weighted.Ayes != 3 || basic.Basic.Unweighted.Ayes != 2 {
+		t.Errorf("expected 3 weighted and 2 unweighted ayes, got %d and %d",
+			basic.Basic.Weighted.Ayes, basic.Basic.Unweighted.Ayes)
+	}
+	if basic.Majority.Base != 4 || basic.Majority.Required != 2 {
+		t.Errorf("expected majority base 4 and required 2, got %d and %d",
+			basic.Majority.Base, basic.Majority.Required)
+	}
+	if basic.Votes != nil {
+		t.Errorf("expected no votes, got %v", basic.Votes)
+	}
+
+	// absolute 2/3 majority of weight 4: more than 2 required, Bob has weight 2
+	absolute := polls[1]
+	if absolute.Majority.Base != 4 || absolute.Outcome != server.PollOutcomeRejected {
+		t.Errorf("expected absolute majority base 4 and rejected, got %d and %s",
+			absolute.Majority.Base, absolute.Outcome)
+	}
+
+	median := polls[2]
+	if median.Outcome != server.PollOutcomeAccepted || median.Median.MajorityValue != 5000 {
+		t.Errorf("expected median majority value 5000, got %d (%s)", median.Median.MajorityValue, median.Outcome)
+	}
+
+	schulze := polls[3]
+	expectedRanking := [][]string{{"A"}, {"B"}, {"C"}}
+	if !reflect.DeepEqual(schulze.Schulze.RankedGroups, expectedRanking) {
+		t.Errorf("expected ranking %v, got %v", expectedRanking, schulze.Schulze.RankedGroups)
+	}
+
+	if polls[4].Outcome != server.PollOutcomeNoVotes {
+		t.Errorf("expected no votes for empty poll, got %s", polls[4].Outcome)
+	}
+}
+
+func TestEvaluateMeetingVotes(t *testing.T) {
+	results, err := server.EvaluateMeeting(testMeeting(t), true, testMeetingTime)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	votes := results.Groups[0].Polls[2].Votes
+	if len(votes) != 3 {
+		t.Fatalf("expected 3 votes, got %d", len(votes))
+	}
+	if votes[1].Voter != "Bob Voter" || votes[1].Weight != 2 || votes[1].Vote != "80.00 €" {
+		t.Errorf("unexpected vote %+v", votes[1])
+	}
+}
+
+func TestEvaluateMeetingSecretVotes(t *testing.T) {
+	meeting := testMeeting(t)
+	meeting.Groups[0].Polls[2].GetPollModel().RollCall = false
+	results, err := server.EvaluateMeeting(meeting, true, testMeetingTime)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if votes := results.Groups[0].Polls[2].Votes; votes != nil {
+		t.Errorf("expected no votes for a poll that is not a roll call, got %v", votes)
+	}
+	if len(results.Groups[0].Polls[0].Votes) != 3 {
+		t.Errorf("expected 3 votes for roll call, got %v", results.Groups[0].Polls[0].Votes)
+	}
+}
+
+func TestWriteResultsJSON(t *testing.T) {
+	results, err := server.EvaluateMeeting(testMeeting(t), false, testMeetingTime)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var buf bytes.Buffer
+	if err := server.WriteResultsJSON(&buf, results); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("expected valid json, got %v", err)
+	}
+	if version, ok := decoded["version"].(float64); !ok || int(version) != server.ResultsFormatVersion {
+		t.Errorf("expected version %d, got %v", server.ResultsFormatVersion, decoded["version"])
+	}
+	if !strings.Contains(buf.String(), `"ranked_groups"`) {
+		t.Errorf("expected ranked_groups in json, got %s", buf.String())
+	}
+}
+
+func TestWriteResultsCSV(t *testing.T) {
+	results, err := server.EvaluateMeeting(testMeeting(t), true, testMeetingTime)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, includeVotes := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := server.WriteResultsCSV(&buf, results, includeVotes); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		records, readErr := csv.NewReader(&buf).ReadAll()
+		if readErr != nil {
+			t.Fatalf("expected valid csv, got %v", readErr)
+		}
+		// head + one row per poll or one row per vote (the empty poll still has one row)
+		expected := 6
+		if includeVotes {
+			expected = 1 + 3 + 2 + 3 + 3 + 1
+		}
+		if len(records) != expected {
+			t.Errorf("expected %d records (votes=%v), got %d", expected, includeVotes, len(records))
+		}
+	}
+}
+
+func TestWriteResultsMarkdown(t *testing.T) {
+	results, err := server.EvaluateMeeting(testMeeting(t), false, testMeetingTime)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	results.ChainHead = pollsdata.ChainGenesisHash
+	var buf bytes.Buffer
+	if err := server.WriteResultsMarkdown(&buf, results); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, expected := range []string{"# Results: Meeting", "### Motion", "**Result: accepted**",
+		"**Result: 50.00 €**", "**Result: A > B > C**", "* Chain head: `" + pollsdata.ChainGenesisHash + "`"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in markdown, got %s", expected, buf.String())
+		}
+	}
+}
+
+func TestEvaluateMeetingPending(t *testing.T) {
+	meeting := testMeeting(t)
+	meeting.Groups[0].Polls[0].GetPollModel().State = pollsdata.PollStateOpen
+	results, err := server.EvaluateMeeting(meeting, true, testMeetingTime)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	motion := results.Groups[0].Polls[0]
+	if motion.Outcome != server.PollOutcomePending || motion.State != pollsdata.PollStateOpen {
+		t.Errorf("expected open poll to be pending, got %s (%s)", motion.Outcome, motion.State)
+	}
+	if motion.Basic != nil || motion.Votes != nil || motion.Majority.Base != 0 {
+		t.Errorf("expected no partial results for open poll, got %+v", motion)
+	}
+	// the turnout is not secret
+	if motion.NumVoters != 3 {
+		t.Errorf("expected 3 voters, got %d", motion.NumVoters)
+	}
+	// closed polls are pending until the results are published
+	meeting.Groups[0].Polls[0].GetPollModel().State = pollsdata.PollStateClosed
+	results, err = server.EvaluateMeeting(meeting, true, testMeetingTime)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	motion = results.Groups[0].Polls[0]
+	if motion.Outcome != server.PollOutcomePending || motion.Basic != nil || motion.Votes != nil {
+		t.Errorf("expected closed poll to be pending, got %+v", motion)
+	}
+}
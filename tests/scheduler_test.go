@@ -0,0 +1,213 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"context"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/FabianWe/pollsweb/server"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+// schedulerTestHandler implements the methods of the data handler used by the scheduler on a single meeting.
+type schedulerTestHandler struct {
+	pollsdata.DataHandler
+	clock   pollsweb.Clock
+	meeting *pollsdata.MeetingModel
+	audit   []*pollsdata.AuditEntryModel
+}
+
+func (h *schedulerTestHandler) GetVotingTransitionMeetings(ctx context.Context, referenceTime time.Time) ([]*pollsdata.MeetingModel, error) {
+	return []*pollsdata.MeetingModel{h.meeting}, nil
+}
+
+func (h *schedulerTestHandler) ApplyVotingTransition(ctx context.Context, args *pollsdata.MeetingQueryArgs, transition *pollsdata.VotingTransition) (int, error) {
+	return h.meeting.ApplyVotingTransition(transition, h.clock.Now())
+}
+
+func (h *schedulerTestHandler) InsertAuditEntry(ctx context.Context, entry *pollsdata.AuditEntryModel) (uuid.UUID, error) {
+	entry.Id = uuid.New()
+	h.audit = append(h.audit, entry)
+	return entry.Id, nil
+}
+
+var schedulerTestStart = time.Date(2020, 7, 1, 18, 0, 0, 0, time.UTC)
+
+func schedulerTestMeeting(t *testing.T) *pollsdata.MeetingModel {
+	meeting := testMeeting(t)
+	for _, poll := range meeting.Groups[0].Polls {
+		poll.GetPollModel().State = pollsdata.PollStateDraft
+	}
+	meeting.OnlineStart = schedulerTestStart
+	meeting.OnlineEnd = schedulerTestStart.Add(2 * time.Hour)
+	return meeting
+}
+
+func TestDueVotingTransition(t *testing.T) {
+	meeting := schedulerTestMeeting(t)
+	tests := []struct {
+		now      time.Time
+		expected *pollsdata.VotingTransition
+	}{
+		{schedulerTestStart.Add(-time.Minute), nil},
+		{schedulerTestStart, pollsdata.OpenVotingTransition},
+		// drafts are not opened after the end
+		{schedulerTestStart.Add(2 * time.Hour), pollsdata.CloseVotingTransition},
+	}
+	for _, tc := range tests {
+		if got := pollsdata.DueVotingTransition(meeting, tc.now); got != tc.expected {
+			t.Errorf("expected transition %v at %v, got %v", tc.expected, tc.now, got)
+		}
+	}
+	// each transition is done only once
+	if _, err := meeting.ApplyVotingTransition(pollsdata.OpenVotingTransition, schedulerTestStart); err != nil {
+		t.Fatal(err)
+	}
+	if !meeting.OnlineOpenedAt.Equal(schedulerTestStart) || !meeting.OnlineClosedAt.IsZero() {
+		t.Errorf("expected the open transition to be recorded, got %v / %v", meeting.OnlineOpenedAt, meeting.OnlineClosedAt)
+	}
+	if got := pollsdata.DueVotingTransition(meeting, schedulerTestStart.Add(time.Minute)); got != nil {
+		t.Errorf("expected no transition once the polls have been opened, got %v", got)
+	}
+	if _, err := meeting.ApplyVotingTransition(pollsdata.CloseVotingTransition, schedulerTestStart.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := pollsdata.DueVotingTransition(meeting, schedulerTestStart.Add(3*time.Hour)); got != nil {
+		t.Errorf("expected no transition once the polls have been closed, got %v", got)
+	}
+	meeting.OnlineStart = time.Time{}
+	if got := pollsdata.DueVotingTransition(meeting, schedulerTestStart); got != nil {
+		t.Errorf("expected no transition without online voting, got %v", got)
+	}
+}
+
+func TestMeetingScheduler(t *testing.T) {
+	clock := pollsweb.NewFakeClock(schedulerTestStart.Add(-time.Minute))
+	handler := &schedulerTestHandler{clock: clock, meeting: schedulerTestMeeting(t)}
+	appContext := server.NewAppContext(server.NewAppConfig(), zap.NewNop().Sugar(), handler, "")
+	appContext.Clock = clock
+	events := make(chan *server.Event, 10)
+	appContext.Events.Subscribe(func(event *server.Event) {
+		events <- event
+	})
+	scheduler := server.NewMeetingScheduler(appContext)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		scheduler.Run(ctx)
+		close(done)
+	}()
+	// wait for the first check, the meeting has not started
+	clock.BlockUntil(1)
+	if state := handler.meeting.Groups[0].Polls[0].GetPollModel().GetState(); state != pollsdata.PollStateDraft {
+		t.Errorf("expected poll to be a draft before the start, got %s", state)
+	}
+
+	clock.Set(schedulerTestStart)
+	// the scheduler waits for the next tick once the check is done
+	clock.BlockUntil(1)
+	if num := handler.meeting.CountPollsInState(pollsdata.PollStateOpen); num != 5 {
+		t.Errorf("expected all 5 polls to be open, got %d", num)
+	}
+	if event := <-events; event.Type != server.VotingOpenedEvent {
+		t.Errorf("expected event %s, got %s", server.VotingOpenedEvent, event.Type)
+	}
+
+	clock.Set(schedulerTestStart.Add(3 * time.Hour))
+	clock.BlockUntil(1)
+	cancel()
+	<-done
+	if num := handler.meeting.CountPollsInState(pollsdata.PollStateClosed); num != 5 {
+		t.Errorf("expected all 5 polls to be closed, got %d", num)
+	}
+	closed := handler.meeting.Groups[0].Polls[0].GetPollModel().Closed
+	if !closed.Equal(schedulerTestStart.Add(3 * time.Hour)) {
+		t.Errorf("expected poll to be closed at the clock time, got %v", closed)
+	}
+	if event := <-events; event.Type != server.VotingClosedEvent {
+		t.Errorf("expected event %s, got %s", server.VotingClosedEvent, event.Type)
+	}
+	if len(handler.audit) != 2 {
+		t.Fatalf("expected two audit entries, got %d", len(handler.audit))
+	}
+	for i, to := range []string{pollsdata.PollStateOpen, pollsdata.PollStateClosed} {
+		entry := handler.audit[i]
+		if entry.Actor != server.AuditSchedulerActor || entry.Action != pollsdata.AuditPollStateChanged ||
+			entry.MeetingId != handler.meeting.Id || entry.Details["to"] != to || entry.Details["polls"] != "5" {
+			t.Errorf("unexpected audit entry %v", entry)
+		}
+	}
+}
+
+func TestMeetingSchedulerRestart(t *testing.T) {
+	// the server was not running at the end of online voting, the polls are closed on the first check
+	clock := pollsweb.NewFakeClock(schedulerTestStart.Add(24 * time.Hour))
+	handler := &schedulerTestHandler{clock: clock, meeting: schedulerTestMeeting(t)}
+	for _, poll := range handler.meeting.Groups[0].Polls {
+		poll.GetPollModel().State = pollsdata.PollStateOpen
+	}
+	appContext := server.NewAppContext(server.NewAppConfig(), zap.NewNop().Sugar(), handler, "")
+	appContext.Clock = clock
+	if err := server.NewMeetingScheduler(appContext).Check(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if num := handler.meeting.CountPollsInState(pollsdata.PollStateClosed); num != 5 {
+		t.Errorf("expected all 5 polls to be closed, got %d", num)
+	}
+}
+
+func TestMeetingSchedulerOnce(t *testing.T) {
+	clock := pollsweb.NewFakeClock(schedulerTestStart)
+	handler := &schedulerTestHandler{clock: clock, meeting: schedulerTestMeeting(t)}
+	appContext := server.NewAppContext(server.NewAppConfig(), zap.NewNop().Sugar(), handler, "")
+	appContext.Clock = clock
+	scheduler := server.NewMeetingScheduler(appContext)
+	ctx := context.Background()
+	if err := scheduler.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// a draft added after the start is not opened
+	draft := handler.meeting.Groups[0].Polls[0].GetPollModel()
+	draft.State = pollsdata.PollStateDraft
+	clock.Set(schedulerTestStart.Add(time.Minute))
+	if err := scheduler.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if state := draft.GetState(); state != pollsdata.PollStateDraft {
+		t.Errorf("expected the draft added after the start to stay a draft, got %s", state)
+	}
+	clock.Set(schedulerTestStart.Add(3 * time.Hour))
+	if err := scheduler.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// a poll opened by hand after the end is not closed
+	if err := draft.Transition(pollsdata.PollStateOpen, clock.Now()); err != nil {
+		t.Fatal(err)
+	}
+	clock.Set(schedulerTestStart.Add(4 * time.Hour))
+	if err := scheduler.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if state := draft.GetState(); state != pollsdata.PollStateOpen {
+		t.Errorf("expected the poll opened after the end to stay open, got %s", state)
+	}
+	if len(handler.audit) != 2 {
+		t.Errorf("expected two audit entries, got %d", len(handler.audit))
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/FabianWe/pollsweb/server"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const storageTestDriverName = "storage-test"
+
+type storageTestConfig struct {
+	Name string `valid:"stringlength(1|100)"`
+}
+
+// storageTestHandler is the DataHandler returned by the test driver.
+type storageTestHandler struct {
+	pollsdata.DataHandler
+	config *storageTestConfig
+	clock  pollsweb.Clock
+}
+
+func (h *storageTestHandler) SetClock(clock pollsweb.Clock) {
+	h.clock = clock
+}
+
+func (h *storageTestHandler) PendingMigrations(ctx context.Context) (int, error) {
+	return 1, nil
+}
+
+func init() {
+	pollsdata.RegisterStorageDriver(&pollsdata.StorageDriver{
+		Name:      storageTestDriverName,
+		ConfigKey: "storagetest",
+		NewConfig: func() interface{} {
+			return &storageTestConfig{}
+		},
+		Open: func(ctx context.Context, config interface{}) (pollsdata.DataHandler, error) {
+			return &storageTestHandler{config: config.(*storageTestConfig)}, nil
+		},
+	})
+}
+
+func TestOpenStorage(t *testing.T) {
+	ctx := context.Background()
+	names := pollsdata.StorageDriverNames()
+	if !equalStrings(names, []string{pollsdata.BoltStorageDriverName, pollsdata.MongoStorageDriverName, storageTestDriverName}) {
+		t.Errorf("unexpected drivers %v", names)
+	}
+	if _, err := pollsdata.OpenStorage(ctx, "unknown", nil); err == nil {
+		t.Error("expected an error for an unknown driver")
+	}
+	configs := pollsdata.NewStorageDriverConfigs()
+	if _, err := pollsdata.OpenStorage(ctx, storageTestDriverName, configs); err == nil {
+		t.Error("expected an error for an invalid config")
+	}
+	configs["storagetest"].(*storageTestConfig).Name = "test"
+	handler, openErr := pollsdata.OpenStorage(ctx, storageTestDriverName, configs)
+	if openErr != nil {
+		t.Fatal(openErr)
+	}
+	if handler.(*storageTestHandler).config.Name != "test" {
+		t.Error("expected the config to be passed to the driver")
+	}
+}
+
+func TestOpenStorageBolt(t *testing.T) {
+	dir, dirErr := ioutil.TempDir("", "pollsweb-bolt")
+	if dirErr != nil {
+		t.Fatal(dirErr)
+	}
+	defer os.RemoveAll(dir)
+	configs := pollsdata.NewStorageDriverConfigs()
+	configs["bolt"].(*pollsdata.BoltConfig).Path = filepath.Join(dir, "pollsweb.db")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	handler, openErr := pollsdata.OpenStorage(ctx, pollsdata.BoltStorageDriverName, configs)
+	if openErr != nil {
+		t.Fatal(openErr)
+	}
+	defer handler.Close(ctx)
+	if _, ok := handler.(*pollsdata.BoltDataHandler); !ok {
+		t.Errorf("expected a bolt handler, got %T", handler)
+	}
+}
+
+func TestNewAppContextFromConfig(t *testing.T) {
+	config := server.NewAppConfig()
+	config.Storage.Driver = storageTestDriverName
+	config.Storage.DriverConfigs["storagetest"].(*storageTestConfig).Name = "test"
+	// the test handler always has a pending migration
+	_, pendingErr := server.NewAppContextFromConfig(context.Background(), config, zap.NewNop().Sugar(), "")
+	var pending server.PendingMigrationsError
+	if !errors.As(pendingErr, &pending) || pending.NumPending != 1 {
+		t.Errorf("expected a PendingMigrationsError, got %v", pendingErr)
+	}
+	config.Storage.AllowPendingMigrations = true
+	appContext, err := server.NewAppContextFromConfig(context.Background(), config, zap.NewNop().Sugar(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, ok := appContext.DataHandler.(*storageTestHandler)
+	if !ok {
+		t.Fatalf("expected the handler of the test driver, got %T", appContext.DataHandler)
+	}
+	if handler.clock != appContext.Clock {
+		t.Error("expected the clock of the app context to be set")
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/server"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestConvertFormat(t *testing.T) {
+	tests := []struct {
+		translator *pollsweb.TimeFormatTranslator
+		in         string
+		expected   string
+		expectsErr bool
+	}{
+		{pollsweb.MomentJSDateFormatter, "02.01.2006 15:04", "DD.MM.YYYY HH:mm", false},
+		{pollsweb.MomentJSDateFormatter, "2006/01/02", "YYYY/MM/DD", false},
+		{pollsweb.MomentJSDateFormatter, "Monday, 2. January 2006 at 3:04 PM", "dddd, D. MMMM YYYY [at] h:mm A", false},
+		{pollsweb.MomentJSDateFormatter, "15:04 -07", "", true},
+		{pollsweb.MomentJSDateFormatter, "15:04:05.000", "", true},
+		{pollsweb.StrftimeDateFormatter, "02.01.2006 15:04", "%d.%m.%Y %H:%M", false},
+		{pollsweb.StrftimeDateFormatter, "100% Jan", "%-m00%% %b", false},
+		{pollsweb.StrftimeDateFormatter, "15:04 -07:00", "", true},
+		{pollsweb.FlatpickrDateFormatter, "2006-01-02 15:04", "Y-m-d H:i", false},
+		{pollsweb.FlatpickrDateFormatter, "15h04", `H\hi`, false},
+		{pollsweb.FlatpickrDateFormatter, "15:4", "", true},
+		{pollsweb.CLDRDateFormatter, "Mon, 02 Jan 2006 15:04:05 -0700", "EEE, dd MMM yyyy HH:mm:ss xx", false},
+		{pollsweb.CLDRDateFormatter, "15 o'clock", "HH' o''clock'", false},
+		{pollsweb.CLDRDateFormatter, "3 pm", "", true},
+		{pollsweb.PHPDateFormatter, "Monday, 02-Jan-06 15:04:05 MST", `l, d-M-y H:i:s T`, false},
+		{pollsweb.PHPDateFormatter, "at 15:04", `\a\t H:i`, false},
+		{pollsweb.PHPDateFormatter, "3:4", "", true},
+	}
+	for _, tc := range tests {
+		res, err := tc.translator.ConvertFormat(tc.in)
+		if tc.expectsErr {
+			if err == nil {
+				t.Errorf("expected error for input \"%s\", but got result \"%s\"", tc.in, res)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expected no error for input \"%s\", but got error %v", tc.in, err)
+			continue
+		}
+		if res != tc.expected {
+			t.Errorf("expected \"%s\" but got \"%s\" for input \"%s\"", tc.expected, res, tc.in)
+		}
+	}
+}
+
+func TestToGoLayout(t *testing.T) {
+	tests := []struct {
+		translator *pollsweb.TimeFormatTranslator
+		in         string
+		expected   string
+		expectsErr bool
+	}{
+		{pollsweb.MomentJSDateFormatter, "DD.MM.YYYY HH:mm", "02.01.2006 15:04", false},
+		{pollsweb.MomentJSDateFormatter, "dddd [at] h:mm A", "Monday at 3:04 PM", false},
+		{pollsweb.MomentJSDateFormatter, "Do MMMM", "", true},
+		{pollsweb.MomentJSDateFormatter, "[1] YYYY", "", true},
+		{pollsweb.StrftimeDateFormatter, "%d.%m.%Y %H:%M", "02.01.2006 15:04", false},
+		{pollsweb.StrftimeDateFormatter, "%A, %-d %B %Y", "Monday, 2 January 2006", false},
+		{pollsweb.StrftimeDateFormatter, "%j", "", true},
+		{pollsweb.StrftimeDateFormatter, "100%%", "", true},
+		{pollsweb.FlatpickrDateFormatter, "Y-m-d H:i", "2006-01-02 15:04", false},
+		{pollsweb.FlatpickrDateFormatter, "U", "", true},
+		{pollsweb.CLDRDateFormatter, "EEE, dd MMM yyyy HH:mm:ss xx", "Mon, 02 Jan 2006 15:04:05 -0700", false},
+		{pollsweb.CLDRDateFormatter, "HH 'o''clock'", "15 o'clock", false},
+		{pollsweb.CLDRDateFormatter, "HH 'o'clock", "", true},
+		{pollsweb.CLDRDateFormatter, "QQQ yyyy", "", true},
+		{pollsweb.PHPDateFormatter, `l, d-M-y H:i:s T`, "Monday, 02-Jan-06 15:04:05 MST", false},
+		{pollsweb.PHPDateFormatter, `\a\t H:i`, "at 15:04", false},
+		{pollsweb.PHPDateFormatter, "N", "", true},
+	}
+	for _, tc := range tests {
+		res, err := tc.translator.ToGoLayout(tc.in)
+		if tc.expectsErr {
+			if err == nil {
+				t.Errorf("expected error for input \"%s\", but got result \"%s\"", tc.in, res)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expected no error for input \"%s\", but got error %v", tc.in, err)
+			continue
+		}
+		if res != tc.expected {
+			t.Errorf("expected \"%s\" but got \"%s\" for input \"%s\"", tc.expected, res, tc.in)
+		}
+	}
+}
+
+func TestRequestContextMomentJSFormats(t *testing.T) {
+	newRequestContext := func(syntax, dateFormat, dateTimeFormat string) *server.RequestContext {
+		config := server.NewAppConfig()
+		config.Localization.FormatSyntax = syntax
+		config.Localization.DefaultDateFormat = dateFormat
+		config.Localization.DefaultTimeFormat = dateTimeFormat
+		return server.NewRequestContext(server.NewAppContext(config, zap.NewNop().Sugar(), nil, "../templates"))
+	}
+	requestContext := newRequestContext("go", "02.01.2006", "02.01.2006 15:04")
+	if got := requestContext.GetMomentJSDateFormat(); got != "DD.MM.YYYY" {
+		t.Errorf("expected date format \"DD.MM.YYYY\", got \"%s\"", got)
+	}
+	if got := requestContext.GetMomentJSDateTimeFormat(); got != "DD.MM.YYYY HH:mm" {
+		t.Errorf("expected date time format \"DD.MM.YYYY HH:mm\", got \"%s\"", got)
+	}
+	// formats in another syntax are converted without changing the config
+	requestContext = newRequestContext("strftime", "%Y-%m-%d", "%Y-%m-%d %H:%M")
+	if got := requestContext.GetMomentJSDateFormat(); got != "YYYY-MM-DD" {
+		t.Errorf("expected date format \"YYYY-MM-DD\", got \"%s\"", got)
+	}
+	if got := requestContext.GetMomentJSDateTimeFormat(); got != "YYYY-MM-DD HH:mm" {
+		t.Errorf("expected date time format \"YYYY-MM-DD HH:mm\", got \"%s\"", got)
+	}
+	if requestContext.Localization.FormatSyntax != "strftime" {
+		t.Errorf("expected the config not to be changed, got syntax \"%s\"", requestContext.Localization.FormatSyntax)
+	}
+	// formats that can't be converted fall back to the formats of the inputs
+	requestContext = newRequestContext("strftime", "%j", "%j")
+	if got := requestContext.GetMomentJSDateFormat(); got != server.InternalDateFormatMomentJS {
+		t.Errorf("expected date format \"%s\", got \"%s\"", server.InternalDateFormatMomentJS, got)
+	}
+	if got := requestContext.GetMomentJSDateTimeFormat(); got != server.InternalDateTimeFormatMomentJS {
+		t.Errorf("expected date time format \"%s\", got \"%s\"", server.InternalDateTimeFormatMomentJS, got)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"errors"
+	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+func expectValidationError(t *testing.T, err error, fieldName string) {
+	t.Helper()
+	var validationErr *pollsdata.ModelValidationError
+	if !errors.As(err, &validationErr) {
+		t.Errorf("expected a ModelValidationError for field \"%s\", got %v", fieldName, err)
+		return
+	}
+	if validationErr.FieldName != fieldName {
+		t.Errorf("expected validation error for field \"%s\", got \"%s\" (%v)", fieldName, validationErr.FieldName, err)
+	}
+}
+
+func TestValidateMeeting(t *testing.T) {
+	if err := testMeeting(t).ValidateModel(); err != nil {
+		t.Fatalf("expected meeting to be valid, got %v", err)
+	}
+	tests := []struct {
+		name      string
+		modify    func(meeting *pollsdata.MeetingModel)
+		fieldName string
+	}{
+		{"missing id", func(meeting *pollsdata.MeetingModel) {
+			meeting.Id = uuid.Nil
+		}, "Id"},
+		{"missing period id", func(meeting *pollsdata.MeetingModel) {
+			meeting.PeriodId = uuid.Nil
+		}, "PeriodId"},
+		{"time based id", func(meeting *pollsdata.MeetingModel) {
+			meeting.Groups[0].Id = uuid.Must(uuid.NewUUID())
+		}, "Groups[0].Id"},
+		{"online end before start", func(meeting *pollsdata.MeetingModel) {
+			meeting.OnlineEnd = meeting.OnlineStart.Add(-time.Minute)
+		}, "OnlineEnd"},
+		{"only online start", func(meeting *pollsdata.MeetingModel) {
+			meeting.OnlineEnd = time.Time{}
+		}, "OnlineEnd"},
+		{"short voter name", func(meeting *pollsdata.MeetingModel) {
+			meeting.Voters[1].Name = "Bob"
+		}, "Voters[1]"},
+		{"invalid email", func(meeting *pollsdata.MeetingModel) {
+			meeting.Voters[0].Email = "alice"
+		}, "Voters[0]"},
+		{"duplicate voter slug", func(meeting *pollsdata.MeetingModel) {
+			meeting.Voters[1].Slug = "alice-voter"
+		}, "Voters[1].Slug"},
+		{"duplicate group slug", func(meeting *pollsdata.MeetingModel) {
+			group := pollsdata.NewPollGroupModel("Other", "group", nil)
+			group.SetId(uuid.New())
+			meeting.Groups = append(meeting.Groups, group)
+		}, "Groups[1].Slug"},
+		{"duplicate poll slug", func(meeting *pollsdata.MeetingModel) {
+			meeting.Groups[0].Polls[1].GetPollModel().Slug = "motion"
+		}, "Groups[0].Polls[1].Slug"},
+		{"short poll name", func(meeting *pollsdata.MeetingModel) {
+			meeting.Groups[0].Polls[0].GetPollModel().Name = "Vote"
+		}, "Groups[0].Polls[0]"},
+		{"invalid state", func(meeting *pollsdata.MeetingModel) {
+			meeting.Groups[0].Polls[0].GetPollModel().State = "running"
+		}, "Groups[0].Polls[0]"},
+		{"wrong type", func(meeting *pollsdata.MeetingModel) {
+			meeting.Groups[0].Polls[0].GetPollModel().Type = pollsdata.MedianPollStringName
+		}, "Groups[0].Polls[0].Type"},
+		{"numerator greater than denominator", func(meeting *pollsdata.MeetingModel) {
+			meeting.Groups[0].Polls[0].GetPollModel().Majority = pollsdata.NewMajorityModel(3, 2)
+		}, "Groups[0].Polls[0].Majority.Numerator"},
+		{"zero denominator", func(meeting *pollsdata.MeetingModel) {
+			meeting.Groups[0].Polls[0].GetPollModel().Majority = pollsdata.NewMajorityModel(0, 0)
+		}, "Groups[0].Polls[0].Majority.Denominator"},
+		{"invalid answer", func(meeting *pollsdata.MeetingModel) {
+			meeting.Groups[0].Polls[0].(*pollsdata.BasicPollModel).Votes[0].Answer = 3
+		}, "Groups[0].Polls[0].Votes[0].Answer"},
+		{"duplicate vote", func(meeting *pollsdata.MeetingModel) {
+			meeting.Groups[0].Polls[0].(*pollsdata.BasicPollModel).Votes[1].Slug = "alice-voter"
+		}, "Groups[0].Polls[0].Votes[1].Slug"},
+		{"median vote greater than value", func(meeting *pollsdata.MeetingModel) {
+			meeting.Groups[0].Polls[2].(*pollsdata.MedianPollModel).Votes[0].Value = 10001
+		}, "Groups[0].Polls[2].Votes[0].Value"},
+		{"missing median value", func(meeting *pollsdata.MeetingModel) {
+			meeting.Groups[0].Polls[2].(*pollsdata.MedianPollModel).Value = gopolls.NoMedianUnitValue
+		}, "Groups[0].Polls[2]"},
+		{"short ranking", func(meeting *pollsdata.MeetingModel) {
+			meeting.Groups[0].Polls[3].(*pollsdata.SchulzePollModel).Votes[0].Ranking = gopolls.SchulzeRanking{0, 1}
+		}, "Groups[0].Polls[3].Votes[0].Ranking"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			meeting := testMeeting(t)
+			tc.modify(meeting)
+			expectValidationError(t, meeting.ValidateModel(), tc.fieldName)
+		})
+	}
+}
+
+func TestValidateMeetingOptionalFields(t *testing.T) {
+	meeting := testMeeting(t)
+	// no online voting, no email and a poll without a state (a draft) are valid
+	meeting.OnlineStart, meeting.OnlineEnd = time.Time{}, time.Time{}
+	meeting.Voters[0].Email = ""
+	meeting.Groups[0].Polls[0].GetPollModel().State = ""
+	if err := meeting.ValidateModel(); err != nil {
+		t.Errorf("expected meeting to be valid, got %v", err)
+	}
+}
+
+func TestValidatePeriod(t *testing.T) {
+	newPeriod := func() *pollsdata.PeriodSettingsModel {
+		period := pollsdata.NewPeriodSettingsModel(pollsweb.NewFakeClock(testMeetingTime), "Summer", "summer",
+			pollsdata.NewMeetingTimeTemplateModel(time.Thursday, 19, 30), testMeeting(t).Voters,
+			testMeetingTime, testMeetingTime.Add(24*time.Hour))
+		period.SetId(uuid.New())
+		return period
+	}
+	if err := newPeriod().ValidateModel(); err != nil {
+		t.Fatalf("expected period to be valid, got %v", err)
+	}
+	period := newPeriod()
+	period.End = period.Start
+	expectValidationError(t, period.ValidateModel(), "End")
+
+	period = newPeriod()
+	period.Name = "Fall"
+	expectValidationError(t, period.ValidateModel(), "")
+
+	period = newPeriod()
+	period.MeetingDateTemplate.Hour = 24
+	expectValidationError(t, period.ValidateModel(), "")
+
+	period = newPeriod()
+	period.MeetingDateTemplate = nil
+	expectValidationError(t, period.ValidateModel(), "MeetingDateTemplate")
+
+	period = newPeriod()
+	period.Voters[0].Id = uuid.Nil
+	expectValidationError(t, period.ValidateModel(), "Voters[0].Id")
+}
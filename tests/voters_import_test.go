@@ -0,0 +1,146 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"github.com/FabianWe/gopolls"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/FabianWe/pollsweb/server"
+	"strings"
+	"testing"
+)
+
+func TestDetectCSVDelimiter(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected rune
+	}{
+		{"name,weight", ','},
+		{"name;weight;email", ';'},
+		{"name\tweight", '\t'},
+		{"\"Doe, John\";2", ';'},
+		{"name", ','},
+	}
+	for _, tc := range tests {
+		if got := server.DetectCSVDelimiter(tc.line); got != tc.expected {
+			t.Errorf("expected delimiter %q for line \"%s\", got %q", tc.expected, tc.line, got)
+		}
+	}
+}
+
+func TestImportVotersCSV(t *testing.T) {
+	input := "\xef\xbb\xbfName;Weight;E-Mail\n" +
+		"Alice;2;alice@example.com\n" +
+		"\n" +
+		"Bob Voter;1;\n" +
+		"Carol;x;carol@example.com\n" +
+		"Alice;1;invalid\n"
+	options := server.NewVotersImportOptions()
+	options.NameColumn = "name"
+	options.WeightColumn = "weight"
+	options.EmailColumn = "e-mail"
+	limits := server.NewVotersLimitsConfig()
+	preview, err := server.ImportVotersCSV(strings.NewReader(input), options, limits)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if preview.Delimiter != ';' || !preview.HasHeader {
+		t.Errorf("expected delimiter ';' and a header, got %q and %v", preview.Delimiter, preview.HasHeader)
+	}
+	if len(preview.Rows) != 4 {
+		t.Fatalf("expected four rows, got %d", len(preview.Rows))
+	}
+	if preview.Valid() || preview.NumInvalidRows() != 2 {
+		t.Errorf("expected two invalid rows, got %d", preview.NumInvalidRows())
+	}
+	alice := preview.Rows[0].Voter
+	if alice == nil || alice.Name != "Alice" || alice.Weight != 2 || alice.Email != "alice@example.com" {
+		t.Errorf("unexpected voter for first row: %v", alice)
+	}
+	// empty lines are skipped by the csv reader
+	if line := preview.Rows[1].Line; line != 3 {
+		t.Errorf("expected Bob in line 3, got %d", line)
+	}
+	// duplicate name and invalid email
+	if errs := preview.Rows[3].Errors; len(errs) != 2 {
+		t.Errorf("expected two errors for the last row, got %v", errs)
+	}
+	if voters := preview.Voters(); len(voters) != 2 {
+		t.Errorf("expected two valid voters, got %d", len(voters))
+	}
+}
+
+func TestImportVotersCSVLimits(t *testing.T) {
+	input := "Alice\t1000\nBob Voter\t1001\nCarol\t1\nDavid\t1\n"
+	limits := server.NewVotersLimitsConfig()
+	limits.MaxNumVoters = 2
+	limits.MaxVotersWeight = gopolls.Weight(1000)
+	preview, err := server.ImportVotersCSV(strings.NewReader(input), server.NewVotersImportOptions(), limits)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if preview.HasHeader {
+		t.Error("expected no header to be detected")
+	}
+	if len(preview.Errors) != 1 {
+		t.Errorf("expected an error for too many voters, got %v", preview.Errors)
+	}
+	if !preview.Rows[0].Valid() || preview.Rows[1].Valid() {
+		t.Error("expected only the weight of the second row to exceed the limit")
+	}
+	// invalid rows don't count against the number of voters
+	limits.MaxNumVoters = 3
+	preview, err = server.ImportVotersCSV(strings.NewReader(input), server.NewVotersImportOptions(), limits)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(preview.Errors) != 0 || preview.NumInvalidRows() != 1 {
+		t.Errorf("expected only the invalid row to be reported, got %v", preview.Errors)
+	}
+}
+
+func TestImportVotersCSVValidation(t *testing.T) {
+	input := "Anna-Lena,1\nAnna Lena,1\nBob,1\n?????,1\nCarol,1\n"
+	preview, err := server.ImportVotersCSV(strings.NewReader(input), server.NewVotersImportOptions(), nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(preview.Rows) != 5 {
+		t.Fatalf("expected five rows, got %d", len(preview.Rows))
+	}
+	// the same slug, a name that is too short and a name without a slug
+	for _, i := range []int{1, 2, 3} {
+		if row := preview.Rows[i]; row.Valid() || row.Voter != nil {
+			t.Errorf("expected row %d to be invalid, got %v", row.Line, row.Voter)
+		}
+	}
+	if errs := preview.Rows[1].Errors; len(errs) != 1 || !strings.Contains(errs[0], "anna-lena") {
+		t.Errorf("expected an error for the duplicate slug, got %v", errs)
+	}
+	if voters := preview.Voters(); len(voters) != 2 {
+		t.Errorf("expected two valid voters, got %d", len(voters))
+	}
+	if err := pollsdata.ValidateVoters(preview.Voters()); err != nil {
+		t.Errorf("expected the voters of the preview to be valid, got %v", err)
+	}
+}
+
+func TestImportVotersCSVUnknownColumn(t *testing.T) {
+	options := server.NewVotersImportOptions()
+	options.NameColumn = "member"
+	if _, err := server.ImportVotersCSV(strings.NewReader("name,weight\nAlice,1\n"), options, nil); err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bytes"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/FabianWe/pollsweb/server"
+	"github.com/google/uuid"
+	"strings"
+	"testing"
+)
+
+// votesImportTestMeeting returns testMeeting with all polls open, only Carol has voted (on Motion).
+func votesImportTestMeeting(t *testing.T) *pollsdata.MeetingModel {
+	meeting := testMeeting(t)
+	polls := meeting.Groups[0].Polls
+	for _, poll := range polls {
+		poll.GetPollModel().State = pollsdata.PollStateOpen
+	}
+	motion := polls[0].(*pollsdata.BasicPollModel)
+	motion.Votes = motion.Votes[2:]
+	polls[1].(*pollsdata.BasicPollModel).Votes = nil
+	polls[2].(*pollsdata.MedianPollModel).Votes = nil
+	polls[3].(*pollsdata.SchulzePollModel).Votes = nil
+	return meeting
+}
+
+func TestWriteVotesCSVTemplate(t *testing.T) {
+	var buf bytes.Buffer
+	if err := server.WriteVotesCSVTemplate(&buf, votesImportTestMeeting(t)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := "voter,Group / Motion,Group / Statute,Group / Budget,Group / Chair,Group / Empty\n" +
+		"Alice Voter,,,,,\nBob Voter,,,,,\nCarol Voter,,,,,\n"
+	if got := buf.String(); got != expected {
+		t.Errorf("expected template %q, got %q", expected, got)
+	}
+}
+
+func TestImportVotesCSV(t *testing.T) {
+	meeting := votesImportTestMeeting(t)
+	input := "voter;Group / Motion;Group / Budget;Group / Chair;Group / Unknown\n" +
+		"Alice Voter;yes;50.00;1, 2, 3;\n" +
+		"Bob Voter;maybe;200.00;1, 2;\n" +
+		"Carol Voter;no;;;\n" +
+		"Dave;;;;\n"
+	result, err := server.ImportVotesCSV(strings.NewReader(input), meeting, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// unknown poll and unknown voter
+	if len(result.Errors) != 2 {
+		t.Errorf("expected two errors, got %v", result.Errors)
+	}
+	// Bob: invalid answer, value too large, invalid ranking; Carol: already voted
+	if len(result.CellErrors) != 4 {
+		t.Errorf("expected four cell errors, got %d", len(result.CellErrors))
+		for _, cellErr := range result.CellErrors {
+			t.Log(cellErr)
+		}
+	}
+	if len(result.Votes) != 3 {
+		t.Fatalf("expected three valid votes, got %d", len(result.Votes))
+	}
+	votes, votesErr := result.PollVotes()
+	if votesErr != nil {
+		t.Fatalf("expected no error creating votes, got %v", votesErr)
+	}
+	for i, vote := range votes {
+		if vote.Vote.GetId() == uuid.Nil || vote.PollId != result.Votes[i].Poll.GetId() {
+			t.Errorf("unexpected vote %v for poll %s", vote.Vote, result.Votes[i].Poll.GetId())
+		}
+		if err := pollsdata.AddPollVote(result.Votes[i].Poll, vote.Vote); err != nil {
+			t.Fatalf("expected no error adding vote, got %v", err)
+		}
+	}
+	median := meeting.Groups[0].Polls[2].(*pollsdata.MedianPollModel)
+	if len(median.Votes) != 1 || median.Votes[0].VoterName != "Alice Voter" || median.Votes[0].Value != 5000 {
+		t.Errorf("unexpected votes for median poll: %v", median.Votes)
+	}
+}
+
+func TestImportVotesCSVGroups(t *testing.T) {
+	meeting := votesImportTestMeeting(t)
+	majority := pollsdata.NewMajorityModel(1, 2)
+	other := pollsdata.NewBasicPollModel("Motion", "motion", majority, false, nil)
+	other.State = pollsdata.PollStateOpen
+	meeting.Groups = append(meeting.Groups,
+		pollsdata.NewPollGroupModel("Other Group", "other-group", []pollsdata.AbstractPollModel{other}))
+	input := "voter,Group / Motion,Other Group / Motion,Motion\n" +
+		"Alice Voter,yes,no,yes\n"
+	result, err := server.ImportVotesCSV(strings.NewReader(input), meeting, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// the poll name alone doesn't identify the poll
+	if len(result.Errors) != 1 {
+		t.Errorf("expected one error, got %v", result.Errors)
+	}
+	if len(result.Votes) != 2 {
+		t.Fatalf("expected two valid votes, got %d", len(result.Votes))
+	}
+	if result.Votes[0].Poll != meeting.Groups[0].Polls[0] || result.Votes[1].Poll != other {
+		t.Errorf("expected the votes to be matched on group and poll, got %v and %v",
+			result.Votes[0].Poll, result.Votes[1].Poll)
+	}
+}
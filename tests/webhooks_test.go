@@ -0,0 +1,226 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/FabianWe/pollsweb"
+	"github.com/FabianWe/pollsweb/pollsdata"
+	"github.com/FabianWe/pollsweb/server"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookBackoff(t *testing.T) {
+	config := server.NewWebhookConfig()
+	config.InitialBackoff = time.Second
+	config.MaxBackoff = 5 * time.Second
+	tests := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{10, 5 * time.Second},
+	}
+	for _, tc := range tests {
+		if got := config.Backoff(tc.attempt); got != tc.expected {
+			t.Errorf("expected backoff %s for attempt %d, got %s", tc.expected, tc.attempt, got)
+		}
+	}
+}
+
+func TestEventBroker(t *testing.T) {
+	broker := server.NewEventBroker()
+	var received []string
+	unsubscribe := broker.Subscribe(func(event *server.Event) {
+		received = append(received, event.Type)
+	})
+	event, eventErr := server.NewEvent(pollsweb.NewSystemClock(), server.MeetingCreatedEvent, nil)
+	if eventErr != nil {
+		t.Fatalf("can't create event: %v", eventErr)
+	}
+	broker.Publish(event)
+	unsubscribe()
+	broker.Publish(event)
+	if len(received) != 1 || received[0] != server.MeetingCreatedEvent {
+		t.Errorf("expected exactly one received event, got %v", received)
+	}
+}
+
+func TestWebhookDeliver(t *testing.T) {
+	const secret = "0123456789abcdef"
+	var body []byte
+	var header http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		header = r.Header
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	appContext := server.NewAppContext(server.NewAppConfig(), zap.NewNop().Sugar(), nil, "../templates")
+	dispatcher := server.NewWebhookDispatcher(appContext)
+	webhook := pollsdata.NewWebhookModel(appContext.Clock, ts.URL, secret, []string{server.PeriodCreatedEvent})
+	event, eventErr := server.NewEvent(appContext.Clock, server.PeriodCreatedEvent, map[string]string{"slug": "period"})
+	if eventErr != nil {
+		t.Fatalf("can't create event: %v", eventErr)
+	}
+	payload, encodeErr := json.Marshal(event)
+	if encodeErr != nil {
+		t.Fatalf("can't encode event: %v", encodeErr)
+	}
+	delivery := dispatcher.Deliver(context.Background(), webhook, event, payload, 1)
+	if !delivery.Success || delivery.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected successful delivery, got %s", delivery)
+	}
+	if string(body) != string(payload) {
+		t.Errorf("expected payload %s, got %s", payload, body)
+	}
+	if got := header.Get(server.WebhookEventHeader); got != server.PeriodCreatedEvent {
+		t.Errorf("expected event header \"%s\", got \"%s\"", server.PeriodCreatedEvent, got)
+	}
+	if got, expected := header.Get(server.WebhookTimestampHeader), strconv.FormatInt(delivery.Time.Unix(), 10); got != expected {
+		t.Errorf("expected timestamp header \"%s\", got \"%s\"", expected, got)
+	}
+	if got, expected := header.Get(server.WebhookSignatureHeader), server.SignWebhookPayload(secret, delivery.Time, payload); got != expected {
+		t.Errorf("expected signature \"%s\", got \"%s\"", expected, got)
+	}
+	// the timestamp is signed, a replayed request with another timestamp has an invalid signature
+	if server.SignWebhookPayload(secret, delivery.Time.Add(time.Hour), payload) == header.Get(server.WebhookSignatureHeader) {
+		t.Error("expected the signature to depend on the timestamp")
+	}
+}
+
+func TestWebhookDeliveryOrder(t *testing.T) {
+	handler, _, closeHandler := openBoltTestHandler(t)
+	defer closeHandler()
+	const numEvents = 20
+	var mutex sync.Mutex
+	received := make([]string, 0, numEvents)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event struct {
+			Data map[string]string `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("can't decode event: %v", err)
+		}
+		mutex.Lock()
+		received = append(received, event.Data["slug"])
+		mutex.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	appContext := server.NewAppContext(server.NewAppConfig(), zap.NewNop().Sugar(), handler, "../templates")
+	webhook := pollsdata.NewWebhookModel(appContext.Clock, ts.URL, "0123456789abcdef", []string{server.PeriodCreatedEvent})
+	if _, err := handler.InsertWebhook(context.Background(), webhook); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dispatcher := server.NewWebhookDispatcher(appContext)
+	dispatcher.Start(ctx)
+	expected := make([]string, numEvents)
+	for i := range expected {
+		expected[i] = fmt.Sprintf("period-%d", i)
+		appContext.PublishEvent(server.PeriodCreatedEvent, map[string]string{"slug": expected[i]})
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		mutex.Lock()
+		numReceived := len(received)
+		mutex.Unlock()
+		if numReceived == numEvents {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d deliveries, got %d", numEvents, numReceived)
+		}
+	}
+	cancel()
+	dispatcher.Wait()
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("expected the events to be delivered in order %v, got %v", expected, received)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	handler, _, closeHandler := openBoltTestHandler(t)
+	defer closeHandler()
+	// the first attempt fails, the retry succeeds
+	var numRequests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&numRequests, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer ts.Close()
+
+	appContext := server.NewAppContext(server.NewAppConfig(), zap.NewNop().Sugar(), handler, "../templates")
+	appContext.Webhooks.InitialBackoff = time.Millisecond
+	appContext.Webhooks.RetryInterval = 10 * time.Millisecond
+	webhook := pollsdata.NewWebhookModel(appContext.Clock, ts.URL, "0123456789abcdef", []string{server.PeriodCreatedEvent})
+	if _, err := handler.InsertWebhook(context.Background(), webhook); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	dispatcher := server.NewWebhookDispatcher(appContext)
+	dispatcher.Start(ctx)
+	appContext.PublishEvent(server.PeriodCreatedEvent, map[string]string{"slug": "period"})
+	// wait until both attempts are stored
+	var deliveries []*pollsdata.WebhookDeliveryModel
+	for deadline := time.Now().Add(5 * time.Second); len(deliveries) < 2; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatalf("webhook delivery was not retried, got %v", deliveries)
+		}
+		var getErr error
+		deliveries, getErr = handler.GetWebhookDeliveries(context.Background(), webhook.Id, 0)
+		if getErr != nil {
+			cancel()
+			t.Fatal(getErr)
+		}
+	}
+	cancel()
+	dispatcher.Wait()
+	if len(deliveries) != 2 {
+		t.Fatalf("expected two deliveries, got %v", deliveries)
+	}
+	retry, first := deliveries[0], deliveries[1]
+	if first.Attempt != 1 || first.Success || !first.RetryAt.IsZero() || len(first.Payload) == 0 {
+		t.Errorf("expected a failed first delivery with a claimed retry, got %s", first)
+	}
+	if retry.Attempt != 2 || !retry.Success || retry.EventId != first.EventId {
+		t.Errorf("expected a successful retry of the first delivery, got %s", retry)
+	}
+	due, dueErr := handler.GetDueWebhookDeliveries(context.Background(), time.Now().Add(time.Hour), 0)
+	if dueErr != nil || len(due) != 0 {
+		t.Errorf("expected no pending retries, got %v (%v)", due, dueErr)
+	}
+}
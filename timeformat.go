@@ -0,0 +1,748 @@
+// Copyright 2020 Fabian Wenzelmann <fabianwen@posteo.eu>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pollsweb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TimeFormatConversionError is returned if a time format can't be translated from or to a Go layout.
+//
+// Token is the token that caused the problem (it might be empty if the problem is not caused by a single token).
+type TimeFormatConversionError struct {
+	PollWebError
+	Format  string
+	Token   string
+	Message string
+}
+
+// NewTimeFormatConversionError returns a new TimeFormatConversionError.
+func NewTimeFormatConversionError(format, token, message string) TimeFormatConversionError {
+	return TimeFormatConversionError{
+		Format:  format,
+		Token:   token,
+		Message: message,
+	}
+}
+
+func (err TimeFormatConversionError) Error() string {
+	if err.Token == "" {
+		return fmt.Sprintf("can't convert time format \"%s\": %s", err.Format, err.Message)
+	}
+	return fmt.Sprintf("can't convert time format \"%s\" (token \"%s\"): %s", err.Format, err.Token, err.Message)
+}
+
+// layoutToken describes the elements of a Go time layout.
+//
+// The constants (except layoutLiteral and layoutUnsupported) are in the same order as the fields in
+// TimeFormatTranslator.
+type layoutToken int
+
+const (
+	layoutLiteral layoutToken = iota
+	layoutYearLong
+	layoutYearShort
+	layoutLongMonthStr
+	layoutShortMonthStr
+	layoutNumMonthLong
+	layoutNumMonthShort
+	layoutWeekdayLong
+	layoutWeekdayShort
+	layoutDayLong
+	layoutDayShort
+	layoutHour24
+	layoutHour12Long
+	layoutHour12Short
+	layoutMinuteLong
+	layoutMinuteShort
+	layoutSecondLong
+	layoutSecondShort
+	layoutPMCapital
+	layoutPMLower
+	layoutTZ
+	layoutNumColonTZ
+	layoutNumTZLong
+	layoutNumTZShort
+	// a token that is valid in Go but has no representation in TimeFormatTranslator
+	layoutUnsupported
+)
+
+// goLayoutTokens contains the canonical Go representation of each token.
+var goLayoutTokens = map[layoutToken]string{
+	layoutYearLong:      "2006",
+	layoutYearShort:     "06",
+	layoutLongMonthStr:  "January",
+	layoutShortMonthStr: "Jan",
+	layoutNumMonthLong:  "01",
+	layoutNumMonthShort: "1",
+	layoutWeekdayLong:   "Monday",
+	layoutWeekdayShort:  "Mon",
+	layoutDayLong:       "02",
+	layoutDayShort:      "2",
+	layoutHour24:        "15",
+	layoutHour12Long:    "03",
+	layoutHour12Short:   "3",
+	layoutMinuteLong:    "04",
+	layoutMinuteShort:   "4",
+	layoutSecondLong:    "05",
+	layoutSecondShort:   "5",
+	layoutPMCapital:     "PM",
+	layoutPMLower:       "pm",
+	layoutTZ:            "MST",
+	layoutNumColonTZ:    "-07:00",
+	layoutNumTZLong:     "-0700",
+	layoutNumTZShort:    "-07",
+}
+
+type layoutChunk struct {
+	token layoutToken
+	text  string
+}
+
+func startsWithLowerCase(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	c := s[0]
+	return 'a' <= c && c <= 'z'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// nextGoLayoutToken returns the token starting in s at position 0.
+// The returned length is 0 if s does not start with a token.
+//
+// The rules are the same as the ones used in the time package.
+func nextGoLayoutToken(s string) (layoutToken, int) {
+	if len(s) == 0 {
+		return layoutLiteral, 0
+	}
+	switch s[0] {
+	case 'J':
+		if strings.HasPrefix(s, "January") {
+			return layoutLongMonthStr, 7
+		}
+		if strings.HasPrefix(s, "Jan") && !startsWithLowerCase(s[3:]) {
+			return layoutShortMonthStr, 3
+		}
+	case 'M':
+		if strings.HasPrefix(s, "Monday") {
+			return layoutWeekdayLong, 6
+		}
+		if strings.HasPrefix(s, "Mon") && !startsWithLowerCase(s[3:]) {
+			return layoutWeekdayShort, 3
+		}
+		if strings.HasPrefix(s, "MST") {
+			return layoutTZ, 3
+		}
+	case '0':
+		if strings.HasPrefix(s, "002") {
+			return layoutUnsupported, 3
+		}
+		if len(s) >= 2 && '1' <= s[1] && s[1] <= '6' {
+			return [...]layoutToken{layoutNumMonthLong, layoutDayLong, layoutHour12Long,
+				layoutMinuteLong, layoutSecondLong, layoutYearShort}[s[1]-'1'], 2
+		}
+	case '1':
+		if strings.HasPrefix(s, "15") {
+			return layoutHour24, 2
+		}
+		return layoutNumMonthShort, 1
+	case '2':
+		if strings.HasPrefix(s, "2006") {
+			return layoutYearLong, 4
+		}
+		return layoutDayShort, 1
+	case '_':
+		// "_2006" is a literal "_" followed by the long year
+		if strings.HasPrefix(s, "_2") && !strings.HasPrefix(s, "_2006") {
+			return layoutUnsupported, 2
+		}
+		if strings.HasPrefix(s, "__2") {
+			return layoutUnsupported, 3
+		}
+	case '3':
+		return layoutHour12Short, 1
+	case '4':
+		return layoutMinuteShort, 1
+	case '5':
+		return layoutSecondShort, 1
+	case 'P':
+		if strings.HasPrefix(s, "PM") {
+			return layoutPMCapital, 2
+		}
+	case 'p':
+		if strings.HasPrefix(s, "pm") {
+			return layoutPMLower, 2
+		}
+	case '-':
+		switch {
+		case strings.HasPrefix(s, "-07:00:00"):
+			return layoutUnsupported, 9
+		case strings.HasPrefix(s, "-070000"):
+			return layoutUnsupported, 7
+		case strings.HasPrefix(s, "-07:00"):
+			return layoutNumColonTZ, 6
+		case strings.HasPrefix(s, "-0700"):
+			return layoutNumTZLong, 5
+		case strings.HasPrefix(s, "-07"):
+			return layoutNumTZShort, 3
+		}
+	case 'Z':
+		for _, zulu := range []string{"Z07:00:00", "Z070000", "Z07:00", "Z0700", "Z07"} {
+			if strings.HasPrefix(s, zulu) {
+				return layoutUnsupported, len(zulu)
+			}
+		}
+	case '.', ',':
+		// fractional seconds: all digits must be the same and followed by a non-digit
+		if len(s) >= 2 && (s[1] == '0' || s[1] == '9') {
+			j := 1
+			for j < len(s) && s[j] == s[1] {
+				j++
+			}
+			if !(j < len(s) && isDigit(s[j])) {
+				return layoutUnsupported, j
+			}
+		}
+	}
+	return layoutLiteral, 0
+}
+
+// goLayoutChunks splits a Go layout into tokens and literals.
+// Adjacent literals are merged into a single chunk.
+func goLayoutChunks(layout string) []layoutChunk {
+	res := make([]layoutChunk, 0, len(layout))
+	var literal strings.Builder
+	flushLiteral := func() {
+		if literal.Len() > 0 {
+			res = append(res, layoutChunk{token: layoutLiteral, text: literal.String()})
+			literal.Reset()
+		}
+	}
+	for i := 0; i < len(layout); {
+		token, n := nextGoLayoutToken(layout[i:])
+		if n == 0 {
+			literal.WriteByte(layout[i])
+			i++
+			continue
+		}
+		flushLiteral()
+		res = append(res, layoutChunk{token: token, text: layout[i : i+n]})
+		i += n
+	}
+	flushLiteral()
+	return res
+}
+
+// TimeFormatDialect describes how literal text is represented in a time format of another library.
+//
+// EscapeLiteral is used when converting a Go layout to the format, it must return literal text in such a way
+// that it is not interpreted as a token.
+//
+// ScanLiteral is used when converting a format to a Go layout. It is called for each position in the format that
+// does not start a known token and must return the literal text at the start of s and the number of bytes consumed.
+// If s starts with something that is reserved in the format (an unknown token) an error should be returned.
+type TimeFormatDialect interface {
+	EscapeLiteral(s string) string
+	ScanLiteral(s string) (string, int, error)
+}
+
+func isASCIILetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// escapeLetterRuns calls escape on each maximal run of ASCII letters in s, all other characters are kept.
+func escapeLetterRuns(s string, escape func(run string) string) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); {
+		if !isASCIILetter(s[i]) {
+			buf.WriteByte(s[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && isASCIILetter(s[j]) {
+			j++
+		}
+		buf.WriteString(escape(s[i:j]))
+		i = j
+	}
+	return buf.String()
+}
+
+// scanReservedLetter returns an error if s starts with an ASCII letter, otherwise the first byte as literal.
+func scanReservedLetter(s string) (string, int, error) {
+	if isASCIILetter(s[0]) {
+		j := 1
+		for j < len(s) && s[j] == s[0] {
+			j++
+		}
+		return "", 0, NewTimeFormatConversionError("", s[:j], "unknown or unsupported token")
+	}
+	return s[:1], 1, nil
+}
+
+// BracketDialect is used by formats that reserve all letters and escape literals in square brackets,
+// for example moment.js.
+type BracketDialect struct{}
+
+func (BracketDialect) EscapeLiteral(s string) string {
+	return escapeLetterRuns(s, func(run string) string {
+		return "[" + run + "]"
+	})
+}
+
+func (BracketDialect) ScanLiteral(s string) (string, int, error) {
+	if s[0] == '[' {
+		if end := strings.IndexByte(s, ']'); end > 0 {
+			return s[1:end], end + 1, nil
+		}
+	}
+	return scanReservedLetter(s)
+}
+
+// QuoteDialect is used by formats that reserve all letters and escape literals in single quotes,
+// for example Unicode CLDR patterns. Two single quotes represent a literal single quote.
+type QuoteDialect struct{}
+
+func (QuoteDialect) EscapeLiteral(s string) string {
+	if s == "'" {
+		return "''"
+	}
+	// quote the whole literal: quoting each run of letters could produce adjacent quoted sections, which
+	// would be read as an escaped quote
+	needsQuotes := strings.IndexFunc(s, func(r rune) bool {
+		return r == '\'' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')
+	}) >= 0
+	if !needsQuotes {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func (QuoteDialect) ScanLiteral(s string) (string, int, error) {
+	if s[0] != '\'' {
+		return scanReservedLetter(s)
+	}
+	if strings.HasPrefix(s, "''") {
+		return "'", 2, nil
+	}
+	var buf strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] != '\'' {
+			buf.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '\'' {
+			buf.WriteByte('\'')
+			i++
+			continue
+		}
+		return buf.String(), i + 1, nil
+	}
+	return "", 0, NewTimeFormatConversionError("", s, "unterminated quoted literal")
+}
+
+// BackslashDialect is used by formats that reserve all letters and escape single characters with a backslash,
+// for example PHP date and flatpickr.
+type BackslashDialect struct{}
+
+func (BackslashDialect) EscapeLiteral(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return escapeLetterRuns(s, func(run string) string {
+		var buf strings.Builder
+		for i := 0; i < len(run); i++ {
+			buf.WriteByte('\\')
+			buf.WriteByte(run[i])
+		}
+		return buf.String()
+	})
+}
+
+func (BackslashDialect) ScanLiteral(s string) (string, int, error) {
+	if s[0] == '\\' && len(s) > 1 {
+		return s[1:2], 2, nil
+	}
+	return scanReservedLetter(s)
+}
+
+// PercentDialect is used by formats in which all tokens start with a percent sign, for example strftime.
+// All other characters are literals.
+type PercentDialect struct{}
+
+func (PercentDialect) EscapeLiteral(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+func (PercentDialect) ScanLiteral(s string) (string, int, error) {
+	if s[0] != '%' {
+		end := strings.IndexByte(s, '%')
+		if end < 0 {
+			end = len(s)
+		}
+		return s[:end], end, nil
+	}
+	if strings.HasPrefix(s, "%%") {
+		return "%", 2, nil
+	}
+	token := s
+	if len(token) > 2 {
+		token = token[:2]
+	}
+	return "", 0, NewTimeFormatConversionError("", token, "unknown or unsupported directive")
+}
+
+type reverseLayoutEntry struct {
+	target string
+	token  layoutToken
+}
+
+// TimeFormatTranslator translates Go time layouts to time formats of other libraries (for example JavaScript
+// libraries in the front-end) and back.
+//
+// Each field contains the representation of the Go layout element of the same name in the target format.
+// An empty string means that the element is not supported by the target format, converting a layout that uses
+// this element returns an error.
+// Dialect describes how literal text is escaped in the target format.
+//
+// Instances should be created with NewTimeFormatTranslator, the conversion tables are computed once on first use,
+// so the fields must not be changed after that.
+type TimeFormatTranslator struct {
+	once          *sync.Once
+	targets       map[layoutToken]string
+	reverse       []reverseLayoutEntry
+	Dialect       TimeFormatDialect
+	YearLong      string
+	YearShort     string
+	LongMonthStr  string
+	ShortMonthStr string
+	NumMonthLong  string
+	NumMonthShort string
+	WeekdayLong   string
+	WeekdayShort  string
+	DayLong       string
+	DayShort      string
+	Hour24        string
+	Hour12Long    string
+	Hour12Short   string
+	MinuteLong    string
+	MinuteShort   string
+	SecondLong    string
+	SecondShort   string
+	PMCapital     string
+	PMLower       string
+	TZ            string
+	NumColonTZ    string
+	NumTZLong     string
+	NumTZShort    string
+}
+
+func NewTimeFormatTranslator(dialect TimeFormatDialect) *TimeFormatTranslator {
+	return &TimeFormatTranslator{
+		once:    &sync.Once{},
+		Dialect: dialect,
+	}
+}
+
+func (f *TimeFormatTranslator) init() {
+	f.once.Do(func() {
+		f.targets = map[layoutToken]string{
+			layoutYearLong:      f.YearLong,
+			layoutYearShort:     f.YearShort,
+			layoutLongMonthStr:  f.LongMonthStr,
+			layoutShortMonthStr: f.ShortMonthStr,
+			layoutNumMonthLong:  f.NumMonthLong,
+			layoutNumMonthShort: f.NumMonthShort,
+			layoutWeekdayLong:   f.WeekdayLong,
+			layoutWeekdayShort:  f.WeekdayShort,
+			layoutDayLong:       f.DayLong,
+			layoutDayShort:      f.DayShort,
+			layoutHour24:        f.Hour24,
+			layoutHour12Long:    f.Hour12Long,
+			layoutHour12Short:   f.Hour12Short,
+			layoutMinuteLong:    f.MinuteLong,
+			layoutMinuteShort:   f.MinuteShort,
+			layoutSecondLong:    f.SecondLong,
+			layoutSecondShort:   f.SecondShort,
+			layoutPMCapital:     f.PMCapital,
+			layoutPMLower:       f.PMLower,
+			layoutTZ:            f.TZ,
+			layoutNumColonTZ:    f.NumColonTZ,
+			layoutNumTZLong:     f.NumTZLong,
+			layoutNumTZShort:    f.NumTZShort,
+		}
+		// for the reverse direction we need the longest match first, if two elements have the same target the
+		// one first in the field order wins
+		f.reverse = make([]reverseLayoutEntry, 0, len(f.targets))
+		for token := layoutYearLong; token < layoutUnsupported; token++ {
+			if target := f.targets[token]; target != "" {
+				f.reverse = append(f.reverse, reverseLayoutEntry{target: target, token: token})
+			}
+		}
+		sort.SliceStable(f.reverse, func(i, j int) bool {
+			return len(f.reverse[i].target) > len(f.reverse[j].target)
+		})
+	})
+}
+
+// ConvertFormat converts a Go layout to the target format.
+//
+// The returned error is of type TimeFormatConversionError if the layout contains an element that is not
+// supported by the target format.
+func (f *TimeFormatTranslator) ConvertFormat(goFormat string) (string, error) {
+	f.init()
+	var buf strings.Builder
+	for _, chunk := range goLayoutChunks(goFormat) {
+		switch chunk.token {
+		case layoutLiteral:
+			buf.WriteString(f.Dialect.EscapeLiteral(chunk.text))
+		case layoutUnsupported:
+			return "", NewTimeFormatConversionError(goFormat, chunk.text, "layout element is not supported")
+		default:
+			target := f.targets[chunk.token]
+			if target == "" {
+				return "", NewTimeFormatConversionError(goFormat, chunk.text,
+					"layout element is not supported by the target format")
+			}
+			buf.WriteString(target)
+		}
+	}
+	return buf.String(), nil
+}
+
+// MustConvertFormat is like ConvertFormat but panics if the layout can't be converted.
+// It should only be used to initialize global variables with constant layouts.
+func (f *TimeFormatTranslator) MustConvertFormat(goFormat string) string {
+	res, err := f.ConvertFormat(goFormat)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// ToGoLayout converts a format string from the target format to a Go layout.
+//
+// The returned error is of type TimeFormatConversionError if the format contains a token that is not supported,
+// or if the literal text in the format can't be represented in a Go layout (Go has no way to escape literal text,
+// so for example a literal "1" can't be used).
+func (f *TimeFormatTranslator) ToGoLayout(format string) (string, error) {
+	f.init()
+	expected := make([]layoutChunk, 0, len(format))
+	addLiteral := func(s string) {
+		if n := len(expected); n > 0 && expected[n-1].token == layoutLiteral {
+			expected[n-1].text += s
+		} else {
+			expected = append(expected, layoutChunk{token: layoutLiteral, text: s})
+		}
+	}
+	for i := 0; i < len(format); {
+		matched := false
+		for _, entry := range f.reverse {
+			if strings.HasPrefix(format[i:], entry.target) {
+				expected = append(expected, layoutChunk{token: entry.token, text: goLayoutTokens[entry.token]})
+				i += len(entry.target)
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+		literal, n, scanErr := f.Dialect.ScanLiteral(format[i:])
+		if scanErr != nil {
+			if conversionErr, ok := scanErr.(TimeFormatConversionError); ok {
+				conversionErr.Format = format
+				return "", conversionErr
+			}
+			return "", scanErr
+		}
+		if literal != "" {
+			addLiteral(literal)
+		}
+		i += n
+	}
+	var buf strings.Builder
+	for _, chunk := range expected {
+		buf.WriteString(chunk.text)
+	}
+	res := buf.String()
+	// make sure Go reads the layout the same way, literals could be interpreted as tokens
+	actual := goLayoutChunks(res)
+	if len(actual) != len(expected) {
+		return "", NewTimeFormatConversionError(format, "", "literal text can't be represented in a Go layout")
+	}
+	for i, chunk := range actual {
+		if chunk != expected[i] {
+			return "", NewTimeFormatConversionError(format, chunk.text, "literal text can't be represented in a Go layout")
+		}
+	}
+	return res, nil
+}
+
+// MomentJSDateFormatter translates to moment.js formats (https://momentjs.com/docs/#/displaying/format/).
+var MomentJSDateFormatter *TimeFormatTranslator
+
+// StrftimeDateFormatter translates to strftime formats.
+// The unpadded elements use the "%-" flag of the GNU C library, which is also supported by Python on most
+// platforms.
+var StrftimeDateFormatter *TimeFormatTranslator
+
+// FlatpickrDateFormatter translates to flatpickr formats (https://flatpickr.js.org/formatting/).
+var FlatpickrDateFormatter *TimeFormatTranslator
+
+// CLDRDateFormatter translates to Unicode CLDR / ICU date patterns
+// (https://unicode.org/reports/tr35/tr35-dates.html#Date_Field_Symbol_Table).
+// These patterns are for example used by date-fns and ICU based libraries.
+var CLDRDateFormatter *TimeFormatTranslator
+
+// PHPDateFormatter translates to formats of PHP's date function (https://www.php.net/manual/en/datetime.format.php).
+var PHPDateFormatter *TimeFormatTranslator
+
+// TimeFormatTranslators maps names (as they can be used in the config) to the predefined translators.
+var TimeFormatTranslators map[string]*TimeFormatTranslator
+
+// GetTimeFormatTranslator returns the translator with the given name from TimeFormatTranslators.
+func GetTimeFormatTranslator(name string) (*TimeFormatTranslator, bool) {
+	res, has := TimeFormatTranslators[name]
+	return res, has
+}
+
+func init() {
+	MomentJSDateFormatter = NewTimeFormatTranslator(BracketDialect{})
+	MomentJSDateFormatter.YearLong = "YYYY"
+	MomentJSDateFormatter.YearShort = "YY"
+	MomentJSDateFormatter.LongMonthStr = "MMMM"
+	MomentJSDateFormatter.ShortMonthStr = "MMM"
+	MomentJSDateFormatter.NumMonthLong = "MM"
+	MomentJSDateFormatter.NumMonthShort = "M"
+	MomentJSDateFormatter.WeekdayLong = "dddd"
+	MomentJSDateFormatter.WeekdayShort = "ddd"
+	MomentJSDateFormatter.DayLong = "DD"
+	MomentJSDateFormatter.DayShort = "D"
+	MomentJSDateFormatter.Hour24 = "HH"
+	MomentJSDateFormatter.Hour12Long = "hh"
+	MomentJSDateFormatter.Hour12Short = "h"
+	MomentJSDateFormatter.MinuteLong = "mm"
+	MomentJSDateFormatter.MinuteShort = "m"
+	MomentJSDateFormatter.SecondLong = "ss"
+	MomentJSDateFormatter.SecondShort = "s"
+	MomentJSDateFormatter.PMCapital = "A"
+	MomentJSDateFormatter.PMLower = "a"
+	MomentJSDateFormatter.TZ = "zz"
+	MomentJSDateFormatter.NumColonTZ = "Z"
+	MomentJSDateFormatter.NumTZLong = "ZZ"
+
+	StrftimeDateFormatter = NewTimeFormatTranslator(PercentDialect{})
+	StrftimeDateFormatter.YearLong = "%Y"
+	StrftimeDateFormatter.YearShort = "%y"
+	StrftimeDateFormatter.LongMonthStr = "%B"
+	StrftimeDateFormatter.ShortMonthStr = "%b"
+	StrftimeDateFormatter.NumMonthLong = "%m"
+	StrftimeDateFormatter.NumMonthShort = "%-m"
+	StrftimeDateFormatter.WeekdayLong = "%A"
+	StrftimeDateFormatter.WeekdayShort = "%a"
+	StrftimeDateFormatter.DayLong = "%d"
+	StrftimeDateFormatter.DayShort = "%-d"
+	StrftimeDateFormatter.Hour24 = "%H"
+	StrftimeDateFormatter.Hour12Long = "%I"
+	StrftimeDateFormatter.Hour12Short = "%-I"
+	StrftimeDateFormatter.MinuteLong = "%M"
+	StrftimeDateFormatter.MinuteShort = "%-M"
+	StrftimeDateFormatter.SecondLong = "%S"
+	StrftimeDateFormatter.SecondShort = "%-S"
+	StrftimeDateFormatter.PMCapital = "%p"
+	StrftimeDateFormatter.PMLower = "%P"
+	StrftimeDateFormatter.TZ = "%Z"
+	StrftimeDateFormatter.NumTZLong = "%z"
+
+	FlatpickrDateFormatter = NewTimeFormatTranslator(BackslashDialect{})
+	FlatpickrDateFormatter.YearLong = "Y"
+	FlatpickrDateFormatter.YearShort = "y"
+	FlatpickrDateFormatter.LongMonthStr = "F"
+	FlatpickrDateFormatter.ShortMonthStr = "M"
+	FlatpickrDateFormatter.NumMonthLong = "m"
+	FlatpickrDateFormatter.NumMonthShort = "n"
+	FlatpickrDateFormatter.WeekdayLong = "l"
+	FlatpickrDateFormatter.WeekdayShort = "D"
+	FlatpickrDateFormatter.DayLong = "d"
+	FlatpickrDateFormatter.DayShort = "j"
+	FlatpickrDateFormatter.Hour24 = "H"
+	FlatpickrDateFormatter.Hour12Long = "G"
+	FlatpickrDateFormatter.Hour12Short = "h"
+	FlatpickrDateFormatter.MinuteLong = "i"
+	FlatpickrDateFormatter.SecondLong = "S"
+	FlatpickrDateFormatter.SecondShort = "s"
+	FlatpickrDateFormatter.PMCapital = "K"
+
+	CLDRDateFormatter = NewTimeFormatTranslator(QuoteDialect{})
+	CLDRDateFormatter.YearLong = "yyyy"
+	CLDRDateFormatter.YearShort = "yy"
+	CLDRDateFormatter.LongMonthStr = "MMMM"
+	CLDRDateFormatter.ShortMonthStr = "MMM"
+	CLDRDateFormatter.NumMonthLong = "MM"
+	CLDRDateFormatter.NumMonthShort = "M"
+	CLDRDateFormatter.WeekdayLong = "EEEE"
+	CLDRDateFormatter.WeekdayShort = "EEE"
+	CLDRDateFormatter.DayLong = "dd"
+	CLDRDateFormatter.DayShort = "d"
+	CLDRDateFormatter.Hour24 = "HH"
+	CLDRDateFormatter.Hour12Long = "hh"
+	CLDRDateFormatter.Hour12Short = "h"
+	CLDRDateFormatter.MinuteLong = "mm"
+	CLDRDateFormatter.MinuteShort = "m"
+	CLDRDateFormatter.SecondLong = "ss"
+	CLDRDateFormatter.SecondShort = "s"
+	CLDRDateFormatter.PMCapital = "a"
+	CLDRDateFormatter.TZ = "zzz"
+	CLDRDateFormatter.NumColonTZ = "xxx"
+	CLDRDateFormatter.NumTZLong = "xx"
+	CLDRDateFormatter.NumTZShort = "x"
+
+	PHPDateFormatter = NewTimeFormatTranslator(BackslashDialect{})
+	PHPDateFormatter.YearLong = "Y"
+	PHPDateFormatter.YearShort = "y"
+	PHPDateFormatter.LongMonthStr = "F"
+	PHPDateFormatter.ShortMonthStr = "M"
+	PHPDateFormatter.NumMonthLong = "m"
+	PHPDateFormatter.NumMonthShort = "n"
+	PHPDateFormatter.WeekdayLong = "l"
+	PHPDateFormatter.WeekdayShort = "D"
+	PHPDateFormatter.DayLong = "d"
+	PHPDateFormatter.DayShort = "j"
+	PHPDateFormatter.Hour24 = "H"
+	PHPDateFormatter.Hour12Long = "h"
+	PHPDateFormatter.Hour12Short = "g"
+	PHPDateFormatter.MinuteLong = "i"
+	PHPDateFormatter.SecondLong = "s"
+	PHPDateFormatter.PMCapital = "A"
+	PHPDateFormatter.PMLower = "a"
+	PHPDateFormatter.TZ = "T"
+	PHPDateFormatter.NumColonTZ = "P"
+	PHPDateFormatter.NumTZLong = "O"
+
+	TimeFormatTranslators = map[string]*TimeFormatTranslator{
+		"moment":    MomentJSDateFormatter,
+		"strftime":  StrftimeDateFormatter,
+		"flatpickr": FlatpickrDateFormatter,
+		"cldr":      CLDRDateFormatter,
+		"php":       PHPDateFormatter,
+	}
+}
@@ -16,8 +16,6 @@ package pollsweb
 
 import (
 	"github.com/google/uuid"
-	"strings"
-	"sync"
 	"time"
 )
 
@@ -62,102 +60,3 @@ func GenUUID() (uuid.UUID, error) {
 func UTCNow() time.Time {
 	return time.Now().UTC()
 }
-
-type TimeFormatTranslator struct {
-	once          *sync.Once
-	replacer      *strings.Replacer
-	YearLong      string
-	YearShort     string
-	LongMonthStr  string
-	ShortMonthStr string
-	NumMonthLong  string
-	NumMonthShort string
-	WeekdayLong   string
-	WeekdayShort  string
-	DayLong       string
-	DayShort      string
-	Hour24        string
-	Hour12Long    string
-	Hour12Short   string
-	MinuteLong    string
-	MinuteShort   string
-	SecondLong    string
-	SecondShort   string
-	PMCapital     string
-	PMLower       string
-	TZ            string
-	NumColonTZ    string
-	NumTZLong     string
-	NumTZShort    string
-}
-
-func NewTimeFormatTranslator() *TimeFormatTranslator {
-	return &TimeFormatTranslator{
-		once: &sync.Once{},
-	}
-}
-
-func (f *TimeFormatTranslator) ConvertFormat(goFormat string) string {
-	f.once.Do(func() {
-		// note that the order matters: "2006" must be before "06" for example
-		replaceList := []string{
-			"2006", f.YearLong,
-			"06", f.YearShort,
-			"January", f.LongMonthStr,
-			"Jan", f.ShortMonthStr,
-			"15", f.Hour24, // this must be this high in the list because the "1" (numMonthShort) would replace it
-			"01", f.NumMonthLong,
-			"1", f.NumMonthShort,
-			"Monday", f.WeekdayLong,
-			"Mon", f.WeekdayShort,
-			"02", f.DayLong,
-			"2", f.DayShort,
-			"03", f.Hour12Long,
-			"3", f.Hour12Short,
-			"04", f.MinuteLong,
-			"4", f.MinuteShort,
-			"05", f.SecondLong,
-			"5", f.SecondShort,
-			"PM", f.PMCapital,
-			"pm", f.PMLower,
-			"MST", f.TZ,
-			"-07:00", f.NumColonTZ,
-			"-0700", f.NumTZLong,
-			"-07", f.NumTZShort,
-		}
-		f.replacer = strings.NewReplacer(replaceList...)
-	})
-	return f.replacer.Replace(goFormat)
-}
-
-var MomentJSDateFormatter *TimeFormatTranslator
-
-func init() {
-	MomentJSDateFormatter = &TimeFormatTranslator{
-		once:          &sync.Once{},
-		replacer:      nil,
-		YearLong:      "YYYY",
-		YearShort:     "YY",
-		LongMonthStr:  "MMMM",
-		ShortMonthStr: "MMM",
-		NumMonthLong:  "MM",
-		NumMonthShort: "M",
-		WeekdayLong:   "dddd",
-		WeekdayShort:  "ddd",
-		DayLong:       "DD",
-		DayShort:      "D",
-		Hour24:        "HH",
-		Hour12Long:    "hh",
-		Hour12Short:   "h",
-		MinuteLong:    "mm",
-		MinuteShort:   "m",
-		SecondLong:    "ss",
-		SecondShort:   "s",
-		PMCapital:     "A",
-		PMLower:       "a",
-		TZ:            "zz",
-		NumColonTZ:    "Z",
-		NumTZLong:     "ZZ",
-		NumTZShort:    "ZZ", // not really supported
-	}
-}